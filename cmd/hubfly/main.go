@@ -1,18 +1,37 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/hubfly/hubfly-reverse-proxy/internal/agent"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/api"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/dnscheck"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/geoip"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/notify"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/synthetic"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	// Setup structured logging
 	opts := &slog.HandlerOptions{
@@ -23,9 +42,60 @@ func main() {
 
 	configDir := flag.String("config-dir", "/etc/hubfly", "Directory for config and data")
 	port := flag.String("port", "81", "API listening port")
+	storeType := flag.String("store", "json", "Metadata store backend: json, sqlite or postgres")
+	storePath := flag.String("store-path", "", "Database file for --store=sqlite (default: <config-dir>/hubfly.db)")
+	storeDSN := flag.String("store-dsn", os.Getenv("HUBFLY_STORE_DSN"), "Connection string for --store=postgres (or HUBFLY_STORE_DSN)")
+	mirrorFrom := flag.String("mirror-from", "", "Primary API URL to replicate from (enables read-only standby mode)")
+	mirrorToken := flag.String("mirror-token", os.Getenv("HUBFLY_MIRROR_TOKEN"), "API key used to read from the primary (or HUBFLY_MIRROR_TOKEN)")
+	mirrorInterval := flag.Duration("mirror-interval", 30*time.Second, "How often a standby pulls state from the primary")
+	controlPlane := flag.Bool("control-plane", false, "Serve rendered configs to node agents under /v1/nodes")
+	agentOf := flag.String("agent-of", "", "Control plane API URL to pull configs from (runs as a node agent, without the API)")
+	agentToken := flag.String("agent-token", os.Getenv("HUBFLY_AGENT_TOKEN"), "API key used by the node agent (or HUBFLY_AGENT_TOKEN)")
+	agentBootstrap := flag.String("agent-bootstrap-token", os.Getenv("HUBFLY_AGENT_BOOTSTRAP_TOKEN"), "Bootstrap key a node agent without --agent-token exchanges for its own key on first start, saved in <config-dir>/agent.token (or HUBFLY_AGENT_BOOTSTRAP_TOKEN)")
+	nodeID := flag.String("node-id", "", "Name the node agent reports as (default: host name)")
+	agentInterval := flag.Duration("agent-interval", 10*time.Second, "How often a node agent pulls configs and reports status")
+	acmeServer := flag.String("acme-server", "", "ACME directory URL (default: Let's Encrypt)")
+	eabKeyID := flag.String("eab-kid", "", "ACME External Account Binding key ID")
+	eabHMACKey := flag.String("eab-hmac-key", os.Getenv("HUBFLY_EAB_HMAC_KEY"), "ACME External Account Binding HMAC key (or HUBFLY_EAB_HMAC_KEY)")
+	dnsPlugin := flag.String("dns-plugin", "", "Certbot DNS plugin for DNS-01 (e.g. cloudflare, route53)")
+	dnsCredentials := flag.String("dns-credentials", "", "Credentials file for the DNS plugin")
+	dnsPropagation := flag.Int("dns-propagation-seconds", 0, "Seconds to wait for DNS propagation (0 uses the plugin default)")
+	noPrechecks := flag.Bool("no-cert-prechecks", false, "Skip the CAA and AAAA checks run before each certificate request")
+	dnsResolver := flag.String("dns-resolver", "", "DNS server (host:port) for certificate prechecks (default: first nameserver in /etc/resolv.conf)")
+	dohURL := flag.String("upstream-doh-url", dnscheck.DefaultDoHURL, "DNS-over-HTTPS server (RFC 8484) that upstream hostnames are also resolved with in a site's runtime view (empty uses only the system resolver)")
+	logRetention := flag.Duration("log-retention", 0, "Purge site logs older than this (0 disables; sites may override)")
+	auditRetention := flag.Duration("audit-retention", 0, "Prune audit events older than this during maintenance, e.g. 2160h (0 keeps all)")
+	auditMaxEvents := flag.Int("audit-max-events", 0, "Keep at most this many audit events (0 keeps all)")
+	configVersions := flag.Int("config-versions", 0, "Keep at most this many config versions per site in the history (0 keeps all)")
+	maintenanceInterval := flag.Duration("maintenance-interval", 24*time.Hour, "How often the audit trail is pruned and the store compacted (0 disables)")
+	healthInterval := flag.Duration("health-interval", 10*time.Second, "How often sites with health checks probe their upstreams (0 disables)")
+	streamHealthInterval := flag.Duration("stream-health-interval", 15*time.Second, "How often stream upstreams are probed to keep stream status current (0 disables)")
+	balanceInterval := flag.Duration("balance-interval", 30*time.Second, "How often adaptive load balancing probes upstreams (0 disables)")
+	renewInterval := flag.Duration("renew-interval", 24*time.Hour, "How often certificates are checked for renewal (0 disables)")
+	renewBefore := flag.Duration("renew-before", certbot.DefaultRenewBefore, "Renew certificates expiring within this window")
+	expiryNotice := flag.Duration("expiry-notice", api.DefaultExpiryNotice, "Warn notify webhooks this long before a site or stream expires (0 disables; expiries may override)")
+	keyRotation := flag.Duration("key-rotation", 0, "Re-issue certificates with a new private key once the key is this old, e.g. 2160h (0 disables; sites may override)")
+	canaryAddr := flag.String("canary-addr", nginx.DefaultCanaryAddr, "nginx HTTP listener that canary requests are sent to after each site config apply (empty disables)")
+	deployCheck := flag.String("cert-check-hosts", strings.Join(nginx.DefaultDeployCheckHosts, ","), "Comma-separated local addresses that are probed for the new certificate after each issuance or renewal (empty disables)")
+	notifyWebhooks := flag.String("notify-webhooks", os.Getenv("HUBFLY_NOTIFY_WEBHOOKS"), "Comma-separated URLs that alerts, such as a synthetic check going down, are POSTed to as JSON (or HUBFLY_NOTIFY_WEBHOOKS)")
+	maxBody := flag.String("client-max-body-size", nginx.DefaultClientMaxBodySize, "Request body limit of sites without their own, e.g. 500m (0 disables the limit)")
+	hygiene := flag.String("connection-hygiene", "", "Connection hygiene preset for sites without their own (hardened; default: nginx defaults)")
+	geoipDB := flag.String("geoip-db", "", "MaxMind DB (.mmdb) used to locate clients in logs and for firewall country rules (default: <config-dir>/geoip.mmdb if present)")
+	noGeoIP := flag.Bool("no-geoip", false, "Never look up client locations, even if a GeoIP database is present")
+	chaos := flag.Bool("chaos", false, "Enable failure injection via /v1/debug/faults (testing only)")
+	checkHostPorts := flag.Bool("check-host-ports", false, "Refuse stream ports that another process on the host already listens on")
+	debugAddr := flag.String("debug-addr", "", "Loopback address for the pprof/expvar debug listener, e.g. 127.0.0.1:6060 (disabled when empty)")
+	adminToken := flag.String("admin-token", os.Getenv("HUBFLY_ADMIN_TOKEN"), "Static full-admin API token (or HUBFLY_ADMIN_TOKEN)")
 	flag.Parse()
 
-	slog.Info("Initializing Hubfly...", "config_dir", *configDir, "port", *port)
+	slog.Info("Initializing Hubfly...", "version", version, "config_dir", *configDir, "port", *port)
+
+	if *debugAddr != "" {
+		if err := api.CheckDebugAddr(*debugAddr); err != nil {
+			slog.Error("Refusing to start debug listener", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Ensure config dir exists
 	if err := os.MkdirAll(*configDir, 0755); err != nil {
@@ -33,34 +103,246 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Initialize Store
-	st, err := store.NewJSONStore(*configDir)
-	if err != nil {
-		slog.Error("Failed to initialize store", "error", err)
-		os.Exit(1)
-	}
-
 	// Initialize Nginx Manager
 	nm := nginx.NewManager(*configDir)
+	nm.GeoIPDB = geoipPath(*geoipDB, *configDir)
+	nm.CanaryAddr = *canaryAddr
+	nm.AuthAddr = "127.0.0.1:" + *port
+	nm.DeployCheckHosts = splitList(*deployCheck)
+	if err := nginx.CheckBodySize(*maxBody); err != nil {
+		slog.Error("Invalid --client-max-body-size", "error", err)
+		os.Exit(1)
+	}
+	nm.ClientMaxBodySize = *maxBody
+	if *hygiene != "" {
+		def := &models.ConnectionHygiene{Preset: *hygiene}
+		if err := nginx.CheckHygiene(def); err != nil {
+			slog.Error("Invalid --connection-hygiene", "error", err)
+			os.Exit(1)
+		}
+		nm.DefaultHygiene = def
+	}
 	if err := nm.EnsureDirs(); err != nil {
 		slog.Error("Failed to create nginx dirs", "error", err)
 		os.Exit(1)
 	}
 
+	// Node agents only apply what the control plane renders
+	if *agentOf != "" {
+		ag, err := agent.New(*agentOf, *agentToken, *nodeID, nm)
+		if err != nil {
+			slog.Error("Failed to start node agent", "error", err)
+			os.Exit(1)
+		}
+		ag.Version = version
+		if *agentInterval > 0 {
+			ag.Interval = *agentInterval
+		}
+		if *agentBootstrap != "" {
+			if err := ag.Bootstrap(context.Background(), *agentBootstrap, filepath.Join(*configDir, "agent.token")); err != nil {
+				slog.Error("Failed to bootstrap node agent", "error", err)
+				os.Exit(1)
+			}
+		}
+		ag.Run(context.Background())
+		return
+	}
+
+	// Initialize Store
+	st, err := openStore(*storeType, *storePath, *storeDSN, *configDir)
+	if err != nil {
+		slog.Error("Failed to initialize store", "store", *storeType, "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize Certbot Manager
 	// We assume webroot at /var/www/hubfly as per design
 	cm := certbot.NewManager("/var/www/hubfly", "cert-support@hubfly.app")
+	cm.Server = *acmeServer
+	cm.EABKeyID = *eabKeyID
+	cm.EABHMACKey = *eabHMACKey
+	cm.DNSPlugin = *dnsPlugin
+	cm.DNSCredentials = *dnsCredentials
+	cm.DNSPropagation = *dnsPropagation
+	cm.Prechecks = !*noPrechecks
+	cm.Resolver = *dnsResolver
+
+	// Chaos mode: route side effects through the fault injector
+	var inj *faults.Injector
+	if *chaos {
+		slog.Warn("Chaos mode enabled: failures can be injected via /v1/debug/faults")
+		inj = faults.NewInjector()
+		st = store.NewFaultStore(st, inj)
+		nm.Faults = inj
+		cm.Faults = inj
+	}
 
 	// Initialize Log Manager
 	lm := logmanager.NewManager("/var/log/hubfly")
+	if !*noGeoIP {
+		lm.GeoIP = openGeoIP(geoipPath(*geoipDB, *configDir))
+	}
 
 	// Initialize API Server
 	srv := api.NewServer(st, nm, cm, lm)
+	srv.Version = version
+	srv.AdminToken = *adminToken
+	srv.ControlPlane = *controlPlane
+	srv.KeyRotation = *keyRotation
+	srv.Faults = inj
+	srv.DNS.DoHURL = *dohURL
+	srv.Ports.CheckHost = *checkHostPorts
+	if err := srv.Ports.ReserveAddr(":"+*port, "the hubfly API"); err != nil {
+		slog.Error("Invalid --port", "error", err)
+		os.Exit(1)
+	}
+	if *debugAddr != "" {
+		if err := srv.Ports.ReserveAddr(*debugAddr, "the debug listener"); err != nil {
+			slog.Error("Invalid --debug-addr", "error", err)
+			os.Exit(1)
+		}
+	}
+	srv.Audit = audit.NewLogger(filepath.Join(*configDir, "audit.log"))
+	srv.AuditRetention = audit.Retention{MaxAge: *auditRetention, MaxEvents: *auditMaxEvents, ConfigVersions: *configVersions}
+	srv.Synthetics = synthetic.NewRecorder(filepath.Join(*configDir, "synthetics"))
+	srv.Notify = notify.NewNotifier(splitList(*notifyWebhooks))
+	srv.StartLogRetention(*logRetention, time.Hour)
+	srv.StartHealthChecks(*healthInterval)
+	srv.StartStreamHealthChecks(*streamHealthInterval)
+	srv.StartBalancer(*balanceInterval)
+
+	if *mirrorFrom != "" {
+		srv.StartMirror(*mirrorFrom, *mirrorToken, *mirrorInterval)
+	}
+	srv.StartCertRenewal(*renewInterval, *renewBefore)
+	srv.StartRateSchedules()
+	srv.StartSynthetics()
+	srv.StartCaptures()
+	srv.StartDrains()
+	srv.StartExpiry(*expiryNotice)
+	srv.StartUsageFlush()
+	srv.StartMaintenance(*maintenanceInterval)
+
+	if *debugAddr != "" {
+		go func() {
+			slog.Warn("Debug listener starting (pprof, expvar)", "address", *debugAddr)
+			if err := http.ListenAndServe(*debugAddr, srv.DebugRoutes()); err != nil {
+				slog.Error("Debug listener failed", "error", err)
+			}
+		}()
+	}
 
 	slog.Info("Hubfly API starting", "address", ":"+*port)
 
-	if err := http.ListenAndServe(":"+*port, srv.Routes()); err != nil {
+	apiServer := &http.Server{Addr: ":" + *port, Handler: srv.Routes(), ConnState: srv.ConnState}
+	// On SIGTERM (docker stop), finish the requests in flight and save
+	// what is only kept in memory, such as API key usage.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	idle := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		apiServer.Shutdown(shutdown)
+		close(idle)
+	}()
+	if err := apiServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Server failed", "error", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+	<-idle
+	srv.FlushKeyUsage()
+	slog.Info("Hubfly API stopped")
+}
+
+// openStore opens the configured metadata backend. A new, empty database is
+// seeded from the JSON files in configDir, if there are any.
+func openStore(kind, path, dsn, configDir string) (store.Store, error) {
+	switch kind {
+	case "json":
+		return store.NewJSONStore(configDir)
+	case "sqlite":
+		if path == "" {
+			path = filepath.Join(configDir, "hubfly.db")
+		}
+		st, err := store.NewSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateJSON(st, configDir); err != nil {
+			st.Close()
+			return nil, err
+		}
+		return st, nil
+	case "postgres":
+		st, err := store.NewPostgresStore(dsn, store.DefaultPostgresOptions)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateJSON(st, configDir); err != nil {
+			st.Close()
+			return nil, err
+		}
+		return st, nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", kind)
+	}
+}
+
+func migrateJSON(st *store.SQLStore, configDir string) error {
+	empty, err := st.Empty()
+	if err != nil || !empty {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "metadata.json")); err != nil {
+		if _, err := os.Stat(filepath.Join(configDir, "streams.json")); err != nil {
+			return nil
+		}
+	}
+	n, err := store.MigrateFromJSON(st, configDir)
+	if err != nil {
+		return fmt.Errorf("migrate from json: %w", err)
+	}
+	slog.Info("Migrated JSON store", "records", n, "from", configDir)
+	return nil
+}
+
+// geoipPath is the GeoIP database to use: the explicit path, or the
+// default location if a database is there. Empty means none.
+func geoipPath(path, configDir string) string {
+	if path != "" {
+		return path
+	}
+	path = filepath.Join(configDir, "geoip.mmdb")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// openGeoIP loads the GeoIP database used to annotate logs. An unreadable
+// path is logged and lookups are disabled.
+func openGeoIP(path string) *geoip.DB {
+	if path == "" {
+		return nil
+	}
+	db, err := geoip.Open(path)
+	if err != nil {
+		slog.Error("Failed to load GeoIP database, client locations disabled", "path", path, "error", err)
+		return nil
+	}
+	slog.Info("GeoIP database loaded", "path", path, "type", db.Type)
+	return db
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
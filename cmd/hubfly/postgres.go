@@ -0,0 +1,6 @@
+//go:build postgres
+
+package main
+
+// Registers the pgx driver for --store=postgres.
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// Registers the pure-Go SQLite driver for --store=sqlite.
+import _ "modernc.org/sqlite"
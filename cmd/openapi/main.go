@@ -0,0 +1,25 @@
+// Command openapi writes the API's OpenAPI 3 document to stdout, for client
+// generation without a running instance.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/api"
+)
+
+func main() {
+	version := flag.String("version", "dev", "Version reported in the document")
+	chaos := flag.Bool("chaos", false, "Include the /v1/debug endpoints")
+	flag.Parse()
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(api.OpenAPI(*version, *chaos)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
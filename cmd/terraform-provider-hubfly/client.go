@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client talks to the hubfly API.
+type client struct {
+	endpoint string
+	apiKey   string
+	http     *http.Client
+}
+
+func newClient(endpoint, apiKey string) *client {
+	// Creates wait for certificate issuance, which can take minutes.
+	return &client{endpoint: strings.TrimSuffix(endpoint, "/"), apiKey: apiKey, http: &http.Client{Timeout: 10 * time.Minute}}
+}
+
+// apiError is an error answer of the API.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("hubfly API: %d %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.Status == http.StatusNotFound
+}
+
+// siteSpec holds the site fields the provider manages. Every field is sent
+// on update so clearing one in the configuration clears it in hubfly;
+// fields not listed here are left as they are.
+type siteSpec struct {
+	ID          string   `json:"id,omitempty"`
+	Domain      string   `json:"domain"`
+	Aliases     []string `json:"aliases"`
+	Upstreams   []string `json:"upstreams"`
+	SSL         bool     `json:"ssl"`
+	ForceSSL    bool     `json:"force_ssl"`
+	Templates   []string `json:"templates"`
+	ExtraConfig string   `json:"extra_config"`
+}
+
+// siteComputed holds the fields hubfly sets itself.
+type siteComputed struct {
+	Status        string     `json:"status"`
+	ErrorMessage  string     `json:"error_message"`
+	CertExpiresAt *time.Time `json:"cert_expires_at"`
+}
+
+// siteState is GET /v1/sites/{id}/state.
+type siteState struct {
+	ID       string       `json:"id"`
+	Spec     siteSpec     `json:"spec"`
+	Computed siteComputed `json:"computed"`
+}
+
+// site is a site as POST and PATCH return it.
+type site struct {
+	siteSpec
+	siteComputed
+}
+
+// siteDrift is GET /v1/sites/{id}/drift.
+type siteDrift struct {
+	InSync  bool   `json:"in_sync"`
+	Missing bool   `json:"missing"`
+	Diff    string `json:"diff"`
+}
+
+// CreateSite creates a site and waits until it is applied.
+func (c *client) CreateSite(ctx context.Context, spec siteSpec) (*site, error) {
+	var out site
+	err := c.do(ctx, http.MethodPost, "/v1/sites?wait=true", spec, &out)
+	return &out, err
+}
+
+// UpdateSite updates a site and waits until it is applied.
+func (c *client) UpdateSite(ctx context.Context, id string, spec siteSpec) (*site, error) {
+	spec.ID = "" // Not updatable
+	var out site
+	err := c.do(ctx, http.MethodPatch, "/v1/sites/"+url.PathEscape(id)+"?wait=true", spec, &out)
+	return &out, err
+}
+
+func (c *client) SiteState(ctx context.Context, id string) (*siteState, error) {
+	var out siteState
+	err := c.do(ctx, http.MethodGet, "/v1/sites/"+url.PathEscape(id)+"/state", nil, &out)
+	return &out, err
+}
+
+func (c *client) SiteDrift(ctx context.Context, id string) (*siteDrift, error) {
+	var out siteDrift
+	err := c.do(ctx, http.MethodGet, "/v1/sites/"+url.PathEscape(id)+"/drift", nil, &out)
+	return &out, err
+}
+
+func (c *client) DeleteSite(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/sites/"+url.PathEscape(id), nil, nil)
+}
+
+// SiteIDByDomain finds the site serving domain, as its domain or an alias.
+func (c *client) SiteIDByDomain(ctx context.Context, domain string) (string, error) {
+	var sites []site
+	if err := c.do(ctx, http.MethodGet, "/v1/sites?domain="+url.QueryEscape(domain), nil, &sites); err != nil {
+		return "", err
+	}
+	if len(sites) == 0 {
+		return "", &apiError{Status: http.StatusNotFound, Message: "no site serves " + domain}
+	}
+	return sites[0].ID, nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(data))
+		}
+		return &apiError{Status: resp.StatusCode, Message: e.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
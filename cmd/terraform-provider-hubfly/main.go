@@ -0,0 +1,31 @@
+// Command terraform-provider-hubfly is a reference Terraform provider for
+// the hubfly API. It manages sites with the hubfly_site resource; see
+// README.md.
+//
+// It is a module of its own so the proxy keeps building from the standard
+// library alone: run go mod tidy in this directory before building it.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+func main() {
+	debug := flag.Bool("debug", false, "Run with support for debuggers such as delve")
+	flag.Parse()
+
+	err := providerserver.Serve(context.Background(), newProvider(version), providerserver.ServeOpts{
+		Address: "registry.terraform.io/hubfly/hubfly",
+		Debug:   *debug,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
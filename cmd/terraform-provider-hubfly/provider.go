@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// defaultEndpoint is the API address of a local hubfly.
+const defaultEndpoint = "http://localhost:81"
+
+type hubflyProvider struct {
+	version string
+}
+
+type providerModel struct {
+	Endpoint types.String `tfsdk:"endpoint"`
+	APIKey   types.String `tfsdk:"api_key"`
+}
+
+func newProvider(version string) func() provider.Provider {
+	return func() provider.Provider {
+		return &hubflyProvider{version: version}
+	}
+}
+
+func (p *hubflyProvider) Metadata(_ context.Context, _ provider.MetadataRequest, resp *provider.MetadataResponse) {
+	resp.TypeName = "hubfly"
+	resp.Version = p.version
+}
+
+func (p *hubflyProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp *provider.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manages sites of a hubfly reverse proxy.",
+		Attributes: map[string]schema.Attribute{
+			"endpoint": schema.StringAttribute{
+				Description: "API URL (or HUBFLY_ENDPOINT; default " + defaultEndpoint + ").",
+				Optional:    true,
+			},
+			"api_key": schema.StringAttribute{
+				Description: "API key with the sites-admin role (or HUBFLY_API_KEY). Not needed when auth is off.",
+				Optional:    true,
+				Sensitive:   true,
+			},
+		},
+	}
+}
+
+func (p *hubflyProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	var cfg providerModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &cfg)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	endpoint := configured(cfg.Endpoint, os.Getenv("HUBFLY_ENDPOINT"))
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	c := newClient(endpoint, configured(cfg.APIKey, os.Getenv("HUBFLY_API_KEY")))
+	resp.ResourceData = c
+	resp.DataSourceData = c
+}
+
+func (p *hubflyProvider) Resources(context.Context) []func() resource.Resource {
+	return []func() resource.Resource{newSiteResource}
+}
+
+func (p *hubflyProvider) DataSources(context.Context) []func() datasource.DataSource {
+	return nil
+}
+
+// configured is v when it is set in the configuration, otherwise env.
+func configured(v types.String, env string) string {
+	if v.IsNull() || v.IsUnknown() {
+		return env
+	}
+	return v.ValueString()
+}
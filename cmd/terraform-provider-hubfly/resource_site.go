@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var (
+	_ resource.Resource                = (*siteResource)(nil)
+	_ resource.ResourceWithConfigure   = (*siteResource)(nil)
+	_ resource.ResourceWithImportState = (*siteResource)(nil)
+)
+
+// siteResource is hubfly_site. Creates and updates wait for the site to be
+// applied (?wait=true), so the state written afterwards is what hubfly
+// serves; reads use the state endpoint, which keeps hubfly's computed
+// fields apart from those in the configuration.
+type siteResource struct {
+	client *client
+}
+
+type siteModel struct {
+	ID            types.String `tfsdk:"id"`
+	Domain        types.String `tfsdk:"domain"`
+	Aliases       types.List   `tfsdk:"aliases"`
+	Upstreams     types.List   `tfsdk:"upstreams"`
+	SSL           types.Bool   `tfsdk:"ssl"`
+	ForceSSL      types.Bool   `tfsdk:"force_ssl"`
+	Templates     types.List   `tfsdk:"templates"`
+	ExtraConfig   types.String `tfsdk:"extra_config"`
+	Status        types.String `tfsdk:"status"`
+	CertExpiresAt types.String `tfsdk:"cert_expires_at"`
+}
+
+func newSiteResource() resource.Resource {
+	return &siteResource{}
+}
+
+func (r *siteResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_site"
+}
+
+func (r *siteResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "A site: server names proxied to upstreams, optionally with a Let's Encrypt certificate. Settings not managed here are left as they are.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Description: "Site ID; defaults to the domain.",
+				Optional:    true,
+				Computed:    true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"domain": schema.StringAttribute{
+				Description: "Primary server name, in ASCII (punycode) form.",
+				Required:    true,
+			},
+			"aliases": schema.ListAttribute{
+				Description: "Additional server names.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"upstreams": schema.ListAttribute{
+				Description: "Backends as host:port.",
+				ElementType: types.StringType,
+				Required:    true,
+			},
+			"ssl": schema.BoolAttribute{
+				Description: "Issue a certificate and serve HTTPS.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+			},
+			"force_ssl": schema.BoolAttribute{
+				Description: "Redirect HTTP to HTTPS; needs ssl.",
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+			},
+			"templates": schema.ListAttribute{
+				Description: "Config snippets included in the server block.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"extra_config": schema.StringAttribute{
+				Description: "Raw nginx directives appended to the server block.",
+				Optional:    true,
+			},
+			"status": schema.StringAttribute{
+				Description: "Provisioning status: active, error or cert-failed.",
+				Computed:    true,
+			},
+			"cert_expires_at": schema.StringAttribute{
+				Description: "Expiry of the served certificate (RFC 3339).",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func (r *siteResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return // Not configured yet
+	}
+	c, ok := req.ProviderData.(*client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected provider data", fmt.Sprintf("expected *client, got %T", req.ProviderData))
+		return
+	}
+	r.client = c
+}
+
+func (r *siteResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan siteModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	spec := specFromModel(ctx, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if !plan.ID.IsUnknown() {
+		spec.ID = plan.ID.ValueString()
+	}
+
+	s, err := r.client.CreateSite(ctx, spec)
+	if err != nil {
+		resp.Diagnostics.AddError("Creating site failed", err.Error())
+		return
+	}
+	plan.ID = types.StringValue(s.ID)
+	setComputed(&plan, s.siteComputed)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+	checkApplied(s, &resp.Diagnostics)
+}
+
+func (r *siteResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state siteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	s, err := r.client.SiteState(ctx, state.ID.ValueString())
+	if isNotFound(err) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError("Reading site failed", err.Error())
+		return
+	}
+	state.ID = types.StringValue(s.ID)
+	state.Domain = types.StringValue(s.Spec.Domain)
+	state.Aliases = listValue(ctx, s.Spec.Aliases, state.Aliases, &resp.Diagnostics)
+	state.Upstreams = listValue(ctx, s.Spec.Upstreams, state.Upstreams, &resp.Diagnostics)
+	state.SSL = types.BoolValue(s.Spec.SSL)
+	state.ForceSSL = types.BoolValue(s.Spec.ForceSSL)
+	state.Templates = listValue(ctx, s.Spec.Templates, state.Templates, &resp.Diagnostics)
+	state.ExtraConfig = stringValue(s.Spec.ExtraConfig, state.ExtraConfig)
+	setComputed(&state, s.Computed)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+
+	// A live config that differs from the stored site is invisible to the
+	// plan; say so instead.
+	if s.Computed.Status == "active" {
+		if d, err := r.client.SiteDrift(ctx, s.ID); err == nil && !d.InSync {
+			resp.Diagnostics.AddWarning("Live nginx config differs from the site",
+				fmt.Sprintf("Site %s was changed in nginx outside hubfly, or its last apply failed; an apply of any change re-renders it.\n\n%s", s.ID, d.Diff))
+		}
+	}
+}
+
+func (r *siteResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan siteModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	spec := specFromModel(ctx, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	s, err := r.client.UpdateSite(ctx, plan.ID.ValueString(), spec)
+	if err != nil {
+		resp.Diagnostics.AddError("Updating site failed", err.Error())
+		return
+	}
+	setComputed(&plan, s.siteComputed)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+	checkApplied(s, &resp.Diagnostics)
+}
+
+func (r *siteResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state siteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if err := r.client.DeleteSite(ctx, state.ID.ValueString()); err != nil && !isNotFound(err) {
+		resp.Diagnostics.AddError("Deleting site failed", err.Error())
+	}
+}
+
+// ImportState imports a site by ID or by a domain it serves.
+func (r *siteResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	id := req.ID
+	if _, err := r.client.SiteState(ctx, id); isNotFound(err) {
+		if id, err = r.client.SiteIDByDomain(ctx, req.ID); err != nil {
+			resp.Diagnostics.AddError("Importing site failed", err.Error())
+			return
+		}
+	}
+	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("id"), id)...)
+}
+
+func specFromModel(ctx context.Context, m *siteModel, diags *diag.Diagnostics) siteSpec {
+	spec := siteSpec{
+		Domain:      m.Domain.ValueString(),
+		SSL:         m.SSL.ValueBool(),
+		ForceSSL:    m.ForceSSL.ValueBool(),
+		ExtraConfig: m.ExtraConfig.ValueString(),
+		Aliases:     []string{},
+		Templates:   []string{},
+	}
+	for _, l := range []struct {
+		list types.List
+		into *[]string
+	}{{m.Aliases, &spec.Aliases}, {m.Upstreams, &spec.Upstreams}, {m.Templates, &spec.Templates}} {
+		if !l.list.IsNull() && !l.list.IsUnknown() {
+			diags.Append(l.list.ElementsAs(ctx, l.into, false)...)
+		}
+	}
+	return spec
+}
+
+func setComputed(m *siteModel, c siteComputed) {
+	m.Status = types.StringValue(c.Status)
+	m.CertExpiresAt = types.StringNull()
+	if c.CertExpiresAt != nil {
+		m.CertExpiresAt = types.StringValue(c.CertExpiresAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// checkApplied fails the apply when hubfly saved the site but could not put
+// it live: the state is kept, so the next apply retries.
+func checkApplied(s *site, diags *diag.Diagnostics) {
+	if s.Status == "active" {
+		return
+	}
+	diags.AddError("Site was not applied", fmt.Sprintf("site %s is %s: %s", s.ID, s.Status, s.ErrorMessage))
+}
+
+// listValue is values as a list. hubfly omits empty lists, so an empty
+// value keeps an empty list from prior rather than reading back as null.
+func listValue(ctx context.Context, values []string, prior types.List, diags *diag.Diagnostics) types.List {
+	if len(values) == 0 {
+		if !prior.IsNull() && !prior.IsUnknown() && len(prior.Elements()) == 0 {
+			return prior
+		}
+		return types.ListNull(types.StringType)
+	}
+	l, d := types.ListValueFrom(ctx, types.StringType, values)
+	diags.Append(d...)
+	return l
+}
+
+// stringValue is listValue for strings: "" stays "" or null as in prior.
+func stringValue(v string, prior types.String) types.String {
+	if v == "" && (prior.IsNull() || prior.IsUnknown()) {
+		return types.StringNull()
+	}
+	return types.StringValue(v)
+}
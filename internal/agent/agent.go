@@ -0,0 +1,258 @@
+// Package agent runs hubfly as a node agent: it pulls rendered configs from
+// a control plane, applies them to the local nginx and reports back.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+var nodeIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidNodeID reports whether id can name a node.
+func ValidNodeID(id string) bool {
+	return nodeIDPattern.MatchString(id)
+}
+
+// Report is what an agent tells the control plane after each sync.
+type Report struct {
+	NodeID        string            `json:"node_id"`
+	Hostname      string            `json:"hostname,omitempty"`
+	AgentVersion  string            `json:"agent_version,omitempty"`
+	ConfigVersion string            `json:"config_version,omitempty"` // Bundle version nginx is running
+	AppliedAt     time.Time         `json:"applied_at,omitempty"`
+	Error         string            `json:"error,omitempty"` // Why the latest bundle was not applied
+	Interval      int               `json:"interval_seconds"`
+	Reloads       nginx.ReloadStats `json:"reloads"`
+	Nginx         *nginx.StubStatus `json:"nginx,omitempty"`
+}
+
+// Agent keeps one node in step with a control plane.
+type Agent struct {
+	ControlPlane string // Base URL of the control plane API
+	Token        string // API key with the node-agent (or full-admin) role
+	NodeID       string
+	Interval     time.Duration
+	Version      string // Reported as agent_version
+
+	Nginx  *nginx.Manager
+	Client *http.Client
+
+	mu        sync.Mutex
+	attempted string // Latest bundle version fetched, applied or not
+	applied   string
+	appliedAt time.Time
+	lastErr   string
+}
+
+// New returns an agent for nodeID; it defaults to the host name.
+func New(controlPlane, token, nodeID string, nm *nginx.Manager) (*Agent, error) {
+	if nodeID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("node id: %w", err)
+		}
+		nodeID = host
+	}
+	if !ValidNodeID(nodeID) {
+		return nil, fmt.Errorf("invalid node id %q: use letters, digits, '.', '_' and '-'", nodeID)
+	}
+	a := &Agent{
+		ControlPlane: strings.TrimRight(controlPlane, "/"),
+		Token:        token,
+		NodeID:       nodeID,
+		Interval:     10 * time.Second,
+		Version:      "dev",
+		Nginx:        nm,
+		Client:       &http.Client{Timeout: 15 * time.Second},
+	}
+	// Whatever is on disk already counts as applied, so a restart with an
+	// unchanged bundle doesn't reload nginx.
+	if b, err := nm.Bundle(); err == nil {
+		a.applied = b.Version
+	}
+	return a, nil
+}
+
+// Bootstrap gives the agent a token of its own. Without Token set, it reuses
+// the token saved in tokenFile or, on first start, exchanges bootstrapKey
+// at the control plane for a key named after the node and saves its token
+// there. Bootstrap keys work once, so the file must survive restarts.
+func (a *Agent) Bootstrap(ctx context.Context, bootstrapKey, tokenFile string) error {
+	if a.Token != "" {
+		return nil
+	}
+	if data, err := os.ReadFile(tokenFile); err == nil {
+		a.Token = strings.TrimSpace(string(data))
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"name": "node-agent " + a.NodeID})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.ControlPlane+"/v1/bootstrap", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+bootstrapKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("bootstrap: control plane returned %d", resp.StatusCode)
+	}
+	var key struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	if err := os.WriteFile(tokenFile, []byte(key.Token+"\n"), 0600); err != nil {
+		return fmt.Errorf("bootstrap: saving the token (key %s) failed: %w", key.ID, err)
+	}
+	slog.Info("Node agent bootstrapped", "key_id", key.ID, "token_file", tokenFile)
+	a.Token = key.Token
+	return nil
+}
+
+// Run syncs and reports every Interval until ctx is done.
+func (a *Agent) Run(ctx context.Context) {
+	slog.Info("Node agent starting", "node_id", a.NodeID, "control_plane", a.ControlPlane, "interval", a.Interval)
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		if err := a.Sync(ctx); err != nil {
+			slog.Error("Node sync failed", "control_plane", a.ControlPlane, "error", err)
+		}
+		if err := a.report(ctx); err != nil {
+			slog.Error("Node status report failed", "control_plane", a.ControlPlane, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync fetches the node's bundle and applies it when it changed. A bundle
+// that failed to apply is not retried until the control plane has a new
+// one.
+func (a *Agent) Sync(ctx context.Context) error {
+	a.mu.Lock()
+	etag := a.attempted
+	a.mu.Unlock()
+
+	req, err := a.request(ctx, http.MethodGet, "/config", nil)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", `"`+etag+`"`)
+	}
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch config: control plane returned %d", resp.StatusCode)
+	}
+	var b nginx.ConfigBundle
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+
+	err = a.Nginx.ApplyBundle(&b)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.attempted = b.Version
+	if err != nil {
+		a.lastErr = err.Error()
+		return fmt.Errorf("apply bundle %s: %w", b.Version, err)
+	}
+	if a.applied != b.Version {
+		slog.Info("Applied config bundle", "version", b.Version)
+		a.applied = b.Version
+		a.appliedAt = time.Now()
+	}
+	a.lastErr = ""
+	return nil
+}
+
+// Report describes the node's current state.
+func (a *Agent) Report(ctx context.Context) Report {
+	host, _ := os.Hostname()
+	r := Report{
+		NodeID:       a.NodeID,
+		Hostname:     host,
+		AgentVersion: a.Version,
+		Interval:     int(a.Interval / time.Second),
+		Reloads:      a.Nginx.ReloadStats(),
+	}
+	if st, err := a.Nginx.StubStatus(ctx); err == nil {
+		r.Nginx = st
+	}
+	a.mu.Lock()
+	r.ConfigVersion = a.applied
+	r.AppliedAt = a.appliedAt
+	r.Error = a.lastErr
+	a.mu.Unlock()
+	return r
+}
+
+func (a *Agent) report(ctx context.Context) error {
+	body, err := json.Marshal(a.Report(ctx))
+	if err != nil {
+		return err
+	}
+	req, err := a.request(ctx, http.MethodPost, "/status", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("control plane returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (a *Agent) request(ctx context.Context, method, suffix string, body []byte) (*http.Request, error) {
+	u := a.ControlPlane + "/v1/nodes/" + url.PathEscape(a.NodeID) + suffix
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	return req, nil
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+func TestSyncAndReport(t *testing.T) {
+	src := nginx.NewManager(t.TempDir())
+	src.EnsureDirs()
+	os.WriteFile(src.SiteConfigFile("a.local"), []byte("server { server_name a.local; }\n"), 0644)
+	bundle, err := src.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches, notModified int
+	var report Report
+	cp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(401)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/nodes/edge-1/config":
+			fetches++
+			if r.Header.Get("If-None-Match") == `"`+bundle.Version+`"` {
+				notModified++
+				w.WriteHeader(304)
+				return
+			}
+			json.NewEncoder(w).Encode(bundle)
+		case "/v1/nodes/edge-1/status":
+			json.NewDecoder(r.Body).Decode(&report)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer cp.Close()
+
+	dst := nginx.NewManager(t.TempDir())
+	dst.EnsureDirs()
+	var a *Agent
+	dst.StatusURL = cp.URL + "/nginx_status"
+	a, err = New(cp.URL+"/", "tok", "edge-1", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := a.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 2 || notModified != 1 {
+		t.Errorf("Expected the second sync to be answered with 304, got %d fetches, %d not modified", fetches, notModified)
+	}
+	if _, err := os.Stat(dst.SiteConfigFile("a.local")); err != nil {
+		t.Errorf("Expected the site config to be applied: %v", err)
+	}
+	if err := a.report(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report.NodeID != "edge-1" || report.ConfigVersion != bundle.Version || report.Error != "" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	if _, err := New(cp.URL, "", "bad/id", dst); err == nil {
+		t.Errorf("Expected an invalid node id to be rejected")
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	exchanges := 0
+	cp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/bootstrap" || r.Header.Get("Authorization") != "Bearer hfk_boot.1" {
+			w.WriteHeader(401)
+			return
+		}
+		exchanges++
+		w.WriteHeader(201)
+		w.Write([]byte(`{"id": "k1", "token": "hfk_k1.secret"}`))
+	}))
+	defer cp.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "agent.token")
+	for i := 0; i < 2; i++ {
+		a, err := New(cp.URL, "", "edge-1", nginx.NewManager(t.TempDir()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Bootstrap(context.Background(), "hfk_boot.1", tokenFile); err != nil {
+			t.Fatal(err)
+		}
+		if a.Token != "hfk_k1.secret" {
+			t.Errorf("Expected the exchanged token, got %q", a.Token)
+		}
+	}
+	if exchanges != 1 {
+		t.Errorf("Expected the saved token to be reused after a restart, got %d exchanges", exchanges)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestEABKeyWriteOnly(t *testing.T) {
+	s := newTestServer(t)
+	watch := "/v1/watch?timeout=0&since=" + strconv.FormatUint(s.Watch.Revision(), 10)
+	body := `{"id": "z", "domain": "z.example.com", "upstreams": ["app:80"],
+		"acme": {"server": "https://acme.zerossl.com/v2/DV90", "eab_kid": "kid", "eab_hmac_key": "s3cret-hmac"}}`
+	if rec := serve(s, "POST", "/v1/sites?wait=true", body); rec.Code != 201 {
+		t.Fatalf("POST failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, target := range []string{"/v1/sites", "/v1/sites/z", "/v1/sites/z/state", "/v1/export", watch} {
+		rec := serve(s, "GET", target, "")
+		if rec.Code != 200 {
+			t.Fatalf("GET %s: %d %s", target, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), "z.example.com") {
+			t.Fatalf("GET %s doesn't return the site: %s", target, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "s3cret-hmac") {
+			t.Errorf("GET %s returns the EAB HMAC key", target)
+		}
+		if target != watch && !strings.Contains(rec.Body.String(), `"eab_hmac_key_set":true`) {
+			t.Errorf("GET %s doesn't report the key as set: %s", target, rec.Body.String())
+		}
+	}
+
+	// The key stays stored, and a PATCH of the same key ID keeps it
+	rec := serve(s, "PATCH", "/v1/sites/z?wait=true", `{"acme": {"server": "https://acme.zerossl.com/v2/DV90", "eab_kid": "kid"}}`)
+	if rec.Code != 200 || strings.Contains(rec.Body.String(), "s3cret-hmac") {
+		t.Fatalf("PATCH failed or returned the key: %d %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := s.Store.GetSite("z")
+	if stored.ACME == nil || stored.ACME.EABHMACKey != "s3cret-hmac" {
+		t.Errorf("PATCH of the same key ID lost the HMAC key: %+v", stored.ACME)
+	}
+	if opts := issueOptions(stored); opts.EABHMACKey != "s3cret-hmac" {
+		t.Errorf("Issuance doesn't get the key: %+v", opts)
+	}
+
+	// A new key ID needs its own HMAC key
+	serve(s, "PATCH", "/v1/sites/z?wait=true", `{"acme": {"eab_kid": "other"}}`)
+	stored, _ = s.Store.GetSite("z")
+	if stored.ACME.EABHMACKey != "" {
+		t.Error("HMAC key carried over to another key ID")
+	}
+}
+
+func TestSiteRedacted(t *testing.T) {
+	site := models.Site{ID: "a", ACME: &models.ACMEConfig{EABKeyID: "kid", EABHMACKey: "secret"}}
+	public := site.Redacted()
+	if public.ACME.EABHMACKey != "" || !public.ACME.EABHMACKeySet {
+		t.Errorf("Not redacted: %+v", public.ACME)
+	}
+	if site.ACME.EABHMACKey != "secret" {
+		t.Error("Redacted changed the original site")
+	}
+	if (models.Site{}).Redacted().ACME != nil {
+		t.Error("A site without acme should stay without")
+	}
+}
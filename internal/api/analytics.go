@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+)
+
+// defaultAnalyticsWindow is used when no since is given.
+const defaultAnalyticsWindow = 24 * time.Hour
+
+// handleSiteAnalytics serves GET /v1/sites/{id}/analytics: the access log
+// aggregated by status class, browser, OS, bot and referer.
+func (s *Server) handleSiteAnalytics(w http.ResponseWriter, r *http.Request, siteID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(siteID)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	opts := logmanager.LogOptions{Search: r.URL.Query().Get("search"), Format: s.siteLogFormat(site)}
+	if t := r.URL.Query().Get("since"); t != "" {
+		opts.Since, _ = time.Parse(time.RFC3339, t)
+	}
+	if opts.Since.IsZero() {
+		opts.Since = time.Now().Add(-defaultAnalyticsWindow)
+	}
+	if t := r.URL.Query().Get("until"); t != "" {
+		opts.Until, _ = time.Parse(time.RFC3339, t)
+	}
+
+	analytics, err := s.LogManager.GetAnalytics(siteID, opts)
+	if err != nil {
+		errorResponse(w, 500, "failed to read access logs: "+err.Error())
+		return
+	}
+	jsonResponse(w, 200, analytics)
+}
@@ -0,0 +1,552 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Resources that routes are grouped under for authorization.
+const (
+	resourceSites   = "sites"
+	resourceStreams = "streams"
+	resourceSystem  = "system"  // audit trail, mirror control
+	resourceAPIKeys = "apikeys" // full-admin only, even for reads
+	resourceNodes   = "nodes"   // control plane agents
+)
+
+// tokenPrefix marks hubfly API tokens; the full format is hfk_<id>.<secret>.
+const tokenPrefix = "hfk_"
+
+// defaultBootstrapTTL is how long a bootstrap key stays usable when it is
+// created without an expiry.
+const defaultBootstrapTTL = 24 * time.Hour
+
+type ctxKey int
+
+const ctxKeyPrincipal ctxKey = iota
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	KeyID string
+	Name  string
+	Role  string
+}
+
+// principalFrom returns the caller attached by the auth middleware, or nil
+// when the API is running without keys.
+func principalFrom(r *http.Request) *Principal {
+	p, _ := r.Context().Value(ctxKeyPrincipal).(*Principal)
+	return p
+}
+
+// actor names the caller for the audit trail.
+func actor(r *http.Request) string {
+	if p := principalFrom(r); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// roleAllows reports whether role may perform a read or write on resource.
+func roleAllows(role, resource string, write bool) bool {
+	if role == models.RoleFullAdmin {
+		return true
+	}
+	if resource == resourceAPIKeys {
+		return false
+	}
+	if role == models.RoleNodeAgent {
+		// Its key is on every edge node, so it gets the node endpoints only
+		return resource == resourceNodes
+	}
+	if !write {
+		return models.ValidRole(role)
+	}
+	switch resource {
+	case resourceSites:
+		return role == models.RoleSitesAdmin
+	case resourceStreams:
+		return role == models.RoleStreamsAdmin
+	}
+	return false
+}
+
+// require wraps a handler with authentication and a role check for resource.
+// Reads are GET/HEAD/OPTIONS; everything else counts as a write.
+//
+// Until the first API key is created (and no admin token is configured) the
+// API stays open, so existing single-operator setups keep working.
+func (s *Server) require(resource string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hubfly"`)
+			errorResponse(w, 401, "missing or invalid API key")
+			return
+		}
+		if p != nil {
+			write := true
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				write = false
+			}
+			if !roleAllows(p.Role, resource, write) {
+				verb := "read"
+				if write {
+					verb = "modify"
+				}
+				errorResponse(w, 403, "role "+p.Role+" may not "+verb+" "+resource)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyPrincipal, p))
+
+			rw := &responseWriter{ResponseWriter: w, status: 200}
+			next(rw, r)
+			s.recordKeyUsage(p, r, rw.status)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authenticate resolves the request's token. It returns (nil, true) when
+// auth is disabled because no credentials have been configured yet.
+func (s *Server) authenticate(r *http.Request) (*Principal, bool) {
+	token := requestToken(r)
+
+	if s.AdminToken != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) == 1 {
+		return &Principal{Name: "admin-token", Role: models.RoleFullAdmin}, true
+	}
+
+	if token == "" {
+		if s.AdminToken != "" {
+			return nil, false
+		}
+		keys, err := s.Store.ListAPIKeys()
+		if err != nil {
+			slog.Error("Failed to list api keys", "error", err)
+			return nil, false
+		}
+		return nil, len(keys) == 0
+	}
+
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return nil, false
+	}
+	key, err := s.Store.GetAPIKey(id)
+	if err != nil || key.Bootstrap || key.Expired(time.Now()) || !secretMatches(key, secret, time.Now()) {
+		return nil, false
+	}
+	return &Principal{KeyID: key.ID, Name: key.Name, Role: key.Role}, true
+}
+
+// secretMatches checks secret against the key's current secret and, during
+// a rotation's grace period, its previous one.
+func secretMatches(key *models.APIKey, secret string, now time.Time) bool {
+	hash := []byte(hashSecret(secret))
+	if subtle.ConstantTimeCompare(hash, []byte(key.SecretHash)) == 1 {
+		return true
+	}
+	return key.PreviousSecretHash != "" && key.PreviousValidUntil != nil && now.Before(*key.PreviousValidUntil) &&
+		subtle.ConstantTimeCompare(hash, []byte(key.PreviousSecretHash)) == 1
+}
+
+// requestToken reads "Authorization: Bearer <token>" or "X-API-Key".
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+func parseToken(token string) (id, secret string, ok bool) {
+	rest, found := strings.CutPrefix(token, tokenPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, ".")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// publicKey strips the secret hashes before a key is returned to clients.
+func publicKey(k models.APIKey) models.APIKey {
+	k.SecretHash = ""
+	k.PreviousSecretHash = ""
+	return k
+}
+
+// keyExpiry resolves an expiry given as a time or as a duration from now,
+// e.g. "720h". Neither means no expiry.
+func keyExpiry(at *time.Time, in string, now time.Time) (*time.Time, error) {
+	if at != nil && in != "" {
+		return nil, fmt.Errorf("set expires_at or expires_in, not both")
+	}
+	if in != "" {
+		d, err := time.ParseDuration(in)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("expires_in must be a positive duration like 720h")
+		}
+		t := now.Add(d)
+		return &t, nil
+	}
+	if at != nil && !at.After(now) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+	return at, nil
+}
+
+// keyInput creates an API key, and documents updates. Bootstrap keys
+// expire after a day unless given an expiry.
+type keyInput struct {
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExpiresIn string     `json:"expires_in,omitempty"` // Duration from now, e.g. "720h"
+	Bootstrap bool       `json:"bootstrap,omitempty"`
+}
+
+// newKeyResponse is returned when a key is created, rotated or exchanged
+// for a bootstrap key; the token is only ever shown there.
+type newKeyResponse struct {
+	models.APIKey
+	Token string `json:"token"`
+}
+
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := s.Store.ListAPIKeys()
+		if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		for i := range keys {
+			keys[i] = publicKey(keys[i])
+		}
+		jsonResponse(w, 200, keys)
+	case http.MethodPost:
+		var req keyInput
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if req.Name == "" {
+			errorResponse(w, 400, "name is required")
+			return
+		}
+		if !models.ValidRole(req.Role) {
+			errorResponse(w, 400, "invalid role: "+req.Role)
+			return
+		}
+		now := time.Now()
+		expires, err := keyExpiry(req.ExpiresAt, req.ExpiresIn, now)
+		if err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if req.Bootstrap && expires == nil {
+			t := now.Add(defaultBootstrapTTL)
+			expires = &t
+		}
+
+		secret := randomHex(24)
+		key := models.APIKey{
+			ID:         randomHex(6),
+			Name:       req.Name,
+			Role:       req.Role,
+			SecretHash: hashSecret(secret),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			ExpiresAt:  expires,
+			Bootstrap:  req.Bootstrap,
+		}
+		if err := s.Store.SaveAPIKey(&key); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "apikey.created",
+			Resource:   "apikey",
+			ResourceID: key.ID,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"name": key.Name, "role": key.Role, "expires_at": key.ExpiresAt, "bootstrap": key.Bootstrap},
+		})
+		jsonResponse(w, 201, newKeyResponse{APIKey: publicKey(key), Token: tokenPrefix + key.ID + "." + secret})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func (s *Server) handleAPIKeyDetail(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/apikeys/")
+	if id == "" {
+		errorResponse(w, 404, "not found")
+		return
+	}
+
+	if strings.HasSuffix(id, "/usage") {
+		s.handleAPIKeyUsage(w, r, strings.TrimSuffix(id, "/usage"))
+		return
+	}
+	if strings.HasSuffix(id, "/rotate") {
+		s.handleAPIKeyRotate(w, r, strings.TrimSuffix(id, "/rotate"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.keysMu.Lock()
+		defer s.keysMu.Unlock()
+	}
+
+	key, err := s.Store.GetAPIKey(id)
+	if err != nil {
+		errorResponse(w, 404, "api key not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, 200, publicKey(*key))
+	case http.MethodPatch:
+		var req struct {
+			Name      *string `json:"name"`
+			Role      *string `json:"role"`
+			ExpiresAt *string `json:"expires_at"` // "" removes the expiry
+			ExpiresIn string  `json:"expires_in"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		details := map[string]interface{}{}
+		if req.Name != nil {
+			key.Name = *req.Name
+			details["name"] = key.Name
+		}
+		if req.Role != nil {
+			if !models.ValidRole(*req.Role) {
+				errorResponse(w, 400, "invalid role: "+*req.Role)
+				return
+			}
+			details["role"] = map[string]string{"from": key.Role, "to": *req.Role}
+			key.Role = *req.Role
+		}
+		if req.ExpiresAt != nil || req.ExpiresIn != "" {
+			var at *time.Time
+			if req.ExpiresAt != nil && *req.ExpiresAt != "" {
+				t, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+				if err != nil {
+					errorResponse(w, 400, "expires_at must be an RFC3339 time")
+					return
+				}
+				at = &t
+			}
+			expires, err := keyExpiry(at, req.ExpiresIn, time.Now())
+			if err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			}
+			key.ExpiresAt = expires
+			details["expires_at"] = key.ExpiresAt
+		}
+		key.UpdatedAt = time.Now()
+		if err := s.Store.SaveAPIKey(key); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "apikey.updated",
+			Resource:   "apikey",
+			ResourceID: key.ID,
+			Actor:      actor(r),
+			Details:    details,
+		})
+		jsonResponse(w, 200, publicKey(*key))
+	case http.MethodDelete:
+		if err := s.Store.DeleteAPIKey(id); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.usage.forget(id)
+		s.Audit.Record(audit.Event{
+			Action:     "apikey.deleted",
+			Resource:   "apikey",
+			ResourceID: id,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"name": key.Name},
+		})
+		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// KeyRotation is the body of POST /v1/apikeys/{id}/rotate. During
+// GracePeriod, e.g. "1h", the previous secret keeps working.
+type KeyRotation struct {
+	GracePeriod string     `json:"grace_period,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // Replaces the key's expiry
+	ExpiresIn   string     `json:"expires_in,omitempty"`
+}
+
+// handleAPIKeyRotate serves POST /v1/apikeys/{id}/rotate: the key gets a
+// new secret and keeps its ID, name and role.
+func (s *Server) handleAPIKeyRotate(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	key, err := s.Store.GetAPIKey(id)
+	if err != nil {
+		errorResponse(w, 404, "api key not found")
+		return
+	}
+	var req KeyRotation
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+	}
+	now := time.Now()
+	var grace time.Duration
+	if req.GracePeriod != "" {
+		if grace, err = time.ParseDuration(req.GracePeriod); err != nil || grace < 0 {
+			errorResponse(w, 400, "grace_period must be a duration like 1h")
+			return
+		}
+	}
+	if req.ExpiresAt != nil || req.ExpiresIn != "" {
+		expires, err := keyExpiry(req.ExpiresAt, req.ExpiresIn, now)
+		if err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		key.ExpiresAt = expires
+	}
+
+	secret := randomHex(24)
+	key.PreviousSecretHash, key.PreviousValidUntil = "", nil
+	if grace > 0 {
+		until := now.Add(grace)
+		key.PreviousSecretHash, key.PreviousValidUntil = key.SecretHash, &until
+	}
+	key.SecretHash = hashSecret(secret)
+	key.RotatedAt = &now
+	key.UpdatedAt = now
+	if err := s.Store.SaveAPIKey(key); err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	s.Audit.Record(audit.Event{
+		Action:     "apikey.rotated",
+		Resource:   "apikey",
+		ResourceID: key.ID,
+		Actor:      actor(r),
+		Details:    map[string]interface{}{"name": key.Name, "previous_valid_until": key.PreviousValidUntil, "expires_at": key.ExpiresAt},
+	})
+	jsonResponse(w, 200, newKeyResponse{APIKey: publicKey(*key), Token: tokenPrefix + key.ID + "." + secret})
+}
+
+// BootstrapRequest optionally names the key a bootstrap key is exchanged
+// for; it defaults to the bootstrap key's name.
+type BootstrapRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+// handleBootstrap serves POST /v1/bootstrap. It authenticates with a
+// bootstrap key instead of require, and exchanges it for a new regular
+// key with the same role. The bootstrap key is deleted, so it works once.
+func (s *Server) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	var req BootstrapRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+	}
+
+	// Two requests with the same token must not both get a key.
+	s.bootstrapMu.Lock()
+	defer s.bootstrapMu.Unlock()
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	now := time.Now()
+	id, secret, ok := parseToken(requestToken(r))
+	var boot *models.APIKey
+	if ok {
+		boot, _ = s.Store.GetAPIKey(id)
+	}
+	if boot == nil || !boot.Bootstrap || boot.Expired(now) || !secretMatches(boot, secret, now) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="hubfly"`)
+		errorResponse(w, 401, "missing, used or expired bootstrap key")
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = boot.Name
+	}
+	newSecret := randomHex(24)
+	key := models.APIKey{
+		ID:         randomHex(6),
+		Name:       name,
+		Role:       boot.Role,
+		SecretHash: hashSecret(newSecret),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.Store.SaveAPIKey(&key); err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	if err := s.Store.DeleteAPIKey(boot.ID); err != nil {
+		s.Store.DeleteAPIKey(key.ID) // Keep the bootstrap key usable instead
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	s.usage.forget(boot.ID)
+	s.Audit.Record(audit.Event{
+		Action:     "apikey.bootstrapped",
+		Resource:   "apikey",
+		ResourceID: key.ID,
+		Actor:      boot.Name,
+		Details:    map[string]interface{}{"bootstrap_id": boot.ID, "name": key.Name, "role": key.Role},
+	})
+	jsonResponse(w, 201, newKeyResponse{APIKey: publicKey(key), Token: tokenPrefix + key.ID + "." + newSecret})
+}
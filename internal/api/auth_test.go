@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestRoleAllows(t *testing.T) {
+	resources := []string{resourceSites, resourceStreams, resourceSystem, resourceAPIKeys, resourceNodes}
+	// Per role, the resources it may read and write
+	tests := []struct {
+		role          string
+		read, written []string
+	}{
+		{models.RoleFullAdmin, resources, resources},
+		{models.RoleViewer, []string{resourceSites, resourceStreams, resourceSystem, resourceNodes}, nil},
+		{models.RoleSitesAdmin, []string{resourceSites, resourceStreams, resourceSystem, resourceNodes}, []string{resourceSites}},
+		{models.RoleStreamsAdmin, []string{resourceSites, resourceStreams, resourceSystem, resourceNodes}, []string{resourceStreams}},
+		{models.RoleNodeAgent, []string{resourceNodes}, []string{resourceNodes}},
+		{"root", nil, nil},
+		{"", nil, nil},
+	}
+	in := func(list []string, v string) bool {
+		for _, s := range list {
+			if s == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tt := range tests {
+		for _, res := range resources {
+			if got, want := roleAllows(tt.role, res, false), in(tt.read, res); got != want {
+				t.Errorf("roleAllows(%q, %s, read) = %v, want %v", tt.role, res, got, want)
+			}
+			if got, want := roleAllows(tt.role, res, true), in(tt.written, res); got != want {
+				t.Errorf("roleAllows(%q, %s, write) = %v, want %v", tt.role, res, got, want)
+			}
+		}
+	}
+}
+
+// authStatus sends method with token to a handler guarded for resource,
+// and returns the status and whether the handler ran.
+func authStatus(s *Server, resource, method, token string) (int, bool) {
+	ran := false
+	h := s.require(resource, func(w http.ResponseWriter, r *http.Request) {
+		ran = true
+		w.WriteHeader(204)
+	})
+	req := httptest.NewRequest(method, "/v1/test", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec.Code, ran
+}
+
+func TestRequire(t *testing.T) {
+	s := newTestServer(t)
+
+	// Open until the first key
+	if code, ran := authStatus(s, resourceAPIKeys, "POST", ""); code != 204 || !ran {
+		t.Fatalf("Expected the API to be open without keys, got %d", code)
+	}
+	if code, _ := authStatus(s, resourceSites, "GET", "hfk_nope.nope"); code != 401 {
+		t.Errorf("A token that doesn't exist should be refused even while open, got %d", code)
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	for _, key := range []models.APIKey{
+		{ID: "viewer", Role: models.RoleViewer, SecretHash: hashSecret("v")},
+		{ID: "sites", Role: models.RoleSitesAdmin, SecretHash: hashSecret("s")},
+		{ID: "agent", Role: models.RoleNodeAgent, SecretHash: hashSecret("a")},
+		{ID: "admin", Role: models.RoleFullAdmin, SecretHash: hashSecret("f")},
+		{ID: "expired", Role: models.RoleFullAdmin, SecretHash: hashSecret("e"), ExpiresAt: &past},
+		{ID: "boot", Role: models.RoleFullAdmin, SecretHash: hashSecret("b"), Bootstrap: true},
+		{ID: "rotated", Role: models.RoleFullAdmin, SecretHash: hashSecret("new"),
+			PreviousSecretHash: hashSecret("old"), PreviousValidUntil: &future},
+		{ID: "graceover", Role: models.RoleFullAdmin, SecretHash: hashSecret("new"),
+			PreviousSecretHash: hashSecret("old"), PreviousValidUntil: &past},
+	} {
+		s.Store.SaveAPIKey(&key)
+	}
+
+	tests := []struct {
+		name, resource, method, token string
+		want                          int
+	}{
+		{"no token once keys exist", resourceSites, "GET", "", 401},
+		{"not a hubfly token", resourceSites, "GET", "secret", 401},
+		{"malformed token", resourceSites, "GET", "hfk_viewer", 401},
+		{"wrong secret", resourceSites, "GET", "hfk_viewer.x", 401},
+		{"unknown key", resourceSites, "GET", "hfk_gone.v", 401},
+		{"expired key", resourceSites, "GET", "hfk_expired.e", 401},
+		{"bootstrap key only exchanges", resourceSites, "GET", "hfk_boot.b", 401},
+		{"viewer reads", resourceSites, "GET", "hfk_viewer.v", 204},
+		{"viewer reads system", resourceSystem, "GET", "hfk_viewer.v", 204},
+		{"viewer HEAD is a read", resourceStreams, "HEAD", "hfk_viewer.v", 204},
+		{"viewer may not write", resourceSites, "PATCH", "hfk_viewer.v", 403},
+		{"viewer may not read keys", resourceAPIKeys, "GET", "hfk_viewer.v", 403},
+		{"sites-admin writes sites", resourceSites, "POST", "hfk_sites.s", 204},
+		{"sites-admin may not write streams", resourceStreams, "DELETE", "hfk_sites.s", 403},
+		{"node-agent reports status", resourceNodes, "POST", "hfk_agent.a", 204},
+		{"node-agent may not read sites", resourceSites, "GET", "hfk_agent.a", 403},
+		{"node-agent may not read system", resourceSystem, "GET", "hfk_agent.a", 403},
+		{"full-admin manages keys", resourceAPIKeys, "POST", "hfk_admin.f", 204},
+		{"previous secret during grace", resourceSites, "GET", "hfk_rotated.old", 204},
+		{"current secret after rotation", resourceSites, "GET", "hfk_rotated.new", 204},
+		{"previous secret after grace", resourceSites, "GET", "hfk_graceover.old", 401},
+	}
+	for _, tt := range tests {
+		code, ran := authStatus(s, tt.resource, tt.method, tt.token)
+		if code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+		if ran != (tt.want == 204) {
+			t.Errorf("%s: handler ran = %v", tt.name, ran)
+		}
+	}
+
+	// Site logs are site data, wherever they are read from
+	for _, target := range []string{"/v1/sites/a.local/logs", "/v1/logs", "/v1/logs/stream"} {
+		if rec := serveAs(s, "hfk_agent.a", "GET", target, ""); rec.Code != 403 {
+			t.Errorf("GET %s: node-agent got %d, want 403", target, rec.Code)
+		}
+	}
+
+	// X-API-Key works like the bearer header
+	req := httptest.NewRequest("GET", "/v1/test", nil)
+	req.Header.Set("X-API-Key", "hfk_viewer.v")
+	if p, ok := s.authenticate(req); !ok || p == nil || p.KeyID != "viewer" {
+		t.Errorf("X-API-Key not accepted: %v %v", p, ok)
+	}
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	s := newTestServer(t)
+	s.AdminToken = "admin-secret"
+
+	// A configured admin token closes the API even without keys
+	if code, _ := authStatus(s, resourceSites, "GET", ""); code != 401 {
+		t.Errorf("Expected 401 without a token, got %d", code)
+	}
+	if code, _ := authStatus(s, resourceSites, "GET", "admin-secre"); code != 401 {
+		t.Errorf("Expected 401 for a wrong admin token, got %d", code)
+	}
+	if code, _ := authStatus(s, resourceAPIKeys, "DELETE", "admin-secret"); code != 204 {
+		t.Errorf("Admin token should be full-admin, got %d", code)
+	}
+
+	// Unauthenticated responses ask for a bearer token
+	rec := serve(s, "GET", "/v1/sites", "")
+	if rec.Code != 401 || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with WWW-Authenticate, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve(s, "GET", "/v1/health", ""); rec.Code != 200 {
+		t.Errorf("/v1/health should stay open, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,681 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+// backupVersion is the version of the backup archive layout.
+const backupVersion = 1
+
+// maxBackupSize caps POST /v1/restore bodies, and the unpacked archive.
+const maxBackupSize = 256 << 20
+
+// BackupManifest is manifest.json at the top of a backup archive.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Hubfly    string    `json:"hubfly_version"`
+	Sites     int       `json:"sites"`
+	Streams   int       `json:"streams"`
+	APIKeys   int       `json:"api_keys"`
+	// Dirs are the directories the archive holds; restoring replaces the
+	// contents of each.
+	Dirs []string `json:"dirs"`
+}
+
+// RestoreReport is the response of POST /v1/restore. Results has an entry
+// per restored or removed site and stream; with ?wait=true each carries
+// the status it was applied with.
+type RestoreReport struct {
+	Manifest BackupManifest `json:"manifest"`
+	Results  []ImportResult `json:"results"`
+}
+
+// backupDir is a directory carried in the archive under name.
+type backupDir struct {
+	name, path string
+	restore    bool // Replaced on restore; generated configs are rendered again instead
+}
+
+// backupDirs are the directories of a backup. The certbot directory is
+// the parent of its live directory: live holds symlinks into archive, and
+// renewal and accounts are needed to renew.
+func (s *Server) backupDirs() []backupDir {
+	return []backupDir{
+		{"templates", s.Nginx.TemplatesDir, true},
+		{"log_formats", s.Nginx.FormatsDir, true},
+		{"files", s.Nginx.FilesDir, true},
+		{"letsencrypt", filepath.Dir(s.Certbot.LiveDir), true},
+		{"nginx/sites", s.Nginx.SitesDir, false},
+		{"nginx/streams", s.Nginx.StreamsDir, false},
+	}
+}
+
+// handleBackup serves POST /v1/backup: a tar.gz of the store (sites,
+// streams and API keys as JSON), templates, log formats, site files,
+// certificates and the generated nginx configs.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	// Build the archive first, so a failure is still a JSON error
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	manifest, err := s.writeBackup(&buf, now)
+	if err != nil {
+		errorResponse(w, 500, "backup failed: "+err.Error())
+		return
+	}
+	s.Audit.Record(audit.Event{
+		Action:   "config.backed_up",
+		Resource: "system",
+		Actor:    actor(r),
+		Details:  map[string]interface{}{"sites": manifest.Sites, "streams": manifest.Streams, "bytes": buf.Len()},
+	})
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="hubfly-backup-`+now.Format("20060102T150405Z")+`.tar.gz"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(200)
+	buf.WriteTo(w)
+}
+
+// writeBackup writes the archive: manifest.json, store/*.json and each
+// directory of backupDirs under its name. Symlinks are kept as they are.
+func (s *Server) writeBackup(w io.Writer, now time.Time) (*BackupManifest, error) {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.Store.ListAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{Version: backupVersion, CreatedAt: now, Hubfly: s.Version,
+		Sites: len(sites), Streams: len(streams), APIKeys: len(keys)}
+	for _, d := range s.backupDirs() {
+		manifest.Dirs = append(manifest.Dirs, d.name)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte, mode int64) error {
+		hdr := &tar.Header{Name: name, Mode: mode, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{{"manifest.json", manifest}, {"store/sites.json", sites}, {"store/streams.json", streams}, {"store/apikeys.json", keys}} {
+		data, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := add(f.name, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range s.backupDirs() {
+		err := filepath.WalkDir(d.path, func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				if p == d.path && errors.Is(err, fs.ErrNotExist) {
+					return fs.SkipDir
+				}
+				return err
+			}
+			rel, err := filepath.Rel(d.path, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			name := d.name + "/" + filepath.ToSlash(rel)
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			switch {
+			case e.IsDir():
+				return tw.WriteHeader(&tar.Header{Name: name + "/", Mode: int64(info.Mode().Perm()), ModTime: info.ModTime(), Typeflag: tar.TypeDir})
+			case e.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				return tw.WriteHeader(&tar.Header{Name: name, Linkname: target, Mode: 0777, ModTime: info.ModTime(), Typeflag: tar.TypeSymlink})
+			case e.Type().IsRegular():
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return err
+				}
+				return add(name, data, int64(info.Mode().Perm()))
+			}
+			return nil // Sockets and the like
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// backupEntry is a file, directory or symlink read from an archive, with
+// its name relative to its backup directory.
+type backupEntry struct {
+	name, link string
+	dir        bool
+	mode       os.FileMode
+	data       []byte
+}
+
+// backupArchive is an archive read and checked in full before anything
+// is restored.
+type backupArchive struct {
+	manifest BackupManifest
+	sites    []models.Site
+	streams  []models.Stream
+	keys     []models.APIKey
+	dirs     map[string][]backupEntry
+}
+
+// readBackup unpacks a backup into memory and validates it: the layout,
+// paths that stay inside their directory, the store JSON, templates and
+// log formats.
+func (s *Server) readBackup(r io.Reader) (*backupArchive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	known := map[string]backupDir{}
+	for _, d := range s.backupDirs() {
+		known[d.name] = d
+	}
+	a := &backupArchive{dirs: map[string][]backupEntry{}}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	size := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid path %q in archive", hdr.Name)
+		}
+		if size += hdr.Size; size > maxBackupSize {
+			return nil, fmt.Errorf("archive unpacks to more than %d MiB", maxBackupSize>>20)
+		}
+		var data []byte
+		if hdr.Typeflag == tar.TypeReg {
+			if data, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("invalid archive: %w", err)
+			}
+		}
+		if name == "manifest.json" || strings.HasPrefix(name, "store/") {
+			files[name] = data
+			continue
+		}
+
+		dir, rel := "", ""
+		for d := range known {
+			if strings.HasPrefix(name, d+"/") {
+				dir, rel = d, strings.TrimPrefix(name, d+"/")
+			}
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("unexpected path %q in archive", hdr.Name)
+		}
+		e := backupEntry{name: rel, mode: os.FileMode(hdr.Mode).Perm(), data: data}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.dir = true
+		case tar.TypeSymlink:
+			// Only certbot's live links, pointing into its archive directory
+			target := path.Join(path.Dir(rel), hdr.Linkname)
+			if dir != "letsencrypt" || path.IsAbs(hdr.Linkname) || target == ".." || strings.HasPrefix(target, "../") {
+				return nil, fmt.Errorf("symlink %q points outside its directory", hdr.Name)
+			}
+			e.link = hdr.Linkname
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("unsupported entry %q in archive", hdr.Name)
+		}
+		a.dirs[dir] = append(a.dirs[dir], e)
+	}
+	for dir, entries := range a.dirs {
+		if err := checkBackupLinks(entries); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+
+	if err := json.Unmarshal(files["manifest.json"], &a.manifest); err != nil {
+		return nil, errors.New("archive has no valid manifest.json")
+	}
+	if a.manifest.Version < 1 || a.manifest.Version > backupVersion {
+		return nil, fmt.Errorf("backup version %d is not supported (want 1 to %d)", a.manifest.Version, backupVersion)
+	}
+	for _, d := range a.manifest.Dirs {
+		if _, ok := known[d]; !ok {
+			return nil, fmt.Errorf("manifest lists unknown directory %q", d)
+		}
+	}
+	for name, v := range map[string]interface{}{"store/sites.json": &a.sites, "store/streams.json": &a.streams, "store/apikeys.json": &a.keys} {
+		if err := json.Unmarshal(files[name], v); err != nil {
+			return nil, fmt.Errorf("%s: invalid or missing: %w", name, err)
+		}
+	}
+	for _, site := range a.sites {
+		if site.ID == "" || strings.ContainsAny(site.ID, "/\\") {
+			return nil, fmt.Errorf("store/sites.json: invalid site ID %q", site.ID)
+		}
+	}
+	for _, stream := range a.streams {
+		if stream.ID == "" || stream.ListenPort < 1 || stream.ListenPort > 65535 {
+			return nil, fmt.Errorf("store/streams.json: invalid stream %q on port %d", stream.ID, stream.ListenPort)
+		}
+	}
+	for _, e := range a.dirs["templates"] {
+		if e.dir || e.link != "" {
+			continue
+		}
+		if err := nginx.CheckTemplate(string(e.data)); err != nil {
+			return nil, fmt.Errorf("template %s: %w", e.name, err)
+		}
+	}
+	for _, e := range a.dirs["log_formats"] {
+		if e.dir || e.link != "" {
+			continue
+		}
+		var f models.LogFormat
+		if err := json.Unmarshal(e.data, &f); err != nil {
+			return nil, fmt.Errorf("log format %s: %w", e.name, err)
+		}
+		if err := nginx.CheckLogFormat(&f); err != nil {
+			return nil, fmt.Errorf("log format %s: %w", e.name, err)
+		}
+	}
+	return a, nil
+}
+
+// checkBackupLinks rejects entries of a directory that could be written
+// outside it once extracted: names given twice (a file written through a
+// symlink of the same name), entries below a symlink, and symlinks whose
+// target leaves the directory or passes through another symlink. Certbot's
+// links point straight at files in archive, so none of these is needed.
+func checkBackupLinks(entries []backupEntry) error {
+	seen, links := map[string]bool{}, map[string]bool{}
+	for _, e := range entries {
+		if seen[e.name] {
+			return fmt.Errorf("%q is in the archive twice", e.name)
+		}
+		seen[e.name] = true
+		if e.link != "" {
+			links[e.name] = true
+		}
+	}
+	for _, e := range entries {
+		for p := path.Dir(e.name); p != "."; p = path.Dir(p) {
+			if links[p] {
+				return fmt.Errorf("%q is inside symlink %q", e.name, p)
+			}
+		}
+		if e.link == "" {
+			continue
+		}
+		var parts []string
+		if dir := path.Dir(e.name); dir != "." {
+			parts = strings.Split(dir, "/")
+		}
+		for _, c := range strings.Split(e.link, "/") {
+			switch c {
+			case "", ".":
+			case "..":
+				if len(parts) == 0 {
+					return fmt.Errorf("symlink %q points outside its directory", e.name)
+				}
+				parts = parts[:len(parts)-1]
+			default:
+				parts = append(parts, c)
+				if links[strings.Join(parts, "/")] {
+					return fmt.Errorf("symlink %q points through symlink %q", e.name, strings.Join(parts, "/"))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// handleRestore serves POST /v1/restore: it validates a backup from
+// POST /v1/backup, replaces the store and the backed up directories with
+// it, then renders every site and stream again and reloads nginx. Sites
+// and streams missing from the backup are removed. Unless ?wait=true the
+// sites and streams are applied in the background.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	a, err := s.readBackup(http.MaxBytesReader(w, r.Body, maxBackupSize))
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	oldSites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	oldStreams, err := s.Store.ListStreams()
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+
+	// Stage every directory, then the store, and only then swap the
+	// directories in: a failure up to the store leaves everything as it was.
+	var staged []*stagedDir
+	defer func() {
+		for _, st := range staged {
+			st.discard()
+		}
+	}()
+	for _, name := range a.manifest.Dirs {
+		for _, d := range s.backupDirs() {
+			if d.name != name || !d.restore {
+				continue
+			}
+			st, err := stageDir(d.path, a.dirs[name])
+			if err != nil {
+				errorResponse(w, 500, "failed to restore "+name+": "+err.Error())
+				return
+			}
+			st.name = name
+			staged = append(staged, st)
+		}
+	}
+
+	now := time.Now()
+	s.keysMu.Lock()
+	err = s.Store.WithTx(func(tx store.Store) error {
+		for _, site := range oldSites {
+			if err := tx.DeleteSite(site.ID); err != nil {
+				return err
+			}
+		}
+		for _, stream := range oldStreams {
+			if err := tx.DeleteStream(stream.ID); err != nil {
+				return err
+			}
+		}
+		keys, err := tx.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.DeleteAPIKey(key.ID); err != nil {
+				return err
+			}
+		}
+		for i := range a.sites {
+			site := &a.sites[i]
+			site.Status, site.ErrorMessage, site.UpdatedAt = "provisioning", "", now
+			if err := tx.SaveSite(site); err != nil {
+				return err
+			}
+		}
+		for i := range a.streams {
+			stream := &a.streams[i]
+			stream.Status, stream.ErrorMessage, stream.UpdatedAt = "provisioning", "", now
+			if err := tx.SaveStream(stream); err != nil {
+				return err
+			}
+		}
+		for i := range a.keys {
+			if err := tx.SaveAPIKey(&a.keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.keysMu.Unlock()
+	if err != nil {
+		errorResponse(w, 500, "failed to restore store: "+err.Error())
+		return
+	}
+	for _, st := range staged {
+		if err := st.swap(); err != nil {
+			// The store is restored already; the directory is left as it was
+			slog.Error("Failed to swap in restored directory", "dir", st.name, "error", err)
+			errorResponse(w, 500, "store restored, but failed to restore "+st.name+": "+err.Error())
+			return
+		}
+	}
+
+	who := actor(r)
+	report := &RestoreReport{Manifest: a.manifest, Results: []ImportResult{}}
+	restored := map[string]bool{}
+	for _, site := range a.sites {
+		restored[site.ID] = true
+		report.Results = append(report.Results, ImportResult{Kind: "site", ID: site.ID, Action: "restored"})
+	}
+	for _, site := range oldSites {
+		if !restored[site.ID] {
+			report.Results = append(report.Results, ImportResult{Kind: "site", ID: site.ID, Action: "removed"})
+		}
+	}
+	ports := map[int]bool{}
+	for _, stream := range a.streams {
+		ports[stream.ListenPort] = true
+		report.Results = append(report.Results, ImportResult{Kind: "stream", ID: stream.ID, Action: "restored"})
+	}
+	for _, stream := range oldStreams {
+		ports[stream.ListenPort] = true
+		if !slices.ContainsFunc(a.streams, func(st models.Stream) bool { return st.ID == stream.ID }) {
+			report.Results = append(report.Results, ImportResult{Kind: "stream", ID: stream.ID, Action: "removed"})
+		}
+	}
+
+	apply := func() {
+		for _, site := range oldSites {
+			if restored[site.ID] {
+				continue
+			}
+			if err := s.Nginx.Delete(site.ID); err != nil {
+				slog.Error("Failed to remove config of site missing from backup", "site_id", site.ID, "error", err)
+			}
+			s.forgetConfigChange(site.ID)
+			s.synthetics.forget(site.ID, nil)
+			if err := s.Synthetics.Forget(site.ID); err != nil {
+				slog.Warn("Failed to delete synthetic check results", "site_id", site.ID, "error", err)
+			}
+		}
+		for i := range a.sites {
+			s.noteConfigChange(a.sites[i].ID, who, "config.restored")
+			s.provisionSite(&a.sites[i])
+		}
+		for _, port := range slices.Sorted(maps.Keys(ports)) {
+			s.reconcileStreams(port)
+		}
+	}
+	if wantWait(r) {
+		apply()
+		for i := range report.Results {
+			res := &report.Results[i]
+			if res.Action == "removed" {
+				continue
+			}
+			switch res.Kind {
+			case "site":
+				if site, err := s.Store.GetSite(res.ID); err == nil {
+					res.Status, res.Error = site.Status, site.ErrorMessage
+				}
+			case "stream":
+				if stream, err := s.Store.GetStream(res.ID); err == nil {
+					res.Status, res.Error = stream.Status, stream.ErrorMessage
+				}
+			}
+		}
+	} else {
+		go apply()
+	}
+
+	s.Audit.Record(audit.Event{
+		Action:   "config.restored",
+		Resource: "system",
+		Actor:    who,
+		Details: map[string]interface{}{
+			"created_at": a.manifest.CreatedAt, "sites": len(a.sites), "streams": len(a.streams),
+			"api_keys": len(a.keys), "dirs": a.manifest.Dirs,
+		},
+	})
+	slog.Info("Backup restored", "created_at", a.manifest.CreatedAt, "sites", len(a.sites), "streams", len(a.streams))
+	jsonResponse(w, 200, report)
+}
+
+// stagedDir is a directory of a backup written next to the directory it
+// replaces, see stageDir.
+type stagedDir struct {
+	name, dir, staging string
+}
+
+// stageDir writes entries to a staging directory inside dir, which is
+// swapped in by swap or removed by discard. dir itself stays, as it may be
+// a mount point. Entries are written through an os.Root, so even a link
+// checkBackupLinks missed can't lead outside the staging directory.
+func stageDir(dir string, entries []backupEntry) (*stagedDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(dir, ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	st := &stagedDir{dir: dir, staging: staging}
+	if err := writeEntries(staging, entries); err != nil {
+		st.discard()
+		return nil, err
+	}
+	return st, nil
+}
+
+func writeEntries(staging string, entries []backupEntry) error {
+	root, err := os.OpenRoot(staging)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	for _, e := range entries {
+		name := filepath.FromSlash(e.name)
+		if dir := filepath.Dir(name); dir != "." {
+			if err := root.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		switch {
+		case e.dir:
+			err = root.MkdirAll(name, e.mode|0700)
+		case e.link != "":
+			err = root.Symlink(e.link, name)
+		default:
+			var f *os.File
+			if f, err = root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, e.mode|0600); err == nil {
+				_, err = f.Write(e.data)
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// swap replaces the contents of dir with the staged ones. The old contents
+// are moved aside first, and moved back if a rename fails, so dir ends up
+// either restored or as it was.
+func (st *stagedDir) swap() error {
+	aside, err := os.MkdirTemp(st.dir, ".restore-old-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(aside)
+	old, err := os.ReadDir(st.dir)
+	if err != nil {
+		return err
+	}
+	var movedOld, movedNew []string
+	rollback := func() {
+		for _, name := range movedNew {
+			os.Rename(filepath.Join(st.dir, name), filepath.Join(st.staging, name))
+		}
+		for _, name := range movedOld {
+			os.Rename(filepath.Join(aside, name), filepath.Join(st.dir, name))
+		}
+	}
+	for _, e := range old {
+		if p := filepath.Join(st.dir, e.Name()); p == st.staging || p == aside {
+			continue
+		}
+		if err := os.Rename(filepath.Join(st.dir, e.Name()), filepath.Join(aside, e.Name())); err != nil {
+			rollback()
+			return err
+		}
+		movedOld = append(movedOld, e.Name())
+	}
+	restored, err := os.ReadDir(st.staging)
+	if err != nil {
+		rollback()
+		return err
+	}
+	for _, e := range restored {
+		if err := os.Rename(filepath.Join(st.staging, e.Name()), filepath.Join(st.dir, e.Name())); err != nil {
+			rollback()
+			return err
+		}
+		movedNew = append(movedNew, e.Name())
+	}
+	return nil
+}
+
+// discard removes the staging directory; after a swap it is empty.
+func (st *stagedDir) discard() {
+	os.RemoveAll(st.staging)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := newTestServer(t)
+	src.Store.SaveSite(&models.Site{ID: "a", Domain: "a.example.com", Upstreams: []string{"app:80"}})
+	src.Store.SaveStream(&models.Stream{ID: "db", ListenPort: 5432, Upstream: "db:5432", Protocol: "tcp"})
+	os.WriteFile(filepath.Join(src.Nginx.TemplatesDir, "spa.conf"), []byte("gzip on;\n"), 0644)
+	le := filepath.Dir(src.Certbot.LiveDir)
+	os.MkdirAll(filepath.Join(le, "archive", "a.example.com"), 0755)
+	os.MkdirAll(filepath.Join(src.Certbot.LiveDir, "a.example.com"), 0755)
+	os.WriteFile(filepath.Join(le, "archive", "a.example.com", "fullchain1.pem"), []byte("cert"), 0644)
+	os.Symlink("../../archive/a.example.com/fullchain1.pem", filepath.Join(src.Certbot.LiveDir, "a.example.com", "fullchain.pem"))
+
+	rec := serve(src, "POST", "/v1/backup", "")
+	if rec.Code != 200 {
+		t.Fatalf("Backup failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	dst := newTestServer(t)
+	dst.Store.SaveSite(&models.Site{ID: "old", Domain: "old.example.com", Upstreams: []string{"old:80"}})
+	os.WriteFile(filepath.Join(dst.Nginx.TemplatesDir, "stale.conf"), []byte("gzip off;\n"), 0644)
+
+	rec = serve(dst, "POST", "/v1/restore?wait=true", rec.Body.String())
+	if rec.Code != 200 {
+		t.Fatalf("Restore failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var report RestoreReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	if report.Manifest.Sites != 1 || report.Manifest.Streams != 1 || len(report.Results) != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	if _, err := dst.Store.GetSite("old"); err == nil {
+		t.Error("Site missing from the backup should be removed")
+	}
+	if site, err := dst.Store.GetSite("a"); err != nil || site.Domain != "a.example.com" {
+		t.Errorf("Site not restored: %v %v", site, err)
+	}
+	if _, err := dst.Store.GetStream("db"); err != nil {
+		t.Errorf("Stream not restored: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst.Nginx.TemplatesDir, "spa.conf")); string(data) != "gzip on;\n" {
+		t.Errorf("Template not restored: %q %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst.Nginx.TemplatesDir, "stale.conf")); !os.IsNotExist(err) {
+		t.Error("Template missing from the backup should be removed")
+	}
+	cert := filepath.Join(dst.Certbot.LiveDir, "a.example.com", "fullchain.pem")
+	if link, err := os.Readlink(cert); err != nil || link != "../../archive/a.example.com/fullchain1.pem" {
+		t.Errorf("Certificate link not restored: %q %v", link, err)
+	}
+	if data, err := os.ReadFile(cert); string(data) != "cert" {
+		t.Errorf("Certificate link does not resolve: %q %v", data, err)
+	}
+	for _, dir := range []string{dst.Nginx.TemplatesDir, filepath.Dir(dst.Certbot.LiveDir)} {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".restore-") {
+				t.Errorf("Staging directory %s left in %s", e.Name(), dir)
+			}
+		}
+	}
+}
+
+// backupEntries builds an archive with the store files and extra.
+func backupEntries(t *testing.T, extra []tar.Header) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct{ name, data string }{
+		{"manifest.json", `{"version": 1, "dirs": ["templates", "letsencrypt"]}`},
+		{"store/sites.json", `[]`},
+		{"store/streams.json", `[]`},
+		{"store/apikeys.json", `[]`},
+	}
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0600, Size: int64(len(f.data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.data))
+	}
+	for _, hdr := range extra {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = 4
+		}
+		tw.WriteHeader(&hdr)
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte("evil"))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.String()
+}
+
+func TestRestoreRejectsEscapes(t *testing.T) {
+	link := func(name, target string) tar.Header {
+		return tar.Header{Name: name, Linkname: target, Mode: 0777, Typeflag: tar.TypeSymlink}
+	}
+	file := func(name string) tar.Header {
+		return tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+	}
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"parent path", []tar.Header{file("templates/../../pwned")}},
+		{"absolute path", []tar.Header{file("/tmp/pwned")}},
+		{"absolute link", []tar.Header{link("letsencrypt/live/x", "/etc")}},
+		{"link out", []tar.Header{link("letsencrypt/x", "../..")}},
+		{"link outside letsencrypt", []tar.Header{link("templates/x.conf", "x")}},
+		{"link chain", []tar.Header{link("letsencrypt/a", "."), link("letsencrypt/a/b", ".."), link("letsencrypt/a/b/c", ".."), file("letsencrypt/a/b/c/pwned")}},
+		{"file below link", []tar.Header{link("letsencrypt/a", "."), file("letsencrypt/a/pwned")}},
+		{"link through link", []tar.Header{link("letsencrypt/a", "."), link("letsencrypt/b", "a/..")}},
+		{"file over link", []tar.Header{link("letsencrypt/a", "live"), file("letsencrypt/a")}},
+		{"hard link", []tar.Header{{Name: "letsencrypt/a", Linkname: "../../pwned", Typeflag: tar.TypeLink}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			os.WriteFile(filepath.Join(s.Nginx.TemplatesDir, "keep.conf"), []byte("gzip on;\n"), 0644)
+			base := filepath.Dir(filepath.Dir(s.Nginx.TemplatesDir))
+
+			rec := serve(s, "POST", "/v1/restore?wait=true", backupEntries(t, tt.entries))
+			if rec.Code != 400 {
+				t.Fatalf("Expected 400, got %d %s", rec.Code, rec.Body.String())
+			}
+			if _, err := os.ReadFile(filepath.Join(s.Nginx.TemplatesDir, "keep.conf")); err != nil {
+				t.Errorf("Rejected restore changed templates: %v", err)
+			}
+			filepath.WalkDir(filepath.Dir(base), func(p string, e os.DirEntry, err error) error {
+				if err == nil && e.Name() == "pwned" {
+					t.Errorf("Restore wrote %s", p)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestStageDirStaysInside(t *testing.T) {
+	// Even entries that got past checkBackupLinks can't leave the directory.
+	dir := t.TempDir()
+	target := filepath.Join(dir, "restore")
+	entries := []backupEntry{
+		{name: "a", link: "."},
+		{name: "a/b", link: ".."},
+		{name: "a/b/pwned", mode: 0644, data: []byte("evil")},
+	}
+	if _, err := stageDir(target, entries); err == nil {
+		t.Error("Expected staging to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); !os.IsNotExist(err) {
+		t.Error("Staging wrote outside the directory")
+	}
+	left, _ := os.ReadDir(target)
+	if len(left) != 0 {
+		t.Errorf("Failed staging left %v", left)
+	}
+}
+
+// failingTx is a store whose transactions fail.
+type failingTx struct{ store.Store }
+
+func (failingTx) WithTx(func(store.Store) error) error { return errors.New("disk full") }
+
+func TestRestoreStoreFailureKeepsDirs(t *testing.T) {
+	src := newTestServer(t)
+	os.WriteFile(filepath.Join(src.Nginx.TemplatesDir, "new.conf"), []byte("gzip on;\n"), 0644)
+	backup := serve(src, "POST", "/v1/backup", "").Body.String()
+
+	dst := newTestServer(t)
+	os.WriteFile(filepath.Join(dst.Nginx.TemplatesDir, "old.conf"), []byte("gzip off;\n"), 0644)
+	dst.Store = failingTx{dst.Store}
+	if rec := serve(dst, "POST", "/v1/restore", backup); rec.Code != 500 {
+		t.Fatalf("Expected 500, got %d %s", rec.Code, rec.Body.String())
+	}
+	entries, _ := os.ReadDir(dst.Nginx.TemplatesDir)
+	if len(entries) != 1 || entries[0].Name() != "old.conf" {
+		t.Errorf("Failed restore changed templates: %v", entries)
+	}
+}
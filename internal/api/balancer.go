@@ -0,0 +1,152 @@
+package api
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// maxWeightHistory bounds the in-memory adjustment history kept per site.
+const maxWeightHistory = 50
+
+// WeightChange is one adjustment made by the adaptive balancer.
+type WeightChange struct {
+	Time    time.Time         `json:"time"`
+	From    map[string]int    `json:"from"`
+	To      map[string]int    `json:"to"`
+	Latency map[string]string `json:"latency"`
+	Healthy map[string]bool   `json:"healthy"`
+}
+
+type weightHistory struct {
+	mu      sync.Mutex
+	changes map[string][]WeightChange
+}
+
+func (h *weightHistory) add(siteID string, c WeightChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.changes == nil {
+		h.changes = make(map[string][]WeightChange)
+	}
+	list := append(h.changes[siteID], c)
+	if len(list) > maxWeightHistory {
+		list = list[len(list)-maxWeightHistory:]
+	}
+	h.changes[siteID] = list
+}
+
+func (h *weightHistory) get(siteID string) []WeightChange {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]WeightChange{}, h.changes[siteID]...)
+}
+
+// StartBalancer periodically probes upstreams of sites with adaptive load
+// balancing and re-renders their weights when latency or health shifts.
+func (s *Server) StartBalancer(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.rebalance()
+		}
+	}()
+}
+
+func (s *Server) rebalance() {
+	// A standby mirrors the primary's rendered weights instead.
+	if s.readOnly.Load() {
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Balancer failed to list sites", "error", err)
+		return
+	}
+	for _, site := range sites {
+		lb := site.LoadBalancing
+		if lb == nil || lb.Adaptive == nil || !lb.Adaptive.Enabled || len(site.Upstreams) < 2 {
+			continue
+		}
+
+		// Reuse the health checker's results when it is running for this
+		// site, otherwise probe with the same check.
+		var stats map[string]health.Stats
+		if site.HealthCheck != nil && site.HealthCheck.Enabled {
+			stats = make(map[string]health.Stats, len(site.Upstreams))
+			for _, st := range s.siteHealth(&site) {
+				stats[st.Address] = st
+			}
+		} else {
+			stats = s.probeSite(&site)
+		}
+
+		next := health.AdaptiveWeights(site.Upstreams, lb.Weights, stats, lb.Adaptive.MinWeight, lb.Adaptive.MaxWeight)
+		if !health.SignificantChange(lb.EffectiveWeights, next) {
+			continue
+		}
+
+		change := WeightChange{
+			Time:    time.Now(),
+			From:    maps.Clone(lb.EffectiveWeights),
+			To:      next,
+			Latency: make(map[string]string, len(stats)),
+			Healthy: make(map[string]bool, len(stats)),
+		}
+		for u, st := range stats {
+			change.Latency[u] = st.Latency.String()
+			change.Healthy[u] = st.Healthy
+		}
+		s.weights.add(site.ID, change)
+		slog.Info("Adjusting upstream weights", "site_id", site.ID, "from", change.From, "to", next)
+
+		lb.EffectiveWeights = next
+		if err := s.Store.SaveSite(&site); err != nil {
+			slog.Error("Balancer failed to save site", "site_id", site.ID, "error", err)
+			continue
+		}
+		siteCopy := site
+		s.noteConfigChange(site.ID, "", "balancer.weights_adjusted")
+		s.refreshSiteConfig(&siteCopy)
+	}
+}
+
+// BalancingStatus is returned by GET /v1/sites/{id}/balancing.
+type BalancingStatus struct {
+	Upstreams []string              `json:"upstreams"`
+	Config    *models.LoadBalancing `json:"config"`
+	Health    []health.Stats        `json:"health"`
+	History   []WeightChange        `json:"history"`
+}
+
+// handleSiteBalancing reports base and effective weights, the latest probe
+// results and the recent adjustment history.
+func (s *Server) handleSiteBalancing(w http.ResponseWriter, r *http.Request, siteID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(siteID)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	resp := BalancingStatus{
+		Upstreams: site.Upstreams,
+		Config:    site.LoadBalancing,
+		Health:    []health.Stats{},
+		History:   s.weights.get(siteID),
+	}
+	resp.Health = append(resp.Health, s.siteHealth(site)...)
+	jsonResponse(w, 200, resp)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// StartRateSchedules re-renders sites whose route rate_schedule windows
+// open or close, checking at every minute boundary. Sites with schedules
+// are rendered once at start, in case a boundary passed while hubfly was
+// down. Standbys skip it: they mirror the primary's rendered configs.
+func (s *Server) StartRateSchedules() {
+	go func() {
+		last := time.Time{}
+		for {
+			now := time.Now()
+			s.applyRateSchedules(last, now)
+			last = now
+			time.Sleep(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+		}
+	}()
+}
+
+// applyRateSchedules refreshes the sites whose limit_rate differs between
+// prev and now; a zero prev refreshes every scheduled site.
+func (s *Server) applyRateSchedules(prev, now time.Time) {
+	if s.readOnly.Load() {
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Rate schedules: failed to list sites", "error", err)
+		return
+	}
+	for i := range sites {
+		site := &sites[i]
+		if !nginx.HasRateSchedule(site) || !prev.IsZero() && !nginx.RatesChanged(site, prev, now) {
+			continue
+		}
+		slog.Info("Rate schedule boundary, re-rendering site", "site_id", site.ID)
+		s.noteConfigChange(site.ID, "", "site.rate_schedule")
+		s.refreshSiteConfig(site)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+)
+
+// CachePurgeRequest selects the cached responses to purge. Paths are
+// request URIs, with a trailing "*" matching a prefix; none purges all.
+type CachePurgeRequest struct {
+	Paths []string `json:"paths,omitempty"`
+}
+
+// CachePurgeResult is returned by POST /v1/sites/{id}/cache/purge.
+type CachePurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// handleSiteCachePurge serves POST /v1/sites/{id}/cache/purge.
+func (s *Server) handleSiteCachePurge(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	if site.Cache == nil || !site.Cache.Enabled {
+		errorResponse(w, 400, "site has no cache")
+		return
+	}
+
+	var req CachePurgeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+	}
+	for _, p := range req.Paths {
+		if !strings.HasPrefix(p, "/") {
+			errorResponse(w, 400, "paths must start with /")
+			return
+		}
+	}
+
+	purged, err := s.Nginx.PurgeCache(site.ID, req.Paths)
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	s.Audit.Record(audit.Event{
+		Action:     "site.cache_purged",
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      actor(r),
+		Details:    map[string]interface{}{"paths": req.Paths, "purged": purged},
+	})
+	jsonResponse(w, 200, CachePurgeResult{Purged: purged})
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Cache warming limits.
+const (
+	warmConcurrency    = 4
+	maxWarmConcurrency = 16
+	maxWarmURLs        = 1000
+	warmTimeout        = 30 * time.Second // Per request
+	maxSitemapSize     = 10 << 20
+)
+
+// CacheWarmRequest lists the URLs to fetch into a site's cache: paths or
+// absolute URLs on one of the site's names, and/or a sitemap (or sitemap
+// index) whose URLs are added.
+type CacheWarmRequest struct {
+	URLs        []string `json:"urls,omitempty"`
+	Sitemap     string   `json:"sitemap,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"` // Requests in flight (default 4, max 16)
+}
+
+// CacheWarmURL is the outcome of fetching one URL.
+type CacheWarmURL struct {
+	Path        string `json:"path"`
+	Status      int    `json:"status,omitempty"`
+	CacheStatus string `json:"cache_status,omitempty"` // X-Cache-Status: MISS, HIT, EXPIRED, BYPASS, ...
+	Latency     int64  `json:"latency_ms"`
+	Error       string `json:"error,omitempty"`
+}
+
+// CacheWarmResult is returned by POST /v1/sites/{id}/cache/warm once every
+// URL has been fetched.
+type CacheWarmResult struct {
+	Requested int            `json:"requested"`
+	Warmed    int            `json:"warmed"` // Answered with a 2xx or 3xx
+	Failed    int            `json:"failed"`
+	Skipped   int            `json:"skipped,omitempty"` // Sitemap URLs on other hosts
+	Duration  int64          `json:"duration_ms"`
+	URLs      []CacheWarmURL `json:"urls"`
+}
+
+// sitemap is a sitemap or a sitemap index; only the locations are read.
+type sitemap struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// handleSiteCacheWarm serves POST /v1/sites/{id}/cache/warm. Each URL is
+// requested through nginx with the site's domain as Host, over HTTPS when
+// the site has SSL, so the responses land under the cache keys clients
+// use.
+func (s *Server) handleSiteCacheWarm(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	if site.Cache == nil || !site.Cache.Enabled {
+		errorResponse(w, 400, "site has no cache")
+		return
+	}
+	host := syntheticHost(site)
+	if host == "" {
+		errorResponse(w, 400, "site has no literal server name to request")
+		return
+	}
+
+	var req CacheWarmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if len(req.URLs) == 0 && req.Sitemap == "" {
+		errorResponse(w, 400, "urls or sitemap is required")
+		return
+	}
+	if req.Concurrency < 0 || req.Concurrency > maxWarmConcurrency {
+		errorResponse(w, 400, fmt.Sprintf("concurrency must be between 1 and %d", maxWarmConcurrency))
+		return
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = warmConcurrency
+	}
+
+	start := time.Now()
+	var paths []string
+	for _, raw := range req.URLs {
+		p, ok := warmPath(site, raw)
+		if !ok {
+			errorResponse(w, 400, fmt.Sprintf("%q is not a path or a URL on one of the site's names", raw))
+			return
+		}
+		paths = append(paths, p)
+	}
+	skipped := 0
+	if req.Sitemap != "" {
+		p, ok := warmPath(site, req.Sitemap)
+		if !ok {
+			errorResponse(w, 400, fmt.Sprintf("sitemap %q is not a path or a URL on one of the site's names", req.Sitemap))
+			return
+		}
+		locs, err := s.fetchSitemap(r.Context(), site, host, p)
+		if err != nil {
+			errorResponse(w, 502, err.Error())
+			return
+		}
+		for _, loc := range locs {
+			if p, ok := warmPath(site, loc); ok {
+				paths = append(paths, p)
+			} else {
+				skipped++
+			}
+		}
+	}
+	paths = dedupe(paths)
+	if len(paths) > maxWarmURLs {
+		errorResponse(w, 400, fmt.Sprintf("at most %d URLs can be warmed at once, got %d", maxWarmURLs, len(paths)))
+		return
+	}
+
+	result := CacheWarmResult{Requested: len(paths), Skipped: skipped, URLs: s.warmPaths(r.Context(), site, host, paths, req.Concurrency)}
+	for _, u := range result.URLs {
+		if u.Error == "" {
+			result.Warmed++
+		} else {
+			result.Failed++
+		}
+	}
+	result.Duration = time.Since(start).Milliseconds()
+
+	s.Audit.Record(audit.Event{
+		Action:     "site.cache_warmed",
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      actor(r),
+		Details:    map[string]interface{}{"requested": result.Requested, "warmed": result.Warmed, "failed": result.Failed, "sitemap": req.Sitemap},
+	})
+	jsonResponse(w, 200, result)
+}
+
+// warmPath turns a path, or an http(s) URL on one of the site's names, into
+// the request URI to fetch.
+func warmPath(site *models.Site, raw string) (string, bool) {
+	if strings.HasPrefix(raw, "//") {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || strings.ContainsAny(raw, " \t\r\n") {
+		return "", false
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if u.Scheme != "http" && u.Scheme != "https" || !hasServerName(site, u.Hostname()) {
+			return "", false
+		}
+	} else if !strings.HasPrefix(raw, "/") {
+		return "", false
+	}
+	u.Scheme, u.Host, u.User, u.Fragment = "", "", nil, ""
+	return u.RequestURI(), true
+}
+
+func hasServerName(site *models.Site, host string) bool {
+	for _, name := range site.ServerNames() {
+		if strings.EqualFold(name, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	out := paths[:0]
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// fetchSitemap reads the locations of the sitemap at path, following one
+// level of sitemap index.
+func (s *Server) fetchSitemap(ctx context.Context, site *models.Site, host, path string) ([]string, error) {
+	sm, err := s.getSitemap(ctx, site, host, path)
+	if err != nil {
+		return nil, err
+	}
+	var locs []string
+	for _, u := range sm.URLs {
+		locs = append(locs, strings.TrimSpace(u.Loc))
+	}
+	for _, child := range sm.Sitemaps {
+		p, ok := warmPath(site, strings.TrimSpace(child.Loc))
+		if !ok {
+			continue // Another host's sitemap
+		}
+		sub, err := s.getSitemap(ctx, site, host, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range sub.URLs {
+			locs = append(locs, strings.TrimSpace(u.Loc))
+		}
+	}
+	return locs, nil
+}
+
+func (s *Server) getSitemap(ctx context.Context, site *models.Site, host, path string) (*sitemap, error) {
+	resp, err := s.warmRequest(ctx, site, host, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: status %d", path, resp.StatusCode)
+	}
+	var sm sitemap
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSitemapSize)).Decode(&sm); err != nil {
+		return nil, fmt.Errorf("sitemap %s is not valid XML: %w", path, err)
+	}
+	return &sm, nil
+}
+
+// warmPaths fetches paths with up to concurrency requests in flight and
+// returns their outcomes in order.
+func (s *Server) warmPaths(ctx context.Context, site *models.Site, host string, paths []string, concurrency int) []CacheWarmURL {
+	results := make([]CacheWarmURL, len(paths))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, p := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p string) {
+			defer func() { <-sem; wg.Done() }()
+			res := CacheWarmURL{Path: p}
+			start := time.Now()
+			resp, err := s.warmRequest(ctx, site, host, p)
+			if err == nil {
+				// The whole body must pass through nginx to be cached.
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				res.Status = resp.StatusCode
+				res.CacheStatus = resp.Header.Get("X-Cache-Status")
+				if err == nil && resp.StatusCode >= 400 {
+					err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+				}
+			}
+			res.Latency = time.Since(start).Milliseconds()
+			if err != nil {
+				res.Error = err.Error()
+			}
+			results[i] = res
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// warmRequest GETs path from the site through nginx's local listener. The
+// listener is our own, so its certificate isn't verified: warming works
+// with staging certificates too.
+func (s *Server) warmRequest(ctx context.Context, site *models.Site, host, path string) (*http.Response, error) {
+	scheme := "http"
+	if site.SSL {
+		scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "hubfly-cache-warm")
+	return s.SyntheticTarget.Client(site.SSL, warmTimeout, true).Do(req)
+}
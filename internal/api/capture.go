@@ -0,0 +1,393 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// Capture limits.
+const (
+	defaultCaptureMinutes = 10
+	maxCaptureMinutes     = 24 * 60
+	maxHAREntries         = 10000
+	captureSweep          = 15 * time.Second // How often expired captures are taken out of nginx
+)
+
+// CaptureRequest starts a traffic capture on a site, replacing any
+// earlier one and its recording.
+type CaptureRequest struct {
+	SampleRate      float64  `json:"sample_rate,omitempty"`      // Share of requests recorded, e.g. 0.1; 0 records all
+	DurationMinutes int      `json:"duration_minutes,omitempty"` // Default 10, max 1440
+	Headers         []string `json:"headers,omitempty"`          // More headers to record, e.g. Cookie
+	RequestBodies   bool     `json:"request_bodies,omitempty"`
+}
+
+// CaptureStatus is GET /v1/sites/{id}/capture.
+type CaptureStatus struct {
+	Capture   *models.Capture `json:"capture,omitempty"` // Omitted when the site has no capture
+	Active    bool            `json:"active"`
+	SizeBytes int64           `json:"size_bytes"`
+}
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), as far as a
+// capture can fill it. Fields starting with "_" are hubfly's own.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	RequestID       string      `json:"_requestId,omitempty"`
+	ClientAddr      string      `json:"_clientAddr,omitempty"`
+	UpstreamAddr    string      `json:"_upstreamAddr,omitempty"`
+	TLS             string      `json:"_tlsProtocol,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNV      `json:"cookies"`
+	Headers     []harNV      `json:"headers"`
+	QueryString []harNV      `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harNV    `json:"cookies"`
+	Headers     []harNV    `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int64      `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harNV struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // To the upstream
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// handleSiteCapture serves /v1/sites/{id}/capture: GET shows the capture,
+// POST starts one and DELETE stops it and deletes the recording.
+func (s *Server) handleSiteCapture(w http.ResponseWriter, r *http.Request, id string) {
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, 200, s.captureStatus(site))
+
+	case http.MethodPost:
+		var req CaptureRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if req.DurationMinutes < 0 || req.DurationMinutes > maxCaptureMinutes {
+			errorResponse(w, 400, fmt.Sprintf("duration_minutes must be between 1 and %d", maxCaptureMinutes))
+			return
+		}
+		if req.DurationMinutes == 0 {
+			req.DurationMinutes = defaultCaptureMinutes
+		}
+		now := time.Now().UTC()
+		capture := &models.Capture{
+			SampleRate:    req.SampleRate,
+			Headers:       req.Headers,
+			RequestBodies: req.RequestBodies,
+			StartedAt:     now,
+			ExpiresAt:     now.Add(time.Duration(req.DurationMinutes) * time.Minute),
+		}
+		if err := nginx.CheckCapture(capture); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.LogManager.ClearCapture(site.ID); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		site.Capture = capture
+		site.UpdatedAt = now
+		if err := s.Store.SaveSite(site); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.noteConfigChange(site.ID, actor(r), "site.capture_started")
+		go s.refreshSiteConfig(site)
+
+		s.Audit.Record(audit.Event{
+			Action:     "site.capture_started",
+			Resource:   "site",
+			ResourceID: site.ID,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"sample_rate": capture.SampleRate, "expires_at": capture.ExpiresAt, "request_bodies": capture.RequestBodies},
+		})
+		jsonResponse(w, 200, s.captureStatus(site))
+
+	case http.MethodDelete:
+		if site.Capture == nil {
+			jsonResponse(w, 200, map[string]string{"status": "no capture to stop"})
+			return
+		}
+		active := site.Capture.Active(time.Now())
+		site.Capture = nil
+		site.UpdatedAt = time.Now()
+		if err := s.Store.SaveSite(site); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		if active {
+			s.noteConfigChange(site.ID, actor(r), "site.capture_stopped")
+			go s.refreshSiteConfig(site)
+		}
+		if err := s.LogManager.RemoveCapture(site.ID); err != nil {
+			slog.Warn("Failed to remove capture", "site_id", site.ID, "error", err)
+		}
+
+		s.Audit.Record(audit.Event{
+			Action:     "site.capture_stopped",
+			Resource:   "site",
+			ResourceID: site.ID,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 200, map[string]string{"status": "stopped"})
+
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+func (s *Server) captureStatus(site *models.Site) CaptureStatus {
+	status := CaptureStatus{Capture: site.Capture, Active: site.Capture.Active(time.Now())}
+	if fi, err := os.Stat(s.LogManager.CaptureFile(site.ID)); err == nil {
+		status.SizeBytes = fi.Size()
+	}
+	return status
+}
+
+// handleSiteCaptureHAR serves GET /v1/sites/{id}/capture/har, the capture
+// as a HAR file, while it records and after it expired.
+func (s *Server) handleSiteCaptureHAR(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	if site.Capture == nil {
+		errorResponse(w, 404, "site has no capture")
+		return
+	}
+	limit := maxHAREntries
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxHAREntries {
+			errorResponse(w, 400, fmt.Sprintf("limit must be between 1 and %d", maxHAREntries))
+			return
+		}
+		limit = n
+	}
+	entries, err := s.LogManager.GetCapture(site.ID, limit)
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "hubfly", Version: s.Version},
+		Entries: make([]harEntry, 0, len(entries)),
+		Comment: "Recorded by nginx: response bodies are not captured, and timings are measured at the proxy.",
+	}}
+	for _, e := range entries {
+		har.Log.Entries = append(har.Log.Entries, harFromCapture(e))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+site.ID+`-`+site.Capture.StartedAt.Format("20060102T150405Z")+`.har"`)
+	json.NewEncoder(w).Encode(har)
+}
+
+// harFromCapture converts a captured request. The timings split nginx's
+// request time at the upstream's connect and first byte; requests nginx
+// answered itself spend it all waiting.
+func harFromCapture(e logmanager.CaptureEntry) harEntry {
+	total := e.RequestTime * 1000
+	t := harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: total}
+	if e.UpstreamHeaderTime >= 0 {
+		connect := max(e.UpstreamConnectTime*1000, 0)
+		header := max(e.UpstreamHeaderTime*1000, connect)
+		t.Connect = connect
+		t.Wait = header - connect
+		t.Receive = max(total-header, 0)
+	}
+
+	reqHeaders := harHeaders(e.RequestHeaders)
+	respHeaders := harHeaders(e.ResponseHeaders)
+	reqBody, _ := strconv.ParseInt(e.RequestHeaders["content-length"], 10, 64)
+	entry := harEntry{
+		StartedDateTime: e.Start.Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            max(t.Connect, 0) + t.Wait + t.Receive,
+		Request: harRequest{
+			Method:      e.Method,
+			URL:         e.Scheme + "://" + e.Host + e.URI,
+			HTTPVersion: e.Protocol,
+			Cookies:     []harNV{},
+			Headers:     reqHeaders,
+			QueryString: harQuery(e.URI),
+			HeadersSize: -1,
+			BodySize:    reqBody,
+		},
+		Response: harResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: e.Protocol,
+			Cookies:     []harNV{},
+			Headers:     respHeaders,
+			Content:     harContent{Size: e.BodyBytesSent, MimeType: e.ResponseHeaders["content-type"]},
+			RedirectURL: e.ResponseHeaders["location"],
+			HeadersSize: e.BytesSent - e.BodyBytesSent,
+			BodySize:    e.BodyBytesSent,
+		},
+		Timings:      t,
+		RequestID:    e.RequestID,
+		ClientAddr:   e.RemoteAddr,
+		UpstreamAddr: e.UpstreamAddr,
+		TLS:          e.SSLProtocol,
+	}
+	if e.RequestBody != "" {
+		entry.Request.PostData = &harPostData{MimeType: e.RequestHeaders["content-type"], Text: e.RequestBody}
+	}
+	return entry
+}
+
+// harHeaders lists headers sorted by name, so entries diff cleanly.
+func harHeaders(h map[string]string) []harNV {
+	out := make([]harNV, 0, len(h))
+	for name, value := range h {
+		out = append(out, harNV{Name: name, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func harQuery(uri string) []harNV {
+	out := []harNV{}
+	_, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return out
+	}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		out = append(out, harNV{Name: name, Value: value})
+	}
+	return out
+}
+
+// StartCaptures takes captures out of nginx's config once they expire.
+// The recordings stay downloadable until the capture is stopped or
+// replaced. Standbys skip it: they mirror the primary's rendered configs.
+func (s *Server) StartCaptures() {
+	go func() {
+		last := time.Time{}
+		ticker := time.NewTicker(captureSweep)
+		defer ticker.Stop()
+		for {
+			now := time.Now()
+			s.expireCaptures(last, now)
+			last = now
+			<-ticker.C
+		}
+	}()
+}
+
+// expireCaptures refreshes the sites whose capture expired in (prev, now];
+// a zero prev refreshes every site with an expired capture.
+func (s *Server) expireCaptures(prev, now time.Time) {
+	if s.readOnly.Load() {
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Captures: failed to list sites", "error", err)
+		return
+	}
+	for i := range sites {
+		site := &sites[i]
+		if site.Capture == nil || site.Capture.Active(now) || !prev.IsZero() && !site.Capture.Active(prev) {
+			continue
+		}
+		slog.Info("Capture expired, re-rendering site", "site_id", site.ID)
+		s.noteConfigChange(site.ID, "", "site.capture_expired")
+		s.refreshSiteConfig(site)
+	}
+}
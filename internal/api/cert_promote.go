@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// promotionStarted answers a promotion running in the background; the
+// site's status and cert_promotion show how it ends.
+type promotionStarted struct {
+	Status string `json:"status"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// handleSiteCertPromote serves POST /v1/sites/{id}/certificates/promote:
+// the site's certificate from a staging CA is re-issued by a production CA
+// into a new lineage, and the site switches to it in one verified reload.
+// The body optionally picks the CA like a site's acme settings; it
+// defaults to Let's Encrypt. Issuance runs in the background unless
+// ?wait=true.
+func (s *Server) handleSiteCertPromote(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	var acme models.ACMEConfig
+	if err := json.NewDecoder(r.Body).Decode(&acme); err != nil && !errors.Is(err, io.EOF) {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if acme.Server == "" {
+		acme.Server = certbot.LetsEncryptProduction
+	}
+	acme.KeepEABKey(site.ACME)
+
+	switch {
+	case !site.SSL:
+		errorResponse(w, 400, "site has no certificate")
+		return
+	case site.Wildcard != "":
+		errorResponse(w, 400, "site serves the shared wildcard certificate of "+site.Wildcard)
+		return
+	case certbot.IsStagingServer(acme.Server):
+		errorResponse(w, 400, "server is a staging CA")
+		return
+	}
+	current, err := s.Certbot.Certificate(site.CertName())
+	if err != nil {
+		errorResponse(w, 409, "site certificate is unreadable: "+err.Error())
+		return
+	}
+	if !certbot.IsStagingIssuer(current.Issuer) {
+		errorResponse(w, 409, fmt.Sprintf("certificate is already issued by %s, not a staging CA", current.Issuer))
+		return
+	}
+
+	if !wantWait(r) {
+		go s.promoteCert(*site, current, acme, actor(r))
+		jsonResponse(w, 202, promotionStarted{Status: "promoting", From: site.CertName(), To: promotedLineage(site)})
+		return
+	}
+	promotion, err := s.promoteCert(*site, current, acme, actor(r))
+	if err != nil {
+		errorResponse(w, 502, err.Error())
+		return
+	}
+	jsonResponse(w, 200, promotion)
+}
+
+// promotedLineage is where a promoted certificate goes: next to the
+// lineage named after the domain, or back to that name when the site
+// already moved off it.
+func promotedLineage(site *models.Site) string {
+	if site.CertName() == site.Domain {
+		return site.Domain + "-production"
+	}
+	return site.Domain
+}
+
+// promoteCert issues the production certificate and switches site to it.
+// Until the reload succeeds the site keeps serving the staging one.
+func (s *Server) promoteCert(site models.Site, current *certbot.CertInfo, acme models.ACMEConfig, actor string) (*models.CertPromotion, error) {
+	from, to := site.CertName(), promotedLineage(&site)
+	fail := func(err error) (*models.CertPromotion, error) {
+		err = fmt.Errorf("certificate promotion failed: %w", err)
+		slog.Error("Certificate promotion failed", "site_id", site.ID, "from", from, "to", to, "error", err)
+		s.updateStatus(site.ID, "active", err.Error())
+		s.Audit.Record(audit.Event{
+			Action:     "certificate.promotion_failed",
+			Resource:   "site",
+			ResourceID: site.ID,
+			Actor:      actor,
+			Details:    map[string]interface{}{"from": from, "to": to, "server": acme.Server, "error": err.Error()},
+		})
+		return nil, err
+	}
+
+	slog.Info("Promoting certificate", "site_id", site.ID, "from", from, "to", to, "server", acme.Server)
+	s.updateStatus(site.ID, "provisioning", "promoting certificate")
+	opts := issueOptions(&site)
+	opts.Server, opts.EABKeyID, opts.EABHMACKey = acme.Server, acme.EABKeyID, acme.EABHMACKey
+	opts.CertName = to
+	if err := s.Certbot.Issue(site.Domain, opts); err != nil {
+		return fail(err)
+	}
+	issued, err := s.Certbot.Certificate(to)
+	if err != nil {
+		return fail(err)
+	}
+	if certbot.IsStagingIssuer(issued.Issuer) {
+		return fail(fmt.Errorf("%s issued a staging certificate (%s)", acme.Server, issued.Issuer))
+	}
+
+	site.CertLineage = to
+	if to == site.Domain {
+		site.CertLineage = ""
+	}
+	s.noteConfigChange(site.ID, actor, "certificate.promoted")
+	staging, err := s.Nginx.GenerateConfig(&site)
+	if err != nil {
+		return fail(err)
+	}
+	if err := s.Nginx.Validate(staging); err != nil {
+		return fail(err)
+	}
+	if err := s.applySiteConfig(&site, staging); err != nil {
+		return fail(err)
+	}
+
+	promotion := &models.CertPromotion{
+		From:       from,
+		FromIssuer: current.Issuer,
+		To:         to,
+		ToIssuer:   issued.Issuer,
+		Server:     acme.Server,
+		PromotedAt: time.Now(),
+	}
+	// Later issuance for the site goes to the production CA too.
+	if stored, err := s.Store.GetSite(site.ID); err == nil {
+		stored.CertLineage = site.CertLineage
+		stored.CertPromotion = promotion
+		stored.ACME = &acme
+		stored.CertIssueStatus = "valid"
+		stored.CertExpiresAt = &issued.NotAfter
+		stored.Status = "active"
+		stored.ErrorMessage = ""
+		stored.UpdatedAt = time.Now()
+		if err := s.Store.SaveSite(stored); err != nil {
+			slog.Error("Failed to save certificate promotion", "site_id", site.ID, "error", err)
+		}
+	}
+	s.Audit.Record(audit.Event{
+		Action:     "certificate.promoted",
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      actor,
+		Details: map[string]interface{}{
+			"from": from, "from_issuer": current.Issuer, "from_serial": current.Serial,
+			"to": to, "to_issuer": issued.Issuer, "to_serial": issued.Serial,
+			"server": acme.Server,
+		},
+	})
+	slog.Info("Certificate promoted", "site_id", site.ID, "from", from, "to", to, "issuer", issued.Issuer)
+	if len(s.Nginx.DeployCheckHosts) > 0 {
+		s.checkCertDeployment(&site, actor)
+	}
+	return promotion, nil
+}
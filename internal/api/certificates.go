@@ -0,0 +1,331 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/idn"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// PreissueJob tracks a certificate issued ahead of site creation.
+type PreissueJob struct {
+	Domain     string     `json:"domain"`
+	AltNames   []string   `json:"alt_names,omitempty"`
+	Status     string     `json:"status"` // "pending", "issued", "failed"
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type preissueJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*PreissueJob
+}
+
+// start registers a pending job, returning false if one is already running.
+func (p *preissueJobs) start(domain string, altNames []string) (*PreissueJob, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jobs == nil {
+		p.jobs = make(map[string]*PreissueJob)
+	}
+	if j, ok := p.jobs[domain]; ok && j.Status == "pending" {
+		return j, false
+	}
+	j := &PreissueJob{Domain: domain, AltNames: altNames, Status: "pending", StartedAt: time.Now()}
+	p.jobs[domain] = j
+	return j, true
+}
+
+func (p *preissueJobs) finish(domain string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j, ok := p.jobs[domain]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Status = "issued"
+	if err != nil {
+		j.Status = "failed"
+		j.Error = err.Error()
+	}
+}
+
+func (p *preissueJobs) get(domain string) (PreissueJob, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j, ok := p.jobs[domain]
+	if !ok {
+		return PreissueJob{}, false
+	}
+	return *j, true
+}
+
+func (p *preissueJobs) list() []PreissueJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := []PreissueJob{}
+	for _, j := range p.jobs {
+		list = append(list, *j)
+	}
+	return list
+}
+
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	certs, err := s.Certbot.ListCertificates()
+	if err != nil {
+		errorResponse(w, 500, "failed to list certificates: "+err.Error())
+		return
+	}
+	jsonResponse(w, 200, map[string]interface{}{
+		"certificates": certs,
+		"preissue":     s.preissue.list(),
+	})
+}
+
+func (s *Server) handleCertificateDetail(w http.ResponseWriter, r *http.Request) {
+	domain := strings.TrimPrefix(r.URL.Path, "/v1/certificates/")
+	if domain == "preissue" {
+		s.handlePreissue(w, r)
+		return
+	}
+	domain = asciiID(domain)
+	if name, ok := strings.CutSuffix(domain, "/precheck"); ok {
+		s.handlePrecheck(w, r, name)
+		return
+	}
+	if name, ok := strings.CutSuffix(domain, "/rotate"); ok {
+		s.handleRotate(w, r, name)
+		return
+	}
+	if domain == "" || r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	resp := map[string]interface{}{"domain": domain}
+	if info, err := s.Certbot.Certificate(domain); err == nil {
+		resp["certificate"] = info
+	}
+	if job, ok := s.preissue.get(domain); ok {
+		resp["preissue"] = job
+	}
+	if len(resp) == 1 {
+		errorResponse(w, 404, "certificate not found")
+		return
+	}
+	jsonResponse(w, 200, resp)
+}
+
+// RotateResult is a lineage after an on-demand key rotation.
+type RotateResult struct {
+	Certificate     *certbot.CertInfo `json:"certificate"`
+	PreviousKey     string            `json:"previous_key_sha256"`
+	RevokedPrevious bool              `json:"revoked_previous"`
+	RevokeError     string            `json:"revoke_error,omitempty"`
+}
+
+// handleRotate re-issues a certificate with a new private key right away:
+// POST /v1/certificates/{domain}/rotate?revoke_previous=true. Revoking the
+// replaced certificate (reason keyCompromise) is for a leaked key.
+func (s *Server) handleRotate(w http.ResponseWriter, r *http.Request, lineage string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	before, err := s.Certbot.Certificate(lineage)
+	if err != nil {
+		errorResponse(w, 404, "certificate not found")
+		return
+	}
+	previous, _ := s.Certbot.PreviousCert(lineage)
+
+	res := certbot.RenewResult{Lineage: lineage, NotAfter: before.NotAfter, NewKey: true}
+	if res.Err = s.Certbot.Rotate(lineage); res.Err == nil {
+		res.Renewed = true
+	}
+	after, err := s.Certbot.Certificate(lineage)
+	if err == nil {
+		res.NotAfter = after.NotAfter
+	}
+	s.applyRenewals([]certbot.RenewResult{res}, actor(r))
+	if res.Err != nil {
+		errorResponse(w, 502, res.Err.Error())
+		return
+	}
+
+	out := RotateResult{Certificate: after, PreviousKey: before.KeySHA256}
+	if r.URL.Query().Get("revoke_previous") == "true" {
+		err := fmt.Errorf("previous certificate file not found")
+		if previous != "" {
+			err = s.Certbot.RevokeRotated(lineage, previous)
+		}
+		event := audit.Event{
+			Action:     "certificate.revoked",
+			Resource:   "certificate",
+			ResourceID: lineage,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"reason": "keyCompromise", "cert_path": previous},
+		}
+		if err != nil {
+			event.Action = "certificate.revoke_failed"
+			event.Details["error"] = err.Error()
+			out.RevokeError = err.Error()
+		}
+		s.Audit.Record(event)
+		out.RevokedPrevious = err == nil
+	}
+	jsonResponse(w, 200, out)
+}
+
+// PrecheckResult is the outcome of the pre-issuance DNS checks.
+type PrecheckResult struct {
+	Domain   string            `json:"domain"`
+	CA       []string          `json:"ca,omitempty"` // CAA issuer domains of the ACME server; empty if unknown
+	OK       bool              `json:"ok"`
+	Problems []certbot.Problem `json:"problems"`
+}
+
+// handlePrecheck runs the CAA and DNS checks that precede issuance without
+// issuing: GET /v1/certificates/{domain}/precheck?challenge=&alt_names=&acme_server=
+func (s *Server) handlePrecheck(w http.ResponseWriter, r *http.Request, domain string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	q := r.URL.Query()
+	opts := certbot.IssueOptions{Server: q.Get("acme_server"), Challenge: q.Get("challenge")}
+	if v := q.Get("alt_names"); v != "" {
+		names, err := asciiNames(strings.Split(v, ","))
+		if err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		opts.AltNames = names
+	}
+	if opts.Challenge != "" && opts.Challenge != certbot.ChallengeHTTP01 && opts.Challenge != certbot.ChallengeDNS01 {
+		errorResponse(w, 400, "challenge must be http-01 or dns-01")
+		return
+	}
+
+	server := s.Certbot.Server
+	if opts.Server != "" {
+		server = opts.Server
+	}
+	res := PrecheckResult{Domain: domain, CA: certbot.CAIdentities(server), OK: true, Problems: []certbot.Problem{}}
+	for _, p := range s.Certbot.Precheck(domain, opts) {
+		res.Problems = append(res.Problems, p)
+		res.OK = res.OK && !p.Fatal
+	}
+	jsonResponse(w, 200, res)
+}
+
+// handlePreissue issues a certificate over DNS-01 for a domain that has no
+// site yet, so creating the site later can use it immediately.
+func (s *Server) handlePreissue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	var req struct {
+		Domain   string             `json:"domain"`
+		AltNames []string           `json:"alt_names"`
+		ACME     *models.ACMEConfig `json:"acme"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if req.Domain == "" {
+		errorResponse(w, 400, "domain is required")
+		return
+	}
+	domain, err := idn.ToASCII(req.Domain)
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	altNames, err := asciiNames(req.AltNames)
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	req.Domain, req.AltNames = domain, altNames
+	if !s.Certbot.DNSEnabled() {
+		errorResponse(w, 400, "pre-issuance requires DNS-01; start hubfly with --dns-plugin")
+		return
+	}
+
+	// A "*.zone" request fills the shared lineage used by wildcard sites,
+	// which may already be attached.
+	lineage := req.Domain
+	if zone, ok := strings.CutPrefix(req.Domain, "*."); ok {
+		lineage = models.WildcardCertName(zone)
+		req.AltNames = append([]string{zone}, req.AltNames...)
+	} else {
+		// Pre-issuance is for planned domains only; attached ones are managed
+		// by site provisioning.
+		planned := &models.Site{Domain: req.Domain, Aliases: req.AltNames}
+		sites, _ := s.Store.ListSites()
+		if other, name := nginx.FindServerNameConflict(planned, sites); other != nil {
+			errorResponse(w, 409, "domain "+name+" is already attached to site "+other.ID)
+			return
+		}
+	}
+
+	if s.Certbot.LineageCovers(lineage, append([]string{req.Domain}, req.AltNames...)...) {
+		info, _ := s.Certbot.Certificate(lineage)
+		jsonResponse(w, 200, map[string]interface{}{"status": "exists", "certificate": info})
+		return
+	}
+
+	job, ok := s.preissue.start(req.Domain, req.AltNames)
+	if !ok {
+		errorResponse(w, 409, "pre-issuance already in progress for "+req.Domain)
+		return
+	}
+
+	opts := issueOptions(&models.Site{Aliases: req.AltNames, ACME: req.ACME})
+	opts.Challenge = certbot.ChallengeDNS01
+	if lineage != req.Domain {
+		opts.CertName = lineage
+	}
+	who := actor(r)
+	go func() {
+		err := s.Certbot.Issue(req.Domain, opts)
+		s.preissue.finish(req.Domain, err)
+
+		event := audit.Event{
+			Action:     "certificate.preissued",
+			Resource:   "certificate",
+			ResourceID: req.Domain,
+			Actor:      who,
+			Details:    map[string]interface{}{"alt_names": req.AltNames},
+		}
+		if err != nil {
+			slog.Error("Certificate pre-issuance failed", "domain", req.Domain, "error", err)
+			event.Action = "certificate.preissue_failed"
+			event.Details["error"] = err.Error()
+		} else {
+			slog.Info("Certificate pre-issued", "domain", req.Domain)
+		}
+		s.Audit.Record(event)
+	}()
+
+	jsonResponse(w, 202, job)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"os"
+	"sync"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// maxAuditDiff caps the config diff kept in a site.config_applied event.
+const maxAuditDiff = 64 << 10
+
+// configChange is who or what last asked for a site to be re-rendered.
+// Renders run in the background, so the request that caused one is noted
+// before it starts and recorded with the resulting config diff.
+type configChange struct {
+	Actor   string
+	Trigger string // e.g. "site.updated", "template.updated:default"
+}
+
+type pendingChanges struct {
+	mu    sync.Mutex
+	sites map[string]configChange
+}
+
+// noteConfigChange records the cause of the next render of a site.
+func (s *Server) noteConfigChange(siteID, actor, trigger string) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+	if s.changes.sites == nil {
+		s.changes.sites = make(map[string]configChange)
+	}
+	s.changes.sites[siteID] = configChange{Actor: actor, Trigger: trigger}
+}
+
+func (s *Server) configChangeFor(siteID string) configChange {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+	return s.changes.sites[siteID]
+}
+
+func (s *Server) forgetConfigChange(siteID string) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+	delete(s.changes.sites, siteID)
+}
+
+// applySiteConfig puts a rendered config live, keeping it only if the
+// site's canary request passes. If the live file changed, it records a
+// site.config_applied event with the diff, so the audit trail shows
+// exactly what changed in nginx and who caused it.
+func (s *Server) applySiteConfig(site *models.Site, staging string) error {
+	live := s.Nginx.SiteConfigFile(site.ID)
+	old, _ := os.ReadFile(live)
+	canary := func() error { return s.Nginx.Canary(site) }
+	if err := s.Nginx.ApplyVerified(site.ID, staging, canary); err != nil {
+		return err
+	}
+	current, err := os.ReadFile(live)
+	if err != nil {
+		return nil
+	}
+
+	diff, added, removed := audit.Diff(site.ID+".conf", string(old), string(current))
+	if diff == "" {
+		return nil
+	}
+	details := map[string]interface{}{
+		"lines_added":   added,
+		"lines_removed": removed,
+	}
+	if len(diff) > maxAuditDiff {
+		diff = diff[:maxAuditDiff]
+		details["truncated"] = true
+	}
+	details["diff"] = diff
+
+	change := s.configChangeFor(site.ID)
+	if change.Trigger != "" {
+		details["trigger"] = change.Trigger
+	}
+	s.Audit.Record(audit.Event{
+		Action:     audit.ConfigApplied,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      change.Actor,
+		Details:    details,
+	})
+	return nil
+}
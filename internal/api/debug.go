@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// connStats counts management API connections and requests. Connections
+// are tracked through http.Server.ConnState (see ConnState).
+type connStats struct {
+	accepted atomic.Int64
+	active   atomic.Int64
+	idle     atomic.Int64
+	requests atomic.Int64
+	inFlight atomic.Int64
+	states   sync.Map // net.Conn -> last http.ConnState
+}
+
+// ConnState is the http.Server.ConnState hook for the API listener.
+func (s *Server) ConnState(c net.Conn, state http.ConnState) {
+	if prev, ok := s.conns.states.Load(c); ok && prev == http.StateIdle {
+		s.conns.idle.Add(-1)
+	}
+	switch state {
+	case http.StateNew:
+		s.conns.accepted.Add(1)
+		s.conns.active.Add(1)
+	case http.StateIdle:
+		s.conns.idle.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		s.conns.active.Add(-1)
+		s.conns.states.Delete(c)
+		return
+	}
+	s.conns.states.Store(c, state)
+}
+
+// DebugVars are hubfly's internals as served under "hubfly" by
+// /debug/vars on the debug listener.
+type DebugVars struct {
+	Goroutines int               `json:"goroutines"`
+	API        APIConnStats      `json:"api"`
+	Reloads    nginx.ReloadStats `json:"reloads"`
+	Store      StoreSizes        `json:"store"`
+	Queues     QueueDepths       `json:"queues"`
+}
+
+type APIConnStats struct {
+	ConnectionsAccepted int64 `json:"connections_accepted"`
+	ConnectionsOpen     int64 `json:"connections_open"`
+	ConnectionsIdle     int64 `json:"connections_idle"`
+	Requests            int64 `json:"requests"`
+	RequestsInFlight    int64 `json:"requests_in_flight"`
+}
+
+type StoreSizes struct {
+	Sites   int `json:"sites"`
+	Streams int `json:"streams"`
+	APIKeys int `json:"api_keys"`
+}
+
+// QueueDepths is pending background work.
+type QueueDepths struct {
+	PreissueJobs   int `json:"preissue_jobs"`   // Certificate pre-issuance still running
+	Provisioning   int `json:"provisioning"`    // Sites and streams waiting for config or certificates
+	UsageUnflushed int `json:"usage_unflushed"` // API keys with request counts not yet saved
+}
+
+// DebugVars collects the current internals.
+func (s *Server) DebugVars() DebugVars {
+	v := DebugVars{
+		Goroutines: runtime.NumGoroutine(),
+		API: APIConnStats{
+			ConnectionsAccepted: s.conns.accepted.Load(),
+			ConnectionsOpen:     s.conns.active.Load(),
+			ConnectionsIdle:     s.conns.idle.Load(),
+			Requests:            s.conns.requests.Load(),
+			RequestsInFlight:    s.conns.inFlight.Load(),
+		},
+		Reloads: s.Nginx.ReloadStats(),
+	}
+	if sites, err := s.Store.ListSites(); err == nil {
+		v.Store.Sites = len(sites)
+		for _, site := range sites {
+			if site.Status == "provisioning" {
+				v.Queues.Provisioning++
+			}
+		}
+	}
+	if streams, err := s.Store.ListStreams(); err == nil {
+		v.Store.Streams = len(streams)
+		for _, stream := range streams {
+			if stream.Status == "provisioning" {
+				v.Queues.Provisioning++
+			}
+		}
+	}
+	if keys, err := s.Store.ListAPIKeys(); err == nil {
+		v.Store.APIKeys = len(keys)
+	}
+
+	s.preissue.mu.Lock()
+	for _, j := range s.preissue.jobs {
+		if j.Status == "pending" {
+			v.Queues.PreissueJobs++
+		}
+	}
+	s.preissue.mu.Unlock()
+
+	s.usage.mu.Lock()
+	for _, ku := range s.usage.keys {
+		if ku.pending > 0 {
+			v.Queues.UsageUnflushed++
+		}
+	}
+	s.usage.mu.Unlock()
+	return v
+}
+
+// DebugRoutes serves net/http/pprof under /debug/pprof/ and the expvar
+// variables (memstats, cmdline) plus DebugVars at /debug/vars. It carries
+// no authentication and must only be bound to loopback; see
+// CheckDebugAddr.
+func (s *Server) DebugRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/vars", s.handleDebugVars)
+	return mux
+}
+
+// handleDebugVars writes the same JSON object as expvar.Handler with a
+// "hubfly" variable added. Nothing is registered globally, so several
+// servers (as in tests) don't collide.
+func (s *Server) handleDebugVars(w http.ResponseWriter, r *http.Request) {
+	hubfly, err := json.Marshal(s.DebugVars())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n%q: %s", "hubfly", hubfly)
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, ",\n%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// CheckDebugAddr refuses debug listener addresses that are not loopback.
+func CheckDebugAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid debug address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("debug address %q must be a loopback address such as 127.0.0.1:6060", addr)
+	}
+	return nil
+}
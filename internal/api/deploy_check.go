@@ -0,0 +1,117 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// deployChecks keeps the latest certificate deployment check of each site.
+type deployChecks struct {
+	mu   sync.Mutex
+	last map[string]*nginx.DeployCheck
+}
+
+func (d *deployChecks) get(siteID string) *nginx.DeployCheck {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last[siteID]
+}
+
+func (d *deployChecks) set(siteID string, check *nginx.DeployCheck) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.last == nil {
+		d.last = make(map[string]*nginx.DeployCheck)
+	}
+	d.last[siteID] = check
+}
+
+// checkCertDeployment verifies that nginx serves the site's current
+// certificate on every local listener, and its HTTPS redirect with
+// force_ssl. A failed check is audited as certificate.deployment_stale
+// (an old certificate is still served) or certificate.deployment_failed.
+// Sites named by a pattern can't be asked for by name and are skipped.
+func (s *Server) checkCertDeployment(site *models.Site, who string) *nginx.DeployCheck {
+	if nginx.IsWildcardServerName(site.Domain) || nginx.IsRegexServerName(site.Domain) {
+		return nil
+	}
+	info, err := s.Certbot.Certificate(site.CertName())
+	if err != nil {
+		slog.Error("Deployment check: failed to read certificate", "site_id", site.ID, "error", err)
+		return nil
+	}
+	check := s.Nginx.CheckDeployment(site.Domain, info.Serial, site.ForceSSL)
+	s.deploys.set(site.ID, check)
+	if check.OK {
+		return check
+	}
+
+	action := "certificate.deployment_failed"
+	if check.Stale {
+		action = "certificate.deployment_stale"
+	}
+	slog.Error("nginx is not serving the new certificate", "site_id", site.ID, "domain", site.Domain, "serial", info.Serial, "stale", check.Stale)
+	s.Audit.Record(audit.Event{
+		Action:     action,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      who,
+		Details:    map[string]interface{}{"lineage": site.CertName(), "serial": info.Serial, "probes": check.Probes},
+	})
+	return check
+}
+
+// checkCertDeployments runs checkCertDeployment on each site in turn;
+// renewals call it in the background so the scheduler isn't held up.
+func (s *Server) checkCertDeployments(sites []models.Site) {
+	if len(s.Nginx.DeployCheckHosts) == 0 {
+		return
+	}
+	for i := range sites {
+		s.checkCertDeployment(&sites[i], "")
+	}
+}
+
+// handleSiteCertDeployment serves /v1/sites/{id}/cert-deployment: GET
+// returns the latest check, POST runs one now.
+func (s *Server) handleSiteCertDeployment(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		check := s.deploys.get(site.ID)
+		if check == nil {
+			errorResponse(w, 404, "no deployment check has run for this site")
+			return
+		}
+		jsonResponse(w, 200, check)
+		return
+	}
+
+	switch {
+	case !site.SSL:
+		errorResponse(w, 400, "site has no certificate")
+		return
+	case len(s.Nginx.DeployCheckHosts) == 0:
+		errorResponse(w, 409, "deployment checks are disabled (--cert-check-hosts)")
+		return
+	}
+	check := s.checkCertDeployment(site, actor(r))
+	if check == nil {
+		errorResponse(w, 400, "cannot check a site whose domain is a pattern or whose certificate is unreadable")
+		return
+	}
+	jsonResponse(w, 200, check)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+const (
+	drainSweep = 5 * time.Second // How often draining upstreams are checked
+	// drainGrace is the least time an upstream drains, so the reload that
+	// removed it has started its shutting-down workers.
+	drainGrace = 10 * time.Second
+)
+
+// DrainStatus is what GET /v1/sites/{id}/drain reports. Deploys wait for
+// Drained before stopping the old backends.
+type DrainStatus struct {
+	SiteID     string                    `json:"site_id"`
+	Draining   []models.DrainingUpstream `json:"draining"`
+	Drained    bool                      `json:"drained"`
+	OldWorkers *int                      `json:"shutting_down_workers,omitempty"` // Server-wide
+	Error      string                    `json:"error,omitempty"`
+}
+
+// drainUpstreams starts draining the upstreams an update removed from
+// site, and stops draining those it added back. With Drain off, removed
+// upstreams go at once.
+func drainUpstreams(site *models.Site, previous []string, now time.Time) {
+	if site.Drain == nil || !site.Drain.Enabled {
+		site.DrainingUpstreams = nil
+		return
+	}
+	var draining []models.DrainingUpstream
+	for _, d := range site.DrainingUpstreams {
+		if !slices.Contains(site.Upstreams, d.Address) {
+			draining = append(draining, d)
+		}
+	}
+	for _, u := range previous {
+		if slices.Contains(site.Upstreams, u) || slices.ContainsFunc(draining, func(d models.DrainingUpstream) bool { return d.Address == u }) {
+			continue
+		}
+		draining = append(draining, models.DrainingUpstream{Address: u, Since: now, Until: now.Add(nginx.DrainTimeout(site))})
+	}
+	site.DrainingUpstreams = draining
+}
+
+// drained drops the upstreams that are done draining: their timeout has
+// passed, or no worker from before the change is left (workers < 0 when
+// unknown). It reports whether any were dropped.
+func drained(site *models.Site, workers int, now time.Time) bool {
+	var kept []models.DrainingUpstream
+	for _, d := range site.DrainingUpstreams {
+		if now.Before(d.Until) && (workers != 0 || now.Sub(d.Since) < drainGrace) {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == len(site.DrainingUpstreams) {
+		return false
+	}
+	site.DrainingUpstreams = kept
+	return true
+}
+
+// handleSiteDrain serves GET /v1/sites/{id}/drain, and DELETE to drop the
+// draining upstreams right away.
+func (s *Server) handleSiteDrain(w http.ResponseWriter, r *http.Request, id string) {
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		st := DrainStatus{SiteID: site.ID, Draining: site.DrainingUpstreams, Drained: len(site.DrainingUpstreams) == 0}
+		if st.Draining == nil {
+			st.Draining = []models.DrainingUpstream{}
+		}
+		if n, err := s.Nginx.ShuttingDownWorkers(); err != nil {
+			st.Error = err.Error()
+		} else {
+			st.OldWorkers = &n
+		}
+		jsonResponse(w, 200, st)
+	case http.MethodDelete:
+		if len(site.DrainingUpstreams) == 0 {
+			jsonResponse(w, 200, DrainStatus{SiteID: site.ID, Draining: []models.DrainingUpstream{}, Drained: true})
+			return
+		}
+		dropped := site.DrainingUpstreams
+		site.DrainingUpstreams = nil
+		if err := s.Store.SaveSite(site); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "site.drain_stopped",
+			Resource:   "site",
+			ResourceID: site.ID,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"upstreams": drainAddresses(dropped)},
+		})
+		siteCopy := *site
+		s.noteConfigChange(site.ID, actor(r), "site.drain_stopped")
+		go s.refreshSiteConfig(&siteCopy)
+		jsonResponse(w, 200, DrainStatus{SiteID: site.ID, Draining: []models.DrainingUpstream{}, Drained: true})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// StartDrains drops draining upstreams once they are drained. The primary
+// does this; a standby mirrors the result.
+func (s *Server) StartDrains() {
+	go func() {
+		ticker := time.NewTicker(drainSweep)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.expireDrains(time.Now())
+		}
+	}()
+}
+
+func (s *Server) expireDrains(now time.Time) {
+	if s.readOnly.Load() {
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Drains: failed to list sites", "error", err)
+		return
+	}
+	workers, counted := 0, false
+	for i := range sites {
+		site := &sites[i]
+		if len(site.DrainingUpstreams) == 0 {
+			continue
+		}
+		if !counted {
+			counted = true
+			if workers, err = s.Nginx.ShuttingDownWorkers(); err != nil {
+				slog.Warn("Drains: can't count old nginx workers, waiting for timeouts", "error", err)
+				workers = -1
+			}
+		}
+		before := drainAddresses(site.DrainingUpstreams)
+		if !drained(site, workers, now) {
+			continue
+		}
+		slog.Info("Upstreams drained, re-rendering site", "site_id", site.ID, "draining", drainAddresses(site.DrainingUpstreams), "previous", before)
+		if err := s.Store.SaveSite(site); err != nil {
+			slog.Error("Drains: failed to save site", "site_id", site.ID, "error", err)
+			continue
+		}
+		siteCopy := *site
+		s.noteConfigChange(site.ID, "", "site.upstreams_drained")
+		s.refreshSiteConfig(&siteCopy)
+	}
+}
+
+func drainAddresses(draining []models.DrainingUpstream) []string {
+	out := make([]string, len(draining))
+	for i, d := range draining {
+		out[i] = d.Address
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/notify"
+)
+
+const (
+	expirySweep         = 30 * time.Second // How often expiries are checked
+	DefaultExpiryNotice = time.Hour        // Warning ahead of an expiry without notify_before_seconds
+)
+
+// checkExpiry validates an expiry set in a request. It must lie ahead, so
+// a typo doesn't take a site down at once.
+func checkExpiry(e *models.Expiry, now time.Time) error {
+	if e == nil {
+		return nil
+	}
+	switch e.Action {
+	case "", models.ExpiryDisable, models.ExpiryDelete:
+	default:
+		return errors.New("expiry: action must be disable or delete")
+	}
+	if e.ExpiresAt.IsZero() {
+		return errors.New("expiry: expires_at is required")
+	}
+	if !e.ExpiresAt.After(now) {
+		return errors.New("expiry: expires_at must be in the future")
+	}
+	if e.NotifyBefore < 0 {
+		return errors.New("expiry: notify_before_seconds must not be negative")
+	}
+	e.Warned, e.Done = false, false
+	return nil
+}
+
+// checkImportedExpiry is checkExpiry for an import, except that the expiry
+// already stored is kept as it is: importing an export again doesn't fail
+// on a site that already expired, or warn about it twice.
+func checkImportedExpiry(e, stored *models.Expiry, now time.Time) error {
+	if e != nil && stored != nil && e.ExpiresAt.Equal(stored.ExpiresAt) && e.Action == stored.Action && e.NotifyBefore == stored.NotifyBefore {
+		*e = *stored
+		return nil
+	}
+	return checkExpiry(e, now)
+}
+
+// StartExpiry disables or deletes sites and streams once their expiry
+// passes, and warns webhooks notice ahead (unless the expiry sets its own
+// notify_before_seconds). Standbys skip it: they mirror the primary.
+func (s *Server) StartExpiry(notice time.Duration) {
+	go func() {
+		ticker := time.NewTicker(expirySweep)
+		defer ticker.Stop()
+		for {
+			s.runExpiry(time.Now(), notice)
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) runExpiry(now time.Time, notice time.Duration) {
+	if s.readOnly.Load() {
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Expiry: failed to list sites", "error", err)
+		return
+	}
+	for i := range sites {
+		site := &sites[i]
+		switch {
+		case site.Expiry == nil || site.Expiry.Done:
+		case !site.Expiry.Expired(now):
+			if s.warnExpiry("site", site.ID, site.Expiry, now, notice) {
+				s.saveSiteExpiry(site.ID, func(e *models.Expiry) { e.Warned = true })
+			}
+		case site.Expiry.Action == models.ExpiryDelete:
+			slog.Info("Site expired, deleting it", "site_id", site.ID, "expires_at", site.Expiry.ExpiresAt)
+			if err := s.deleteSite(site.ID); err != nil {
+				slog.Error("Expiry: failed to delete site", "site_id", site.ID, "error", err)
+				continue
+			}
+			s.expired("site", site.ID, site.Expiry)
+		default:
+			slog.Info("Site expired, disabling it", "site_id", site.ID, "expires_at", site.Expiry.ExpiresAt)
+			s.disableSite(site)
+			s.saveSiteExpiry(site.ID, func(e *models.Expiry) { e.Done = true })
+			s.expired("site", site.ID, site.Expiry)
+		}
+	}
+
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		slog.Error("Expiry: failed to list streams", "error", err)
+		return
+	}
+	for i := range streams {
+		stream := &streams[i]
+		switch {
+		case stream.Expiry == nil || stream.Expiry.Done:
+		case !stream.Expiry.Expired(now):
+			if s.warnExpiry("stream", stream.ID, stream.Expiry, now, notice) {
+				s.saveStreamExpiry(stream.ID, func(e *models.Expiry) { e.Warned = true })
+			}
+		case stream.Expiry.Action == models.ExpiryDelete:
+			slog.Info("Stream expired, deleting it", "stream_id", stream.ID, "expires_at", stream.Expiry.ExpiresAt)
+			if err := s.Store.DeleteStream(stream.ID); err != nil {
+				slog.Error("Expiry: failed to delete stream", "stream_id", stream.ID, "error", err)
+				continue
+			}
+			s.reconcileStreams(stream.ListenPort)
+			s.expired("stream", stream.ID, stream.Expiry)
+		default:
+			slog.Info("Stream expired, disabling it", "stream_id", stream.ID, "expires_at", stream.Expiry.ExpiresAt)
+			s.reconcileStreams(stream.ListenPort) // Leaves it out and marks it expired
+			s.saveStreamExpiry(stream.ID, func(e *models.Expiry) { e.Done = true })
+			s.expired("stream", stream.ID, stream.Expiry)
+		}
+	}
+}
+
+// saveSiteExpiry applies fn to the stored site's expiry. The site is
+// re-read, so an update made meanwhile is not overwritten.
+func (s *Server) saveSiteExpiry(id string, fn func(*models.Expiry)) {
+	site, err := s.Store.GetSite(id)
+	if err != nil || site.Expiry == nil {
+		return
+	}
+	fn(site.Expiry)
+	if err := s.Store.SaveSite(site); err != nil {
+		slog.Error("Expiry: failed to save site", "site_id", id, "error", err)
+	}
+}
+
+// saveStreamExpiry is saveSiteExpiry for streams.
+func (s *Server) saveStreamExpiry(id string, fn func(*models.Expiry)) {
+	stream, err := s.Store.GetStream(id)
+	if err != nil || stream.Expiry == nil {
+		return
+	}
+	fn(stream.Expiry)
+	if err := s.Store.SaveStream(stream); err != nil {
+		slog.Error("Expiry: failed to save stream", "stream_id", id, "error", err)
+	}
+}
+
+// disableSite takes an expired site out of nginx. It stays in the store
+// as "expired" until its expiry is moved or removed.
+func (s *Server) disableSite(site *models.Site) {
+	if err := s.Nginx.Delete(site.ID); err != nil {
+		slog.Error("Failed to remove config of expired site", "site_id", site.ID, "error", err)
+		s.updateStatus(site.ID, "error", "failed to disable expired site: "+err.Error())
+		return
+	}
+	s.updateStatus(site.ID, "expired", expiredMessage(site.Expiry))
+}
+
+func expiredMessage(e *models.Expiry) string {
+	return "expired at " + e.ExpiresAt.UTC().Format(time.RFC3339)
+}
+
+// warnExpiry sends the warning ahead of e, unless it went out already, and
+// reports whether it did.
+func (s *Server) warnExpiry(resource, id string, e *models.Expiry, now time.Time, notice time.Duration) bool {
+	if e.Warned {
+		return false
+	}
+	if e.NotifyBefore > 0 {
+		notice = time.Duration(e.NotifyBefore) * time.Second
+	}
+	if notice <= 0 || now.Before(e.ExpiresAt.Add(-notice)) {
+		return false
+	}
+	action := e.Action
+	if action == "" {
+		action = models.ExpiryDisable
+	}
+	s.Notify.Send(notify.Alert{
+		Event:      resource + ".expiring",
+		Resource:   resource,
+		ResourceID: id,
+		Message:    fmt.Sprintf("%s %s expires in %s and will be %sd", resource, id, e.ExpiresAt.Sub(now).Round(time.Second), action),
+		Details:    map[string]interface{}{"expires_at": e.ExpiresAt, "action": action},
+	})
+	return true
+}
+
+// expired records that expiry e of a resource was carried out.
+func (s *Server) expired(resource, id string, e *models.Expiry) {
+	action := e.Action
+	if action == "" {
+		action = models.ExpiryDisable
+	}
+	details := map[string]interface{}{"expires_at": e.ExpiresAt, "action": action}
+	s.Audit.Record(audit.Event{
+		Action:     resource + ".expired",
+		Resource:   resource,
+		ResourceID: id,
+		Details:    details,
+	})
+	s.Notify.Send(notify.Alert{
+		Event:      resource + ".expired",
+		Resource:   resource,
+		ResourceID: id,
+		Message:    fmt.Sprintf("%s %s expired and was %sd", resource, id, action),
+		Details:    details,
+	})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/notify"
+)
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		e    *models.Expiry
+		ok   bool
+	}{
+		{"none", nil, true},
+		{"future", &models.Expiry{ExpiresAt: now.Add(time.Minute)}, true},
+		{"delete", &models.Expiry{ExpiresAt: now.Add(time.Minute), Action: models.ExpiryDelete}, true},
+		{"zero", &models.Expiry{}, false},
+		{"past", &models.Expiry{ExpiresAt: now.Add(-time.Minute)}, false},
+		{"now", &models.Expiry{ExpiresAt: now}, false},
+		{"unknown action", &models.Expiry{ExpiresAt: now.Add(time.Minute), Action: "archive"}, false},
+		{"negative notice", &models.Expiry{ExpiresAt: now.Add(time.Minute), NotifyBefore: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := checkExpiry(tt.e, now); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+
+	// A client can't mark a new expiry as handled already
+	e := &models.Expiry{ExpiresAt: now.Add(time.Minute), Warned: true, Done: true}
+	if err := checkExpiry(e, now); err != nil || e.Warned || e.Done {
+		t.Errorf("Internal flags kept: %+v %v", e, err)
+	}
+}
+
+// webhook returns a notifier posting to a test server, and the events it
+// received so far.
+func webhook(t *testing.T) (*notify.Notifier, func() []string) {
+	var mu sync.Mutex
+	var events []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a notify.Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		mu.Lock()
+		events = append(events, a.Event+" "+a.ResourceID)
+		mu.Unlock()
+	}))
+	t.Cleanup(ts.Close)
+	return notify.NewNotifier([]string{ts.URL}), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		list := slices.Clone(events)
+		slices.Sort(list)
+		return list
+	}
+}
+
+// alertsAre waits for the webhook to have received exactly want.
+func alertsAre(t *testing.T, events func() []string, want ...string) {
+	t.Helper()
+	slices.Sort(want)
+	eventually(t, "alerts", func() bool { return len(events()) >= len(want) })
+	time.Sleep(20 * time.Millisecond) // Let unexpected extra alerts arrive
+	if got := events(); !slices.Equal(got, want) {
+		t.Errorf("Alerts %v, want %v", got, want)
+	}
+}
+
+func TestRunExpiry(t *testing.T) {
+	s := newTestServer(t)
+	var events func() []string
+	s.Notify, events = webhook(t)
+	// reconcileStreams checks expiries against the clock, so the streams
+	// really expire during the test
+	at := time.Now().Add(500 * time.Millisecond)
+	now := at.Add(-30 * time.Minute)
+	for _, site := range []models.Site{
+		{ID: "off", Domain: "off.example.com", Upstreams: []string{"app:80"}, Expiry: &models.Expiry{ExpiresAt: at}},
+		{ID: "gone", Domain: "gone.example.com", Upstreams: []string{"app:80"}, Expiry: &models.Expiry{ExpiresAt: at, Action: models.ExpiryDelete}},
+		{ID: "later", Domain: "later.example.com", Upstreams: []string{"app:80"}, Expiry: &models.Expiry{ExpiresAt: at, NotifyBefore: 60}},
+		{ID: "kept", Domain: "kept.example.com", Upstreams: []string{"app:80"}},
+	} {
+		s.Store.SaveSite(&site)
+		os.WriteFile(s.Nginx.SiteConfigFile(site.ID), []byte("server {}\n"), 0644)
+	}
+	for _, stream := range []models.Stream{
+		{ID: "soff", ListenPort: 30001, Upstream: "db:5432", Protocol: "tcp", Expiry: &models.Expiry{ExpiresAt: at}},
+		{ID: "sgone", ListenPort: 30002, Upstream: "db:5432", Protocol: "tcp", Expiry: &models.Expiry{ExpiresAt: at, Action: models.ExpiryDelete}},
+	} {
+		s.Store.SaveStream(&stream)
+		s.reconcileStreams(stream.ListenPort)
+	}
+
+	// A standby leaves expiries to the primary
+	s.readOnly.Store(true)
+	s.runExpiry(at.Add(time.Minute), time.Hour)
+	s.readOnly.Store(false)
+	if site, _ := s.Store.GetSite("gone"); site == nil || site.Expiry.Warned {
+		t.Fatalf("Standby acted on an expiry: %+v", site)
+	}
+
+	// Within the notice: warned once, except the site with a shorter notice
+	s.runExpiry(now, time.Hour)
+	s.runExpiry(now.Add(time.Minute), time.Hour)
+	alertsAre(t, events, "site.expiring off", "site.expiring gone", "stream.expiring soff", "stream.expiring sgone")
+	if site, _ := s.Store.GetSite("off"); !site.Expiry.Warned {
+		t.Error("Warning not recorded")
+	}
+
+	// Its own notice is a minute
+	s.runExpiry(at.Add(-30*time.Second), time.Hour)
+	alertsAre(t, events, "site.expiring off", "site.expiring gone", "stream.expiring soff", "stream.expiring sgone",
+		"site.expiring later")
+
+	// Past the expiry
+	time.Sleep(time.Until(at))
+	s.runExpiry(at, time.Hour)
+	s.runExpiry(at.Add(time.Minute), time.Hour)
+	alertsAre(t, events, "site.expiring off", "site.expiring gone", "stream.expiring soff", "stream.expiring sgone",
+		"site.expiring later", "site.expired off", "site.expired gone", "site.expired later",
+		"stream.expired soff", "stream.expired sgone")
+
+	for _, id := range []string{"off", "later"} {
+		site, err := s.Store.GetSite(id)
+		if err != nil || site.Status != "expired" || !site.Expiry.Done {
+			t.Errorf("Site %s not disabled: %+v %v", id, site, err)
+		}
+		if _, err := os.Stat(s.Nginx.SiteConfigFile(id)); !os.IsNotExist(err) {
+			t.Errorf("Disabled site %s still has its config", id)
+		}
+	}
+	if _, err := s.Store.GetSite("gone"); err == nil {
+		t.Error("Site with the delete action still exists")
+	}
+	if site, _ := s.Store.GetSite("kept"); site == nil || site.Status == "expired" {
+		t.Errorf("Site without expiry changed: %+v", site)
+	}
+	if _, err := os.Stat(s.Nginx.SiteConfigFile("kept")); err != nil {
+		t.Errorf("Site without expiry lost its config: %v", err)
+	}
+
+	stream, err := s.Store.GetStream("soff")
+	if err != nil || stream.Status != "expired" || !stream.Expiry.Done {
+		t.Errorf("Stream not disabled: %+v %v", stream, err)
+	}
+	if _, err := s.Store.GetStream("sgone"); err == nil {
+		t.Error("Stream with the delete action still exists")
+	}
+	for _, port := range []int{30001, 30002} {
+		if _, err := os.Stat(s.Nginx.StreamConfigFile(port)); !os.IsNotExist(err) {
+			t.Errorf("Expired stream still listens on %d", port)
+		}
+	}
+}
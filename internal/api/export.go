@@ -0,0 +1,530 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/yaml"
+)
+
+// exportVersion is the version of the ConfigExport document.
+const exportVersion = 1
+
+// maxImportSize caps POST /v1/import bodies.
+const maxImportSize = 64 << 20
+
+// ConfigExport is everything needed to rebuild a host's sites and streams
+// elsewhere. Firewall rules travel inside their sites. Site files,
+// certificates and API keys are not included.
+type ConfigExport struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	LogFormats []models.LogFormat `json:"log_formats"`
+	Templates  []nginx.Template   `json:"templates"`
+	Sites      []models.Site      `json:"sites"`
+	Streams    []models.Stream    `json:"streams"`
+}
+
+// ImportResult is what POST /v1/import did with one item.
+type ImportResult struct {
+	Kind   string `json:"kind"` // "log_format", "template", "site" or "stream"
+	ID     string `json:"id"`
+	Action string `json:"action"`           // "created", "updated", "unchanged" or "failed"
+	Status string `json:"status,omitempty"` // Sites and streams, once applied with ?wait=true
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport lists the result of every imported item, in import order.
+type ImportReport struct {
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Failed    int            `json:"failed"`
+	Results   []ImportResult `json:"results"`
+}
+
+func (rep *ImportReport) add(res ImportResult) {
+	switch res.Action {
+	case "created":
+		rep.Created++
+	case "updated":
+		rep.Updated++
+	case "unchanged":
+		rep.Unchanged++
+	case "failed":
+		rep.Failed++
+	}
+	rep.Results = append(rep.Results, res)
+}
+
+// wantYAML reports whether the client asked for YAML, with ?format=yaml
+// or a YAML media type in header.
+func wantYAML(r *http.Request, header string) bool {
+	return r.URL.Query().Get("format") == "yaml" || strings.Contains(r.Header.Get(header), "yaml")
+}
+
+// handleExport serves GET /v1/export: every log format, template, site and
+// stream as one JSON document, or YAML with ?format=yaml.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	export, err := s.exportConfig(time.Now().UTC())
+	if err != nil {
+		errorResponse(w, 500, "export failed: "+err.Error())
+		return
+	}
+	if !wantYAML(r, "Accept") {
+		jsonResponse(w, 200, export)
+		return
+	}
+	data, err := json.Marshal(export)
+	if err == nil {
+		data, err = yaml.FromJSON(data)
+	}
+	if err != nil {
+		errorResponse(w, 500, "export failed: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func (s *Server) exportConfig(now time.Time) (*ConfigExport, error) {
+	export := &ConfigExport{Version: exportVersion, ExportedAt: now}
+	var err error
+	if export.LogFormats, err = s.Nginx.ListLogFormats(); err != nil {
+		return nil, fmt.Errorf("list log formats: %w", err)
+	}
+	list, err := s.Nginx.ListTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	export.Templates = []nginx.Template{}
+	for _, t := range list {
+		full, err := s.Nginx.GetTemplate(t.Name)
+		if err != nil {
+			return nil, fmt.Errorf("read template %s: %w", t.Name, err)
+		}
+		export.Templates = append(export.Templates, *full)
+	}
+	if export.Sites, err = s.Store.ListSites(); err != nil {
+		return nil, fmt.Errorf("list sites: %w", err)
+	}
+	if export.Streams, err = s.Store.ListStreams(); err != nil {
+		return nil, fmt.Errorf("list streams: %w", err)
+	}
+	slices.SortFunc(export.Sites, func(a, b models.Site) int { return strings.Compare(a.ID, b.ID) })
+	for i := range export.Sites {
+		export.Sites[i] = export.Sites[i].Redacted()
+	}
+	slices.SortFunc(export.Streams, func(a, b models.Stream) int { return strings.Compare(a.ID, b.ID) })
+	return export, nil
+}
+
+// handleImport serves POST /v1/import: a ConfigExport document (YAML with
+// a YAML Content-Type or ?format=yaml) is applied item by item. Log
+// formats and templates go first, since sites name them; existing items
+// with the same name or ID are replaced. A failed item doesn't stop the
+// rest, unless ?atomic=true. The sites and streams that passed are saved
+// in one transaction, then applied in the background unless ?wait=true.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		errorResponse(w, 400, "failed to read body: "+err.Error())
+		return
+	}
+	if wantYAML(r, "Content-Type") {
+		if data, err = yaml.ToJSON(data); err != nil {
+			errorResponse(w, 400, "invalid yaml: "+err.Error())
+			return
+		}
+	}
+	var doc ConfigExport
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if doc.Version > exportVersion {
+		errorResponse(w, 400, fmt.Sprintf("export version %d is newer than this hubfly supports (%d)", doc.Version, exportVersion))
+		return
+	}
+
+	who, wait := actor(r), wantWait(r)
+	report := &ImportReport{Results: []ImportResult{}}
+	var refresh []string // Sites using a changed log format or template
+	for i := range doc.LogFormats {
+		res, users := s.importLogFormat(&doc.LogFormats[i])
+		report.add(res)
+		refresh = append(refresh, users...)
+	}
+	for i := range doc.Templates {
+		res, users := s.importTemplate(&doc.Templates[i])
+		report.add(res)
+		refresh = append(refresh, users...)
+	}
+	items, err := s.prepareImport(&doc)
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	s.commitImport(items, r.URL.Query().Get("atomic") == "true")
+	imported := map[string]bool{}
+	ports := map[int]bool{}
+	for _, item := range items {
+		report.add(item.res)
+		if item.res.Action == "failed" {
+			continue
+		}
+		if item.site != nil {
+			imported[item.site.ID] = true
+			s.noteConfigChange(item.site.ID, who, "site.imported")
+			if wait {
+				s.provisionSite(item.site)
+			} else {
+				go s.provisionSite(item.site)
+			}
+		}
+		for _, port := range item.ports {
+			ports[port] = true
+		}
+	}
+
+	// Imported sites render with the new formats and templates already.
+	slices.Sort(refresh)
+	for _, id := range slices.Compact(refresh) {
+		site, err := s.Store.GetSite(id)
+		if err != nil || imported[id] {
+			continue
+		}
+		s.noteConfigChange(id, who, "config.imported")
+		if wait {
+			s.refreshSiteConfig(site)
+		} else {
+			go s.refreshSiteConfig(site)
+		}
+	}
+	reconcile := func() {
+		for _, port := range slices.Sorted(maps.Keys(ports)) {
+			s.reconcileStreams(port)
+		}
+	}
+	if wait {
+		reconcile()
+		for i := range report.Results {
+			res := &report.Results[i]
+			if res.Action == "failed" {
+				continue
+			}
+			switch res.Kind {
+			case "site":
+				if site, err := s.Store.GetSite(res.ID); err == nil {
+					res.Status = site.Status
+					res.Error = site.ErrorMessage
+				}
+			case "stream":
+				if stream, err := s.Store.GetStream(res.ID); err == nil {
+					res.Status = stream.Status
+					res.Error = stream.ErrorMessage
+				}
+			}
+		}
+	} else {
+		go reconcile()
+	}
+
+	s.Audit.Record(audit.Event{
+		Action:   "config.imported",
+		Resource: "system",
+		Actor:    who,
+		Details: map[string]interface{}{
+			"created": report.Created, "updated": report.Updated,
+			"unchanged": report.Unchanged, "failed": report.Failed,
+		},
+	})
+	slog.Info("Configuration imported", "created", report.Created, "updated", report.Updated, "unchanged", report.Unchanged, "failed", report.Failed)
+	jsonResponse(w, 200, report)
+}
+
+// importLogFormat saves f and returns the sites to refresh when an
+// existing format changed.
+func (s *Server) importLogFormat(f *models.LogFormat) (ImportResult, []string) {
+	res := ImportResult{Kind: "log_format", ID: f.Name, Action: "created"}
+	if existing, err := s.Nginx.GetLogFormat(f.Name); err == nil {
+		if reflect.DeepEqual(existing.Fields, f.Fields) {
+			res.Action = "unchanged"
+			return res, nil
+		}
+		res.Action = "updated"
+	}
+	if err := s.Nginx.SaveLogFormat(f); err != nil {
+		res.Action, res.Error = "failed", err.Error()
+		return res, nil
+	}
+	if res.Action == "created" {
+		return res, nil
+	}
+	return res, siteIDs(s.logFormatUsers(f.Name))
+}
+
+// importTemplate saves t and returns the sites to refresh when an
+// existing template changed.
+func (s *Server) importTemplate(t *nginx.Template) (ImportResult, []string) {
+	res := ImportResult{Kind: "template", ID: t.Name, Action: "created"}
+	if nginx.IsPreset(t.Name) {
+		res.Action, res.Error = "failed", "template name "+t.Name+" is taken by a built-in preset"
+		return res, nil
+	}
+	if existing, err := s.Nginx.GetTemplate(t.Name); err == nil {
+		if existing.Content == t.Content {
+			res.Action = "unchanged"
+			return res, nil
+		}
+		res.Action = "updated"
+	}
+	if err := s.Nginx.SaveTemplate(t.Name, t.Content); err != nil {
+		res.Action, res.Error = "failed", err.Error()
+		return res, nil
+	}
+	if res.Action == "created" {
+		return res, nil
+	}
+	return res, siteIDs(s.templateUsers(t.Name))
+}
+
+// importItem is a site or stream of an import, ready to be saved unless
+// res failed.
+type importItem struct {
+	res    ImportResult
+	site   *models.Site
+	stream *models.Stream
+	ports  []int // Stream ports to reconcile once saved
+}
+
+// prepareImport validates the document's sites and streams. Each item is
+// checked against the store as the items before it leave it, as if they
+// were saved one by one.
+func (s *Server) prepareImport(doc *ConfigExport) ([]importItem, error) {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sites: %w", err)
+	}
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+	var items []importItem
+	for i := range doc.Sites {
+		item := s.importSite(doc.Sites[i], sites)
+		if item.site != nil {
+			sites = replaceByID(sites, *item.site, func(s models.Site) string { return s.ID })
+		}
+		items = append(items, item)
+	}
+	for i := range doc.Streams {
+		item := s.importStream(doc.Streams[i], streams)
+		if item.stream != nil {
+			streams = replaceByID(streams, *item.stream, func(s models.Stream) string { return s.ID })
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// replaceByID replaces the element of list with v's ID, or appends v.
+func replaceByID[T any](list []T, v T, id func(T) string) []T {
+	for i := range list {
+		if id(list[i]) == id(v) {
+			list[i] = v
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// commitImport saves the items that passed in one transaction. When it
+// fails, or with atomic when any item failed, none is saved and all of
+// them are reported failed.
+func (s *Server) commitImport(items []importItem, atomic bool) {
+	var err error
+	failed := slices.ContainsFunc(items, func(item importItem) bool { return item.res.Action == "failed" })
+	if atomic && failed {
+		err = fmt.Errorf("another site or stream failed")
+	} else {
+		err = s.Store.WithTx(func(tx store.Store) error {
+			for _, item := range items {
+				switch {
+				case item.res.Action == "failed":
+				case item.site != nil:
+					if err := tx.SaveSite(item.site); err != nil {
+						return err
+					}
+				case item.stream != nil:
+					if err := tx.SaveStream(item.stream); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		return
+	}
+	for i := range items {
+		if items[i].res.Action != "failed" {
+			items[i].res.Action, items[i].res.Error = "failed", "not imported: "+err.Error()
+		}
+	}
+}
+
+// importSite validates site like POST /v1/sites and prepares it to replace
+// any site with its ID. sites is the store as the import leaves it so far.
+// Its certificate is reused when this host already has one covering it,
+// and issued otherwise.
+func (s *Server) importSite(site models.Site, sites []models.Site) importItem {
+	item := importItem{res: ImportResult{Kind: "site", ID: site.ID, Action: "created"}}
+	fail := func(err error) importItem {
+		item.res.Action, item.res.Error = "failed", err.Error()
+		return item
+	}
+	if err := normalizeSiteNames(&site); err != nil {
+		return fail(err)
+	}
+	if site.ID == "" {
+		id, err := defaultSiteID(&site)
+		if err != nil {
+			return fail(err)
+		}
+		site.ID = id
+		item.res.ID = id
+	}
+	now := time.Now()
+	site.CreatedAt, site.DrainingUpstreams = now, nil
+	var storedExpiry *models.Expiry
+	if i := slices.IndexFunc(sites, func(other models.Site) bool { return other.ID == site.ID }); i >= 0 {
+		previous := sites[i]
+		item.res.Action = "updated"
+		site.ACME.KeepEABKey(previous.ACME)
+		site.CreatedAt = previous.CreatedAt
+		site.DrainingUpstreams = previous.DrainingUpstreams
+		drainUpstreams(&site, previous.Upstreams, now)
+		storedExpiry = previous.Expiry
+	}
+	if err := checkImportedExpiry(site.Expiry, storedExpiry, now); err != nil {
+		return fail(err)
+	}
+	checkNames := func(site *models.Site) error {
+		if other, name := nginx.FindServerNameConflict(site, sites); other != nil {
+			return fmt.Errorf("server name %s is already used by site %s", name, other.ID)
+		}
+		return nil
+	}
+	for _, check := range []func(*models.Site) error{s.validateWildcard, s.validateSiteRules, s.checkSiteLogFormat, checkNames} {
+		if err := check(&site); err != nil {
+			return fail(err)
+		}
+	}
+	site.UpdatedAt = now
+	site.Status = "provisioning"
+	site.ErrorMessage = ""
+	item.site = &site
+	return item
+}
+
+// importStream validates stream like POST /v1/streams and prepares it to
+// replace any stream with its ID. streams is the store as the import
+// leaves it so far. The ports to reconcile are the stream's, and the one
+// it moved from.
+func (s *Server) importStream(stream models.Stream, streams []models.Stream) importItem {
+	item := importItem{res: ImportResult{Kind: "stream", ID: stream.ID, Action: "created"}}
+	fail := func(err error) importItem {
+		item.res.Action, item.res.Error = "failed", err.Error()
+		return item
+	}
+	var err error
+	if stream.ListenPort == 0 {
+		if stream.ListenPort, err = s.Ports.Allocate(&stream, streams); err != nil {
+			return fail(err)
+		}
+	}
+	if stream.ID == "" {
+		stream.ID = fmt.Sprintf("stream-%d", stream.ListenPort)
+		item.res.ID = stream.ID
+	}
+	if stream.Protocol == "" {
+		stream.Protocol = "tcp"
+	}
+	if err := normalizeStreamNames(&stream); err != nil {
+		return fail(err)
+	}
+	if stream.Protocol != "tcp" && stream.Protocol != "udp" {
+		return fail(fmt.Errorf("protocol must be tcp or udp"))
+	}
+	if err := s.validateStream(&stream, streams); err != nil {
+		return fail(err)
+	}
+
+	now := time.Now()
+	item.ports = []int{stream.ListenPort}
+	stream.CreatedAt = now
+	var storedExpiry *models.Expiry
+	if i := slices.IndexFunc(streams, func(other models.Stream) bool { return other.ID == stream.ID }); i >= 0 {
+		previous := streams[i]
+		item.res.Action = "updated"
+		stream.CreatedAt = previous.CreatedAt
+		if previous.ListenPort != stream.ListenPort {
+			item.ports = append(item.ports, previous.ListenPort)
+		}
+		storedExpiry = previous.Expiry
+	}
+	if err := checkImportedExpiry(stream.Expiry, storedExpiry, now); err != nil {
+		return fail(err)
+	}
+	stream.UpdatedAt = now
+	stream.Status = "provisioning"
+	stream.ErrorMessage = ""
+	item.stream = &stream
+	return item
+}
+
+// handleExportNginx serves GET /v1/export/nginx: a tar.gz of the rendered
+// site and stream configs and the global includes, for offline review.
+func (s *Server) handleExportNginx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	// Build the archive first, so a failure is still a JSON error
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	if err := s.Nginx.Export(&buf, now); err != nil {
+		errorResponse(w, 500, "export failed: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="hubfly-nginx-`+now.Format("20060102T150405Z")+`.tar.gz"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(200)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+const importDoc = `{"version": 1,
+	"sites": [
+		{"id": "a", "domain": "a.example.com", "upstreams": ["app:80"]},
+		{"id": "b", "domain": "a.example.com", "upstreams": ["app:80"]},
+		{"id": "c", "domain": "c.example.com", "upstreams": ["app:80"]}
+	],
+	"streams": [{"id": "db", "listen_port": 30001, "upstream": "db:5432"}]}`
+
+func importReport(t *testing.T, s *Server, query, doc string) ImportReport {
+	t.Helper()
+	rec := serve(s, "POST", "/v1/import?wait=true"+query, doc)
+	if rec.Code != 200 {
+		t.Fatalf("Import failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var report ImportReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestImport(t *testing.T) {
+	s := newTestServer(t)
+	report := importReport(t, s, "", importDoc)
+	// b collides with a, which comes before it in the same import
+	if report.Created != 3 || report.Failed != 1 || report.Results[1].ID != "b" || report.Results[1].Action != "failed" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	sites, _ := s.Store.ListSites()
+	streams, _ := s.Store.ListStreams()
+	if len(sites) != 2 || len(streams) != 1 {
+		t.Errorf("Expected 2 sites and 1 stream, got %d and %d", len(sites), len(streams))
+	}
+
+	// Importing again updates in place
+	if report := importReport(t, s, "", importDoc); report.Updated != 3 || report.Failed != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
+
+func TestImportAtomic(t *testing.T) {
+	s := newTestServer(t)
+	report := importReport(t, s, "&atomic=true", importDoc)
+	if report.Failed != 4 || report.Created != 0 {
+		t.Fatalf("Expected every item to fail, got %+v", report)
+	}
+	if sites, _ := s.Store.ListSites(); len(sites) != 0 {
+		t.Errorf("Atomic import saved %d sites", len(sites))
+	}
+}
+
+func TestImportCommitFailure(t *testing.T) {
+	s := newTestServer(t)
+	s.Store = failingTx{s.Store}
+	report := importReport(t, s, "", importDoc)
+	if report.Failed != 4 {
+		t.Fatalf("Expected every item to fail, got %+v", report)
+	}
+	if res := report.Results[0]; res.Error != "not imported: disk full" {
+		t.Errorf("Unexpected error: %+v", res)
+	}
+	sites, _ := s.Store.ListSites()
+	streams, _ := s.Store.ListStreams()
+	if len(sites) != 0 || len(streams) != 0 {
+		t.Errorf("Failed commit saved %d sites and %d streams", len(sites), len(streams))
+	}
+}
+
+func TestImportExpiry(t *testing.T) {
+	s := newTestServer(t)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	doc := fmt.Sprintf(`{"version": 1, "sites": [
+		{"id": "bad-action", "domain": "a.example.com", "upstreams": ["app:80"], "expiry": {"expires_at": %q, "action": "archive"}},
+		{"id": "past", "domain": "b.example.com", "upstreams": ["app:80"], "expiry": {"expires_at": %q, "action": "delete"}},
+		{"id": "zero", "domain": "c.example.com", "upstreams": ["app:80"], "expiry": {"action": "delete"}},
+		{"id": "flags", "domain": "d.example.com", "upstreams": ["app:80"], "expiry": {"expires_at": %q, "warned": true, "done": true}}],
+		"streams": [{"id": "db", "listen_port": 30001, "upstream": "db:5432", "expiry": {"expires_at": %q}}]}`,
+		future, past, future, past)
+	report := importReport(t, s, "", doc)
+	for i, want := range []string{"failed", "failed", "failed", "created", "failed"} {
+		if res := report.Results[i]; res.Action != want {
+			t.Errorf("%s: expected %s, got %+v", res.ID, want, res)
+		}
+	}
+	if site, _ := s.Store.GetSite("flags"); site == nil || site.Expiry.Warned || site.Expiry.Done {
+		t.Errorf("Imported expiry kept its flags: %+v", site)
+	}
+
+	// An expiry that is already stored is kept, even once it has passed
+	site, _ := s.Store.GetSite("flags")
+	site.Expiry = &models.Expiry{ExpiresAt: time.Now().Add(-time.Minute).Truncate(time.Second), Warned: true, Done: true}
+	s.Store.SaveSite(site)
+	doc = fmt.Sprintf(`{"version": 1, "sites": [{"id": "flags", "domain": "d.example.com", "upstreams": ["app:80"],
+		"expiry": {"expires_at": %q}}]}`, site.Expiry.ExpiresAt.Format(time.RFC3339))
+	if report := importReport(t, s, "", doc); report.Updated != 1 {
+		t.Fatalf("Re-import of a stored expiry failed: %+v", report)
+	}
+	if site, _ := s.Store.GetSite("flags"); !site.Expiry.Warned || !site.Expiry.Done {
+		t.Errorf("Re-import reset the stored expiry: %+v", site.Expiry)
+	}
+}
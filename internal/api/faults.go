@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+)
+
+// handleFaults arms and clears injected failures (chaos mode only).
+//
+//	GET    /v1/debug/faults          armed faults and the available points
+//	POST   /v1/debug/faults          arm one fault
+//	DELETE /v1/debug/faults[/point]  clear one or all faults
+func (s *Server) handleFaults(w http.ResponseWriter, r *http.Request) {
+	point := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1/debug/faults"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, 200, map[string]interface{}{
+			"faults": s.Faults.List(),
+			"points": faults.Points,
+		})
+	case http.MethodPost:
+		if point != "" {
+			http.Error(w, "method not allowed", 405)
+			return
+		}
+		var f faults.Fault
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if err := s.Faults.Set(f); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		slog.Warn("Fault armed", "point", f.Point, "mode", f.Mode, "count", f.Count)
+		s.Audit.Record(audit.Event{
+			Action:     "fault.armed",
+			Resource:   "fault",
+			ResourceID: f.Point,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"mode": f.Mode, "count": f.Count, "probability": f.Probability},
+		})
+		jsonResponse(w, 201, s.Faults.List())
+	case http.MethodDelete:
+		s.Faults.Clear(point)
+		slog.Info("Faults cleared", "point", point)
+		s.Audit.Record(audit.Event{
+			Action:     "fault.cleared",
+			Resource:   "fault",
+			ResourceID: point,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 200, map[string]string{"status": "cleared"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+var groupPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// checkGroup validates the group of a site or stream.
+func checkGroup(group string) error {
+	if group != "" && !groupPattern.MatchString(group) {
+		return fmt.Errorf("invalid group %q: use up to 64 letters, digits, '.', '_' or '-'", group)
+	}
+	return nil
+}
+
+// GroupUsage is returned by GET /v1/groups/{id}/usage.
+type GroupUsage struct {
+	Group        string      `json:"group"`
+	Since        time.Time   `json:"since"`
+	Until        time.Time   `json:"until"`
+	Requests     int64       `json:"requests"`
+	BytesSent    int64       `json:"bytes_sent"`   // Response bodies
+	Sites        int         `json:"sites"`        // Current, not over the period
+	Streams      int         `json:"streams"`      // Current, not over the period
+	Certificates int         `json:"certificates"` // Distinct lineages of the SSL sites
+	PerSite      []SiteUsage `json:"per_site"`
+	StreamIDs    []string    `json:"stream_ids"`
+}
+
+// SiteUsage is one site's share of a GroupUsage.
+type SiteUsage struct {
+	SiteID      string `json:"site_id"`
+	Domain      string `json:"domain"`
+	Requests    int64  `json:"requests"`
+	BytesSent   int64  `json:"bytes_sent"`
+	Certificate string `json:"certificate,omitempty"`
+	Error       string `json:"error,omitempty"` // The access log could not be read
+}
+
+// GroupDeleted is returned by DELETE /v1/groups/{id}.
+type GroupDeleted struct {
+	Status  string   `json:"status"`
+	Sites   []string `json:"sites"`
+	Streams []string `json:"streams"`
+}
+
+func (s *Server) handleGroupDetail(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/groups/")
+	if id, ok := strings.CutSuffix(path, "/usage"); ok && id != "" {
+		s.handleGroupUsage(w, r, id)
+		return
+	}
+	if path == "" || strings.Contains(path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	s.handleGroupDelete(w, r, path)
+}
+
+// handleGroupDelete serves DELETE /v1/groups/{id}: every site and stream of
+// the group is removed from the store in one transaction, then from nginx.
+// Deleting streams too needs a role that may modify them.
+func (s *Server) handleGroupDelete(w http.ResponseWriter, r *http.Request, group string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, "failed to list sites: "+err.Error())
+		return
+	}
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		errorResponse(w, 500, "failed to list streams: "+err.Error())
+		return
+	}
+	siteIDs, streamIDs := []string{}, []string{}
+	ports := map[int]bool{}
+	for _, site := range sites {
+		if site.Group == group {
+			siteIDs = append(siteIDs, site.ID)
+		}
+	}
+	for _, st := range streams {
+		if st.Group == group {
+			streamIDs = append(streamIDs, st.ID)
+			ports[st.ListenPort] = true
+		}
+	}
+	if len(siteIDs) == 0 && len(streamIDs) == 0 {
+		errorResponse(w, 404, "no sites or streams in group "+group)
+		return
+	}
+	if p := principalFrom(r); p != nil && len(streamIDs) > 0 && !roleAllows(p.Role, resourceStreams, true) {
+		errorResponse(w, 403, "role "+p.Role+" may not modify "+resourceStreams)
+		return
+	}
+
+	err = s.Store.WithTx(func(tx store.Store) error {
+		for _, id := range siteIDs {
+			if err := tx.DeleteSite(id); err != nil {
+				return err
+			}
+		}
+		for _, id := range streamIDs {
+			if err := tx.DeleteStream(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errorResponse(w, 500, "failed to delete group: "+err.Error())
+		return
+	}
+
+	for _, id := range siteIDs {
+		if err := s.Nginx.Delete(id); err != nil {
+			slog.Error("Failed to remove nginx config of deleted site", "site_id", id, "error", err)
+		}
+		s.forgetSite(id)
+	}
+	for _, port := range slices.Sorted(maps.Keys(ports)) {
+		go s.reconcileStreams(port)
+	}
+	slog.Info("Group deleted", "group", group, "sites", len(siteIDs), "streams", len(streamIDs))
+	sort.Strings(siteIDs)
+	sort.Strings(streamIDs)
+	jsonResponse(w, 200, GroupDeleted{Status: "deleted", Sites: siteIDs, Streams: streamIDs})
+}
+
+// handleGroupUsage serves GET /v1/groups/{id}/usage: the traffic of a
+// group's sites over a billing period, from their access logs, and what it
+// has in the store. The period is ?month=YYYY-MM, or since/until (RFC
+// 3339), and defaults to the current calendar month (UTC).
+func (s *Server) handleGroupUsage(w http.ResponseWriter, r *http.Request, group string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	since, until, err := billingPeriod(r, time.Now())
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, "failed to list sites: "+err.Error())
+		return
+	}
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		errorResponse(w, 500, "failed to list streams: "+err.Error())
+		return
+	}
+
+	u := GroupUsage{Group: group, Since: since, Until: until, PerSite: []SiteUsage{}, StreamIDs: []string{}}
+	certs := map[string]bool{}
+	for i := range sites {
+		site := &sites[i]
+		if site.Group != group {
+			continue
+		}
+		su := SiteUsage{SiteID: site.ID, Domain: site.Domain}
+		if site.SSL {
+			su.Certificate = site.CertName()
+			certs[su.Certificate] = true
+		}
+		totals, err := s.LogManager.GetTotals(site.ID, logmanager.LogOptions{Since: since, Until: until, Format: s.siteLogFormat(site)})
+		if err != nil {
+			su.Error = err.Error()
+		}
+		su.Requests, su.BytesSent = totals.Requests, totals.BytesSent
+		u.Requests += totals.Requests
+		u.BytesSent += totals.BytesSent
+		u.PerSite = append(u.PerSite, su)
+	}
+	for _, st := range streams {
+		if st.Group == group {
+			u.StreamIDs = append(u.StreamIDs, st.ID)
+		}
+	}
+	if len(u.PerSite) == 0 && len(u.StreamIDs) == 0 {
+		errorResponse(w, 404, "no sites or streams in group "+group)
+		return
+	}
+	sort.Slice(u.PerSite, func(i, j int) bool { return u.PerSite[i].SiteID < u.PerSite[j].SiteID })
+	sort.Strings(u.StreamIDs)
+	u.Sites, u.Streams, u.Certificates = len(u.PerSite), len(u.StreamIDs), len(certs)
+	jsonResponse(w, 200, u)
+}
+
+// billingPeriod reads the period of a usage request. Log timestamps have
+// second resolution, so a month ends on its last second and requests at
+// midnight are billed once.
+func billingPeriod(r *http.Request, now time.Time) (since, until time.Time, err error) {
+	q := r.URL.Query()
+	if m := q.Get("month"); m != "" {
+		start, err := time.Parse("2006-01", m)
+		if err != nil {
+			return since, until, fmt.Errorf("invalid month %q, use YYYY-MM", m)
+		}
+		return start, start.AddDate(0, 1, 0).Add(-time.Second), nil
+	}
+	now = now.UTC()
+	since = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	until = now
+	if v := q.Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, fmt.Errorf("invalid since %q, use RFC 3339", v)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, fmt.Errorf("invalid until %q, use RFC 3339", v)
+		}
+	}
+	if until.Before(since) {
+		return since, until, fmt.Errorf("until is before since")
+	}
+	return since, until, nil
+}
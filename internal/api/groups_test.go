@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestGroupDelete(t *testing.T) {
+	s := newTestServer(t)
+	for _, site := range []models.Site{{ID: "a", Domain: "a.example.com", Group: "acme"}, {ID: "b", Domain: "b.example.com"}} {
+		s.Store.SaveSite(&site)
+	}
+	s.Store.SaveStream(&models.Stream{ID: "db", ListenPort: 30001, Upstream: "db:5432", Group: "acme"})
+	s.Store.SaveAPIKey(&models.APIKey{ID: "sites", Role: models.RoleSitesAdmin, SecretHash: hashSecret("s")})
+	s.Store.SaveAPIKey(&models.APIKey{ID: "admin", Role: models.RoleFullAdmin, SecretHash: hashSecret("f")})
+
+	// The group has a stream, which a sites-admin may not delete
+	if rec := serveAs(s, "hfk_sites.s", "DELETE", "/v1/groups/acme", ""); rec.Code != 403 {
+		t.Errorf("Expected 403, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(s, "hfk_admin.f", "DELETE", "/v1/groups/other", ""); rec.Code != 404 {
+		t.Errorf("Expected 404 for an empty group, got %d", rec.Code)
+	}
+
+	// A failed transaction deletes nothing
+	live := s.Store
+	s.Store = failingTx{live}
+	if rec := serveAs(s, "hfk_admin.f", "DELETE", "/v1/groups/acme", ""); rec.Code != 500 {
+		t.Errorf("Expected 500, got %d", rec.Code)
+	}
+	s.Store = live
+	if _, err := s.Store.GetSite("a"); err != nil {
+		t.Errorf("Failed group delete removed a site: %v", err)
+	}
+
+	rec := serveAs(s, "hfk_admin.f", "DELETE", "/v1/groups/acme", "")
+	var res GroupDeleted
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != 200 || len(res.Sites) != 1 || len(res.Streams) != 1 {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := s.Store.GetSite("a"); err == nil {
+		t.Error("Site a still exists")
+	}
+	if _, err := s.Store.GetStream("db"); err == nil {
+		t.Error("Stream db still exists")
+	}
+	if _, err := s.Store.GetSite("b"); err != nil {
+		t.Errorf("Site outside the group was deleted: %v", err)
+	}
+}
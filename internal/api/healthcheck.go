@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// healthKey scopes probe results to a site, since two sites may check the
+// same upstream differently.
+func healthKey(siteID, upstream string) string {
+	return siteID + "|" + upstream
+}
+
+// probeSite runs the site's health check (TCP connect by default) against
+// every upstream.
+func (s *Server) probeSite(site *models.Site) map[string]health.Stats {
+	hc := site.HealthCheck
+	if hc == nil {
+		hc = &models.HealthCheck{}
+	}
+	timeout := s.Health.Timeout
+	if hc.Timeout > 0 {
+		timeout = time.Duration(hc.Timeout) * time.Second
+	}
+
+	stats := make(map[string]health.Stats, len(site.Upstreams))
+	for _, u := range site.Upstreams {
+		var probe func() error
+		switch {
+		case hc.Type == "http" && site.UpstreamTLS != nil:
+			cfg, err := upstreamTLSConfig(site.UpstreamTLS)
+			if cfg != nil {
+				cfg.ServerName = nginx.UpstreamSSLName(site)
+			}
+			probe = health.HTTPSProbe(u, hc.Path, hc.ExpectStatus, timeout, cfg)
+			if err != nil {
+				probe = func() error { return err }
+			}
+		case hc.Type == "http":
+			probe = health.HTTPProbe(u, hc.Path, hc.ExpectStatus, timeout)
+		default:
+			probe = health.TCPProbe(u, timeout)
+		}
+		stats[u] = s.Health.Check(healthKey(site.ID, u), u, probe)
+	}
+	return stats
+}
+
+// upstreamTLSConfig is the TLS nginx speaks to the upstreams, so HTTP health
+// checks present the same client certificate and trust the same CA.
+func upstreamTLSConfig(t *models.UpstreamTLS) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: !t.Verify}
+	if t.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("upstream_tls: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("upstream_tls: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("upstream_tls: no certificates in %s", t.CA)
+		}
+	}
+	return cfg, nil
+}
+
+// siteHealth returns the latest probe results for the site's upstreams.
+func (s *Server) siteHealth(site *models.Site) []health.Stats {
+	var list []health.Stats
+	for _, u := range site.Upstreams {
+		if st, ok := s.Health.Get(healthKey(site.ID, u)); ok {
+			list = append(list, st)
+		}
+	}
+	return list
+}
+
+// StartHealthChecks probes the upstreams of every site with an enabled
+// health check each interval.
+func (s *Server) StartHealthChecks(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runHealthChecks()
+		}
+	}()
+}
+
+func (s *Server) runHealthChecks() {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Health checks failed to list sites", "error", err)
+		return
+	}
+	for _, site := range sites {
+		if site.HealthCheck == nil || !site.HealthCheck.Enabled {
+			continue
+		}
+		stats := s.probeSite(&site)
+
+		var down []string
+		if site.HealthCheck.MarkDown && len(site.Upstreams) > 1 {
+			down = downUpstreams(site.Upstreams, stats)
+		}
+		if slices.Equal(down, site.DownUpstreams) {
+			continue
+		}
+		// A standby mirrors the primary's rendered state instead.
+		if s.readOnly.Load() {
+			continue
+		}
+
+		slog.Info("Upstream health changed", "site_id", site.ID, "down", down, "previous", site.DownUpstreams)
+		site.DownUpstreams = down
+		if err := s.Store.SaveSite(&site); err != nil {
+			slog.Error("Health checks failed to save site", "site_id", site.ID, "error", err)
+			continue
+		}
+		siteCopy := site
+		s.noteConfigChange(site.ID, "", "health.upstreams_changed")
+		s.refreshSiteConfig(&siteCopy)
+	}
+}
+
+// downUpstreams lists unhealthy upstreams in order. If every upstream is
+// failing none are marked down: nginx would otherwise reject all requests
+// even if a backend recovers between checks.
+func downUpstreams(upstreams []string, stats map[string]health.Stats) []string {
+	var down []string
+	for _, u := range upstreams {
+		if st, ok := stats[u]; ok && !st.Healthy {
+			down = append(down, u)
+		}
+	}
+	if len(down) == len(upstreams) {
+		return nil
+	}
+	return down
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/hsts"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// HSTSPreloadReport is a site's preload readiness, with the preload list's
+// view when requested.
+type HSTSPreloadReport struct {
+	Domain      string           `json:"domain"`
+	Preloadable bool             `json:"preloadable"`
+	Checks      []hsts.Check     `json:"checks"`
+	ListStatus  *hsts.ListStatus `json:"list_status,omitempty"`
+	Submission  *hsts.Submission `json:"submission,omitempty"`
+}
+
+// siteHSTSChecks are the requirements hubfly can see from the site record.
+func siteHSTSChecks(site *models.Site) []hsts.Check {
+	var checks []hsts.Check
+	if site.SSL && site.ForceSSL {
+		checks = append(checks, hsts.Check{Name: "force_ssl", Status: hsts.Pass, Message: "SSL with an HTTP to HTTPS redirect"})
+	} else {
+		checks = append(checks, hsts.Check{Name: "force_ssl", Status: hsts.Fail,
+			Message: "The site must have ssl and force_ssl enabled", Fix: `PATCH the site with {"ssl": true, "force_ssl": true}`})
+	}
+	if site.Wildcard != "" {
+		checks = append(checks, hsts.Check{Name: "wildcard", Status: hsts.Warn,
+			Message: "includeSubDomains forces HTTPS on every name under " + site.Wildcard + ", not only the ones hubfly serves"})
+	}
+	return checks
+}
+
+// handleSiteHSTSPreload serves /v1/sites/{id}/hsts-preload. GET runs the
+// checks (?status=true also asks the preload list); POST submits the
+// domain once every check passes.
+func (s *Server) handleSiteHSTSPreload(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	if nginx.IsWildcardServerName(site.Domain) || nginx.IsRegexServerName(site.Domain) {
+		errorResponse(w, 400, "HSTS preload needs a site whose domain is a plain name")
+		return
+	}
+
+	checks := append(siteHSTSChecks(site), s.HSTS.Check(r.Context(), site.Domain)...)
+	report := HSTSPreloadReport{Domain: site.Domain, Preloadable: hsts.Preloadable(checks), Checks: checks}
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("status") == "true" {
+			if report.ListStatus, err = s.HSTS.Status(r.Context(), site.Domain); err != nil {
+				errorResponse(w, 502, err.Error())
+				return
+			}
+		}
+	case http.MethodPost:
+		if !report.Preloadable {
+			var failed []string
+			for _, c := range checks {
+				if c.Status == hsts.Fail {
+					failed = append(failed, c.Name)
+				}
+			}
+			errorResponse(w, 409, "site is not ready for preloading: failed "+strings.Join(failed, ", "))
+			return
+		}
+		if report.Submission, err = s.HSTS.Submit(r.Context(), site.Domain); err != nil {
+			errorResponse(w, 502, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "site.hsts_preload_submitted",
+			Resource:   "site",
+			ResourceID: site.ID,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"domain": site.Domain, "errors": len(report.Submission.Errors)},
+		})
+		report.Preloadable = len(report.Submission.Errors) == 0
+	}
+	jsonResponse(w, 200, report)
+}
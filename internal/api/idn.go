@@ -0,0 +1,109 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/idn"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// Names are accepted in Unicode and stored in ASCII (punycode), the form
+// nginx, certbot and the log file names need.
+
+// unicodeForm returns the Unicode form of an ASCII name, or "" when it has
+// none.
+func unicodeForm(ascii string) string {
+	if u := idn.ToUnicode(ascii); u != ascii {
+		return u
+	}
+	return ""
+}
+
+// asciiNames converts a list of names, failing on the first invalid one.
+func asciiNames(names []string) ([]string, error) {
+	if names == nil {
+		return nil, nil
+	}
+	out := make([]string, len(names))
+	for i, name := range names {
+		ascii, err := idn.ToASCII(name)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ascii
+	}
+	return out, nil
+}
+
+// serverNameASCII is idn.ToASCII for a server name. Regex names are kept
+// as they are, since lowercasing would change what they match.
+func serverNameASCII(name string) (string, error) {
+	if nginx.IsRegexServerName(name) {
+		return name, nil
+	}
+	return idn.ToASCII(name)
+}
+
+// normalizeSiteNames converts the site's domain, aliases, wildcard zone and
+// ID to ASCII, records the Unicode forms of the names and rejects names
+// nginx can't serve.
+func normalizeSiteNames(site *models.Site) error {
+	domain, err := serverNameASCII(site.Domain)
+	if err != nil {
+		return err
+	}
+	var aliases []string
+	if site.Aliases != nil {
+		aliases = make([]string, len(site.Aliases))
+		for i, alias := range site.Aliases {
+			if aliases[i], err = serverNameASCII(alias); err != nil {
+				return err
+			}
+		}
+	}
+	wildcard, err := idn.ToASCII(site.Wildcard)
+	if err != nil {
+		return err
+	}
+	site.Domain, site.Aliases, site.Wildcard = domain, aliases, wildcard
+	site.ID = asciiID(site.ID)
+	for _, name := range site.ServerNames() {
+		if err := nginx.CheckServerName(name); err != nil {
+			return err
+		}
+	}
+
+	site.DomainUnicode = unicodeForm(domain)
+	site.AliasesUnicode = nil
+	for _, alias := range aliases {
+		if unicodeForm(alias) != "" {
+			for _, a := range aliases {
+				site.AliasesUnicode = append(site.AliasesUnicode, idn.ToUnicode(a))
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// normalizeStreamNames converts the stream's SNI domain to ASCII.
+func normalizeStreamNames(stream *models.Stream) error {
+	domain, err := idn.ToASCII(stream.Domain)
+	if err != nil {
+		return err
+	}
+	stream.Domain = domain
+	stream.DomainUnicode = unicodeForm(domain)
+	return nil
+}
+
+// asciiID maps a Unicode site ID (usually its domain) to the ASCII form it
+// was stored under, since IDs become file names. Other IDs are returned as
+// they are.
+func asciiID(id string) string {
+	if ascii, err := idn.ToASCII(id); err == nil && ascii != strings.ToLower(id) {
+		return ascii
+	}
+	return id
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/jwtgate"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// handleJWTCheck serves /v1/auth/jwt/{site}[/{route}], the auth_request
+// target of sites with a jwt_gate. It answers 204 for a valid token, 401
+// for a missing or invalid one, 403 when nginx asks about a gate that is
+// no longer stored and 502 when the JWKS can't be fetched (which nginx
+// turns into a 500). Only loopback clients are served: the
+// answers are meant for nginx, not as a token oracle.
+func (s *Server) handleJWTCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err != nil || !net.ParseIP(host).IsLoopback() {
+		errorResponse(w, 403, "jwt checks are only served to nginx on this host")
+		return
+	}
+	id, route, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/auth/jwt/"), "/")
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	// nginx may still run a gate the store no longer has: it wasn't
+	// reloaded yet, or the apply of a change failed. Fail closed until it
+	// renders the current one.
+	gate := jwtGateFor(site, route)
+	if gate == nil || r.URL.Query().Get("gate") != gate.Hash() {
+		slog.Warn("JWT check for an outdated gate", "site_id", site.ID, "route", route)
+		errorResponse(w, 403, "jwt gate changed; nginx config is out of date")
+		return
+	}
+
+	err = s.JWT.Verify(r.Context(), jwtgate.Token(r, gate), gate, time.Now())
+	switch {
+	case err == nil:
+		w.WriteHeader(204)
+	case errors.Is(err, jwtgate.ErrKeys):
+		slog.Warn("JWT keys unavailable", "site_id", site.ID, "jwks_url", gate.JWKSURL, "error", err)
+		errorResponse(w, 502, err.Error())
+	default:
+		slog.Debug("JWT rejected", "site_id", site.ID, "uri", r.Header.Get("X-Original-URI"), "error", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		errorResponse(w, 401, err.Error())
+	}
+}
+
+// jwtGateFor is the gate of the route at index route, or the site's when
+// the route has none (or no longer exists). Disabled route gates are
+// rendered as "auth_request off", so they never get here.
+func jwtGateFor(site *models.Site, route string) *models.JWTGate {
+	if i, err := strconv.Atoi(route); err == nil && i >= 0 && i < len(site.Routes) {
+		if g := site.Routes[i].JWTGate; g != nil && !g.Disabled {
+			return g
+		}
+	}
+	return site.JWTGate
+}
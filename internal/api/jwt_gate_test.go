@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// jwtCheck asks for a JWT check the way nginx does, without a token.
+func jwtCheck(s *Server, target string) int {
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestJWTCheck(t *testing.T) {
+	s := newTestServer(t)
+	siteGate := &models.JWTGate{JWKSURL: "https://id.example.com/jwks"}
+	adminGate := &models.JWTGate{JWKSURL: "https://id.example.com/jwks", Audience: []string{"admin"}}
+	site := &models.Site{ID: "app.local", Domain: "app.local", Upstreams: []string{"app:80"}, JWTGate: siteGate,
+		Routes: []models.RouteOverride{{Path: "/admin/", JWTGate: adminGate}, {Path: "/api/"}}}
+	s.Store.SaveSite(site)
+	siteURL := "/v1/auth/jwt/app.local?gate=" + siteGate.Hash()
+	adminURL := "/v1/auth/jwt/app.local/0?gate=" + adminGate.Hash()
+
+	// The current gates check the token
+	for _, target := range []string{siteURL, adminURL} {
+		if code := jwtCheck(s, target); code != 401 {
+			t.Errorf("%s: expected 401 without a token, got %d", target, code)
+		}
+	}
+	req := httptest.NewRequest("GET", siteURL, nil)
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	if rec.Code != 403 {
+		t.Errorf("Expected 403 for a remote client, got %d", rec.Code)
+	}
+	for _, target := range []string{
+		"/v1/auth/jwt/app.local",                            // No hash
+		"/v1/auth/jwt/app.local?gate=" + adminGate.Hash(),   // Another gate's
+		"/v1/auth/jwt/app.local/5?gate=" + adminGate.Hash(), // A route that is gone
+	} {
+		if code := jwtCheck(s, target); code != 403 {
+			t.Errorf("%s: expected 403, got %d", target, code)
+		}
+	}
+
+	// The store dropped and reordered gates that nginx still runs, as after
+	// a PATCH whose apply failed
+	site.JWTGate = nil
+	site.Routes = []models.RouteOverride{{Path: "/api/", JWTGate: &models.JWTGate{Disabled: true}}, {Path: "/admin/", JWTGate: adminGate}}
+	s.Store.SaveSite(site)
+	for _, target := range []string{siteURL, adminURL} {
+		if code := jwtCheck(s, target); code != 403 {
+			t.Errorf("%s: expected a removed gate to fail closed, got %d", target, code)
+		}
+	}
+	if code := jwtCheck(s, "/v1/auth/jwt/app.local/1?gate="+adminGate.Hash()); code != 401 {
+		t.Errorf("Expected the moved gate to check the token, got %d", code)
+	}
+	if code := jwtCheck(s, "/v1/auth/jwt/missing.local"); code != 404 {
+		t.Errorf("Expected 404 for an unknown site, got %d", code)
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// LogFormatResponse is a log format with the sites that use it.
+type LogFormatResponse struct {
+	models.LogFormat
+	UsedBy []string `json:"used_by"`
+}
+
+// logFormatUsers returns the sites whose access log uses the format.
+func (s *Server) logFormatUsers(name string) []*models.Site {
+	sites, _ := s.Store.ListSites()
+	var users []*models.Site
+	for i := range sites {
+		if sites[i].LogFormat == name {
+			users = append(users, &sites[i])
+		}
+	}
+	return users
+}
+
+// siteLogFormat returns the registered format of the site's access log,
+// nil for the built-in one (or when the format is gone).
+func (s *Server) siteLogFormat(site *models.Site) *models.LogFormat {
+	if site.LogFormat == "" {
+		return nil
+	}
+	f, err := s.Nginx.GetLogFormat(site.LogFormat)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// checkSiteLogFormat rejects a site naming a format that is not registered.
+func (s *Server) checkSiteLogFormat(site *models.Site) error {
+	if site.LogFormat == "" {
+		return nil
+	}
+	if _, err := s.Nginx.GetLogFormat(site.LogFormat); err != nil {
+		return fmt.Errorf("log format %s is not registered", site.LogFormat)
+	}
+	return nil
+}
+
+// handleLogFormats serves GET and POST on /v1/log-formats.
+func (s *Server) handleLogFormats(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		formats, err := s.Nginx.ListLogFormats()
+		if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		jsonResponse(w, 200, formats)
+	case http.MethodPost:
+		var f models.LogFormat
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if _, err := s.Nginx.GetLogFormat(f.Name); err == nil {
+			errorResponse(w, 409, "log format "+f.Name+" already exists")
+			return
+		}
+		if err := s.Nginx.SaveLogFormat(&f); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "log_format.created",
+			Resource:   "log_format",
+			ResourceID: f.Name,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 201, LogFormatResponse{LogFormat: f, UsedBy: []string{}})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// handleLogFormatDetail serves GET, PUT and DELETE on
+// /v1/log-formats/{name}. Sites using an updated format are re-rendered; a
+// format still in use cannot be deleted.
+func (s *Server) handleLogFormatDetail(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/log-formats/")
+	f, err := s.Nginx.GetLogFormat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			errorResponse(w, 404, "log format not found")
+		} else {
+			errorResponse(w, 500, err.Error())
+		}
+		return
+	}
+	users := s.logFormatUsers(name)
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, 200, LogFormatResponse{LogFormat: *f, UsedBy: siteIDs(users)})
+	case http.MethodPut:
+		var req struct {
+			Fields []models.LogField `json:"fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		f.Fields = req.Fields
+		if err := s.Nginx.SaveLogFormat(f); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "log_format.updated",
+			Resource:   "log_format",
+			ResourceID: name,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"sites": siteIDs(users)},
+		})
+		for _, site := range users {
+			slog.Info("Log format changed, refreshing site", "log_format", name, "site_id", site.ID)
+			s.noteConfigChange(site.ID, actor(r), "log_format.updated:"+name)
+			go s.refreshSiteConfig(site)
+		}
+		jsonResponse(w, 200, LogFormatResponse{LogFormat: *f, UsedBy: siteIDs(users)})
+	case http.MethodDelete:
+		if len(users) > 0 {
+			errorResponse(w, 409, "log format is used by sites: "+strings.Join(siteIDs(users), ", "))
+			return
+		}
+		if err := s.Nginx.DeleteLogFormat(name); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "log_format.deleted",
+			Resource:   "log_format",
+			ResourceID: name,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// handleLogs serves GET /v1/logs: the access or error logs of several
+// sites merged newest first, each entry tagged with its site. ?sites=a,b
+// or ?group= picks the sites (default all). Access logs are parsed with
+// each site's own format. limit, since, until and search work as for
+// /v1/sites/{id}/logs, with limit counting merged entries.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	q := r.URL.Query()
+	logType := q.Get("type")
+	if logType == "" {
+		logType = "access"
+	}
+	if logType != "access" && logType != "error" {
+		errorResponse(w, 400, "type must be access or error")
+		return
+	}
+	opts, err := parseLogOptions(q)
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, "failed to list sites: "+err.Error())
+		return
+	}
+	var ids []string
+	if v := q.Get("sites"); v != "" {
+		ids = strings.Split(v, ",")
+	}
+	group := q.Get("group")
+	formats := map[string]*models.LogFormat{}
+	for i := range sites {
+		site := &sites[i]
+		if ids != nil && !slices.Contains(ids, site.ID) || group != "" && site.Group != group {
+			continue
+		}
+		formats[site.ID] = s.siteLogFormat(site)
+	}
+	for _, id := range ids {
+		if _, ok := formats[id]; !ok && group == "" {
+			errorResponse(w, 404, "site not found: "+id)
+			return
+		}
+	}
+
+	if logType == "error" {
+		logs, err := s.LogManager.GetMergedErrorLogs(slices.Sorted(maps.Keys(formats)), opts)
+		if err != nil {
+			errorResponse(w, 500, "failed to read error logs: "+err.Error())
+			return
+		}
+		jsonResponse(w, 200, logs)
+		return
+	}
+	logs, err := s.LogManager.GetMergedAccessLogs(formats, opts)
+	if err != nil {
+		errorResponse(w, 500, "failed to read access logs: "+err.Error())
+		return
+	}
+	jsonResponse(w, 200, logs)
+}
+
+// parseLogOptions reads limit (default 100), since, until and search.
+func parseLogOptions(q url.Values) (logmanager.LogOptions, error) {
+	opts := logmanager.LogOptions{Limit: 100, Search: q.Get("search")}
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return opts, fmt.Errorf("limit must be a positive number")
+		}
+		opts.Limit = l
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s, use RFC 3339", p.name)
+			}
+			*p.t = t
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// sseHeartbeat keeps idle streams from being closed by intermediaries.
+const sseHeartbeat = 15 * time.Second
+
+// handleLogStream serves GET /v1/logs/stream: nginx's global access log
+// (?type=access, the default) or error log (?type=error) as Server-Sent
+// Events.
+func (s *Server) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	switch logType := logStreamType(r); logType {
+	case "access":
+		s.streamLog(w, r, filepath.Join(s.LogManager.LogDir, "access.log"), logType, nil)
+	case "error":
+		s.streamLog(w, r, s.LogManager.ErrorLog, logType, nil)
+	default:
+		errorResponse(w, 400, "type must be access or error")
+	}
+}
+
+// handleSiteLogStream serves GET /v1/sites/{id}/logs/stream.
+func (s *Server) handleSiteLogStream(w http.ResponseWriter, r *http.Request, siteID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(siteID)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	logType := logStreamType(r)
+	if logType != "access" && logType != "error" {
+		errorResponse(w, 400, "type must be access or error")
+		return
+	}
+	s.streamLog(w, r, s.LogManager.SiteLogFile(siteID, logType), logType, s.siteLogFormat(site))
+}
+
+func logStreamType(r *http.Request) string {
+	if t := r.URL.Query().Get("type"); t != "" {
+		return t
+	}
+	return "access"
+}
+
+// streamLog follows filename and writes every new line as an SSE event named
+// after logType, with the parsed entry as JSON data. ?search= keeps only
+// lines containing the given text. format is the access log's registered
+// format, if any. The stream ends when the client goes away.
+func (s *Server) streamLog(w http.ResponseWriter, r *http.Request, filename, logType string, format *models.LogFormat) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorResponse(w, 500, "streaming not supported")
+		return
+	}
+	search := r.URL.Query().Get("search")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// Follow runs on its own goroutine; all writes happen here.
+	lines := make(chan string, 256)
+	go logmanager.Follow(r.Context(), filename, logmanager.DefaultFollowInterval, func(line string) {
+		select {
+		case lines <- line:
+		case <-r.Context().Done():
+		}
+	})
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case line := <-lines:
+			if search != "" && !strings.Contains(line, search) {
+				continue
+			}
+			var entry interface{} = logmanager.ParseErrorLine(line)
+			if logType == "access" {
+				parsed, ok := logmanager.ParseLine(format, line)
+				if !ok {
+					parsed = logmanager.LogEntry{Raw: line}
+				}
+				s.LogManager.Annotate(&parsed)
+				entry = parsed
+			}
+			data, _ := json.Marshal(entry)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", logType, data)
+			flusher.Flush()
+		}
+	}
+}
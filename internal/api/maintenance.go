@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+// MaintenanceReport is the outcome of one maintenance run.
+type MaintenanceReport struct {
+	Time      time.Time            `json:"time"`
+	Trigger   string               `json:"trigger"` // "api" or "schedule"
+	Audit     audit.PruneResult    `json:"audit"`
+	Store     *store.CompactResult `json:"store,omitempty"` // Omitted when not compacted, or for the JSON store
+	Reclaimed int64                `json:"reclaimed_bytes"`
+	Duration  int64                `json:"duration_ms"`
+}
+
+// MaintenancePolicy is the retention applied by scheduled runs.
+type MaintenancePolicy struct {
+	AuditMaxAge    string `json:"audit_max_age,omitempty"` // e.g. "2160h"
+	AuditMaxEvents int    `json:"audit_max_events,omitempty"`
+	ConfigVersions int    `json:"config_versions,omitempty"` // Per site
+	Interval       string `json:"interval,omitempty"`        // Empty when not scheduled
+}
+
+// MaintenanceStatus is GET /v1/system/maintenance.
+type MaintenanceStatus struct {
+	Policy  MaintenancePolicy  `json:"policy"`
+	LastRun *MaintenanceReport `json:"last_run,omitempty"`
+}
+
+// MaintenanceRequest overrides the configured retention for one run.
+type MaintenanceRequest struct {
+	AuditMaxAge    string `json:"audit_max_age,omitempty"`
+	AuditMaxEvents *int   `json:"audit_max_events,omitempty"`
+	ConfigVersions *int   `json:"config_versions,omitempty"`
+	Compact        *bool  `json:"compact,omitempty"` // Default true
+}
+
+// maintenanceState serialises runs and keeps the last report.
+type maintenanceState struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     *MaintenanceReport
+}
+
+// StartMaintenance prunes the audit trail to AuditRetention and compacts
+// the store every interval (0 disables).
+func (s *Server) StartMaintenance(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.maintenance.mu.Lock()
+	s.maintenance.interval = interval
+	s.maintenance.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.runMaintenance(s.AuditRetention, true, "schedule", ""); err != nil {
+				slog.Error("Maintenance failed", "error", err)
+			}
+		}
+	}()
+}
+
+// runMaintenance prunes the audit trail and, with compact, compacts the
+// store. The run itself is recorded in the pruned trail.
+func (s *Server) runMaintenance(retention audit.Retention, compact bool, trigger, actor string) (*MaintenanceReport, error) {
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+
+	start := time.Now()
+	report := &MaintenanceReport{Time: start, Trigger: trigger}
+	var err error
+	if report.Audit, err = s.Audit.Prune(retention, start); err != nil {
+		return nil, err
+	}
+	report.Reclaimed = report.Audit.BytesBefore - report.Audit.BytesAfter
+	if compact {
+		if c, ok := s.Store.(interface {
+			Compact() (*store.CompactResult, error)
+		}); ok {
+			if report.Store, err = c.Compact(); err != nil {
+				return nil, err
+			}
+			if report.Store != nil {
+				report.Reclaimed += report.Store.BytesBefore - report.Store.BytesAfter
+			}
+		}
+	}
+	report.Duration = time.Since(start).Milliseconds()
+	s.maintenance.last = report
+
+	s.Audit.Record(audit.Event{
+		Action:   "system.maintenance",
+		Resource: "system",
+		Actor:    actor,
+		Details:  map[string]interface{}{"trigger": trigger, "audit_removed": report.Audit.Removed, "reclaimed_bytes": report.Reclaimed},
+	})
+	slog.Info("Maintenance finished", "trigger", trigger, "audit_removed", report.Audit.Removed, "reclaimed_bytes", report.Reclaimed)
+	return report, nil
+}
+
+// handleMaintenance serves /v1/system/maintenance: GET shows the policy and
+// the last run, POST runs maintenance now.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status := MaintenanceStatus{Policy: MaintenancePolicy{
+			AuditMaxEvents: s.AuditRetention.MaxEvents,
+			ConfigVersions: s.AuditRetention.ConfigVersions,
+		}}
+		if s.AuditRetention.MaxAge > 0 {
+			status.Policy.AuditMaxAge = s.AuditRetention.MaxAge.String()
+		}
+		s.maintenance.mu.Lock()
+		if s.maintenance.interval > 0 {
+			status.Policy.Interval = s.maintenance.interval.String()
+		}
+		status.LastRun = s.maintenance.last
+		s.maintenance.mu.Unlock()
+		jsonResponse(w, 200, status)
+	case http.MethodPost:
+		var req MaintenanceRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				errorResponse(w, 400, "invalid json")
+				return
+			}
+		}
+		retention := s.AuditRetention
+		if req.AuditMaxAge != "" {
+			d, err := time.ParseDuration(req.AuditMaxAge)
+			if err != nil || d <= 0 {
+				errorResponse(w, 400, "audit_max_age must be a positive duration such as 2160h")
+				return
+			}
+			retention.MaxAge = d
+		}
+		if req.AuditMaxEvents != nil {
+			retention.MaxEvents = *req.AuditMaxEvents
+		}
+		if req.ConfigVersions != nil {
+			retention.ConfigVersions = *req.ConfigVersions
+		}
+		if retention.MaxEvents < 0 || retention.ConfigVersions < 0 {
+			errorResponse(w, 400, "audit_max_events and config_versions must not be negative")
+			return
+		}
+		report, err := s.runMaintenance(retention, req.Compact == nil || *req.Compact, "api", actor(r))
+		if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		jsonResponse(w, 200, report)
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
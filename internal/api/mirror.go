@@ -0,0 +1,428 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// mirrorState tracks a standby instance that replicates a primary hubfly API.
+type mirrorState struct {
+	mu       sync.RWMutex
+	primary  string
+	token    string // API key presented to the primary
+	interval time.Duration
+	lastSync time.Time
+	lastErr  string
+	promoted bool
+	stop     chan struct{}
+
+	// Records the primary's UpdatedAt for each synced resource, so local
+	// status writes don't make every item look changed on the next pass.
+	sites   map[string]mirroredSite
+	streams map[string]time.Time
+}
+
+// mirroredSite is how a site was last rendered from the primary's copy.
+type mirroredSite struct {
+	updated time.Time
+	// httpOnly: an SSL site rendered without its certificate, to render
+	// again once the certificate arrives.
+	httpOnly bool
+}
+
+// MirrorStatus is returned by GET /v1/mirror.
+type MirrorStatus struct {
+	ReadOnly  bool      `json:"read_only"`
+	Primary   string    `json:"primary,omitempty"`
+	Interval  string    `json:"interval,omitempty"`
+	LastSync  time.Time `json:"last_sync,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Promoted  bool      `json:"promoted"`
+}
+
+// StartMirror puts the server into read-only standby mode and continuously
+// pulls sites and streams from the primary, rendering them locally.
+// The token is sent to the primary when it requires authentication; a
+// viewer key is sufficient.
+func (s *Server) StartMirror(primaryURL, token string, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	s.mirror = &mirrorState{
+		primary:  strings.TrimRight(primaryURL, "/"),
+		token:    token,
+		interval: interval,
+		stop:     make(chan struct{}),
+		sites:    make(map[string]mirroredSite),
+		streams:  make(map[string]time.Time),
+	}
+	s.readOnly.Store(true)
+
+	slog.Info("Starting mirror mode", "primary", s.mirror.primary, "interval", interval)
+	go s.runMirror()
+}
+
+func (s *Server) runMirror() {
+	ticker := time.NewTicker(s.mirror.interval)
+	defer ticker.Stop()
+
+	for {
+		s.syncFromPrimary()
+		select {
+		case <-ticker.C:
+		case <-s.mirror.stop:
+			slog.Info("Mirror sync stopped")
+			return
+		}
+	}
+}
+
+func (s *Server) syncFromPrimary() {
+	m := s.mirror
+	err := s.mirrorOnce()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSync = time.Now()
+	if err != nil {
+		slog.Error("Mirror sync failed", "primary", m.primary, "error", err)
+		m.lastErr = err.Error()
+		return
+	}
+	m.lastErr = ""
+}
+
+func (s *Server) mirrorOnce() error {
+	var templates []nginx.Template
+	if err := s.fetchPrimary("/v1/templates?content=true", &templates); err != nil {
+		return err
+	}
+	var formats []models.LogFormat
+	if err := s.fetchPrimary("/v1/log-formats", &formats); err != nil {
+		return err
+	}
+	var sites []models.Site
+	if err := s.fetchPrimary("/v1/sites", &sites); err != nil {
+		return err
+	}
+	var streams []models.Stream
+	if err := s.fetchPrimary("/v1/streams", &streams); err != nil {
+		return err
+	}
+
+	// Templates and log formats first, so the sites below render against
+	// the new versions.
+	changed := s.mirrorTemplates(templates)
+	changedFormats := s.mirrorLogFormats(formats)
+	s.mirrorSites(sites)
+	s.mirrorStreams(streams)
+
+	// Sites that did not change themselves still need a render when a
+	// template they include, or their log format, did.
+	var users []*models.Site
+	for name := range changed {
+		users = append(users, s.templateUsers(name)...)
+	}
+	for name := range changedFormats {
+		users = append(users, s.logFormatUsers(name)...)
+	}
+	rendered := make(map[string]bool)
+	for _, site := range users {
+		if rendered[site.ID] {
+			continue
+		}
+		rendered[site.ID] = true
+		render := *site
+		if render.SSL && !s.Certbot.CertExists(render.CertName()) {
+			render.SSL = false
+		}
+		s.noteConfigChange(site.ID, "", "mirror.synced")
+		s.refreshSiteConfig(&render)
+	}
+	return nil
+}
+
+// mirrorTemplates makes the local templates match the primary's and
+// returns the names whose content changed.
+func (s *Server) mirrorTemplates(remote []nginx.Template) map[string]bool {
+	changed := make(map[string]bool)
+	seen := make(map[string]bool, len(remote))
+	for _, t := range remote {
+		seen[t.Name] = true
+		if local, err := s.Nginx.GetTemplate(t.Name); err == nil && local.Content == t.Content {
+			continue
+		}
+		slog.Info("Mirroring template", "template", t.Name)
+		if err := s.Nginx.SaveTemplate(t.Name, t.Content); err != nil {
+			slog.Error("Mirror failed to save template", "template", t.Name, "error", err)
+			continue
+		}
+		changed[t.Name] = true
+	}
+
+	local, err := s.Nginx.ListTemplates()
+	if err != nil {
+		slog.Error("Mirror failed to list local templates", "error", err)
+		return changed
+	}
+	for _, t := range local {
+		if !seen[t.Name] {
+			slog.Info("Removing template deleted on primary", "template", t.Name)
+			s.Nginx.DeleteTemplate(t.Name)
+		}
+	}
+	return changed
+}
+
+// mirrorLogFormats makes the local log formats match the primary's and
+// returns the names whose fields changed.
+func (s *Server) mirrorLogFormats(remote []models.LogFormat) map[string]bool {
+	changed := make(map[string]bool)
+	seen := make(map[string]bool, len(remote))
+	for _, f := range remote {
+		seen[f.Name] = true
+		if local, err := s.Nginx.GetLogFormat(f.Name); err == nil && slices.Equal(local.Fields, f.Fields) {
+			continue
+		}
+		slog.Info("Mirroring log format", "log_format", f.Name)
+		if err := s.Nginx.SaveLogFormat(&f); err != nil {
+			slog.Error("Mirror failed to save log format", "log_format", f.Name, "error", err)
+			continue
+		}
+		changed[f.Name] = true
+	}
+
+	local, err := s.Nginx.ListLogFormats()
+	if err != nil {
+		slog.Error("Mirror failed to list local log formats", "error", err)
+		return changed
+	}
+	for _, f := range local {
+		if !seen[f.Name] {
+			slog.Info("Removing log format deleted on primary", "log_format", f.Name)
+			s.Nginx.DeleteLogFormat(f.Name)
+		}
+	}
+	return changed
+}
+
+func (s *Server) fetchPrimary(path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, s.mirror.primary+path, nil)
+	if err != nil {
+		return err
+	}
+	if s.mirror.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.mirror.token)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch %s: primary returned %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Server) mirrorSites(remote []models.Site) {
+	m := s.mirror
+	seen := make(map[string]bool, len(remote))
+
+	for _, site := range remote {
+		seen[site.ID] = true
+
+		m.mu.RLock()
+		last, known := m.sites[site.ID]
+		m.mu.RUnlock()
+		if known && last.updated.Equal(site.UpdatedAt) &&
+			!(last.httpOnly && s.Certbot.CertExists(site.CertName())) {
+			continue
+		}
+
+		slog.Info("Mirroring site", "site_id", site.ID, "domain", site.Domain)
+		primaryUpdated := site.UpdatedAt
+		// The primary never sends the EAB HMAC key; keep one set here
+		if local, err := s.Store.GetSite(site.ID); err == nil {
+			site.ACME.KeepEABKey(local.ACME)
+		}
+		if err := s.Store.SaveSite(&site); err != nil {
+			slog.Error("Mirror failed to save site", "site_id", site.ID, "error", err)
+			continue
+		}
+
+		// Certificates are issued on the primary. Render HTTP-only until the
+		// lineage is present locally to avoid breaking the nginx reload.
+		render := site
+		if render.SSL && !s.Certbot.CertExists(render.CertName()) {
+			slog.Warn("Certificate missing on standby, rendering HTTP only", "site_id", site.ID, "domain", site.Domain)
+			render.SSL = false
+		}
+		s.noteConfigChange(site.ID, "", "mirror.synced")
+		s.refreshSiteConfig(&render)
+
+		m.mu.Lock()
+		m.sites[site.ID] = mirroredSite{updated: primaryUpdated, httpOnly: render.SSL != site.SSL}
+		m.mu.Unlock()
+	}
+
+	local, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Mirror failed to list local sites", "error", err)
+		return
+	}
+	for _, site := range local {
+		if seen[site.ID] {
+			continue
+		}
+		slog.Info("Removing site deleted on primary", "site_id", site.ID)
+		if err := s.Nginx.Delete(site.ID); err != nil {
+			slog.Error("Mirror failed to remove site config", "site_id", site.ID, "error", err)
+			continue
+		}
+		s.Store.DeleteSite(site.ID)
+
+		m.mu.Lock()
+		delete(m.sites, site.ID)
+		m.mu.Unlock()
+	}
+}
+
+func (s *Server) mirrorStreams(remote []models.Stream) {
+	m := s.mirror
+	seen := make(map[string]bool, len(remote))
+	dirtyPorts := make(map[int]bool)
+
+	local, err := s.Store.ListStreams()
+	if err != nil {
+		slog.Error("Mirror failed to list local streams", "error", err)
+		return
+	}
+	localByID := make(map[string]models.Stream, len(local))
+	for _, str := range local {
+		localByID[str.ID] = str
+	}
+
+	for _, str := range remote {
+		seen[str.ID] = true
+
+		m.mu.RLock()
+		last, known := m.streams[str.ID]
+		m.mu.RUnlock()
+		if known && last.Equal(str.UpdatedAt) {
+			continue
+		}
+
+		if old, ok := localByID[str.ID]; ok && old.ListenPort != str.ListenPort {
+			dirtyPorts[old.ListenPort] = true
+		}
+		if err := s.Store.SaveStream(&str); err != nil {
+			slog.Error("Mirror failed to save stream", "stream_id", str.ID, "error", err)
+			continue
+		}
+		dirtyPorts[str.ListenPort] = true
+
+		m.mu.Lock()
+		m.streams[str.ID] = str.UpdatedAt
+		m.mu.Unlock()
+	}
+
+	for _, str := range local {
+		if seen[str.ID] {
+			continue
+		}
+		slog.Info("Removing stream deleted on primary", "stream_id", str.ID)
+		s.Store.DeleteStream(str.ID)
+		dirtyPorts[str.ListenPort] = true
+
+		m.mu.Lock()
+		delete(m.streams, str.ID)
+		m.mu.Unlock()
+	}
+
+	for port := range dirtyPorts {
+		s.reconcileStreams(port)
+	}
+}
+
+// PromoteMirror stops replication and makes the instance writable.
+func (s *Server) PromoteMirror() bool {
+	if s.mirror == nil {
+		return false
+	}
+	s.mirror.mu.Lock()
+	defer s.mirror.mu.Unlock()
+	if s.mirror.promoted {
+		return false
+	}
+	s.mirror.promoted = true
+	close(s.mirror.stop)
+	s.readOnly.Store(false)
+	slog.Info("Mirror promoted to primary", "former_primary", s.mirror.primary)
+	return true
+}
+
+func (s *Server) handleMirror(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	status := MirrorStatus{ReadOnly: s.readOnly.Load()}
+	if s.mirror != nil {
+		s.mirror.mu.RLock()
+		status.Primary = s.mirror.primary
+		status.Interval = s.mirror.interval.String()
+		status.LastSync = s.mirror.lastSync
+		status.LastError = s.mirror.lastErr
+		status.Promoted = s.mirror.promoted
+		s.mirror.mu.RUnlock()
+	}
+	jsonResponse(w, 200, status)
+}
+
+func (s *Server) handleMirrorPromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	if s.mirror == nil {
+		errorResponse(w, 400, "instance is not running in mirror mode")
+		return
+	}
+	if !s.PromoteMirror() {
+		errorResponse(w, 409, "mirror already promoted")
+		return
+	}
+	jsonResponse(w, 200, map[string]string{"status": "promoted"})
+}
+
+// readOnlyMiddleware rejects mutating requests while the instance is a standby.
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly.Load() && r.URL.Path != "/v1/mirror/promote" && r.URL.Path != "/v1/backup" {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				errorResponse(w, 403, "instance is a read-only mirror; promote it to accept writes")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestMirrorRendersSSLOnceCertArrives(t *testing.T) {
+	primary := newTestServer(t)
+	site := models.Site{ID: "a", Domain: "a.example.com", Upstreams: []string{"app:80"}, SSL: true, UpdatedAt: time.Now()}
+	primary.Store.SaveSite(&site)
+	ts := httptest.NewServer(primary.Routes())
+	defer ts.Close()
+
+	standby := newTestServer(t)
+	standby.mirror = &mirrorState{
+		primary: ts.URL,
+		stop:    make(chan struct{}),
+		sites:   make(map[string]mirroredSite),
+		streams: make(map[string]time.Time),
+	}
+	config := standby.Nginx.SiteConfigFile("a")
+	sync := func() string {
+		t.Helper()
+		if err := standby.mirrorOnce(); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(config)
+		return string(data)
+	}
+
+	if conf := sync(); conf == "" || strings.Contains(conf, "ssl_certificate") {
+		t.Fatalf("Expected an HTTP-only config without the certificate:\n%s", conf)
+	}
+	// Nothing changed: a pass without the certificate renders nothing
+	os.Remove(config)
+	if conf := sync(); conf != "" {
+		t.Fatal("Site rendered again without a change")
+	}
+
+	// The certificate arrives, the site is unchanged on the primary
+	live := filepath.Join(standby.Certbot.LiveDir, site.CertName())
+	os.MkdirAll(live, 0755)
+	for _, name := range []string{"fullchain.pem", "privkey.pem"} {
+		os.WriteFile(filepath.Join(live, name), []byte("test"), 0600)
+	}
+	if conf := sync(); !strings.Contains(conf, "ssl_certificate") {
+		t.Fatalf("Expected an SSL config once the certificate is present:\n%s", conf)
+	}
+	os.Remove(config)
+	if conf := sync(); conf != "" {
+		t.Error("Site rendered again after its SSL render")
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/agent"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// NodeStatus is a node agent as seen by the control plane.
+type NodeStatus struct {
+	agent.Report
+	Address  string    `json:"address"` // Where the last request came from
+	LastSeen time.Time `json:"last_seen"`
+	InSync   bool      `json:"in_sync"` // Running the current bundle
+	Stale    bool      `json:"stale"`   // Missed three reports
+}
+
+// nodeRegistry is the control plane's view of its agents. It is kept in
+// memory; agents report again within one interval after a restart.
+type nodeRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]*NodeStatus
+}
+
+// seen records a request from node id and returns its status, creating it
+// on first contact.
+func (n *nodeRegistry) seen(id string, r *http.Request) (st *NodeStatus, created bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nodes == nil {
+		n.nodes = make(map[string]*NodeStatus)
+	}
+	st, ok := n.nodes[id]
+	if !ok {
+		st = &NodeStatus{Report: agent.Report{NodeID: id}}
+		n.nodes[id] = st
+	}
+	st.LastSeen = time.Now()
+	st.Address = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		st.Address = host
+	}
+	return st, !ok
+}
+
+// snapshot copies a node's status, filling in how it compares to the
+// current bundle version.
+func (n *nodeRegistry) snapshot(st *NodeStatus, version string) NodeStatus {
+	out := *st
+	out.InSync = out.ConfigVersion != "" && out.ConfigVersion == version
+	interval := time.Duration(out.Interval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	out.Stale = time.Since(out.LastSeen) > 3*interval
+	return out
+}
+
+// handleNodes serves GET /v1/nodes.
+func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
+	if !s.ControlPlane {
+		errorResponse(w, 404, "control plane mode is not enabled (start with --control-plane)")
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	version := ""
+	if b, err := s.Nginx.Bundle(); err == nil {
+		version = b.Version
+	}
+	s.nodes.mu.Lock()
+	list := make([]NodeStatus, 0, len(s.nodes.nodes))
+	for _, st := range s.nodes.nodes {
+		list = append(list, s.nodes.snapshot(st, version))
+	}
+	s.nodes.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].NodeID < list[j].NodeID })
+	jsonResponse(w, 200, list)
+}
+
+// handleNodeDetail serves /v1/nodes/{id} (GET, DELETE) and the agent
+// endpoints /v1/nodes/{id}/config and /v1/nodes/{id}/status.
+func (s *Server) handleNodeDetail(w http.ResponseWriter, r *http.Request) {
+	if !s.ControlPlane {
+		errorResponse(w, 404, "control plane mode is not enabled (start with --control-plane)")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/nodes/")
+	switch {
+	case strings.HasSuffix(id, "/config"):
+		s.handleNodeConfig(w, r, strings.TrimSuffix(id, "/config"))
+		return
+	case strings.HasSuffix(id, "/status"):
+		s.handleNodeReport(w, r, strings.TrimSuffix(id, "/status"))
+		return
+	}
+
+	s.nodes.mu.Lock()
+	st, ok := s.nodes.nodes[id]
+	s.nodes.mu.Unlock()
+	if !ok {
+		errorResponse(w, 404, "node not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		version := ""
+		if b, err := s.Nginx.Bundle(); err == nil {
+			version = b.Version
+		}
+		s.nodes.mu.Lock()
+		out := s.nodes.snapshot(st, version)
+		s.nodes.mu.Unlock()
+		jsonResponse(w, 200, out)
+	case http.MethodDelete:
+		if p := principalFrom(r); p != nil && p.Role == models.RoleNodeAgent {
+			errorResponse(w, 403, "role "+p.Role+" may only report node status")
+			return
+		}
+		s.nodes.mu.Lock()
+		delete(s.nodes.nodes, id)
+		s.nodes.mu.Unlock()
+		s.Audit.Record(audit.Event{
+			Action:     "node.removed",
+			Resource:   "node",
+			ResourceID: id,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// handleNodeConfig serves GET /v1/nodes/{id}/config: the bundle of live
+// configs. Agents send the version they have as If-None-Match and get 304
+// while it is still current.
+func (s *Server) handleNodeConfig(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	if !agent.ValidNodeID(id) {
+		errorResponse(w, 400, "invalid node id")
+		return
+	}
+	if _, created := s.nodes.seen(id, r); created {
+		s.Audit.Record(audit.Event{
+			Action:     "node.registered",
+			Resource:   "node",
+			ResourceID: id,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"address": r.RemoteAddr},
+		})
+	}
+
+	b, err := s.Nginx.Bundle()
+	if err != nil {
+		errorResponse(w, 500, "failed to read configs: "+err.Error())
+		return
+	}
+	etag := `"` + b.Version + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	jsonResponse(w, 200, b)
+}
+
+// handleNodeReport serves POST /v1/nodes/{id}/status.
+func (s *Server) handleNodeReport(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	if !agent.ValidNodeID(id) {
+		errorResponse(w, 400, "invalid node id")
+		return
+	}
+	var report agent.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if report.NodeID != "" && report.NodeID != id {
+		errorResponse(w, 400, "node_id does not match the URL")
+		return
+	}
+	report.NodeID = id
+
+	st, created := s.nodes.seen(id, r)
+	s.nodes.mu.Lock()
+	previous := st.Error
+	st.Report = report
+	s.nodes.mu.Unlock()
+	if created {
+		s.Audit.Record(audit.Event{
+			Action:     "node.registered",
+			Resource:   "node",
+			ResourceID: id,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"address": r.RemoteAddr},
+		})
+	}
+	if report.Error != "" && report.Error != previous {
+		s.Audit.Record(audit.Event{
+			Action:     "node.apply_failed",
+			Resource:   "node",
+			ResourceID: id,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"error": report.Error},
+		})
+	}
+	jsonResponse(w, 200, map[string]string{"status": "ok"})
+}
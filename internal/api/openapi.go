@@ -0,0 +1,503 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/agent"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/synthetic"
+)
+
+// operation describes one endpoint for the OpenAPI document. Request and
+// response schemas are reflected from the Go types the handlers encode, so
+// model changes show up in the spec without editing it; TestOpenAPIRoutes
+// checks every operation against the router.
+type operation struct {
+	id       string
+	method   string
+	path     string // {name} marks path parameters
+	tag      string
+	summary  string
+	query    []param
+	request  interface{} // JSON body, nil for none
+	response interface{} // JSON body; sse for an event stream, file for a download
+	status   int         // Success status, default 200
+	debug    bool        // Only served in chaos mode
+}
+
+type param struct {
+	name, description string
+}
+
+// oneOf documents a response whose shape depends on a parameter.
+type oneOf []interface{}
+
+// sse marks a Server-Sent Events response.
+type sse struct{}
+
+// file marks a download, or an upload, of the given media type.
+type file string
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+var (
+	qCheckUpstream = param{"check_upstream", "true to probe the upstreams before saving"}
+	qWait          = param{"wait", "true to answer once the site is applied, with its final status"}
+	qLogType       = param{"type", "access (default) or error"}
+	qSearch        = param{"search", "Only entries containing this text"}
+	qSince         = param{"since", "RFC3339 lower bound"}
+	qUntil         = param{"until", "RFC3339 upper bound"}
+	qLimit         = param{"limit", "Maximum number of entries"}
+)
+
+// operations lists the API. Keep it next to Routes when adding endpoints.
+var operations = []operation{
+	{id: "getHealth", method: "GET", path: "/v1/health", tag: "system", summary: "Liveness and store connectivity", response: map[string]string{}},
+	{id: "checkSiteJWT", method: "GET", path: "/v1/auth/jwt/{id}", tag: "system", summary: "Validate the request's token against the site's jwt_gate (nginx auth_request, loopback only)", status: 204},
+	{id: "checkRouteJWT", method: "GET", path: "/v1/auth/jwt/{id}/{route}", tag: "system", summary: "Validate the request's token against the jwt_gate of the site's route at index route (nginx auth_request, loopback only)", status: 204},
+	{id: "getOpenAPI", method: "GET", path: "/v1/openapi.json", tag: "system", summary: "This document", response: map[string]interface{}{}},
+	{id: "getSystem", method: "GET", path: "/v1/system", tag: "system", summary: "Build, nginx and resource overview", response: SystemInfo{}},
+	{id: "getMaintenance", method: "GET", path: "/v1/system/maintenance", tag: "system", summary: "Retention policy and the last maintenance run", response: MaintenanceStatus{}},
+	{id: "runMaintenance", method: "POST", path: "/v1/system/maintenance", tag: "system", summary: "Prune the audit trail and config history and compact the store now", request: MaintenanceRequest{}, response: MaintenanceReport{}},
+	{id: "getOverview", method: "GET", path: "/v1/overview", tag: "system", summary: "Cached dashboard snapshot: status counts, request rate, error rate, expiring certificates and last reload", response: Overview{}},
+	{id: "exportConfig", method: "GET", path: "/v1/export", tag: "system", summary: "Every log format, template, site (with its firewall rules) and stream, for migrating to another host",
+		query: []param{{"format", "yaml for YAML (or Accept: application/yaml); JSON by default"}}, response: ConfigExport{}},
+	{id: "importConfig", method: "POST", path: "/v1/import", tag: "system", summary: "Create or replace the items of an export, with a result per item",
+		query: []param{{"format", "yaml to read a YAML body (or a YAML Content-Type)"}, {"wait", "true to answer once sites and streams are applied, with their final status"},
+			{"atomic", "true to import no site or stream when one of them fails"}},
+		request: ConfigExport{}, response: ImportReport{}},
+	{id: "createBackup", method: "POST", path: "/v1/backup", tag: "system", summary: "tar.gz of the store (sites, streams, API keys), templates, log formats, site files, certificates and generated nginx configs, for disaster recovery",
+		response: file("application/gzip")},
+	{id: "restoreBackup", method: "POST", path: "/v1/restore", tag: "system", summary: "Validate a backup, replace the store and files with it, re-render every site and stream and reload nginx",
+		query:   []param{{"wait", "true to apply every site and stream before responding, with their status in the results"}},
+		request: file("application/gzip"), response: RestoreReport{}},
+	{id: "exportNginx", method: "GET", path: "/v1/export/nginx", tag: "system", summary: "tar.gz of the rendered site and stream configs and global includes, for offline review", response: file("application/gzip")},
+	{id: "getDrift", method: "GET", path: "/v1/drift", tag: "system", summary: "Server names in nginx that do not match the store", response: []DriftEntry{}},
+	{id: "watch", method: "GET", path: "/v1/watch", tag: "system", summary: "Site and stream changes after a revision, by long poll or Server-Sent Events; 410 when the revision must be re-listed",
+		query: []param{{"resource", "sites, streams or both (comma-separated, default both)"}, {"since", "Revision to resume after (default: now)"},
+			{"timeout", "Long-poll seconds (default 30, max 300)"}, {"stream", "true for Server-Sent Events"}}, response: WatchResponse{}},
+	{id: "listSecurityFindings", method: "GET", path: "/v1/security/findings", tag: "system", summary: "Security checks (host spoofing, alias traversal, SSRF) on the live nginx configs",
+		query: []param{{"site", "Only this site's findings"}}, response: SecurityReport{}},
+	{id: "listAudit", method: "GET", path: "/v1/audit", tag: "system", summary: "Audit trail of API changes",
+		query:    []param{{"resource", "Filter by resource type"}, {"resource_id", "Filter by resource ID"}, {"action", "Filter by action"}, qSince, qLimit},
+		response: []audit.Event{}},
+	{id: "getMirror", method: "GET", path: "/v1/mirror", tag: "system", summary: "Standby replication status", response: MirrorStatus{}},
+	{id: "promoteMirror", method: "POST", path: "/v1/mirror/promote", tag: "system", summary: "Promote a standby to primary", response: statusResponse{}},
+	{id: "getLogs", method: "GET", path: "/v1/logs", tag: "logs", summary: "Read the access or error logs of several sites, merged",
+		query:    []param{qLogType, {"sites", "Comma-separated site IDs (default all)"}, {"group", "Only the sites of this group"}, qLimit, qSearch, qSince, qUntil},
+		response: []logmanager.SiteLogEntry{}},
+	{id: "streamLogs", method: "GET", path: "/v1/logs/stream", tag: "logs", summary: "Follow nginx's global access or error log",
+		query: []param{qLogType, qSearch}, response: sse{}},
+
+	{id: "listSites", method: "GET", path: "/v1/sites", tag: "sites", summary: "List sites",
+		query: []param{{"domain", "Only the site serving this domain or alias"}}, response: []models.Site{}},
+	{id: "createSite", method: "POST", path: "/v1/sites", tag: "sites", summary: "Create a site",
+		query: []param{qCheckUpstream, qWait}, request: models.Site{}, response: siteResponse{}, status: 201},
+	{id: "previewSite", method: "POST", path: "/v1/sites/preview", tag: "sites", summary: "Render a site's nginx config without applying it",
+		query: []param{qCheckUpstream}, request: models.Site{}, response: PreviewResponse{}},
+	{id: "getSite", method: "GET", path: "/v1/sites/{id}", tag: "sites", summary: "Get a site", response: siteResponse{}},
+	{id: "updateSite", method: "PATCH", path: "/v1/sites/{id}", tag: "sites", summary: "Update the given fields of a site",
+		query: []param{qCheckUpstream, qWait}, request: models.Site{}, response: siteResponse{}},
+	{id: "deleteSite", method: "DELETE", path: "/v1/sites/{id}", tag: "sites", summary: "Delete a site",
+		query: []param{{"revoke_cert", "true to revoke its certificate"}}, response: statusResponse{}},
+	{id: "getSiteLogs", method: "GET", path: "/v1/sites/{id}/logs", tag: "logs", summary: "Read a site's logs",
+		query:    []param{{"type", "access (default), error or audit"}, qLimit, qSearch, qSince, qUntil},
+		response: oneOf{[]logmanager.LogEntry{}, []logmanager.ErrorLogEntry{}, []logmanager.AuditLogEntry{}}},
+	{id: "purgeSiteLogs", method: "DELETE", path: "/v1/sites/{id}/logs", tag: "logs", summary: "Purge a range of log lines",
+		query: []param{{"type", "access, error, audit or all (default)"}, {"older_than", "Duration, e.g. 720h"}, qSince, qUntil},
+		response: struct {
+			Status  string         `json:"status"`
+			Removed map[string]int `json:"removed"`
+		}{}},
+	{id: "getSiteAccessLogs", method: "GET", path: "/v1/sites/{id}/logs/access", tag: "logs", summary: "Read a site's access log",
+		query: []param{qLimit, qSearch, qSince, qUntil}, response: []logmanager.LogEntry{}},
+	{id: "getSiteErrorLogs", method: "GET", path: "/v1/sites/{id}/logs/error", tag: "logs", summary: "Read a site's error log",
+		query: []param{qLimit, qSearch, qSince, qUntil}, response: []logmanager.ErrorLogEntry{}},
+	{id: "streamSiteLogs", method: "GET", path: "/v1/sites/{id}/logs/stream", tag: "logs", summary: "Follow a site's access or error log",
+		query: []param{qLogType, qSearch}, response: sse{}},
+	{id: "getSiteAnalytics", method: "GET", path: "/v1/sites/{id}/analytics", tag: "logs", summary: "Aggregated access log",
+		query: []param{qSince, qUntil, qSearch}, response: logmanager.Analytics{}},
+	{id: "getSiteFirewall", method: "GET", path: "/v1/sites/{id}/firewall", tag: "sites", summary: "Get a site's firewall rules", response: models.FirewallConfig{}},
+	{id: "clearSiteFirewall", method: "DELETE", path: "/v1/sites/{id}/firewall", tag: "sites", summary: "Clear firewall rules",
+		query: []param{{"section", "ip_rules, rate_limit, block_rules, countries or all (default)"}}, response: statusResponse{}},
+	{id: "getSiteWAF", method: "GET", path: "/v1/sites/{id}/waf", tag: "sites", summary: "Get a site's WAF settings", response: models.WAF{}},
+	{id: "updateSiteWAF", method: "PUT", path: "/v1/sites/{id}/waf", tag: "sites", summary: "Replace a site's WAF settings", request: models.WAF{}, response: models.WAF{}},
+	{id: "addWAFExclusion", method: "POST", path: "/v1/sites/{id}/waf/exclusions", tag: "sites", summary: "Exclude a CRS rule, optionally under a path", request: models.WAFExclusion{}, response: models.WAF{}},
+	{id: "deleteWAFExclusion", method: "DELETE", path: "/v1/sites/{id}/waf/exclusions/{rule_id}", tag: "sites", summary: "Remove the exclusions of a rule",
+		query: []param{{"path", "Only remove the exclusion for this path"}}, response: models.WAF{}},
+	{id: "getSiteFile", method: "GET", path: "/v1/sites/{id}/files/{name}", tag: "sites", summary: "Get an uploaded favicon.ico or robots.txt", response: SiteFile{}},
+	{id: "putSiteFile", method: "PUT", path: "/v1/sites/{id}/files/{name}", tag: "sites", summary: "Upload the favicon.ico or robots.txt served by the asset shield",
+		request: struct {
+			Content []byte `json:"content"`
+		}{}, response: SiteFile{}},
+	{id: "deleteSiteFile", method: "DELETE", path: "/v1/sites/{id}/files/{name}", tag: "sites", summary: "Remove an uploaded file", response: statusResponse{}},
+	{id: "getSiteDrain", method: "GET", path: "/v1/sites/{id}/drain", tag: "sites", summary: "Upstreams still draining after removal", response: DrainStatus{}},
+	{id: "deleteSiteDrain", method: "DELETE", path: "/v1/sites/{id}/drain", tag: "sites", summary: "Drop draining upstreams now", response: DrainStatus{}},
+	{id: "getSiteBalancing", method: "GET", path: "/v1/sites/{id}/balancing", tag: "sites", summary: "Upstream weights and health", response: BalancingStatus{}},
+	{id: "getSiteRuntime", method: "GET", path: "/v1/sites/{id}/runtime", tag: "sites", summary: "Live status: nginx connections, upstream health, traffic rates, certificate expiry and last reload", response: SiteRuntime{}},
+	{id: "getSiteSynthetics", method: "GET", path: "/v1/sites/{id}/synthetics", tag: "sites", summary: "State and 24h/7d/30d uptime of the site's synthetic checks",
+		query: []param{{"since", "RFC3339 time; also return the individual results since then"}}, response: SyntheticReport{}},
+	{id: "runSiteSynthetics", method: "POST", path: "/v1/sites/{id}/synthetics/run", tag: "sites", summary: "Run the site's synthetic checks now", response: []synthetic.Result{}},
+	{id: "getSiteState", method: "GET", path: "/v1/sites/{id}/state", tag: "sites", summary: "The site split into user-set spec and hubfly-computed fields", response: SiteState{}},
+	{id: "getSiteDrift", method: "GET", path: "/v1/sites/{id}/drift", tag: "sites", summary: "Diff of the live nginx config against the one the stored site renders to", response: SiteDrift{}},
+	{id: "purgeSiteCache", method: "POST", path: "/v1/sites/{id}/cache/purge", tag: "sites", summary: "Delete cached responses, by path or all", request: CachePurgeRequest{}, response: CachePurgeResult{}},
+	{id: "warmSiteCache", method: "POST", path: "/v1/sites/{id}/cache/warm", tag: "sites", summary: "Fetch URLs or a sitemap through nginx to fill the cache", request: CacheWarmRequest{}, response: CacheWarmResult{}},
+	{id: "getSiteCapture", method: "GET", path: "/v1/sites/{id}/capture", tag: "sites", summary: "Traffic capture settings, state and recording size", response: CaptureStatus{}},
+	{id: "startSiteCapture", method: "POST", path: "/v1/sites/{id}/capture", tag: "sites", summary: "Record request and response metadata for a sample of traffic for a few minutes", request: CaptureRequest{}, response: CaptureStatus{}},
+	{id: "stopSiteCapture", method: "DELETE", path: "/v1/sites/{id}/capture", tag: "sites", summary: "Stop a traffic capture and delete its recording", response: statusResponse{}},
+	{id: "downloadSiteCapture", method: "GET", path: "/v1/sites/{id}/capture/har", tag: "sites", summary: "The capture's recording as a HAR file",
+		query: []param{{"limit", "Newest entries to include (default and max 10000)"}}, response: file("application/json")},
+	{id: "getSiteCertDeployment", method: "GET", path: "/v1/sites/{id}/cert-deployment", tag: "sites", summary: "Latest check that nginx serves the site's current certificate on every local listener", response: nginx.DeployCheck{}},
+	{id: "promoteSiteCertificate", method: "POST", path: "/v1/sites/{id}/certificates/promote", tag: "sites", summary: "Re-issue a staging certificate from a production CA and switch the site to it",
+		query: []param{{"wait", "true to answer once the certificate is issued and served"}}, request: models.ACMEConfig{}, response: oneOf{promotionStarted{}, models.CertPromotion{}}, status: 202},
+	{id: "checkSiteCertDeployment", method: "POST", path: "/v1/sites/{id}/cert-deployment", tag: "sites", summary: "Check now that nginx serves the current certificate and HTTPS redirect over IPv4 and IPv6", response: nginx.DeployCheck{}},
+	{id: "checkSiteHSTSPreload", method: "GET", path: "/v1/sites/{id}/hsts-preload", tag: "sites", summary: "Check HSTS preload list requirements",
+		query: []param{{"status", "true to also read the domain's status from the preload list"}}, response: HSTSPreloadReport{}},
+	{id: "submitSiteHSTSPreload", method: "POST", path: "/v1/sites/{id}/hsts-preload", tag: "sites", summary: "Submit the domain to the HSTS preload list once every check passes", response: HSTSPreloadReport{}},
+
+	{id: "listStreams", method: "GET", path: "/v1/streams", tag: "streams", summary: "List streams", response: []models.Stream{}},
+	{id: "createStream", method: "POST", path: "/v1/streams", tag: "streams", summary: "Create a TCP/UDP stream",
+		query: []param{qCheckUpstream}, request: models.Stream{}, response: streamResponse{}, status: 201},
+	{id: "previewStream", method: "POST", path: "/v1/streams/preview", tag: "streams", summary: "Render a stream port's nginx config without applying it",
+		query: []param{qCheckUpstream}, request: models.Stream{}, response: PreviewResponse{}},
+	{id: "getStream", method: "GET", path: "/v1/streams/{id}", tag: "streams", summary: "Get a stream with its upstream health", response: streamResponse{}},
+	{id: "updateStream", method: "PATCH", path: "/v1/streams/{id}", tag: "streams", summary: "Update the given fields of a stream",
+		request: models.Stream{}, response: streamResponse{}},
+	{id: "deleteStream", method: "DELETE", path: "/v1/streams/{id}", tag: "streams", summary: "Delete a stream", response: statusResponse{}},
+	{id: "getStreamLogs", method: "GET", path: "/v1/streams/{id}/logs", tag: "logs", summary: "Read a stream's sessions with connection, byte and duration totals",
+		query: []param{qLimit, qSearch, qSince, qUntil}, response: StreamLogs{}},
+
+	{id: "getGroupUsage", method: "GET", path: "/v1/groups/{id}/usage", tag: "sites", summary: "Requests, bandwidth, sites, streams and certificates of a group over a billing period",
+		query: []param{{"month", "Billing month, YYYY-MM (default: the current month, UTC)"}, qSince, qUntil}, response: GroupUsage{}},
+	{id: "deleteGroup", method: "DELETE", path: "/v1/groups/{id}", tag: "sites", summary: "Delete every site and stream of a group, all or nothing", response: GroupDeleted{}},
+
+	{id: "listCertificates", method: "GET", path: "/v1/certificates", tag: "certificates", summary: "Certificates on disk and pre-issue jobs",
+		response: struct {
+			Certificates []certbot.CertInfo `json:"certificates"`
+			Preissue     []PreissueJob      `json:"preissue"`
+		}{}},
+	{id: "getCertificate", method: "GET", path: "/v1/certificates/{domain}", tag: "certificates", summary: "Get a certificate",
+		response: struct {
+			Domain      string            `json:"domain"`
+			Certificate *certbot.CertInfo `json:"certificate,omitempty"`
+			Preissue    *PreissueJob      `json:"preissue,omitempty"`
+		}{}},
+	{id: "precheckCertificate", method: "GET", path: "/v1/certificates/{domain}/precheck", tag: "certificates", summary: "Check CAA and DNS records before issuance",
+		query: []param{
+			{"challenge", "http-01 (default) or dns-01; AAAA records are only checked for http-01"},
+			{"alt_names", "Comma-separated additional names"},
+			{"acme_server", "ACME directory URL (default: the global one)"},
+		}, response: PrecheckResult{}},
+	{id: "verifyDomains", method: "POST", path: "/v1/tools/verify-domains", tag: "certificates", summary: "Pre-flight up to 500 domains before onboarding: where A/AAAA records point, ports 80/443, CAA and existing certificates",
+		request: VerifyDomainsRequest{}, response: VerifyDomainsResponse{}},
+	{id: "rotateCertificate", method: "POST", path: "/v1/certificates/{domain}/rotate", tag: "certificates", summary: "Re-issue a certificate with a new private key",
+		query: []param{{"revoke_previous", "true to revoke the replaced certificate (reason keyCompromise)"}}, response: RotateResult{}},
+	{id: "preissueCertificate", method: "POST", path: "/v1/certificates/preissue", tag: "certificates", summary: "Issue a certificate before its site exists",
+		request: struct {
+			Domain   string             `json:"domain"`
+			AltNames []string           `json:"alt_names,omitempty"`
+			ACME     *models.ACMEConfig `json:"acme,omitempty"`
+		}{},
+		response: PreissueJob{}, status: 202},
+
+	{id: "listTemplates", method: "GET", path: "/v1/templates", tag: "templates", summary: "List nginx snippet templates",
+		query: []param{{"content", "true to include each template's content"}}, response: []nginx.Template{}},
+	{id: "createTemplate", method: "POST", path: "/v1/templates", tag: "templates", summary: "Create a template",
+		request: struct {
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		}{}, response: TemplateResponse{}, status: 201},
+	{id: "listBuiltinTemplates", method: "GET", path: "/v1/templates/builtin", tag: "templates", summary: "List built-in template presets and their effect on an example site", response: []BuiltinTemplate{}},
+	{id: "getTemplate", method: "GET", path: "/v1/templates/{name}", tag: "templates", summary: "Get a template and the sites using it", response: TemplateResponse{}},
+	{id: "updateTemplate", method: "PUT", path: "/v1/templates/{name}", tag: "templates", summary: "Replace a template and re-render the sites using it",
+		request: struct {
+			Content string `json:"content"`
+		}{}, response: TemplateResponse{}},
+	{id: "deleteTemplate", method: "DELETE", path: "/v1/templates/{name}", tag: "templates", summary: "Delete a template that no site uses", response: statusResponse{}},
+
+	{id: "listDirectives", method: "GET", path: "/v1/reference/directives", tag: "templates", summary: "The nginx directives hubfly renders: context, module, description, documentation link and the site or stream fields that control each",
+		query:    []param{{"name", "Only this directive"}, {"resource", "site or stream"}, {"field", "Only directives controlled by this field or a field inside it, e.g. firewall or routes.retries"}},
+		response: []nginx.DirectiveDoc{}},
+
+	{id: "listLogFormats", method: "GET", path: "/v1/log-formats", tag: "logs", summary: "List registered access log formats", response: []models.LogFormat{}},
+	{id: "createLogFormat", method: "POST", path: "/v1/log-formats", tag: "logs", summary: "Register an access log format", request: models.LogFormat{}, response: LogFormatResponse{}, status: 201},
+	{id: "getLogFormat", method: "GET", path: "/v1/log-formats/{name}", tag: "logs", summary: "Get a log format and the sites using it", response: LogFormatResponse{}},
+	{id: "updateLogFormat", method: "PUT", path: "/v1/log-formats/{name}", tag: "logs", summary: "Replace a log format's fields and re-render the sites using it",
+		request: struct {
+			Fields []models.LogField `json:"fields"`
+		}{}, response: LogFormatResponse{}},
+	{id: "deleteLogFormat", method: "DELETE", path: "/v1/log-formats/{name}", tag: "logs", summary: "Delete a log format that no site uses", response: statusResponse{}},
+
+	{id: "listNodes", method: "GET", path: "/v1/nodes", tag: "nodes", summary: "Node agents reporting to this control plane", response: []NodeStatus{}},
+	{id: "getNode", method: "GET", path: "/v1/nodes/{id}", tag: "nodes", summary: "Get a node agent's status", response: NodeStatus{}},
+	{id: "deleteNode", method: "DELETE", path: "/v1/nodes/{id}", tag: "nodes", summary: "Forget a node until it reports again", response: statusResponse{}},
+	{id: "getNodeConfig", method: "GET", path: "/v1/nodes/{id}/config", tag: "nodes", summary: "Rendered configs for a node agent (304 with a current If-None-Match)", response: nginx.ConfigBundle{}},
+	{id: "reportNodeStatus", method: "POST", path: "/v1/nodes/{id}/status", tag: "nodes", summary: "Report a node agent's status", request: agent.Report{}, response: statusResponse{}},
+
+	{id: "listAPIKeys", method: "GET", path: "/v1/apikeys", tag: "apikeys", summary: "List API keys", response: []models.APIKey{}},
+	{id: "createAPIKey", method: "POST", path: "/v1/apikeys", tag: "apikeys", summary: "Create an API key; the token is only returned here",
+		request: keyInput{}, response: newKeyResponse{}, status: 201},
+	{id: "getAPIKey", method: "GET", path: "/v1/apikeys/{id}", tag: "apikeys", summary: "Get an API key", response: models.APIKey{}},
+	{id: "updateAPIKey", method: "PATCH", path: "/v1/apikeys/{id}", tag: "apikeys", summary: "Rename a key or change its role or expiry",
+		request: keyInput{}, response: models.APIKey{}},
+	{id: "deleteAPIKey", method: "DELETE", path: "/v1/apikeys/{id}", tag: "apikeys", summary: "Delete an API key", response: statusResponse{}},
+	{id: "rotateAPIKey", method: "POST", path: "/v1/apikeys/{id}/rotate", tag: "apikeys", summary: "Replace a key's secret, keeping its ID and role; the new token is only returned here",
+		request: KeyRotation{}, response: newKeyResponse{}},
+	{id: "exchangeBootstrapKey", method: "POST", path: "/v1/bootstrap", tag: "apikeys", summary: "Exchange a bootstrap key, once, for a regular key with its role",
+		request: BootstrapRequest{}, response: newKeyResponse{}, status: 201},
+	{id: "getAPIKeyUsage", method: "GET", path: "/v1/apikeys/{id}/usage", tag: "apikeys", summary: "Request counts for a key", response: KeyUsage{}},
+
+	{id: "listFaults", method: "GET", path: "/v1/debug/faults", tag: "debug", summary: "Armed faults and injection points", debug: true,
+		response: struct {
+			Faults []faults.Fault `json:"faults"`
+			Points []string       `json:"points"`
+		}{}},
+	{id: "armFault", method: "POST", path: "/v1/debug/faults", tag: "debug", summary: "Arm a fault", debug: true,
+		request: faults.Fault{}, response: []faults.Fault{}, status: 201},
+	{id: "clearFaults", method: "DELETE", path: "/v1/debug/faults", tag: "debug", summary: "Clear all faults", debug: true, response: statusResponse{}},
+	{id: "clearFault", method: "DELETE", path: "/v1/debug/faults/{point}", tag: "debug", summary: "Clear the faults at one point", debug: true, response: statusResponse{}},
+}
+
+// OpenAPI builds the OpenAPI 3 document for the API. Debug endpoints are
+// only included when chaos is set, matching Routes.
+func OpenAPI(version string, chaos bool) map[string]interface{} {
+	g := &schemaGen{components: map[string]interface{}{}, types: map[string]reflect.Type{}}
+	errSchema := g.schema(reflect.TypeOf(errorBody{}))
+
+	paths := map[string]interface{}{}
+	for _, op := range operations {
+		if op.debug && !chaos {
+			continue
+		}
+		item, _ := paths[op.path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = g.operation(op, errSchema)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Hubfly Reverse Proxy API",
+			"version":     version,
+			"description": "Sites, streams, certificates and logs of a Hubfly nginx instance.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// Open until the first key exists; see "Access Control" in the README.
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		},
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	jsonResponse(w, 200, OpenAPI(s.Version, s.Faults != nil))
+}
+
+func (g *schemaGen) operation(op operation, errSchema interface{}) map[string]interface{} {
+	var params []interface{}
+	for _, part := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params = append(params, map[string]interface{}{
+				"name": strings.Trim(part, "{}"), "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, q := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": q.name, "in": "query", "description": q.description,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+
+	status := op.status
+	if status == 0 {
+		status = 200
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch resp := op.response.(type) {
+	case sse:
+		success["content"] = map[string]interface{}{
+			"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+		}
+	case file:
+		success["content"] = map[string]interface{}{
+			string(resp): map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+		}
+	case oneOf:
+		var variants []interface{}
+		for _, v := range resp {
+			variants = append(variants, g.schema(reflect.TypeOf(v)))
+		}
+		success["content"] = jsonContent(map[string]interface{}{"oneOf": variants})
+	case nil:
+	default:
+		success["content"] = jsonContent(g.schema(reflect.TypeOf(resp)))
+	}
+
+	out := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            map[string]interface{}{"description": "Error", "content": jsonContent(errSchema)},
+		},
+	}
+	if params != nil {
+		out["parameters"] = params
+	}
+	if body, ok := op.request.(file); ok {
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				string(body): map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			},
+		}
+	} else if op.request != nil {
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(g.schema(reflect.TypeOf(op.request))),
+		}
+	}
+	return out
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaGen converts Go types to JSON schemas, following encoding/json
+// rules. Named structs become shared components. Fields are not marked
+// required: the same models serve as partial PATCH bodies.
+type schemaGen struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := g.componentName(t)
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = map[string]interface{}{} // Placeholder for recursive types
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{} // interface{}: any value
+}
+
+// object lists a struct's JSON properties, flattening embedded structs.
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	g.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+// componentName capitalises unexported type names (siteResponse) and
+// prefixes the package when two packages use the same type name.
+func (g *schemaGen) componentName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	name := string(r)
+	if other, ok := g.types[name]; ok && other != t {
+		pkg := []rune(path.Base(t.PkgPath()))
+		pkg[0] = unicode.ToUpper(pkg[0])
+		name = string(pkg) + name
+	}
+	g.types[name] = t
+	return name
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+// TestOpenAPIRoutes sends every documented operation to the router and
+// fails when it is not served: the mux's 404 or a handler's 405.
+func TestOpenAPIRoutes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "openapi_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	st, err := store.NewJSONStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm := nginx.NewManager(tmpDir)
+	if err := nm.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(st, nm, certbot.NewManager(filepath.Join(tmpDir, "www"), "test@example.com"), logmanager.NewManager(tmpDir))
+	srv.Faults = faults.NewInjector()
+	routes := srv.Routes()
+
+	// Streaming handlers return at once on a cancelled request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	seen := map[string]bool{}
+	for _, op := range operations {
+		key := op.method + " " + op.path
+		if seen[key] || seen[op.id] {
+			t.Errorf("Duplicate operation %s (%s)", key, op.id)
+		}
+		seen[key], seen[op.id] = true, true
+
+		var body *strings.Reader
+		if op.request != nil {
+			body = strings.NewReader("{") // Rejected before any side effect
+		} else {
+			body = strings.NewReader("")
+		}
+		req := httptest.NewRequest(op.method, param.ReplaceAllString(op.path, "missing"), body).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+
+		if rec.Code == http.StatusMethodNotAllowed ||
+			(rec.Code == http.StatusNotFound && strings.Contains(rec.Body.String(), "404 page not found")) {
+			t.Errorf("%s (%s) is documented but not served: %d %s", key, op.id, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := OpenAPI("test", false)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Document does not encode: %v", err)
+	}
+
+	if strings.Contains(string(data), "/v1/debug/") {
+		t.Errorf("Debug endpoints must only be documented in chaos mode")
+	}
+	if !strings.Contains(string(data), `"capacity":{"$ref":"#/components/schemas/Capacity"}`) {
+		t.Errorf("Site schema should reference the Capacity component")
+	}
+
+	// Every $ref resolves to a component.
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(data), -1) {
+		if _, ok := schemas[m[1]]; !ok {
+			t.Errorf("Dangling reference to %s", m[1])
+		}
+	}
+
+	// Embedded structs are flattened: a site response has the site's
+	// fields next to its warnings.
+	props := schemas["SiteResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, name := range []string{"domain", "upstreams", "warnings"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("SiteResponse missing property %s", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// overviewTTL is how long an overview is served from cache. Traffic reads
+// every site's access log, so polling dashboards share one aggregation.
+const (
+	overviewTTL          = 10 * time.Second
+	overviewWindow       = time.Minute
+	overviewCertsWarning = 14 * 24 * time.Hour
+)
+
+// Overview is the instance-wide snapshot served by GET /v1/overview.
+type Overview struct {
+	GeneratedAt   time.Time         `json:"generated_at"`
+	Sites         StatusCounts      `json:"sites"`
+	Streams       StatusCounts      `json:"streams"`
+	Traffic       OverviewTraffic   `json:"traffic"`
+	CertsExpiring []ExpiringCert    `json:"certs_expiring"` // Within 14 days, soonest first
+	LastReload    nginx.ReloadStats `json:"last_reload"`    // Always current
+}
+
+type StatusCounts struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"` // "active", "provisioning", "error", ...
+}
+
+// OverviewTraffic sums every site's access log over the last minute.
+type OverviewTraffic struct {
+	WindowSeconds     int     `json:"window_seconds"`
+	Requests          int     `json:"requests"`
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	ErrorRate         float64 `json:"error_rate"` // Share of 5xx responses
+	Truncated         bool    `json:"truncated,omitempty"`
+}
+
+type ExpiringCert struct {
+	Name     string    `json:"name"` // Lineage
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
+type overviewCache struct {
+	mu     sync.Mutex
+	latest *Overview
+}
+
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	now := time.Now()
+	ov := s.snapshot(now)
+	ov.LastReload = s.Nginx.ReloadStats()
+	fresh := overviewTTL - now.Sub(ov.GeneratedAt)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(fresh.Seconds())))
+	jsonResponse(w, 200, ov)
+}
+
+// snapshot returns the cached snapshot, aggregating a new one once it is
+// older than overviewTTL. Concurrent callers wait for the same one.
+func (s *Server) snapshot(now time.Time) Overview {
+	s.overview.mu.Lock()
+	defer s.overview.mu.Unlock()
+	if ov := s.overview.latest; ov != nil && now.Sub(ov.GeneratedAt) < overviewTTL {
+		return *ov
+	}
+
+	ov := &Overview{
+		GeneratedAt:   now,
+		Sites:         StatusCounts{ByStatus: map[string]int{}},
+		Streams:       StatusCounts{ByStatus: map[string]int{}},
+		Traffic:       OverviewTraffic{WindowSeconds: int(overviewWindow.Seconds())},
+		CertsExpiring: []ExpiringCert{},
+	}
+	var errors int
+	if sites, err := s.Store.ListSites(); err == nil {
+		for i := range sites {
+			site := &sites[i]
+			ov.Sites.Total++
+			ov.Sites.ByStatus[site.Status]++
+
+			tr := s.siteTrafficWindow(site, now, overviewWindow)
+			ov.Traffic.Requests += tr.Requests
+			ov.Traffic.Truncated = ov.Traffic.Truncated || tr.Truncated
+			errors += tr.Statuses["5xx"]
+		}
+	}
+	if ov.Traffic.Requests > 0 {
+		ov.Traffic.RequestsPerMinute = float64(ov.Traffic.Requests) / overviewWindow.Minutes()
+		ov.Traffic.ErrorRate = float64(errors) / float64(ov.Traffic.Requests)
+	}
+	if streams, err := s.Store.ListStreams(); err == nil {
+		for _, stream := range streams {
+			ov.Streams.Total++
+			ov.Streams.ByStatus[stream.Status]++
+		}
+	}
+	if certs, err := s.Certbot.ListCertificates(); err == nil {
+		for _, c := range certs {
+			if c.NotAfter.Sub(now) > overviewCertsWarning {
+				continue
+			}
+			ov.CertsExpiring = append(ov.CertsExpiring, ExpiringCert{
+				Name:     c.Domain,
+				NotAfter: c.NotAfter,
+				DaysLeft: int(c.NotAfter.Sub(now).Hours() / 24),
+			})
+		}
+		sort.Slice(ov.CertsExpiring, func(i, j int) bool {
+			return ov.CertsExpiring[i].NotAfter.Before(ov.CertsExpiring[j].NotAfter)
+		})
+	}
+
+	s.overview.latest = ov
+	return *ov
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Ports new streams are assigned from when they don't ask for one.
+const (
+	streamPortMin = 30000
+	streamPortMax = 30100
+)
+
+// PortRegistry knows the ports nginx and hubfly listen on themselves, which
+// a stream would break nginx's reload by taking, and assigns free ports to
+// new streams.
+type PortRegistry struct {
+	// Reserved maps ports to what listens on them.
+	Reserved map[int]string
+	// CheckHost also refuses ports that another process already listens
+	// on. Listeners of existing streams with the same protocol and bind
+	// address are skipped, as nginx holds them.
+	CheckHost bool
+
+	// Test hook replacing the bind probe.
+	probe func(network, addr string) error
+}
+
+// NewPortRegistry reserves the listeners of the bundled nginx.conf: the
+// sites on 80 and 443 (TCP, and UDP for HTTP/3), the management UI on
+// 82, stub_status on 8081 and the GoAccess websocket on 7890.
+func NewPortRegistry() *PortRegistry {
+	return &PortRegistry{Reserved: map[int]string{
+		80:   "HTTP sites",
+		443:  "HTTPS and HTTP/3 sites",
+		82:   "the management UI",
+		8081: "nginx stub_status",
+		7890: "the GoAccess websocket",
+	}}
+}
+
+// Reserve marks a port as taken by owner.
+func (p *PortRegistry) Reserve(port int, owner string) {
+	p.Reserved[port] = owner
+}
+
+// ReserveAddr reserves the port of a listen address such as ":81".
+func (p *PortRegistry) ReserveAddr(addr, owner string) error {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port in %q", addr)
+	}
+	p.Reserve(port, owner)
+	return nil
+}
+
+// Check reports why a stream can't listen on its port. existing is the
+// current set of streams, including the stream's previous version.
+func (p *PortRegistry) Check(stream *models.Stream, existing []models.Stream) error {
+	port := stream.ListenPort
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("listen_port must be between 1 and 65535")
+	}
+	if owner, ok := p.Reserved[port]; ok {
+		return fmt.Errorf("port %d is used by %s", port, owner)
+	}
+	if !p.CheckHost || streamListening(stream, existing) {
+		return nil
+	}
+	if err := p.bind(stream.Protocol, net.JoinHostPort(stream.BindAddress, strconv.Itoa(port))); err != nil {
+		return fmt.Errorf("port %d is already in use on the host", port)
+	}
+	return nil
+}
+
+// Allocate picks a free port for a new stream, at random so concurrent
+// requests rarely collide.
+func (p *PortRegistry) Allocate(stream *models.Stream, existing []models.Stream) (int, error) {
+	var candidates []int
+	for port := streamPortMin; port <= streamPortMax; port++ {
+		if streamPortInUse(port, existing) {
+			continue
+		}
+		candidate := *stream
+		candidate.ListenPort = port
+		if p.Check(&candidate, existing) == nil {
+			candidates = append(candidates, port)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, fmt.Errorf("no available ports in range %d-%d", streamPortMin, streamPortMax)
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+func streamPortInUse(port int, streams []models.Stream) bool {
+	for _, s := range streams {
+		if s.ListenPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+// streamListening reports whether one of streams already has nginx listen
+// where stream wants to.
+func streamListening(stream *models.Stream, streams []models.Stream) bool {
+	for _, s := range streams {
+		if s.ListenPort == stream.ListenPort && streamNetwork(s.Protocol) == streamNetwork(stream.Protocol) &&
+			s.BindAddress == stream.BindAddress {
+			return true
+		}
+	}
+	return false
+}
+
+func streamNetwork(protocol string) string {
+	if protocol == "udp" {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// bind reports whether addr is taken by trying to listen on it. Errors
+// other than the address being in use, such as missing privileges for a
+// low port, don't count: nginx may still be allowed to bind it.
+func (p *PortRegistry) bind(protocol, addr string) error {
+	network := streamNetwork(protocol)
+	var err error
+	if p.probe != nil {
+		err = p.probe(network, addr)
+	} else if network == "udp" {
+		var conn net.PacketConn
+		if conn, err = net.ListenPacket(network, addr); err == nil {
+			conn.Close()
+		}
+	} else {
+		var l net.Listener
+		if l, err = net.Listen(network, addr); err == nil {
+			l.Close()
+		}
+	}
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+	return nil
+}
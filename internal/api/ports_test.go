@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// probeHost returns a registry whose bind probe reports the listed
+// "network addr" pairs as in use, and records every probe.
+func probeHost(inUse ...string) (*PortRegistry, *[]string) {
+	var probed []string
+	p := NewPortRegistry()
+	p.CheckHost = true
+	p.probe = func(network, addr string) error {
+		probed = append(probed, network+" "+addr)
+		for _, u := range inUse {
+			if u == network+" "+addr {
+				return syscall.EADDRINUSE
+			}
+		}
+		return nil
+	}
+	return p, &probed
+}
+
+func TestPortCheck(t *testing.T) {
+	existing := []models.Stream{
+		{ID: "db", ListenPort: 30001, Protocol: "tcp"},
+		{ID: "dns", ListenPort: 30002, Protocol: "udp", BindAddress: "10.0.0.5"},
+	}
+	tests := []struct {
+		name   string
+		stream models.Stream
+		inUse  []string
+		probe  string // expected probe, "" for none
+		ok     bool
+	}{
+		{"out of range", models.Stream{ListenPort: 70000}, nil, "", false},
+		{"reserved", models.Stream{ListenPort: 443}, nil, "", false},
+		{"free", models.Stream{ListenPort: 30010}, nil, "tcp :30010", true},
+		{"taken on the host", models.Stream{ListenPort: 30010}, []string{"tcp :30010"}, "tcp :30010", false},
+		{"udp probe", models.Stream{ListenPort: 30010, Protocol: "udp"}, []string{"tcp :30010"}, "udp :30010", true},
+		{"bind address probe", models.Stream{ListenPort: 30010, BindAddress: "fd00::5"}, nil, "tcp [fd00::5]:30010", true},
+		{"nginx holds the listener", models.Stream{ListenPort: 30001}, []string{"tcp :30001"}, "", true},
+		{"default protocol is tcp", models.Stream{ListenPort: 30001, Protocol: ""}, []string{"tcp :30001"}, "", true},
+		{"other protocol on a stream port", models.Stream{ListenPort: 30001, Protocol: "udp"}, []string{"udp :30001"}, "udp :30001", false},
+		{"other address on a stream port", models.Stream{ListenPort: 30002, Protocol: "udp"}, []string{"udp :30002"}, "udp :30002", false},
+		{"same address on a stream port", models.Stream{ListenPort: 30002, Protocol: "udp", BindAddress: "10.0.0.5"}, []string{"udp 10.0.0.5:30002"}, "", true},
+	}
+	for _, tt := range tests {
+		p, probed := probeHost(tt.inUse...)
+		err := p.Check(&tt.stream, existing)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok=%v", tt.name, err, tt.ok)
+		}
+		var want []string
+		if tt.probe != "" {
+			want = []string{tt.probe}
+		}
+		if fmt.Sprint(*probed) != fmt.Sprint(want) {
+			t.Errorf("%s: probed %v, want %v", tt.name, *probed, want)
+		}
+	}
+}
+
+func TestPortCheckProbeErrors(t *testing.T) {
+	p := NewPortRegistry()
+	p.probe = func(network, addr string) error { return syscall.EADDRINUSE }
+	if err := p.Check(&models.Stream{ListenPort: 30010}, nil); err != nil {
+		t.Errorf("Host ports are only probed with CheckHost: %v", err)
+	}
+
+	// Failing to bind for other reasons, like privileges, isn't a conflict
+	p.CheckHost = true
+	p.probe = func(network, addr string) error { return syscall.EACCES }
+	if err := p.Check(&models.Stream{ListenPort: 30010}, nil); err != nil {
+		t.Errorf("EACCES counted as in use: %v", err)
+	}
+}
+
+func TestPortAllocate(t *testing.T) {
+	var existing []models.Stream
+	var inUse []string
+	for port := streamPortMin; port <= streamPortMax; port++ {
+		switch {
+		case port == streamPortMin+7:
+		case port%2 == 0:
+			existing = append(existing, models.Stream{ListenPort: port, Protocol: "udp"})
+		default:
+			inUse = append(inUse, fmt.Sprintf("tcp :%d", port))
+		}
+	}
+	p, _ := probeHost(inUse...)
+	port, err := p.Allocate(&models.Stream{Protocol: "tcp"}, existing)
+	if err != nil || port != streamPortMin+7 {
+		t.Fatalf("Allocate = %d, %v; want %d", port, err, streamPortMin+7)
+	}
+
+	// Ports of streams aren't handed out again, whatever the protocol
+	existing = append(existing, models.Stream{ListenPort: port, Protocol: "udp"})
+	if port, err := p.Allocate(&models.Stream{Protocol: "tcp"}, existing); err == nil {
+		t.Errorf("Expected no free port, got %d", port)
+	}
+
+	p.Reserve(streamPortMin+7, "something")
+	if _, err := p.Allocate(&models.Stream{}, existing[:len(existing)-1]); err == nil {
+		t.Error("Allocate returned a reserved port")
+	}
+}
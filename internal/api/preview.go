@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// PreviewResponse is the config a site or stream payload would produce.
+type PreviewResponse struct {
+	File     string              `json:"file"` // Where the config would be written
+	Config   string              `json:"config"`
+	Changed  bool                `json:"changed"` // Differs from the live file, or there is none yet
+	Warnings []nginx.LintWarning `json:"warnings,omitempty"`
+}
+
+func previewResponse(file string, config []byte, warnings []nginx.LintWarning) PreviewResponse {
+	live, err := os.ReadFile(file)
+	return PreviewResponse{
+		File:     file,
+		Config:   string(config),
+		Changed:  err != nil || !bytes.Equal(live, config),
+		Warnings: warnings,
+	}
+}
+
+// handleSitePreview serves POST /v1/sites/preview: the submitted site goes
+// through the same checks as a create and is rendered, but nothing is saved
+// or applied. Submitting an existing site's ID previews an update.
+func (s *Server) handleSitePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	var site models.Site
+	if err := json.NewDecoder(r.Body).Decode(&site); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if err := normalizeSiteNames(&site); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	if site.ID == "" {
+		id, err := defaultSiteID(&site)
+		if err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		site.ID = id
+	}
+	if err := s.validateWildcard(&site); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	if err := s.validateSiteRules(&site); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	if err := s.checkSiteLogFormat(&site); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	if err := s.checkServerNames(&site); err != nil {
+		errorResponse(w, 409, err.Error())
+		return
+	}
+
+	config, err := s.Nginx.Render(&site)
+	if err != nil {
+		errorResponse(w, 400, "render failed: "+err.Error())
+		return
+	}
+	warnings := s.lintSite(&site)
+	if wantUpstreamCheck(r) {
+		warnings = append(warnings, s.checkSiteUpstreams(&site)...)
+	}
+	jsonResponse(w, 200, previewResponse(s.Nginx.SiteConfigFile(site.ID), config, warnings))
+}
+
+// handleStreamPreview serves POST /v1/streams/preview. A stream shares its
+// port's config with the other streams on it, so the whole port is
+// rendered with the submitted stream added or replaced.
+func (s *Server) handleStreamPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	var stream models.Stream
+	if err := json.NewDecoder(r.Body).Decode(&stream); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if stream.ListenPort == 0 {
+		errorResponse(w, 400, "listen_port is required for a preview")
+		return
+	}
+	if stream.ID == "" {
+		stream.ID = fmt.Sprintf("stream-%d", stream.ListenPort)
+	}
+	if stream.Protocol == "" {
+		stream.Protocol = "tcp"
+	}
+	if err := normalizeStreamNames(&stream); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+
+	existing, err := s.Store.ListStreams()
+	if err != nil {
+		errorResponse(w, 500, "failed to list streams: "+err.Error())
+		return
+	}
+	if err := s.validateStream(&stream, existing); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+
+	// Keep the store's order so an unchanged stream previews as unchanged.
+	var portStreams []models.Stream
+	added := false
+	for _, other := range existing {
+		if other.ID == stream.ID {
+			other, added = stream, true
+		}
+		if other.ListenPort == stream.ListenPort {
+			portStreams = append(portStreams, other)
+		}
+	}
+	if !added {
+		portStreams = append(portStreams, stream)
+	}
+
+	config, err := s.Nginx.RenderStreamConfig(stream.ListenPort, portStreams)
+	if err != nil {
+		errorResponse(w, 400, "render failed: "+err.Error())
+		return
+	}
+	var warnings []nginx.LintWarning
+	if wantUpstreamCheck(r) {
+		warnings = s.checkStreamUpstream(&stream)
+	}
+	jsonResponse(w, 200, previewResponse(s.Nginx.StreamConfigFile(stream.ListenPort), config, warnings))
+}
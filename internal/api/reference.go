@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// handleDirectives lists the nginx directives hubfly renders, for inline
+// help in dashboards. A field filter matches the field and what it holds, so
+// field=firewall also returns the directives of firewall.rate_limit.
+func (s *Server) handleDirectives(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	q := r.URL.Query()
+	name, resource, field := q.Get("name"), q.Get("resource"), q.Get("field")
+	if resource != "" && resource != "site" && resource != "stream" {
+		errorResponse(w, 400, "resource must be site or stream")
+		return
+	}
+
+	docs := []nginx.DirectiveDoc{}
+	for _, d := range nginx.Directives() {
+		if (name != "" && d.Name != name) || (resource != "" && d.Resource != resource) {
+			continue
+		}
+		if field != "" && !controlledBy(d, field) {
+			continue
+		}
+		docs = append(docs, d)
+	}
+	jsonResponse(w, 200, docs)
+}
+
+// controlledBy reports whether field, or a field inside it, controls d.
+func controlledBy(d nginx.DirectiveDoc, field string) bool {
+	for _, f := range d.Fields {
+		if f == field || strings.HasPrefix(f, field+".") {
+			return true
+		}
+	}
+	return false
+}
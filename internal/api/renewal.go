@@ -0,0 +1,133 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// StartCertRenewal checks certificates every interval and renews those
+// expiring within before, or whose key is older than the rotation policy
+// allows. A zero interval disables renewal. Standbys skip it: certificates
+// are issued and renewed on the primary.
+func (s *Server) StartCertRenewal(interval, before time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	sched := &certbot.Scheduler{
+		Manager:     s.Certbot,
+		Interval:    interval,
+		Before:      before,
+		RotateAfter: s.keyRotation,
+		Skip:        s.readOnly.Load,
+		OnResults:   func(results []certbot.RenewResult) { s.applyRenewals(results, "") },
+	}
+	sched.Start()
+}
+
+// keyRotation is the maximum key age of a lineage: the shortest
+// key_rotation_days of the SSL sites serving it, or the global policy.
+func (s *Server) keyRotation(lineage string) time.Duration {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		return 0
+	}
+	var rotation time.Duration
+	for _, site := range sites {
+		if !site.SSL || site.CertName() != lineage {
+			continue
+		}
+		d := s.KeyRotation
+		if site.KeyRotationDays > 0 {
+			d = time.Duration(site.KeyRotationDays) * 24 * time.Hour
+		}
+		if d > 0 && (rotation == 0 || d < rotation) {
+			rotation = d
+		}
+	}
+	return rotation
+}
+
+// applyRenewals reloads nginx when a certificate changed on disk, records
+// the new status and expiry on every site serving the lineage and checks
+// that the renewed certificates are being served.
+// who is the API key behind an on-demand rotation, empty for the
+// scheduler.
+func (s *Server) applyRenewals(results []certbot.RenewResult, who string) {
+	byLineage := make(map[string]certbot.RenewResult, len(results))
+	renewed := false
+	for _, res := range results {
+		byLineage[res.Lineage] = res
+		if res.Renewed {
+			renewed = true
+		}
+		if res.Renewed || res.Err != nil {
+			event := audit.Event{
+				Action:     "certificate.renewed",
+				Resource:   "certificate",
+				ResourceID: res.Lineage,
+				Actor:      who,
+				Details:    map[string]interface{}{"not_after": res.NotAfter},
+			}
+			if res.NewKey {
+				event.Action = "certificate.key_rotated"
+			}
+			if res.Err != nil {
+				event.Action = "certificate.renew_failed"
+				if res.NewKey {
+					event.Action = "certificate.key_rotation_failed"
+				}
+				event.Details["error"] = res.Err.Error()
+			}
+			s.Audit.Record(event)
+		}
+	}
+
+	// nginx only picks up renewed files on reload.
+	if renewed {
+		if err := s.Nginx.Reload(); err != nil {
+			slog.Error("Renewal: nginx reload failed", "error", err)
+		}
+	}
+
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Renewal: failed to list sites", "error", err)
+		return
+	}
+	var deployed []models.Site
+	for i := range sites {
+		site := &sites[i]
+		res, ok := byLineage[site.CertName()]
+		if !site.SSL || !ok {
+			continue
+		}
+		if res.Renewed {
+			deployed = append(deployed, *site)
+		}
+		status := "valid"
+		if res.Err != nil {
+			status = "renew-failed"
+		}
+		if site.CertIssueStatus == status && site.CertExpiresAt != nil && site.CertExpiresAt.Equal(res.NotAfter) {
+			continue
+		}
+		site.CertIssueStatus = status
+		site.CertExpiresAt = &res.NotAfter
+		if err := s.Store.SaveSite(site); err != nil {
+			slog.Error("Renewal: failed to save site", "site_id", site.ID, "error", err)
+		}
+	}
+	go s.checkCertDeployments(deployed)
+}
+
+// markCertValid records a freshly attached certificate and its expiry.
+func (s *Server) markCertValid(site *models.Site) {
+	site.CertIssueStatus = "valid"
+	if info, err := s.Certbot.Certificate(site.CertName()); err == nil {
+		site.CertExpiresAt = &info.NotAfter
+	}
+}
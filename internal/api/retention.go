@@ -0,0 +1,179 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+)
+
+// handleSiteLogsPurge serves DELETE /v1/sites/{id}/logs.
+//
+// Query parameters:
+//   - type: access, error, audit or all (default all)
+//   - older_than: Go duration (e.g. 720h); purges everything before now-older_than
+//   - since / until: RFC3339 bounds of the range to purge
+func (s *Server) handleSiteLogsPurge(w http.ResponseWriter, r *http.Request, siteID string) {
+	if _, err := s.Store.GetSite(siteID); err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	q := r.URL.Query()
+	types := logmanager.LogTypes
+	if t := q.Get("type"); t != "" && t != "all" {
+		if !validLogType(t) {
+			errorResponse(w, 400, "invalid type: must be access, error, audit, or all")
+			return
+		}
+		types = []string{t}
+	}
+
+	var since, until time.Time
+	var err error
+	if v := q.Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			errorResponse(w, 400, "invalid since: "+err.Error())
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			errorResponse(w, 400, "invalid until: "+err.Error())
+			return
+		}
+	}
+	if v := q.Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errorResponse(w, 400, "invalid older_than: must be a positive duration such as 720h")
+			return
+		}
+		until = time.Now().Add(-d)
+	}
+	if since.IsZero() && until.IsZero() {
+		errorResponse(w, 400, "a range is required: set older_than, since, or until")
+		return
+	}
+
+	removed, err := s.purgeSiteLogs(siteID, types, since, until, "api", actor(r))
+	if err != nil {
+		errorResponse(w, 500, "failed to purge logs: "+err.Error())
+		return
+	}
+	jsonResponse(w, 200, map[string]interface{}{"status": "purged", "removed": removed})
+}
+
+// purgeSiteLogs purges the given log types and records an audit event when
+// anything was removed.
+func (s *Server) purgeSiteLogs(siteID string, types []string, since, until time.Time, reason, actor string) (map[string]int, error) {
+	removed := make(map[string]int, len(types))
+	total := 0
+	for _, t := range types {
+		n, err := s.LogManager.PurgeLogs(siteID, t, since, until)
+		if err != nil {
+			return removed, err
+		}
+		removed[t] = n
+		total += n
+	}
+
+	if total > 0 {
+		details := map[string]interface{}{"removed": removed, "reason": reason}
+		if !since.IsZero() {
+			details["since"] = since
+		}
+		if !until.IsZero() {
+			details["until"] = until
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "logs.purged",
+			Resource:   "site",
+			ResourceID: siteID,
+			Actor:      actor,
+			Details:    details,
+		})
+		slog.Info("Purged site logs", "site_id", siteID, "reason", reason, "removed", removed)
+	}
+	return removed, nil
+}
+
+// StartLogRetention periodically purges site logs older than the site's
+// LogRetentionDays, falling back to the global retention. A zero global
+// retention only applies per-site policies.
+func (s *Server) StartLogRetention(global time.Duration, interval time.Duration) {
+	s.LogRetention = global
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.enforceLogRetention()
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *Server) enforceLogRetention() {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Log retention: failed to list sites", "error", err)
+		return
+	}
+
+	for _, site := range sites {
+		retention := s.LogRetention
+		if site.LogRetentionDays > 0 {
+			retention = time.Duration(site.LogRetentionDays) * 24 * time.Hour
+		}
+		if retention <= 0 {
+			continue
+		}
+
+		cutoff := time.Now().Add(-retention)
+		if _, err := s.purgeSiteLogs(site.ID, logmanager.LogTypes, time.Time{}, cutoff, "retention", ""); err != nil {
+			slog.Error("Log retention purge failed", "site_id", site.ID, "error", err)
+		}
+	}
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Resource:   q.Get("resource"),
+		ResourceID: q.Get("resource_id"),
+		Action:     q.Get("action"),
+		Limit:      100,
+	}
+	if v := q.Get("limit"); v != "" {
+		if l, err := strconv.Atoi(v); err == nil {
+			filter.Limit = l
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		filter.Since, _ = time.Parse(time.RFC3339, v)
+	}
+
+	events, err := s.Audit.List(filter)
+	if err != nil {
+		errorResponse(w, 500, "failed to read audit log: "+err.Error())
+		return
+	}
+	jsonResponse(w, 200, events)
+}
+
+func validLogType(t string) bool {
+	for _, v := range logmanager.LogTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/dnscheck"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// runtimeWindow is how far back the access log is read for traffic rates,
+// and runtimeMaxEntries caps how much of it, so a busy site stays cheap.
+const (
+	runtimeWindow     = 5 * time.Minute
+	runtimeMaxEntries = 20000
+)
+
+// SiteRuntime is everything the dashboard's site page shows live, in one
+// response.
+type SiteRuntime struct {
+	SiteID          string            `json:"site_id"`
+	Status          string            `json:"status"`
+	ErrorMessage    string            `json:"error_message,omitempty"`
+	Nginx           *nginx.StubStatus `json:"nginx,omitempty"` // Server-wide
+	NginxError      string            `json:"nginx_error,omitempty"`
+	UpstreamHealth  []health.Stats    `json:"upstream_health"`
+	DownUpstreams   []string          `json:"down_upstreams,omitempty"`
+	Draining        []string          `json:"draining_upstreams,omitempty"`
+	UpstreamDNS     []dnscheck.Result `json:"upstream_dns"` // Hostnames via the system resolver and DoH
+	Traffic         TrafficRates      `json:"traffic"`
+	Certificate     *CertRuntime      `json:"certificate,omitempty"`
+	ConfigAppliedAt *time.Time        `json:"config_applied_at,omitempty"`
+	LastReload      nginx.ReloadStats `json:"last_reload"`
+}
+
+// TrafficRates are computed from the most recent access log entries.
+type TrafficRates struct {
+	WindowSeconds     int            `json:"window_seconds"`
+	Requests          int            `json:"requests"`
+	RequestsPerSecond float64        `json:"requests_per_second"`
+	Statuses          map[string]int `json:"statuses"`   // "2xx", "4xx", ...
+	ErrorRate         float64        `json:"error_rate"` // Share of 5xx responses
+	AvgRequestTime    float64        `json:"avg_request_time_seconds"`
+	Truncated         bool           `json:"truncated,omitempty"` // Window shortened to the newest entries
+	Error             string         `json:"error,omitempty"`
+}
+
+// CertRuntime is the certificate the site serves.
+type CertRuntime struct {
+	Name     string    `json:"name"` // Lineage
+	Issuer   string    `json:"issuer,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	DaysLeft int       `json:"days_left"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// handleSiteRuntime serves GET /v1/sites/{id}/runtime. Sources that fail
+// are reported in their own error field rather than failing the request.
+func (s *Server) handleSiteRuntime(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	rt := SiteRuntime{
+		SiteID:         site.ID,
+		Status:         site.Status,
+		ErrorMessage:   site.ErrorMessage,
+		UpstreamHealth: s.siteHealth(site),
+		DownUpstreams:  site.DownUpstreams,
+		Draining:       drainAddresses(site.DrainingUpstreams),
+		Traffic:        s.siteTraffic(site, time.Now()),
+		Certificate:    s.siteCertRuntime(site),
+		LastReload:     s.Nginx.ReloadStats(),
+	}
+	if rt.UpstreamHealth == nil {
+		rt.UpstreamHealth = []health.Stats{}
+	}
+	rt.UpstreamDNS = s.DNS.Check(r.Context(), siteUpstreamHosts(site))
+	if rt.Nginx, err = s.Nginx.StubStatus(r.Context()); err != nil {
+		rt.NginxError = err.Error()
+	}
+	if fi, err := os.Stat(s.Nginx.SiteConfigFile(site.ID)); err == nil {
+		t := fi.ModTime()
+		rt.ConfigAppliedAt = &t
+	}
+	jsonResponse(w, 200, rt)
+}
+
+// siteTraffic summarizes the access log over the runtimeWindow before now.
+func (s *Server) siteTraffic(site *models.Site, now time.Time) TrafficRates {
+	return s.siteTrafficWindow(site, now, runtimeWindow)
+}
+
+func (s *Server) siteTrafficWindow(site *models.Site, now time.Time, window time.Duration) TrafficRates {
+	since := now.Add(-window)
+	tr := TrafficRates{WindowSeconds: int(window.Seconds()), Statuses: map[string]int{}}
+	entries, err := s.LogManager.GetAccessLogs(site.ID, logmanager.LogOptions{Since: since, Limit: runtimeMaxEntries, Format: s.siteLogFormat(site)})
+	if err != nil && !os.IsNotExist(err) {
+		tr.Error = err.Error()
+		return tr
+	}
+	if len(entries) == runtimeMaxEntries {
+		// Entries are newest first; the cap cut the window short.
+		since = entries[len(entries)-1].TimeLocal
+		tr.Truncated = true
+	}
+
+	var errors int
+	var requestTime float64
+	for _, e := range entries {
+		tr.Requests++
+		if e.Status > 0 {
+			tr.Statuses[strconv.Itoa(e.Status/100)+"xx"]++
+		}
+		if e.Status >= 500 {
+			errors++
+		}
+		requestTime += e.RequestTime
+	}
+	if tr.Requests == 0 {
+		return tr
+	}
+	if secs := now.Sub(since).Seconds(); secs > 0 {
+		tr.RequestsPerSecond = float64(tr.Requests) / secs
+	}
+	tr.ErrorRate = float64(errors) / float64(tr.Requests)
+	tr.AvgRequestTime = requestTime / float64(tr.Requests)
+	return tr
+}
+
+// siteCertRuntime reads the certificate of an SSL site, nil otherwise.
+func (s *Server) siteCertRuntime(site *models.Site) *CertRuntime {
+	if !site.SSL {
+		return nil
+	}
+	cr := &CertRuntime{Name: site.CertName()}
+	info, err := s.Certbot.Certificate(cr.Name)
+	if err != nil {
+		cr.Error = err.Error()
+		return cr
+	}
+	cr.Issuer = info.Issuer
+	cr.NotAfter = info.NotAfter
+	cr.DaysLeft = int(time.Until(info.NotAfter).Hours() / 24)
+	return cr
+}
+
+// siteUpstreamHosts lists the hostnames a site's traffic is proxied to.
+func siteUpstreamHosts(site *models.Site) []string {
+	upstreams := append([]string{}, site.Upstreams...)
+	if site.CanaryRelease != nil {
+		upstreams = append(upstreams, site.CanaryRelease.Upstream)
+	}
+	if site.TrafficMirror != nil {
+		upstreams = append(upstreams, site.TrafficMirror.Upstream)
+	}
+	return dnscheck.Hosts(upstreams...)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// SecurityReport is served by GET /v1/security/findings.
+type SecurityReport struct {
+	Total      int              `json:"total"`
+	BySeverity map[string]int   `json:"by_severity"`
+	Findings   []SecurityResult `json:"findings"`
+}
+
+// SecurityResult is a finding, with the site whose config it is in.
+type SecurityResult struct {
+	SiteID string `json:"site_id,omitempty"` // Empty for nginx.conf and unmanaged files
+	nginx.SecurityFinding
+}
+
+// handleFindings runs the security checks on the live configs;
+// ?site= keeps one site's findings.
+func (s *Server) handleFindings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	findings, err := s.Nginx.ScanSecurity()
+	if err != nil {
+		errorResponse(w, 500, "failed to scan nginx configs: "+err.Error())
+		return
+	}
+
+	managed := make(map[string]string, len(sites))
+	for _, site := range sites {
+		managed[s.Nginx.SiteConfigFile(site.ID)] = site.ID
+	}
+	report := SecurityReport{BySeverity: map[string]int{}, Findings: []SecurityResult{}}
+	site := r.URL.Query().Get("site")
+	for _, f := range findings {
+		if site != "" && managed[f.File] != site {
+			continue
+		}
+		report.Findings = append(report.Findings, SecurityResult{SiteID: managed[f.File], SecurityFinding: f})
+		report.BySeverity[f.Severity]++
+	}
+	report.Total = len(report.Findings)
+	jsonResponse(w, 200, report)
+}
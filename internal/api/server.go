@@ -6,17 +6,28 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"math/rand"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/dnscheck"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/hsts"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/idn"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/jwtgate"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/notify"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/synthetic"
 )
 
 type Server struct {
@@ -24,26 +35,157 @@ type Server struct {
 	Nginx      *nginx.Manager
 	Certbot    *certbot.Manager
 	LogManager *logmanager.Manager
+	Audit      *audit.Logger
+
+	// Watch is Store's change feed for GET /v1/watch; NewServer wraps the
+	// store with it.
+	Watch *store.WatchStore
+
+	// LogRetention is the global log retention; sites may override it.
+	LogRetention time.Duration
+
+	// KeyRotation is the global maximum certificate key age (0 = never
+	// rotate on a schedule); sites may override it.
+	KeyRotation time.Duration
+
+	// AdminToken is a static full-admin credential, used to bootstrap API
+	// keys. When empty the API is open until the first key is created.
+	AdminToken string
+
+	// Health holds upstream probe results from health checks and the
+	// adaptive balancer.
+	Health *health.Tracker
+
+	// HSTS checks sites against the HSTS preload list requirements.
+	HSTS *hsts.Checker
+
+	// JWT validates tokens for sites with a jwt_gate, on nginx's behalf.
+	JWT *jwtgate.Verifier
+
+	// DNS resolves upstream hostnames for the runtime view.
+	DNS *dnscheck.Checker
+
+	// Ports keeps streams off the ports nginx and hubfly listen on.
+	Ports *PortRegistry
+
+	// Synthetics stores synthetic check results, which are sent to
+	// SyntheticTarget.
+	Synthetics      *synthetic.Recorder
+	SyntheticTarget synthetic.Target
+
+	// AuditRetention is what scheduled maintenance keeps of the audit
+	// trail, see StartMaintenance.
+	AuditRetention audit.Retention
+
+	// Notify delivers alerts, such as a synthetic check going down.
+	Notify *notify.Notifier
+
+	// Faults is set in chaos mode only and enables /v1/debug/faults.
+	Faults *faults.Injector
+
+	// ControlPlane enables /v1/nodes, from which node agents pull the
+	// rendered configs.
+	ControlPlane bool
+
+	// Version is the hubfly build version reported by /v1/system.
+	Version string
+	started time.Time
+
+	readOnly atomic.Bool
+	mirror   *mirrorState
+	weights  weightHistory
+	usage    usageTracker
+	conns    connStats
+	preissue preissueJobs
+	nodes    nodeRegistry
+	changes  pendingChanges
+	overview overviewCache
+	deploys  deployChecks
+
+	synthetics  syntheticChecks
+	maintenance maintenanceState
+
+	// bootstrapMu serialises bootstrap key exchanges, so each key is
+	// exchanged once.
+	bootstrapMu sync.Mutex
+
+	// keysMu serialises changes to stored API keys, which are read,
+	// changed and saved back. Usage flushes take it too, so they can't
+	// save a stale copy over a rotation, role change or deletion.
+	keysMu sync.Mutex
+
+	// wildcardMu serialises wildcard issuance so sites sharing a zone
+	// request the certificate once.
+	wildcardMu sync.Mutex
 }
 
 func NewServer(s store.Store, n *nginx.Manager, c *certbot.Manager, l *logmanager.Manager) *Server {
+	watch := store.NewWatchStore(s)
 	return &Server{
-		Store:      s,
+		Store:      watch,
+		Watch:      watch,
 		Nginx:      n,
 		Certbot:    c,
 		LogManager: l,
+		Health:     health.NewTracker(),
+		HSTS:       hsts.NewChecker(),
+		JWT:        jwtgate.NewVerifier(),
+		DNS:        dnscheck.NewChecker(),
+		Ports:      NewPortRegistry(),
+		Version:    "dev",
+		started:    time.Now(),
+
+		SyntheticTarget: synthetic.DefaultTarget,
 	}
 }
 
 func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/health", s.handleHealth)
-	mux.HandleFunc("/v1/sites", s.handleSites)       // GET, POST
-	mux.HandleFunc("/v1/sites/", s.handleSiteDetail) // GET, DELETE, PATCH
-	mux.HandleFunc("/v1/streams", s.handleStreams)       // GET, POST
-	mux.HandleFunc("/v1/streams/", s.handleStreamDetail) // GET, DELETE
-	
-	return s.loggingMiddleware(mux)
+	mux.HandleFunc("/v1/openapi.json", s.handleOpenAPI)                                         // GET
+	mux.HandleFunc("/v1/sites", s.require(resourceSites, s.handleSites))                        // GET, POST
+	mux.HandleFunc("/v1/sites/preview", s.require(resourceSites, s.handleSitePreview))          // POST
+	mux.HandleFunc("/v1/sites/", s.require(resourceSites, s.handleSiteDetail))                  // GET, DELETE, PATCH
+	mux.HandleFunc("/v1/streams", s.require(resourceStreams, s.handleStreams))                  // GET, POST
+	mux.HandleFunc("/v1/streams/preview", s.require(resourceStreams, s.handleStreamPreview))    // POST
+	mux.HandleFunc("/v1/streams/", s.require(resourceStreams, s.handleStreamDetail))            // GET, PATCH, DELETE
+	mux.HandleFunc("/v1/certificates", s.require(resourceSites, s.handleCertificates))          // GET
+	mux.HandleFunc("/v1/certificates/", s.require(resourceSites, s.handleCertificateDetail))    // GET, POST preissue
+	mux.HandleFunc("/v1/groups/", s.require(resourceSites, s.handleGroupDetail))                // GET usage, DELETE
+	mux.HandleFunc("/v1/tools/verify-domains", s.require(resourceSites, s.handleVerifyDomains)) // POST
+	mux.HandleFunc("/v1/templates", s.require(resourceSites, s.handleTemplates))                // GET, POST
+	mux.HandleFunc("/v1/templates/", s.require(resourceSites, s.handleTemplateDetail))          // GET, PUT, DELETE
+	mux.HandleFunc("/v1/reference/directives", s.require(resourceSites, s.handleDirectives))    // GET
+	mux.HandleFunc("/v1/log-formats", s.require(resourceSites, s.handleLogFormats))             // GET, POST
+	mux.HandleFunc("/v1/log-formats/", s.require(resourceSites, s.handleLogFormatDetail))       // GET, PUT, DELETE
+	mux.HandleFunc("/v1/system", s.require(resourceSystem, s.handleSystem))                     // GET
+	mux.HandleFunc("/v1/system/maintenance", s.require(resourceSystem, s.handleMaintenance))    // GET, POST
+	mux.HandleFunc("/v1/overview", s.require(resourceSystem, s.handleOverview))                 // GET
+	mux.HandleFunc("/v1/logs", s.require(resourceSites, s.handleLogs))                          // GET
+	mux.HandleFunc("/v1/logs/stream", s.require(resourceSites, s.handleLogStream))              // GET (SSE)
+	mux.HandleFunc("/v1/drift", s.require(resourceSystem, s.handleDrift))                       // GET
+	mux.HandleFunc("/v1/watch", s.require(resourceSystem, s.handleWatch))                       // GET (long poll or SSE)
+	mux.HandleFunc("/v1/security/findings", s.require(resourceSystem, s.handleFindings))        // GET
+	mux.HandleFunc("/v1/export", s.require(resourceSystem, s.handleExport))                     // GET (JSON or YAML)
+	mux.HandleFunc("/v1/export/nginx", s.require(resourceSystem, s.handleExportNginx))          // GET (tar.gz)
+	mux.HandleFunc("/v1/import", s.require(resourceSystem, s.handleImport))                     // POST
+	mux.HandleFunc("/v1/backup", s.require(resourceAPIKeys, s.handleBackup))                    // POST (tar.gz)
+	mux.HandleFunc("/v1/restore", s.require(resourceAPIKeys, s.handleRestore))                  // POST (tar.gz)
+	mux.HandleFunc("/v1/audit", s.require(resourceSystem, s.handleAudit))                       // GET
+	mux.HandleFunc("/v1/mirror", s.require(resourceSystem, s.handleMirror))                     // GET
+	mux.HandleFunc("/v1/mirror/promote", s.require(resourceSystem, s.handleMirrorPromote))      // POST
+	mux.HandleFunc("/v1/nodes", s.require(resourceNodes, s.handleNodes))                        // GET
+	mux.HandleFunc("/v1/nodes/", s.require(resourceNodes, s.handleNodeDetail))                  // GET, DELETE; agents: GET config, POST status
+	mux.HandleFunc("/v1/apikeys", s.require(resourceAPIKeys, s.handleAPIKeys))                  // GET, POST
+	mux.HandleFunc("/v1/apikeys/", s.require(resourceAPIKeys, s.handleAPIKeyDetail))            // GET, PATCH, DELETE, POST rotate
+	mux.HandleFunc("/v1/bootstrap", s.handleBootstrap)                                          // POST, with a bootstrap key
+	mux.HandleFunc("/v1/auth/jwt/", s.handleJWTCheck)                                           // GET, from nginx over loopback
+	if s.Faults != nil {
+		mux.HandleFunc("/v1/debug/faults", s.require(resourceSystem, s.handleFaults))  // GET, POST, DELETE
+		mux.HandleFunc("/v1/debug/faults/", s.require(resourceSystem, s.handleFaults)) // DELETE
+	}
+
+	return s.loggingMiddleware(s.readOnlyMiddleware(mux))
 }
 
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
@@ -66,10 +208,18 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 
 		// Wrap ResponseWriter to capture status code
 		rw := &responseWriter{ResponseWriter: w, status: 200}
+		s.conns.requests.Add(1)
+		s.conns.inFlight.Add(1)
 		next.ServeHTTP(rw, r)
+		s.conns.inFlight.Add(-1)
 
 		duration := time.Since(start)
-		slog.Info("API Response",
+		// nginx asks for every request to a JWT-gated site.
+		level := slog.LevelInfo
+		if strings.HasPrefix(r.URL.Path, "/v1/auth/") {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "API Response",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rw.status,
@@ -88,7 +238,22 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush lets streaming handlers (SSE) push data through the wrapper.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	// Database-backed stores report connectivity, so a load balancer can
+	// take an instance out while its database is unreachable.
+	if p, ok := s.Store.(interface{ Ping() error }); ok {
+		if err := p.Ping(); err != nil {
+			jsonResponse(w, 503, map[string]string{"status": "degraded", "store": err.Error()})
+			return
+		}
+	}
 	jsonResponse(w, 200, map[string]string{"status": "ok"})
 }
 
@@ -114,24 +279,12 @@ func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			usedPorts := make(map[int]bool)
-			for _, str := range streams {
-				usedPorts[str.ListenPort] = true
-			}
-
-			var candidates []int
-			for p := 30000; p <= 30100; p++ {
-				if !usedPorts[p] {
-					candidates = append(candidates, p)
-				}
-			}
-
-			if len(candidates) == 0 {
-				errorResponse(w, 500, "no available ports in range 30000-30100")
+			port, err := s.Ports.Allocate(&stream, streams)
+			if err != nil {
+				errorResponse(w, 500, err.Error())
 				return
 			}
-
-			stream.ListenPort = candidates[rand.Intn(len(candidates))]
+			stream.ListenPort = port
 		}
 
 		if stream.ID == "" {
@@ -141,7 +294,29 @@ func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
 		if stream.Protocol == "" {
 			stream.Protocol = "tcp"
 		}
+		if err := normalizeStreamNames(&stream); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+
+		existing, err := s.Store.ListStreams()
+		if err != nil {
+			errorResponse(w, 500, "failed to list streams: "+err.Error())
+			return
+		}
+		if err := s.validateStream(&stream, existing); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := checkExpiry(stream.Expiry, time.Now()); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
 
+		var warnings []nginx.LintWarning
+		if wantUpstreamCheck(r) {
+			warnings = s.checkStreamUpstream(&stream)
+		}
 		stream.CreatedAt = time.Now()
 		stream.UpdatedAt = time.Now()
 		stream.Status = "provisioning"
@@ -154,7 +329,7 @@ func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
 		streamCopy := stream
 		go s.provisionStream(&streamCopy)
 
-		jsonResponse(w, 201, stream)
+		jsonResponse(w, 201, streamResponse{Stream: &stream, Warnings: warnings})
 	default:
 		http.Error(w, "method not allowed", 405)
 	}
@@ -167,6 +342,12 @@ func (s *Server) handleStreamDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasSuffix(id, "/logs") {
+		realID := strings.TrimSuffix(id, "/logs")
+		s.handleStreamLogs(w, r, realID)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		stream, err := s.Store.GetStream(id)
@@ -174,7 +355,7 @@ func (s *Server) handleStreamDetail(w http.ResponseWriter, r *http.Request) {
 			errorResponse(w, 404, "stream not found")
 			return
 		}
-		jsonResponse(w, 200, stream)
+		jsonResponse(w, 200, streamResponse{Stream: stream, UpstreamHealth: s.streamHealth(stream)})
 	case http.MethodDelete:
 		// Get stream to know the port
 		stream, err := s.Store.GetStream(id)
@@ -193,6 +374,132 @@ func (s *Server) handleStreamDetail(w http.ResponseWriter, r *http.Request) {
 		go s.reconcileStreams(port)
 
 		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	case http.MethodPatch:
+		var input struct {
+			ListenPort    *int                      `json:"listen_port"`
+			Upstream      *string                   `json:"upstream"`
+			Upstreams     []string                  `json:"upstreams"`
+			LoadBalancing *models.StreamBalancing   `json:"load_balancing"`
+			Protocol      *string                   `json:"protocol"`
+			Domain        *string                   `json:"domain"`
+			BindAddress   *string                   `json:"bind_address"`
+			Timeouts      *models.StreamTimeouts    `json:"timeouts"`
+			UDP           *models.StreamUDP         `json:"udp"`
+			HealthCheck   *models.StreamHealthCheck `json:"health_check"`
+			Group         *string                   `json:"group"`
+			Expiry        *models.Expiry            `json:"expiry"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+
+		stream, err := s.Store.GetStream(id)
+		if err != nil {
+			errorResponse(w, 404, "stream not found")
+			return
+		}
+		oldPort := stream.ListenPort
+
+		if input.ListenPort != nil {
+			stream.ListenPort = *input.ListenPort
+		}
+		// upstream and upstreams replace each other.
+		if input.Upstream != nil {
+			stream.Upstream = *input.Upstream
+			stream.Upstreams = nil
+		}
+		if input.Upstreams != nil {
+			stream.Upstreams = input.Upstreams
+			stream.Upstream = ""
+		}
+		if input.LoadBalancing != nil {
+			stream.LoadBalancing = input.LoadBalancing
+			if reflect.DeepEqual(*input.LoadBalancing, models.StreamBalancing{}) {
+				stream.LoadBalancing = nil // {} goes back to round robin
+			}
+		}
+		if input.Protocol != nil {
+			stream.Protocol = *input.Protocol
+		}
+		if input.Domain != nil {
+			stream.Domain = *input.Domain
+		}
+		if input.BindAddress != nil {
+			stream.BindAddress = *input.BindAddress
+		}
+		if input.Timeouts != nil {
+			stream.Timeouts = input.Timeouts
+			if *input.Timeouts == (models.StreamTimeouts{}) {
+				stream.Timeouts = nil // {} restores nginx's defaults
+			}
+		}
+		if input.UDP != nil {
+			stream.UDP = input.UDP
+			if input.UDP.Responses == nil {
+				stream.UDP = nil // {} restores nginx's defaults
+			}
+		}
+		if input.HealthCheck != nil {
+			stream.HealthCheck = input.HealthCheck
+			if *input.HealthCheck == (models.StreamHealthCheck{}) {
+				stream.HealthCheck = nil // {} goes back to dialing
+			}
+		}
+		if input.Group != nil {
+			stream.Group = *input.Group
+		}
+		if input.Expiry != nil {
+			if *input.Expiry == (models.Expiry{}) {
+				stream.Expiry = nil // {} keeps the stream for good
+			} else if err := checkExpiry(input.Expiry, time.Now()); err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			} else {
+				stream.Expiry = input.Expiry
+			}
+		}
+
+		if err := normalizeStreamNames(stream); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if stream.Protocol != "tcp" && stream.Protocol != "udp" {
+			errorResponse(w, 400, "protocol must be tcp or udp")
+			return
+		}
+		existing, err := s.Store.ListStreams()
+		if err != nil {
+			errorResponse(w, 500, "failed to list streams: "+err.Error())
+			return
+		}
+		if err := s.validateStream(stream, existing); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+
+		var warnings []nginx.LintWarning
+		if wantUpstreamCheck(r) {
+			warnings = s.checkStreamUpstream(stream)
+		}
+		stream.UpdatedAt = time.Now()
+		stream.Status = "provisioning"
+		stream.ErrorMessage = ""
+
+		if err := s.Store.SaveStream(stream); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+
+		// A port change must also drop the stream from the old listener.
+		go func(newPort int) {
+			if oldPort != newPort {
+				s.reconcileStreams(oldPort)
+			}
+			s.reconcileStreams(newPort)
+		}(stream.ListenPort)
+
+		jsonResponse(w, 200, streamResponse{Stream: stream, Warnings: warnings})
 	default:
 		http.Error(w, "method not allowed", 405)
 	}
@@ -208,27 +515,37 @@ func (s *Server) reconcileStreams(port int) {
 		return
 	}
 
-	// 2. Filter by port
+	// 2. Filter by port, leaving out expired streams
 	var portStreams []models.Stream
+	now := time.Now()
 	for _, str := range allStreams {
-		if str.ListenPort == port {
-			portStreams = append(portStreams, str)
+		if str.ListenPort != port {
+			continue
 		}
+		if str.Expiry.Expired(now) {
+			if str.Status != "expired" {
+				s.updateStreamStatus(str.ID, "expired", expiredMessage(str.Expiry))
+			}
+			continue
+		}
+		portStreams = append(portStreams, str)
 	}
 	slog.Debug("Found streams for port", "port", port, "count", len(portStreams))
 
 	// 3. Rebuild Config
 	if err := s.Nginx.RebuildStreamConfig(port, portStreams); err != nil {
 		slog.Error("reconcile error: failed to rebuild config", "port", port, "error", err)
-		// Update status for all affected streams?
-		// For MVP, we log. In production, we should update status of all portStreams to 'error'.
+		for _, str := range portStreams {
+			s.updateStreamStatus(str.ID, "error", "apply failed: "+err.Error())
+		}
 		return
 	}
 
-	// Success: Update status of these streams to active
+	// Success: the streams are active unless health checks reach none of
+	// their upstreams.
 	for _, str := range portStreams {
-		if str.Status != "active" {
-			s.updateStreamStatus(str.ID, "active", "")
+		if status, msg := s.streamStatus(&str); str.Status != status || str.ErrorMessage != msg {
+			s.updateStreamStatus(str.ID, status, msg)
 		}
 	}
 	slog.Info("Stream reconciliation complete", "port", port)
@@ -258,6 +575,15 @@ func (s *Server) handleSites(w http.ResponseWriter, r *http.Request) {
 			errorResponse(w, 500, err.Error())
 			return
 		}
+		if domain := r.URL.Query().Get("domain"); domain != "" {
+			if sites, err = filterSitesByDomain(sites, domain); err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			}
+		}
+		for i := range sites {
+			sites[i] = sites[i].Redacted()
+		}
 		jsonResponse(w, 200, sites)
 	case http.MethodPost:
 		var site models.Site
@@ -265,8 +591,41 @@ func (s *Server) handleSites(w http.ResponseWriter, r *http.Request) {
 			errorResponse(w, 400, "invalid json")
 			return
 		}
+		if err := normalizeSiteNames(&site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
 		if site.ID == "" {
-			site.ID = site.Domain // Simple ID generation
+			id, err := defaultSiteID(&site)
+			if err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			}
+			site.ID = id
+		}
+		if err := s.validateWildcard(&site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.validateSiteRules(&site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := checkExpiry(site.Expiry, time.Now()); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.checkSiteLogFormat(&site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.checkServerNames(&site); err != nil {
+			errorResponse(w, 409, err.Error())
+			return
+		}
+		var unreachable []nginx.LintWarning
+		if wantUpstreamCheck(r) {
+			unreachable = s.checkSiteUpstreams(&site)
 		}
 		site.CreatedAt = time.Now()
 		site.UpdatedAt = time.Now()
@@ -281,33 +640,159 @@ func (s *Server) handleSites(w http.ResponseWriter, r *http.Request) {
 		// Apply Nginx Config (async)
 		// We pass a copy to avoid race with jsonResponse which reads 'site'
 		siteCopy := site
-		go s.provisionSite(&siteCopy)
+		s.noteConfigChange(site.ID, actor(r), "site.created")
+		if wantWait(r) {
+			s.provisionSite(&siteCopy)
+			if applied, err := s.Store.GetSite(site.ID); err == nil {
+				site = *applied
+			}
+		} else {
+			go s.provisionSite(&siteCopy)
+		}
 
-		jsonResponse(w, 201, site)
+		jsonResponse(w, 201, siteResponse{Site: publicSite(&site), Warnings: append(s.lintSite(&site), unreachable...)})
 	default:
 		http.Error(w, "method not allowed", 405)
 	}
 }
 
 func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v1/sites/"):]
+	id := asciiID(r.URL.Path[len("/v1/sites/"):])
 	if id == "" {
 		http.NotFound(w, r)
 		return
 	}
 
+	if strings.HasSuffix(id, "/logs/stream") {
+		realID := strings.TrimSuffix(id, "/logs/stream")
+		s.handleSiteLogStream(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/logs/access") {
+		realID := strings.TrimSuffix(id, "/logs/access")
+		s.handleSiteLogType(w, r, realID, "access")
+		return
+	}
+
+	if strings.HasSuffix(id, "/logs/error") {
+		realID := strings.TrimSuffix(id, "/logs/error")
+		s.handleSiteLogType(w, r, realID, "error")
+		return
+	}
+
 	if strings.HasSuffix(id, "/logs") {
 		realID := strings.TrimSuffix(id, "/logs")
 		s.handleSiteLogs(w, r, realID)
 		return
 	}
 
+	if strings.HasSuffix(id, "/analytics") {
+		realID := strings.TrimSuffix(id, "/analytics")
+		s.handleSiteAnalytics(w, r, realID)
+		return
+	}
+
 	if strings.HasSuffix(id, "/firewall") {
 		realID := strings.TrimSuffix(id, "/firewall")
 		s.handleSiteFirewall(w, r, realID)
 		return
 	}
 
+	if strings.HasSuffix(id, "/hsts-preload") {
+		realID := strings.TrimSuffix(id, "/hsts-preload")
+		s.handleSiteHSTSPreload(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/cache/warm") {
+		realID := strings.TrimSuffix(id, "/cache/warm")
+		s.handleSiteCacheWarm(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/cache/purge") {
+		realID := strings.TrimSuffix(id, "/cache/purge")
+		s.handleSiteCachePurge(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/capture/har") {
+		realID := strings.TrimSuffix(id, "/capture/har")
+		s.handleSiteCaptureHAR(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/capture") {
+		realID := strings.TrimSuffix(id, "/capture")
+		s.handleSiteCapture(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/certificates/promote") {
+		realID := strings.TrimSuffix(id, "/certificates/promote")
+		s.handleSiteCertPromote(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/cert-deployment") {
+		realID := strings.TrimSuffix(id, "/cert-deployment")
+		s.handleSiteCertDeployment(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/synthetics/run") {
+		realID := strings.TrimSuffix(id, "/synthetics/run")
+		s.handleSiteSynthetics(w, r, realID, true)
+		return
+	}
+
+	if strings.HasSuffix(id, "/synthetics") {
+		realID := strings.TrimSuffix(id, "/synthetics")
+		s.handleSiteSynthetics(w, r, realID, false)
+		return
+	}
+
+	if strings.HasSuffix(id, "/state") {
+		realID := strings.TrimSuffix(id, "/state")
+		s.handleSiteState(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/drift") {
+		realID := strings.TrimSuffix(id, "/drift")
+		s.handleSiteDrift(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/runtime") {
+		realID := strings.TrimSuffix(id, "/runtime")
+		s.handleSiteRuntime(w, r, realID)
+		return
+	}
+
+	if i := strings.Index(id, "/waf"); i > 0 && (len(id) == i+4 || id[i+4] == '/') {
+		s.handleSiteWAF(w, r, id[:i], id[i+4:])
+		return
+	}
+
+	if i := strings.Index(id, "/files/"); i > 0 {
+		s.handleSiteFile(w, r, id[:i], id[i+len("/files/"):])
+		return
+	}
+
+	if strings.HasSuffix(id, "/drain") {
+		realID := strings.TrimSuffix(id, "/drain")
+		s.handleSiteDrain(w, r, realID)
+		return
+	}
+
+	if strings.HasSuffix(id, "/balancing") {
+		realID := strings.TrimSuffix(id, "/balancing")
+		s.handleSiteBalancing(w, r, realID)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		site, err := s.Store.GetSite(id)
@@ -315,7 +800,7 @@ func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
 			errorResponse(w, 404, "site not found")
 			return
 		}
-		jsonResponse(w, 200, site)
+		jsonResponse(w, 200, siteResponse{Site: publicSite(site), UpstreamHealth: s.siteHealth(site)})
 	case http.MethodDelete:
 		// Check if revoke requested
 		revoke := r.URL.Query().Get("revoke_cert") == "true"
@@ -327,18 +812,15 @@ func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if revoke && site.SSL {
-			if err := s.Certbot.Revoke(site.Domain); err != nil {
+			if others := s.wildcardUsers(site); len(others) > 0 {
+				slog.Warn("Not revoking shared wildcard certificate", "site_id", site.ID, "cert_name", site.CertName(), "used_by", others)
+			} else if err := s.Certbot.Revoke(site.CertName()); err != nil {
 				slog.Error("Failed to revoke cert", "domain", site.Domain, "error", err)
 				// continue to delete
 			}
 		}
 
-		if err := s.Nginx.Delete(id); err != nil {
-			errorResponse(w, 500, "failed to remove nginx config: "+err.Error())
-			return
-		}
-
-		if err := s.Store.DeleteSite(id); err != nil {
+		if err := s.deleteSite(id); err != nil {
 			errorResponse(w, 500, err.Error())
 			return
 		}
@@ -346,13 +828,57 @@ func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPatch:
 		// Decode partial update
 		var input struct {
-			Domain          *string           `json:"domain"`
-			Upstreams       []string          `json:"upstreams"`
-			ForceSSL        *bool             `json:"force_ssl"`
-			SSL             *bool             `json:"ssl"`
-			ExtraConfig     *string           `json:"extra_config"`
-			ProxySetHeaders map[string]string `json:"proxy_set_header"`
-			Firewall        *models.FirewallConfig `json:"firewall"`
+			Domain          *string                 `json:"domain"`
+			Aliases         []string                `json:"aliases"`
+			Upstreams       []string                `json:"upstreams"`
+			ForceSSL        *bool                   `json:"force_ssl"`
+			SSL             *bool                   `json:"ssl"`
+			Templates       []string                `json:"templates"`
+			ExtraConfig     *string                 `json:"extra_config"`
+			ProxySetHeaders map[string]string       `json:"proxy_set_header"`
+			Protocol        *string                 `json:"protocol"`
+			WebSockets      *bool                   `json:"websockets"`
+			WSTimeout       *int                    `json:"websocket_timeout_seconds"`
+			HTTP3           *bool                   `json:"http3"`
+			TLS             *models.TLSSettings     `json:"tls"`
+			ClientAuth      *models.ClientAuth      `json:"client_auth"`
+			MaxBodySize     *string                 `json:"client_max_body_size"`
+			RequestBuffer   *bool                   `json:"proxy_request_buffering"`
+			ResponseBuffer  *bool                   `json:"proxy_buffering"`
+			Firewall        *models.FirewallConfig  `json:"firewall"`
+			ResponseRewrite *models.ResponseRewrite `json:"response_rewrite"`
+			ProtectedFiles  []models.FileMapping    `json:"protected_files"`
+			Capacity        *models.Capacity        `json:"capacity"`
+			Routes          []models.RouteOverride  `json:"routes"`
+			Redirects       []models.Redirect       `json:"redirects"`
+			Rewrites        []models.Rewrite        `json:"rewrites"`
+			ACME            *models.ACMEConfig      `json:"acme"`
+			Wildcard        *string                 `json:"wildcard"`
+			AuditHeaders    []models.HeaderAudit    `json:"audit_headers"`
+			LogFormat       *string                 `json:"log_format"`
+			LogRetention    *int                    `json:"log_retention_days"`
+			KeyRotation     *int                    `json:"key_rotation_days"`
+			LoadBalancing   *models.LoadBalancing   `json:"load_balancing"`
+			HealthCheck     *models.HealthCheck     `json:"health_check"`
+			Synthetics      []models.SyntheticCheck `json:"synthetic_checks"`
+
+			Hygiene         *models.ConnectionHygiene `json:"connection_hygiene"`
+			SecurityHeaders *models.SecurityHeaders   `json:"security_headers"`
+			WAF             *models.WAF               `json:"waf"`
+			Canary          *models.CanaryCheck       `json:"canary"`
+			CanaryRelease   *models.Canary            `json:"canary_release"`
+			TrafficMirror   *models.Mirror            `json:"traffic_mirror"`
+			Cache           *models.Cache             `json:"cache"`
+			Keepalive       *models.UpstreamKeepalive `json:"upstream_keepalive"`
+			UpstreamTLS     *models.UpstreamTLS       `json:"upstream_tls"`
+			UpstreamHost    *string                   `json:"upstream_host"`
+			JWTGate         *models.JWTGate           `json:"jwt_gate"`
+			Group           *string                   `json:"group"`
+			StaticAssets    []models.StaticAssetRule  `json:"static_assets"`
+			InterceptErrors *models.ErrorInterception `json:"intercept_errors"`
+			AssetShield     *models.AssetShield       `json:"asset_shield"`
+			Drain           *models.UpstreamDrain     `json:"drain"`
+			Expiry          *models.Expiry            `json:"expiry"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			errorResponse(w, 400, "invalid json")
@@ -368,33 +894,289 @@ func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
 		// Detect if we need full re-provisioning (cert issuance) or just config reload
 		needsFullProvision := false
 
+		if input.Domain != nil {
+			domain, err := idn.ToASCII(*input.Domain)
+			if err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			}
+			input.Domain = &domain
+		}
 		if input.Domain != nil && *input.Domain != site.Domain {
 			site.Domain = *input.Domain
+			site.CertLineage = "" // The new domain gets a lineage of its own
 			needsFullProvision = true
 		}
+		if input.Aliases != nil {
+			site.Aliases = input.Aliases
+			if site.SSL {
+				needsFullProvision = true // New names need a certificate
+			}
+		}
 		if input.SSL != nil && *input.SSL != site.SSL {
 			site.SSL = *input.SSL
 			needsFullProvision = true
+			if !site.SSL {
+				// The certificate is kept on disk for re-enabling, but the
+				// site no longer serves it.
+				site.CertIssueStatus = ""
+				site.CertExpiresAt = nil
+			}
+		}
+		if input.Wildcard != nil && *input.Wildcard != site.Wildcard {
+			site.Wildcard = *input.Wildcard
+			if site.SSL {
+				needsFullProvision = true // Switches certificate lineage
+			}
 		}
 
 		// Apply other updates
+		previousUpstreams := site.Upstreams
+		if input.Drain != nil {
+			site.Drain = input.Drain
+			if *input.Drain == (models.UpstreamDrain{}) {
+				site.Drain = nil // {} drops removed upstreams at once again
+			}
+		}
 		if input.Upstreams != nil {
 			site.Upstreams = input.Upstreams
 		}
+		if input.Upstreams != nil || input.Drain != nil {
+			drainUpstreams(site, previousUpstreams, time.Now())
+		}
 		if input.ForceSSL != nil {
 			site.ForceSSL = *input.ForceSSL
 		}
+		if site.ForceSSL && !site.SSL {
+			if input.ForceSSL != nil && *input.ForceSSL {
+				errorResponse(w, 400, "force_ssl requires ssl")
+				return
+			}
+			site.ForceSSL = false // Nothing to redirect to once SSL is off
+		}
+		if input.HTTP3 != nil {
+			site.HTTP3 = *input.HTTP3
+		}
+		if site.HTTP3 && !site.SSL && (input.HTTP3 == nil || !*input.HTTP3) {
+			site.HTTP3 = false // QUIC needs the certificate too
+		}
+		if input.TLS != nil {
+			site.TLS = input.TLS
+			if *input.TLS == (models.TLSSettings{}) {
+				site.TLS = nil // {} restores nginx's defaults
+			}
+		}
+		if input.ClientAuth != nil {
+			site.ClientAuth = input.ClientAuth
+			if *input.ClientAuth == (models.ClientAuth{}) {
+				site.ClientAuth = nil // {} stops asking for certificates
+			}
+		}
+		if input.MaxBodySize != nil {
+			site.ClientMaxBodySize = *input.MaxBodySize // "" falls back to the global default
+		}
+		if input.RequestBuffer != nil {
+			site.ProxyRequestBuffering = input.RequestBuffer
+		}
+		if input.ResponseBuffer != nil {
+			site.ProxyBuffering = input.ResponseBuffer
+		}
+		if input.Templates != nil {
+			site.Templates = input.Templates
+		}
 		if input.ExtraConfig != nil {
 			site.ExtraConfig = *input.ExtraConfig
 		}
 		if input.ProxySetHeaders != nil {
 			site.ProxySetHeaders = input.ProxySetHeaders
 		}
+		if input.Protocol != nil {
+			site.Protocol = *input.Protocol
+		}
+		if input.WebSockets != nil {
+			site.WebSockets = *input.WebSockets
+			if !site.WebSockets {
+				site.WebSocketTimeout = 0
+			}
+		}
+		if input.WSTimeout != nil {
+			site.WebSocketTimeout = *input.WSTimeout
+		}
 		if input.Firewall != nil {
 			site.Firewall = input.Firewall
 		}
+		if input.ResponseRewrite != nil {
+			site.ResponseRewrite = input.ResponseRewrite
+			if len(input.ResponseRewrite.Rules) == 0 {
+				site.ResponseRewrite = nil // {"rules": []} removes rewriting
+			}
+		}
+		if input.ProtectedFiles != nil {
+			site.ProtectedFiles = input.ProtectedFiles
+		}
+		if input.Capacity != nil {
+			site.Capacity = input.Capacity
+			if *input.Capacity == (models.Capacity{}) {
+				site.Capacity = nil // {} removes the limits
+			}
+		}
+		if input.Hygiene != nil {
+			site.Hygiene = input.Hygiene
+			if *input.Hygiene == (models.ConnectionHygiene{}) {
+				site.Hygiene = nil // {} falls back to the global default
+			}
+		}
+		if input.SecurityHeaders != nil {
+			site.SecurityHeaders = input.SecurityHeaders
+			if *input.SecurityHeaders == (models.SecurityHeaders{}) {
+				site.SecurityHeaders = nil // {} removes them
+			}
+		}
+		if input.WAF != nil {
+			site.WAF = input.WAF
+		}
+		if input.Canary != nil {
+			site.Canary = input.Canary
+			if *input.Canary == (models.CanaryCheck{}) {
+				site.Canary = nil // {} restores the default check
+			}
+		}
+		if input.CanaryRelease != nil {
+			site.CanaryRelease = input.CanaryRelease
+			if *input.CanaryRelease == (models.Canary{}) {
+				site.CanaryRelease = nil // {} ends the release
+			}
+		}
+		if input.TrafficMirror != nil {
+			site.TrafficMirror = input.TrafficMirror
+			if *input.TrafficMirror == (models.Mirror{}) {
+				site.TrafficMirror = nil // {} stops mirroring
+			}
+		}
+		if input.Cache != nil {
+			site.Cache = input.Cache
+		}
+		if input.Routes != nil {
+			site.Routes = input.Routes
+		}
+		if input.Redirects != nil {
+			site.Redirects = input.Redirects
+		}
+		if input.Rewrites != nil {
+			site.Rewrites = input.Rewrites
+		}
+		if input.ACME != nil {
+			input.ACME.KeepEABKey(site.ACME)
+			site.ACME = input.ACME
+		}
+		if input.AuditHeaders != nil {
+			site.AuditHeaders = input.AuditHeaders
+		}
+		if input.LogFormat != nil {
+			site.LogFormat = *input.LogFormat
+		}
+		if input.LogRetention != nil {
+			site.LogRetentionDays = *input.LogRetention
+		}
+		if input.KeyRotation != nil {
+			site.KeyRotationDays = *input.KeyRotation
+		}
+		if input.HealthCheck != nil {
+			site.HealthCheck = input.HealthCheck
+			if !site.HealthCheck.Enabled || !site.HealthCheck.MarkDown {
+				site.DownUpstreams = nil
+			}
+		}
+		if input.Synthetics != nil {
+			site.SyntheticChecks = input.Synthetics
+		}
+		if input.LoadBalancing != nil {
+			// Effective weights are owned by the balancer; keep the current
+			// ones so traffic doesn't jump back to base weights.
+			input.LoadBalancing.EffectiveWeights = nil
+			if site.LoadBalancing != nil {
+				input.LoadBalancing.EffectiveWeights = site.LoadBalancing.EffectiveWeights
+			}
+			site.LoadBalancing = input.LoadBalancing
+		}
+		if input.Keepalive != nil {
+			site.UpstreamKeepalive = input.Keepalive
+			if *input.Keepalive == (models.UpstreamKeepalive{}) {
+				site.UpstreamKeepalive = nil // {} opens a connection per request again
+			}
+		}
+		if input.UpstreamTLS != nil {
+			site.UpstreamTLS = input.UpstreamTLS
+			if *input.UpstreamTLS == (models.UpstreamTLS{}) {
+				site.UpstreamTLS = nil // {} proxies over plain HTTP again
+			}
+		}
+		if input.UpstreamHost != nil {
+			site.UpstreamHost = *input.UpstreamHost // "" forwards the client's Host again
+		}
+		if input.Group != nil {
+			site.Group = *input.Group
+		}
+		if input.StaticAssets != nil {
+			site.StaticAssets = input.StaticAssets // [] removes the rules
+		}
+		if input.JWTGate != nil {
+			site.JWTGate = input.JWTGate
+			if reflect.DeepEqual(*input.JWTGate, models.JWTGate{}) {
+				site.JWTGate = nil // {} removes the gate
+			}
+		}
+		if input.InterceptErrors != nil {
+			site.InterceptErrors = input.InterceptErrors
+			if len(input.InterceptErrors.Codes) == 0 {
+				site.InterceptErrors = nil // {} stops intercepting
+			}
+		}
+		if input.AssetShield != nil {
+			site.AssetShield = input.AssetShield
+			if *input.AssetShield == (models.AssetShield{}) {
+				site.AssetShield = nil // {} proxies both files again
+			}
+		}
+		if input.Expiry != nil {
+			if *input.Expiry == (models.Expiry{}) {
+				site.Expiry = nil // {} keeps the site for good
+			} else if err := checkExpiry(input.Expiry, time.Now()); err != nil {
+				errorResponse(w, 400, err.Error())
+				return
+			} else {
+				site.Expiry = input.Expiry
+			}
+		}
 
+		if err := normalizeSiteNames(site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.validateWildcard(site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.validateSiteRules(site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.checkSiteLogFormat(site); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		if err := s.checkServerNames(site); err != nil {
+			errorResponse(w, 409, err.Error())
+			return
+		}
+
+		var unreachable []nginx.LintWarning
+		if wantUpstreamCheck(r) {
+			unreachable = s.checkSiteUpstreams(site)
+		}
 		site.UpdatedAt = time.Now()
+		site.Status = "provisioning"
+		site.ErrorMessage = ""
 
 		if err := s.Store.SaveSite(site); err != nil {
 			errorResponse(w, 500, err.Error())
@@ -402,19 +1184,57 @@ func (s *Server) handleSiteDetail(w http.ResponseWriter, r *http.Request) {
 		}
 
 		siteCopy := *site
+		s.noteConfigChange(site.ID, actor(r), "site.updated")
+		apply := s.refreshSiteConfig
 		if needsFullProvision {
-			go s.provisionSite(&siteCopy)
+			apply = s.provisionSite
+		}
+		if wantWait(r) {
+			apply(&siteCopy)
+			if applied, err := s.Store.GetSite(site.ID); err == nil {
+				site = applied
+			}
 		} else {
-			go s.refreshSiteConfig(&siteCopy)
+			go apply(&siteCopy)
 		}
 
-		jsonResponse(w, 200, site)
+		jsonResponse(w, 200, siteResponse{Site: publicSite(site), Warnings: append(s.lintSite(site), unreachable...)})
 	default:
 		http.Error(w, "method not allowed", 405)
 	}
 }
 
+// deleteSite removes a site's nginx config, the site and what is kept
+// for it. Its certificate stays.
+func (s *Server) deleteSite(id string) error {
+	if err := s.Nginx.Delete(id); err != nil {
+		return fmt.Errorf("failed to remove nginx config: %w", err)
+	}
+	if err := s.Store.DeleteSite(id); err != nil {
+		return err
+	}
+	s.forgetSite(id)
+	return nil
+}
+
+// forgetSite drops what is kept about a site besides its store entry and
+// nginx config.
+func (s *Server) forgetSite(id string) {
+	if err := s.Nginx.DeleteSiteFiles(id); err != nil {
+		slog.Warn("Failed to delete uploaded site files", "site_id", id, "error", err)
+	}
+	s.forgetConfigChange(id)
+	s.synthetics.forget(id, nil)
+	if err := s.Synthetics.Forget(id); err != nil {
+		slog.Warn("Failed to delete synthetic check results", "site_id", id, "error", err)
+	}
+}
+
 func (s *Server) refreshSiteConfig(site *models.Site) {
+	if site.Expiry.Expired(time.Now()) {
+		s.disableSite(site)
+		return
+	}
 	slog.Info("Refreshing site config", "site_id", site.ID, "domain", site.Domain)
 	s.updateStatus(site.ID, "provisioning", "refreshing config")
 
@@ -431,7 +1251,7 @@ func (s *Server) refreshSiteConfig(site *models.Site) {
 		return
 	}
 
-	if err := s.Nginx.Apply(site.ID, config); err != nil {
+	if err := s.applySiteConfig(site, config); err != nil {
 		slog.Error("Config application failed", "site_id", site.ID, "error", err)
 		s.updateStatus(site.ID, "error", "apply failed: "+err.Error())
 		return
@@ -457,7 +1277,28 @@ func (s *Server) provisionSite(site *models.Site) {
 	// Then we run certbot.
 	// Then we set SSL=true and re-render.
 
+	if site.Expiry.Expired(time.Now()) {
+		s.disableSite(site)
+		return
+	}
+
 	originalSSL := site.SSL
+
+	if originalSSL && site.Wildcard != "" {
+		s.provisionWildcard(site)
+		return
+	}
+
+	// A pre-issued (or previously issued) certificate covering every name
+	// can be attached right away.
+	if originalSSL && s.Certbot.LineageCovers(site.CertName(), site.ServerNames()...) {
+		slog.Info("Using existing certificate", "site_id", site.ID, "domain", site.Domain)
+		s.markCertValid(site)
+		s.saveCertState(site)
+		s.applySSLConfig(site)
+		return
+	}
+
 	if originalSSL {
 		site.SSL = false // Temporary disable for challenge
 	}
@@ -475,7 +1316,7 @@ func (s *Server) provisionSite(site *models.Site) {
 		return
 	}
 
-	if err := s.Nginx.Apply(site.ID, staging); err != nil {
+	if err := s.applySiteConfig(site, staging); err != nil {
 		slog.Error("Initial config application failed", "site_id", site.ID, "error", err)
 		s.updateStatus(site.ID, "error", "apply failed: "+err.Error())
 		return
@@ -490,7 +1331,7 @@ func (s *Server) provisionSite(site *models.Site) {
 	// Handle SSL
 	slog.Info("Starting SSL provisioning", "site_id", site.ID, "domain", site.Domain)
 	s.updateStatus(site.ID, "provisioning", "issuing certificate")
-	if err := s.Certbot.Issue(site.Domain); err != nil {
+	if err := s.Certbot.Issue(site.Domain, issueOptions(site)); err != nil {
 		slog.Error("Certificate issuance failed", "site_id", site.ID, "domain", site.Domain, "error", err)
 		s.updateStatus(site.ID, "cert-failed", err.Error())
 		return
@@ -498,10 +1339,15 @@ func (s *Server) provisionSite(site *models.Site) {
 
 	// Re-apply with SSL
 	site.SSL = true
-	site.CertIssueStatus = "valid"
+	s.markCertValid(site)
 	// Update store with SSL=true
-	s.Store.SaveSite(site)
+	s.saveCertState(site)
 
+	s.applySSLConfig(site)
+}
+
+// applySSLConfig renders and applies the site with its certificate.
+func (s *Server) applySSLConfig(site *models.Site) {
 	stagingSSL, err := s.Nginx.GenerateConfig(site)
 	if err != nil {
 		slog.Error("SSL config generation failed", "site_id", site.ID, "error", err)
@@ -510,7 +1356,12 @@ func (s *Server) provisionSite(site *models.Site) {
 	}
 
 	// Validate & Apply
-	if err := s.Nginx.Apply(site.ID, stagingSSL); err != nil {
+	if err := s.Nginx.Validate(stagingSSL); err != nil {
+		slog.Error("SSL config validation failed", "site_id", site.ID, "error", err)
+		s.updateStatus(site.ID, "error", "ssl config invalid: "+err.Error())
+		return
+	}
+	if err := s.applySiteConfig(site, stagingSSL); err != nil {
 		slog.Error("SSL config application failed", "site_id", site.ID, "error", err)
 		s.updateStatus(site.ID, "error", "ssl apply failed: "+err.Error())
 		return
@@ -518,6 +1369,51 @@ func (s *Server) provisionSite(site *models.Site) {
 
 	slog.Info("Site provisioned with SSL", "site_id", site.ID)
 	s.updateStatus(site.ID, "active", "")
+	if len(s.Nginx.DeployCheckHosts) > 0 {
+		s.checkCertDeployment(site, "")
+	}
+}
+
+// siteResponse is a site plus response-only data: lint warnings about its
+// rendered config on create/update, upstream health on GET.
+type siteResponse struct {
+	*models.Site
+	Warnings       []nginx.LintWarning `json:"warnings,omitempty"`
+	UpstreamHealth []health.Stats      `json:"upstream_health,omitempty"`
+}
+
+// publicSite strips write-only secrets before a site is returned to
+// clients.
+func publicSite(site *models.Site) *models.Site {
+	public := site.Redacted()
+	return &public
+}
+
+// streamResponse is a stream plus any upstream check warnings, and its
+// upstream health on GET.
+type streamResponse struct {
+	*models.Stream
+	Warnings       []nginx.LintWarning `json:"warnings,omitempty"`
+	UpstreamHealth []health.Stats      `json:"upstream_health,omitempty"`
+}
+
+func (s *Server) lintSite(site *models.Site) []nginx.LintWarning {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Warn("Lint skipped duplicate check", "site_id", site.ID, "error", err)
+	}
+	return s.Nginx.Lint(site, sites)
+}
+
+// issueOptions maps the site's aliases and ACME overrides onto certbot options.
+func issueOptions(site *models.Site) certbot.IssueOptions {
+	opts := certbot.IssueOptions{AltNames: site.Aliases, CertName: site.CertLineage}
+	if site.ACME != nil {
+		opts.Server = site.ACME.Server
+		opts.EABKeyID = site.ACME.EABKeyID
+		opts.EABHMACKey = site.ACME.EABHMACKey
+	}
+	return opts
 }
 
 func (s *Server) updateStatus(id, status, msg string) {
@@ -545,17 +1441,40 @@ func errorResponse(w http.ResponseWriter, code int, msg string) {
 }
 
 func (s *Server) handleSiteLogs(w http.ResponseWriter, r *http.Request, siteID string) {
+	if r.Method == http.MethodDelete {
+		s.handleSiteLogsPurge(w, r, siteID)
+		return
+	}
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", 405)
 		return
 	}
 
-	// Parse Query Params
 	logType := r.URL.Query().Get("type")
 	if logType == "" {
 		logType = "access"
 	}
+	s.serveSiteLogs(w, r, siteID, logType)
+}
 
+// handleSiteLogType serves GET /v1/sites/{id}/logs/access and /logs/error,
+// the same as /logs?type=access|error.
+func (s *Server) handleSiteLogType(w http.ResponseWriter, r *http.Request, siteID, logType string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	if _, err := s.Store.GetSite(siteID); err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	s.serveSiteLogs(w, r, siteID, logType)
+}
+
+// serveSiteLogs maps the limit, since, until and search query parameters to
+// LogOptions and returns the matching entries of one log type.
+func (s *Server) serveSiteLogs(w http.ResponseWriter, r *http.Request, siteID, logType string) {
+	// Parse Query Params
 	limitStr := r.URL.Query().Get("limit")
 	limit := 100
 	if limitStr != "" {
@@ -580,6 +1499,9 @@ func (s *Server) handleSiteLogs(w http.ResponseWriter, r *http.Request, siteID s
 		Until:  until,
 		Search: search,
 	}
+	if site, err := s.Store.GetSite(siteID); err == nil {
+		opts.Format = s.siteLogFormat(site)
+	}
 
 	if logType == "error" {
 		logs, err := s.LogManager.GetErrorLogs(siteID, opts)
@@ -588,6 +1510,13 @@ func (s *Server) handleSiteLogs(w http.ResponseWriter, r *http.Request, siteID s
 			return
 		}
 		jsonResponse(w, 200, logs)
+	} else if logType == "audit" {
+		logs, err := s.LogManager.GetAuditLogs(siteID, opts)
+		if err != nil {
+			errorResponse(w, 500, "failed to read audit logs: "+err.Error())
+			return
+		}
+		jsonResponse(w, 200, logs)
 	} else {
 		logs, err := s.LogManager.GetAccessLogs(siteID, opts)
 		if err != nil {
@@ -627,10 +1556,12 @@ func (s *Server) handleSiteFirewall(w http.ResponseWriter, r *http.Request, site
 			site.Firewall.RateLimit = nil
 		case "block_rules":
 			site.Firewall.BlockRules = nil
+		case "countries":
+			site.Firewall.Countries = nil
 		case "all", "":
 			site.Firewall = nil
 		default:
-			errorResponse(w, 400, "invalid section: must be ip_rules, rate_limit, block_rules, or all")
+			errorResponse(w, 400, "invalid section: must be ip_rules, rate_limit, block_rules, countries, or all")
 			return
 		}
 
@@ -641,6 +1572,7 @@ func (s *Server) handleSiteFirewall(w http.ResponseWriter, r *http.Request, site
 		}
 
 		// Apply changes
+		s.noteConfigChange(site.ID, actor(r), "site.firewall_cleared:"+section)
 		go s.refreshSiteConfig(site)
 
 		jsonResponse(w, 200, map[string]string{"status": "cleared", "section": section})
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// checkServerNames returns an error naming the other site when one of
+// site's domain or aliases is already served by another site.
+func (s *Server) checkServerNames(site *models.Site) error {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		return nil
+	}
+	if other, name := nginx.FindServerNameConflict(site, sites); other != nil {
+		return fmt.Errorf("server name %s is already used by site %s", name, other.ID)
+	}
+	return nil
+}
+
+// defaultSiteID is the ID of a site created without one: its domain, as a
+// name for a wildcard ("*" makes an awkward file name) and never for a
+// regex.
+func defaultSiteID(site *models.Site) (string, error) {
+	switch {
+	case nginx.IsRegexServerName(site.Domain):
+		return "", fmt.Errorf("a site with a regex domain needs an explicit id")
+	case nginx.IsWildcardServerName(site.Domain):
+		return models.WildcardCertName(strings.TrimPrefix(site.Domain, "*.")), nil
+	}
+	return site.Domain, nil
+}
+
+// DriftEntry is a server_name in the nginx tree that does not match the
+// store: a config hubfly did not write, or a stale hubfly config.
+type DriftEntry struct {
+	Kind       string `json:"kind"` // "unmanaged", "conflict" or "stale"
+	ServerName string `json:"server_name"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	SiteID     string `json:"site_id,omitempty"`
+	Message    string `json:"message"`
+}
+
+// handleDrift compares the server names in the live nginx configs with the
+// sites in the store.
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	claims, err := s.Nginx.ScanServerNames()
+	if err != nil {
+		errorResponse(w, 500, "failed to scan nginx configs: "+err.Error())
+		return
+	}
+
+	byFile := make(map[string]*models.Site, len(sites))
+	for i := range sites {
+		byFile[filepath.Join(s.Nginx.SitesDir, sites[i].ID+".conf")] = &sites[i]
+	}
+
+	entries := []DriftEntry{}
+	for _, c := range claims {
+		if owner, ok := byFile[c.File]; ok {
+			if !slices.ContainsFunc(owner.ServerNames(), func(n string) bool { return strings.EqualFold(n, c.Name) }) {
+				entries = append(entries, DriftEntry{
+					Kind: "stale", ServerName: c.Name, File: c.File, Line: c.Line, SiteID: owner.ID,
+					Message: "rendered config serves a name the site no longer has; re-apply the site",
+				})
+			}
+			continue
+		}
+
+		entry := DriftEntry{
+			Kind: "unmanaged", ServerName: c.Name, File: c.File, Line: c.Line,
+			Message: "server name is configured outside hubfly",
+		}
+		for _, site := range sites {
+			if slices.ContainsFunc(site.ServerNames(), func(n string) bool { return nginx.ServerNamesConflict(n, c.Name) }) {
+				entry.Kind = "conflict"
+				entry.SiteID = site.ID
+				entry.Message = "server name is configured outside hubfly and collides with site " + site.ID
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+	jsonResponse(w, 200, map[string]interface{}{"server_names": entries})
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+// newTestServer returns a server with every directory in a temporary
+// directory. There is no nginx binary, so reloads are skipped.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := store.NewJSONStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm := nginx.NewManager(filepath.Join(dir, "nginx"))
+	if err := nm.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	cb := certbot.NewManager(filepath.Join(dir, "www"), "test@example.com")
+	cb.LiveDir = filepath.Join(dir, "letsencrypt", "live")
+	return NewServer(st, nm, cb, logmanager.NewManager(filepath.Join(dir, "logs")))
+}
+
+// serve sends a request through the server's routes.
+func serve(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	return serveAs(s, "", method, target, body)
+}
+
+// serveAs is serve with a bearer token, unless token is empty.
+func serveAs(s *Server, token, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// stored returns the store's JSON of a site or stream, to compare before
+// and after a request.
+func stored(t *testing.T, s *Server, kind, id string) string {
+	t.Helper()
+	var v interface{}
+	var err error
+	if kind == "site" {
+		v, err = s.Store.GetSite(id)
+	} else {
+		v, err = s.Store.GetStream(id)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestSitePatch(t *testing.T) {
+	s := newTestServer(t)
+	body := `{"id": "a", "domain": "a.example.com", "aliases": ["www.a.example.com"], "upstreams": ["app:80"],
+		"extra_config": "gzip on;", "group": "acme", "tls": {"protocols": ["TLSv1.3"]}, "capacity": {"max_connections": 10}}`
+	if rec := serve(s, "POST", "/v1/sites?wait=true", body); rec.Code != 201 {
+		t.Fatalf("POST failed: %d %s", rec.Code, rec.Body.String())
+	}
+	serve(s, "POST", "/v1/sites?wait=true", `{"id": "b", "domain": "b.example.com", "upstreams": ["app:80"]}`)
+	patch := func(body string) *models.Site {
+		t.Helper()
+		if rec := serve(s, "PATCH", "/v1/sites/a?wait=true", body); rec.Code != 200 {
+			t.Fatalf("PATCH %s failed: %d %s", body, rec.Code, rec.Body.String())
+		}
+		site, _ := s.Store.GetSite("a")
+		return site
+	}
+
+	// Omitted and null fields keep their values
+	for _, body := range []string{
+		`{"upstreams": ["app:8080"]}`,
+		`{"aliases": null, "extra_config": null, "group": null, "tls": null, "capacity": null}`,
+	} {
+		site := patch(body)
+		if site.Upstreams[0] != "app:8080" || len(site.Aliases) != 1 || site.ExtraConfig != "gzip on;" ||
+			site.Group != "acme" || site.TLS == nil || site.Capacity == nil {
+			t.Errorf("PATCH %s changed other fields: %+v", body, site)
+		}
+	}
+
+	// Set fields replace, and empty values clear
+	site := patch(`{"aliases": [], "extra_config": "", "group": "", "tls": {}, "capacity": {}}`)
+	if len(site.Aliases) != 0 || site.ExtraConfig != "" || site.Group != "" || site.TLS != nil || site.Capacity != nil {
+		t.Errorf("Empty values didn't clear: %+v", site)
+	}
+	if site.Domain != "a.example.com" || site.Upstreams[0] != "app:8080" {
+		t.Errorf("Clearing changed other fields: %+v", site)
+	}
+	site = patch(`{"group": "other", "extra_config": "gzip off;"}`)
+	if site.Group != "other" || site.ExtraConfig != "gzip off;" {
+		t.Errorf("Set values not applied: %+v", site)
+	}
+
+	// Turning SSL off also drops force_ssl
+	if site := patch(`{"ssl": true, "force_ssl": true}`); !site.SSL || !site.ForceSSL {
+		t.Errorf("SSL not turned on: %+v", site)
+	}
+	if site := patch(`{"ssl": false}`); site.SSL || site.ForceSSL {
+		t.Errorf("SSL not turned off: %+v", site)
+	}
+
+	// A rejected PATCH leaves the stored site as it was
+	before := stored(t, s, "site", "a")
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"upstreams": ["new:80"], "force_ssl": true}`, 400},
+		{`{"upstreams": ["new:80"], "group": "no spaces"}`, 400},
+		{`{"upstreams": ["new:80"], "expiry": {"expires_at": "2000-01-01T00:00:00Z"}}`, 400},
+		{`{"upstreams": ["new:80"], "aliases": ["b.example.com"]}`, 409},
+		{`{"upstreams": ["new:80"], "wildcard": "com"}`, 400},
+		{`{"upstreams": `, 400},
+	} {
+		if rec := serve(s, "PATCH", "/v1/sites/a", tt.body); rec.Code != tt.code {
+			t.Errorf("PATCH %s: got %d, want %d: %s", tt.body, rec.Code, tt.code, rec.Body.String())
+		}
+		if after := stored(t, s, "site", "a"); after != before {
+			t.Errorf("PATCH %s changed the stored site:\n%s\n%s", tt.body, before, after)
+		}
+	}
+	if rec := serve(s, "PATCH", "/v1/sites/missing", `{}`); rec.Code != 404 {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
+
+// eventually fails the test unless cond holds within a second, for work
+// handlers run in the background.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting: %s", what)
+		}
+	}
+}
+
+func TestStreamPatch(t *testing.T) {
+	s := newTestServer(t)
+	if rec := serve(s, "POST", "/v1/streams", `{"id": "db", "listen_port": 30001, "upstream": "db:5432", "group": "acme"}`); rec.Code != 201 {
+		t.Fatalf("POST failed: %d %s", rec.Code, rec.Body.String())
+	}
+	serve(s, "POST", "/v1/streams", `{"id": "cache", "listen_port": 30003, "upstream": "redis:6379"}`)
+	config := func(port int) string {
+		data, _ := os.ReadFile(s.Nginx.StreamConfigFile(port))
+		return string(data)
+	}
+	eventually(t, "stream configs", func() bool {
+		return strings.Contains(config(30001), "db:5432") && strings.Contains(config(30003), "redis:6379")
+	})
+
+	// Moving the stream gives up the old listener
+	rec := serve(s, "PATCH", "/v1/streams/db", `{"listen_port": 30002}`)
+	if rec.Code != 200 {
+		t.Fatalf("PATCH failed: %d %s", rec.Code, rec.Body.String())
+	}
+	eventually(t, "stream moved to 30002", func() bool {
+		_, err := os.Stat(s.Nginx.StreamConfigFile(30001))
+		return os.IsNotExist(err) && strings.Contains(config(30002), "db:5432")
+	})
+	stream, _ := s.Store.GetStream("db")
+	if stream.Upstream != "db:5432" || stream.Group != "acme" {
+		t.Errorf("PATCH changed other fields: %+v", stream)
+	}
+	eventually(t, "stream active", func() bool {
+		stream, _ := s.Store.GetStream("db")
+		return stream.Status == "active"
+	})
+
+	// A rejected PATCH leaves the stored stream as it was
+	before := stored(t, s, "stream", "db")
+	for _, body := range []string{
+		`{"upstream": "new:5432", "listen_port": 80}`,
+		`{"upstream": "new:5432", "listen_port": 70000}`,
+		`{"upstream": "new:5432", "protocol": "sctp"}`,
+		`{"upstream": "new:5432", "group": "no spaces"}`,
+		`{"upstream": "new:5432", "expiry": {"expires_at": "2000-01-01T00:00:00Z"}}`,
+		`{"upstream": `,
+	} {
+		if rec := serve(s, "PATCH", "/v1/streams/db", body); rec.Code != 400 {
+			t.Errorf("PATCH %s: got %d, want 400: %s", body, rec.Code, rec.Body.String())
+		}
+		if after := stored(t, s, "stream", "db"); after != before {
+			t.Errorf("PATCH %s changed the stored stream:\n%s\n%s", body, before, after)
+		}
+	}
+	if !strings.Contains(config(30002), "db:5432") || !strings.Contains(config(30003), "redis:6379") {
+		t.Error("A rejected PATCH changed the stream configs")
+	}
+	if rec := serve(s, "PATCH", "/v1/streams/missing", `{}`); rec.Code != 404 {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// SiteFile is a favicon.ico or robots.txt uploaded for a site's asset
+// shield. Content is base64 in JSON.
+type SiteFile struct {
+	Name      string    `json:"name"`
+	Content   []byte    `json:"content"`
+	Size      int       `json:"size"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Served    bool      `json:"served"` // The site's asset_shield serves this file
+}
+
+// handleSiteFile serves GET, PUT and DELETE on /v1/sites/{id}/files/{name}.
+func (s *Server) handleSiteFile(w http.ResponseWriter, r *http.Request, siteID, name string) {
+	site, err := s.Store.GetSite(siteID)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	if name != nginx.FaviconFile && name != nginx.RobotsFile {
+		errorResponse(w, 404, "unknown file "+name+" (use favicon.ico or robots.txt)")
+		return
+	}
+	path := s.Nginx.SiteFile(siteID, name)
+
+	switch r.Method {
+	case http.MethodGet:
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			errorResponse(w, 404, name+" was not uploaded")
+			return
+		} else if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		f := SiteFile{Name: name, Content: data, Size: len(data), Served: shieldServes(site, name)}
+		if info, err := os.Stat(path); err == nil {
+			f.UpdatedAt = info.ModTime()
+		}
+		jsonResponse(w, 200, f)
+	case http.MethodPut:
+		var input struct {
+			Content []byte `json:"content"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 2*nginx.MaxSiteFileSize)
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if err := s.Nginx.SaveSiteFile(siteID, name, input.Content); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		s.siteFileChanged(r, site, name, "site.file_uploaded")
+		jsonResponse(w, 200, SiteFile{Name: name, Content: input.Content, Size: len(input.Content), UpdatedAt: time.Now(), Served: shieldServes(site, name)})
+	case http.MethodDelete:
+		if err := s.Nginx.DeleteSiteFile(siteID, name); errors.Is(err, fs.ErrNotExist) {
+			errorResponse(w, 404, name+" was not uploaded")
+			return
+		} else if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.siteFileChanged(r, site, name, "site.file_deleted")
+		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// siteFileChanged records an upload or removal and re-renders the site if
+// its asset shield serves the file.
+func (s *Server) siteFileChanged(r *http.Request, site *models.Site, name, action string) {
+	s.Audit.Record(audit.Event{
+		Action:     action,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      actor(r),
+		Details:    map[string]interface{}{"file": name},
+	})
+	if shieldServes(site, name) {
+		siteCopy := *site
+		s.noteConfigChange(site.ID, actor(r), action)
+		go s.refreshSiteConfig(&siteCopy)
+	}
+}
+
+func shieldServes(site *models.Site, name string) bool {
+	a := site.AssetShield
+	return a != nil && (name == nginx.FaviconFile && a.Favicon || name == nginx.RobotsFile && a.Robots)
+}
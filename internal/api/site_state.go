@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/idn"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// computedSiteFields are the site fields hubfly sets itself. They are never
+// part of a site's spec, so a declarative client can diff what it sent
+// against the spec without seeing status changes as drift.
+var computedSiteFields = []string{
+	"status", "error_message", "created_at", "updated_at",
+	"cert_issue_status", "cert_expires_at", "upstream_unreachable",
+	"domain_unicode", "aliases_unicode", "down_upstreams",
+}
+
+// SiteState is a site split into the fields a client sets (Spec, in the
+// shape POST /v1/sites accepts) and those hubfly computes.
+type SiteState struct {
+	ID       string                 `json:"id"`
+	Spec     map[string]interface{} `json:"spec"`
+	Computed map[string]interface{} `json:"computed"`
+}
+
+func siteState(site *models.Site) (SiteState, error) {
+	data, err := json.Marshal(site.Redacted())
+	if err != nil {
+		return SiteState{}, err
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return SiteState{}, err
+	}
+	computed := map[string]interface{}{}
+	for _, k := range computedSiteFields {
+		if v, ok := spec[k]; ok {
+			computed[k] = v
+			delete(spec, k)
+		}
+	}
+	// The balancer owns the effective weights; the configured ones stay.
+	if lb, ok := spec["load_balancing"].(map[string]interface{}); ok {
+		if v, ok := lb["effective_weights"]; ok {
+			computed["effective_weights"] = v
+			delete(lb, "effective_weights")
+		}
+		if len(lb) == 0 {
+			delete(spec, "load_balancing")
+		}
+	}
+	return SiteState{ID: site.ID, Spec: spec, Computed: computed}, nil
+}
+
+// handleSiteState serves GET /v1/sites/{id}/state.
+func (s *Server) handleSiteState(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	state, err := siteState(site)
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	jsonResponse(w, 200, state)
+}
+
+// SiteDrift compares the config a site's stored settings render to with
+// the live file in nginx.
+type SiteDrift struct {
+	ID           string `json:"id"`
+	File         string `json:"file"`
+	Status       string `json:"status"` // The site's status; "provisioning" drifts until applied
+	InSync       bool   `json:"in_sync"`
+	Missing      bool   `json:"missing,omitempty"` // No live file; nothing to diff
+	Diff         string `json:"diff,omitempty"`    // Unified diff from live to desired
+	LinesAdded   int    `json:"lines_added,omitempty"`
+	LinesRemoved int    `json:"lines_removed,omitempty"`
+}
+
+// handleSiteDrift serves GET /v1/sites/{id}/drift. A site out of sync was
+// edited in nginx by hand, failed to apply, or is still being applied;
+// PATCHing it with {} re-applies it.
+func (s *Server) handleSiteDrift(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+	desired, err := s.Nginx.Render(site)
+	if err != nil {
+		errorResponse(w, 500, "render failed: "+err.Error())
+		return
+	}
+
+	file := s.Nginx.SiteConfigFile(site.ID)
+	drift := SiteDrift{ID: site.ID, File: file, Status: site.Status}
+	live, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		drift.Missing = true
+		jsonResponse(w, 200, drift)
+		return
+	}
+	drift.Diff, drift.LinesAdded, drift.LinesRemoved = audit.Diff(site.ID+".conf", string(live), string(desired))
+	drift.InSync = drift.Diff == ""
+	jsonResponse(w, 200, drift)
+}
+
+// filterSitesByDomain keeps the sites serving domain as their domain or an
+// alias, which is how a site is imported by name rather than by ID.
+func filterSitesByDomain(sites []models.Site, domain string) ([]models.Site, error) {
+	name, err := idn.ToASCII(domain)
+	if err != nil {
+		return nil, err
+	}
+	matched := []models.Site{}
+	for _, site := range sites {
+		for _, n := range site.ServerNames() {
+			if strings.EqualFold(n, name) {
+				matched = append(matched, site)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// wantWait reports whether a create or update should answer once the site
+// has been applied, rather than while it is still provisioning.
+func wantWait(r *http.Request) bool {
+	return r.URL.Query().Get("wait") == "true"
+}
+
+// saveCertState stores the certificate fields provisioning set on site.
+// site is the copy provisioning started from; the stored site is re-read so
+// an update made meanwhile is not overwritten with the old settings.
+func (s *Server) saveCertState(site *models.Site) {
+	stored, err := s.Store.GetSite(site.ID)
+	if err != nil {
+		return
+	}
+	stored.SSL = site.SSL
+	stored.CertIssueStatus = site.CertIssueStatus
+	stored.CertExpiresAt = site.CertExpiresAt
+	s.Store.SaveSite(stored)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// Stream health check limits.
+const (
+	maxStreamProbeTimeout = 30
+	maxStreamProbeData    = 1024
+)
+
+// streamHealthKey keeps stream probe results apart from site ones.
+func streamHealthKey(streamID, upstream string) string {
+	return "stream:" + streamID + "|" + upstream
+}
+
+// checkStreamHealth validates a stream's health check.
+func checkStreamHealth(stream *models.Stream) error {
+	hc := stream.HealthCheck
+	if hc == nil {
+		return nil
+	}
+	if hc.Timeout < 0 || hc.Timeout > maxStreamProbeTimeout {
+		return fmt.Errorf("health_check: timeout_seconds must be between 0 and %d", maxStreamProbeTimeout)
+	}
+	if len(hc.Send) > maxStreamProbeData || len(hc.Expect) > maxStreamProbeData {
+		return fmt.Errorf("health_check: send and expect are limited to %d bytes", maxStreamProbeData)
+	}
+	if stream.Protocol == "udp" && hc.Expect != "" && hc.Send == "" {
+		return fmt.Errorf("health_check: udp upstreams only reply to a datagram, set send")
+	}
+	return nil
+}
+
+// streamProbed reports whether the background checker probes stream.
+func streamProbed(stream *models.Stream) bool {
+	hc := stream.HealthCheck
+	if hc != nil && hc.Disabled {
+		return false
+	}
+	return stream.Protocol != "udp" || hc != nil && hc.Send != ""
+}
+
+// probeStream runs the stream's health check against every upstream.
+func (s *Server) probeStream(stream *models.Stream) map[string]health.Stats {
+	timeout := s.Health.Timeout
+	var send, expect string
+	if hc := stream.HealthCheck; hc != nil {
+		send, expect = hc.Send, hc.Expect
+		if hc.Timeout > 0 {
+			timeout = time.Duration(hc.Timeout) * time.Second
+		}
+	}
+	network := "tcp"
+	if stream.Protocol == "udp" {
+		network = "udp"
+	}
+	upstreams := nginx.StreamUpstreams(stream)
+	stats := make(map[string]health.Stats, len(upstreams))
+	for _, u := range upstreams {
+		stats[u] = s.Health.Check(streamHealthKey(stream.ID, u), u, health.StreamProbe(network, u, send, expect, timeout))
+	}
+	return stats
+}
+
+// streamHealth returns the latest probe results for the stream's upstreams.
+func (s *Server) streamHealth(stream *models.Stream) []health.Stats {
+	var list []health.Stats
+	for _, u := range nginx.StreamUpstreams(stream) {
+		if st, ok := s.Health.Get(streamHealthKey(stream.ID, u)); ok {
+			list = append(list, st)
+		}
+	}
+	return list
+}
+
+// streamReachability is the status of an applied stream given its probe
+// results: "unreachable" when no upstream answers, otherwise "active",
+// naming the upstreams nginx fails over from. Upstreams not probed yet
+// count as reachable.
+func streamReachability(upstreams []string, stats map[string]health.Stats) (status, msg string) {
+	var failing []string
+	for _, u := range upstreams {
+		if st, ok := stats[u]; ok && !st.Healthy {
+			failing = append(failing, fmt.Sprintf("%s (%s)", u, st.LastError))
+		}
+	}
+	switch {
+	case len(failing) == 0:
+		return "active", ""
+	case len(failing) == len(upstreams):
+		return "unreachable", "no upstream is reachable: " + strings.Join(failing, ", ")
+	default:
+		return "active", "failing over from unreachable upstreams: " + strings.Join(failing, ", ")
+	}
+}
+
+// streamStatus is the status an applied stream gets from the latest probe
+// results.
+func (s *Server) streamStatus(stream *models.Stream) (status, msg string) {
+	if !streamProbed(stream) {
+		return "active", ""
+	}
+	stats := map[string]health.Stats{}
+	for _, st := range s.streamHealth(stream) {
+		stats[st.Address] = st
+	}
+	return streamReachability(nginx.StreamUpstreams(stream), stats)
+}
+
+// StartStreamHealthChecks probes the upstreams of every applied stream each
+// interval and keeps its status in line with what it can reach.
+func (s *Server) StartStreamHealthChecks(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runStreamHealthChecks()
+		}
+	}()
+}
+
+func (s *Server) runStreamHealthChecks() {
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		slog.Error("Stream health checks failed to list streams", "error", err)
+		return
+	}
+	for i := range streams {
+		stream := &streams[i]
+		// Config errors and pending changes keep their status.
+		if !streamProbed(stream) || stream.Status != "active" && stream.Status != "unreachable" {
+			continue
+		}
+		status, msg := streamReachability(nginx.StreamUpstreams(stream), s.probeStream(stream))
+		if status == stream.Status && msg == stream.ErrorMessage || s.readOnly.Load() {
+			continue
+		}
+		// Re-read, so an update applied meanwhile keeps its status.
+		stored, err := s.Store.GetStream(stream.ID)
+		if err != nil || stored.Status != stream.Status {
+			continue
+		}
+		slog.Info("Stream reachability changed", "stream_id", stream.ID, "status", status, "previous", stream.Status, "message", msg)
+		stored.Status = status
+		stored.ErrorMessage = msg
+		stored.UpdatedAt = time.Now()
+		if err := s.Store.SaveStream(stored); err != nil {
+			slog.Error("Stream health checks failed to save stream", "stream_id", stream.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/logmanager"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// StreamLogs is what GET /v1/streams/{id}/logs returns. Stats cover the
+// returned sessions.
+type StreamLogs struct {
+	StreamID string                      `json:"stream_id"`
+	Port     int                         `json:"port"`
+	Stats    logmanager.StreamLogStats   `json:"stats"`
+	Entries  []logmanager.StreamLogEntry `json:"entries"`
+}
+
+// handleStreamLogs serves GET /v1/streams/{id}/logs: the stream's sessions
+// newest first, with limit, since, until and search as for site logs.
+// Streams sharing a port by SNI only see the sessions of their domain.
+func (s *Server) handleStreamLogs(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	stream, err := s.Store.GetStream(id)
+	if err != nil {
+		errorResponse(w, 404, "stream not found")
+		return
+	}
+	opts, err := parseLogOptions(r.URL.Query())
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	streams, err := s.Store.ListStreams()
+	if err != nil {
+		errorResponse(w, 500, "failed to list streams: "+err.Error())
+		return
+	}
+
+	entries, err := s.LogManager.GetStreamLogs(stream.ListenPort, opts, streamSessions(stream, streams))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errorResponse(w, 500, "failed to read stream logs: "+err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []logmanager.StreamLogEntry{}
+	}
+	jsonResponse(w, 200, StreamLogs{
+		StreamID: stream.ID,
+		Port:     stream.ListenPort,
+		Stats:    logmanager.SummarizeStream(entries),
+		Entries:  entries,
+	})
+}
+
+// streamSessions picks the sessions of stream out of its port's log. A
+// port with one stream logs only its sessions; on a port routed by SNI a
+// stream with a domain gets the sessions naming it, and the default stream
+// the rest.
+func streamSessions(stream *models.Stream, streams []models.Stream) func(logmanager.StreamLogEntry) bool {
+	var others []string
+	for _, o := range streams {
+		if o.ID != stream.ID && o.ListenPort == stream.ListenPort && o.Domain != "" {
+			others = append(others, strings.ToLower(o.Domain))
+		}
+	}
+	if stream.Domain != "" {
+		return func(e logmanager.StreamLogEntry) bool { return strings.EqualFold(e.ServerName, stream.Domain) }
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	return func(e logmanager.StreamLogEntry) bool { return !slices.Contains(others, strings.ToLower(e.ServerName)) }
+}
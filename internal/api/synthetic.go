@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/notify"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/synthetic"
+)
+
+const (
+	// syntheticTick is how often due checks are looked for.
+	syntheticTick = 5 * time.Second
+	// syntheticRetention is how long results are kept.
+	syntheticRetention = 30 * 24 * time.Hour
+)
+
+// Synthetic check states.
+const (
+	syntheticPending = "pending" // Not run yet
+	syntheticUp      = "up"
+	syntheticDown    = "down"
+)
+
+// syntheticChecks tracks the schedule and up/down state of each check.
+type syntheticChecks struct {
+	mu     sync.Mutex
+	checks map[string]*syntheticCheckState // By syntheticKey
+}
+
+type syntheticCheckState struct {
+	next     time.Time
+	running  bool
+	failures int // In a row
+	down     bool
+	last     *synthetic.Result
+}
+
+func syntheticKey(siteID, check string) string {
+	return siteID + "|" + check
+}
+
+func (c *syntheticChecks) state(key string) *syntheticCheckState {
+	if c.checks == nil {
+		c.checks = make(map[string]*syntheticCheckState)
+	}
+	st, ok := c.checks[key]
+	if !ok {
+		st = &syntheticCheckState{}
+		c.checks[key] = st
+	}
+	return st
+}
+
+// forget drops the states of siteID's checks not in keep.
+func (c *syntheticChecks) forget(siteID string, keep []models.SyntheticCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.checks {
+		i := strings.LastIndexByte(key, '|') // Check names have no "|"
+		if key[:i] != siteID {
+			continue
+		}
+		if !slices.ContainsFunc(keep, func(check models.SyntheticCheck) bool { return check.Name == key[i+1:] }) {
+			delete(c.checks, key)
+		}
+	}
+}
+
+// StartSynthetics runs the sites' synthetic checks on their intervals and
+// prunes old results hourly. A standby leaves checking to the primary.
+func (s *Server) StartSynthetics() {
+	go func() {
+		ticker := time.NewTicker(syntheticTick)
+		defer ticker.Stop()
+		var pruned time.Time
+		for now := range ticker.C {
+			if s.readOnly.Load() {
+				continue
+			}
+			s.runDueSynthetics(now)
+			if now.Sub(pruned) >= time.Hour {
+				if err := s.Synthetics.Prune(now.Add(-syntheticRetention)); err != nil {
+					slog.Error("Pruning synthetic check results failed", "error", err)
+				}
+				pruned = now
+			}
+		}
+	}()
+}
+
+// runDueSynthetics starts each check whose interval has passed and that
+// isn't still running.
+func (s *Server) runDueSynthetics(now time.Time) {
+	sites, err := s.Store.ListSites()
+	if err != nil {
+		slog.Error("Synthetic checks failed to list sites", "error", err)
+		return
+	}
+	for i := range sites {
+		site := &sites[i]
+		s.synthetics.forget(site.ID, site.SyntheticChecks)
+		for _, check := range site.SyntheticChecks {
+			s.synthetics.mu.Lock()
+			st := s.synthetics.state(syntheticKey(site.ID, check.Name))
+			due := !st.running && !now.Before(st.next)
+			if due {
+				st.running = true
+				st.next = now.Add(synthetic.Interval(check))
+			}
+			s.synthetics.mu.Unlock()
+			if due {
+				go s.runSynthetic(site, check)
+			}
+		}
+	}
+}
+
+// syntheticHost is the name checks ask nginx for: the first of the site's
+// names that is neither a wildcard nor a regex.
+func syntheticHost(site *models.Site) string {
+	for _, name := range site.ServerNames() {
+		if !nginx.IsWildcardServerName(name) && !nginx.IsRegexServerName(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// runSynthetic runs one check, records its result and, when the check goes
+// down (FailThreshold failures in a row) or comes back up, audits it as
+// synthetic.down or synthetic.up and sends an alert.
+func (s *Server) runSynthetic(site *models.Site, check models.SyntheticCheck) synthetic.Result {
+	var res synthetic.Result
+	if host := syntheticHost(site); host == "" {
+		res = synthetic.Result{Time: time.Now(), Check: check.Name, Error: "site has no literal server name to request"}
+	} else {
+		res = s.SyntheticTarget.Run(context.Background(), host, site.SSL, check)
+	}
+	if err := s.Synthetics.Record(site.ID, res); err != nil {
+		slog.Error("Failed to record synthetic check result", "site_id", site.ID, "check", check.Name, "error", err)
+	}
+
+	s.synthetics.mu.Lock()
+	st := s.synthetics.state(syntheticKey(site.ID, check.Name))
+	st.running = false
+	st.last = &res
+	change := ""
+	if res.OK {
+		st.failures = 0
+		if st.down {
+			st.down, change = false, syntheticUp
+		}
+	} else {
+		st.failures++
+		if !st.down && st.failures >= synthetic.FailThreshold(check) {
+			st.down, change = true, syntheticDown
+		}
+	}
+	failures := st.failures
+	s.synthetics.mu.Unlock()
+
+	if change == "" {
+		return res
+	}
+	details := map[string]interface{}{"check": check.Name, "path": check.Path, "status": res.Status, "latency_ms": res.Latency}
+	msg := fmt.Sprintf("synthetic check %s of site %s is back up", check.Name, site.ID)
+	if change == syntheticDown {
+		details["error"] = res.Error
+		details["failures"] = failures
+		msg = fmt.Sprintf("synthetic check %s of site %s is down: %s", check.Name, site.ID, res.Error)
+		slog.Warn("Synthetic check down", "site_id", site.ID, "check", check.Name, "error", res.Error, "failures", failures)
+	} else {
+		slog.Info("Synthetic check recovered", "site_id", site.ID, "check", check.Name)
+	}
+	s.Audit.Record(audit.Event{
+		Action:     "synthetic." + change,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Details:    details,
+	})
+	s.Notify.Send(notify.Alert{
+		Event:      "synthetic." + change,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Message:    msg,
+		Details:    details,
+	})
+	return res
+}
+
+// SyntheticStatus is a check with its state and uptime.
+type SyntheticStatus struct {
+	models.SyntheticCheck
+	State      string                      `json:"state"` // "pending", "up" or "down"
+	Failures   int                         `json:"consecutive_failures"`
+	LastResult *synthetic.Result           `json:"last_result,omitempty"`
+	Uptime     map[string]synthetic.Uptime `json:"uptime"` // Over "24h", "7d" and "30d"
+}
+
+// SyntheticReport is GET /v1/sites/{id}/synthetics.
+type SyntheticReport struct {
+	SiteID  string             `json:"site_id"`
+	Checks  []SyntheticStatus  `json:"checks"`
+	Results []synthetic.Result `json:"results,omitempty"` // With ?since=
+}
+
+// handleSiteSynthetics serves /v1/sites/{id}/synthetics: GET reports each
+// check's state and uptime, with the individual results since ?since=;
+// POST /run runs every check now and returns the results.
+func (s *Server) handleSiteSynthetics(w http.ResponseWriter, r *http.Request, id string, run bool) {
+	if run && r.Method != http.MethodPost || !run && r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	site, err := s.Store.GetSite(id)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	if run {
+		results := []synthetic.Result{}
+		for _, check := range site.SyntheticChecks {
+			results = append(results, s.runSynthetic(site, check))
+		}
+		jsonResponse(w, 200, results)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			errorResponse(w, 400, "since must be an RFC3339 time")
+			return
+		}
+	}
+	now := time.Now()
+	results, err := s.Synthetics.Results(site.ID, now.Add(-syntheticRetention))
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+
+	report := SyntheticReport{SiteID: site.ID, Checks: []SyntheticStatus{}}
+	for _, check := range site.SyntheticChecks {
+		status := SyntheticStatus{SyntheticCheck: check, State: syntheticPending, Uptime: map[string]synthetic.Uptime{}}
+		for name, window := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "30d": syntheticRetention} {
+			status.Uptime[name] = synthetic.Summarize(results, check.Name, now.Add(-window))
+		}
+		s.synthetics.mu.Lock()
+		if st, ok := s.synthetics.checks[syntheticKey(site.ID, check.Name)]; ok && st.last != nil {
+			status.State, status.Failures, status.LastResult = syntheticUp, st.failures, st.last
+			if st.down {
+				status.State = syntheticDown
+			}
+		}
+		s.synthetics.mu.Unlock()
+		report.Checks = append(report.Checks, status)
+	}
+	if !since.IsZero() {
+		for _, res := range results {
+			if !res.Time.Before(since) {
+				report.Results = append(report.Results, res)
+			}
+		}
+	}
+	jsonResponse(w, 200, report)
+}
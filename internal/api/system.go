@@ -0,0 +1,94 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// SystemInfo is the overview returned by GET /v1/system.
+type SystemInfo struct {
+	Hubfly       HubflyInfo         `json:"hubfly"`
+	Nginx        *nginx.BuildInfo   `json:"nginx"`
+	NginxError   string             `json:"nginx_error,omitempty"`
+	ManagedFiles nginx.ManagedFiles `json:"managed_files"`
+	Resources    ResourceCounts     `json:"resources"`
+	Disk         DiskUsage          `json:"disk"`
+}
+
+type HubflyInfo struct {
+	Version       string    `json:"version"`
+	GoVersion     string    `json:"go_version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	ReadOnly      bool      `json:"read_only"`
+}
+
+type ResourceCounts struct {
+	Sites   int `json:"sites"`
+	Streams int `json:"streams"`
+}
+
+// DiskUsage is in bytes.
+type DiskUsage struct {
+	Logs  int64 `json:"logs_bytes"`
+	Certs int64 `json:"certs_bytes"`
+}
+
+func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	info := SystemInfo{
+		Hubfly: HubflyInfo{
+			Version:       s.Version,
+			GoVersion:     runtime.Version(),
+			StartedAt:     s.started,
+			UptimeSeconds: int64(time.Since(s.started).Seconds()),
+			ReadOnly:      s.readOnly.Load(),
+		},
+		ManagedFiles: s.Nginx.Inventory(),
+		Disk: DiskUsage{
+			Logs: dirSize(s.LogManager.LogDir),
+			// LiveDir only holds symlinks; the lineages live in its parent.
+			Certs: dirSize(filepath.Dir(s.Certbot.LiveDir)),
+		},
+	}
+	if nginxInfo, err := s.Nginx.Info(); err != nil {
+		info.NginxError = err.Error()
+	} else {
+		info.Nginx = nginxInfo
+	}
+	if sites, err := s.Store.ListSites(); err == nil {
+		info.Resources.Sites = len(sites)
+	}
+	if streams, err := s.Store.ListStreams(); err == nil {
+		info.Resources.Streams = len(streams)
+	}
+
+	jsonResponse(w, 200, info)
+}
+
+// dirSize sums the size of the regular files under dir. Unreadable entries
+// are skipped; a missing dir is 0.
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				total += fi.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// TemplateResponse is a template with the sites that include it.
+type TemplateResponse struct {
+	nginx.Template
+	UsedBy []string `json:"used_by"`
+}
+
+// templateUsers returns the sites that list the template.
+func (s *Server) templateUsers(name string) []*models.Site {
+	sites, _ := s.Store.ListSites()
+	var users []*models.Site
+	for i := range sites {
+		if slices.Contains(sites[i].Templates, name) {
+			users = append(users, &sites[i])
+		}
+	}
+	return users
+}
+
+func siteIDs(sites []*models.Site) []string {
+	ids := []string{}
+	for _, site := range sites {
+		ids = append(ids, site.ID)
+	}
+	return ids
+}
+
+// handleTemplates serves GET (?content=true includes each body) and POST
+// on /v1/templates.
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := s.Nginx.ListTemplates()
+		if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		if r.URL.Query().Get("content") == "true" {
+			for i := range templates {
+				if t, err := s.Nginx.GetTemplate(templates[i].Name); err == nil {
+					templates[i] = *t
+				}
+			}
+		}
+		jsonResponse(w, 200, templates)
+	case http.MethodPost:
+		var req struct {
+			Name    string `json:"name"`
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if nginx.IsPreset(req.Name) {
+			errorResponse(w, 409, "template name "+req.Name+" is taken by a built-in preset")
+			return
+		}
+		if _, err := s.Nginx.GetTemplate(req.Name); err == nil {
+			errorResponse(w, 409, "template "+req.Name+" already exists")
+			return
+		}
+		if err := s.Nginx.SaveTemplate(req.Name, req.Content); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "template.created",
+			Resource:   "template",
+			ResourceID: req.Name,
+			Actor:      actor(r),
+		})
+		t, err := s.Nginx.GetTemplate(req.Name)
+		if err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		jsonResponse(w, 201, TemplateResponse{Template: *t, UsedBy: siteIDs(s.templateUsers(req.Name))})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// handleTemplateDetail serves GET, PUT and DELETE on /v1/templates/{name}.
+// Sites that include an updated template are re-rendered and reloaded; a
+// template still in use cannot be deleted.
+func (s *Server) handleTemplateDetail(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/templates/")
+	if name == "builtin" {
+		s.handleBuiltinTemplates(w, r)
+		return
+	}
+	t, err := s.Nginx.GetTemplate(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			errorResponse(w, 404, "template not found")
+		} else {
+			errorResponse(w, 500, err.Error())
+		}
+		return
+	}
+	users := s.templateUsers(name)
+
+	switch r.Method {
+	case http.MethodGet:
+		jsonResponse(w, 200, TemplateResponse{Template: *t, UsedBy: siteIDs(users)})
+	case http.MethodPut:
+		var req struct {
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if err := s.Nginx.SaveTemplate(name, req.Content); err != nil {
+			errorResponse(w, 400, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "template.updated",
+			Resource:   "template",
+			ResourceID: name,
+			Actor:      actor(r),
+			Details:    map[string]interface{}{"sites": siteIDs(users)},
+		})
+		for _, site := range users {
+			slog.Info("Template changed, refreshing site", "template", name, "site_id", site.ID)
+			s.noteConfigChange(site.ID, actor(r), "template.updated:"+name)
+			go s.refreshSiteConfig(site)
+		}
+		if t, err = s.Nginx.GetTemplate(name); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		jsonResponse(w, 200, TemplateResponse{Template: *t, UsedBy: siteIDs(users)})
+	case http.MethodDelete:
+		if len(users) > 0 {
+			errorResponse(w, 409, "template is used by sites: "+strings.Join(siteIDs(users), ", "))
+			return
+		}
+		if err := s.Nginx.DeleteTemplate(name); err != nil {
+			errorResponse(w, 500, err.Error())
+			return
+		}
+		s.Audit.Record(audit.Event{
+			Action:     "template.deleted",
+			Resource:   "template",
+			ResourceID: name,
+			Actor:      actor(r),
+		})
+		jsonResponse(w, 200, map[string]string{"status": "deleted"})
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+// BuiltinTemplate is a preset with the config it produces for an example
+// site and the sites using any of its versions.
+type BuiltinTemplate struct {
+	nginx.Preset
+	Versions []int    `json:"versions"`
+	Example  string   `json:"example"`
+	UsedBy   []string `json:"used_by"`
+}
+
+// handleBuiltinTemplates serves GET /v1/templates/builtin.
+func (s *Server) handleBuiltinTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	sites, _ := s.Store.ListSites()
+	builtin := []BuiltinTemplate{}
+	for _, p := range nginx.Presets() {
+		example, err := s.Nginx.Render(&models.Site{
+			ID:        "example.com",
+			Domain:    "example.com",
+			Upstreams: []string{"app:8080"},
+			Templates: []string{p.Name + "@" + strconv.Itoa(p.Version)},
+		})
+		if err != nil {
+			errorResponse(w, 500, "render "+p.Name+": "+err.Error())
+			return
+		}
+		users := []string{}
+		for _, site := range sites {
+			if slices.ContainsFunc(site.Templates, func(t string) bool {
+				name, _, _ := strings.Cut(t, "@")
+				return name == p.Name
+			}) {
+				users = append(users, site.ID)
+			}
+		}
+		builtin = append(builtin, BuiltinTemplate{
+			Preset:   p,
+			Versions: nginx.PresetVersions(p.Name),
+			Example:  string(example),
+			UsedBy:   users,
+		})
+	}
+	jsonResponse(w, 200, builtin)
+}
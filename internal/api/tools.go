@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+)
+
+// maxVerifyDomains caps one verification request.
+const maxVerifyDomains = 500
+
+// VerifyDomainsRequest is POST /v1/tools/verify-domains.
+type VerifyDomainsRequest struct {
+	Domains    []string `json:"domains"`
+	ACMEServer string   `json:"acme_server,omitempty"` // CA whose CAA identities are checked (default: the configured one)
+}
+
+// VerifyDomainsResponse reports every domain, in request order.
+type VerifyDomainsResponse struct {
+	Total   int                   `json:"total"`
+	Ready   int                   `json:"ready"`
+	Results []certbot.DomainCheck `json:"results"`
+}
+
+// handleVerifyDomains pre-flights domains before they are moved here: DNS,
+// ports 80 and 443, CAA and existing certificates, without creating sites.
+func (s *Server) handleVerifyDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	var req VerifyDomainsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, 400, "invalid json")
+		return
+	}
+	if len(req.Domains) == 0 || len(req.Domains) > maxVerifyDomains {
+		errorResponse(w, 400, "domains must list 1 to 500 domains")
+		return
+	}
+	domains, err := asciiNames(req.Domains)
+	if err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+
+	results, err := s.Certbot.VerifyDomains(domains, req.ACMEServer)
+	if err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	resp := VerifyDomainsResponse{Total: len(results), Results: results}
+	for _, res := range results {
+		if res.Ready {
+			resp.Ready++
+		}
+	}
+	jsonResponse(w, 200, resp)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/health"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// wantUpstreamCheck reports whether the request opted into verifying its
+// upstreams with ?check_upstream=true.
+func wantUpstreamCheck(r *http.Request) bool {
+	return r.URL.Query().Get("check_upstream") == "true"
+}
+
+// checkUpstreams probes the upstreams concurrently and returns a warning
+// for each one that does not answer. With httpCheck any HTTP response
+// counts; the point is to catch typos and stopped containers before nginx
+// starts returning 502s, not to judge the application.
+func (s *Server) checkUpstreams(upstreams []string, httpCheck bool) []nginx.LintWarning {
+	errs := make([]error, len(upstreams))
+	var wg sync.WaitGroup
+	for i, u := range upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errs[i] = health.TCPProbe(u, s.Health.Timeout)(); errs[i] == nil && httpCheck {
+				errs[i] = health.HTTPAnswerProbe(u, s.Health.Timeout)()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var warnings []nginx.LintWarning
+	for i, err := range errs {
+		if err != nil {
+			warnings = append(warnings, nginx.LintWarning{
+				Rule:    "upstream_unreachable",
+				Message: fmt.Sprintf("upstream %s did not answer: %v", upstreams[i], err),
+			})
+		}
+	}
+	return warnings
+}
+
+// checkSiteUpstreams records on the site whether its upstreams answered.
+func (s *Server) checkSiteUpstreams(site *models.Site) []nginx.LintWarning {
+	upstreams := site.Upstreams
+	if site.CanaryRelease != nil {
+		upstreams = append(slices.Clip(upstreams), site.CanaryRelease.Upstream)
+	}
+	// A plain HTTP request to a TLS upstream may go unanswered, so those
+	// are only dialled.
+	warnings := s.checkUpstreams(upstreams, site.UpstreamTLS == nil)
+	site.UpstreamUnreachable = len(warnings) > 0
+	return warnings
+}
+
+// checkStreamUpstream records on the stream whether its upstreams accept
+// connections. UDP cannot be verified without speaking the protocol.
+func (s *Server) checkStreamUpstream(stream *models.Stream) []nginx.LintWarning {
+	if stream.Protocol == "udp" {
+		return nil
+	}
+	warnings := s.checkUpstreams(nginx.StreamUpstreams(stream), false)
+	stream.UpstreamUnreachable = len(warnings) > 0
+	return warnings
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// usageFlushInterval is how often usage is written to the store.
+	usageFlushInterval = time.Minute
+	// maxRecentRequests is how many recent requests are kept per key.
+	maxRecentRequests = 20
+)
+
+// KeyRequest is one request made with an API key.
+type KeyRequest struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	Remote string    `json:"remote"`
+}
+
+// KeyUsage is returned by GET /v1/apikeys/{id}/usage.
+type KeyUsage struct {
+	KeyID        string           `json:"key_id"`
+	Name         string           `json:"name"`
+	RequestCount int64            `json:"request_count"`
+	LastUsedAt   *time.Time       `json:"last_used_at,omitempty"`
+	Endpoints    map[string]int64 `json:"endpoints"` // Since the server started
+	Recent       []KeyRequest     `json:"recent"`
+}
+
+type keyUsage struct {
+	pending   int64 // Requests not yet added to the stored count
+	lastUsed  time.Time
+	endpoints map[string]int64
+	recent    []KeyRequest
+}
+
+// usageTracker counts requests per API key. Counts and last-used times are
+// flushed to the store every usageFlushInterval and on shutdown, see
+// StartUsageFlush; endpoint breakdowns and recent requests are kept in
+// memory only.
+type usageTracker struct {
+	mu   sync.Mutex
+	keys map[string]*keyUsage
+}
+
+func (u *usageTracker) record(keyID string, req KeyRequest) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.keys == nil {
+		u.keys = make(map[string]*keyUsage)
+	}
+	ku, ok := u.keys[keyID]
+	if !ok {
+		ku = &keyUsage{endpoints: make(map[string]int64)}
+		u.keys[keyID] = ku
+	}
+	ku.pending++
+	ku.lastUsed = req.Time
+	ku.endpoints[req.Method+" "+routePattern(req.Path)]++
+	ku.recent = append(ku.recent, req)
+	if len(ku.recent) > maxRecentRequests {
+		ku.recent = ku.recent[len(ku.recent)-maxRecentRequests:]
+	}
+}
+
+// take returns and resets the pending count for keyID.
+func (u *usageTracker) take(keyID string) (int64, time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ku, ok := u.keys[keyID]
+	if !ok {
+		return 0, time.Time{}
+	}
+	n := ku.pending
+	ku.pending = 0
+	return n, ku.lastUsed
+}
+
+// pendingKeys lists the keys with usage not yet flushed.
+func (u *usageTracker) pendingKeys() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var ids []string
+	for id, ku := range u.keys {
+		if ku.pending > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (u *usageTracker) snapshot(keyID string) (pending int64, lastUsed time.Time, endpoints map[string]int64, recent []KeyRequest) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	endpoints = make(map[string]int64)
+	recent = []KeyRequest{}
+	ku, ok := u.keys[keyID]
+	if !ok {
+		return 0, time.Time{}, endpoints, recent
+	}
+	for k, v := range ku.endpoints {
+		endpoints[k] = v
+	}
+	// Newest first
+	for i := len(ku.recent) - 1; i >= 0; i-- {
+		recent = append(recent, ku.recent[i])
+	}
+	return ku.pending, ku.lastUsed, endpoints, recent
+}
+
+func (u *usageTracker) forget(keyID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.keys, keyID)
+}
+
+// routePattern replaces resource IDs so /v1/sites/a/logs and
+// /v1/sites/b/logs count as the same endpoint.
+func routePattern(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 3 {
+		parts[2] = "{id}"
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// recordKeyUsage is called by the auth middleware after a request made
+// with an API key has been served.
+func (s *Server) recordKeyUsage(p *Principal, r *http.Request, status int) {
+	if p == nil || p.KeyID == "" {
+		return
+	}
+	s.usage.record(p.KeyID, KeyRequest{
+		Time:   time.Now(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+		Remote: r.RemoteAddr,
+	})
+}
+
+// StartUsageFlush writes API key usage to the store every
+// usageFlushInterval. Call FlushKeyUsage on shutdown for the rest.
+func (s *Server) StartUsageFlush() {
+	go func() {
+		ticker := time.NewTicker(usageFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.FlushKeyUsage()
+		}
+	}()
+}
+
+// FlushKeyUsage writes the pending usage of every key to the store.
+func (s *Server) FlushKeyUsage() {
+	for _, id := range s.usage.pendingKeys() {
+		s.flushKeyUsage(id)
+	}
+}
+
+// flushKeyUsage adds keyID's pending usage to the stored key. The key is
+// re-read under keysMu, so only the usage fields change: a rotation, role
+// change or deletion made since is kept.
+func (s *Server) flushKeyUsage(keyID string) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	n, lastUsed := s.usage.take(keyID)
+	if n == 0 {
+		return
+	}
+	key, err := s.Store.GetAPIKey(keyID)
+	if err != nil {
+		return // Deleted meanwhile
+	}
+	key.RequestCount += n
+	key.LastUsedAt = &lastUsed
+	if err := s.Store.SaveAPIKey(key); err != nil {
+		slog.Warn("Failed to persist api key usage", "key_id", keyID, "error", err)
+	}
+}
+
+func (s *Server) handleAPIKeyUsage(w http.ResponseWriter, r *http.Request, keyID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	key, err := s.Store.GetAPIKey(keyID)
+	if err != nil {
+		errorResponse(w, 404, "api key not found")
+		return
+	}
+
+	pending, lastUsed, endpoints, recent := s.usage.snapshot(keyID)
+	resp := KeyUsage{
+		KeyID:        key.ID,
+		Name:         key.Name,
+		RequestCount: key.RequestCount + pending,
+		LastUsedAt:   key.LastUsedAt,
+		Endpoints:    endpoints,
+		Recent:       recent,
+	}
+	if !lastUsed.IsZero() {
+		resp.LastUsedAt = &lastUsed
+	}
+	jsonResponse(w, 200, resp)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+func TestFlushKeyUsage(t *testing.T) {
+	s := newTestServer(t)
+	s.AdminToken = "admin"
+	key := &models.APIKey{ID: "k1", Name: "ci", Role: models.RoleViewer, SecretHash: hashSecret("secret")}
+	s.Store.SaveAPIKey(key)
+
+	// A key used once is saved by the periodic flush
+	if rec := serveAs(s, tokenPrefix+"k1.secret", "GET", "/v1/sites", ""); rec.Code != 200 {
+		t.Fatalf("Request failed: %d %s", rec.Code, rec.Body.String())
+	}
+	s.FlushKeyUsage()
+	stored, _ := s.Store.GetAPIKey("k1")
+	if stored.RequestCount != 1 || stored.LastUsedAt == nil {
+		t.Fatalf("Usage not flushed: count %d, last used %v", stored.RequestCount, stored.LastUsedAt)
+	}
+
+	// Usage recorded before a rotation and role change doesn't undo them
+	s.recordKeyUsage(&Principal{KeyID: "k1"}, httptest.NewRequest("GET", "/v1/sites", nil), 200)
+	if rec := serveAs(s, "admin", "PATCH", "/v1/apikeys/k1", `{"role": "sites-admin"}`); rec.Code != 200 {
+		t.Fatalf("PATCH failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAs(s, "admin", "POST", "/v1/apikeys/k1/rotate", ""); rec.Code != 200 {
+		t.Fatalf("Rotate failed: %d %s", rec.Code, rec.Body.String())
+	}
+	s.FlushKeyUsage()
+	stored, _ = s.Store.GetAPIKey("k1")
+	if stored.RequestCount != 2 || stored.Role != models.RoleSitesAdmin || stored.SecretHash == hashSecret("secret") {
+		t.Errorf("Flush saved a stale key: count %d, role %s, rotated %v", stored.RequestCount, stored.Role, stored.SecretHash != hashSecret("secret"))
+	}
+
+	// Nor revives a deleted key
+	s.recordKeyUsage(&Principal{KeyID: "k1"}, httptest.NewRequest("GET", "/v1/sites", nil), 200)
+	serveAs(s, "admin", "DELETE", "/v1/apikeys/k1", "")
+	s.FlushKeyUsage()
+	if _, err := s.Store.GetAPIKey("k1"); err == nil {
+		t.Error("Flush revived a deleted key")
+	}
+}
+
+// slowRead delays the first key read, so a rotation starts while a flush
+// holds the key it read.
+type slowRead struct {
+	store.Store
+	once sync.Once
+}
+
+func (s *slowRead) GetAPIKey(id string) (*models.APIKey, error) {
+	key, err := s.Store.GetAPIKey(id)
+	s.once.Do(func() { time.Sleep(50 * time.Millisecond) })
+	return key, err
+}
+
+func TestFlushKeyUsageConcurrentRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.AdminToken = "admin"
+	s.Store.SaveAPIKey(&models.APIKey{ID: "k1", Name: "ci", Role: models.RoleViewer, SecretHash: hashSecret("secret")})
+	s.recordKeyUsage(&Principal{KeyID: "k1"}, httptest.NewRequest("GET", "/v1/sites", nil), 200)
+	s.Store = &slowRead{Store: s.Store}
+
+	done := make(chan struct{})
+	go func() {
+		s.FlushKeyUsage()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if rec := serveAs(s, "admin", "POST", "/v1/apikeys/k1/rotate", ""); rec.Code != 200 {
+		t.Fatalf("Rotate failed: %d %s", rec.Code, rec.Body.String())
+	}
+	<-done
+
+	stored, _ := s.Store.GetAPIKey("k1")
+	if stored.SecretHash == hashSecret("secret") {
+		t.Error("The flush saved the key from before the rotation")
+	}
+	if stored.RequestCount != 1 {
+		t.Errorf("Expected the flushed count, got %d", stored.RequestCount)
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/synthetic"
+)
+
+// validateSiteRules checks the redirect and rewrite rules, connection
+// hygiene, security headers, WAF, protocol, websocket, HTTP/3, TLS, client
+// auth, body size, keepalive, upstream host and TLS, capture, JWT gate,
+// static asset, error interception, asset shield, drain, rate schedule,
+// cache, synthetic check and country rules of a site, which would
+// otherwise only fail when its config is rendered or loaded (or, for
+// synthetic checks, when they run), and its group.
+func (s *Server) validateSiteRules(site *models.Site) error {
+	if err := checkGroup(site.Group); err != nil {
+		return err
+	}
+	if err := nginx.CheckRedirects(site.Redirects); err != nil {
+		return err
+	}
+	if err := nginx.CheckHygiene(site.Hygiene); err != nil {
+		return err
+	}
+	if err := nginx.CheckSecurityHeaders(site.SecurityHeaders); err != nil {
+		return err
+	}
+	if err := nginx.CheckWAF(site.WAF); err != nil {
+		return err
+	}
+	if err := nginx.CheckCanary(site.Canary); err != nil {
+		return err
+	}
+	if err := nginx.CheckCanaryRelease(site.CanaryRelease); err != nil {
+		return err
+	}
+	if err := nginx.CheckTrafficMirror(site.TrafficMirror); err != nil {
+		return err
+	}
+	if err := nginx.CheckProtocol(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckWebSockets(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckRateSchedules(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckCache(site); err != nil {
+		return err
+	}
+	if err := synthetic.Validate(site.SyntheticChecks); err != nil {
+		return err
+	}
+	if site.HTTP3 {
+		if !site.SSL {
+			return fmt.Errorf("http3 requires ssl")
+		}
+		if err := s.Nginx.SupportsHTTP3(); err != nil {
+			return err
+		}
+	}
+	if err := nginx.CheckTLS(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckClientAuth(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckBodySize(site.ClientMaxBodySize); err != nil {
+		return err
+	}
+	if err := nginx.CheckKeepalive(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckUpstreamHost(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckUpstreamTLS(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckCapture(site.Capture); err != nil {
+		return err
+	}
+	if err := nginx.CheckJWTGate(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckStaticAssets(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckInterceptErrors(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckAssetShield(site); err != nil {
+		return err
+	}
+	if err := nginx.CheckDrain(site); err != nil {
+		return err
+	}
+	if site.KeyRotationDays < 0 {
+		return fmt.Errorf("key_rotation_days must not be negative")
+	}
+	if site.Firewall != nil && site.Firewall.Countries != nil {
+		if err := nginx.CheckCountries(site.Firewall.Countries); err != nil {
+			return err
+		}
+		if s.Nginx.GeoIPDB == "" {
+			return fmt.Errorf("firewall countries need a GeoIP database (--geoip-db)")
+		}
+	}
+	return nginx.CheckRewrites(site.Rewrites)
+}
+
+// validateStream checks a stream before it is saved. existing is the current
+// set of streams, which may include the stream's previous version.
+func (s *Server) validateStream(stream *models.Stream, existing []models.Stream) error {
+	if err := s.Ports.Check(stream, existing); err != nil {
+		return err
+	}
+	if err := checkGroup(stream.Group); err != nil {
+		return err
+	}
+	if err := nginx.CheckStreamUpstreams(stream); err != nil {
+		return err
+	}
+	if err := nginx.CheckStreamTimeouts(stream); err != nil {
+		return err
+	}
+	if err := nginx.CheckStreamUDP(stream); err != nil {
+		return err
+	}
+	if err := checkStreamHealth(stream); err != nil {
+		return err
+	}
+	if stream.BindAddress != "" {
+		ip := net.ParseIP(stream.BindAddress)
+		if ip == nil {
+			return fmt.Errorf("invalid bind_address %q: must be an IP address", stream.BindAddress)
+		}
+		if !ip.IsUnspecified() && !isLocalAddress(ip) {
+			return fmt.Errorf("bind_address %s is not assigned to any interface on this host", stream.BindAddress)
+		}
+	}
+
+	// Streams on one port are rendered into a single listener, so they
+	// must agree on where it binds and on its timeouts.
+	for _, other := range existing {
+		if other.ID == stream.ID || other.ListenPort != stream.ListenPort {
+			continue
+		}
+		if other.Protocol == "udp" || stream.Protocol == "udp" {
+			return fmt.Errorf("port %d is used by stream %s; udp streams can't share a port (SNI routing needs tcp)", stream.ListenPort, other.ID)
+		}
+		if other.BindAddress != stream.BindAddress {
+			return fmt.Errorf("port %d is already bound to %q by stream %s", stream.ListenPort, displayBind(other.BindAddress), other.ID)
+		}
+		if !nginx.SameStreamTimeouts(&other, stream) {
+			return fmt.Errorf("port %d is shared with stream %s, which uses different timeouts", stream.ListenPort, other.ID)
+		}
+	}
+	return nil
+}
+
+// isLocalAddress reports whether ip is configured on one of the host's interfaces.
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func displayBind(addr string) string {
+	if addr == "" {
+		return "all interfaces"
+	}
+	return addr
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/audit"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// handleSiteWAF serves /v1/sites/{id}/waf (GET, PUT) and its exclusions:
+// POST /v1/sites/{id}/waf/exclusions adds one, DELETE
+// /v1/sites/{id}/waf/exclusions/{rule_id} removes a rule's exclusions
+// (only the one for ?path= when given).
+func (s *Server) handleSiteWAF(w http.ResponseWriter, r *http.Request, siteID, rest string) {
+	site, err := s.Store.GetSite(siteID)
+	if err != nil {
+		errorResponse(w, 404, "site not found")
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		if site.WAF == nil {
+			jsonResponse(w, 200, models.WAF{})
+			return
+		}
+		jsonResponse(w, 200, site.WAF)
+	case rest == "" && r.Method == http.MethodPut:
+		var waf models.WAF
+		if err := json.NewDecoder(r.Body).Decode(&waf); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		site.WAF = &waf
+		s.saveSiteWAF(w, r, site, "site.waf_updated", map[string]interface{}{"enabled": waf.Enabled, "paranoia": waf.Paranoia})
+	case rest == "/exclusions" && r.Method == http.MethodPost:
+		var e models.WAFExclusion
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			errorResponse(w, 400, "invalid json")
+			return
+		}
+		if site.WAF == nil {
+			site.WAF = &models.WAF{}
+		}
+		site.WAF.RuleExclusions = append(site.WAF.RuleExclusions, e)
+		s.saveSiteWAF(w, r, site, "site.waf_exclusion_added", map[string]interface{}{"rule_id": e.RuleID, "path": e.Path, "reason": e.Reason})
+	case strings.HasPrefix(rest, "/exclusions/") && r.Method == http.MethodDelete:
+		ruleID, err := strconv.Atoi(strings.TrimPrefix(rest, "/exclusions/"))
+		if err != nil {
+			errorResponse(w, 400, "invalid rule id")
+			return
+		}
+		path, scoped := r.URL.Query().Get("path"), r.URL.Query().Has("path")
+		var kept []models.WAFExclusion
+		if site.WAF != nil {
+			for _, e := range site.WAF.RuleExclusions {
+				if e.RuleID != ruleID || (scoped && e.Path != path) {
+					kept = append(kept, e)
+				}
+			}
+		}
+		if site.WAF == nil || len(kept) == len(site.WAF.RuleExclusions) {
+			errorResponse(w, 404, "exclusion not found")
+			return
+		}
+		site.WAF.RuleExclusions = kept
+		s.saveSiteWAF(w, r, site, "site.waf_exclusion_removed", map[string]interface{}{"rule_id": ruleID, "path": path})
+	case rest == "" || rest == "/exclusions" || strings.HasPrefix(rest, "/exclusions/"):
+		http.Error(w, "method not allowed", 405)
+	default:
+		errorResponse(w, 404, "not found")
+	}
+}
+
+// saveSiteWAF validates and stores a site's changed WAF and re-renders it.
+func (s *Server) saveSiteWAF(w http.ResponseWriter, r *http.Request, site *models.Site, action string, details map[string]interface{}) {
+	if err := nginx.CheckWAF(site.WAF); err != nil {
+		errorResponse(w, 400, err.Error())
+		return
+	}
+	site.UpdatedAt = time.Now()
+	if err := s.Store.SaveSite(site); err != nil {
+		errorResponse(w, 500, err.Error())
+		return
+	}
+	s.Audit.Record(audit.Event{
+		Action:     action,
+		Resource:   "site",
+		ResourceID: site.ID,
+		Actor:      actor(r),
+		Details:    details,
+	})
+
+	siteCopy := *site
+	s.noteConfigChange(site.ID, actor(r), action)
+	go s.refreshSiteConfig(&siteCopy)
+	jsonResponse(w, 200, site.WAF)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/store"
+)
+
+// Long-poll timeouts of GET /v1/watch.
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+)
+
+// WatchResponse is a long-poll answer: the events after since, and the
+// revision to pass as since next time.
+type WatchResponse struct {
+	Revision uint64              `json:"revision"`
+	Events   []store.ChangeEvent `json:"events"`
+}
+
+// handleWatch serves GET /v1/watch: the site and stream changes after
+// ?since=, a revision from an earlier answer. Without since it starts from
+// the current revision. Plain requests long-poll, returning as soon as
+// there are events or after ?timeout= seconds; ?stream=true (or an
+// Accept: text/event-stream) streams them as Server-Sent Events, resuming
+// from Last-Event-ID. A revision that can no longer be resumed from gets
+// 410 Gone: list the resources again and watch from X-Hubfly-Revision.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+	q := r.URL.Query()
+	resources := map[string]bool{}
+	for _, name := range strings.Split(q.Get("resource"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case store.ResourceSites, store.ResourceStreams:
+			resources[name] = true
+		default:
+			errorResponse(w, 400, "resource must be sites or streams")
+			return
+		}
+	}
+	if len(resources) == 0 {
+		resources[store.ResourceSites], resources[store.ResourceStreams] = true, true
+	}
+
+	since := s.Watch.Revision()
+	if v := q.Get("since"); v != "" || r.Header.Get("Last-Event-ID") != "" {
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			v = id
+		}
+		rev, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			errorResponse(w, 400, "since must be a revision number")
+			return
+		}
+		since = rev
+	}
+	w.Header().Set("X-Hubfly-Revision", strconv.FormatUint(s.Watch.Revision(), 10))
+
+	if q.Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamWatch(w, r, since, resources)
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if v := q.Get("timeout"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 || time.Duration(secs)*time.Second > maxWatchTimeout {
+			errorResponse(w, 400, fmt.Sprintf("timeout must be 0 to %d seconds", int(maxWatchTimeout.Seconds())))
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		events, changed, ok := s.Watch.Since(since)
+		if !ok {
+			errorResponse(w, 410, watchGone(since))
+			return
+		}
+		matched := filterEvents(events, resources)
+		if len(events) > 0 {
+			since = events[len(events)-1].Revision
+		}
+		if len(matched) > 0 {
+			jsonResponse(w, 200, WatchResponse{Revision: since, Events: matched})
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			jsonResponse(w, 200, WatchResponse{Revision: since, Events: []store.ChangeEvent{}})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// streamWatch writes each event as an SSE event named after its type, with
+// the revision as its id, until the client goes away.
+func (s *Server) streamWatch(w http.ResponseWriter, r *http.Request, since uint64, resources map[string]bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorResponse(w, 500, "streaming not supported")
+		return
+	}
+	if _, _, ok := s.Watch.Since(since); !ok {
+		errorResponse(w, 410, watchGone(since))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, changed, ok := s.Watch.Since(since)
+		if !ok {
+			// The client fell too far behind; it must list again.
+			fmt.Fprintf(w, "event: expired\ndata: %q\n\n", watchGone(since))
+			flusher.Flush()
+			return
+		}
+		for _, e := range filterEvents(events, resources) {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Revision, e.Type, data)
+		}
+		if len(events) > 0 {
+			since = events[len(events)-1].Revision
+			flusher.Flush()
+		}
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func filterEvents(events []store.ChangeEvent, resources map[string]bool) []store.ChangeEvent {
+	var matched []store.ChangeEvent
+	for _, e := range events {
+		if resources[e.Resource] {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+func watchGone(since uint64) string {
+	return fmt.Sprintf("revision %d is no longer available; list again and watch from X-Hubfly-Revision", since)
+}
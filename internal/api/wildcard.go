@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/certbot"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/nginx"
+)
+
+// wildcardCovers reports whether *.zone (plus the zone apex, which the
+// shared certificate always includes) is valid for name. A wildcard covers
+// a single label only.
+func wildcardCovers(zone, name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(zone)
+	if name == zone {
+		return true
+	}
+	label, ok := strings.CutSuffix(name, "."+zone)
+	return ok && label != "" && !strings.Contains(label, ".")
+}
+
+// certNames returns the server names a certificate must cover. Regex
+// names can't be checked against one and are left out.
+func certNames(site *models.Site) []string {
+	var names []string
+	for _, name := range site.ServerNames() {
+		if !nginx.IsRegexServerName(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validateWildcard checks that every server name of a wildcard site is
+// covered by the shared certificate, and that it can be issued. An SSL site
+// with a "*.zone" name and no wildcard zone gets that zone, since only
+// DNS-01 can issue for it.
+func (s *Server) validateWildcard(site *models.Site) error {
+	if site.Wildcard == "" && site.SSL {
+		for _, name := range site.ServerNames() {
+			if nginx.IsWildcardServerName(name) {
+				site.Wildcard = strings.TrimPrefix(name, "*.")
+				break
+			}
+		}
+	}
+	if site.Wildcard == "" {
+		for _, name := range site.ServerNames() {
+			if site.SSL && nginx.IsRegexServerName(name) {
+				return fmt.Errorf("regex server name %s needs a wildcard certificate; set wildcard to the zone it matches", name)
+			}
+		}
+		return nil
+	}
+	zone := strings.TrimPrefix(site.Wildcard, "*.")
+	if !strings.Contains(zone, ".") {
+		return fmt.Errorf("wildcard zone %q must be a domain such as example.com", site.Wildcard)
+	}
+	site.Wildcard = zone
+	for _, name := range certNames(site) {
+		if !wildcardCovers(zone, name) {
+			return fmt.Errorf("%s is not covered by *.%s", name, zone)
+		}
+	}
+	if site.SSL && !s.Certbot.DNSEnabled() && !s.Certbot.LineageCovers(site.CertName(), certNames(site)...) {
+		return fmt.Errorf("wildcard certificates require DNS-01; start hubfly with --dns-plugin")
+	}
+	return nil
+}
+
+// wildcardUsers returns the other sites serving the same wildcard lineage.
+func (s *Server) wildcardUsers(site *models.Site) []string {
+	if site.Wildcard == "" {
+		return nil
+	}
+	sites, _ := s.Store.ListSites()
+	var ids []string
+	for _, other := range sites {
+		if other.ID != site.ID && other.SSL && other.CertName() == site.CertName() {
+			ids = append(ids, other.ID)
+		}
+	}
+	return ids
+}
+
+// provisionWildcard attaches the shared *.zone certificate, issuing it over
+// DNS-01 first when no other site has. DNS-01 needs no HTTP-only pass.
+func (s *Server) provisionWildcard(site *models.Site) {
+	lineage := site.CertName()
+
+	s.wildcardMu.Lock()
+	if !s.Certbot.LineageCovers(lineage, certNames(site)...) {
+		slog.Info("Issuing wildcard certificate", "site_id", site.ID, "zone", site.Wildcard, "cert_name", lineage)
+		s.updateStatus(site.ID, "provisioning", "issuing wildcard certificate")
+
+		opts := issueOptions(site)
+		opts.AltNames = []string{site.Wildcard}
+		opts.CertName = lineage
+		opts.Challenge = certbot.ChallengeDNS01
+		if err := s.Certbot.Issue("*."+site.Wildcard, opts); err != nil {
+			s.wildcardMu.Unlock()
+			slog.Error("Wildcard certificate issuance failed", "site_id", site.ID, "zone", site.Wildcard, "error", err)
+			s.updateStatus(site.ID, "cert-failed", err.Error())
+			return
+		}
+	} else {
+		slog.Info("Using shared wildcard certificate", "site_id", site.ID, "cert_name", lineage)
+	}
+	s.wildcardMu.Unlock()
+
+	s.markCertValid(site)
+	s.saveCertState(site)
+	s.applySSLConfig(site)
+}
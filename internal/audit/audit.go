@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConfigApplied is the action of the events that make up a site's config
+// history.
+const ConfigApplied = "site.config_applied"
+
+// Event is a single entry in the audit trail.
+type Event struct {
+	Time       time.Time              `json:"time"`
+	Action     string                 `json:"action"`   // e.g. "logs.purged"
+	Resource   string                 `json:"resource"` // "site", "stream", ...
+	ResourceID string                 `json:"resource_id,omitempty"`
+	Actor      string                 `json:"actor,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// Filter narrows down List results. Zero values match everything.
+type Filter struct {
+	Resource   string
+	ResourceID string
+	Action     string
+	Since      time.Time
+	Limit      int
+}
+
+// Logger appends events to a JSON-lines file.
+type Logger struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLogger(path string) *Logger {
+	return &Logger{path: path}
+}
+
+// Record appends an event. A nil Logger discards events.
+func (l *Logger) Record(e Event) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// List returns matching events, newest first.
+func (l *Logger) List(filter Filter) ([]Event, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return []Event{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if !filter.matches(e) {
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reverse to newest first, then apply limit
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+func (f Filter) matches(e Event) bool {
+	if f.Resource != "" && e.Resource != f.Resource {
+		return false
+	}
+	if f.ResourceID != "" && e.ResourceID != f.ResourceID {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Retention bounds the audit trail. Zero values keep everything.
+type Retention struct {
+	MaxAge         time.Duration // Drop events older than this
+	MaxEvents      int           // Keep only the newest MaxEvents events
+	ConfigVersions int           // Keep only the newest ConfigVersions ConfigApplied events per site
+}
+
+// PruneResult reports what Prune removed.
+type PruneResult struct {
+	Removed     int   `json:"removed"`
+	Kept        int   `json:"kept"`
+	BytesBefore int64 `json:"bytes_before"`
+	BytesAfter  int64 `json:"bytes_after"`
+}
+
+// Prune rewrites the log without the events r doesn't keep. Lines that
+// aren't events are dropped too.
+func (l *Logger) Prune(r Retention, now time.Time) (PruneResult, error) {
+	var res PruneResult
+	if l == nil {
+		return res, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	res.BytesBefore = int64(len(data))
+
+	type line struct {
+		raw   []byte
+		event Event
+	}
+	var lines []line
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			res.Removed++
+			continue
+		}
+		lines = append(lines, line{raw: append([]byte(nil), scanner.Bytes()...), event: e})
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+
+	// Walk newest first so the count limits keep the latest events.
+	keep := make([]bool, len(lines))
+	versions := map[string]int{}
+	kept := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		e := lines[i].event
+		if r.MaxAge > 0 && e.Time.Before(now.Add(-r.MaxAge)) {
+			continue
+		}
+		if r.MaxEvents > 0 && kept >= r.MaxEvents {
+			continue
+		}
+		if r.ConfigVersions > 0 && e.Action == ConfigApplied {
+			if versions[e.ResourceID] >= r.ConfigVersions {
+				continue
+			}
+			versions[e.ResourceID]++
+		}
+		keep[i] = true
+		kept++
+	}
+	res.Kept = kept
+	res.Removed += len(lines) - kept
+	if res.Removed == 0 {
+		res.BytesAfter = res.BytesBefore
+		return res, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".audit-*")
+	if err != nil {
+		return res, err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for i, ln := range lines {
+		if keep[i] {
+			w.Write(ln.raw)
+			w.WriteByte('\n')
+			res.BytesAfter += int64(len(ln.raw)) + 1
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return res, err
+	}
+	if err := tmp.Close(); err != nil {
+		return res, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return res, err
+	}
+	return res, os.Rename(tmp.Name(), l.path)
+}
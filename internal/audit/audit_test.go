@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	l := NewLogger(filepath.Join(t.TempDir(), "audit.log"))
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		l.Record(Event{Time: now.Add(time.Duration(i-11) * 24 * time.Hour), Action: "site.created", ResourceID: "old"})
+	}
+	for i := 0; i < 5; i++ {
+		l.Record(Event{Time: now.Add(time.Duration(i-5) * time.Hour), Action: ConfigApplied, ResourceID: "shop"})
+	}
+	l.Record(Event{Time: now, Action: ConfigApplied, ResourceID: "blog"})
+
+	res, err := l.Prune(Retention{MaxAge: 7 * 24 * time.Hour, ConfigVersions: 2}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 7 || res.Kept != 3 || res.BytesAfter >= res.BytesBefore {
+		t.Errorf("Unexpected prune result %+v", res)
+	}
+	events, _ := l.List(Filter{})
+	if len(events) != 3 || events[0].ResourceID != "blog" || !events[1].Time.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected the newest config versions to be kept, got %+v", events)
+	}
+
+	if res, _ := l.Prune(Retention{MaxEvents: 1}, now); res.Removed != 2 || res.Kept != 1 {
+		t.Errorf("Expected MaxEvents to keep 1 event, got %+v", res)
+	}
+	if res, _ := l.Prune(Retention{}, now); res.Removed != 0 || res.BytesAfter != res.BytesBefore {
+		t.Errorf("Expected no change without retention, got %+v", res)
+	}
+}
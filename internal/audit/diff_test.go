@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	if d, a, r := Diff("x", "same\n", "same\n"); d != "" || a != 0 || r != 0 {
+		t.Errorf("Expected no diff for identical input, got %q", d)
+	}
+
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		old = append(old, "line "+string(rune('a'+i)))
+	}
+	new = append(new, old...)
+	new[4] = "changed"
+	new = append(new[:15], append([]string{"inserted"}, new[15:]...)...)
+
+	d, added, removed := Diff("site.conf", strings.Join(old, "\n")+"\n", strings.Join(new, "\n")+"\n")
+	if added != 2 || removed != 1 {
+		t.Errorf("Expected 2 added and 1 removed, got %d and %d:\n%s", added, removed, d)
+	}
+	for _, want := range []string{
+		"--- site.conf\n+++ site.conf\n",
+		"@@ -2,7 +2,7 @@\n line c\n line d\n line e\n-line f\n+changed\n line g\n",
+		"@@ -13,6 +13,7 @@\n",
+		"+inserted\n",
+	} {
+		if !strings.Contains(d, want) {
+			t.Errorf("Expected %q in:\n%s", want, d)
+		}
+	}
+
+	d, added, removed = Diff("new.conf", "", "a\nb\n")
+	if added != 2 || removed != 0 || !strings.Contains(d, "@@ -0,0 +1,2 @@\n+a\n+b\n") {
+		t.Errorf("Unexpected diff for a new file (+%d -%d):\n%s", added, removed, d)
+	}
+}
@@ -0,0 +1,223 @@
+package certbot
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// The standard library resolver has no CAA lookup, so CAA records are
+// queried with a minimal DNS client.
+
+const (
+	dnsTypeCAA   = 257
+	dnsClassIN   = 1
+	rcodeNameErr = 3 // NXDOMAIN
+)
+
+// CAARecord is one CAA resource record (RFC 8659).
+type CAARecord struct {
+	Flags uint8  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// Critical reports whether the issuer-critical flag is set.
+func (r CAARecord) Critical() bool {
+	return r.Flags&0x80 != 0
+}
+
+var rcodeNames = map[int]string{1: "FORMERR", 2: "SERVFAIL", 4: "NOTIMP", 5: "REFUSED"}
+
+// rcodeError is a DNS failure response.
+type rcodeError struct {
+	name  string
+	rcode int
+}
+
+func (e *rcodeError) Error() string {
+	name, ok := rcodeNames[e.rcode]
+	if !ok {
+		name = fmt.Sprintf("rcode %d", e.rcode)
+	}
+	return fmt.Sprintf("CAA lookup for %s failed: %s", e.name, name)
+}
+
+// systemResolver returns the first nameserver from /etc/resolv.conf.
+func systemResolver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// lookupCAA returns the CAA records at exactly name. A name that does not
+// exist has none.
+func lookupCAA(resolver, name string, timeout time.Duration) ([]CAARecord, error) {
+	query, id, err := buildQuery(name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchangeUDP(resolver, query, timeout)
+	if err == nil && len(resp) > 2 && resp[2]&0x02 != 0 {
+		resp, err = exchangeTCP(resolver, query, timeout) // Truncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseCAAResponse(resp, id, name)
+}
+
+func buildQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	var idb [2]byte
+	rand.Read(idb[:])
+	id := binary.BigEndian.Uint16(idb[:])
+
+	msg := []byte{idb[0], idb[1], 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0} // RD, one question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid domain name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg, id, nil
+}
+
+func exchangeUDP(resolver string, query []byte, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", resolver, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func exchangeTCP(resolver string, query []byte, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", resolver, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var errShortMessage = errors.New("malformed DNS response")
+
+// parseCAAResponse extracts the CAA answers. CNAMEs followed by the
+// resolver are skipped; only CAA data is returned.
+func parseCAAResponse(msg []byte, id uint16, name string) ([]CAARecord, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return nil, errShortMessage
+	}
+	switch rcode := int(msg[3] & 0x0f); rcode {
+	case 0:
+	case rcodeNameErr:
+		return nil, nil
+	default:
+		return nil, &rcodeError{name: name, rcode: rcode}
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4 // type, class
+	}
+
+	var records []CAARecord
+	for i := 0; i < ancount; i++ {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errShortMessage
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errShortMessage
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+
+		if rtype != dnsTypeCAA {
+			continue
+		}
+		if len(rdata) < 2 || 2+int(rdata[1]) > len(rdata) {
+			return nil, errShortMessage
+		}
+		tagLen := int(rdata[1])
+		records = append(records, CAARecord{
+			Flags: rdata[0],
+			Tag:   strings.ToLower(string(rdata[2 : 2+tagLen])),
+			Value: string(rdata[2+tagLen:]),
+		})
+	}
+	return records, nil
+}
+
+// skipName returns the offset just past the (possibly compressed) name at off.
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errShortMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			return off + 2, nil // Pointer ends the name
+		default:
+			off += 1 + l
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package certbot
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CertInfo describes a certificate lineage on disk.
+type CertInfo struct {
+	Domain    string    `json:"domain"` // Lineage name
+	Names     []string  `json:"names"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"` // Leaf serial number, hex
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+
+	// KeySHA256 fingerprints the public key; KeyCreatedAt is when the
+	// lineage started using it (see keyCreatedAt).
+	KeySHA256    string    `json:"key_sha256"`
+	KeyCreatedAt time.Time `json:"key_created_at"`
+}
+
+// Certificate reads the leaf certificate of the lineage for domain.
+func (m *Manager) Certificate(domain string) (*CertInfo, error) {
+	cert, err := m.leaf(domain)
+	if err != nil {
+		return nil, err
+	}
+	return &CertInfo{
+		Domain:    domain,
+		Names:     cert.DNSNames,
+		Issuer:    cert.Issuer.CommonName,
+		Serial:    cert.SerialNumber.Text(16),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+
+		KeySHA256:    keyFingerprint(cert),
+		KeyCreatedAt: m.keyCreatedAt(domain, cert),
+	}, nil
+}
+
+// ListCertificates returns every lineage in LiveDir.
+func (m *Manager) ListCertificates() ([]CertInfo, error) {
+	entries, err := os.ReadDir(m.LiveDir)
+	if os.IsNotExist(err) {
+		return []CertInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	certs := []CertInfo{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := m.Certificate(e.Name())
+		if err != nil {
+			continue // README and other non-lineage entries
+		}
+		certs = append(certs, *info)
+	}
+	return certs, nil
+}
+
+// CertCovers reports whether the lineage for domain exists, has not
+// expired and is valid for domain and every name.
+func (m *Manager) CertCovers(domain string, names ...string) bool {
+	return m.LineageCovers(domain, append([]string{domain}, names...)...)
+}
+
+// LineageCovers reports whether the named lineage exists, has not expired
+// and is valid for every name. Unlike CertCovers the lineage name itself is
+// not checked, so it works for shared lineages such as wildcards.
+func (m *Manager) LineageCovers(lineage string, names ...string) bool {
+	cert, err := m.leaf(lineage)
+	if err != nil || time.Now().After(cert.NotAfter) {
+		return false
+	}
+	for _, name := range names {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) leaf(domain string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(m.LiveDir, domain, "fullchain.pem"))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %s lineage", domain)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
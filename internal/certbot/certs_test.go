@@ -0,0 +1,198 @@
+package certbot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, liveDir, lineage string, names []string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(liveDir, lineage)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "fullchain.pem"), pemData, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertCovers(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "certbot_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m := NewManager("/var/www/hubfly", "test@example.com")
+	m.LiveDir = tmpDir
+	writeTestCert(t, tmpDir, "shop.example.com", []string{"shop.example.com", "www.shop.example.com"}, time.Now().Add(24*time.Hour))
+	writeTestCert(t, tmpDir, "old.example.com", []string{"old.example.com"}, time.Now().Add(-time.Minute))
+
+	if !m.CertCovers("shop.example.com", "www.shop.example.com") {
+		t.Errorf("Certificate should cover its SANs")
+	}
+	if m.CertCovers("shop.example.com", "api.shop.example.com") {
+		t.Errorf("Certificate should not cover a missing alias")
+	}
+	if m.CertCovers("old.example.com") {
+		t.Errorf("Expired certificate should not count")
+	}
+	if m.CertCovers("missing.example.com") {
+		t.Errorf("Missing lineage should not count")
+	}
+
+	certs, err := m.ListCertificates()
+	if err != nil || len(certs) != 2 {
+		t.Fatalf("ListCertificates = %v, %v", certs, err)
+	}
+}
+
+func TestLineageCoversWildcard(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "certbot_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m := NewManager("/var/www/hubfly", "test@example.com")
+	m.LiveDir = tmpDir
+	writeTestCert(t, tmpDir, "_wildcard.example.com", []string{"*.example.com", "example.com"}, time.Now().Add(24*time.Hour))
+
+	if !m.LineageCovers("_wildcard.example.com", "*.example.com", "example.com", "app.example.com", "api.example.com") {
+		t.Errorf("Wildcard lineage should cover the apex and first-level names")
+	}
+	if m.LineageCovers("_wildcard.example.com", "a.b.example.com") {
+		t.Errorf("Wildcard should not cover nested names")
+	}
+}
+
+func TestChallengeArgs(t *testing.T) {
+	m := NewManager("/var/www/hubfly", "test@example.com")
+	if _, err := m.challengeArgs(ChallengeDNS01); err == nil {
+		t.Errorf("DNS-01 without a plugin should fail")
+	}
+	m.DNSPlugin = "cloudflare"
+	m.DNSCredentials = "/etc/hubfly/cloudflare.ini"
+	args, err := m.challengeArgs(ChallengeDNS01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--dns-cloudflare", "--dns-cloudflare-credentials", "/etc/hubfly/cloudflare.ini"}
+	if len(args) != len(want) {
+		t.Fatalf("args = %v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("args = %v, want %v", args, want)
+		}
+	}
+}
+
+func TestRenewDue(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "certbot_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("PATH", "") // no certbot binary
+
+	m := NewManager("/var/www/hubfly", "test@example.com")
+	m.LiveDir = tmpDir
+	fresh := time.Now().Add(60 * 24 * time.Hour)
+	writeTestCert(t, tmpDir, "fresh.example.com", []string{"fresh.example.com"}, fresh)
+	writeTestCert(t, tmpDir, "due.example.com", []string{"due.example.com"}, time.Now().Add(5*24*time.Hour))
+
+	results := map[string]RenewResult{}
+	for _, res := range m.RenewDue(DefaultRenewBefore, nil) {
+		results[res.Lineage] = res
+	}
+	if len(results) != 2 {
+		t.Fatalf("RenewDue returned %d results, want 2", len(results))
+	}
+	if res := results["fresh.example.com"]; res.Renewed || res.Err != nil || res.NotAfter.Unix() != fresh.Unix() {
+		t.Errorf("Fresh certificate should be left alone: %+v", res)
+	}
+	if res := results["due.example.com"]; res.Renewed || res.Err == nil {
+		t.Errorf("Due certificate should have attempted renewal: %+v", res)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("PATH", "") // no certbot binary
+
+	m := NewManager("/var/www/hubfly", "test@example.com")
+	m.LiveDir = filepath.Join(tmpDir, "live")
+	archive := filepath.Join(tmpDir, "archive", "a.example.com")
+	os.MkdirAll(archive, 0755)
+	os.MkdirAll(filepath.Join(m.LiveDir, "a.example.com"), 0755)
+
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	write := func(path string, key *ecdsa.PrivateKey, notBefore time.Time) {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			DNSNames:     []string{"a.example.com"},
+			NotBefore:    notBefore,
+			NotAfter:     notBefore.Add(90 * 24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	}
+	day := 24 * time.Hour
+	write(filepath.Join(archive, "cert1.pem"), oldKey, time.Now().Add(-200*day))
+	write(filepath.Join(archive, "cert2.pem"), newKey, time.Now().Add(-120*day))
+	write(filepath.Join(archive, "cert3.pem"), newKey, time.Now().Add(-60*day))
+	live := filepath.Join(m.LiveDir, "a.example.com", "fullchain.pem")
+	write(live, newKey, time.Now().Add(-60*day))
+
+	// The key is as old as the first certificate that used it.
+	info, err := m.Certificate("a.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().Add(-120 * day); info.KeyCreatedAt.Sub(want).Abs() > time.Minute {
+		t.Errorf("KeyCreatedAt = %v, want about %v", info.KeyCreatedAt, want)
+	}
+
+	// Not due for renewal, but the key is older than 90 days.
+	rotate := func(d time.Duration) func(string) time.Duration {
+		return func(string) time.Duration { return d }
+	}
+	res := m.RenewDue(time.Hour, rotate(90*day))
+	if len(res) != 1 || !res[0].NewKey || res[0].Err == nil {
+		t.Errorf("Expected an attempted key rotation: %+v", res)
+	}
+	res = m.RenewDue(time.Hour, rotate(180*day))
+	if len(res) != 1 || res[0].NewKey || res[0].Err != nil {
+		t.Errorf("Key within its rotation period should be left alone: %+v", res)
+	}
+}
@@ -0,0 +1,57 @@
+package certbot
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveDir is where certbot keeps every version of a lineage, next to
+// LiveDir (e.g. /etc/letsencrypt/archive/<lineage>).
+func (m *Manager) archiveDir(lineage string) string {
+	return filepath.Join(filepath.Dir(m.LiveDir), "archive", lineage)
+}
+
+// keyFingerprint is the hex SHA-256 of a certificate's public key.
+func keyFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// keyCreatedAt estimates when the lineage's current key was first used:
+// the earliest NotBefore among its archived certificates with the same
+// public key. Renewals that reuse the key keep the date; a new key resets
+// it. Without an archive it is the leaf's own NotBefore.
+func (m *Manager) keyCreatedAt(lineage string, leaf *x509.Certificate) time.Time {
+	created := leaf.NotBefore
+	fingerprint := keyFingerprint(leaf)
+	files, _ := filepath.Glob(filepath.Join(m.archiveDir(lineage), "cert*.pem"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || keyFingerprint(cert) != fingerprint {
+			continue
+		}
+		if cert.NotBefore.Before(created) {
+			created = cert.NotBefore
+		}
+	}
+	return created
+}
+
+// PreviousCert is the archived file the lineage's cert.pem points at. Taken
+// before Rotate, it can be passed to RevokeRotated afterwards.
+func (m *Manager) PreviousCert(lineage string) (string, error) {
+	return filepath.EvalSymlinks(filepath.Join(m.LiveDir, lineage, "cert.pem"))
+}
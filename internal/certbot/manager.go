@@ -1,45 +1,142 @@
 package certbot
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
 )
 
 type Manager struct {
 	Webroot string
 	Email   string
+	LiveDir string // Certbot lineage directory, e.g. /etc/letsencrypt/live
+
+	// Global ACME account settings. Empty Server means certbot's default (Let's Encrypt).
+	Server     string
+	EABKeyID   string
+	EABHMACKey string
+
+	// DNS-01 settings: the certbot DNS plugin (e.g. "cloudflare", "route53"),
+	// its credentials file and an optional propagation wait in seconds.
+	DNSPlugin      string
+	DNSCredentials string
+	DNSPropagation int
+
+	// Prechecks enables the CAA and DNS checks run before every issuance.
+	// Resolver is the DNS server for CAA queries (default: the first
+	// nameserver in /etc/resolv.conf).
+	Prechecks       bool
+	Resolver        string
+	PrecheckTimeout time.Duration
+
+	Faults *faults.Injector // Failure injection (chaos mode); nil in normal operation
+
+	// Test hooks replacing DNS and network access in prechecks.
+	caaLookup func(name string) ([]CAARecord, error)
+	ipLookup  func(ctx context.Context, name string) ([]net.IP, error)
+	httpProbe func(ip net.IP, name, path string) (string, error)
+	portDial  func(addr string) error
+}
+
+// Challenge types.
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// IssueOptions carries per-site overrides of the global ACME settings.
+type IssueOptions struct {
+	Server     string
+	EABKeyID   string
+	EABHMACKey string
+
+	// AltNames are added to the certificate next to the primary domain.
+	AltNames []string
+
+	// Challenge is ChallengeHTTP01 (default, webroot) or ChallengeDNS01.
+	Challenge string
+
+	// CertName overrides the lineage name (default: the primary domain).
+	CertName string
 }
 
 func NewManager(webroot, email string) *Manager {
 	return &Manager{
-		Webroot: webroot,
-		Email:   email,
+		Webroot:   webroot,
+		Email:     email,
+		LiveDir:   "/etc/letsencrypt/live",
+		Prechecks: true,
 	}
 }
 
-func (m *Manager) Issue(domain string) error {
+// CertExists reports whether a certificate lineage for domain is present on disk.
+func (m *Manager) CertExists(domain string) bool {
+	_, err := os.Stat(filepath.Join(m.LiveDir, domain, "fullchain.pem"))
+	return err == nil
+}
+
+func (m *Manager) Issue(domain string, opts IssueOptions) error {
 	// certbot certonly --webroot -w /var/www/hubfly -d example.com --non-interactive --agree-tos -m email
+	if err := m.Faults.Check(faults.CertbotIssue); err != nil {
+		slog.Error("Certbot issue failed", "domain", domain, "error", err)
+		return err
+	}
 	path, err := exec.LookPath("certbot")
 	if err != nil {
 		return fmt.Errorf("certbot not found")
 	}
 
-	args := []string{
-		"certonly",
-		"--webroot",
-		"-w", m.Webroot,
+	challenge, err := m.challengeArgs(opts.Challenge)
+	if err != nil {
+		return err
+	}
+	if m.Prechecks {
+		problems := m.Precheck(domain, opts)
+		for _, p := range problems {
+			if !p.Fatal {
+				slog.Warn("Certificate precheck warning", "domain", domain, "name", p.Name, "check", p.Check, "message", p.Message)
+			}
+		}
+		if hasFatal(problems) {
+			err := &PrecheckError{Problems: problems}
+			slog.Error("Certificate precheck failed", "domain", domain, "error", err)
+			return err
+		}
+	}
+	args := append([]string{"certonly"}, challenge...)
+	args = append(args,
 		"-d", domain,
 		"--non-interactive",
 		"--agree-tos",
 		"-m", m.Email,
+	)
+	if len(opts.AltNames) > 0 || opts.CertName != "" {
+		// Keep the lineage named after the primary domain and grow it in
+		// place when aliases are added.
+		name := domain
+		if opts.CertName != "" {
+			name = opts.CertName
+		}
+		args = append(args, "--cert-name", name, "--expand")
+		for _, name := range opts.AltNames {
+			args = append(args, "-d", name)
+		}
 	}
+	args = append(args, m.accountArgs(opts)...)
 
-	slog.Info("Running certbot issue", "domain", domain, "command", path, "args", args)
+	slog.Info("Running certbot issue", "domain", domain, "command", path, "args", redactArgs(args))
 
 	cmd := exec.Command(path, args...)
 	out, err := cmd.CombinedOutput()
-	
+
 	slog.Debug("Certbot output", "domain", domain, "output", string(out))
 
 	if err != nil {
@@ -49,11 +146,82 @@ func (m *Manager) Issue(domain string) error {
 	return nil
 }
 
+// DNSEnabled reports whether a DNS plugin is configured for DNS-01.
+func (m *Manager) DNSEnabled() bool {
+	return m.DNSPlugin != ""
+}
+
+// challengeArgs selects the certbot authenticator for the challenge type.
+func (m *Manager) challengeArgs(challenge string) ([]string, error) {
+	switch challenge {
+	case "", ChallengeHTTP01:
+		return []string{"--webroot", "-w", m.Webroot}, nil
+	case ChallengeDNS01:
+		if !m.DNSEnabled() {
+			return nil, fmt.Errorf("dns-01 requested but no DNS plugin is configured")
+		}
+		plugin := "--dns-" + m.DNSPlugin
+		args := []string{plugin}
+		if m.DNSCredentials != "" {
+			args = append(args, plugin+"-credentials", m.DNSCredentials)
+		}
+		if m.DNSPropagation > 0 {
+			args = append(args, plugin+"-propagation-seconds", strconv.Itoa(m.DNSPropagation))
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("unknown challenge type %q", challenge)
+	}
+}
+
+// accountArgs resolves the ACME server and External Account Binding flags.
+// Site-level values win over the global ones; EAB is taken as a pair so a
+// site cannot end up with a key ID from one account and an HMAC from another.
+func (m *Manager) accountArgs(opts IssueOptions) []string {
+	var args []string
+
+	server := m.Server
+	if opts.Server != "" {
+		server = opts.Server
+	}
+	if server != "" {
+		args = append(args, "--server", server)
+	}
+
+	kid, hmac := m.EABKeyID, m.EABHMACKey
+	if opts.EABKeyID != "" {
+		kid, hmac = opts.EABKeyID, opts.EABHMACKey
+	}
+	if kid != "" && hmac != "" {
+		args = append(args, "--eab-kid", kid, "--eab-hmac-key", hmac)
+	}
+	return args
+}
+
+// redactArgs hides secret flag values before they reach the logs.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i := 0; i < len(out)-1; i++ {
+		if out[i] == "--eab-hmac-key" {
+			out[i+1] = "[redacted]"
+		}
+	}
+	return out
+}
+
 func (m *Manager) Revoke(domain string) error {
 	// certbot revoke --cert-path ...
-	// For simplicity, we assume standard letsencrypt path
-	certPath := fmt.Sprintf("/etc/letsencrypt/live/%s/cert.pem", domain)
+	return m.revoke(domain, filepath.Join(m.LiveDir, domain, "cert.pem"), "unspecified")
+}
+
+// RevokeRotated revokes a certificate replaced by Rotate, given the path
+// PreviousCert returned before rotating, for a compromised key.
+func (m *Manager) RevokeRotated(lineage, certPath string) error {
+	return m.revoke(lineage, certPath, "keycompromise")
+}
 
+func (m *Manager) revoke(domain, certPath, reason string) error {
 	path, err := exec.LookPath("certbot")
 	if err != nil {
 		return fmt.Errorf("certbot not found")
@@ -61,7 +229,7 @@ func (m *Manager) Revoke(domain string) error {
 
 	slog.Info("Running certbot revoke", "domain", domain, "cert_path", certPath)
 
-	cmd := exec.Command(path, "revoke", "--cert-path", certPath, "--reason", "unspecified", "--non-interactive")
+	cmd := exec.Command(path, "revoke", "--cert-path", certPath, "--reason", reason, "--non-interactive")
 	out, err := cmd.CombinedOutput()
 
 	slog.Debug("Certbot revoke output", "domain", domain, "output", string(out))
@@ -0,0 +1,51 @@
+package certbot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAccountArgs(t *testing.T) {
+	global := &Manager{Server: "https://acme.example/global", EABKeyID: "gkid", EABHMACKey: "ghmac"}
+	tests := []struct {
+		name string
+		m    *Manager
+		opts IssueOptions
+		want []string
+	}{
+		{"none", &Manager{}, IssueOptions{}, nil},
+		{"global", global, IssueOptions{},
+			[]string{"--server", "https://acme.example/global", "--eab-kid", "gkid", "--eab-hmac-key", "ghmac"}},
+		{"site server keeps global EAB", global, IssueOptions{Server: "https://acme.example/site"},
+			[]string{"--server", "https://acme.example/site", "--eab-kid", "gkid", "--eab-hmac-key", "ghmac"}},
+		{"site EAB wins as a pair", global, IssueOptions{EABKeyID: "skid", EABHMACKey: "shmac"},
+			[]string{"--server", "https://acme.example/global", "--eab-kid", "skid", "--eab-hmac-key", "shmac"}},
+		{"site key ID without HMAC", global, IssueOptions{EABKeyID: "skid"},
+			[]string{"--server", "https://acme.example/global"}},
+		{"HMAC without key ID", &Manager{EABHMACKey: "ghmac"}, IssueOptions{}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.m.accountArgs(tt.opts); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"certonly", "--eab-kid", "kid", "--eab-hmac-key", "secret", "-d", "a.example.com"}
+	got := redactArgs(args)
+	if strings.Contains(strings.Join(got, " "), "secret") {
+		t.Errorf("HMAC key not redacted: %v", got)
+	}
+	if want := []string{"certonly", "--eab-kid", "kid", "--eab-hmac-key", "[redacted]", "-d", "a.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if args[4] != "secret" {
+		t.Error("redactArgs must not change the args certbot runs with")
+	}
+	// A trailing flag without a value is left alone
+	if got := redactArgs([]string{"--eab-hmac-key"}); !slices.Equal(got, []string{"--eab-hmac-key"}) {
+		t.Errorf("got %v", got)
+	}
+}
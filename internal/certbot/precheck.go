@@ -0,0 +1,308 @@
+package certbot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultPrecheckTimeout bounds each DNS query and HTTP probe.
+const DefaultPrecheckTimeout = 5 * time.Second
+
+// Problem is a misconfiguration found before issuance. Fatal problems are
+// certain to make the CA refuse; the others are reported as warnings.
+type Problem struct {
+	Check   string `json:"check"` // "caa" or "dns"
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Fatal   bool   `json:"fatal"`
+}
+
+// PrecheckError is returned by Issue when a fatal problem was found.
+type PrecheckError struct {
+	Problems []Problem
+}
+
+func (e *PrecheckError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		if p.Fatal {
+			msgs = append(msgs, p.Message)
+		}
+	}
+	return "precheck failed: " + strings.Join(msgs, "; ")
+}
+
+// caIdentities maps ACME directory hosts to the issuer domains their CA
+// accepts in CAA "issue" records.
+var caIdentities = []struct {
+	host string
+	ids  []string
+}{
+	{"letsencrypt.org", []string{"letsencrypt.org"}},
+	{"zerossl.com", []string{"sectigo.com", "zerossl.com"}},
+	{"sectigo.com", []string{"sectigo.com"}},
+	{"pki.goog", []string{"pki.goog"}},
+	{"buypass.com", []string{"buypass.com"}},
+	{"ssl.com", []string{"ssl.com"}},
+	{"digicert.com", []string{"digicert.com"}},
+}
+
+// CAIdentities returns the CAA issuer domains for an ACME directory URL
+// (empty means Let's Encrypt), or nil when the CA is unknown.
+func CAIdentities(server string) []string {
+	if server == "" {
+		return []string{"letsencrypt.org"}
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, ca := range caIdentities {
+		if host == ca.host || strings.HasSuffix(host, "."+ca.host) {
+			return ca.ids
+		}
+	}
+	return nil
+}
+
+// Precheck inspects DNS for the names a certificate would cover and
+// reports what would make issuance fail: CAA records that do not authorize
+// the CA and, for HTTP-01, AAAA records that point away from this server
+// (Let's Encrypt validates over IPv6 whenever an AAAA record exists).
+func (m *Manager) Precheck(domain string, opts IssueOptions) []Problem {
+	server := m.Server
+	if opts.Server != "" {
+		server = opts.Server
+	}
+	ids := CAIdentities(server)
+	names := append([]string{domain}, opts.AltNames...)
+
+	var problems []Problem
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if ids != nil {
+			problems = append(problems, m.checkCAA(name, ids)...)
+		}
+		if (opts.Challenge == "" || opts.Challenge == ChallengeHTTP01) && !strings.HasPrefix(name, "*.") {
+			problems = append(problems, m.checkAddresses(name)...)
+		}
+	}
+	return problems
+}
+
+// checkCAA applies RFC 8659: the closest ancestor with CAA records decides.
+func (m *Manager) checkCAA(name string, ids []string) []Problem {
+	wildcard := strings.HasPrefix(name, "*.")
+	lookup := strings.TrimPrefix(name, "*.")
+
+	labels := strings.Split(lookup, ".")
+	for i := 0; i < len(labels)-1; i++ { // Never the TLD itself
+		at := strings.Join(labels[i:], ".")
+		records, err := m.lookupCAA(at)
+		if err != nil {
+			var rerr *rcodeError
+			if errors.As(err, &rerr) {
+				return []Problem{{Check: "caa", Name: name, Message: fmt.Sprintf("%v; the CA will refuse to issue if its resolver gets the same answer", err)}}
+			}
+			return []Problem{{Check: "caa", Name: name, Message: fmt.Sprintf("could not check CAA records for %s: %v", at, err)}}
+		}
+		if len(records) > 0 {
+			return evaluateCAA(name, at, records, wildcard, ids)
+		}
+	}
+	return nil
+}
+
+func evaluateCAA(name, at string, records []CAARecord, wildcard bool, ids []string) []Problem {
+	var issue, issuewild []string
+	for _, r := range records {
+		switch r.Tag {
+		case "issue":
+			issue = append(issue, r.Value)
+		case "issuewild":
+			issuewild = append(issuewild, r.Value)
+		case "iodef", "contactemail", "contactphone", "issuemail", "issuevmc":
+		default:
+			if r.Critical() {
+				return []Problem{{Check: "caa", Name: name, Fatal: true,
+					Message: fmt.Sprintf("CAA record at %s has unknown critical tag %q, which forbids issuance by any CA", at, r.Tag)}}
+			}
+		}
+	}
+
+	values, tag := issue, "issue"
+	if wildcard && len(issuewild) > 0 {
+		values, tag = issuewild, "issuewild"
+	}
+	if len(values) == 0 {
+		return nil // Only reporting records: any CA may issue
+	}
+
+	var allowed []string
+	for _, v := range values {
+		issuer := strings.ToLower(strings.TrimSpace(strings.SplitN(v, ";", 2)[0]))
+		for _, id := range ids {
+			if issuer == id {
+				return nil
+			}
+		}
+		if issuer != "" {
+			allowed = append(allowed, issuer)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return []Problem{{Check: "caa", Name: name, Fatal: true,
+			Message: fmt.Sprintf("CAA %s records at %s forbid certificate issuance for %s; add %s. CAA 0 %s \"%s\"", tag, at, name, at, tag, ids[0])}}
+	}
+	return []Problem{{Check: "caa", Name: name, Fatal: true,
+		Message: fmt.Sprintf("CAA %s records at %s only allow %s, not %s; add %s. CAA 0 %s \"%s\"", tag, at, strings.Join(allowed, ", "), ids[0], at, tag, ids[0])}}
+}
+
+// checkAddresses verifies that name resolves and that every AAAA record
+// reaches this server. Each AAAA address is probed with a token placed in
+// the challenge webroot, so NAT and container networking do not matter.
+func (m *Manager) checkAddresses(name string) []Problem {
+	ctx, cancel := context.WithTimeout(context.Background(), m.precheckTimeout())
+	defer cancel()
+	ips, err := m.lookupIP(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return []Problem{{Check: "dns", Name: name, Fatal: true, Message: fmt.Sprintf("%s does not resolve (no A or AAAA record)", name)}}
+		}
+		return []Problem{{Check: "dns", Name: name, Message: fmt.Sprintf("could not resolve %s: %v", name, err)}}
+	}
+	if len(ips) == 0 {
+		return []Problem{{Check: "dns", Name: name, Fatal: true, Message: fmt.Sprintf("%s does not resolve (no A or AAAA record)", name)}}
+	}
+
+	var v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			v6 = append(v6, ip)
+		}
+	}
+	if len(v6) == 0 {
+		return nil
+	}
+
+	token, cleanup, err := m.writeProbeToken()
+	if err != nil {
+		return []Problem{{Check: "dns", Name: name, Message: fmt.Sprintf("could not verify AAAA records for %s: %v", name, err)}}
+	}
+	defer cleanup()
+
+	var problems []Problem
+	for _, ip := range v6 {
+		body, err := m.probe(ip, name, "/.well-known/acme-challenge/"+token)
+		switch {
+		case err != nil && errors.Is(err, syscall.ECONNREFUSED):
+			problems = append(problems, Problem{Check: "dns", Name: name, Fatal: true,
+				Message: fmt.Sprintf("AAAA record %s for %s refuses HTTP connections; Let's Encrypt validates over IPv6 when an AAAA record exists — fix or remove it", ip, name)})
+		case err != nil:
+			// No route, a firewall or a timeout: this host cannot tell
+			// whether the CA would get through.
+			problems = append(problems, Problem{Check: "dns", Name: name,
+				Message: fmt.Sprintf("could not verify AAAA record %s for %s: %v", ip, name, err)})
+		case body != token:
+			problems = append(problems, Problem{Check: "dns", Name: name, Fatal: true,
+				Message: fmt.Sprintf("AAAA record %s for %s points to a different server; Let's Encrypt validates over IPv6 when an AAAA record exists — point it here or remove it", ip, name)})
+		}
+	}
+	return problems
+}
+
+func (m *Manager) writeProbeToken() (string, func(), error) {
+	var b [16]byte
+	rand.Read(b[:])
+	token := "hubfly-precheck-" + hex.EncodeToString(b[:])
+
+	dir := filepath.Join(m.Webroot, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, token)
+	if err := os.WriteFile(path, []byte(token), 0644); err != nil {
+		return "", nil, err
+	}
+	return token, func() { os.Remove(path) }, nil
+}
+
+func (m *Manager) precheckTimeout() time.Duration {
+	if m.PrecheckTimeout > 0 {
+		return m.PrecheckTimeout
+	}
+	return DefaultPrecheckTimeout
+}
+
+func (m *Manager) lookupCAA(name string) ([]CAARecord, error) {
+	if m.caaLookup != nil {
+		return m.caaLookup(name)
+	}
+	resolver := m.Resolver
+	if resolver == "" {
+		resolver = systemResolver()
+	}
+	return lookupCAA(resolver, name, m.precheckTimeout())
+}
+
+func (m *Manager) lookupIP(ctx context.Context, name string) ([]net.IP, error) {
+	if m.ipLookup != nil {
+		return m.ipLookup(ctx, name)
+	}
+	return net.DefaultResolver.LookupIP(ctx, "ip", name)
+}
+
+// probe fetches path from ip on port 80 with name as the Host header.
+func (m *Manager) probe(ip net.IP, name, path string) (string, error) {
+	if m.httpProbe != nil {
+		return m.httpProbe(ip, name, path)
+	}
+	client := &http.Client{
+		Timeout: m.precheckTimeout(),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+net.JoinHostPort(ip.String(), "80")+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Host = name
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode != 200 {
+		slog.Debug("Precheck probe answered", "ip", ip.String(), "name", name, "status", resp.StatusCode)
+		return "", nil
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// hasFatal reports whether any problem blocks issuance.
+func hasFatal(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Fatal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package certbot
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// caaAnswer builds a DNS response to query carrying the given CAA records,
+// with answer names compressed to point at the question.
+func caaAnswer(query []byte, rcode byte, records []CAARecord) []byte {
+	resp := append([]byte(nil), query...)
+	resp[2] |= 0x80 // QR
+	resp[3] = 0x80 | rcode
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(records)))
+	for _, r := range records {
+		rdata := append([]byte{r.Flags, byte(len(r.Tag))}, r.Tag...)
+		rdata = append(rdata, r.Value...)
+		resp = append(resp, 0xc0, 12) // Pointer to the question name
+		resp = binary.BigEndian.AppendUint16(resp, dnsTypeCAA)
+		resp = binary.BigEndian.AppendUint16(resp, dnsClassIN)
+		resp = binary.BigEndian.AppendUint32(resp, 300)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+	return resp
+}
+
+func TestLookupCAA(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	zone := map[string][]CAARecord{
+		"example.com": {{0, "issue", "letsencrypt.org"}, {0, "iodef", "mailto:ops@example.com"}},
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			var labels []string
+			for off := 12; query[off] != 0; off += int(query[off]) + 1 {
+				labels = append(labels, string(query[off+1:off+1+int(query[off])]))
+			}
+			name := strings.Join(labels, ".")
+			switch {
+			case name == "broken.example.com":
+				conn.WriteTo(caaAnswer(query, 2, nil), addr)
+			case zone[name] != nil:
+				conn.WriteTo(caaAnswer(query, 0, zone[name]), addr)
+			default:
+				conn.WriteTo(caaAnswer(query, 3, nil), addr)
+			}
+		}
+	}()
+
+	resolver := conn.LocalAddr().String()
+	records, err := lookupCAA(resolver, "example.com", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0] != (CAARecord{0, "issue", "letsencrypt.org"}) || records[1].Tag != "iodef" {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	if records, err := lookupCAA(resolver, "missing.example.com", time.Second); err != nil || len(records) != 0 {
+		t.Errorf("NXDOMAIN should mean no records, got %v, %v", records, err)
+	}
+
+	_, err = lookupCAA(resolver, "broken.example.com", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "SERVFAIL") {
+		t.Errorf("Expected SERVFAIL error, got %v", err)
+	}
+}
+
+func TestCAAIdentities(t *testing.T) {
+	tests := map[string]string{
+		"": "letsencrypt.org",
+		"https://acme-staging-v02.api.letsencrypt.org/directory": "letsencrypt.org",
+		"https://acme.zerossl.com/v2/DV90":                       "sectigo.com",
+		"https://dv.acme-v02.api.pki.goog/directory":             "pki.goog",
+		"https://acme.internal.example/dir":                      "",
+	}
+	for server, want := range tests {
+		got := ""
+		if ids := CAIdentities(server); len(ids) > 0 {
+			got = ids[0]
+		}
+		if got != want {
+			t.Errorf("CAIdentities(%q) starts with %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestPrecheckCAA(t *testing.T) {
+	zone := map[string][]CAARecord{
+		"example.com":     {{0, "issue", "letsencrypt.org"}, {0, "issuewild", ";"}},
+		"sub.example.com": {{0, "issue", "digicert.com; cansignhttpexchanges=yes"}},
+		"other.org":       {{0, "iodef", "mailto:ops@other.org"}},
+		"strict.net":      {{128, "tbs", "x"}},
+	}
+	m := NewManager(t.TempDir(), "test@example.com")
+	m.caaLookup = func(name string) ([]CAARecord, error) { return zone[name], nil }
+	dns := IssueOptions{Challenge: ChallengeDNS01}
+
+	tests := []struct {
+		name   string
+		server string
+		fatal  string
+	}{
+		{"example.com", "", ""},
+		{"www.example.com", "", ""}, // Inherits example.com
+		{"*.example.com", "", "forbid certificate issuance"},
+		{"sub.example.com", "", "only allow digicert.com, not letsencrypt.org"},
+		{"a.b.sub.example.com", "", "CAA issue records at sub.example.com"},
+		{"example.com", "https://acme.zerossl.com/v2/DV90", "only allow letsencrypt.org, not sectigo.com"},
+		{"example.com", "https://acme.internal.example/dir", ""}, // Unknown CA: not checked
+		{"other.org", "", ""},
+		{"strict.net", "", `unknown critical tag "tbs"`},
+		{"unlisted.io", "", ""},
+	}
+	for _, tt := range tests {
+		opts := dns
+		opts.Server = tt.server
+		problems := m.Precheck(tt.name, opts)
+		if tt.fatal == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s (%s): expected no problems, got %+v", tt.name, tt.server, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || !problems[0].Fatal || !strings.Contains(problems[0].Message, tt.fatal) {
+			t.Errorf("%s (%s): expected fatal %q, got %+v", tt.name, tt.server, tt.fatal, problems)
+		}
+	}
+
+	// Alternative names are checked too, and a failed lookup only warns.
+	m.caaLookup = func(name string) ([]CAARecord, error) {
+		if name == "broken.example.com" {
+			return nil, &rcodeError{name: name, rcode: 2}
+		}
+		return zone[name], nil
+	}
+	problems := m.Precheck("www.example.com", IssueOptions{Challenge: ChallengeDNS01, AltNames: []string{"broken.example.com", "sub.example.com"}})
+	if len(problems) != 2 || problems[0].Fatal || !strings.Contains(problems[0].Message, "SERVFAIL") || !problems[1].Fatal {
+		t.Errorf("Unexpected problems: %+v", problems)
+	}
+}
+
+func TestPrecheckAddresses(t *testing.T) {
+	webroot := t.TempDir()
+	m := NewManager(webroot, "test@example.com")
+	m.caaLookup = func(string) ([]CAARecord, error) { return nil, nil }
+
+	here, elsewhere, dark := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3")
+	hosts := map[string][]net.IP{
+		"v4.example.com":    {net.ParseIP("192.0.2.1")},
+		"ok.example.com":    {net.ParseIP("192.0.2.1"), here},
+		"stale.example.com": {net.ParseIP("192.0.2.1"), elsewhere},
+		"dark.example.com":  {dark},
+	}
+	m.ipLookup = func(ctx context.Context, name string) ([]net.IP, error) {
+		if ips, ok := hosts[name]; ok {
+			return ips, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	m.httpProbe = func(ip net.IP, name, path string) (string, error) {
+		switch {
+		case ip.Equal(here):
+			// This server: serve the token from the webroot.
+			data, err := os.ReadFile(filepath.Join(webroot, filepath.FromSlash(path)))
+			return string(data), err
+		case ip.Equal(elsewhere):
+			return "", nil // Another server answering 404
+		default:
+			return "", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ENETUNREACH}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		want  string
+		fatal bool
+	}{
+		{"v4.example.com", "", false},
+		{"ok.example.com", "", false},
+		{"stale.example.com", "points to a different server", true},
+		{"dark.example.com", "could not verify AAAA record", false},
+		{"missing.example.com", "does not resolve", true},
+	}
+	for _, tt := range tests {
+		problems := m.Precheck(tt.name, IssueOptions{})
+		if tt.want == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s: expected no problems, got %+v", tt.name, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || problems[0].Fatal != tt.fatal || !strings.Contains(problems[0].Message, tt.want) {
+			t.Errorf("%s: expected %q (fatal %v), got %+v", tt.name, tt.want, tt.fatal, problems)
+		}
+	}
+
+	// DNS-01 does not care where the name points.
+	if problems := m.Precheck("stale.example.com", IssueOptions{Challenge: ChallengeDNS01}); len(problems) != 0 {
+		t.Errorf("Expected no address checks for dns-01, got %+v", problems)
+	}
+
+	// Probe tokens are cleaned up.
+	entries, _ := os.ReadDir(filepath.Join(webroot, ".well-known", "acme-challenge"))
+	if len(entries) != 0 {
+		t.Errorf("Probe tokens left behind: %v", entries)
+	}
+}
@@ -0,0 +1,134 @@
+package certbot
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+)
+
+// DefaultRenewBefore renews certificates this long before they expire,
+// matching certbot's own default.
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+// RenewResult is the outcome of checking one lineage.
+type RenewResult struct {
+	Lineage  string
+	NotAfter time.Time // expiry after the check (the new one when renewed)
+	Renewed  bool
+	NewKey   bool // The renewal was a key rotation
+	Err      error
+}
+
+// Scheduler periodically renews certificates that are close to expiry.
+type Scheduler struct {
+	Manager  *Manager
+	Interval time.Duration
+	Before   time.Duration // renew lineages expiring within this window
+
+	// RotateAfter, when set, is the maximum key age of a lineage; older
+	// keys are replaced even if the certificate isn't due. Zero never
+	// rotates.
+	RotateAfter func(lineage string) time.Duration
+
+	// Skip, when set, is consulted before each run (e.g. on a standby).
+	Skip func() bool
+	// OnResults receives the outcome of every run.
+	OnResults func([]RenewResult)
+}
+
+// Start runs the scheduler in the background. The first check runs
+// immediately.
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if s.Skip == nil || !s.Skip() {
+				results := s.Manager.RenewDue(s.Before, s.RotateAfter)
+				if s.OnResults != nil {
+					s.OnResults(results)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RenewDue renews every lineage expiring within before, or with a new key
+// when its key is older than rotateAfter (if set) allows, and reports the
+// expiry of all lineages.
+func (m *Manager) RenewDue(before time.Duration, rotateAfter func(lineage string) time.Duration) []RenewResult {
+	certs, err := m.ListCertificates()
+	if err != nil {
+		slog.Error("Renewal: failed to list certificates", "error", err)
+		return nil
+	}
+
+	results := make([]RenewResult, 0, len(certs))
+	for _, cert := range certs {
+		res := RenewResult{Lineage: cert.Domain, NotAfter: cert.NotAfter}
+		if rotateAfter != nil {
+			maxAge := rotateAfter(cert.Domain)
+			res.NewKey = maxAge > 0 && time.Since(cert.KeyCreatedAt) >= maxAge
+		}
+		if !res.NewKey && time.Until(cert.NotAfter) > before {
+			results = append(results, res)
+			continue
+		}
+
+		if res.NewKey {
+			slog.Info("Certificate key due for rotation", "cert_name", cert.Domain, "key_created_at", cert.KeyCreatedAt)
+		} else {
+			slog.Info("Certificate due for renewal", "cert_name", cert.Domain, "not_after", cert.NotAfter)
+		}
+		if res.Err = m.renew(cert.Domain, res.NewKey); res.Err == nil {
+			res.Renewed = true
+			if info, err := m.Certificate(cert.Domain); err == nil {
+				res.NotAfter = info.NotAfter
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// Renew renews one lineage with the settings certbot stored when it was
+// issued (authenticator, server, account). The caller decides when renewal
+// is due, so certbot's own threshold is bypassed.
+func (m *Manager) Renew(lineage string) error {
+	return m.renew(lineage, false)
+}
+
+// Rotate renews one lineage with a new private key, even if certbot is
+// set to reuse keys on renewal.
+func (m *Manager) Rotate(lineage string) error {
+	return m.renew(lineage, true)
+}
+
+func (m *Manager) renew(lineage string, newKey bool) error {
+	if err := m.Faults.Check(faults.CertbotRenew); err != nil {
+		slog.Error("Certbot renew failed", "cert_name", lineage, "error", err)
+		return err
+	}
+	path, err := exec.LookPath("certbot")
+	if err != nil {
+		return fmt.Errorf("certbot not found")
+	}
+
+	args := []string{"renew", "--cert-name", lineage, "--force-renewal", "--non-interactive"}
+	if newKey {
+		args = append(args, "--new-key")
+	}
+	slog.Info("Running certbot renew", "cert_name", lineage, "command", path, "args", args)
+
+	out, err := exec.Command(path, args...).CombinedOutput()
+	slog.Debug("Certbot renew output", "cert_name", lineage, "output", string(out))
+	if err != nil {
+		slog.Error("Certbot renew failed", "cert_name", lineage, "error", err, "output", string(out))
+		return fmt.Errorf("certbot renew failed: %s, output: %s", err, string(out))
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package certbot
+
+import "strings"
+
+// Let's Encrypt ACME directories. certbot uses LetsEncryptProduction when
+// no server is set.
+const (
+	LetsEncryptProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// IsStagingIssuer reports whether a certificate comes from a test CA that
+// browsers don't trust: Let's Encrypt's staging issuers are named like
+// "(STAGING) Counterfeit Cashew R10", older ones "Fake LE Intermediate X1".
+func IsStagingIssuer(issuer string) bool {
+	return strings.Contains(issuer, "(STAGING)") || strings.HasPrefix(issuer, "Fake LE ")
+}
+
+// IsStagingServer reports whether an ACME directory URL is a staging
+// endpoint, such as LetsEncryptStaging.
+func IsStagingServer(server string) bool {
+	return strings.Contains(strings.ToLower(server), "staging")
+}
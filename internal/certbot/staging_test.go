@@ -0,0 +1,21 @@
+package certbot
+
+import "testing"
+
+func TestIsStaging(t *testing.T) {
+	for issuer, want := range map[string]bool{
+		"(STAGING) Counterfeit Cashew R10":  true,
+		"(STAGING) Ersatz Edamame E1":       true,
+		"Fake LE Intermediate X1":           true,
+		"R10":                               false,
+		"E6":                                false,
+		"ZeroSSL RSA Domain Secure Site CA": false,
+	} {
+		if got := IsStagingIssuer(issuer); got != want {
+			t.Errorf("IsStagingIssuer(%q) = %v, want %v", issuer, got, want)
+		}
+	}
+	if !IsStagingServer(LetsEncryptStaging) || IsStagingServer(LetsEncryptProduction) {
+		t.Error("Expected only the staging directory to be a staging server")
+	}
+}
@@ -0,0 +1,200 @@
+package certbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// verifyWorkers bounds how many domains VerifyDomains checks at once.
+const verifyWorkers = 16
+
+// expiringWithin is when an existing certificate is reported as expiring.
+const expiringWithin = 30 * 24 * time.Hour
+
+// Certificate statuses of a DomainCheck.
+const (
+	CertValid    = "valid"
+	CertExpiring = "expiring" // Within 30 days
+	CertExpired  = "expired"
+	CertNone     = "none"
+)
+
+// DomainCheck is how ready a domain is to be moved to this server: where
+// its addresses point, whether ports 80 and 443 answer, whether CAA lets
+// the CA issue and which certificate this server already has for it.
+type DomainCheck struct {
+	Domain     string         `json:"domain"`
+	Ready      bool           `json:"ready"`       // No fatal problem: an HTTP-01 certificate can be issued
+	PointsHere bool           `json:"points_here"` // Every address reaches this server
+	HTTP       bool           `json:"http_reachable"`
+	HTTPS      bool           `json:"https_reachable"`
+	CAAOK      bool           `json:"caa_ok"`
+	Addresses  []AddressCheck `json:"addresses"`
+
+	CertStatus  string    `json:"certificate_status"` // valid, expiring, expired or none
+	Certificate *CertInfo `json:"certificate,omitempty"`
+
+	Problems []Problem `json:"problems"`
+}
+
+// AddressCheck is one A or AAAA record of a domain.
+type AddressCheck struct {
+	IP         string `json:"ip"`
+	PointsHere bool   `json:"points_here"` // Served this server's probe token on port 80
+	HTTP       bool   `json:"http"`        // Port 80 answered HTTP
+	HTTPS      bool   `json:"https"`       // Port 443 accepted a connection
+}
+
+// VerifyDomains checks each domain against CAA for the ACME server (empty
+// uses the configured one) and probes its addresses, several domains at a
+// time. Results are in the order of domains.
+func (m *Manager) VerifyDomains(domains []string, acmeServer string) ([]DomainCheck, error) {
+	if acmeServer == "" {
+		acmeServer = m.Server
+	}
+	ids := CAIdentities(acmeServer)
+	token, cleanup, err := m.writeProbeToken()
+	if err != nil {
+		return nil, fmt.Errorf("write probe token: %w", err)
+	}
+	defer cleanup()
+	certs, err := m.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DomainCheck, len(domains))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(verifyWorkers, len(domains)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = m.verifyDomain(domains[i], ids, token, certs)
+			}
+		}()
+	}
+	for i := range domains {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results, nil
+}
+
+func (m *Manager) verifyDomain(name string, ids []string, token string, certs []CertInfo) DomainCheck {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	c := DomainCheck{Domain: name, CAAOK: true, Addresses: []AddressCheck{}, Problems: []Problem{}}
+
+	if ids == nil {
+		c.Problems = append(c.Problems, Problem{Check: "caa", Name: name, Message: "unknown CA; CAA records were not checked"})
+	} else {
+		for _, p := range m.checkCAA(name, ids) {
+			c.Problems = append(c.Problems, p)
+			c.CAAOK = c.CAAOK && !p.Fatal
+		}
+	}
+
+	c.CertStatus, c.Certificate = certStatus(name, certs, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.precheckTimeout())
+	ips, err := m.lookupIP(ctx, name)
+	cancel()
+	var dnsErr *net.DNSError
+	switch {
+	case err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound):
+		c.Problems = append(c.Problems, Problem{Check: "dns", Name: name, Message: fmt.Sprintf("could not resolve %s: %v", name, err)})
+	case len(ips) == 0:
+		c.Problems = append(c.Problems, Problem{Check: "dns", Name: name, Fatal: true, Message: fmt.Sprintf("%s does not resolve (no A or AAAA record)", name)})
+	}
+
+	c.PointsHere = len(ips) > 0
+	for _, ip := range ips {
+		a := AddressCheck{IP: ip.String()}
+		body, err := m.probe(ip, name, "/.well-known/acme-challenge/"+token)
+		a.HTTP = err == nil
+		a.PointsHere = err == nil && body == token
+		switch {
+		case err != nil && errors.Is(err, syscall.ECONNREFUSED):
+			c.Problems = append(c.Problems, Problem{Check: "http", Name: name, Fatal: true,
+				Message: fmt.Sprintf("%s refuses HTTP connections on port 80; HTTP-01 validation needs it", ip)})
+		case err != nil:
+			c.Problems = append(c.Problems, Problem{Check: "http", Name: name,
+				Message: fmt.Sprintf("could not reach %s on port 80: %v", ip, err)})
+		case !a.PointsHere:
+			c.Problems = append(c.Problems, Problem{Check: "dns", Name: name, Fatal: true,
+				Message: fmt.Sprintf("%s for %s points to a different server; point it here before moving the domain", ip, name)})
+		}
+		a.HTTPS = m.dialPort(net.JoinHostPort(ip.String(), "443")) == nil
+		c.PointsHere = c.PointsHere && a.PointsHere
+		c.HTTP = c.HTTP || a.HTTP
+		c.HTTPS = c.HTTPS || a.HTTPS
+		c.Addresses = append(c.Addresses, a)
+	}
+	// nginx only listens on 443 once a site has SSL, so this isn't fatal.
+	if len(ips) > 0 && !c.HTTPS {
+		c.Problems = append(c.Problems, Problem{Check: "https", Name: name, Message: fmt.Sprintf("no address of %s accepts connections on port 443", name)})
+	}
+	c.Ready = !hasFatal(c.Problems)
+	return c
+}
+
+// certStatus finds the certificate this server has for name: the lineage
+// named after it, or else any lineage covering it (such as a wildcard),
+// preferring the one that expires last.
+func certStatus(name string, certs []CertInfo, now time.Time) (string, *CertInfo) {
+	var best *CertInfo
+	for i := range certs {
+		c := &certs[i]
+		if !certNamesCover(c.Names, name) {
+			continue
+		}
+		own, bestOwn := c.Domain == name, best != nil && best.Domain == name
+		if best == nil || own && !bestOwn || own == bestOwn && c.NotAfter.After(best.NotAfter) {
+			best = c
+		}
+	}
+	switch {
+	case best == nil:
+		return CertNone, nil
+	case now.After(best.NotAfter):
+		return CertExpired, best
+	case best.NotAfter.Sub(now) < expiringWithin:
+		return CertExpiring, best
+	}
+	return CertValid, best
+}
+
+func certNamesCover(names []string, name string) bool {
+	for _, n := range names {
+		n = strings.ToLower(n)
+		if n == name {
+			return true
+		}
+		if rest, ok := strings.CutPrefix(n, "*."); ok {
+			if i := strings.IndexByte(name, '.'); i > 0 && name[i+1:] == rest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialPort opens and closes a TCP connection to addr.
+func (m *Manager) dialPort(addr string) error {
+	if m.portDial != nil {
+		return m.portDial(addr)
+	}
+	conn, err := net.DialTimeout("tcp", addr, m.precheckTimeout())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,109 @@
+package certbot
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestVerifyDomains(t *testing.T) {
+	webroot := t.TempDir()
+	m := NewManager(webroot, "test@example.com")
+	m.LiveDir = t.TempDir()
+	m.caaLookup = func(name string) ([]CAARecord, error) {
+		if name == "example.org" {
+			return []CAARecord{{0, "issue", "digicert.com"}}, nil
+		}
+		return nil, nil
+	}
+
+	here, elsewhere, closed := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3")
+	hosts := map[string][]net.IP{
+		"shop.example.com":  {here},
+		"moved.example.com": {here, elsewhere},
+		"down.example.com":  {closed},
+		"blog.example.org":  {here},
+	}
+	m.ipLookup = func(ctx context.Context, name string) ([]net.IP, error) {
+		if ips, ok := hosts[name]; ok {
+			return ips, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	m.httpProbe = func(ip net.IP, name, path string) (string, error) {
+		switch {
+		case ip.Equal(here):
+			data, err := os.ReadFile(filepath.Join(webroot, filepath.FromSlash(path)))
+			return string(data), err
+		case ip.Equal(elsewhere):
+			return "", nil
+		default:
+			return "", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+	}
+	m.portDial = func(addr string) error {
+		if addr == "192.0.2.1:443" {
+			return nil
+		}
+		return syscall.ECONNREFUSED
+	}
+
+	domains := []string{"shop.example.com", "moved.example.com", "down.example.com", "blog.example.org", "new.example.com"}
+	results, err := m.VerifyDomains(domains, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(domains) {
+		t.Fatalf("Expected %d results, got %d", len(domains), len(results))
+	}
+	tests := []struct {
+		ready, pointsHere, http, https, caa bool
+	}{
+		{true, true, true, true, true},
+		{false, false, true, true, true},
+		{false, false, false, false, true},
+		{false, true, true, true, false},
+		{false, false, false, false, true},
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.Domain != domains[i] || r.Ready != tt.ready || r.PointsHere != tt.pointsHere || r.HTTP != tt.http || r.HTTPS != tt.https || r.CAAOK != tt.caa {
+			t.Errorf("%s: unexpected result %+v", domains[i], r)
+		}
+	}
+	if r := results[1]; len(r.Addresses) != 2 || !r.Addresses[0].PointsHere || r.Addresses[1].PointsHere {
+		t.Errorf("Expected only the first address of moved.example.com to point here, got %+v", r.Addresses)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(webroot, ".well-known", "acme-challenge"))
+	if len(entries) != 0 {
+		t.Errorf("Probe tokens left behind: %v", entries)
+	}
+}
+
+func TestCertStatus(t *testing.T) {
+	now := time.Now()
+	certs := []CertInfo{
+		{Domain: "wildcard-example-com", Names: []string{"*.example.com", "example.com"}, NotAfter: now.Add(60 * 24 * time.Hour)},
+		{Domain: "shop.example.com", Names: []string{"shop.example.com"}, NotAfter: now.Add(10 * 24 * time.Hour)},
+		{Domain: "old.example.org", Names: []string{"old.example.org"}, NotAfter: now.Add(-time.Hour)},
+	}
+	tests := []struct {
+		name, status, lineage string
+	}{
+		{"shop.example.com", CertExpiring, "shop.example.com"}, // Its own lineage wins
+		{"api.example.com", CertValid, "wildcard-example-com"},
+		{"a.b.example.com", CertNone, ""},
+		{"old.example.org", CertExpired, "old.example.org"},
+	}
+	for _, tt := range tests {
+		status, cert := certStatus(tt.name, certs, now)
+		if status != tt.status || (cert == nil) != (tt.lineage == "") || cert != nil && cert.Domain != tt.lineage {
+			t.Errorf("%s: got %s %+v, want %s %s", tt.name, status, cert, tt.status, tt.lineage)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package dnscheck resolves upstream hostnames through both the system
+// resolver and a DNS-over-HTTPS server (RFC 8484), so that a 502 caused by
+// DNS can be told apart from a backend that is down.
+package dnscheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDoHURL is Cloudflare's DNS-over-HTTPS endpoint.
+	DefaultDoHURL = "https://cloudflare-dns.com/dns-query"
+	// DefaultCacheTTL is how long a result is reused, so polling a site's
+	// runtime view doesn't query the resolvers on every request.
+	DefaultCacheTTL = time.Minute
+)
+
+// Result statuses. Problem is set for the ones that can explain a 502.
+const (
+	OK          = "ok"           // Both resolvers share an address
+	Mismatch    = "mismatch"     // The resolvers have no address in common
+	NXDomain    = "nxdomain"     // The system resolver says the name doesn't exist
+	SystemError = "system_error" // The system resolver failed
+	Internal    = "internal"     // Only the system resolver knows the name (containers, split horizon)
+	DoHError    = "doh_error"    // The system resolver answered but DoH failed
+)
+
+// Result is one hostname resolved both ways.
+type Result struct {
+	Host        string    `json:"host"`
+	Status      string    `json:"status"`
+	Problem     bool      `json:"problem"`
+	Message     string    `json:"message"`
+	System      []string  `json:"system"`
+	SystemError string    `json:"system_error,omitempty"`
+	DoH         []string  `json:"doh,omitempty"`
+	DoHError    string    `json:"doh_error,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// Checker resolves hostnames and caches the results for CacheTTL.
+type Checker struct {
+	// DoHURL is the DNS-over-HTTPS endpoint. Empty only asks the system
+	// resolver.
+	DoHURL   string
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	Client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]Result
+
+	// Test hook replacing the system resolver.
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		DoHURL:   DefaultDoHURL,
+		Timeout:  3 * time.Second,
+		CacheTTL: DefaultCacheTTL,
+		Client:   &http.Client{},
+		cache:    make(map[string]Result),
+	}
+}
+
+// Hosts returns the hostnames in upstream addresses ("host:port", with an
+// optional http:// or https:// scheme), skipping IP addresses and
+// duplicates, in order.
+func Hosts(upstreams ...string) []string {
+	var hosts []string
+	for _, u := range upstreams {
+		if u == "" {
+			continue
+		}
+		addr := strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		addr, _, _ = strings.Cut(addr, "/")
+		host := addr
+		if h, _, err := net.SplitHostPort(addr); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+		if host == "" || net.ParseIP(host) != nil || slices.Contains(hosts, host) {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Check resolves hosts concurrently. Results are in the order of hosts.
+func (c *Checker) Check(ctx context.Context, hosts []string) []Result {
+	results := make([]Result, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		if r, ok := c.cached(host); ok {
+			results[i] = r
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx, host)
+			c.mu.Lock()
+			c.cache[host] = results[i]
+			c.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *Checker) cached(host string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.cache[host]
+	if ok && time.Since(r.CheckedAt) < c.CacheTTL {
+		return r, true
+	}
+	delete(c.cache, host)
+	return Result{}, false
+}
+
+func (c *Checker) check(ctx context.Context, host string) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	r := Result{Host: host, System: []string{}, CheckedAt: time.Now()}
+
+	sys, sysErr := c.systemLookup(ctx, host)
+	var dnsErr *net.DNSError
+	sysNX := errors.As(sysErr, &dnsErr) && dnsErr.IsNotFound
+	if sysErr != nil {
+		r.SystemError = sysErr.Error()
+	} else {
+		r.System = sys
+	}
+
+	// Public resolvers don't know container and other internal names.
+	if c.DoHURL == "" || internalName(host) {
+		switch {
+		case sysNX:
+			r.Status, r.Problem, r.Message = NXDomain, true, fmt.Sprintf("%s does not resolve; nginx can't reach the upstream until it does", host)
+		case sysErr != nil:
+			r.Status, r.Problem, r.Message = SystemError, true, fmt.Sprintf("the system resolver failed for %s", host)
+		case c.DoHURL == "":
+			r.Status, r.Message = OK, "resolved by the system resolver"
+		default:
+			r.Status, r.Message = Internal, "internal name, only asked of the system resolver"
+		}
+		return r
+	}
+
+	doh, dohNX, dohErr := c.resolveDoH(ctx, host)
+	if dohErr != nil {
+		r.DoHError = dohErr.Error()
+	} else {
+		r.DoH = doh
+	}
+	switch {
+	case sysNX && dohErr == nil && !dohNX:
+		r.Status, r.Problem = NXDomain, true
+		r.Message = fmt.Sprintf("the system resolver says %s doesn't exist, but DoH resolves it; check the host's resolver configuration", host)
+	case sysNX:
+		r.Status, r.Problem = NXDomain, true
+		r.Message = fmt.Sprintf("%s does not resolve; nginx can't reach the upstream until it does", host)
+	case sysErr != nil:
+		r.Status, r.Problem = SystemError, true
+		r.Message = fmt.Sprintf("the system resolver failed for %s; check the host's resolver configuration", host)
+	case dohErr != nil:
+		r.Status, r.Message = DoHError, "resolved by the system resolver; the DoH server could not be asked"
+	case dohNX || len(doh) == 0:
+		r.Status, r.Message = Internal, "only the system resolver knows this name (split-horizon DNS)"
+	case !overlaps(sys, doh):
+		r.Status, r.Problem = Mismatch, true
+		r.Message = "the system resolver and DoH have no address in common; nginx may be connecting to a stale or hijacked address"
+	default:
+		r.Status, r.Message = OK, "both resolvers agree"
+	}
+	return r
+}
+
+func (c *Checker) systemLookup(ctx context.Context, host string) ([]string, error) {
+	if c.lookupHost != nil {
+		return c.lookupHost(ctx, host)
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// internalName reports whether host can only be known to local resolvers:
+// single-label names such as Docker container names, and reserved suffixes.
+func internalName(host string) bool {
+	if !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range []string{".local", ".internal", ".localhost", ".lan", ".home.arpa"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if net.ParseIP(x).Equal(net.ParseIP(y)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	dnsTypeA     = 1
+	dnsTypeAAAA  = 28
+	dnsClassIN   = 1
+	rcodeNameErr = 3
+)
+
+// resolveDoH asks the DoH server for A and AAAA records of host.
+func (c *Checker) resolveDoH(ctx context.Context, host string) (addrs []string, nx bool, err error) {
+	addrs = []string{}
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		query, err := buildQuery(host, qtype)
+		if err != nil {
+			return nil, false, err
+		}
+		resp, err := c.exchange(ctx, query)
+		if err != nil {
+			return nil, false, err
+		}
+		found, rcode, err := parseAnswers(resp)
+		if err != nil {
+			return nil, false, err
+		}
+		switch rcode {
+		case 0:
+			addrs = append(addrs, found...)
+		case rcodeNameErr:
+			return nil, true, nil
+		default:
+			return nil, false, fmt.Errorf("DoH lookup for %s failed: rcode %d", host, rcode)
+		}
+	}
+	return addrs, false, nil
+}
+
+// exchange POSTs a DNS message to the DoH server.
+func (c *Checker) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.DoHURL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server answered %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+// buildQuery encodes a recursive query with ID 0, as RFC 8484 recommends
+// for cacheability.
+func buildQuery(name string, qtype uint16) ([]byte, error) {
+	msg := []byte{0, 0, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0} // RD, one question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg, nil
+}
+
+var errShortMessage = errors.New("malformed DNS response")
+
+// parseAnswers returns the A and AAAA addresses in a response and its
+// rcode. CNAMEs followed by the resolver are skipped.
+func parseAnswers(msg []byte) ([]string, int, error) {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return nil, 0, errShortMessage
+	}
+	rcode := int(msg[3] & 0x0f)
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		off += 4 // type, class
+	}
+
+	var addrs []string
+	for i := 0; i < ancount; i++ {
+		var err error
+		if off, err = skipName(msg, off); err != nil {
+			return nil, 0, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, errShortMessage
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, errShortMessage
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+
+		if rtype == dnsTypeA && rdlen == net.IPv4len || rtype == dnsTypeAAAA && rdlen == net.IPv6len {
+			addrs = append(addrs, net.IP(rdata).String())
+		}
+	}
+	return addrs, rcode, nil
+}
+
+// skipName returns the offset just past the (possibly compressed) name at off.
+func skipName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errShortMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			return off + 2, nil // Pointer ends the name
+		default:
+			off += 1 + l
+		}
+	}
+}
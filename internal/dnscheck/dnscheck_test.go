@@ -0,0 +1,126 @@
+package dnscheck
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dohServer answers A queries from records; names missing from it are
+// NXDOMAIN.
+func dohServer(t *testing.T, records map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", 415)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		end, err := skipName(query, 12)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var labels []string
+		for off := 12; query[off] != 0; off += 1 + int(query[off]) {
+			labels = append(labels, string(query[off+1:off+1+int(query[off])]))
+		}
+		qtype := binary.BigEndian.Uint16(query[end:])
+
+		resp := append([]byte{}, query[:end+4]...)
+		resp[2] |= 0x80 // QR
+		ip, ok := records[strings.Join(labels, ".")]
+		switch {
+		case !ok:
+			resp[3] = rcodeNameErr
+		case qtype == dnsTypeA:
+			resp[7] = 1 // ANCOUNT
+			resp = append(resp, 0xc0, 12)
+			resp = binary.BigEndian.AppendUint16(resp, dnsTypeA)
+			resp = binary.BigEndian.AppendUint16(resp, dnsClassIN)
+			resp = append(resp, 0, 0, 0, 60, 0, 4)
+			resp = append(resp, net.ParseIP(ip).To4()...)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(resp)
+	}))
+}
+
+func TestCheck(t *testing.T) {
+	srv := dohServer(t, map[string]string{
+		"api.example.com":    "203.0.113.10",
+		"moved.example.com":  "203.0.113.20",
+		"broken.example.com": "203.0.113.30",
+	})
+	defer srv.Close()
+
+	c := NewChecker()
+	c.DoHURL = srv.URL
+	system := map[string][]string{
+		"api.example.com":     {"203.0.113.10", "2001:db8::10"},
+		"moved.example.com":   {"198.51.100.1"},
+		"intranet.corp.local": {"10.0.0.5"},
+		"app":                 {"172.18.0.4"},
+		"vpn.example.com":     {"10.8.0.1"},
+	}
+	var lookups atomic.Int32
+	c.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups.Add(1)
+		if addrs, ok := system[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	hosts := []string{"api.example.com", "moved.example.com", "broken.example.com", "gone.example.com", "intranet.corp.local", "app", "vpn.example.com"}
+	want := []struct {
+		status  string
+		problem bool
+	}{
+		{OK, false},
+		{Mismatch, true},
+		{NXDomain, true},
+		{NXDomain, true},
+		{Internal, false},
+		{Internal, false},
+		{Internal, false}, // Split horizon
+	}
+	results := c.Check(context.Background(), hosts)
+	for i, w := range want {
+		if r := results[i]; r.Host != hosts[i] || r.Status != w.status || r.Problem != w.problem {
+			t.Errorf("%s: got %s (problem %v), want %s: %+v", hosts[i], r.Status, r.Problem, w.status, r)
+		}
+	}
+	if !strings.Contains(results[2].Message, "DoH resolves it") {
+		t.Errorf("Expected the resolver to be blamed for broken.example.com, got %q", results[2].Message)
+	}
+
+	// Results are cached.
+	c.Check(context.Background(), hosts[:1])
+	if n := lookups.Load(); n != int32(len(hosts)) {
+		t.Errorf("Expected a cached result, got %d lookups", n)
+	}
+
+	// An unreachable DoH server doesn't make a problem of a resolving host.
+	c.DoHURL = "http://127.0.0.1:1/dns-query"
+	if r := c.Check(context.Background(), []string{"vpn2.example.com"})[0]; r.Status != NXDomain {
+		t.Errorf("Expected NXDOMAIN from the system resolver, got %+v", r)
+	}
+	system["vpn2.example.com"] = []string{"10.8.0.2"}
+	c.cache = map[string]Result{}
+	if r := c.Check(context.Background(), []string{"vpn2.example.com"})[0]; r.Status != DoHError || r.Problem {
+		t.Errorf("Expected a DoH error without a problem, got %+v", r)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	got := Hosts("app:3000", "https://API.example.com/v1", "10.0.0.1:80", "[2001:db8::1]:443", "app:3001", "", "backend.example.com.")
+	want := []string{"app", "api.example.com", "backend.example.com"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Hosts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Package faults injects failures into hubfly's side effects so operators
+// and CI can exercise error paths (status transitions, retries, rollbacks)
+// without breaking nginx, certbot or the store for real. A nil *Injector is
+// valid and never fires, so production builds pay only a nil check.
+package faults
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Injection points.
+const (
+	NginxValidate = "nginx.validate"
+	NginxReload   = "nginx.reload"
+	CertbotIssue  = "certbot.issue"
+	CertbotRenew  = "certbot.renew"
+	StoreWrite    = "store.write"
+)
+
+// Points lists every injection point.
+var Points = []string{NginxValidate, NginxReload, CertbotIssue, CertbotRenew, StoreWrite}
+
+// Modes.
+const (
+	ModeError   = "error"   // fail immediately
+	ModeTimeout = "timeout" // wait Delay, then fail as a timeout
+	ModeDelay   = "delay"   // wait Delay, then succeed
+)
+
+// Fault is an armed failure at one injection point.
+type Fault struct {
+	Point       string  `json:"point"`
+	Mode        string  `json:"mode,omitempty"`        // default "error"
+	DelayMS     int     `json:"delay_ms,omitempty"`    // for "timeout" and "delay"
+	Probability float64 `json:"probability,omitempty"` // 0 < p <= 1, default 1
+	Count       int     `json:"count,omitempty"`       // fire at most this often (0 = until cleared)
+	Message     string  `json:"message,omitempty"`
+	Fired       int     `json:"fired"`
+}
+
+// Injector holds the armed faults.
+type Injector struct {
+	mu     sync.Mutex
+	faults map[string]*Fault
+	rand   func() float64
+}
+
+func NewInjector() *Injector {
+	return &Injector{faults: make(map[string]*Fault), rand: rand.Float64}
+}
+
+// Set arms f, replacing any fault at the same point.
+func (i *Injector) Set(f Fault) error {
+	if !validPoint(f.Point) {
+		return fmt.Errorf("unknown injection point %q", f.Point)
+	}
+	switch f.Mode {
+	case "":
+		f.Mode = ModeError
+	case ModeError, ModeTimeout, ModeDelay:
+	default:
+		return fmt.Errorf("unknown mode %q: must be error, timeout or delay", f.Mode)
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return fmt.Errorf("probability must be between 0 and 1")
+	}
+	if f.DelayMS < 0 || f.Count < 0 {
+		return fmt.Errorf("delay_ms and count must not be negative")
+	}
+	f.Fired = 0
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults[f.Point] = &f
+	return nil
+}
+
+// Clear disarms the fault at point, or every fault when point is empty.
+func (i *Injector) Clear(point string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if point == "" {
+		i.faults = make(map[string]*Fault)
+		return
+	}
+	delete(i.faults, point)
+}
+
+// List returns the armed faults ordered by point.
+func (i *Injector) List() []Fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	list := make([]Fault, 0, len(i.faults))
+	for _, f := range i.faults {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Point < list[b].Point })
+	return list
+}
+
+// Check is called at an injection point. It returns the injected error, if
+// the fault there fires, after any configured delay.
+func (i *Injector) Check(point string) error {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	f, ok := i.faults[point]
+	if !ok || (f.Probability > 0 && i.rand() >= f.Probability) {
+		i.mu.Unlock()
+		return nil
+	}
+	f.Fired++
+	fault := *f
+	if f.Count > 0 && f.Fired >= f.Count {
+		delete(i.faults, point)
+	}
+	i.mu.Unlock()
+
+	if fault.Mode != ModeError {
+		time.Sleep(time.Duration(fault.DelayMS) * time.Millisecond)
+	}
+	if fault.Mode == ModeDelay {
+		return nil
+	}
+	msg := fault.Message
+	if msg == "" {
+		msg = fault.Mode
+	}
+	return fmt.Errorf("injected fault at %s: %s", point, msg)
+}
+
+func validPoint(point string) bool {
+	for _, p := range Points {
+		if p == point {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package faults
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInjector(t *testing.T) {
+	var nilInjector *Injector
+	if err := nilInjector.Check(NginxReload); err != nil {
+		t.Fatalf("nil injector should never fire: %v", err)
+	}
+
+	inj := NewInjector()
+	if err := inj.Set(Fault{Point: "nginx.restart"}); err == nil {
+		t.Errorf("Unknown point should be rejected")
+	}
+	if err := inj.Set(Fault{Point: NginxReload, Mode: "explode"}); err == nil {
+		t.Errorf("Unknown mode should be rejected")
+	}
+
+	if err := inj.Set(Fault{Point: NginxReload, Count: 2, Message: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inj.Check(CertbotIssue); err != nil {
+		t.Errorf("Unarmed point fired: %v", err)
+	}
+	for n := 0; n < 2; n++ {
+		err := inj.Check(NginxReload)
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("Check %d = %v, want injected error", n, err)
+		}
+	}
+	if err := inj.Check(NginxReload); err != nil {
+		t.Errorf("Fault should disarm after count: %v", err)
+	}
+	if len(inj.List()) != 0 {
+		t.Errorf("Exhausted fault still listed: %v", inj.List())
+	}
+
+	inj.Set(Fault{Point: StoreWrite, Probability: 0.5})
+	inj.rand = func() float64 { return 0.7 }
+	if err := inj.Check(StoreWrite); err != nil {
+		t.Errorf("Fault should not fire above its probability: %v", err)
+	}
+	inj.rand = func() float64 { return 0.2 }
+	if err := inj.Check(StoreWrite); err == nil {
+		t.Errorf("Fault should fire below its probability")
+	}
+
+	inj.Set(Fault{Point: CertbotRenew, Mode: ModeDelay, DelayMS: 1})
+	if err := inj.Check(CertbotRenew); err != nil {
+		t.Errorf("Delay mode should succeed: %v", err)
+	}
+	inj.Clear("")
+	if len(inj.List()) != 0 {
+		t.Errorf("Clear should disarm everything")
+	}
+}
@@ -0,0 +1,371 @@
+// Package geoip looks up client IPs in a MaxMind DB (.mmdb) file, such as
+// GeoLite2-City/Country or the DB-IP Lite databases. Only the subset of the
+// format needed for lookups is implemented, so no third-party reader is
+// required.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Location is what a lookup reports about an IP.
+type Location struct {
+	Country     string `json:"country,omitempty"`      // ISO 3166-1 alpha-2 code
+	CountryName string `json:"country_name,omitempty"` // English name
+	City        string `json:"city,omitempty"`
+}
+
+// DB is an in-memory MaxMind database. It is safe for concurrent use.
+type DB struct {
+	Type string // database_type from the metadata, e.g. "GeoLite2-City"
+
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint // offset of the data section
+	ipv4Start  uint // node reached after the 96 zero bits of ::/96
+}
+
+// Open reads an .mmdb file.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New parses a database held in buf.
+func New(buf []byte) (*DB, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("geoip: not a MaxMind DB file")
+	}
+	metaStart := uint(i + len(metadataMarker))
+	d := decoder{buf: buf[metaStart:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("geoip: metadata is not a map")
+	}
+
+	db := &DB{
+		buf:        buf,
+		nodeCount:  uint(toUint(meta["node_count"])),
+		recordSize: uint(toUint(meta["record_size"])),
+		ipVersion:  uint(toUint(meta["ip_version"])),
+	}
+	db.Type, _ = meta["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + 16
+	if db.dataStart > metaStart {
+		return nil, errors.New("geoip: search tree exceeds file size")
+	}
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Lookup returns the location of ip, or ok false when the database has no
+// entry for it.
+func (db *DB) Lookup(ip net.IP) (Location, bool) {
+	v, ok := db.lookup(ip)
+	if !ok {
+		return Location{}, false
+	}
+	record, _ := v.(map[string]interface{})
+	loc := Location{
+		Country:     pathString(record, "country", "iso_code"),
+		CountryName: pathString(record, "country", "names", "en"),
+		City:        pathString(record, "city", "names", "en"),
+	}
+	if loc.Country == "" {
+		// Anonymous or satellite providers only carry a registered country.
+		loc.Country = pathString(record, "registered_country", "iso_code")
+		loc.CountryName = pathString(record, "registered_country", "names", "en")
+	}
+	return loc, loc.Country != "" || loc.City != ""
+}
+
+// LookupString is Lookup for a textual address; invalid input is not found.
+func (db *DB) LookupString(addr string) (Location, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return Location{}, false
+	}
+	return db.Lookup(ip)
+}
+
+func (db *DB) lookup(ip net.IP) (interface{}, bool) {
+	var bits []byte
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		bits = v4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 6 {
+		bits = ip.To16()
+	} else {
+		return nil, false // IPv6 address in an IPv4-only database
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, false // node_count itself marks "no data"
+	}
+
+	offset := node - db.nodeCount - 16
+	d := decoder{buf: db.buf[db.dataStart:]}
+	v, _, err := d.decode(offset)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a node.
+func (db *DB) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		o := node*6 + bit*3
+		b := db.buf[o : o+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		o := node * 7
+		b := db.buf[o : o+7]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		o := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[o : o+4]))
+	}
+}
+
+func pathString(m map[string]interface{}, path ...string) string {
+	var v interface{} = m
+	for _, key := range path {
+		mm, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = mm[key]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func toUint(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		return uint64(n)
+	}
+	return 0
+}
+
+// Data types of the MaxMind DB data section.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+var errCorrupt = errors.New("geoip: corrupt data section")
+
+// decoder reads values from a data section (or the metadata, which uses the
+// same encoding). Pointers are offsets from the start of buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset just after it.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[offset:end]
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c) // uint128 values are truncated; unused here
+		}
+		return n, end, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), end, nil
+	}
+	return nil, 0, fmt.Errorf("geoip: unsupported data type %d", typ)
+}
+
+// control decodes a control byte (and any extended type and size bytes).
+func (d *decoder) control(offset uint) (typ, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = uint(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1f)
+	if typ == typePointer {
+		return typ, size, offset, nil
+	}
+	if size >= 29 {
+		n := size - 28 // 1, 2 or 3 extra bytes
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, errCorrupt
+		}
+		var ext uint
+		for _, c := range d.buf[offset : offset+n] {
+			ext = ext<<8 | uint(c)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + ext
+		case 2:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+	}
+	return typ, size, offset, nil
+}
+
+// pointer decodes the target of a pointer whose control bits are ctrl.
+func (d *decoder) pointer(ctrl, offset uint) (target, next uint, err error) {
+	n := (ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var v uint
+	if n < 4 {
+		v = ctrl & 0x7
+	}
+	for _, c := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
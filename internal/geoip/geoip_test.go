@@ -0,0 +1,146 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The helpers below write just enough of the MaxMind DB format to build a
+// database with a single network.
+
+func encCtrl(typ, size int) []byte {
+	if typ > 7 {
+		return []byte{byte(size), byte(typ - 7)}
+	}
+	return []byte{byte(typ<<5 | size)}
+}
+
+func encString(s string) []byte {
+	return append(encCtrl(typeString, len(s)), s...)
+}
+
+func encUint16(n uint16) []byte {
+	return append(encCtrl(typeUint16, 2), byte(n>>8), byte(n))
+}
+
+func encUint32(n uint32) []byte {
+	return append(encCtrl(typeUint32, 4), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// encMap encodes alternating keys and already-encoded values.
+func encMap(kv ...interface{}) []byte {
+	out := encCtrl(typeMap, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		out = append(out, encString(kv[i].(string))...)
+		out = append(out, kv[i+1].([]byte)...)
+	}
+	return out
+}
+
+func names(en string) []byte { return encMap("en", encString(en)) }
+
+// buildDB returns a database mapping network/prefix to record.
+func buildDB(t *testing.T, ipVersion int, network net.IP, prefix int, record []byte) []byte {
+	t.Helper()
+	var bits []int
+	for i := 0; i < prefix; i++ {
+		bits = append(bits, int(network[i/8]>>(7-uint(i%8)))&1)
+	}
+	nodeCount := len(bits)
+
+	var tree bytes.Buffer
+	put := func(v int) { tree.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)}) }
+	for i, bit := range bits {
+		next := i + 1
+		if i == len(bits)-1 {
+			next = nodeCount + 16 // data section offset 0
+		}
+		records := [2]int{nodeCount, nodeCount}
+		records[bit] = next
+		put(records[0])
+		put(records[1])
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, 16))
+	buf.Write(record)
+	buf.Write(metadataMarker)
+	buf.Write(encMap(
+		"node_count", encUint32(uint32(nodeCount)),
+		"record_size", encUint16(24),
+		"ip_version", encUint16(uint16(ipVersion)),
+		"database_type", encString("Test-City"),
+	))
+	return buf.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	record := encMap(
+		"country", encMap("iso_code", encString("AU"), "names", names("Australia")),
+		"city", encMap("names", names("Sydney")),
+	)
+	want := Location{Country: "AU", CountryName: "Australia", City: "Sydney"}
+
+	tests := []struct {
+		name      string
+		ipVersion int
+		network   net.IP
+		prefix    int
+	}{
+		{"ipv4 database", 4, net.ParseIP("1.2.0.0").To4(), 16},
+		{"ipv6 database", 6, net.ParseIP("::1.2.0.0").To16(), 112},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := New(buildDB(t, tt.ipVersion, tt.network, tt.prefix, record))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if db.Type != "Test-City" {
+				t.Errorf("Expected type Test-City, got %q", db.Type)
+			}
+			if got, ok := db.LookupString("1.2.3.4"); !ok || got != want {
+				t.Errorf("Lookup(1.2.3.4) = %+v, %v; want %+v", got, ok, want)
+			}
+			if _, ok := db.LookupString("1.3.3.4"); ok {
+				t.Errorf("Expected 1.3.3.4 to be unknown")
+			}
+			if _, ok := db.LookupString("not-an-ip"); ok {
+				t.Errorf("Expected invalid address to be unknown")
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "geoip_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "bad.mmdb")
+	os.WriteFile(path, []byte("not a database"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Errorf("Expected an error for a file without metadata")
+	}
+
+	// Only a registered country, whose code is reached through a pointer
+	// to a string stored after the record.
+	ptr := func(offset int) []byte { return []byte{byte(typePointer<<5 | offset>>8), byte(offset)} }
+	record := encMap("registered_country", encMap("iso_code", ptr(0)))
+	record = append(encMap("registered_country", encMap("iso_code", ptr(len(record)))), encString("DE")...)
+	path = filepath.Join(tmpDir, "test.mmdb")
+	os.WriteFile(path, buildDB(t, 4, net.ParseIP("10.0.0.0").To4(), 8, record), 0644)
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got, _ := db.LookupString("10.1.2.3"); got.Country != "DE" {
+		t.Errorf("Expected registered country DE, got %+v", got)
+	}
+}
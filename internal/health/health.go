@@ -0,0 +1,196 @@
+// Package health probes upstreams and keeps per-address latency and
+// reachability statistics.
+package health
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats summarizes recent probes of one upstream.
+type Stats struct {
+	Address             string        `json:"address"`
+	Healthy             bool          `json:"healthy"`
+	Latency             time.Duration `json:"latency_ns"` // Smoothed (EWMA) connect latency
+	LastLatency         time.Duration `json:"last_latency_ns"`
+	LastCheck           time.Time     `json:"last_check"`
+	LastError           string        `json:"last_error,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// Tracker probes upstreams and stores their Stats. Stats are keyed by the
+// caller, so different checks against the same address stay separate.
+type Tracker struct {
+	// Timeout bounds a single probe.
+	Timeout time.Duration
+	// Alpha is the EWMA smoothing factor for latency (0..1].
+	Alpha float64
+	// FailThreshold is how many consecutive failures mark an upstream unhealthy.
+	FailThreshold int
+
+	mu    sync.RWMutex
+	stats map[string]*Stats
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		Timeout:       2 * time.Second,
+		Alpha:         0.3,
+		FailThreshold: 2,
+		stats:         make(map[string]*Stats),
+	}
+}
+
+// Probe TCP-dials addr and folds the result into its stats.
+func (t *Tracker) Probe(addr string) Stats {
+	return t.Check(addr, addr, TCPProbe(addr, t.Timeout))
+}
+
+// Check runs probe, timing it, and folds the result into the stats stored
+// under key. addr is the upstream being checked.
+func (t *Tracker) Check(key, addr string, probe func() error) Stats {
+	start := time.Now()
+	err := probe()
+	return t.record(key, addr, time.Since(start), err)
+}
+
+// TCPProbe succeeds when a TCP connection to addr can be opened.
+func TCPProbe(addr string, timeout time.Duration) func() error {
+	return func() error {
+		conn, err := net.DialTimeout("tcp", DialAddress(addr), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPProbe GETs path on addr and succeeds when the response status is in
+// expect, or 200-399 when expect is empty.
+func HTTPProbe(addr, path string, expect []int, timeout time.Duration) func() error {
+	return httpProbe(addr, path, timeout, nil, expected(expect))
+}
+
+func expected(expect []int) func(code int) bool {
+	return func(code int) bool {
+		if len(expect) == 0 {
+			return code >= 200 && code < 400
+		}
+		return slices.Contains(expect, code)
+	}
+}
+
+// HTTPSProbe is HTTPProbe over TLS with cfg, for upstreams that need a
+// client certificate or a private CA.
+func HTTPSProbe(addr, path string, expect []int, timeout time.Duration, cfg *tls.Config) func() error {
+	if !strings.HasPrefix(addr, "https://") {
+		addr = "https://" + strings.TrimPrefix(addr, "http://")
+	}
+	return httpProbe(addr, path, timeout, cfg, expected(expect))
+}
+
+// HTTPAnswerProbe succeeds when addr answers an HTTP request at all, with
+// any status.
+func HTTPAnswerProbe(addr string, timeout time.Duration) func() error {
+	return httpProbe(addr, "/", timeout, nil, func(int) bool { return true })
+}
+
+func httpProbe(addr, path string, timeout time.Duration, cfg *tls.Config, accept func(code int) bool) func() error {
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u := "http://" + DialAddress(addr) + path
+	if strings.HasPrefix(addr, "https://") {
+		u = "https://" + DialAddress(addr) + path
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		// Redirects count as a response from the upstream; don't follow them.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	if cfg != nil {
+		client.Transport = &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}
+	}
+	return func() error {
+		resp, err := client.Get(u)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		if accept(resp.StatusCode) {
+			return nil
+		}
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+}
+
+func (t *Tracker) record(key, addr string, elapsed time.Duration, err error) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.stats[key]
+	if !ok {
+		st = &Stats{Address: addr}
+		t.stats[key] = st
+	}
+	st.LastCheck = time.Now()
+
+	if err != nil {
+		st.LastError = err.Error()
+		st.ConsecutiveFailures++
+		if st.ConsecutiveFailures >= t.FailThreshold {
+			st.Healthy = false
+		}
+		return *st
+	}
+
+	st.LastError = ""
+	st.ConsecutiveFailures = 0
+	st.Healthy = true
+	st.LastLatency = elapsed
+	if st.Latency == 0 {
+		st.Latency = elapsed
+	} else {
+		st.Latency = time.Duration(t.Alpha*float64(elapsed) + (1-t.Alpha)*float64(st.Latency))
+	}
+	return *st
+}
+
+// Get returns the stats stored under key, if it has been probed.
+func (t *Tracker) Get(key string) (Stats, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st, ok := t.stats[key]
+	if !ok {
+		return Stats{}, false
+	}
+	return *st, true
+}
+
+// DialAddress normalizes an upstream ("host", "host:port", "http://host")
+// to a dialable host:port.
+func DialAddress(upstream string) string {
+	addr, port := upstream, "80"
+	if rest, ok := strings.CutPrefix(addr, "https://"); ok {
+		addr, port = rest, "443"
+	} else {
+		addr = strings.TrimPrefix(addr, "http://")
+	}
+	addr, _, _ = strings.Cut(addr, "/")
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
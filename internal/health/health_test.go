@@ -0,0 +1,71 @@
+package health
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(204)
+			return
+		}
+		w.WriteHeader(503)
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	tr := NewTracker()
+	if st := tr.Check("ok", addr, HTTPProbe(addr, "/healthz", nil, time.Second)); !st.Healthy || st.LastError != "" {
+		t.Errorf("Expected healthy upstream, got %+v", st)
+	}
+	if st := tr.Check("strict", addr, HTTPProbe(addr, "/healthz", []int{200}, time.Second)); st.Healthy {
+		t.Errorf("204 should fail when only 200 is expected")
+	}
+
+	// Unhealthy only after FailThreshold consecutive failures
+	bad := HTTPProbe(addr, "/", nil, time.Second)
+	tr.Check("ok", addr, bad)
+	if st, _ := tr.Get("ok"); !st.Healthy || st.ConsecutiveFailures != 1 {
+		t.Errorf("One failure should not flip health: %+v", st)
+	}
+	if st := tr.Check("ok", addr, bad); st.Healthy {
+		t.Errorf("Two failures should mark unhealthy: %+v", st)
+	}
+
+	// Any status means the upstream answers
+	if err := HTTPAnswerProbe(addr, time.Second)(); err != nil {
+		t.Errorf("503 should count as an answer: %v", err)
+	}
+	srv.Close()
+	if err := HTTPAnswerProbe(addr, time.Second)(); err == nil {
+		t.Errorf("Closed server should not answer")
+	}
+}
+
+func TestHTTPSProbe(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	// The test server's own certificate doubles as the client certificate.
+	client := &tls.Config{InsecureSkipVerify: true, Certificates: srv.TLS.Certificates}
+	if err := HTTPSProbe(addr, "/", nil, time.Second, client)(); err != nil {
+		t.Errorf("Expected the probe to pass with a client certificate: %v", err)
+	}
+	if err := HTTPSProbe(addr, "/", nil, time.Second, &tls.Config{InsecureSkipVerify: true})(); err == nil {
+		t.Errorf("Expected the probe to fail without a client certificate")
+	}
+	if err := HTTPProbe(addr, "/", nil, time.Second)(); err == nil {
+		t.Errorf("Expected plain HTTP to a TLS upstream to fail")
+	}
+}
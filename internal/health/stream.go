@@ -0,0 +1,50 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxReply bounds what StreamProbe reads of an answer.
+const maxReply = 4096
+
+// StreamProbe connects to addr over network ("tcp" or "udp"), writes send
+// if set, and succeeds when the first reply contains expect. Without
+// expect, a TCP connection (and write) is enough, and a UDP probe only
+// needs some reply.
+func StreamProbe(network, addr, send, expect string, timeout time.Duration) func() error {
+	return func() error {
+		conn, err := net.DialTimeout(network, addr, timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(timeout))
+		if send != "" {
+			if _, err := conn.Write([]byte(send)); err != nil {
+				return err
+			}
+		}
+		if expect == "" && network != "udp" {
+			return nil
+		}
+		buf := make([]byte, maxReply)
+		n, err := conn.Read(buf)
+		if n == 0 && err != nil {
+			return fmt.Errorf("no reply: %w", err)
+		}
+		if !strings.Contains(string(buf[:n]), expect) {
+			return fmt.Errorf("reply %q does not contain %q", truncate(string(buf[:n]), 64), expect)
+		}
+		return nil
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if line, _ := bufio.NewReader(conn).ReadString('\n'); line == "PING\r\n" {
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}()
+		}
+	}()
+	addr := l.Addr().String()
+
+	if err := StreamProbe("tcp", addr, "", "", time.Second)(); err != nil {
+		t.Errorf("Expected a plain connect to pass: %v", err)
+	}
+	if err := StreamProbe("tcp", addr, "PING\r\n", "+PONG", time.Second)(); err != nil {
+		t.Errorf("Expected PING to be answered: %v", err)
+	}
+	if err := StreamProbe("tcp", addr, "HELLO\r\n", "+PONG", time.Second)(); err == nil {
+		t.Error("Expected a probe without the expected reply to fail")
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte("echo:"), buf[:n]...), from)
+		}
+	}()
+	if err := StreamProbe("udp", pc.LocalAddr().String(), "status", "echo:status", time.Second)(); err != nil {
+		t.Errorf("Expected the UDP probe to be answered: %v", err)
+	}
+	closed, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	silent := closed.LocalAddr().String()
+	closed.Close()
+	if err := StreamProbe("udp", silent, "status", "", 200*time.Millisecond)(); err == nil {
+		t.Error("Expected a UDP probe without a reply to fail")
+	}
+}
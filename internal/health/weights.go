@@ -0,0 +1,89 @@
+package health
+
+import "math"
+
+// weightScale is the effective weight of a healthy upstream with base
+// weight 1 when it is the fastest upstream. Slower upstreams scale down
+// from there, which leaves room for fractional shares without rounding
+// everything to 1.
+const weightScale = 10
+
+// Default bounds for adaptive weights.
+const (
+	DefaultMinWeight = 1
+	DefaultMaxWeight = 100
+)
+
+// AdaptiveWeights scales each upstream's base weight by its latency
+// relative to the fastest healthy upstream. Unhealthy upstreams get min.
+// Upstreams with no stats yet keep their full scaled base weight.
+func AdaptiveWeights(upstreams []string, base map[string]int, stats map[string]Stats, min, max int) map[string]int {
+	if min <= 0 {
+		min = DefaultMinWeight
+	}
+	if max <= 0 {
+		max = DefaultMaxWeight
+	}
+	if max < min {
+		max = min
+	}
+
+	var fastest float64
+	for _, u := range upstreams {
+		st, ok := stats[u]
+		if !ok || !st.Healthy || st.Latency <= 0 {
+			continue
+		}
+		if l := float64(st.Latency); fastest == 0 || l < fastest {
+			fastest = l
+		}
+	}
+
+	weights := make(map[string]int, len(upstreams))
+	for _, u := range upstreams {
+		b := base[u]
+		if b <= 0 {
+			b = 1
+		}
+		factor := 1.0
+		if st, ok := stats[u]; ok {
+			switch {
+			case !st.Healthy:
+				factor = 0
+			case st.Latency > 0 && fastest > 0:
+				factor = fastest / float64(st.Latency)
+			}
+		}
+		w := int(math.Round(float64(b) * weightScale * factor))
+		weights[u] = clamp(w, min, max)
+	}
+	return weights
+}
+
+// SignificantChange reports whether any weight moved by at least 20% (or
+// an upstream was added or removed), so jitter doesn't trigger reloads.
+func SignificantChange(old, next map[string]int) bool {
+	if len(old) != len(next) {
+		return true
+	}
+	for u, w := range next {
+		prev, ok := old[u]
+		if !ok {
+			return true
+		}
+		if diff := math.Abs(float64(w - prev)); diff > 0 && diff >= 0.2*float64(prev) {
+			return true
+		}
+	}
+	return false
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
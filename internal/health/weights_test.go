@@ -0,0 +1,59 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveWeights(t *testing.T) {
+	ups := []string{"a:80", "b:80", "c:80", "d:80"}
+	base := map[string]int{"a:80": 2}
+	stats := map[string]Stats{
+		"a:80": {Healthy: true, Latency: 10 * time.Millisecond},
+		"b:80": {Healthy: true, Latency: 40 * time.Millisecond},
+		"c:80": {Healthy: false, Latency: 5 * time.Millisecond},
+		// d has not been probed yet
+	}
+
+	got := AdaptiveWeights(ups, base, stats, 1, 15)
+	want := map[string]int{
+		"a:80": 15, // 2*10 clamped to max
+		"b:80": 3,  // 10 * 10/40, rounded
+		"c:80": 1,  // unhealthy gets min
+		"d:80": 10, // unknown keeps scaled base
+	}
+	for u, w := range want {
+		if got[u] != w {
+			t.Errorf("weight[%s] = %d, want %d", u, got[u], w)
+		}
+	}
+}
+
+func TestSignificantChange(t *testing.T) {
+	old := map[string]int{"a": 10, "b": 10}
+	if SignificantChange(old, map[string]int{"a": 9, "b": 11}) {
+		t.Errorf("10%% change should be ignored")
+	}
+	if !SignificantChange(old, map[string]int{"a": 10, "b": 5}) {
+		t.Errorf("50%% change should be significant")
+	}
+	if !SignificantChange(old, map[string]int{"a": 10}) {
+		t.Errorf("Removed upstream should be significant")
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	cases := map[string]string{
+		"app:8080":            "app:8080",
+		"app":                 "app:80",
+		"http://app/path":     "app:80",
+		"https://app":         "app:443",
+		"[::1]:9000":          "[::1]:9000",
+		"https://app:8443/x/": "app:8443",
+	}
+	for in, want := range cases {
+		if got := DialAddress(in); got != want {
+			t.Errorf("DialAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
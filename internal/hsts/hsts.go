@@ -0,0 +1,291 @@
+// Package hsts checks a domain against the HSTS preload list requirements
+// (https://hstspreload.org) and talks to the list's API to submit it or
+// read its status.
+package hsts
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPreloadAPI is the hstspreload.org API.
+	DefaultPreloadAPI = "https://hstspreload.org/api/v2"
+	// MinMaxAge is the shortest max-age the preload list accepts (one year).
+	MinMaxAge = 31536000
+	// RecommendedHeader satisfies every header requirement.
+	RecommendedHeader = "max-age=63072000; includeSubDomains; preload"
+)
+
+// Check statuses. Only "fail" makes a domain ineligible.
+const (
+	Pass = "pass"
+	Fail = "fail"
+	Warn = "warn"
+	Skip = "skip"
+)
+
+// Check is the outcome of one preload requirement.
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"` // pass, fail, warn, skip
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// Preloadable reports whether no check failed.
+func Preloadable(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// ListStatus is the domain's entry on the preload list.
+type ListStatus struct {
+	Name              string `json:"name"`
+	Status            string `json:"status"` // unknown, pending, preloaded, rejected, removed, ...
+	IncludeSubDomains bool   `json:"include_subdomains,omitempty"`
+}
+
+// Issue is a problem reported by the preload list API.
+type Issue struct {
+	Code    string `json:"code"`
+	Summary string `json:"summary"`
+	Message string `json:"message"`
+}
+
+// Submission is the preload list's answer to a submission. The domain is
+// queued only when Errors is empty.
+type Submission struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// Checker runs the preload checks over the network.
+type Checker struct {
+	PreloadAPI string
+	Timeout    time.Duration
+
+	// Test hooks.
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+	rootCAs    *x509.CertPool
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+func NewChecker() *Checker {
+	return &Checker{PreloadAPI: DefaultPreloadAPI, Timeout: 10 * time.Second}
+}
+
+// client does not follow redirects: each requirement is about the first
+// response.
+func (c *Checker) client() *http.Client {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	dial := dialer.DialContext
+	if c.dial != nil {
+		dial = c.dial
+	}
+	return &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			DialContext:       dial,
+			TLSClientConfig:   &tls.Config{RootCAs: c.rootCAs},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+func (c *Checker) get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// Check evaluates the preload requirements for domain: a valid certificate,
+// an HTTP to HTTPS redirect on the same host, the header with a long enough
+// max-age, includeSubDomains and preload, and HTTPS on www if it exists.
+func (c *Checker) Check(ctx context.Context, domain string) []Check {
+	client := c.client()
+	var checks []Check
+	add := func(name, status, message, fix string) {
+		checks = append(checks, Check{Name: name, Status: status, Message: message, Fix: fix})
+	}
+
+	if strings.Count(strings.TrimSuffix(domain, "."), ".") > 1 {
+		add("root_domain", Warn, domain+" looks like a subdomain; only registrable domains (example.com) can be submitted",
+			"Serve the header on the parent domain and submit that instead")
+	} else {
+		add("root_domain", Pass, domain+" is a registrable domain", "")
+	}
+
+	resp, err := c.get(ctx, client, "https://"+domain+"/")
+	if err != nil {
+		add("https", Fail, "HTTPS request failed: "+err.Error(), "Enable ssl on the site so it has a valid certificate")
+		for _, name := range []string{"hsts_header", "max_age", "include_subdomains", "preload"} {
+			add(name, Skip, "Needs a working HTTPS response", "")
+		}
+	} else {
+		add("https", Pass, "Valid certificate", "")
+		checks = append(checks, checkHeader(resp)...)
+	}
+
+	checks = append(checks, c.checkRedirect(ctx, client, domain))
+	checks = append(checks, c.checkWWW(ctx, client, domain))
+	return checks
+}
+
+// checkHeader validates the Strict-Transport-Security header of the HTTPS
+// response. A redirect must carry the header too.
+func checkHeader(resp *http.Response) []Check {
+	fix := `PATCH the site with {"security_headers": {"hsts": {"max_age_seconds": 63072000, "include_subdomains": true, "preload": true}}}`
+	value := resp.Header.Get("Strict-Transport-Security")
+	where := "the HTTPS response"
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		where = "the HTTPS redirect"
+	}
+	if value == "" {
+		return []Check{
+			{Name: "hsts_header", Status: Fail, Message: "No Strict-Transport-Security header on " + where, Fix: fix},
+			{Name: "max_age", Status: Skip, Message: "No header"},
+			{Name: "include_subdomains", Status: Skip, Message: "No header"},
+			{Name: "preload", Status: Skip, Message: "No header"},
+		}
+	}
+
+	maxAge := -1
+	var includeSubDomains, preload bool
+	for _, part := range strings.Split(value, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(arg), `"`)); err == nil {
+				maxAge = n
+			}
+		case "includesubdomains":
+			includeSubDomains = true
+		case "preload":
+			preload = true
+		}
+	}
+
+	checks := []Check{{Name: "hsts_header", Status: Pass, Message: "Header on " + where + ": " + value}}
+	switch {
+	case maxAge < 0:
+		checks = append(checks, Check{Name: "max_age", Status: Fail, Message: "The header has no valid max-age", Fix: fix})
+	case maxAge < MinMaxAge:
+		checks = append(checks, Check{Name: "max_age", Status: Fail,
+			Message: fmt.Sprintf("max-age=%d is shorter than one year (%d)", maxAge, MinMaxAge), Fix: fix})
+	default:
+		checks = append(checks, Check{Name: "max_age", Status: Pass, Message: fmt.Sprintf("max-age=%d", maxAge)})
+	}
+	if includeSubDomains {
+		checks = append(checks, Check{Name: "include_subdomains", Status: Pass, Message: "includeSubDomains is set"})
+	} else {
+		checks = append(checks, Check{Name: "include_subdomains", Status: Fail, Message: "includeSubDomains is missing", Fix: fix})
+	}
+	if preload {
+		checks = append(checks, Check{Name: "preload", Status: Pass, Message: "preload is set"})
+	} else {
+		checks = append(checks, Check{Name: "preload", Status: Fail, Message: "preload is missing", Fix: fix})
+	}
+	return checks
+}
+
+// checkRedirect requires http://domain/ to redirect to HTTPS on the same
+// host first; redirecting straight to another host (such as www) breaks
+// HSTS for the bare domain.
+func (c *Checker) checkRedirect(ctx context.Context, client *http.Client, domain string) Check {
+	const fix = "Set force_ssl on the site"
+	resp, err := c.get(ctx, client, "http://"+domain+"/")
+	if err != nil {
+		return Check{Name: "http_redirect", Status: Fail, Message: "HTTP request failed: " + err.Error(), Fix: "Port 80 must answer and redirect to HTTPS"}
+	}
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return Check{Name: "http_redirect", Status: Fail, Message: fmt.Sprintf("HTTP answers %d instead of redirecting", resp.StatusCode), Fix: fix}
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Scheme != "https" {
+		return Check{Name: "http_redirect", Status: Fail, Message: "HTTP redirects to " + resp.Header.Get("Location") + " instead of HTTPS", Fix: fix}
+	}
+	if !strings.EqualFold(loc.Hostname(), domain) {
+		return Check{Name: "http_redirect", Status: Fail,
+			Message: "HTTP redirects to " + loc.Hostname() + "; it must redirect to https://" + domain + " before any other host", Fix: fix}
+	}
+	return Check{Name: "http_redirect", Status: Pass, Message: "HTTP redirects to " + loc.String()}
+}
+
+// checkWWW requires HTTPS on www.domain when it exists, since
+// includeSubDomains will force it.
+func (c *Checker) checkWWW(ctx context.Context, client *http.Client, domain string) Check {
+	www := "www." + domain
+	lookup := net.DefaultResolver.LookupHost
+	if c.lookupHost != nil {
+		lookup = c.lookupHost
+	}
+	if addrs, err := lookup(ctx, www); err != nil || len(addrs) == 0 {
+		return Check{Name: "www", Status: Skip, Message: www + " does not resolve"}
+	}
+	if _, err := c.get(ctx, client, "https://"+www+"/"); err != nil {
+		return Check{Name: "www", Status: Fail, Message: "HTTPS on " + www + " failed: " + err.Error(),
+			Fix: "Add " + www + " as an alias of an SSL site, or remove its DNS record"}
+	}
+	return Check{Name: "www", Status: Pass, Message: www + " serves a valid certificate"}
+}
+
+// Status reads the domain's preload list status.
+func (c *Checker) Status(ctx context.Context, domain string) (*ListStatus, error) {
+	var status ListStatus
+	if err := c.callAPI(ctx, http.MethodGet, "status", domain, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Submit asks the preload list to add the domain. The list re-runs its own
+// checks and reports them in the Submission.
+func (c *Checker) Submit(ctx context.Context, domain string) (*Submission, error) {
+	var sub Submission
+	if err := c.callAPI(ctx, http.MethodPost, "submit", domain, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (c *Checker) callAPI(ctx context.Context, method, endpoint, domain string, out interface{}) error {
+	u := strings.TrimSuffix(c.PreloadAPI, "/") + "/" + endpoint + "?domain=" + url.QueryEscape(domain)
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: c.Timeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("preload list %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("preload list %s: HTTP %d", endpoint, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("preload list %s: %w", endpoint, err)
+	}
+	return nil
+}
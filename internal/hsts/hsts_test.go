@@ -0,0 +1,132 @@
+package hsts
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testChecker routes every connection for example.com (and www) to the
+// test servers. httptest's certificate is valid for example.com and
+// *.example.com.
+func testChecker(t *testing.T, https, plain http.HandlerFunc, www bool) *Checker {
+	tlsSrv := httptest.NewTLSServer(https)
+	t.Cleanup(tlsSrv.Close)
+	httpSrv := httptest.NewServer(plain)
+	t.Cleanup(httpSrv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsSrv.Certificate())
+	c := NewChecker()
+	c.rootCAs = pool
+	c.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, _ := net.SplitHostPort(addr)
+		target := httpSrv.Listener.Addr().String()
+		if port == "443" {
+			target = tlsSrv.Listener.Addr().String()
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, target)
+	}
+	c.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if www {
+			return []string{"127.0.0.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	return c
+}
+
+func redirectTo(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+func statuses(checks []Check) map[string]string {
+	m := map[string]string{}
+	for _, c := range checks {
+		m[c.Name] = c.Status
+	}
+	return m
+}
+
+func TestCheck(t *testing.T) {
+	good := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", RecommendedHeader)
+	}
+	c := testChecker(t, good, redirectTo("https://example.com/"), true)
+	checks := c.Check(context.Background(), "example.com")
+	if !Preloadable(checks) {
+		t.Fatalf("Expected preloadable, got %+v", checks)
+	}
+	if got := statuses(checks); got["www"] != Pass || got["http_redirect"] != Pass || got["preload"] != Pass {
+		t.Errorf("Unexpected statuses: %v", got)
+	}
+
+	weak := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=300")
+	}
+	c = testChecker(t, weak, redirectTo("https://www.example.com/"), false)
+	got := statuses(c.Check(context.Background(), "example.com"))
+	want := map[string]string{
+		"root_domain": Pass, "https": Pass, "hsts_header": Pass, "max_age": Fail,
+		"include_subdomains": Fail, "preload": Fail, "http_redirect": Fail, "www": Skip,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("%s = %q, want %q", name, got[name], status)
+		}
+	}
+
+	none := func(w http.ResponseWriter, r *http.Request) {}
+	c = testChecker(t, none, none, false)
+	got = statuses(c.Check(context.Background(), "app.example.com"))
+	if got["root_domain"] != Warn || got["hsts_header"] != Fail || got["max_age"] != Skip || got["http_redirect"] != Fail {
+		t.Errorf("Unexpected statuses: %v", got)
+	}
+
+	// A certificate the client does not trust fails the HTTPS check.
+	c = testChecker(t, good, redirectTo("https://example.com/"), false)
+	c.rootCAs = x509.NewCertPool()
+	got = statuses(c.Check(context.Background(), "example.com"))
+	if got["https"] != Fail || got["hsts_header"] != Skip {
+		t.Errorf("Untrusted certificate: %v", got)
+	}
+}
+
+func TestPreloadAPI(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("domain") != "example.com" {
+			http.Error(w, "bad domain", 400)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/status"):
+			fmt.Fprint(w, `{"name": "example.com", "status": "pending", "include_subdomains": true}`)
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/submit"):
+			fmt.Fprint(w, `{"errors": [], "warnings": [{"code": "domain.tls.sha1", "summary": "SHA-1", "message": "..."}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	c := NewChecker()
+	c.PreloadAPI = api.URL + "/api/v2"
+	status, err := c.Status(context.Background(), "example.com")
+	if err != nil || status.Status != "pending" || !status.IncludeSubDomains {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+	sub, err := c.Submit(context.Background(), "example.com")
+	if err != nil || len(sub.Errors) != 0 || len(sub.Warnings) != 1 {
+		t.Errorf("Submit = %+v, %v", sub, err)
+	}
+	if _, err := c.Status(context.Background(), "other.com"); err == nil {
+		t.Errorf("Expected an error for a non-200 answer")
+	}
+}
@@ -0,0 +1,234 @@
+// Package idn converts internationalized domain names between their
+// Unicode form and the ASCII (punycode, RFC 3492) form used by DNS, nginx
+// and certificate authorities.
+//
+// Labels are case-folded but not otherwise normalized (no UTS #46
+// mapping), so callers should submit names in their usual composed form.
+package idn
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const acePrefix = "xn--"
+
+// Punycode parameters (RFC 3492 section 5).
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+	maxLabel    = 63
+	maxName     = 253
+)
+
+// Dots that IDNA treats like "." (ideographic and fullwidth full stops).
+var dotReplacer = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII returns the ASCII form of a domain name. ASCII labels are only
+// lowercased; a leading "*." wildcard label is kept.
+func ToASCII(name string) (string, error) {
+	name = strings.ToLower(dotReplacer.Replace(name))
+	if isASCII(name) {
+		return name, nil
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := encode(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid domain %q: %w", name, err)
+		}
+		if len(acePrefix)+len(encoded) > maxLabel {
+			return "", fmt.Errorf("invalid domain %q: label %q is longer than %d bytes when encoded", name, label, maxLabel)
+		}
+		labels[i] = acePrefix + encoded
+	}
+	ascii := strings.Join(labels, ".")
+	if len(strings.TrimSuffix(ascii, ".")) > maxName {
+		return "", fmt.Errorf("invalid domain %q: longer than %d bytes when encoded", name, maxName)
+	}
+	return ascii, nil
+}
+
+// ToUnicode returns the Unicode form of a domain name. Labels that are not
+// valid punycode are returned unchanged.
+func ToUnicode(name string) string {
+	if !strings.Contains(name, acePrefix) {
+		return name
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		encoded, ok := strings.CutPrefix(strings.ToLower(label), acePrefix)
+		if !ok {
+			continue
+		}
+		if decoded, err := decode(encoded); err == nil {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((base-tmin)*tmax)/2 {
+		delta /= base - tmin
+		k += base
+	}
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+func threshold(k, bias int) int {
+	switch t := k - bias; {
+	case t < tmin:
+		return tmin
+	case t > tmax:
+		return tmax
+	default:
+		return t
+	}
+}
+
+func encodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func decodeDigit(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
+
+// encode is the punycode encoding of one label, without the ACE prefix.
+func encode(label string) (string, error) {
+	if !utf8.ValidString(label) {
+		return "", fmt.Errorf("label is not valid UTF-8")
+	}
+	input := []rune(label)
+	var out []byte
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := initialN, 0, initialBias
+	for h := basic; h < len(input); {
+		m := int(utf8.MaxRune) + 1
+		for _, r := range input {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := threshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, encodeDigit(t+(q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, encodeDigit(q))
+			bias = adapt(delta, h+1, h == basic)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// decode reverses encode.
+func decode(encoded string) (string, error) {
+	var output []rune
+	if pos := strings.LastIndexByte(encoded, '-'); pos >= 0 {
+		for i := 0; i < pos; i++ {
+			if encoded[i] >= utf8.RuneSelf {
+				return "", fmt.Errorf("non-ASCII basic code point")
+			}
+			output = append(output, rune(encoded[i]))
+		}
+		encoded = encoded[pos+1:]
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for pos := 0; pos < len(encoded); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(encoded) {
+				return "", fmt.Errorf("truncated punycode")
+			}
+			digit, ok := decodeDigit(encoded[pos])
+			pos++
+			if !ok {
+				return "", fmt.Errorf("invalid punycode digit %q", encoded[pos-1])
+			}
+			i += digit * w
+			t := threshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= base - t
+			if w > utf8.MaxRune*base {
+				return "", fmt.Errorf("punycode overflow")
+			}
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > utf8.MaxRune {
+			return "", fmt.Errorf("punycode overflow")
+		}
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return string(output), nil
+}
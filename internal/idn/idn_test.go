@@ -0,0 +1,61 @@
+package idn
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	tests := map[string]string{
+		"example.com":         "example.com",
+		"WWW.Example.COM":     "www.example.com",
+		"münchen.de":          "xn--mnchen-3ya.de",
+		"MÜNCHEN.de":          "xn--mnchen-3ya.de",
+		"bücher.example":      "xn--bcher-kva.example",
+		"пример.рф":           "xn--e1afmkfd.xn--p1ai",
+		"中国":                  "xn--fiqs8s",
+		"例え.テスト":              "xn--r8jz45g.xn--zckzah",
+		"*.münchen.de":        "*.xn--mnchen-3ya.de",
+		"shop。münchen。de":     "shop.xn--mnchen-3ya.de",
+		"xn--mnchen-3ya.de":   "xn--mnchen-3ya.de",
+		"api.bücher.example.": "api.xn--bcher-kva.example.",
+	}
+	for in, want := range tests {
+		got, err := ToASCII(in)
+		if err != nil || got != want {
+			t.Errorf("ToASCII(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	long := ""
+	for i := 0; i < 60; i++ {
+		long += "ü"
+	}
+	if _, err := ToASCII(long + ".de"); err == nil {
+		t.Errorf("Expected an error for a label that is too long once encoded")
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := map[string]string{
+		"example.com":            "example.com",
+		"xn--mnchen-3ya.de":      "münchen.de",
+		"*.xn--mnchen-3ya.de":    "*.münchen.de",
+		"xn--r8jz45g.xn--zckzah": "例え.テスト",
+		"xn--e1afmkfd.xn--p1ai":  "пример.рф",
+		"xn--!!.de":              "xn--!!.de", // Invalid punycode is left alone
+	}
+	for in, want := range tests {
+		if got := ToUnicode(in); got != want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// Round trip.
+	for _, name := range []string{"straße.de", "ελληνικά.gr", "日本語.jp", "a-ü-b.example"} {
+		ascii, err := ToASCII(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ToUnicode(ascii); got != name {
+			t.Errorf("Round trip of %q gave %q (via %q)", name, got, ascii)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Package jwtgate validates JWTs against a JWKS, for sites that only let
+// requests with a valid token through to their upstreams.
+package jwtgate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+const (
+	// DefaultCache is how long a JWKS is used before it is fetched again.
+	DefaultCache = 10 * time.Minute
+	// refetchInterval limits fetches for tokens with an unknown key ID, so
+	// forged key IDs can't make every request fetch the JWKS.
+	refetchInterval = 30 * time.Second
+	maxJWKSSize     = 1 << 20
+)
+
+// ErrKeys wraps failures to get the signing keys, as opposed to tokens
+// that are invalid.
+var ErrKeys = errors.New("jwks unavailable")
+
+type keySet struct {
+	keys    map[string]crypto.PublicKey // By key ID; keys without one under ""
+	fetched time.Time
+	tried   time.Time
+}
+
+// Verifier checks tokens, caching each JWKS it fetches.
+type Verifier struct {
+	Client *http.Client
+
+	mu   sync.Mutex
+	sets map[string]*keySet
+}
+
+// NewVerifier returns a Verifier with a short fetch timeout.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Client: &http.Client{Timeout: 5 * time.Second},
+		sets:   make(map[string]*keySet),
+	}
+}
+
+// Token returns the token a gate reads from the request: the Authorization
+// header without its "Bearer " prefix, another header, or a cookie.
+func Token(r *http.Request, gate *models.JWTGate) string {
+	if gate.Cookie != "" {
+		c, err := r.Cookie(gate.Cookie)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+	header := gate.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	v := strings.TrimSpace(r.Header.Get(header))
+	if strings.EqualFold(header, "Authorization") {
+		if len(v) < 7 || !strings.EqualFold(v[:7], "bearer ") {
+			return ""
+		}
+		v = strings.TrimSpace(v[7:])
+	}
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	Expires   *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience is a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks the token's signature against the gate's JWKS and its
+// expiry, not-before, issuer and audience claims at now.
+func (v *Verifier) Verify(ctx context.Context, token string, gate *models.JWTGate, now time.Time) error {
+	if token == "" {
+		return errors.New("no token")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return fmt.Errorf("malformed header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	key, err := v.key(ctx, gate, h.Kid, now)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return fmt.Errorf("malformed claims: %w", err)
+	}
+	leeway := time.Duration(gate.Leeway) * time.Second
+	if c.Expires == nil {
+		return errors.New("token has no expiry")
+	}
+	if now.After(unixTime(*c.Expires).Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if c.NotBefore != nil && now.Add(leeway).Before(unixTime(*c.NotBefore)) {
+		return errors.New("token not valid yet")
+	}
+	if gate.Issuer != "" && c.Issuer != gate.Issuer {
+		return fmt.Errorf("unexpected issuer %q", c.Issuer)
+	}
+	if len(gate.Audience) > 0 && !anyAudience(c.Audience, gate.Audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+func anyAudience(got, want []string) bool {
+	for _, g := range got {
+		for _, w := range want {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the JWKS key for kid, fetching the JWKS when the cache is
+// stale or doesn't know kid. A failed fetch keeps the cached keys.
+func (v *Verifier) key(ctx context.Context, gate *models.JWTGate, kid string, now time.Time) (crypto.PublicKey, error) {
+	ttl := DefaultCache
+	if gate.CacheSeconds > 0 {
+		ttl = time.Duration(gate.CacheSeconds) * time.Second
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	set := v.sets[gate.JWKSURL]
+	_, known := set.lookup(kid)
+	stale := set == nil || now.Sub(set.fetched) >= ttl
+	retry := min(refetchInterval, ttl)
+	if (stale || !known) && (set == nil || now.Sub(set.tried) >= retry) {
+		keys, err := v.fetch(ctx, gate.JWKSURL)
+		if err != nil {
+			if set == nil {
+				set = &keySet{tried: now}
+				v.sets[gate.JWKSURL] = set
+			} else {
+				set.tried = now
+			}
+			if len(set.keys) == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrKeys, err)
+			}
+		} else {
+			set = &keySet{keys: keys, fetched: now, tried: now}
+			v.sets[gate.JWKSURL] = set
+		}
+	}
+	if set == nil || len(set.keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys", ErrKeys)
+	}
+	key, ok := set.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds kid, or the only key when the token names none.
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if s == nil {
+		return nil, false
+	}
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *Verifier) fetch(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks returned %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unknown types are skipped, tokens signed with them fail
+		// as signed by an unknown key.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid ec point")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks an asymmetric signature. "none" and the HMAC
+// algorithms are refused: a JWKS only publishes public keys.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	invalid := errors.New("invalid signature")
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, []byte(signed), sig) {
+			return invalid
+		}
+		return nil
+	}
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(k, ch, digest, sig) != nil {
+			return invalid
+		}
+	case "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPSS(k, ch, digest, sig, nil) != nil {
+			return invalid
+		}
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
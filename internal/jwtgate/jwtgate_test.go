@@ -0,0 +1,141 @@
+package jwtgate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	gate := &models.JWTGate{JWKSURL: srv.URL, Issuer: "https://id.example.com", Audience: []string{"api", "web"}, Leeway: 30}
+	valid := map[string]interface{}{"iss": "https://id.example.com", "aud": "web", "exp": now.Unix() + 60}
+	v := NewVerifier()
+
+	cases := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"rsa", sign(t, "RS256", "rsa", rsaKey, valid), ""},
+		{"ec", sign(t, "ES256", "ec", ecKey, valid), ""},
+		{"audience list", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": []string{"other", "api"}, "exp": now.Unix() + 60}), ""},
+		{"within leeway", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": "api", "exp": now.Unix() - 10}), ""},
+		{"expired", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": "api", "exp": now.Unix() - 60}), "expired"},
+		{"no expiry", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": "api"}), "no expiry"},
+		{"not yet", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": "api", "exp": now.Unix() + 600, "nbf": now.Unix() + 300}), "not valid yet"},
+		{"issuer", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://evil.example.com", "aud": "api", "exp": now.Unix() + 60}), "issuer"},
+		{"audience", sign(t, "RS256", "rsa", rsaKey, map[string]interface{}{"iss": "https://id.example.com", "aud": "admin", "exp": now.Unix() + 60}), "audience"},
+		{"wrong key", sign(t, "ES256", "rsa", ecKey, valid), "invalid signature"},
+		{"none", strings.Join(strings.Split(sign(t, "none", "rsa", rsaKey, valid), ".")[:2], ".") + ".", "unsupported algorithm"},
+		{"hmac", sign(t, "HS256", "hmac", rsaKey, valid), "unknown key"},
+		{"garbage", "not-a-token", "malformed"},
+	}
+	for _, c := range cases {
+		err := v.Verify(context.Background(), c.token, gate, now)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: expected a valid token, got %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.name, c.err, err)
+		}
+	}
+
+	// Unknown key IDs refetch at most every 30s, the cache lasts 10 minutes.
+	before := fetches.Load()
+	v.Verify(context.Background(), sign(t, "RS256", "rotated", rsaKey, valid), gate, now.Add(5*time.Second))
+	v.Verify(context.Background(), sign(t, "RS256", "rotated", rsaKey, valid), gate, now.Add(40*time.Second))
+	v.Verify(context.Background(), sign(t, "RS256", "rotated", rsaKey, valid), gate, now.Add(50*time.Second))
+	if got := fetches.Load() - before; got != 1 {
+		t.Errorf("Expected 1 refetch for an unknown key, got %d", got)
+	}
+
+	// A JWKS that goes away keeps serving the cached keys.
+	srv.Close()
+	if err := v.Verify(context.Background(), sign(t, "RS256", "rsa", rsaKey, valid), gate, now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected cached keys after the JWKS failed, got %v", err)
+	}
+	other := &models.JWTGate{JWKSURL: srv.URL + "/other"}
+	if err := v.Verify(context.Background(), sign(t, "RS256", "rsa", rsaKey, valid), other, now); !errors.Is(err, ErrKeys) {
+		t.Errorf("Expected ErrKeys without any keys, got %v", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer abc.def.ghi")
+	r.Header.Set("X-Token", "x.y.z")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "c.o.k"})
+
+	cases := []struct {
+		gate models.JWTGate
+		want string
+	}{
+		{models.JWTGate{}, "abc.def.ghi"},
+		{models.JWTGate{Header: "X-Token"}, "x.y.z"},
+		{models.JWTGate{Cookie: "session"}, "c.o.k"},
+		{models.JWTGate{Cookie: "missing"}, ""},
+	}
+	for _, c := range cases {
+		if got := Token(r, &c.gate); got != c.want {
+			t.Errorf("Token(%+v) = %q, want %q", c.gate, got, c.want)
+		}
+	}
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if got := Token(r, &models.JWTGate{}); got != "" {
+		t.Errorf("Expected no token from Basic auth, got %q", got)
+	}
+}
@@ -0,0 +1,145 @@
+package logmanager
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTopReferers and maxTopCities cap breakdowns whose long tail is not
+// useful.
+const (
+	maxTopReferers = 20
+	maxTopCities   = 20
+)
+
+// Count is one bucket of a breakdown, largest first.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Analytics aggregates a site's access log over a time window.
+type Analytics struct {
+	Since       time.Time      `json:"since,omitempty"`
+	Until       time.Time      `json:"until,omitempty"`
+	Requests    int            `json:"requests"`
+	BotRequests int            `json:"bot_requests"`
+	Statuses    map[string]int `json:"statuses"` // "2xx", "4xx", ...
+	Browsers    []Count        `json:"browsers"` // Human traffic only
+	OS          []Count        `json:"os"`       // Human traffic only
+	Bots        []Count        `json:"bots"`
+	Referers    []Count        `json:"referers"`            // Top referer domains
+	Countries   []Count        `json:"countries,omitempty"` // With a GeoIP database
+	Cities      []Count        `json:"cities,omitempty"`    // "City, CC", top entries
+}
+
+// GetAnalytics summarises the access log entries matching opts.
+func (m *Manager) GetAnalytics(siteID string, opts LogOptions) (Analytics, error) {
+	opts.Limit = 0
+	entries, err := m.GetAccessLogs(siteID, opts)
+	if err != nil {
+		return Analytics{}, err
+	}
+	a := Summarize(entries)
+	a.Since, a.Until = opts.Since, opts.Until
+	return a, nil
+}
+
+// Totals is the request count and response body bytes of an access log
+// over a time window.
+type Totals struct {
+	Requests  int64 `json:"requests"`
+	BytesSent int64 `json:"bytes_sent"`
+}
+
+// GetTotals counts the access log entries matching opts without keeping
+// them, so long windows (a billing month) stay cheap. opts.Limit is
+// ignored.
+func (m *Manager) GetTotals(siteID string, opts LogOptions) (Totals, error) {
+	var t Totals
+	filename := filepath.Join(m.LogDir, siteID+".access.log")
+	err := m.scanFileBackwards(filename, func(line string) bool {
+		if opts.Search != "" && !strings.Contains(line, opts.Search) {
+			return true
+		}
+		entry, ok := ParseLine(opts.Format, line)
+		if !ok {
+			return true
+		}
+		if !opts.Since.IsZero() && entry.TimeLocal.Before(opts.Since) {
+			return false
+		}
+		if !opts.Until.IsZero() && entry.TimeLocal.After(opts.Until) {
+			return true
+		}
+		t.Requests++
+		t.BytesSent += entry.BodyBytesSent
+		return true
+	})
+	return t, err
+}
+
+// Summarize aggregates entries into status classes and client breakdowns.
+func Summarize(entries []LogEntry) Analytics {
+	browsers := map[string]int{}
+	oses := map[string]int{}
+	bots := map[string]int{}
+	referers := map[string]int{}
+	countries := map[string]int{}
+	cities := map[string]int{}
+
+	a := Analytics{Statuses: map[string]int{}}
+	for _, e := range entries {
+		a.Requests++
+		if e.Status > 0 {
+			a.Statuses[strconv.Itoa(e.Status/100)+"xx"]++
+		}
+		if e.IsBot {
+			a.BotRequests++
+			bots[e.Browser]++
+		} else {
+			browsers[e.Browser]++
+			oses[e.OS]++
+		}
+		if e.RefererDomain != "" {
+			referers[e.RefererDomain]++
+		}
+		if e.Country != "" {
+			countries[e.Country]++
+		}
+		if e.City != "" {
+			cities[e.City+", "+e.Country]++
+		}
+	}
+
+	a.Browsers = sortCounts(browsers, 0)
+	a.OS = sortCounts(oses, 0)
+	a.Bots = sortCounts(bots, 0)
+	a.Referers = sortCounts(referers, maxTopReferers)
+	if len(countries) > 0 {
+		a.Countries = sortCounts(countries, 0)
+		a.Cities = sortCounts(cities, maxTopCities)
+	}
+	return a
+}
+
+// sortCounts orders a breakdown by count, then name; max > 0 truncates it.
+func sortCounts(m map[string]int, max int) []Count {
+	counts := make([]Count, 0, len(m))
+	for name, n := range m {
+		counts = append(counts, Count{Name: name, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	if max > 0 && len(counts) > max {
+		counts = counts[:max]
+	}
+	return counts
+}
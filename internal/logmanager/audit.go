@@ -0,0 +1,90 @@
+package logmanager
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditLogEntry is a parsed line of a site's JSON header audit log.
+type AuditLogEntry struct {
+	Raw        string            `json:"raw"`
+	Time       time.Time         `json:"time,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Request    string            `json:"request,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+type auditLine struct {
+	Time         string            `json:"time"`
+	RemoteAddr   string            `json:"remote_addr"`
+	Request      string            `json:"request"`
+	Status       string            `json:"status"`
+	Headers      map[string]string `json:"headers"`
+	HeaderHashes string            `json:"header_hashes"`
+}
+
+// GetAuditLogs reads the site's header audit log, newest first. Hashed
+// headers are merged into Headers as "sha256:<prefix>".
+func (m *Manager) GetAuditLogs(siteID string, opts LogOptions) ([]AuditLogEntry, error) {
+	var entries []AuditLogEntry
+	filename := filepath.Join(m.LogDir, siteID+".audit.log")
+
+	err := m.scanFileBackwards(filename, func(line string) bool {
+		if opts.Search != "" && !strings.Contains(line, opts.Search) {
+			return true
+		}
+
+		var parsed auditLine
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return true
+		}
+
+		t, err := time.Parse(time.RFC3339, parsed.Time)
+		if err != nil {
+			return true
+		}
+		if !opts.Since.IsZero() && t.Before(opts.Since) {
+			return false
+		}
+		if !opts.Until.IsZero() && t.After(opts.Until) {
+			return true
+		}
+
+		headers := parsed.Headers
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		for _, pair := range strings.Split(parsed.HeaderHashes, ",") {
+			name, digest, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				continue
+			}
+			if digest == "-" {
+				headers[name] = ""
+				continue
+			}
+			headers[name] = "sha256:" + digest
+		}
+
+		status, _ := strconv.Atoi(parsed.Status)
+		entries = append(entries, AuditLogEntry{
+			Raw:        line,
+			Time:       t,
+			RemoteAddr: parsed.RemoteAddr,
+			Request:    parsed.Request,
+			Status:     status,
+			Headers:    headers,
+		})
+
+		if opts.Limit > 0 && len(entries) >= opts.Limit {
+			return false
+		}
+		return true
+	})
+
+	return entries, err
+}
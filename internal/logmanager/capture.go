@@ -0,0 +1,157 @@
+package logmanager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CaptureEntry is one request recorded by a site's traffic capture.
+type CaptureEntry struct {
+	Start         time.Time `json:"start"`
+	RequestID     string    `json:"request_id,omitempty"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	Method        string    `json:"method"`
+	Scheme        string    `json:"scheme"`
+	Host          string    `json:"host"`
+	URI           string    `json:"uri"`
+	Protocol      string    `json:"protocol"`
+	Status        int       `json:"status"`
+	RequestLength int64     `json:"request_length"` // Request line, headers and body
+	BytesSent     int64     `json:"bytes_sent"`     // Response headers and body
+	BodyBytesSent int64     `json:"body_bytes_sent"`
+	RequestTime   float64   `json:"request_time"` // Seconds, all times below too
+
+	UpstreamAddr string `json:"upstream_addr,omitempty"`
+	// Upstream times are -1 when no upstream was asked, or the last
+	// upstream's when the request was retried.
+	UpstreamConnectTime  float64 `json:"upstream_connect_time"`
+	UpstreamHeaderTime   float64 `json:"upstream_header_time"`
+	UpstreamResponseTime float64 `json:"upstream_response_time"`
+
+	SSLProtocol     string            `json:"ssl_protocol,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"` // Headers the request didn't have are left out
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+}
+
+type captureLine struct {
+	Msec                 string            `json:"msec"`
+	RequestID            string            `json:"request_id"`
+	RemoteAddr           string            `json:"remote_addr"`
+	Method               string            `json:"method"`
+	Scheme               string            `json:"scheme"`
+	Host                 string            `json:"host"`
+	URI                  string            `json:"uri"`
+	Protocol             string            `json:"protocol"`
+	Status               string            `json:"status"`
+	RequestLength        string            `json:"request_length"`
+	BytesSent            string            `json:"bytes_sent"`
+	BodyBytesSent        string            `json:"body_bytes_sent"`
+	RequestTime          string            `json:"request_time"`
+	UpstreamAddr         string            `json:"upstream_addr"`
+	UpstreamConnectTime  string            `json:"upstream_connect_time"`
+	UpstreamHeaderTime   string            `json:"upstream_header_time"`
+	UpstreamResponseTime string            `json:"upstream_response_time"`
+	SSLProtocol          string            `json:"ssl_protocol"`
+	RequestHeaders       map[string]string `json:"request_headers"`
+	ResponseHeaders      map[string]string `json:"response_headers"`
+	RequestBody          string            `json:"request_body"`
+}
+
+// CaptureFile is the log a site's traffic capture is written to.
+func (m *Manager) CaptureFile(siteID string) string {
+	return filepath.Join(m.LogDir, siteID+".capture.log")
+}
+
+// GetCapture reads the site's capture, oldest first. With a limit only the
+// newest limit entries are returned.
+func (m *Manager) GetCapture(siteID string, limit int) ([]CaptureEntry, error) {
+	var entries []CaptureEntry
+	err := m.scanFileBackwards(m.CaptureFile(siteID), func(line string) bool {
+		var parsed captureLine
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return true
+		}
+		msec, err := strconv.ParseFloat(parsed.Msec, 64)
+		if err != nil {
+			return true
+		}
+		e := CaptureEntry{
+			RequestID:            parsed.RequestID,
+			RemoteAddr:           parsed.RemoteAddr,
+			Method:               parsed.Method,
+			Scheme:               parsed.Scheme,
+			Host:                 parsed.Host,
+			URI:                  parsed.URI,
+			Protocol:             parsed.Protocol,
+			RequestTime:          captureTime(parsed.RequestTime),
+			UpstreamAddr:         parsed.UpstreamAddr,
+			UpstreamConnectTime:  captureTime(parsed.UpstreamConnectTime),
+			UpstreamHeaderTime:   captureTime(parsed.UpstreamHeaderTime),
+			UpstreamResponseTime: captureTime(parsed.UpstreamResponseTime),
+			SSLProtocol:          parsed.SSLProtocol,
+			RequestHeaders:       presentHeaders(parsed.RequestHeaders),
+			ResponseHeaders:      presentHeaders(parsed.ResponseHeaders),
+			RequestBody:          parsed.RequestBody,
+		}
+		e.Status, _ = strconv.Atoi(parsed.Status)
+		e.RequestLength, _ = strconv.ParseInt(parsed.RequestLength, 10, 64)
+		e.BytesSent, _ = strconv.ParseInt(parsed.BytesSent, 10, 64)
+		e.BodyBytesSent, _ = strconv.ParseInt(parsed.BodyBytesSent, 10, 64)
+		if e.RequestTime < 0 {
+			e.RequestTime = 0
+		}
+		// msec is when the response was logged, after the request time.
+		e.Start = time.UnixMilli(int64((msec - e.RequestTime) * 1000)).UTC()
+		entries = append(entries, e)
+		return limit <= 0 || len(entries) < limit
+	})
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, err
+}
+
+// ClearCapture empties the site's capture. The file is truncated rather
+// than removed, so nginx keeps writing to it.
+func (m *Manager) ClearCapture(siteID string) error {
+	if err := os.Truncate(m.CaptureFile(siteID), 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveCapture deletes the site's capture.
+func (m *Manager) RemoveCapture(siteID string) error {
+	if err := os.Remove(m.CaptureFile(siteID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// captureTime parses an nginx time in seconds. Retried upstream requests
+// list one time per attempt ("0.002, 0.010" or "0.004 : 0.010"); the last
+// counts. "-" and empty are -1.
+func captureTime(v string) float64 {
+	if i := strings.LastIndexAny(v, ",:"); i >= 0 {
+		v = v[i+1:]
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return -1
+	}
+	return f
+}
+
+func presentHeaders(h map[string]string) map[string]string {
+	for k, v := range h {
+		if v == "" {
+			delete(h, k)
+		}
+	}
+	return h
+}
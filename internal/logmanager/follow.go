@@ -0,0 +1,115 @@
+package logmanager
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultFollowInterval is how often a followed file is polled for growth.
+const DefaultFollowInterval = 500 * time.Millisecond
+
+// SiteLogFile returns the path of a site's log of the given type.
+func (m *Manager) SiteLogFile(siteID, logType string) string {
+	return filepath.Join(m.LogDir, siteID+"."+logType+".log")
+}
+
+// Follow tails filename like `tail -F`, calling fn for each complete line
+// appended after it was called. It polls rather than relying on inotify so
+// it behaves the same on every filesystem, including bind mounts.
+//
+// A missing file is waited for. When the file is replaced (logrotate) or
+// truncated (PurgeLogs), reading restarts from its beginning. Follow returns
+// when ctx is done.
+func Follow(ctx context.Context, filename string, interval time.Duration, fn func(line string)) error {
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+
+	var (
+		file    *os.File
+		offset  int64
+		partial []byte
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	// Existing content is not replayed; start at the current end.
+	if f, err := os.Open(filename); err == nil {
+		file = f
+		offset, _ = f.Seek(0, io.SeekEnd)
+	}
+
+	buf := make([]byte, 32*1024)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if file == nil {
+			if f, err := os.Open(filename); err == nil {
+				file, offset, partial = f, 0, nil
+			}
+		}
+
+		if file != nil {
+			if reopened := reopenIfRotated(filename, file, offset); reopened != nil {
+				file.Close()
+				file, offset, partial = reopened, 0, nil
+			}
+
+			for {
+				n, err := file.ReadAt(buf, offset)
+				if n > 0 {
+					offset += int64(n)
+					partial = append(partial, buf[:n]...)
+					for {
+						i := bytes.IndexByte(partial, '\n')
+						if i < 0 {
+							break
+						}
+						if line := bytes.TrimRight(partial[:i], "\r"); len(line) > 0 {
+							fn(string(line))
+						}
+						partial = partial[i+1:]
+					}
+				}
+				if err != nil || n == 0 {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// reopenIfRotated returns a fresh descriptor when filename no longer refers
+// to file, or the file shrank below offset. It returns nil otherwise.
+func reopenIfRotated(filename string, file *os.File, offset int64) *os.File {
+	current, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	if os.SameFile(current, opened) && opened.Size() >= offset {
+		return nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	return f
+}
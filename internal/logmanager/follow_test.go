@@ -0,0 +1,84 @@
+package logmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "followtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filename := filepath.Join(tmpDir, "site.access.log")
+	if err := os.WriteFile(filename, []byte("old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, filename, 10*time.Millisecond, func(line string) { lines <- line })
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a followed line")
+			return ""
+		}
+	}
+	appendTo := func(s string) {
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+
+	// Give Follow a moment to seek to the end before appending.
+	time.Sleep(50 * time.Millisecond)
+
+	// Partial lines are held back until they are complete.
+	appendTo("first ")
+	time.Sleep(50 * time.Millisecond)
+	appendTo("line\nsecond line\n")
+	if got := next(); got != "first line" {
+		t.Errorf("Expected 'first line', got %q", got)
+	}
+	if got := next(); got != "second line" {
+		t.Errorf("Expected 'second line', got %q", got)
+	}
+
+	// Truncated in place (PurgeLogs): reading restarts at the beginning.
+	if err := os.WriteFile(filename, []byte("after purge\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got != "after purge" {
+		t.Errorf("Expected 'after purge', got %q", got)
+	}
+
+	// Rotated: the new file is followed from the start.
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo("rotated\n")
+	if got := next(); got != "rotated" {
+		t.Errorf("Expected 'rotated', got %q", got)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package logmanager
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// ParseLine parses an access log line written with format, or with the
+// built-in hubfly format when format is nil. Lines from before a site
+// switched formats still parse: registered formats always write JSON
+// objects, the built-in one never does.
+func ParseLine(format *models.LogFormat, line string) (LogEntry, bool) {
+	if format != nil && strings.HasPrefix(line, "{") {
+		return ParseFormattedLine(format, line)
+	}
+	return ParseAccessLine(line)
+}
+
+// ParseFormattedLine parses a JSON line written by a registered log
+// format. Fields holding the variables of the built-in format fill the
+// matching LogEntry fields; the rest go to Fields under their names.
+func ParseFormattedLine(format *models.LogFormat, line string) (LogEntry, bool) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(line), &values); err != nil {
+		return LogEntry{}, false
+	}
+
+	entry := LogEntry{Raw: line}
+	for _, f := range format.Fields {
+		v, ok := values[f.Name]
+		if !ok {
+			continue
+		}
+		switch f.Variable {
+		case "$remote_addr":
+			entry.RemoteAddr = v
+		case "$remote_user":
+			entry.RemoteUser = v
+		case "$time_local":
+			entry.TimeLocal, _ = time.Parse(nginxTimeLayout, v)
+		case "$time_iso8601":
+			entry.TimeLocal, _ = time.Parse(time.RFC3339, v)
+		case "$request":
+			entry.Request = v
+		case "$status":
+			entry.Status, _ = strconv.Atoi(v)
+		case "$body_bytes_sent":
+			entry.BodyBytesSent, _ = strconv.ParseInt(v, 10, 64)
+		case "$http_referer":
+			entry.Referer = v
+		case "$http_user_agent":
+			entry.UserAgent = v
+		case "$request_time":
+			entry.RequestTime, _ = strconv.ParseFloat(v, 64)
+		default:
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]string)
+			}
+			entry.Fields[f.Name] = v
+		}
+	}
+	if entry.TimeLocal.IsZero() {
+		return LogEntry{}, false
+	}
+
+	client := ParseUserAgent(entry.UserAgent)
+	entry.Browser, entry.OS, entry.IsBot = client.Browser, client.OS, client.IsBot
+	entry.RefererDomain = RefererDomain(entry.Referer)
+	return entry, true
+}
+
+// formattedLineTime finds the timestamp of a registered-format line
+// without its schema: the first value in either nginx time layout.
+func formattedLineTime(line string) (time.Time, bool) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(line), &values); err != nil {
+		return time.Time{}, false
+	}
+	for _, v := range values {
+		if t, err := time.Parse(nginxTimeLayout, v); err == nil {
+			return t, true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
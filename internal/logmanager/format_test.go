@@ -0,0 +1,69 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+var testFormat = &models.LogFormat{Name: "json", Fields: []models.LogField{
+	{Name: "ts", Variable: "$time_iso8601"},
+	{Name: "client", Variable: "$remote_addr"},
+	{Name: "status", Variable: "$status"},
+	{Name: "ua", Variable: "$http_user_agent"},
+	{Name: "request_id", Variable: "$request_id"},
+}}
+
+func TestParseFormattedLine(t *testing.T) {
+	line := `{"ts":"2025-12-26T10:00:00+00:00","client":"10.0.0.1","status":"502","ua":"curl/8.0","request_id":"abc123"}`
+	entry, ok := ParseLine(testFormat, line)
+	if !ok {
+		t.Fatal("Expected the line to parse")
+	}
+	if entry.RemoteAddr != "10.0.0.1" || entry.Status != 502 || entry.Fields["request_id"] != "abc123" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if !entry.TimeLocal.Equal(time.Date(2025, 12, 26, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected time %v", entry.TimeLocal)
+	}
+
+	// Lines written before the site switched formats.
+	old := `127.0.0.1 - - [26/Dec/2025:09:00:00 +0000] "GET / HTTP/1.1" 200 612 "-" "Mozilla/5.0" "0.001"`
+	if entry, ok := ParseLine(testFormat, old); !ok || entry.Status != 200 {
+		t.Errorf("Expected the built-in format to still parse, got %+v", entry)
+	}
+
+	if _, ok := ParseLine(testFormat, `{"client":"10.0.0.1"}`); ok {
+		t.Error("Expected a line without a time to be skipped")
+	}
+}
+
+func TestFormattedLogs(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir)
+	lines := `127.0.0.1 - - [26/Dec/2025:09:00:00 +0000] "GET / HTTP/1.1" 200 612 "-" "Mozilla/5.0" "0.001"
+{"ts":"2025-12-26T10:00:00+00:00","client":"10.0.0.1","status":"200","ua":"curl/8.0","request_id":"a"}
+{"ts":"2025-12-26T11:00:00+00:00","client":"10.0.0.2","status":"500","ua":"curl/8.0","request_id":"b"}
+`
+	file := filepath.Join(dir, "f.local.access.log")
+	os.WriteFile(file, []byte(lines), 0644)
+
+	entries, err := m.GetAccessLogs("f.local", LogOptions{Format: testFormat, Since: time.Date(2025, 12, 26, 9, 30, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Fields["request_id"] != "b" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+
+	removed, err := m.PurgeLogs("f.local", "access", time.Time{}, time.Date(2025, 12, 26, 10, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 lines purged, got %d", removed)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/geoip"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
 )
 
 type LogEntry struct {
@@ -20,6 +23,20 @@ type LogEntry struct {
 	Referer       string    `json:"referer,omitempty"`
 	UserAgent     string    `json:"user_agent,omitempty"`
 	RequestTime   float64   `json:"request_time,omitempty"`
+
+	// Derived from UserAgent and Referer.
+	Browser       string `json:"browser,omitempty"`
+	OS            string `json:"os,omitempty"`
+	IsBot         bool   `json:"is_bot"`
+	RefererDomain string `json:"referer_domain,omitempty"`
+
+	// Set from RemoteAddr when a GeoIP database is loaded.
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+
+	// Fields holds the values of a registered log format that have no
+	// field of their own above.
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 type ErrorLogEntry struct {
@@ -34,14 +51,22 @@ type LogOptions struct {
 	Since  time.Time `json:"since"`
 	Until  time.Time `json:"until"`
 	Search string    `json:"search"`
+
+	// Format is the site's registered access log format, nil for the
+	// built-in one.
+	Format *models.LogFormat `json:"-"`
 }
 
 type Manager struct {
 	LogDir string
+	// GeoIP, when set, annotates access entries with the client's location.
+	GeoIP *geoip.DB
+	// ErrorLog is nginx's global error log; per-site errors go to LogDir.
+	ErrorLog string
 }
 
 func NewManager(logDir string) *Manager {
-	return &Manager{LogDir: logDir}
+	return &Manager{LogDir: logDir, ErrorLog: "/var/log/nginx/error.log"}
 }
 
 // Access Log Regex
@@ -100,8 +125,8 @@ func (m *Manager) scanFileBackwards(filename string, callback func(string) bool)
 						return nil
 					}
 				}
-			tail = nil
-			p = i
+				tail = nil
+				p = i
 			}
 		}
 		tail = append(chunk[:p], tail...)
@@ -125,44 +150,26 @@ func (m *Manager) GetAccessLogs(siteID string, opts LogOptions) ([]LogEntry, err
 		}
 
 		// 2. Parse
-		matches := accessLogRegex.FindStringSubmatch(line)
-		if len(matches) != 10 {
+		entry, ok := ParseLine(opts.Format, line)
+		if !ok {
 			// Skip malformed lines
 			return true
 		}
 
-		t, err := time.Parse(nginxTimeLayout, matches[3])
-		if err != nil {
-			return true
-		}
+		m.Annotate(&entry)
 
 		// 3. Time Filter
 		// Reading backwards: Time decreases.
 		// If Time < Since, then all remaining logs are older than Since. Stop.
-		if !opts.Since.IsZero() && t.Before(opts.Since) {
+		if !opts.Since.IsZero() && entry.TimeLocal.Before(opts.Since) {
 			return false
 		}
 		// If Time > Until, this log is too new. Skip it, but older ones might match.
-		if !opts.Until.IsZero() && t.After(opts.Until) {
+		if !opts.Until.IsZero() && entry.TimeLocal.After(opts.Until) {
 			return true
 		}
 
-		status, _ := strconv.Atoi(matches[5])
-		bytesSent, _ := strconv.ParseInt(matches[6], 10, 64)
-		reqTime, _ := strconv.ParseFloat(matches[9], 64)
-
-		entries = append(entries, LogEntry{
-			Raw:           line,
-			RemoteAddr:    matches[1],
-			RemoteUser:    matches[2],
-			TimeLocal:     t,
-			Request:       matches[4],
-			Status:        status,
-			BodyBytesSent: bytesSent,
-			Referer:       matches[7],
-			UserAgent:     matches[8],
-			RequestTime:   reqTime,
-		})
+		entries = append(entries, entry)
 
 		// Limit
 		if opts.Limit > 0 && len(entries) >= opts.Limit {
@@ -175,6 +182,53 @@ func (m *Manager) GetAccessLogs(siteID string, opts LogOptions) ([]LogEntry, err
 	return entries, err
 }
 
+// Annotate adds the client location to entry when a GeoIP database is
+// loaded.
+func (m *Manager) Annotate(entry *LogEntry) {
+	if m.GeoIP == nil {
+		return
+	}
+	if loc, ok := m.GeoIP.LookupString(entry.RemoteAddr); ok {
+		entry.Country = loc.Country
+		entry.City = loc.City
+	}
+}
+
+// ParseAccessLine parses one line in the hubfly log format.
+func ParseAccessLine(line string) (LogEntry, bool) {
+	matches := accessLogRegex.FindStringSubmatch(line)
+	if len(matches) != 10 {
+		return LogEntry{}, false
+	}
+
+	t, err := time.Parse(nginxTimeLayout, matches[3])
+	if err != nil {
+		return LogEntry{}, false
+	}
+
+	status, _ := strconv.Atoi(matches[5])
+	bytesSent, _ := strconv.ParseInt(matches[6], 10, 64)
+	reqTime, _ := strconv.ParseFloat(matches[9], 64)
+
+	client := ParseUserAgent(matches[8])
+	return LogEntry{
+		Raw:           line,
+		RemoteAddr:    matches[1],
+		RemoteUser:    matches[2],
+		TimeLocal:     t,
+		Request:       matches[4],
+		Status:        status,
+		BodyBytesSent: bytesSent,
+		Referer:       matches[7],
+		UserAgent:     matches[8],
+		RequestTime:   reqTime,
+		Browser:       client.Browser,
+		OS:            client.OS,
+		IsBot:         client.IsBot,
+		RefererDomain: RefererDomain(matches[7]),
+	}, true
+}
+
 func (m *Manager) GetErrorLogs(siteID string, opts LogOptions) ([]ErrorLogEntry, error) {
 	var entries []ErrorLogEntry
 	filename := filepath.Join(m.LogDir, siteID+".error.log")
@@ -184,24 +238,13 @@ func (m *Manager) GetErrorLogs(siteID string, opts LogOptions) ([]ErrorLogEntry,
 			return true
 		}
 
-		// Parse timestamp
-		// Format: YYYY/MM/DD HH:MM:SS (first 19 chars)
-		var t time.Time
-		var err error
-
-		if len(line) >= 19 {
-			t, err = time.Parse(errorLogTimeLayout, line[:19])
-		}
-		// If line is too short, we can't parse time.
-		// Treat as "unknown time".
-		// If filtering strictly by time, maybe skip?
-		// For now, if we can't parse time, we include it unless strict checks fail.
+		entry := ParseErrorLine(line)
 
-		if err == nil && !t.IsZero() {
-			if !opts.Since.IsZero() && t.Before(opts.Since) {
+		if !entry.TimeLocal.IsZero() {
+			if !opts.Since.IsZero() && entry.TimeLocal.Before(opts.Since) {
 				return false
 			}
-			if !opts.Until.IsZero() && t.After(opts.Until) {
+			if !opts.Until.IsZero() && entry.TimeLocal.After(opts.Until) {
 				return true
 			}
 		} else if !opts.Since.IsZero() || !opts.Until.IsZero() {
@@ -214,26 +257,7 @@ func (m *Manager) GetErrorLogs(siteID string, opts LogOptions) ([]ErrorLogEntry,
 			return true
 		}
 
-		level := "unknown"
-		startBracket := strings.Index(line, "[")
-		endBracket := strings.Index(line, "]")
-		if startBracket != -1 && endBracket != -1 && endBracket > startBracket {
-			level = line[startBracket+1 : endBracket]
-		}
-
-		msg := ""
-		if endBracket != -1 && len(line) > endBracket+1 {
-			msg = strings.TrimSpace(line[endBracket+1:])
-		} else {
-			msg = line
-		}
-
-		entries = append(entries, ErrorLogEntry{
-			Raw:       line,
-			TimeLocal: t,
-			Level:     level,
-			Message:   msg,
-		})
+		entries = append(entries, entry)
 
 		if opts.Limit > 0 && len(entries) >= opts.Limit {
 			return false
@@ -243,4 +267,35 @@ func (m *Manager) GetErrorLogs(siteID string, opts LogOptions) ([]ErrorLogEntry,
 	})
 
 	return entries, err
-}
\ No newline at end of file
+}
+
+// ParseErrorLine parses one nginx error log line. TimeLocal is zero when
+// the line has no timestamp (e.g. a continuation line).
+func ParseErrorLine(line string) ErrorLogEntry {
+	// Format: YYYY/MM/DD HH:MM:SS (first 19 chars)
+	var t time.Time
+	if len(line) >= 19 {
+		t, _ = time.Parse(errorLogTimeLayout, line[:19])
+	}
+
+	level := "unknown"
+	startBracket := strings.Index(line, "[")
+	endBracket := strings.Index(line, "]")
+	if startBracket != -1 && endBracket != -1 && endBracket > startBracket {
+		level = line[startBracket+1 : endBracket]
+	}
+
+	msg := ""
+	if endBracket != -1 && len(line) > endBracket+1 {
+		msg = strings.TrimSpace(line[endBracket+1:])
+	} else {
+		msg = line
+	}
+
+	return ErrorLogEntry{
+		Raw:       line,
+		TimeLocal: t,
+		Level:     level,
+		Message:   msg,
+	}
+}
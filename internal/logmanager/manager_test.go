@@ -3,6 +3,7 @@ package logmanager
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -106,3 +107,190 @@ func TestGetErrorLogs(t *testing.T) {
 		t.Errorf("Expected error level, got %s", logs[1].Level)
 	}
 }
+
+func TestGetAuditLogs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "logtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	siteID := "example.com"
+	logContent := `{"time":"2025-12-26T10:00:00+00:00","remote_addr":"10.0.0.1","request":"GET / HTTP/1.1","status":"200","headers":{"authorization":"1"},"header_hashes":"x-api-key=3fa2c1d09b8e7f61"}
+{"time":"2025-12-26T10:05:00+00:00","remote_addr":"10.0.0.2","request":"POST /login HTTP/1.1","status":"401","headers":{"authorization":"0"},"header_hashes":"x-api-key=-"}
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, siteID+".audit.log"), []byte(logContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewManager(tmpDir)
+
+	logs, err := mgr.GetAuditLogs(siteID, LogOptions{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 logs, got %d", len(logs))
+	}
+	if logs[0].Status != 401 || logs[0].Headers["authorization"] != "0" {
+		t.Errorf("Unexpected newest entry: %+v", logs[0])
+	}
+	if logs[0].Headers["x-api-key"] != "" {
+		t.Errorf("Missing header should be empty, got %q", logs[0].Headers["x-api-key"])
+	}
+	if logs[1].Headers["x-api-key"] != "sha256:3fa2c1d09b8e7f61" {
+		t.Errorf("Hashed header mismatch: %q", logs[1].Headers["x-api-key"])
+	}
+}
+
+func TestGetCapture(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	logContent := `{"msec":"1766743200.500","method":"GET","scheme":"https","host":"example.com","uri":"/a?x=1","protocol":"HTTP/2.0","status":"200","bytes_sent":"812","body_bytes_sent":"612","request_time":"0.250","upstream_connect_time":"0.001","upstream_header_time":"0.100","upstream_response_time":"0.240","request_headers":{"user-agent":"curl/8","cookie":""},"response_headers":{"content-type":"text/html"}}
+not json
+{"msec":"1766743201.000","method":"GET","scheme":"http","host":"example.com","uri":"/","protocol":"HTTP/1.1","status":"301","request_time":"0.000","upstream_connect_time":"","upstream_header_time":"-","upstream_response_time":"0.002, 0.004"}
+`
+	if err := os.WriteFile(mgr.CaptureFile("example.com"), []byte(logContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := mgr.GetCapture("example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	first := entries[0]
+	if !first.Start.Equal(time.UnixMilli(1766743200250)) || first.Status != 200 || first.BytesSent != 812 || first.UpstreamHeaderTime != 0.1 {
+		t.Errorf("Unexpected first entry: %+v", first)
+	}
+	if _, ok := first.RequestHeaders["cookie"]; ok || first.RequestHeaders["user-agent"] != "curl/8" {
+		t.Errorf("Expected only present headers, got %v", first.RequestHeaders)
+	}
+	if last := entries[1]; last.UpstreamHeaderTime != -1 || last.UpstreamResponseTime != 0.004 {
+		t.Errorf("Unexpected upstream times: %+v", last)
+	}
+
+	if entries, _ = mgr.GetCapture("example.com", 1); len(entries) != 1 || entries[0].Status != 301 {
+		t.Errorf("Expected the newest entry with a limit, got %+v", entries)
+	}
+	if err := mgr.ClearCapture("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = mgr.GetCapture("example.com", 0); len(entries) != 0 {
+		t.Errorf("Expected no entries after ClearCapture, got %d", len(entries))
+	}
+}
+
+func TestPurgeLogs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "logtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	siteID := "example.com"
+	accessLog := `127.0.0.1 - - [26/Dec/2025:10:00:00 +0000] "GET /old HTTP/1.1" 200 123 "-" "Agent" "0.001"
+127.0.0.1 - - [26/Dec/2025:10:05:00 +0000] "GET /mid HTTP/1.1" 200 456 "-" "Agent" "0.002"
+127.0.0.1 - - [26/Dec/2025:10:10:00 +0000] "GET /new HTTP/1.1" 200 789 "-" "Agent" "0.003"
+`
+	errorLog := `2025/12/26 10:00:00 [error] 123#123: *1 upstream timed out
+continuation of the old error
+2025/12/26 10:10:00 [warn] 123#123: *2 something weird
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, siteID+".access.log"), []byte(accessLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, siteID+".error.log"), []byte(errorLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewManager(tmpDir)
+	until, _ := time.Parse(nginxTimeLayout, "26/Dec/2025:10:06:00 +0000")
+
+	removed, err := mgr.PurgeLogs(siteID, "access", time.Time{}, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 access lines removed, got %d", removed)
+	}
+	logs, _ := mgr.GetAccessLogs(siteID, LogOptions{})
+	if len(logs) != 1 || logs[0].Request != "GET /new HTTP/1.1" {
+		t.Errorf("Unexpected remaining access logs: %+v", logs)
+	}
+
+	removed, err = mgr.PurgeLogs(siteID, "error", time.Time{}, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected error line and its continuation removed, got %d", removed)
+	}
+
+	// Missing files are not an error
+	if removed, err := mgr.PurgeLogs(siteID, "audit", time.Time{}, until); err != nil || removed != 0 {
+		t.Errorf("Expected no-op for missing audit log, got %d, %v", removed, err)
+	}
+}
+
+func TestPurgeLogsKeepsAppended(t *testing.T) {
+	tmpDir := t.TempDir()
+	filename := filepath.Join(tmpDir, "a.local.access.log")
+	old := `127.0.0.1 - - [26/Dec/2025:10:00:00 +0000] "GET /old HTTP/1.1" 200 123 "-" "Agent" "0.001"
+127.0.0.1 - - [26/Dec/2025:10:10:00 +0000] "GET /new HTTP/1.1" 200 789 "-" "Agent" "0.003"
+127.0.0.1 - - [26/Dec/2025:10:`
+	if err := os.WriteFile(filename, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// nginx finishes the partial line and appends another while the purge runs
+	appended := `20:00 +0000] "GET /partial HTTP/1.1" 200 1 "-" "Agent" "0.001"
+127.0.0.1 - - [26/Dec/2025:10:30:00 +0000] "GET /appended HTTP/1.1" 200 1 "-" "Agent" "0.001"
+`
+	purgeScanned = func() {
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(appended)
+		f.Close()
+	}
+	defer func() { purgeScanned = nil }()
+
+	until, _ := time.Parse(nginxTimeLayout, "26/Dec/2025:10:05:00 +0000")
+	removed, err := NewManager(tmpDir).PurgeLogs("a.local", "access", time.Time{}, until)
+	if err != nil || removed != 1 {
+		t.Fatalf("PurgeLogs = %d, %v", removed, err)
+	}
+	data, _ := os.ReadFile(filename)
+	want := old[strings.Index(old, "\n")+1:] + appended
+	if string(data) != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestGetTotals(t *testing.T) {
+	tmpDir := t.TempDir()
+	logContent := `127.0.0.1 - - [31/Oct/2025:23:59:59 +0000] "GET /old HTTP/1.1" 200 100 "-" "Agent" "0.001"
+127.0.0.1 - - [01/Nov/2025:00:00:00 +0000] "GET / HTTP/1.1" 200 1000 "-" "Agent" "0.001"
+not a log line
+127.0.0.1 - - [15/Nov/2025:12:00:00 +0000] "GET /big HTTP/1.1" 200 250000 "-" "Agent" "0.002"
+127.0.0.1 - - [01/Dec/2025:00:00:01 +0000] "GET /next HTTP/1.1" 200 10 "-" "Agent" "0.001"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "shop.access.log"), []byte(logContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewManager(tmpDir)
+	since := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	totals, err := mgr.GetTotals("shop", LogOptions{Since: since, Until: since.AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals != (Totals{Requests: 2, BytesSent: 251000}) {
+		t.Errorf("Unexpected totals for November: %+v", totals)
+	}
+	if totals, err := mgr.GetTotals("missing", LogOptions{}); err != nil || totals != (Totals{}) {
+		t.Errorf("Expected no traffic for a site without logs, got %+v, %v", totals, err)
+	}
+}
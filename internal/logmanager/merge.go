@@ -0,0 +1,94 @@
+package logmanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// SiteLogEntry is an access log entry in logs merged across sites.
+type SiteLogEntry struct {
+	SiteID string `json:"site_id"`
+	LogEntry
+}
+
+// SiteErrorLogEntry is an error log entry in logs merged across sites.
+type SiteErrorLogEntry struct {
+	SiteID string `json:"site_id"`
+	ErrorLogEntry
+}
+
+// GetMergedAccessLogs reads the access logs of several sites, each with its
+// own format (keyed by site ID, nil for the built-in one), and merges them
+// newest first. opts.Format is ignored; opts.Limit bounds the merged
+// entries, not each site's.
+func (m *Manager) GetMergedAccessLogs(formats map[string]*models.LogFormat, opts LogOptions) ([]SiteLogEntry, error) {
+	merged := []SiteLogEntry{}
+	for siteID, format := range formats {
+		o := opts
+		o.Format = format
+		entries, err := m.GetAccessLogs(siteID, o)
+		if err != nil {
+			return nil, fmt.Errorf("site %s: %w", siteID, err)
+		}
+		for _, e := range entries {
+			merged = append(merged, SiteLogEntry{SiteID: siteID, LogEntry: e})
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i], merged[j]
+		if !a.TimeLocal.Equal(b.TimeLocal) {
+			return a.TimeLocal.After(b.TimeLocal)
+		}
+		return a.SiteID < b.SiteID
+	})
+	if opts.Limit > 0 && len(merged) > opts.Limit {
+		merged = merged[:opts.Limit]
+	}
+	return merged, nil
+}
+
+// GetMergedErrorLogs reads the error logs of several sites and merges them
+// newest first. Lines without a timestamp stay next to the entry they
+// continue.
+func (m *Manager) GetMergedErrorLogs(siteIDs []string, opts LogOptions) ([]SiteErrorLogEntry, error) {
+	type keyed struct {
+		entry SiteErrorLogEntry
+		at    time.Time
+	}
+	var all []keyed
+	for _, siteID := range siteIDs {
+		entries, err := m.GetErrorLogs(siteID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("site %s: %w", siteID, err)
+		}
+		// Entries are newest first; a continuation line is read just
+		// before the line it continues.
+		site := make([]keyed, len(entries))
+		var at time.Time
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !entries[i].TimeLocal.IsZero() {
+				at = entries[i].TimeLocal
+			}
+			site[i] = keyed{SiteErrorLogEntry{SiteID: siteID, ErrorLogEntry: entries[i]}, at}
+		}
+		all = append(all, site...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if !a.at.Equal(b.at) {
+			return a.at.After(b.at)
+		}
+		return a.entry.SiteID < b.entry.SiteID
+	})
+	if opts.Limit > 0 && len(all) > opts.Limit {
+		all = all[:opts.Limit]
+	}
+	merged := make([]SiteErrorLogEntry, len(all))
+	for i, k := range all {
+		merged[i] = k.entry
+	}
+	return merged, nil
+}
@@ -0,0 +1,62 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestGetMergedAccessLogs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.com.access.log", `127.0.0.1 - - [26/Dec/2025:10:00:00 +0000] "GET /a1 HTTP/1.1" 200 1 "-" "Agent" "0.001"
+127.0.0.1 - - [26/Dec/2025:10:10:00 +0000] "GET /a2 HTTP/1.1" 200 1 "-" "Agent" "0.001"
+`)
+	// b.com switched to a JSON format: older lines are in the built-in one.
+	write("b.com.access.log", `127.0.0.1 - - [26/Dec/2025:10:05:00 +0000] "GET /b1 HTTP/1.1" 200 1 "-" "Agent" "0.001"
+{"time":"2025-12-26T10:15:00+00:00","req":"GET /b2 HTTP/1.1","status":"500"}
+`)
+	format := &models.LogFormat{Name: "json", Fields: []models.LogField{
+		{Name: "time", Variable: "$time_iso8601"}, {Name: "req", Variable: "$request"}, {Name: "status", Variable: "$status"}}}
+
+	mgr := NewManager(dir)
+	logs, err := mgr.GetMergedAccessLogs(map[string]*models.LogFormat{"a.com": nil, "b.com": format}, LogOptions{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b.com GET /b2 HTTP/1.1", "a.com GET /a2 HTTP/1.1", "b.com GET /b1 HTTP/1.1"}
+	if len(logs) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), logs)
+	}
+	for i, w := range want {
+		if got := logs[i].SiteID + " " + logs[i].Request; got != w {
+			t.Errorf("Entry %d: got %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestGetMergedErrorLogs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.com.error.log"), []byte("2025/12/26 10:00:00 [error] 1#1: first\n  continued\n2025/12/26 10:20:00 [warn] 1#1: last\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.com.error.log"), []byte("2025/12/26 10:10:00 [error] 1#1: middle\n"), 0644)
+
+	logs, err := NewManager(dir).GetMergedErrorLogs([]string{"a.com", "b.com"}, LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1#1: last", "1#1: middle", "  continued", "1#1: first"}
+	if len(logs) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), logs)
+	}
+	for i, w := range want {
+		if logs[i].Raw[len(logs[i].Raw)-len(w):] != w {
+			t.Errorf("Entry %d: got %q, want it to end with %q", i, logs[i].Raw, w)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package logmanager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogTypes lists the per-site log files managed by hubfly.
+var LogTypes = []string{"access", "error", "audit"}
+
+// Test hook run after PurgeLogs has read the file.
+var purgeScanned func()
+
+// PurgeLogs removes lines whose timestamp falls in [since, until) from the
+// site's log files. A zero since means "from the beginning", a zero until
+// means "up to now". Lines without a parseable timestamp (e.g. continuation
+// lines of an error) follow the decision made for the preceding line.
+//
+// The file is rewritten in place rather than replaced, so the descriptor
+// nginx holds stays valid and new lines keep being appended. Only the
+// complete lines read are filtered; whatever is appended meanwhile is moved
+// up behind the kept lines before the file is truncated. A line appended
+// between that last copy and the truncate, a window of a few syscalls, is
+// lost.
+func (m *Manager) PurgeLogs(siteID, logType string, since, until time.Time) (int, error) {
+	filename := filepath.Join(m.LogDir, fmt.Sprintf("%s.%s.log", siteID, logType))
+
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	// A partial last line is still being written; it is moved up as is
+	end := bytes.LastIndexByte(data, '\n') + 1
+
+	var kept bytes.Buffer
+	removed := 0
+	drop := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data[:end]))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if t, ok := lineTime(logType, line); ok {
+			drop = (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+		}
+		if drop {
+			removed++
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	if purgeScanned != nil {
+		purgeScanned()
+	}
+	if _, err := f.WriteAt(kept.Bytes(), 0); err != nil {
+		return 0, err
+	}
+	// Writes stay behind the read offset, so nothing unread is overwritten
+	read, written := int64(end), int64(kept.Len())
+	for {
+		rest, err := io.ReadAll(io.NewSectionReader(f, read, math.MaxInt64-read))
+		if err != nil {
+			return 0, err
+		}
+		if len(rest) == 0 {
+			break
+		}
+		if _, err := f.WriteAt(rest, written); err != nil {
+			return 0, err
+		}
+		read += int64(len(rest))
+		written += int64(len(rest))
+	}
+	if err := f.Truncate(written); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// lineTime extracts the timestamp of a log line for the given log type.
+func lineTime(logType, line string) (time.Time, bool) {
+	switch logType {
+	case "access":
+		if strings.HasPrefix(line, "{") {
+			return formattedLineTime(line)
+		}
+		matches := accessLogRegex.FindStringSubmatch(line)
+		if len(matches) != 10 {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(nginxTimeLayout, matches[3])
+		return t, err == nil
+	case "error":
+		if len(line) < 19 {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(errorLogTimeLayout, line[:19])
+		return t, err == nil
+	case "audit":
+		var parsed struct {
+			Time string `json:"time"`
+		}
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(time.RFC3339, parsed.Time)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,114 @@
+package logmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamLogEntry is one TCP or UDP session in a stream port's access log.
+type StreamLogEntry struct {
+	Raw           string    `json:"raw"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	TimeLocal     time.Time `json:"time_local,omitempty"` // When the session ended
+	Protocol      string    `json:"protocol,omitempty"`   // TCP or UDP
+	Status        int       `json:"status,omitempty"`     // 200, or 502 when the upstream couldn't be reached
+	BytesSent     int64     `json:"bytes_sent"`           // To the client
+	BytesReceived int64     `json:"bytes_received"`       // From the client
+	SessionTime   float64   `json:"session_time"`         // Seconds
+	UpstreamAddr  string    `json:"upstream_addr,omitempty"`
+	ServerName    string    `json:"server_name,omitempty"` // SNI, on ports routed by domain
+}
+
+// StreamLogStats summarizes stream sessions.
+type StreamLogStats struct {
+	Connections    int            `json:"connections"`
+	BytesSent      int64          `json:"bytes_sent"`
+	BytesReceived  int64          `json:"bytes_received"`
+	AvgSessionTime float64        `json:"avg_session_time_seconds"`
+	MaxSessionTime float64        `json:"max_session_time_seconds"`
+	Statuses       map[string]int `json:"statuses"` // "200", "502", ...
+}
+
+// Stream Log Regex
+// $remote_addr [$time_local] $protocol $status $bytes_sent $bytes_received $session_time "$upstream_addr" "$ssl_preread_server_name"
+// Example: 10.0.0.5 [26/Dec/2025:10:00:00 +0000] TCP 200 4096 512 12.034 "172.18.0.4:5432" ""
+var streamLogRegex = regexp.MustCompile(`^(\S+) \[([^\]]+)\] (\S+) (\d+) (\d+) (\d+) ([\d.]+) "([^"]*)" "([^"]*)"$`)
+
+// StreamLogFile is the access log of a stream port.
+func (m *Manager) StreamLogFile(port int) string {
+	return filepath.Join(m.LogDir, fmt.Sprintf("stream_%d.access.log", port))
+}
+
+// GetStreamLogs reads the access log of a stream port newest first. match,
+// when set, keeps only some sessions, such as those of one domain on a
+// port routed by SNI; Limit counts matching sessions.
+func (m *Manager) GetStreamLogs(port int, opts LogOptions, match func(StreamLogEntry) bool) ([]StreamLogEntry, error) {
+	var entries []StreamLogEntry
+	err := m.scanFileBackwards(m.StreamLogFile(port), func(line string) bool {
+		if opts.Search != "" && !strings.Contains(line, opts.Search) {
+			return true
+		}
+		entry, ok := ParseStreamLine(line)
+		if !ok {
+			return true
+		}
+		if !opts.Since.IsZero() && entry.TimeLocal.Before(opts.Since) {
+			return false
+		}
+		if !opts.Until.IsZero() && entry.TimeLocal.After(opts.Until) || match != nil && !match(entry) {
+			return true
+		}
+		entries = append(entries, entry)
+		return opts.Limit <= 0 || len(entries) < opts.Limit
+	})
+	return entries, err
+}
+
+// ParseStreamLine parses one line in the hubfly_stream log format.
+func ParseStreamLine(line string) (StreamLogEntry, bool) {
+	matches := streamLogRegex.FindStringSubmatch(line)
+	if len(matches) != 10 {
+		return StreamLogEntry{}, false
+	}
+	t, err := time.Parse(nginxTimeLayout, matches[2])
+	if err != nil {
+		return StreamLogEntry{}, false
+	}
+	status, _ := strconv.Atoi(matches[4])
+	sent, _ := strconv.ParseInt(matches[5], 10, 64)
+	received, _ := strconv.ParseInt(matches[6], 10, 64)
+	session, _ := strconv.ParseFloat(matches[7], 64)
+	return StreamLogEntry{
+		Raw:           line,
+		RemoteAddr:    matches[1],
+		TimeLocal:     t,
+		Protocol:      matches[3],
+		Status:        status,
+		BytesSent:     sent,
+		BytesReceived: received,
+		SessionTime:   session,
+		UpstreamAddr:  matches[8],
+		ServerName:    matches[9],
+	}, true
+}
+
+// SummarizeStream counts sessions, bytes and session times.
+func SummarizeStream(entries []StreamLogEntry) StreamLogStats {
+	st := StreamLogStats{Connections: len(entries), Statuses: map[string]int{}}
+	var total float64
+	for _, e := range entries {
+		st.BytesSent += e.BytesSent
+		st.BytesReceived += e.BytesReceived
+		st.Statuses[strconv.Itoa(e.Status)]++
+		total += e.SessionTime
+		st.MaxSessionTime = max(st.MaxSessionTime, e.SessionTime)
+	}
+	if len(entries) > 0 {
+		st.AvgSessionTime = total / float64(len(entries))
+	}
+	return st
+}
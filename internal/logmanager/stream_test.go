@@ -0,0 +1,44 @@
+package logmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetStreamLogs(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	lines := `10.0.0.5 [26/Dec/2025:10:00:00 +0000] TCP 200 4096 512 12.034 "172.18.0.4:5432" ""
+10.0.0.6 [26/Dec/2025:10:01:00 +0000] TCP 200 100 50 0.500 "172.18.0.5:443" "b.example.com"
+garbage line
+10.0.0.7 [26/Dec/2025:10:02:00 +0000] TCP 502 0 0 0.001 "172.18.0.4:5432" ""
+10.0.0.8 [26/Dec/2025:10:03:00 +0000] UDP 200 90 30 3.000 "172.18.0.9:53" ""
+`
+	if err := os.WriteFile(filepath.Join(mgr.LogDir, "stream_5432.access.log"), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := mgr.GetStreamLogs(5432, LogOptions{Since: time.Date(2025, 12, 26, 10, 0, 30, 0, time.UTC)}, func(e StreamLogEntry) bool { return e.ServerName == "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].RemoteAddr != "10.0.0.8" || entries[1].Status != 502 {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	if e := entries[0]; e.Protocol != "UDP" || e.BytesSent != 90 || e.BytesReceived != 30 || e.SessionTime != 3 || e.UpstreamAddr != "172.18.0.9:53" {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	entries, err = mgr.GetStreamLogs(5432, LogOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := SummarizeStream(entries)
+	if st.Connections != 4 || st.BytesSent != 4286 || st.BytesReceived != 592 || st.MaxSessionTime != 12.034 || st.Statuses["502"] != 1 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+	if st.AvgSessionTime < 3.88 || st.AvgSessionTime > 3.89 {
+		t.Errorf("Unexpected average session time %v", st.AvgSessionTime)
+	}
+}
@@ -0,0 +1,128 @@
+package logmanager
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Client is what a User-Agent string says about the client. It is a
+// deliberately small classifier covering the families dashboards group by,
+// not a full UA database.
+type Client struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	IsBot   bool   `json:"is_bot"`
+}
+
+// uaRule maps a case-insensitive substring to a family. Rules are checked in
+// order, so more specific tokens come first (Edge and Opera also send
+// "Chrome/", Chrome also sends "Safari/").
+type uaRule struct {
+	token  string
+	family string
+}
+
+var botRules = []uaRule{
+	{"googlebot", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"yandexbot", "YandexBot"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"baiduspider", "Baiduspider"},
+	{"applebot", "Applebot"},
+	{"ahrefsbot", "AhrefsBot"},
+	{"semrushbot", "SemrushBot"},
+	{"gptbot", "GPTBot"},
+	{"facebookexternalhit", "Facebook"},
+	{"twitterbot", "Twitterbot"},
+	{"slackbot", "Slackbot"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"python-requests", "python-requests"},
+	{"go-http-client", "Go HTTP client"},
+	{"okhttp", "OkHttp"},
+	{"headlesschrome", "Headless Chrome"},
+	// Generic markers, after the named ones.
+	{"bot", "Other bot"},
+	{"crawl", "Other bot"},
+	{"spider", "Other bot"},
+	{"slurp", "Other bot"},
+	{"monitor", "Other bot"},
+	{"python", "Other bot"},
+	{"java/", "Other bot"},
+	{"libwww", "Other bot"},
+	{"httpclient", "Other bot"},
+}
+
+var browserRules = []uaRule{
+	{"edg/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser", "Samsung Internet"},
+	{"yabrowser", "Yandex Browser"},
+	{"firefox/", "Firefox"},
+	{"fxios", "Firefox"},
+	{"crios", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"chromium", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+}
+
+var osRules = []uaRule{
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"cros ", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+func matchRule(ua string, rules []uaRule) string {
+	for _, r := range rules {
+		if strings.Contains(ua, r.token) {
+			return r.family
+		}
+	}
+	return ""
+}
+
+// ParseUserAgent classifies a User-Agent header. Bots report their own name
+// as Browser. An empty UA is treated as a bot: real browsers always send one.
+func ParseUserAgent(ua string) Client {
+	if ua == "" || ua == "-" {
+		return Client{Browser: "Other", OS: "Other", IsBot: true}
+	}
+	lower := strings.ToLower(ua)
+
+	c := Client{Browser: "Other", OS: "Other"}
+	if os := matchRule(lower, osRules); os != "" {
+		c.OS = os
+	}
+	if bot := matchRule(lower, botRules); bot != "" {
+		c.Browser = bot
+		c.IsBot = true
+		return c
+	}
+	if browser := matchRule(lower, browserRules); browser != "" {
+		c.Browser = browser
+	}
+	return c
+}
+
+// RefererDomain returns the host of a Referer header without a leading
+// "www.", or "" when there is none.
+func RefererDomain(referer string) string {
+	if referer == "" || referer == "-" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,94 @@
+package logmanager
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want Client
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", Client{"Chrome", "Windows", false}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61", Client{"Edge", "Windows", false}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", Client{"Safari", "macOS", false}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1", Client{"Chrome", "iOS", false}},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", Client{"Firefox", "Linux", false}},
+		{"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36", Client{"Samsung Internet", "Android", false}},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", Client{"Chrome", "ChromeOS", false}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Client{"Googlebot", "Other", true}},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36", Client{"Bingbot", "Other", true}},
+		{"curl/8.4.0", Client{"curl", "Other", true}},
+		{"UptimeRobot/2.0 (monitoring)", Client{"Other bot", "Other", true}},
+		{"-", Client{"Other", "Other", true}},
+		{"SomethingElse/1.0", Client{"Other", "Other", false}},
+	}
+	for _, tt := range tests {
+		if got := ParseUserAgent(tt.ua); got != tt.want {
+			t.Errorf("ParseUserAgent(%q) = %+v, want %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestRefererDomain(t *testing.T) {
+	tests := map[string]string{
+		"https://www.Google.com/search?q=x": "google.com",
+		"http://news.ycombinator.com/":      "news.ycombinator.com",
+		"-":                                 "",
+		"":                                  "",
+		"not a url":                         "",
+	}
+	for referer, want := range tests {
+		if got := RefererDomain(referer); got != want {
+			t.Errorf("RefererDomain(%q) = %q, want %q", referer, got, want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	lines := []string{
+		`1.1.1.1 - - [26/Dec/2025:10:00:00 +0000] "GET / HTTP/1.1" 200 10 "https://www.google.com/" "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0" "0.001"`,
+		`1.1.1.2 - - [26/Dec/2025:10:00:01 +0000] "GET /a HTTP/1.1" 404 10 "-" "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0" "0.001"`,
+		`1.1.1.3 - - [26/Dec/2025:10:00:02 +0000] "GET / HTTP/1.1" 200 10 "https://google.com/" "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)" "0.001"`,
+	}
+	var entries []LogEntry
+	for _, line := range lines {
+		e, ok := ParseAccessLine(line)
+		if !ok {
+			t.Fatalf("Failed to parse %q", line)
+		}
+		entries = append(entries, e)
+	}
+	if entries[0].Browser != "Firefox" || entries[0].RefererDomain != "google.com" || entries[0].IsBot {
+		t.Errorf("Unexpected enrichment: %+v", entries[0])
+	}
+
+	a := Summarize(entries)
+	if a.Requests != 3 || a.BotRequests != 1 {
+		t.Errorf("Expected 3 requests, 1 bot; got %d, %d", a.Requests, a.BotRequests)
+	}
+	if a.Statuses["2xx"] != 2 || a.Statuses["4xx"] != 1 {
+		t.Errorf("Unexpected statuses: %v", a.Statuses)
+	}
+	if len(a.Browsers) != 1 || a.Browsers[0] != (Count{"Firefox", 2}) {
+		t.Errorf("Unexpected browsers: %v", a.Browsers)
+	}
+	if len(a.Bots) != 1 || a.Bots[0] != (Count{"Googlebot", 1}) {
+		t.Errorf("Unexpected bots: %v", a.Bots)
+	}
+	if len(a.Referers) != 1 || a.Referers[0] != (Count{"google.com", 2}) {
+		t.Errorf("Unexpected referers: %v", a.Referers)
+	}
+	if a.Countries != nil {
+		t.Errorf("Expected no country breakdown without GeoIP, got %v", a.Countries)
+	}
+
+	// With GeoIP annotations.
+	entries[0].Country, entries[0].City = "AU", "Sydney"
+	entries[1].Country = "AU"
+	a = Summarize(entries)
+	if len(a.Countries) != 1 || a.Countries[0] != (Count{"AU", 2}) {
+		t.Errorf("Unexpected countries: %v", a.Countries)
+	}
+	if len(a.Cities) != 1 || a.Cities[0] != (Count{"Sydney, AU", 1}) {
+		t.Errorf("Unexpected cities: %v", a.Cities)
+	}
+}
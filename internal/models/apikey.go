@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Roles that can be assigned to API keys.
+const (
+	RoleViewer       = "viewer"        // Read-only access to everything except API keys
+	RoleSitesAdmin   = "sites-admin"   // viewer + manage sites
+	RoleStreamsAdmin = "streams-admin" // viewer + manage streams
+	RoleFullAdmin    = "full-admin"    // Everything, including API key management
+	RoleNodeAgent    = "node-agent"    // Fetch node configs and report node status, nothing else
+)
+
+// ValidRole reports whether r is one of the known roles.
+func ValidRole(r string) bool {
+	switch r {
+	case RoleViewer, RoleSitesAdmin, RoleStreamsAdmin, RoleFullAdmin, RoleNodeAgent:
+		return true
+	}
+	return false
+}
+
+// APIKey is a credential for the management API. Only a hash of the secret
+// is stored; the plain token is returned once, at creation time.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Role       string    `json:"role"`
+	SecretHash string    `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// ExpiresAt, when set, is when the key stops authenticating.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Bootstrap keys can't call the API. They are exchanged, once, for a
+	// regular key with the same role at POST /v1/bootstrap.
+	Bootstrap bool `json:"bootstrap,omitempty"`
+
+	// After a rotation the previous secret keeps working until
+	// PreviousValidUntil, so clients can switch over.
+	RotatedAt          *time.Time `json:"rotated_at,omitempty"`
+	PreviousSecretHash string     `json:"previous_secret_hash,omitempty"`
+	PreviousValidUntil *time.Time `json:"previous_valid_until,omitempty"`
+
+	// Usage, persisted periodically by the API server.
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RequestCount int64      `json:"request_count"`
+}
+
+// Expired reports whether the key has stopped authenticating at now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
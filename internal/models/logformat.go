@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LogFormat is an access log schema registered through the API. nginx
+// writes each entry as a JSON object with one key per field, which is how
+// hubfly reads it back.
+type LogFormat struct {
+	Name      string     `json:"name"`
+	Fields    []LogField `json:"fields"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// LogField is one key of a log entry and the nginx variable it holds.
+type LogField struct {
+	Name     string `json:"name"`     // JSON key, e.g. "client"
+	Variable string `json:"variable"` // e.g. "$remote_addr"
+}
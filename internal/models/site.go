@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"time"
 )
 
@@ -8,22 +11,213 @@ import (
 type Site struct {
 	ID              string            `json:"id"`
 	Domain          string            `json:"domain"`
+	Aliases         []string          `json:"aliases,omitempty"` // Additional server names
 	Upstreams       []string          `json:"upstreams"`
 	ForceSSL        bool              `json:"force_ssl"` // Redirect HTTP to HTTPS
 	SSL             bool              `json:"ssl"`       // Enable SSL (requires cert)
 	Templates       []string          `json:"templates"`
 	ExtraConfig     string            `json:"extra_config,omitempty"`
 	ProxySetHeaders map[string]string `json:"proxy_set_header,omitempty"`
+	Protocol        string            `json:"protocol,omitempty"` // Upstream protocol: "http" (default), "grpc" or "grpcs" (gRPC over TLS)
+
+	// Domain and Aliases hold ASCII (punycode) names. The Unicode forms of
+	// internationalized names are kept alongside for display.
+	DomainUnicode  string   `json:"domain_unicode,omitempty"`
+	AliasesUnicode []string `json:"aliases_unicode,omitempty"`
+
+	// Group is the tenant or customer the site belongs to, for usage
+	// reports.
+	Group string `json:"group,omitempty"`
 
 	// Firewall Configuration
 	Firewall *FirewallConfig `json:"firewall,omitempty"`
 
+	// ResponseRewrite replaces strings in proxied response bodies.
+	ResponseRewrite *ResponseRewrite `json:"response_rewrite,omitempty"`
+
+	// ProtectedFiles are internal locations backends can hand off to with
+	// X-Accel-Redirect, so nginx streams the file.
+	ProtectedFiles []FileMapping `json:"protected_files,omitempty"`
+
+	// Capacity caps concurrent and queued requests to protect the upstreams.
+	Capacity *Capacity `json:"capacity,omitempty"`
+
+	// Hygiene tightens client timeouts and header buffers against slow
+	// clients (slowloris, slow reads). Nil uses the global default.
+	Hygiene *ConnectionHygiene `json:"connection_hygiene,omitempty"`
+
+	// SecurityHeaders adds HSTS, CSP and related headers to every response.
+	SecurityHeaders *SecurityHeaders `json:"security_headers,omitempty"`
+
+	// WAF runs requests through ModSecurity with the OWASP Core Rule Set.
+	WAF *WAF `json:"waf,omitempty"`
+
+	// Canary is the request sent through nginx after each config apply; a
+	// config that doesn't get the expected answer is rolled back. Nil uses
+	// the defaults.
+	Canary *CanaryCheck `json:"canary,omitempty"`
+
+	// Upgrade requests are always passed on. WebSockets also keeps idle
+	// upgraded connections open for WebSocketTimeout seconds (default 3600)
+	// instead of nginx's 60.
+	WebSockets       bool `json:"websockets,omitempty"`
+	WebSocketTimeout int  `json:"websocket_timeout_seconds,omitempty"`
+
+	// HTTP3 adds a QUIC listener next to the TLS one and advertises it with
+	// Alt-Svc. Needs ssl and nginx built with the HTTP/3 module.
+	HTTP3 bool `json:"http3,omitempty"`
+
+	// TLS tunes session resumption and 0-RTT on the HTTPS server.
+	TLS *TLSSettings `json:"tls,omitempty"`
+
+	// ClientAuth asks HTTPS clients for a certificate signed by a CA, e.g.
+	// for admin panels only reachable with mutual TLS.
+	ClientAuth *ClientAuth `json:"client_auth,omitempty"`
+
+	// ClientMaxBodySize limits request bodies, e.g. "500m"; "0" removes the
+	// limit. Empty uses the global default (100m).
+	ClientMaxBodySize string `json:"client_max_body_size,omitempty"`
+	// ProxyRequestBuffering and ProxyBuffering set to false stream request
+	// and response bodies instead of buffering them, e.g. for large
+	// uploads or server-sent events. Nil keeps nginx's default (on).
+	ProxyRequestBuffering *bool `json:"proxy_request_buffering,omitempty"`
+	ProxyBuffering        *bool `json:"proxy_buffering,omitempty"`
+
+	// Routes override proxy timeouts and retries for path prefixes.
+	Routes []RouteOverride `json:"routes,omitempty"`
+
+	// Redirects send paths elsewhere before the request reaches the upstream.
+	Redirects []Redirect `json:"redirects,omitempty"`
+
+	// Rewrites change the request URI in the root location (and routes).
+	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// AuditHeaders selects request headers to record in the site's JSON audit log.
+	AuditHeaders []HeaderAudit `json:"audit_headers,omitempty"`
+
+	// LogFormat names a registered log format for the access log (empty =
+	// the built-in hubfly format).
+	LogFormat string `json:"log_format,omitempty"`
+
+	// LogRetentionDays overrides the global log retention (0 = use global).
+	LogRetentionDays int `json:"log_retention_days,omitempty"`
+
+	// ACME overrides the global certificate authority settings for this site.
+	ACME *ACMEConfig `json:"acme,omitempty"`
+	// Wildcard serves the shared *.<zone> certificate (DNS-01) instead of
+	// issuing one for this site, e.g. "example.com".
+	Wildcard string `json:"wildcard,omitempty"`
+	// KeyRotationDays re-issues the certificate with a new private key once
+	// the key is this old, even if renewals reuse it (0 = use global).
+	KeyRotationDays int `json:"key_rotation_days,omitempty"`
+	// CertLineage is the site's own lineage when it isn't named after the
+	// domain, after a promotion from a staging CA (internal use).
+	CertLineage string `json:"cert_lineage,omitempty"`
+	// CertPromotion records the last move from a staging certificate to a
+	// production one.
+	CertPromotion *CertPromotion `json:"cert_promotion,omitempty"`
+
+	// LoadBalancing sets upstream weights when there are several upstreams.
+	LoadBalancing *LoadBalancing `json:"load_balancing,omitempty"`
+	// UpstreamKeepalive reuses connections to the upstreams instead of
+	// opening one per request. It needs an upstream block, so several
+	// upstreams or load_balancing.
+	UpstreamKeepalive *UpstreamKeepalive `json:"upstream_keepalive,omitempty"`
+	// UpstreamTLS re-encrypts traffic to the upstreams, optionally with a
+	// client certificate for backends that require mTLS.
+	UpstreamTLS *UpstreamTLS `json:"upstream_tls,omitempty"`
+
+	// UpstreamHost replaces the client's Host header towards the upstreams,
+	// for origins that route by name (storage buckets, PaaS apps).
+	UpstreamHost string `json:"upstream_host,omitempty"`
+
+	// CanaryRelease sends a share of clients to a new backend version.
+	CanaryRelease *Canary `json:"canary_release,omitempty"`
+	// TrafficMirror copies requests to a shadow backend; its responses are
+	// discarded and it is never health checked.
+	TrafficMirror *Mirror `json:"traffic_mirror,omitempty"`
+
+	// Cache stores upstream responses in a cache zone of the site's own.
+	Cache *Cache `json:"cache,omitempty"`
+
+	// StaticAssets sets browser caching headers on proxied responses for
+	// matching paths, replacing the upstream's.
+	StaticAssets []StaticAssetRule `json:"static_assets,omitempty"`
+
+	// InterceptErrors replaces the bodies of upstream error responses
+	// (proxy_intercept_errors).
+	InterceptErrors *ErrorInterception `json:"intercept_errors,omitempty"`
+
+	// AssetShield has nginx answer /favicon.ico and /robots.txt itself.
+	AssetShield *AssetShield `json:"asset_shield,omitempty"`
+
+	// HealthCheck enables active probing of the upstreams.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// DownUpstreams are rendered as "down" after failing health checks (internal use).
+	DownUpstreams []string `json:"down_upstreams,omitempty"`
+
+	// Drain keeps upstreams removed from the site until their connections
+	// are closed, so deploys don't cut off WebSockets and long polls.
+	Drain *UpstreamDrain `json:"drain,omitempty"`
+	// DrainingUpstreams were removed while Drain was set and are still
+	// draining (internal use).
+	DrainingUpstreams []DrainingUpstream `json:"draining_upstreams,omitempty"`
+
+	// SyntheticChecks are requests hubfly sends to the site through nginx,
+	// so they cover the whole path from the listener to the upstream.
+	SyntheticChecks []SyntheticCheck `json:"synthetic_checks,omitempty"`
+
+	// JWTGate rejects requests without a valid JWT before they reach the
+	// upstreams. Routes may have their own or opt out.
+	JWTGate *JWTGate `json:"jwt_gate,omitempty"`
+
+	// Capture records request and response metadata for a sample of the
+	// site's traffic until it expires, see /v1/sites/{id}/capture.
+	Capture *Capture `json:"capture,omitempty"`
+
+	// Expiry takes down a temporary site, such as a preview deployment,
+	// at a set time.
+	Expiry *Expiry `json:"expiry,omitempty"`
+
 	// Status fields
-	Status          string    `json:"status"` // "active", "provisioning", "error"
-	ErrorMessage    string    `json:"error_message,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-	CertIssueStatus string    `json:"cert_issue_status,omitempty"` // "pending", "valid", "failed"
+	Status          string     `json:"status"` // "active", "provisioning", "error", "expired"
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	CertIssueStatus string     `json:"cert_issue_status,omitempty"` // "pending", "valid", "failed", "renew-failed"
+	CertExpiresAt   *time.Time `json:"cert_expires_at,omitempty"`
+
+	// UpstreamUnreachable is set when ?check_upstream=true found an upstream
+	// that did not answer at the last create or update.
+	UpstreamUnreachable bool `json:"upstream_unreachable,omitempty"`
+}
+
+// ServerNames returns the primary domain followed by any aliases.
+func (s *Site) ServerNames() []string {
+	names := make([]string, 0, 1+len(s.Aliases))
+	if s.Domain != "" {
+		names = append(names, s.Domain)
+	}
+	return append(names, s.Aliases...)
+}
+
+// CertName returns the certificate lineage served by the site: the shared
+// wildcard lineage when Wildcard is set, otherwise the site's own lineage,
+// which is named after the domain unless it was promoted.
+func (s *Site) CertName() string {
+	if s.Wildcard != "" {
+		return WildcardCertName(s.Wildcard)
+	}
+	if s.CertLineage != "" {
+		return s.CertLineage
+	}
+	return s.Domain
+}
+
+// WildcardCertName is the lineage holding the *.zone certificate. "_" is
+// not valid in a hostname, so it never collides with a site's own lineage.
+func WildcardCertName(zone string) string {
+	return "_wildcard." + zone
 }
 
 // APIResponse Standard API response wrapper (optional, but good for consistency)
@@ -33,11 +227,449 @@ type APIResponse struct {
 	Data  interface{} `json:"data,omitempty"`
 }
 
+// ResponseRewrite rewrites proxied response bodies with nginx sub_filter,
+// e.g. absolute URLs an upstream emits for its internal host.
+type ResponseRewrite struct {
+	Rules []SubFilter `json:"rules"`
+	Types []string    `json:"types,omitempty"` // MIME types besides text/html ("*" for all)
+	Once  bool        `json:"once,omitempty"`  // Replace only the first match (default: every match)
+}
+
+// SubFilter is one find/replace pair. Replace may reference nginx
+// variables such as $host.
+type SubFilter struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+}
+
+// FileMapping serves Directory at the internal location Path, e.g.
+// "/protected/" -> "/srv/downloads/". Both must end with "/".
+type FileMapping struct {
+	Path      string `json:"path"`
+	Directory string `json:"directory"`
+}
+
+// Capacity protects a fragile backend from overload. Requests over
+// MaxConcurrent, or arriving faster than Rate once Queue is full, are shed
+// with ShedStatus.
+type Capacity struct {
+	MaxConcurrent int `json:"max_concurrent,omitempty"` // Concurrent requests across all clients (limit_conn)
+	Rate          int `json:"rate,omitempty"`           // Requests per second passed to the upstream (limit_req)
+	Queue         int `json:"queue,omitempty"`          // Requests over Rate held back instead of shed
+
+	ShedStatus      int    `json:"shed_status,omitempty"`       // Default 503
+	ShedBody        string `json:"shed_body,omitempty"`         // Custom response body
+	ShedContentType string `json:"shed_content_type,omitempty"` // Default text/plain
+	RetryAfter      int    `json:"retry_after,omitempty"`       // Retry-After seconds on shed responses
+}
+
+// ConnectionHygiene sets how long nginx waits on clients and how large
+// their headers may be. Preset is applied first and the other fields
+// override it; zero values keep nginx's defaults.
+type ConnectionHygiene struct {
+	Preset              string `json:"preset,omitempty"`                        // "hardened", or "none" to ignore the global default
+	ClientHeaderTimeout int    `json:"client_header_timeout_seconds,omitempty"` // client_header_timeout
+	ClientBodyTimeout   int    `json:"client_body_timeout_seconds,omitempty"`   // client_body_timeout
+	SendTimeout         int    `json:"send_timeout_seconds,omitempty"`          // send_timeout
+	KeepaliveRequests   int    `json:"keepalive_requests,omitempty"`            // keepalive_requests
+	HeaderBuffers       int    `json:"large_header_buffers,omitempty"`          // large_client_header_buffers number
+	HeaderBufferSize    string `json:"large_header_buffer_size,omitempty"`      // large_client_header_buffers size, e.g. "8k"
+}
+
+// SecurityHeaders are response headers sent on every response, including
+// errors. Preset turns on a set of them first; the other fields add to or
+// change it.
+type SecurityHeaders struct {
+	Preset             string      `json:"preset,omitempty"`                  // "recommended"
+	HSTS               *HSTSHeader `json:"hsts,omitempty"`                    // Strict-Transport-Security, HTTPS only
+	ContentTypeOptions bool        `json:"x_content_type_options,omitempty"`  // X-Content-Type-Options: nosniff
+	FrameOptions       string      `json:"x_frame_options,omitempty"`         // DENY or SAMEORIGIN
+	ReferrerPolicy     string      `json:"referrer_policy,omitempty"`         // e.g. strict-origin-when-cross-origin
+	CSP                string      `json:"content_security_policy,omitempty"` // Sent as is
+}
+
+// WAF is a site's ModSecurity setup. Paranoia is the CRS blocking
+// paranoia level (1-4, default 1); higher levels catch more attacks and
+// more legitimate traffic.
+type WAF struct {
+	Enabled        bool           `json:"enabled"`
+	Paranoia       int            `json:"paranoia,omitempty"`
+	DetectionOnly  bool           `json:"detection_only,omitempty"` // Log matches without blocking
+	RuleExclusions []WAFExclusion `json:"rule_exclusions,omitempty"`
+}
+
+// WAFExclusion turns off a CRS rule for the site, or only for request
+// paths under Path.
+type WAFExclusion struct {
+	RuleID int    `json:"rule_id"`
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Canary sends Percent of clients (0.01-100) to Upstream and the rest to
+// the site's upstreams. A client stays on the same side while the
+// percentage is unchanged.
+type Canary struct {
+	Upstream string  `json:"upstream"`
+	Percent  float64 `json:"percent"`
+}
+
+// Mirror copies a sample of requests (SampleRate 0-1; 0 means all) to
+// Upstream, e.g. a staging backend.
+type Mirror struct {
+	Upstream   string  `json:"upstream"`
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// Capture is a short-lived traffic capture. Requests are recorded with
+// their timings, sizes and common headers; bodies only with RequestBodies,
+// and then only request bodies nginx held in memory.
+type Capture struct {
+	SampleRate    float64   `json:"sample_rate,omitempty"` // Share of requests recorded; 0 records all
+	Headers       []string  `json:"headers,omitempty"`     // More request and response headers to record
+	RequestBodies bool      `json:"request_bodies,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// Active reports whether the capture is still recording at now.
+func (c *Capture) Active(now time.Time) bool {
+	return c != nil && now.Before(c.ExpiresAt)
+}
+
+// Cache configures proxy caching. Responses are cached for as long as
+// TTLByStatus says ("200": "10m"; "any" for every other status), or as the
+// upstream's Cache-Control allows when it is empty. KeyExtras are nginx
+// variables added to the cache key, e.g. "$http_accept_language". Requests
+// carrying one of BypassCookies (e.g. a session) skip the cache both ways.
+type Cache struct {
+	Enabled       bool              `json:"enabled"`
+	ZoneSize      string            `json:"zone_size,omitempty"` // Key zone size, default "10m" (about 80,000 keys)
+	TTLByStatus   map[string]string `json:"ttl_by_status,omitempty"`
+	KeyExtras     []string          `json:"key_extras,omitempty"`
+	BypassCookies []string          `json:"bypass_cookies,omitempty"`
+}
+
+// StaticAssetRule matches requests by path prefix, file extension or both,
+// and has browsers cache the responses for MaxAge seconds. Rules are tried
+// in order; the first match wins.
+type StaticAssetRule struct {
+	Path       string   `json:"path,omitempty"`       // Path prefix, e.g. "/assets/"
+	Extensions []string `json:"extensions,omitempty"` // e.g. ["css", "js", "woff2"]
+	MaxAge     int      `json:"max_age_seconds"`      // Cache-Control max-age and Expires
+	Immutable  bool     `json:"immutable,omitempty"`  // For fingerprinted files that never change
+}
+
+// UpstreamDrain delays dropping removed upstreams until the nginx workers
+// that had connections to them have exited, or until the timeout.
+type UpstreamDrain struct {
+	Enabled bool `json:"enabled"`
+	Timeout int  `json:"timeout_seconds,omitempty"` // Default 300, at most 3600
+}
+
+// Expiry actions.
+const (
+	ExpiryDisable = "disable" // Keep the site or stream, but stop serving it
+	ExpiryDelete  = "delete"
+)
+
+// Expiry schedules a site or stream to be disabled or deleted. Webhooks
+// are warned NotifyBefore ahead, and again when it expires.
+type Expiry struct {
+	ExpiresAt    time.Time `json:"expires_at"`
+	Action       string    `json:"action,omitempty"`                // "disable" (default) or "delete"
+	NotifyBefore int       `json:"notify_before_seconds,omitempty"` // Default --expiry-notice
+	Warned       bool      `json:"warned,omitempty"`                // The warning was sent (internal use)
+	Done         bool      `json:"done,omitempty"`                  // The action was carried out (internal use)
+}
+
+// Expired reports whether e has passed at now.
+func (e *Expiry) Expired(now time.Time) bool {
+	return e != nil && !now.Before(e.ExpiresAt)
+}
+
+// DrainingUpstream is an upstream removed from a site that may still have
+// connections from before the change.
+type DrainingUpstream struct {
+	Address string    `json:"address"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"` // Dropped at the latest then
+}
+
+// AssetShield serves /favicon.ico and /robots.txt from nginx, so backends
+// without them aren't asked and their logs don't fill with 404s. Files
+// uploaded to /v1/sites/{id}/files are served; without one, the favicon
+// is empty (204) and robots.txt allows everything.
+type AssetShield struct {
+	Favicon bool `json:"favicon,omitempty"`
+	Robots  bool `json:"robots,omitempty"`
+	MaxAge  int  `json:"max_age_seconds,omitempty"` // Browser caching, default one day
+}
+
+// ErrorInterception maps upstream error statuses to what clients get
+// instead, so web domains can show branded pages while API domains keep
+// their backend's error bodies.
+type ErrorInterception struct {
+	Codes map[int]ErrorResponse `json:"codes"` // 400-599
+}
+
+// ErrorResponse is what an intercepted status is answered with. The status
+// itself is kept.
+type ErrorResponse struct {
+	Action  string `json:"action"`            // "page", "json" or "passthrough"
+	Page    string `json:"page,omitempty"`    // page: a path on the site; defaults to the bundled page for 403, 404, 502 and 504
+	Message string `json:"message,omitempty"` // json: defaults to the status text
+}
+
+// CanaryCheck is what a site's canary request expects. Without an
+// expected status or location nginx must answer with anything but a 500,
+// or with the HTTPS redirect when force_ssl is on.
+type CanaryCheck struct {
+	Disabled       bool   `json:"disabled,omitempty"`
+	Path           string `json:"path,omitempty"`            // Default /
+	ExpectStatus   int    `json:"expect_status,omitempty"`   // Exact status code
+	ExpectLocation string `json:"expect_location,omitempty"` // Prefix of the Location header
+}
+
+// HSTSHeader is a Strict-Transport-Security policy.
+type HSTSHeader struct {
+	MaxAge            int  `json:"max_age_seconds,omitempty"` // Default one year
+	IncludeSubDomains bool `json:"include_subdomains,omitempty"`
+	Preload           bool `json:"preload,omitempty"`
+}
+
+// Status returns the status code of shed requests.
+func (c *Capacity) Status() int {
+	if c.ShedStatus == 0 {
+		return 503
+	}
+	return c.ShedStatus
+}
+
+// RouteOverride gives a path prefix its own timeouts, retry budget or
+// protocol, e.g. a slow "/reports/" next to an "/api/" that must fail fast.
+// Zero values keep the site's settings.
+type RouteOverride struct {
+	Path           string       `json:"path"`                              // Location prefix, e.g. "/reports/"
+	ReadTimeout    int          `json:"read_timeout_seconds,omitempty"`    // proxy_read_timeout
+	SendTimeout    int          `json:"send_timeout_seconds,omitempty"`    // proxy_send_timeout
+	ConnectTimeout int          `json:"connect_timeout_seconds,omitempty"` // proxy_connect_timeout (max 75)
+	Retries        *RetryPolicy `json:"retries,omitempty"`
+	Protocol       string       `json:"protocol,omitempty"` // Overrides the site's protocol, e.g. "grpc" for one service path
+
+	// LimitRate caps the response rate of each client connection, e.g.
+	// "500k" bytes per second (limit_rate). RateSchedule replaces it
+	// during time windows.
+	LimitRate    string       `json:"limit_rate,omitempty"`
+	RateSchedule []RateWindow `json:"rate_schedule,omitempty"`
+
+	// JWTGate replaces the site's gate under the route.
+	JWTGate *JWTGate `json:"jwt_gate,omitempty"`
+}
+
+// JWTGate validates a JWT sent in a header (by default "Authorization:
+// Bearer") or a cookie, signed by a key of the JWKS. Expired tokens are
+// always rejected; Issuer and Audience are only checked when set.
+type JWTGate struct {
+	JWKSURL      string   `json:"jwks_url,omitempty"`
+	Issuer       string   `json:"issuer,omitempty"`
+	Audience     []string `json:"audience,omitempty"` // The token needs one of them
+	Header       string   `json:"header,omitempty"`
+	Cookie       string   `json:"cookie,omitempty"`
+	Leeway       int      `json:"leeway_seconds,omitempty"`     // Clock skew allowed for exp and nbf
+	CacheSeconds int      `json:"jwks_cache_seconds,omitempty"` // How long the JWKS is cached (default 600)
+	Disabled     bool     `json:"disabled,omitempty"`           // On a route: no gate, even if the site has one
+}
+
+// Hash identifies the gate's settings. nginx sends it with each check, so
+// the API can tell a config it no longer has from the stored one.
+func (g *JWTGate) Hash() string {
+	data, _ := json.Marshal(g)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RateWindow is a limit_rate that applies between From and To ("HH:MM",
+// server local time) on Days ("mon".."sun"; empty means every day). A
+// window whose To is earlier than From runs past midnight. Rate "0" lifts
+// the limit.
+type RateWindow struct {
+	Days []string `json:"days,omitempty"`
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Rate string   `json:"rate"`
+}
+
+// RetryPolicy controls when nginx passes a failed request to the next
+// upstream.
+type RetryPolicy struct {
+	On      []string `json:"on,omitempty"`              // proxy_next_upstream conditions, e.g. ["error", "timeout", "http_503"]; ["off"] disables
+	Tries   int      `json:"tries,omitempty"`           // Upstreams to try in total (1 = no retries)
+	Timeout int      `json:"timeout_seconds,omitempty"` // Give up retrying after this long
+}
+
+// Redirect sends requests for a path to another URL. From is an exact path
+// ("/spring-sale") or a "~" regex matched against the URI
+// ("~^/blog/(.*)$"), whose captures To can use as $1, $2...
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`             // Path or absolute URL
+	Code int    `json:"code,omitempty"` // 301 (default), 302, 303, 307 or 308; regexes allow 301 and 302
+}
+
+// Rewrite is an nginx rewrite directive. Pattern is a PCRE regex matched
+// against the URI; Replacement may use its captures as $1, $2...
+type Rewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Flag        string `json:"flag,omitempty"` // "last", "break", "redirect", "permanent" or empty
+}
+
+// HeaderAudit selects a request header for the audit log and how it is recorded.
+type HeaderAudit struct {
+	Name string `json:"name"` // Header name, e.g. "Authorization"
+	Mode string `json:"mode"` // "presence" (default), "hash" or "raw"
+}
+
+// CertPromotion is a site's switch from a certificate of a staging CA to
+// one issued by a production CA. The staging lineage is kept on disk.
+type CertPromotion struct {
+	From       string    `json:"from"` // Staging lineage
+	FromIssuer string    `json:"from_issuer"`
+	To         string    `json:"to"` // Production lineage
+	ToIssuer   string    `json:"to_issuer"`
+	Server     string    `json:"server"` // ACME directory issued against
+	PromotedAt time.Time `json:"promoted_at"`
+}
+
+// ACMEConfig selects the ACME CA and External Account Binding credentials
+// used when issuing this site's certificate (ZeroSSL, Google Trust Services, ...).
+//
+// EABHMACKey is write-only: Redacted drops it from everything that leaves
+// the store, and reports EABHMACKeySet instead.
+type ACMEConfig struct {
+	Server        string `json:"server,omitempty"`           // ACME directory URL
+	EABKeyID      string `json:"eab_kid,omitempty"`          // External Account Binding key ID
+	EABHMACKey    string `json:"eab_hmac_key,omitempty"`     // External Account Binding HMAC key (base64url)
+	EABHMACKeySet bool   `json:"eab_hmac_key_set,omitempty"` // In responses: an HMAC key is stored
+}
+
+// Redacted returns a copy of the site without write-only secrets, for API
+// responses, exports and watch events.
+func (s Site) Redacted() Site {
+	if s.ACME != nil {
+		acme := *s.ACME
+		acme.EABHMACKey, acme.EABHMACKeySet = "", acme.EABHMACKey != ""
+		s.ACME = &acme
+	}
+	return s
+}
+
+// KeepEABKey carries the stored HMAC key over to an update of the same EAB
+// key ID that doesn't repeat it, as clients never get it back to send.
+func (a *ACMEConfig) KeepEABKey(old *ACMEConfig) {
+	if a != nil && old != nil && a.EABHMACKey == "" && a.EABKeyID != "" && a.EABKeyID == old.EABKeyID {
+		a.EABHMACKey = old.EABHMACKey
+	}
+}
+
+// LoadBalancing configures how requests are spread across a site's upstreams.
+type LoadBalancing struct {
+	Weights  map[string]int   `json:"weights,omitempty"` // Base weight per upstream (default 1)
+	Adaptive *AdaptiveWeights `json:"adaptive,omitempty"`
+
+	// EffectiveWeights are the weights last rendered by the adaptive
+	// balancer (internal use).
+	EffectiveWeights map[string]int `json:"effective_weights,omitempty"`
+}
+
+// UpstreamKeepalive sets how many idle connections each nginx worker keeps
+// to a site's upstreams, and for how long.
+type UpstreamKeepalive struct {
+	Connections int `json:"connections"`               // keepalive
+	Timeout     int `json:"timeout_seconds,omitempty"` // keepalive_timeout (nginx default 60)
+	Requests    int `json:"requests,omitempty"`        // keepalive_requests (nginx default 1000)
+}
+
+// UpstreamTLS configures TLS to the upstreams. The certificate, key and CA
+// are PEM files on the hubfly host, so keys never pass through the API.
+type UpstreamTLS struct {
+	Scheme     string `json:"scheme"`                // "https" (grpcs for gRPC sites)
+	ClientCert string `json:"client_cert,omitempty"` // proxy_ssl_certificate
+	ClientKey  string `json:"client_key,omitempty"`  // proxy_ssl_certificate_key
+	CA         string `json:"ca,omitempty"`          // proxy_ssl_trusted_certificate
+	Verify     bool   `json:"verify,omitempty"`      // Check the upstream's certificate against CA
+	SNI        bool   `json:"sni,omitempty"`         // Send the server name in the handshake (proxy_ssl_server_name)
+	ServerName string `json:"server_name,omitempty"` // Name sent and verified (proxy_ssl_name); default upstream_host
+}
+
+// AdaptiveWeights scales upstream weights by measured latency and health so
+// slower or failing backends receive proportionally less traffic.
+type AdaptiveWeights struct {
+	Enabled   bool `json:"enabled"`
+	MinWeight int  `json:"min_weight,omitempty"` // Lower bound for any upstream (default 1)
+	MaxWeight int  `json:"max_weight,omitempty"` // Upper bound for any upstream (default 100)
+}
+
+// HealthCheck configures active probing of a site's upstreams.
+type HealthCheck struct {
+	Enabled      bool   `json:"enabled"`
+	Type         string `json:"type,omitempty"`            // "tcp" (default) or "http"
+	Path         string `json:"path,omitempty"`            // HTTP path to GET (default "/")
+	ExpectStatus []int  `json:"expect_status,omitempty"`   // Healthy HTTP statuses (default 200-399)
+	Timeout      int    `json:"timeout_seconds,omitempty"` // Per-probe timeout (default 2)
+	MarkDown     bool   `json:"mark_down,omitempty"`       // Render failing upstreams as "down"
+}
+
+// SyntheticCheck is a request sent to a site on a schedule. It goes over
+// HTTPS when the site has SSL, with the certificate verified.
+type SyntheticCheck struct {
+	Name          string `json:"name"`
+	Path          string `json:"path,omitempty"`             // Request URI (default "/")
+	ExpectStatus  []int  `json:"expect_status,omitempty"`    // Passing statuses (default 200-399)
+	ExpectBody    string `json:"expect_body,omitempty"`      // Text the body must contain
+	Interval      int    `json:"interval_seconds,omitempty"` // Default 60
+	Timeout       int    `json:"timeout_seconds,omitempty"`  // Default 10
+	FailThreshold int    `json:"fail_threshold,omitempty"`   // Failures in a row before it is down (default 2)
+	SkipTLSVerify bool   `json:"skip_tls_verify,omitempty"`  // e.g. for staging certificates
+}
+
+// TLSSettings tune TLS handshakes. Nil fields keep nginx's defaults:
+// no session cache and session tickets on.
+type TLSSettings struct {
+	SessionCacheSize string `json:"session_cache_size,omitempty"` // Shared session cache, e.g. "10m" (about 40000 sessions), or "off"
+	SessionTickets   *bool  `json:"session_tickets,omitempty"`    // ssl_session_tickets
+	EarlyData        bool   `json:"early_data,omitempty"`         // TLS 1.3 0-RTT; requests may be replayed
+}
+
+// ClientAuth verifies client certificates against CAPath, a PEM bundle on
+// the hubfly host. The certificate's subject and the verification result
+// are sent to the upstream as X-SSL-Client-S-DN and X-SSL-Client-Verify.
+type ClientAuth struct {
+	CAPath   string `json:"ca_path"`
+	Optional bool   `json:"optional,omitempty"` // Let clients without a certificate through; the upstream decides
+}
+
 // FirewallConfig holds all firewall related settings
 type FirewallConfig struct {
 	IPRules    []IPRule         `json:"ip_rules,omitempty"`
 	BlockRules *BlockRules      `json:"block_rules,omitempty"`
 	RateLimit  *RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// BlockTraversal rejects requests whose raw URI contains encoded path
+	// traversal (%2e%2e/, double encoding, null bytes) with 400.
+	BlockTraversal bool `json:"block_traversal,omitempty"`
+
+	// Countries rejects clients by GeoIP country with 403.
+	Countries *CountryRules `json:"countries,omitempty"`
+}
+
+// CountryRules allow or deny ISO 3166-1 alpha-2 country codes. With an
+// allow list, every other country is denied.
+type CountryRules struct {
+	Allow        []string `json:"allow,omitempty"`
+	Deny         []string `json:"deny,omitempty"`
+	AllowUnknown bool     `json:"allow_unknown,omitempty"` // Clients with no country (e.g. private IPs) pass an allow list
 }
 
 // IPRule defines an allow/deny rule for an IP or CIDR
@@ -48,17 +680,19 @@ type IPRule struct {
 
 // BlockRules defines patterns to block requests
 type BlockRules struct {
-	UserAgents  []string            `json:"user_agents,omitempty"` // Regex patterns for User-Agent
-	Methods     []string            `json:"methods,omitempty"`     // HTTP Methods to block (e.g., POST, PUT)
-	Paths       []string            `json:"paths,omitempty"`       // Regex patterns for URL paths
-	PathMethods map[string][]string `json:"path_methods,omitempty"` // Map of Path -> []Methods to block
+	UserAgents   []string            `json:"user_agents,omitempty"`   // Regex patterns for User-Agent
+	Methods      []string            `json:"methods,omitempty"`       // HTTP Methods to block (e.g., POST, PUT)
+	Paths        []string            `json:"paths,omitempty"`         // Regex patterns for URL paths
+	PathMethods  map[string][]string `json:"path_methods,omitempty"`  // Map of Path -> []Methods to block
+	Extensions   []string            `json:"extensions,omitempty"`    // File extensions to block, e.g. "php", "env", "git"
+	ContentTypes []string            `json:"content_types,omitempty"` // Request Content-Type prefixes to reject with 415
 }
 
 // RateLimitConfig defines rate limiting parameters
 type RateLimitConfig struct {
-	Enabled        bool   `json:"enabled"`
-	Rate           int    `json:"rate"`            // Requests per unit
-	Unit           string `json:"unit"`            // "r/s" or "r/m"
-	Burst          int    `json:"burst"`           // Max burst size
-	ZoneName       string `json:"zone_name"`       // Internal use: Nginx zone name
+	Enabled  bool   `json:"enabled"`
+	Rate     int    `json:"rate"`      // Requests per unit
+	Unit     string `json:"unit"`      // "r/s" or "r/m"
+	Burst    int    `json:"burst"`     // Max burst size
+	ZoneName string `json:"zone_name"` // Internal use: Nginx zone name
 }
@@ -4,14 +4,104 @@ import "time"
 
 // Stream represents a Layer 4 (TCP/UDP) proxy configuration.
 type Stream struct {
-	ID           string    `json:"id"`
-	ListenPort   int       `json:"listen_port"` // Port to listen on host
-	Upstream     string    `json:"upstream"`    // host:port
-	Protocol     string    `json:"protocol"`    // "tcp" or "udp" (default tcp)
-	Domain       string    `json:"domain,omitempty"` // SNI Hostname (for TCP+TLS routing)
-	
+	ID         string `json:"id"`
+	ListenPort int    `json:"listen_port"`      // Port to listen on host
+	Upstream   string `json:"upstream"`         // host:port, or use Upstreams
+	Protocol   string `json:"protocol"`         // "tcp" or "udp" (default tcp)
+	Domain     string `json:"domain,omitempty"` // SNI Hostname (for TCP+TLS routing), ASCII form
+
+	// Upstreams balances the stream over several host:port addresses
+	// (database replicas, an MQTT cluster) instead of one Upstream.
+	Upstreams     []string         `json:"upstreams,omitempty"`
+	LoadBalancing *StreamBalancing `json:"load_balancing,omitempty"`
+
+	// DomainUnicode is the Unicode form of an internationalized Domain.
+	DomainUnicode string `json:"domain_unicode,omitempty"`
+
+	// Group is the tenant or customer the stream belongs to, for usage
+	// reports.
+	Group string `json:"group,omitempty"`
+
+	// BindAddress restricts the listener to one local IP (e.g. an internal
+	// interface on a multi-homed host). Empty listens on all interfaces.
+	BindAddress string `json:"bind_address,omitempty"`
+
+	// Timeouts replaces nginx's stream timeouts (10 minutes idle, 60
+	// seconds to connect). Streams sharing a port must agree on them.
+	Timeouts *StreamTimeouts `json:"timeouts,omitempty"`
+
+	// UDP tunes the sessions of a udp stream.
+	UDP *StreamUDP `json:"udp,omitempty"`
+
+	// HealthCheck changes how the upstreams are probed in the background.
+	HealthCheck *StreamHealthCheck `json:"health_check,omitempty"`
+
+	// Expiry takes down a temporary stream at a set time.
+	Expiry *Expiry `json:"expiry,omitempty"`
+
+	// UpstreamUnreachable is set when ?check_upstream=true could not connect
+	// to the upstream at creation.
+	UpstreamUnreachable bool `json:"upstream_unreachable,omitempty"`
+
+	// Status is "active" once the config is applied and an upstream is
+	// reachable, "unreachable" when health checks reach none,
+	// "provisioning" or "error" while applying, and "expired" once disabled
+	// by its Expiry.
 	Status       string    `json:"status"`
 	ErrorMessage string    `json:"error_message,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
-}
\ No newline at end of file
+}
+
+// StreamTimeouts sets how long a stream waits on its connections. Preset is
+// applied first and the other fields override it; zero values keep nginx's
+// defaults.
+type StreamTimeouts struct {
+	Preset          string `json:"preset,omitempty"`                  // "long-lived" or "fast-failover"
+	Idle            int    `json:"idle_seconds,omitempty"`            // proxy_timeout
+	Connect         int    `json:"connect_timeout_seconds,omitempty"` // proxy_connect_timeout (max 75)
+	SocketKeepalive bool   `json:"socket_keepalive,omitempty"`        // proxy_socket_keepalive (TCP only)
+}
+
+// StreamUDP tunes UDP sessions. A session ends after Responses datagrams
+// came back, or after the idle timeout (Timeouts.Idle, 10 minutes by
+// default) without any.
+type StreamUDP struct {
+	// Responses is how many datagrams the upstream answers each client
+	// datagram with (proxy_responses): 1 for DNS, 0 for fire-and-forget
+	// traffic such as syslog or metrics. Unset, sessions stay open for
+	// replies until they idle out, as game servers need.
+	Responses *int `json:"proxy_responses,omitempty"`
+}
+
+// StreamHealthCheck tunes the background probe of a stream's upstreams.
+// TCP upstreams are dialed by default; UDP has no connection to open, so
+// UDP streams are only checked when Send is set.
+type StreamHealthCheck struct {
+	Disabled bool   `json:"disabled,omitempty"`
+	Send     string `json:"send,omitempty"`            // Written once connected, e.g. "PING\r\n"
+	Expect   string `json:"expect,omitempty"`          // Text the first reply must contain, e.g. "+PONG"
+	Timeout  int    `json:"timeout_seconds,omitempty"` // Per-probe timeout (default 2, at most 30)
+}
+
+// StreamBalancing picks how a stream's connections are spread over its
+// upstreams and when an upstream is taken out. Zero values keep nginx's
+// defaults: round robin, 1 failure and 10 seconds. UDP streams default to
+// consistent hashing on the client address instead, so a client's
+// datagrams keep reaching the same upstream across sessions.
+type StreamBalancing struct {
+	Method      string                  `json:"method,omitempty"`               // "round_robin" (default for tcp), "least_conn", "hash" or "random"
+	HashKey     string                  `json:"hash_key,omitempty"`             // hash only (default $remote_addr)
+	Consistent  bool                    `json:"consistent,omitempty"`           // hash only: ketama, so adding an upstream moves few clients
+	MaxFails    int                     `json:"max_fails,omitempty"`            // Failed connections before an upstream is taken out
+	FailTimeout int                     `json:"fail_timeout_seconds,omitempty"` // How long it stays out, and the window max_fails is counted in
+	Servers     map[string]StreamServer `json:"servers,omitempty"`              // Per-upstream settings, keyed by address
+}
+
+// StreamServer overrides the balancing settings of one upstream.
+type StreamServer struct {
+	Weight      int  `json:"weight,omitempty"`
+	MaxFails    int  `json:"max_fails,omitempty"`
+	FailTimeout int  `json:"fail_timeout_seconds,omitempty"`
+	Backup      bool `json:"backup,omitempty"` // Only used when the others are down (round_robin and least_conn)
+}
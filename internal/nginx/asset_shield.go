@@ -0,0 +1,133 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Files a site can upload for its asset shield.
+const (
+	FaviconFile = "favicon.ico"
+	RobotsFile  = "robots.txt"
+)
+
+// MaxSiteFileSize bounds an uploaded favicon or robots.txt.
+const MaxSiteFileSize = 256 << 10
+
+const defaultShieldMaxAge = 86400
+
+// assetShield is a site's AssetShield ready to render.
+type assetShield struct {
+	MaxAge int
+	Files  []shieldedFile
+}
+
+type shieldedFile struct {
+	Path    string // Location, e.g. "/favicon.ico"
+	File    string // Uploaded file served with alias, or "" for Default
+	Default string // Directives answering without a file
+}
+
+// CheckAssetShield validates a site's asset shield.
+func CheckAssetShield(site *models.Site) error {
+	a := site.AssetShield
+	if a == nil {
+		return nil
+	}
+	if !a.Favicon && !a.Robots {
+		return fmt.Errorf("asset_shield: enable favicon, robots or both")
+	}
+	if a.MaxAge < 0 || a.MaxAge > maxStaticAssetMaxAge {
+		return fmt.Errorf("asset_shield: max_age_seconds must be between 0 and %d (one year)", maxStaticAssetMaxAge)
+	}
+	// Exact redirects render the same location.
+	for _, r := range site.Redirects {
+		if a.Favicon && r.From == "/"+FaviconFile || a.Robots && r.From == "/"+RobotsFile {
+			return fmt.Errorf("asset_shield: %s already has a redirect", r.From)
+		}
+	}
+	return nil
+}
+
+// SiteFile is where an uploaded file of a site is kept.
+func (m *Manager) SiteFile(siteID, name string) string {
+	return filepath.Join(m.FilesDir, siteID, name)
+}
+
+// SaveSiteFile stores an uploaded favicon.ico or robots.txt of a site.
+func (m *Manager) SaveSiteFile(siteID, name string, data []byte) error {
+	if name != FaviconFile && name != RobotsFile {
+		return fmt.Errorf("unknown file %q (use %s or %s)", name, FaviconFile, RobotsFile)
+	}
+	if len(data) == 0 || len(data) > MaxSiteFileSize {
+		return fmt.Errorf("%s must be between 1 byte and %d KB", name, MaxSiteFileSize>>10)
+	}
+	dir := filepath.Join(m.FilesDir, siteID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// nginx workers read the file.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.SiteFile(siteID, name))
+}
+
+// DeleteSiteFile removes an uploaded file of a site.
+func (m *Manager) DeleteSiteFile(siteID, name string) error {
+	if name != FaviconFile && name != RobotsFile {
+		return os.ErrNotExist
+	}
+	return os.Remove(m.SiteFile(siteID, name))
+}
+
+// DeleteSiteFiles removes every uploaded file of a site.
+func (m *Manager) DeleteSiteFiles(siteID string) error {
+	return os.RemoveAll(filepath.Join(m.FilesDir, siteID))
+}
+
+// resolveAssetShield serves uploaded files where there are some, and
+// otherwise an empty favicon (204) and a robots.txt allowing everything.
+func (m *Manager) resolveAssetShield(site *models.Site) *assetShield {
+	a := site.AssetShield
+	if a == nil {
+		return nil
+	}
+	out := &assetShield{MaxAge: a.MaxAge}
+	if out.MaxAge == 0 {
+		out.MaxAge = defaultShieldMaxAge
+	}
+	for _, f := range []struct {
+		name    string
+		enabled bool
+		def     string
+	}{
+		{FaviconFile, a.Favicon, "return 204;"},
+		{RobotsFile, a.Robots, `default_type text/plain; return 200 "User-agent: *\nAllow: /\n";`},
+	} {
+		if !f.enabled {
+			continue
+		}
+		sf := shieldedFile{Path: "/" + f.name, Default: f.def}
+		if _, err := os.Stat(m.SiteFile(site.ID, f.name)); err == nil {
+			sf.File = m.SiteFile(site.ID, f.name)
+		}
+		out.Files = append(out.Files, sf)
+	}
+	return out
+}
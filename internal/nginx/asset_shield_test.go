@@ -0,0 +1,63 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestAssetShield(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "shop.local", Domain: "shop.local", Upstreams: []string{"shop:3000"},
+		AssetShield: &models.AssetShield{Favicon: true, Robots: true},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"location = /favicon.ico {",
+		"return 204;",
+		"location = /robots.txt {",
+		`return 200 "User-agent: *\nAllow: /\n";`,
+		"expires 86400s;",
+		"log_not_found off;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// Uploaded files replace the defaults.
+	if err := mgr.SaveSiteFile(site.ID, RobotsFile, []byte("User-agent: *\nDisallow: /*.php$\n")); err != nil {
+		t.Fatal(err)
+	}
+	site.AssetShield = &models.AssetShield{Robots: true, MaxAge: 600}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = string(config)
+	if !strings.Contains(cfg, `alias "`+mgr.SiteFile(site.ID, RobotsFile)+`";`) || !strings.Contains(cfg, "expires 600s;") {
+		t.Errorf("Expected the uploaded robots.txt:\n%s", cfg)
+	}
+	if strings.Contains(cfg, "favicon") {
+		t.Errorf("Expected the favicon to reach the upstream:\n%s", cfg)
+	}
+
+	if err := mgr.SaveSiteFile(site.ID, "index.html", []byte("x")); err == nil {
+		t.Error("Expected an unknown file name to be rejected")
+	}
+	for _, a := range []*models.AssetShield{{}, {Favicon: true, MaxAge: -1}} {
+		if err := CheckAssetShield(&models.Site{AssetShield: a}); err == nil {
+			t.Errorf("Expected %+v to be rejected", a)
+		}
+	}
+	redirected := &models.Site{AssetShield: &models.AssetShield{Favicon: true}, Redirects: []models.Redirect{{From: "/favicon.ico", To: "/static/icon.png"}}}
+	if err := CheckAssetShield(redirected); err == nil {
+		t.Error("Expected a clash with a redirect to be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+var headerNameRegex = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// auditLog holds the rendered pieces of a site's header audit log.
+type auditLog struct {
+	HTTP   string // log_format and maps, http context
+	Server string // access_log and set directives, server context
+}
+
+// renderAuditLog builds the JSON audit log_format for the headers selected on
+// the site. "presence" logs 0/1, "hash" logs a truncated SHA-256 computed by
+// the njs helper, and "raw" logs the value verbatim.
+func renderAuditLog(site *models.Site) (auditLog, error) {
+	if len(site.AuditHeaders) == 0 {
+		return auditLog{}, nil
+	}
+
+	id := ident(site.ID)
+	var maps strings.Builder
+	var fields []string
+	var hashed []string
+
+	for _, h := range site.AuditHeaders {
+		if !headerNameRegex.MatchString(h.Name) {
+			return auditLog{}, fmt.Errorf("invalid audit header name %q", h.Name)
+		}
+		name := strings.ToLower(h.Name)
+		variable := "$http_" + strings.ReplaceAll(name, "-", "_")
+
+		switch h.Mode {
+		case "", "presence":
+			flag := fmt.Sprintf("$audit_%s_%s", id, ident(name))
+			fmt.Fprintf(&maps, "map %s %s {\n    \"\" \"0\";\n    default \"1\";\n}\n", variable, flag)
+			fields = append(fields, fmt.Sprintf(`"%s":"%s"`, name, flag))
+		case "hash":
+			hashed = append(hashed, name)
+		case "raw":
+			fields = append(fields, fmt.Sprintf(`"%s":"%s"`, name, variable))
+		default:
+			return auditLog{}, fmt.Errorf("invalid audit mode %q for header %s: must be presence, hash or raw", h.Mode, h.Name)
+		}
+	}
+
+	format := fmt.Sprintf(`log_format hubfly_audit_%s escape=json '{"time":"$time_iso8601","remote_addr":"$remote_addr","request":"$request","status":"$status","headers":{%s},"header_hashes":"$hubfly_header_hashes"}';`,
+		id, strings.Join(fields, ","))
+
+	var server strings.Builder
+	if len(hashed) > 0 {
+		fmt.Fprintf(&server, "set $hubfly_audit_hash \"%s\";\n    ", strings.Join(hashed, ","))
+	}
+	fmt.Fprintf(&server, "access_log /var/log/hubfly/%s.audit.log hubfly_audit_%s;", site.ID, id)
+
+	return auditLog{
+		HTTP:   maps.String() + format,
+		Server: server.String(),
+	}, nil
+}
+
+// ident turns an arbitrary ID into something usable in nginx variable and
+// zone names. The names are global to the http context, so no two IDs may
+// map to the same one: "my-app.example.com" and "my.app.example.com" would
+// both be "my_app_example_com". Any ID that isn't alphanumeric already
+// gets a hash of itself appended, which also keeps it apart from IDs
+// that were written with underscores.
+func ident(s string) string {
+	var b strings.Builder
+	changed := false
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+			changed = true
+		}
+	}
+	if changed {
+		sum := sha256.Sum256([]byte(s))
+		b.WriteString("_" + hex.EncodeToString(sum[:4]))
+	}
+	return b.String()
+}
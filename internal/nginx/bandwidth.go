@@ -0,0 +1,118 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// rateValue is an nginx size: bytes per second, or with a k or m suffix.
+var rateValue = regexp.MustCompile(`^[0-9]+[kKmM]?$`)
+
+// weekdays are the day names rate windows accept.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// renderTime is the clock rate schedules are rendered against.
+var renderTime = time.Now
+
+// CheckRateSchedules validates the limit_rate and rate_schedule of each
+// route.
+func CheckRateSchedules(site *models.Site) error {
+	for _, r := range site.Routes {
+		if r.LimitRate != "" && !rateValue.MatchString(r.LimitRate) {
+			return fmt.Errorf("routes: %s: limit_rate must be a size like 500k or 2m, got %q", r.Path, r.LimitRate)
+		}
+		for i, w := range r.RateSchedule {
+			if !rateValue.MatchString(w.Rate) {
+				return fmt.Errorf("routes: %s: rate_schedule[%d]: rate must be a size like 500k or 2m (0 is unlimited), got %q", r.Path, i, w.Rate)
+			}
+			from, okFrom := clockMinutes(w.From)
+			to, okTo := clockMinutes(w.To)
+			if !okFrom || !okTo {
+				return fmt.Errorf("routes: %s: rate_schedule[%d]: from and to must be HH:MM times", r.Path, i)
+			}
+			if from == to {
+				return fmt.Errorf("routes: %s: rate_schedule[%d]: from and to must differ", r.Path, i)
+			}
+			for _, d := range w.Days {
+				if _, ok := weekdays[strings.ToLower(d)]; !ok {
+					return fmt.Errorf("routes: %s: rate_schedule[%d]: unknown day %q (use mon, tue, ... sun)", r.Path, i, d)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// clockMinutes parses "HH:MM" into minutes after midnight.
+func clockMinutes(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// activeRate is the limit_rate of a route at t: the rate of the first
+// schedule window t falls in, or the route's own. A window whose to is
+// earlier than its from runs past midnight and belongs to the day it
+// starts on.
+func activeRate(r models.RouteOverride, t time.Time) string {
+	now := t.Hour()*60 + t.Minute()
+	for _, w := range r.RateSchedule {
+		from, _ := clockMinutes(w.From)
+		to, _ := clockMinutes(w.To)
+		day := t.Weekday()
+		switch {
+		case from < to && now >= from && now < to:
+		case from > to && now >= from:
+		case from > to && now < to:
+			day = (day + 6) % 7 // Started the day before
+		default:
+			continue
+		}
+		if onDay(w.Days, day) {
+			return w.Rate
+		}
+	}
+	return r.LimitRate
+}
+
+func onDay(days []string, d time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, name := range days {
+		if weekdays[strings.ToLower(name)] == d {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRateSchedule reports whether any route's rate changes over time.
+func HasRateSchedule(site *models.Site) bool {
+	for _, r := range site.Routes {
+		if len(r.RateSchedule) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RatesChanged reports whether some route of the site has another
+// limit_rate at t than at prev, so its config needs rendering again.
+func RatesChanged(site *models.Site, prev, t time.Time) bool {
+	for _, r := range site.Routes {
+		if len(r.RateSchedule) > 0 && activeRate(r, prev) != activeRate(r, t) {
+			return true
+		}
+	}
+	return false
+}
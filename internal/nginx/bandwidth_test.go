@@ -0,0 +1,66 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestRateSchedule(t *testing.T) {
+	route := models.RouteOverride{Path: "/downloads/", LimitRate: "2m", RateSchedule: []models.RateWindow{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "17:00", Rate: "200k"},
+		{Days: []string{"fri"}, From: "22:00", To: "06:00", Rate: "0"},
+	}}
+	// 2026-10-12 is a Monday.
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2026, 10, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+	for _, tc := range []struct {
+		t    time.Time
+		want string
+	}{
+		{at(12, "08:59"), "2m"},
+		{at(12, "09:00"), "200k"},
+		{at(16, "16:59"), "200k"},
+		{at(16, "17:00"), "2m"},
+		{at(16, "23:00"), "0"},
+		{at(17, "05:59"), "0"}, // Friday's window, on Saturday morning
+		{at(17, "06:00"), "2m"},
+		{at(17, "10:00"), "2m"},
+		{at(18, "23:00"), "2m"},
+	} {
+		if got := activeRate(route, tc.t); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.t.Format("Mon 15:04"), tc.want, got)
+		}
+	}
+
+	site := &models.Site{ID: "files.local", Domain: "files.local", Upstreams: []string{"files:80"}, Routes: []models.RouteOverride{route}}
+	if !RatesChanged(site, at(12, "08:59"), at(12, "09:00")) || RatesChanged(site, at(12, "09:00"), at(12, "09:01")) {
+		t.Error("Expected a change only at the window boundary")
+	}
+
+	defer func() { renderTime = time.Now }()
+	renderTime = func() time.Time { return at(12, "10:00") }
+	config, err := NewManager(t.TempDir()).Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "location /downloads/ {") || !strings.Contains(string(config), "limit_rate 200k;") {
+		t.Errorf("Expected the business hours rate:\n%s", config)
+	}
+
+	for _, bad := range []models.RateWindow{
+		{From: "09:00", To: "17:00", Rate: "fast"},
+		{From: "9am", To: "17:00", Rate: "1m"},
+		{From: "09:00", To: "09:00", Rate: "1m"},
+		{Days: []string{"monday"}, From: "09:00", To: "17:00", Rate: "1m"},
+	} {
+		site.Routes[0].RateSchedule = []models.RateWindow{bad}
+		if err := CheckRateSchedules(site); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultClientMaxBodySize is the request body limit of sites without
+// their own. nginx's own default of 1m rejects most file uploads.
+const DefaultClientMaxBodySize = "100m"
+
+var bodySize = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// bodyBuffering is a site's request body limit and buffering, ready to
+// render. Empty buffering fields keep nginx's default (on).
+type bodyBuffering struct {
+	MaxSize          string
+	RequestBuffering string // proxy_request_buffering
+	Buffering        string // proxy_buffering
+}
+
+// CheckBodySize validates a client_max_body_size value; "0" turns the
+// limit off.
+func CheckBodySize(size string) error {
+	if size != "" && !bodySize.MatchString(size) {
+		return fmt.Errorf("client_max_body_size must be a size like 100m or 0 for no limit, got %q", size)
+	}
+	return nil
+}
+
+// resolveBody renders a site's body settings, falling back to def for the
+// size.
+func resolveBody(site *models.Site, def string) bodyBuffering {
+	b := bodyBuffering{
+		MaxSize:          site.ClientMaxBodySize,
+		RequestBuffering: onOff(site.ProxyRequestBuffering),
+		Buffering:        onOff(site.ProxyBuffering),
+	}
+	if b.MaxSize == "" {
+		b.MaxSize = def
+	}
+	return b
+}
+
+// onOff renders an optional flag; nil is empty.
+func onOff(v *bool) string {
+	switch {
+	case v == nil:
+		return ""
+	case *v:
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,39 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestBodySize(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{ID: "app.local", Domain: "app.local", Upstreams: []string{"app:80"}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "client_max_body_size 100m;") || strings.Contains(string(config), "proxy_buffering") {
+		t.Errorf("Expected only the default body size:\n%s", config)
+	}
+
+	off, on := false, true
+	site.ClientMaxBodySize = "2g"
+	site.ProxyRequestBuffering = &off
+	site.ProxyBuffering = &on
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"client_max_body_size 2g;", "proxy_request_buffering off;", "proxy_buffering on;"} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("Expected %q in config:\n%s", want, config)
+		}
+	}
+
+	site.ClientMaxBodySize = "lots"
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected a bad body size to be rejected")
+	}
+}
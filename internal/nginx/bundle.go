@@ -0,0 +1,170 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigBundle is every live site and stream config, as shipped from a
+// control plane to node agents. Files are keyed by base name.
+type ConfigBundle struct {
+	Version string            `json:"version"`
+	Sites   map[string]string `json:"sites"`
+	Streams map[string]string `json:"streams"`
+}
+
+// Bundle snapshots the live configs in SitesDir and StreamsDir.
+func (m *Manager) Bundle() (*ConfigBundle, error) {
+	b := &ConfigBundle{}
+	var err error
+	if b.Sites, err = readConfigs(m.SitesDir); err != nil {
+		return nil, err
+	}
+	if b.Streams, err = readConfigs(m.StreamsDir); err != nil {
+		return nil, err
+	}
+	b.Version = b.hash()
+	return b, nil
+}
+
+// hash is a digest of the bundle's files, so agents can tell whether they
+// already run it.
+func (b *ConfigBundle) hash() string {
+	h := sha256.New()
+	for _, set := range []map[string]string{b.Sites, b.Streams} {
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(h, "%s\x00%d\x00%s", name, len(set[name]), set[name])
+		}
+		h.Write([]byte{0xff})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func readConfigs(dir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		configs[filepath.Base(f)] = string(data)
+	}
+	return configs, nil
+}
+
+// ApplyBundle makes the local site and stream configs match b and reloads
+// nginx once. If the reload fails every file is put back as it was and
+// nginx reloaded again, as installConfig does for a single file.
+func (m *Manager) ApplyBundle(b *ConfigBundle) error {
+	if got := b.hash(); got != b.Version {
+		return fmt.Errorf("bundle version %s does not match its content (%s)", b.Version, got)
+	}
+	sites, err := readConfigs(m.SitesDir)
+	if err != nil {
+		return err
+	}
+	streams, err := readConfigs(m.StreamsDir)
+	if err != nil {
+		return err
+	}
+
+	var undo []func() error
+	rollback := func() error {
+		var first error
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	syncDir := func(dir string, want, have map[string]string) error {
+		for name, content := range want {
+			if err := checkBundleName(name); err != nil {
+				return err
+			}
+			old, existed := have[name]
+			if existed && old == content {
+				continue
+			}
+			target := filepath.Join(dir, name)
+			if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+				return err
+			}
+			undo = append(undo, restoreFile(target, old, existed))
+		}
+		for name, old := range have {
+			if _, ok := want[name]; ok {
+				continue
+			}
+			target := filepath.Join(dir, name)
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			undo = append(undo, restoreFile(target, old, true))
+		}
+		return nil
+	}
+
+	if err := syncDir(m.SitesDir, b.Sites, sites); err != nil {
+		rollback()
+		return err
+	}
+	if err := syncDir(m.StreamsDir, b.Streams, streams); err != nil {
+		rollback()
+		return err
+	}
+	if len(undo) == 0 {
+		return nil
+	}
+	slog.Info("Applying config bundle", "version", b.Version, "changed_files", len(undo))
+
+	reloadErr := m.Reload()
+	if reloadErr == nil {
+		return nil
+	}
+	slog.Warn("Reload failed, restoring previous configs", "version", b.Version)
+	rerr := &ReloadError{Err: reloadErr, RollbackErr: rollback()}
+	if rerr.RollbackErr == nil {
+		rerr.RollbackErr = m.Reload()
+	}
+	if rerr.RollbackErr != nil {
+		slog.Error("Rollback failed, nginx may be serving a stale config", "version", b.Version, "error", rerr.RollbackErr)
+	}
+	return rerr
+}
+
+// checkBundleName keeps bundle files inside the config directories.
+func checkBundleName(name string) error {
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".conf") {
+		return fmt.Errorf("invalid config file name %q in bundle", name)
+	}
+	return nil
+}
+
+func restoreFile(target, content string, existed bool) func() error {
+	return func() error {
+		if !existed {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		return os.WriteFile(target, []byte(content), 0644)
+	}
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	src := NewManager(t.TempDir())
+	if err := src.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(src.SiteConfigFile("a.local"), []byte("server { server_name a.local; }\n"), 0644)
+	os.WriteFile(src.StreamConfigFile(5432), []byte("server { listen 5432; }\n"), 0644)
+	os.WriteFile(PreviousConfigFile(src.SiteConfigFile("a.local")), []byte("old"), 0644)
+
+	b, err := src.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Sites) != 1 || len(b.Streams) != 1 {
+		t.Fatalf("Expected one site and one stream config (no .prev), got %+v", b)
+	}
+
+	dst := NewManager(t.TempDir())
+	if err := dst.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	stale := dst.SiteConfigFile("gone.local")
+	os.WriteFile(stale, []byte("server {}\n"), 0644)
+	if err := dst.ApplyBundle(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected a config missing from the bundle to be removed")
+	}
+	got, err := dst.Bundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != b.Version {
+		t.Errorf("Expected the applied configs to have version %s, got %s", b.Version, got.Version)
+	}
+
+	// Tampered content and names outside the config dirs are refused.
+	b.Sites["a.local.conf"] = "server {}"
+	if err := dst.ApplyBundle(b); err == nil {
+		t.Errorf("Expected a bundle whose content does not match its version to be rejected")
+	}
+	evil := &ConfigBundle{Sites: map[string]string{"../nginx.conf": "x"}}
+	evil.Version = evil.hash()
+	if err := dst.ApplyBundle(evil); err == nil {
+		t.Errorf("Expected a path outside the sites dir to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dst.SitesDir), "nginx.conf")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written outside the sites dir")
+	}
+	if _, err := os.Stat(dst.SiteConfigFile("a.local")); err != nil {
+		t.Errorf("Expected a rejected bundle to leave the applied configs in place: %v", err)
+	}
+}
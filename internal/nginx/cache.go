@@ -0,0 +1,198 @@
+package nginx
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultCacheRoot holds the cache directory of each site with caching.
+const DefaultCacheRoot = "/var/cache/nginx/hubfly"
+
+// defaultCacheZone is the key zone size of caches without zone_size.
+const defaultCacheZone = "10m"
+
+var (
+	cacheSize     = regexp.MustCompile(`^[0-9]+[kKmM]$`)
+	cacheTTL      = regexp.MustCompile(`^[0-9]+[smhd]$`)
+	cacheStatus   = regexp.MustCompile(`^[1-5][0-9][0-9]$`)
+	cacheVariable = regexp.MustCompile(`^\$[A-Za-z0-9_]+$`)
+	cookieName    = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// proxyCache is a site's cache, ready to render.
+type proxyCache struct {
+	Path   string
+	Zone   string // keys_zone name
+	Size   string
+	Key    string
+	Valid  []string // proxy_cache_valid arguments, e.g. "200 301 10m"
+	Bypass string   // $cookie_ variables, space separated
+}
+
+// CheckCache validates a site's cache settings. gRPC responses can't be
+// cached.
+func CheckCache(site *models.Site) error {
+	c := site.Cache
+	if c == nil {
+		return nil
+	}
+	if c.ZoneSize != "" && !cacheSize.MatchString(c.ZoneSize) {
+		return fmt.Errorf("cache: zone_size must be a size like 10m, got %q", c.ZoneSize)
+	}
+	for status, ttl := range c.TTLByStatus {
+		if status != "any" && !cacheStatus.MatchString(status) {
+			return fmt.Errorf("cache: ttl_by_status keys must be status codes or \"any\", got %q", status)
+		}
+		if !cacheTTL.MatchString(ttl) {
+			return fmt.Errorf("cache: ttl_by_status %s: must be a duration like 30s, 10m or 1h, got %q", status, ttl)
+		}
+	}
+	for _, v := range c.KeyExtras {
+		if !cacheVariable.MatchString(v) {
+			return fmt.Errorf("cache: key_extras must be nginx variables like $http_accept_language, got %q", v)
+		}
+	}
+	for _, name := range c.BypassCookies {
+		if !cookieName.MatchString(name) {
+			return fmt.Errorf("cache: bypass cookie %q must be letters, digits and underscores", name)
+		}
+	}
+	if c.Enabled && isGRPC(site.Protocol) {
+		return fmt.Errorf("cache is not supported for gRPC sites")
+	}
+	return nil
+}
+
+// CacheDir is where the site's cached responses are stored.
+func (m *Manager) CacheDir(siteID string) string {
+	return filepath.Join(m.CacheRoot, siteID)
+}
+
+// resolveCache renders a site's cache settings. The key starts with
+// scheme://host and the request URI, which PurgeCache matches on; extras
+// follow after a "|" each.
+func (m *Manager) resolveCache(site *models.Site) *proxyCache {
+	c := site.Cache
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	pc := &proxyCache{
+		Path: m.CacheDir(site.ID),
+		Zone: "hubfly_cache_" + ident(site.ID),
+		Size: c.ZoneSize,
+		Key:  "$scheme://$host$request_uri",
+	}
+	if pc.Size == "" {
+		pc.Size = defaultCacheZone
+	}
+	for _, v := range c.KeyExtras {
+		pc.Key += "|" + v
+	}
+
+	// Group statuses sharing a TTL into one directive; "any" goes last, as
+	// nginx matches the first directive naming a status.
+	byTTL := map[string][]string{}
+	for status, ttl := range c.TTLByStatus {
+		if status != "any" {
+			byTTL[ttl] = append(byTTL[ttl], status)
+		}
+	}
+	for ttl, statuses := range byTTL {
+		sort.Strings(statuses)
+		pc.Valid = append(pc.Valid, strings.Join(statuses, " ")+" "+ttl)
+	}
+	sort.Strings(pc.Valid)
+	if ttl, ok := c.TTLByStatus["any"]; ok {
+		pc.Valid = append(pc.Valid, "any "+ttl)
+	}
+
+	var bypass []string
+	for _, name := range c.BypassCookies {
+		bypass = append(bypass, "$cookie_"+name)
+	}
+	pc.Bypass = strings.Join(bypass, " ")
+	return pc
+}
+
+// PurgeCache deletes cached responses of a site: those whose request URI
+// is one of paths (a trailing "*" matches a prefix), or all of them when
+// paths is empty. nginx fetches a deleted entry from the upstream on the
+// next request. It returns the number of entries removed.
+func (m *Manager) PurgeCache(siteID string, paths []string) (int, error) {
+	dir := m.CacheDir(siteID)
+	purged := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir // Nothing cached yet
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if len(paths) > 0 {
+			uri, ok := cachedURI(path)
+			if !ok || !matchesPurge(uri, paths) {
+				return nil
+			}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		purged++
+		return nil
+	})
+	return purged, err
+}
+
+// cachedURI reads the request URI from the "KEY: " line nginx writes in
+// the header of every cache file.
+func cachedURI(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 4096), 64<<10)
+	for i := 0; i < 8 && sc.Scan(); i++ { // The binary header may hold newlines
+		_, key, ok := strings.Cut(sc.Text(), "KEY: ")
+		if !ok {
+			continue
+		}
+		// scheme://host/uri|extra...
+		_, rest, ok := strings.Cut(key, "://")
+		if !ok {
+			return "", false
+		}
+		slash := strings.IndexByte(rest, '/')
+		if slash < 0 {
+			return "", false
+		}
+		uri, _, _ := strings.Cut(rest[slash:], "|")
+		return uri, true
+	}
+	return "", false
+}
+
+func matchesPurge(uri string, paths []string) bool {
+	for _, p := range paths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(uri, prefix) {
+				return true
+			}
+		} else if uri == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestProxyCache(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	mgr.CacheRoot = t.TempDir()
+	site := &models.Site{ID: "shop.local", Domain: "shop.local", Upstreams: []string{"shop:80"}, Cache: &models.Cache{
+		Enabled:       true,
+		TTLByStatus:   map[string]string{"200": "10m", "301": "10m", "404": "1m", "any": "30s"},
+		KeyExtras:     []string{"$http_accept_language"},
+		BypassCookies: []string{"session"},
+	}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"proxy_cache_path " + mgr.CacheRoot + "/shop.local levels=1:2 keys_zone=hubfly_cache_shop_local_6de78b6f:10m inactive=60m use_temp_path=off;",
+		"proxy_cache hubfly_cache_shop_local_6de78b6f;",
+		`proxy_cache_key "$scheme://$host$request_uri|$http_accept_language";`,
+		"proxy_cache_valid 200 301 10m;\n        proxy_cache_valid 404 1m;\n        proxy_cache_valid any 30s;",
+		"proxy_cache_bypass $cookie_session;\n        proxy_no_cache $cookie_session;",
+		"add_header X-Cache-Status $upstream_cache_status always;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	site.Cache.Enabled = false
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "proxy_cache") {
+		t.Errorf("Expected no cache when disabled:\n%s", config)
+	}
+
+	for _, bad := range []*models.Cache{
+		{Enabled: true, ZoneSize: "lots"},
+		{Enabled: true, TTLByStatus: map[string]string{"ok": "1m"}},
+		{Enabled: true, TTLByStatus: map[string]string{"200": "forever"}},
+		{Enabled: true, KeyExtras: []string{"$http_x; drop"}},
+		{Enabled: true, BypassCookies: []string{"a b"}},
+	} {
+		if err := CheckCache(&models.Site{Cache: bad}); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+	if err := CheckCache(&models.Site{Protocol: ProtocolGRPC, Cache: &models.Cache{Enabled: true}}); err == nil {
+		t.Error("Expected caching a gRPC site to be rejected")
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	mgr.CacheRoot = t.TempDir()
+	if n, err := mgr.PurgeCache("shop.local", nil); err != nil || n != 0 {
+		t.Fatalf("Expected nothing to purge before caching, got %d, %v", n, err)
+	}
+
+	dir := mgr.CacheDir("shop.local")
+	entry := func(name, key string) {
+		path := filepath.Join(dir, name[len(name)-1:], name[len(name)-3:len(name)-1], name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("\x05\x00\n\x00\x00binary\nKEY: "+key+"\nHTTP/1.1 200 OK\r\n\r\nbody"), 0644)
+	}
+	entry("0a1b2c3d4e5f60718293a4b5c6d7e8f1", "https://shop.local/img/logo.png")
+	entry("1a1b2c3d4e5f60718293a4b5c6d7e8f2", "https://shop.local/img/hero.jpg|en")
+	entry("2a1b2c3d4e5f60718293a4b5c6d7e8f3", "https://shop.local/cart")
+
+	n, err := mgr.PurgeCache("shop.local", []string{"/img/*"})
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 purged under /img/, got %d, %v", n, err)
+	}
+	n, _ = mgr.PurgeCache("shop.local", []string{"/cart?x=1"})
+	if n != 0 {
+		t.Errorf("Expected an exact path to match exactly, purged %d", n)
+	}
+	n, _ = mgr.PurgeCache("shop.local", nil)
+	if n != 1 {
+		t.Errorf("Expected the rest to be purged, got %d", n)
+	}
+}
@@ -0,0 +1,168 @@
+package nginx
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultCanaryAddr is nginx's plain HTTP listener, which serves every
+// site.
+const DefaultCanaryAddr = "127.0.0.1:80"
+
+// canaryWait is how long a canary keeps retrying while nginx's new
+// workers take over after a reload.
+var canaryWait = 3 * time.Second
+
+// CheckCanary validates a site's canary settings.
+func CheckCanary(c *models.CanaryCheck) error {
+	if c == nil {
+		return nil
+	}
+	if c.Path != "" && (!strings.HasPrefix(c.Path, "/") || strings.ContainsAny(c.Path, " \t\r\n#")) {
+		return fmt.Errorf("canary: path %q must start with / and contain no spaces", c.Path)
+	}
+	if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+		return fmt.Errorf("canary: expect_status %d is not an HTTP status code", c.ExpectStatus)
+	}
+	if strings.ContainsAny(c.ExpectLocation, "\r\n") {
+		return fmt.Errorf("canary: expect_location must be a single line")
+	}
+	return nil
+}
+
+// CanaryError is a config that went live but whose canary request did
+// not get the expected answer. By the time it is returned the previous
+// config has been put back.
+type CanaryError struct {
+	Err         error // What was sent, and the response observed
+	RollbackErr error // Set when restoring or reloading the old config failed too
+}
+
+func (e *CanaryError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%v; rollback failed: %v", e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("%v; previous config restored", e.Err)
+}
+
+func (e *CanaryError) Unwrap() error { return e.Err }
+
+// canaryHost is the name the canary asks for: the first of the site's
+// names nginx matches literally. Sites with only wildcard or regex names
+// have none and are not checked.
+func canaryHost(site *models.Site) string {
+	for _, name := range append([]string{site.Domain}, site.Aliases...) {
+		if name != "" && !IsWildcardServerName(name) && !IsRegexServerName(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Canary sends a request for the site through nginx and checks the
+// answer against the site's canary settings. It is skipped when
+// CanaryAddr is empty or nginx isn't installed (as reloads are).
+func (m *Manager) Canary(site *models.Site) error {
+	c := site.Canary
+	if c == nil {
+		c = &models.CanaryCheck{}
+	}
+	host := canaryHost(site)
+	if m.CanaryAddr == "" || c.Disabled || host == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("nginx"); err != nil {
+		return nil
+	}
+
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	status, location := c.ExpectStatus, c.ExpectLocation
+	if status == 0 && location == "" && site.SSL && site.ForceSSL {
+		status, location = http.StatusMovedPermanently, "https://"+host+path
+	}
+	expected := "any status but 500"
+	if status != 0 {
+		expected = fmt.Sprintf("status %d", status)
+	}
+	if location != "" {
+		expected += " with Location " + location + "*"
+	}
+
+	client := &http.Client{
+		Timeout: time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var resp canaryResponse
+	deadline := time.Now().Add(canaryWait)
+	for {
+		resp = m.canaryRequest(client, host, path)
+		if resp.matches(status, location) {
+			slog.Debug("Canary passed", "site_id", site.ID, "host", host, "path", path, "response", resp)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	slog.Warn("Canary failed", "site_id", site.ID, "host", host, "path", path, "response", resp, "expected", expected)
+	return fmt.Errorf("canary GET http://%s%s: got %s, expected %s", host, path, resp, expected)
+}
+
+// canaryResponse is what a canary request got back.
+type canaryResponse struct {
+	Status   int
+	Location string
+	Err      error
+}
+
+func (r canaryResponse) String() string {
+	switch {
+	case r.Err != nil:
+		return r.Err.Error()
+	case r.Location != "":
+		return fmt.Sprintf("%d with Location %s", r.Status, r.Location)
+	default:
+		return fmt.Sprint(r.Status)
+	}
+}
+
+// matches reports whether the response has the status (any but 500 when
+// zero) and a Location starting with location.
+func (r canaryResponse) matches(status int, location string) bool {
+	if r.Err != nil {
+		return false
+	}
+	if status == 0 && r.Status == http.StatusInternalServerError || status != 0 && r.Status != status {
+		return false
+	}
+	return strings.HasPrefix(r.Location, location)
+}
+
+func (m *Manager) canaryRequest(client *http.Client, host, path string) canaryResponse {
+	req, err := http.NewRequest(http.MethodGet, "http://"+m.CanaryAddr+path, nil)
+	if err != nil {
+		return canaryResponse{Err: err}
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", "hubfly-canary")
+	resp, err := client.Do(req)
+	if err != nil {
+		return canaryResponse{Err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return canaryResponse{Status: resp.StatusCode, Location: resp.Header.Get("Location")}
+}
@@ -0,0 +1,104 @@
+package nginx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestCanary(t *testing.T) {
+	tmpDir := t.TempDir()
+	bin := filepath.Join(tmpDir, "bin")
+	os.Mkdir(bin, 0755)
+	os.WriteFile(filepath.Join(bin, "nginx"), []byte("#!/bin/sh\nexit 0\n"), 0755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer func(d time.Duration) { canaryWait = d }(canaryWait)
+	canaryWait = 0
+
+	// Stands in for nginx: the live config file decides the answer.
+	mgr := NewManager(tmpDir)
+	mgr.EnsureDirs()
+	live := mgr.SiteConfigFile("a.local")
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		data, _ := os.ReadFile(live)
+		switch strings.TrimSpace(string(data)) {
+		case "redirect":
+			http.Redirect(w, r, "https://"+r.Host+r.URL.Path, http.StatusMovedPermanently)
+		case "broken":
+			w.WriteHeader(500)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	mgr.CanaryAddr = strings.TrimPrefix(srv.URL, "http://")
+
+	site := &models.Site{ID: "a.local", Domain: "*.a.local", Aliases: []string{"a.local"}}
+	apply := func(content string) error {
+		staging := filepath.Join(mgr.StagingDir, "a.local.conf")
+		os.WriteFile(staging, []byte(content+"\n"), 0644)
+		return mgr.ApplyVerified(site.ID, staging, func() error { return mgr.Canary(site) })
+	}
+
+	// A 404 is fine by default; the literal alias is what gets asked for.
+	if err := apply("ok"); err != nil {
+		t.Fatalf("Canary should pass: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0] != "a.local" {
+		t.Errorf("Canary hosts = %v, want [a.local]", hosts)
+	}
+
+	// A 500 is rolled back and reported.
+	err := apply("broken")
+	var cerr *CanaryError
+	if !errors.As(err, &cerr) || cerr.RollbackErr != nil || !strings.Contains(err.Error(), "got 500") {
+		t.Fatalf("Expected a rolled back CanaryError, got %v", err)
+	}
+	if data, _ := os.ReadFile(live); string(data) != "ok\n" {
+		t.Errorf("Live config = %q, want the previous one restored", data)
+	}
+
+	// force_ssl expects the HTTPS redirect.
+	site.SSL, site.ForceSSL = true, true
+	if err := apply("ok"); err == nil || !strings.Contains(err.Error(), "expected status 301 with Location https://a.local/") {
+		t.Errorf("Expected the missing redirect to fail, got %v", err)
+	}
+	if err := apply("redirect"); err != nil {
+		t.Errorf("Redirect should pass: %v", err)
+	}
+
+	// Explicit expectations replace the defaults.
+	site.Canary = &models.CanaryCheck{Path: "/health", ExpectStatus: 404}
+	if err := apply("ok"); err != nil {
+		t.Errorf("Expected 404 should pass: %v", err)
+	}
+	site.Canary.Disabled = true
+	if err := apply("broken"); err != nil {
+		t.Errorf("Disabled canary should not run: %v", err)
+	}
+}
+
+func TestCheckCanary(t *testing.T) {
+	for _, c := range []*models.CanaryCheck{
+		{Path: "health"},
+		{Path: "/a b"},
+		{ExpectStatus: 99},
+		{ExpectLocation: "https://a\r\nX: y"},
+	} {
+		if CheckCanary(c) == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+	}
+	if err := CheckCanary(&models.CanaryCheck{Path: "/health", ExpectStatus: 200}); err != nil {
+		t.Errorf("Valid canary rejected: %v", err)
+	}
+}
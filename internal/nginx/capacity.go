@@ -0,0 +1,35 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// checkCapacity validates a site's capacity limits. Shed statuses that
+// already have a Hubfly error page are refused so the two don't fight.
+func checkCapacity(c *models.Capacity) error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxConcurrent < 0 || c.Rate < 0 || c.Queue < 0 || c.RetryAfter < 0 {
+		return fmt.Errorf("capacity: values must not be negative")
+	}
+	if c.MaxConcurrent == 0 && c.Rate == 0 {
+		return fmt.Errorf("capacity: set max_concurrent, rate or both")
+	}
+	if c.Queue > 0 && c.Rate == 0 {
+		return fmt.Errorf("capacity: queue requires rate")
+	}
+	switch status := c.Status(); {
+	case status < 400 || status > 599:
+		return fmt.Errorf("capacity: shed_status %d must be between 400 and 599", status)
+	case status == 403 || status == 502 || status == 504:
+		return fmt.Errorf("capacity: shed_status %d is used by Hubfly's error pages", status)
+	}
+	if strings.ContainsAny(c.ShedContentType, " \t\n;{}\"'$#") {
+		return fmt.Errorf("capacity: invalid shed_content_type %q", c.ShedContentType)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// maxCaptureHeaders caps the extra headers a capture records.
+const maxCaptureHeaders = 32
+
+// Headers every capture records. Cookie, Authorization and Set-Cookie are
+// left out: they carry credentials and need to be asked for by name.
+var (
+	captureRequestHeaders = []string{
+		"accept", "accept-encoding", "accept-language", "cache-control", "content-length", "content-type",
+		"if-modified-since", "if-none-match", "origin", "range", "referer", "user-agent",
+		"x-forwarded-for", "x-forwarded-proto", "x-request-id",
+	}
+	captureResponseHeaders = []string{
+		"cache-control", "content-encoding", "content-length", "content-type", "etag", "expires",
+		"last-modified", "location", "vary", "x-cache-status",
+	}
+)
+
+// trafficCapture is a site's active capture, ready to render.
+type trafficCapture struct {
+	Format string // log_format, http context
+	Sample string // Percent of requests recorded; empty records all
+}
+
+// CheckCapture validates a traffic capture.
+func CheckCapture(c *models.Capture) error {
+	if c == nil {
+		return nil
+	}
+	if err := checkSampleRate("capture", c.SampleRate); err != nil {
+		return err
+	}
+	if len(c.Headers) > maxCaptureHeaders {
+		return fmt.Errorf("capture: at most %d headers, got %d", maxCaptureHeaders, len(c.Headers))
+	}
+	for _, h := range c.Headers {
+		if !headerNameRegex.MatchString(h) {
+			return fmt.Errorf("capture: invalid header name %q", h)
+		}
+	}
+	return nil
+}
+
+// resolveCapture renders a site's capture while it is active at now. Each
+// line is a JSON object with the request line, timings, sizes and the
+// request and response headers as "request_headers" and
+// "response_headers".
+func resolveCapture(site *models.Site, now time.Time) *trafficCapture {
+	c := site.Capture
+	if !c.Active(now) {
+		return nil
+	}
+	request := append([]string(nil), captureRequestHeaders...)
+	response := append([]string(nil), captureResponseHeaders...)
+	for _, h := range c.Headers {
+		request = appendHeader(request, strings.ToLower(h))
+		response = appendHeader(response, strings.ToLower(h))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `log_format hubfly_capture_%s escape=json '{`, ident(site.ID))
+	b.WriteString(`"time":"$time_iso8601","msec":"$msec","request_id":"$request_id",`)
+	b.WriteString(`"remote_addr":"$remote_addr","method":"$request_method","scheme":"$scheme","host":"$host","uri":"$request_uri","protocol":"$server_protocol",`)
+	b.WriteString(`"status":"$status","request_length":"$request_length","bytes_sent":"$bytes_sent","body_bytes_sent":"$body_bytes_sent","request_time":"$request_time",`)
+	b.WriteString(`"upstream_addr":"$upstream_addr","upstream_status":"$upstream_status","upstream_connect_time":"$upstream_connect_time","upstream_header_time":"$upstream_header_time","upstream_response_time":"$upstream_response_time",`)
+	b.WriteString(`"ssl_protocol":"$ssl_protocol",`)
+	b.WriteString(`"request_headers":{` + headerFields("$http_", request) + `},`)
+	b.WriteString(`"response_headers":{` + headerFields("$sent_http_", response) + `}`)
+	if c.RequestBodies {
+		b.WriteString(`,"request_body":"$request_body"`)
+	}
+	b.WriteString(`}';`)
+	return &trafficCapture{Format: b.String(), Sample: samplePercent(c.SampleRate)}
+}
+
+func appendHeader(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// headerFields renders "name":"$prefix_name" pairs for a log_format.
+func headerFields(prefix string, names []string) string {
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = fmt.Sprintf(`"%s":"%s%s"`, name, prefix, strings.ReplaceAll(name, "-", "_"))
+	}
+	return strings.Join(fields, ",")
+}
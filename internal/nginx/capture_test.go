@@ -0,0 +1,70 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestCapture(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	now := time.Now()
+	site := &models.Site{
+		ID: "shop.local", Domain: "shop.local", Upstreams: []string{"shop:80"}, SSL: true,
+		Capture: &models.Capture{SampleRate: 0.25, Headers: []string{"Cookie", "User-Agent"}, StartedAt: now, ExpiresAt: now.Add(10 * time.Minute)},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		`log_format hubfly_capture_shop_local_6de78b6f escape=json '{"time":"$time_iso8601","msec":"$msec",`,
+		`"request_headers":{"accept":"$http_accept",`,
+		`"user-agent":"$http_user_agent","x-forwarded-for":"$http_x_forwarded_for","x-forwarded-proto":"$http_x_forwarded_proto","x-request-id":"$http_x_request_id","cookie":"$http_cookie"}`,
+		`"x-cache-status":"$sent_http_x_cache_status","cookie":"$sent_http_cookie","user-agent":"$sent_http_user_agent"}}';`,
+		"split_clients \"${request_id}\" $capture_sample_shop_local_6de78b6f {\n    25% 1;\n    * \"\";\n}",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	access := "access_log /var/log/hubfly/shop.local.capture.log hubfly_capture_shop_local_6de78b6f if=$capture_sample_shop_local_6de78b6f;"
+	if n := strings.Count(cfg, access); n != 2 {
+		t.Errorf("Expected the capture log in both servers, got %d", n)
+	}
+	if strings.Contains(cfg, "$request_body") {
+		t.Errorf("Expected no request bodies by default")
+	}
+
+	site.Capture.SampleRate = 0
+	site.Capture.RequestBodies = true
+	config, _ = mgr.Render(site)
+	cfg = string(config)
+	if strings.Contains(cfg, "capture_sample") || !strings.Contains(cfg, "access_log /var/log/hubfly/shop.local.capture.log hubfly_capture_shop_local_6de78b6f;") {
+		t.Errorf("Expected every request to be captured:\n%s", cfg)
+	}
+	if !strings.Contains(cfg, `,"request_body":"$request_body"}';`) {
+		t.Errorf("Expected request bodies to be captured:\n%s", cfg)
+	}
+
+	// An expired capture is no longer rendered.
+	site.Capture.ExpiresAt = now.Add(-time.Minute)
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "capture") {
+		t.Errorf("Expected no capture after expiry:\n%s", config)
+	}
+
+	for _, c := range []*models.Capture{
+		{SampleRate: 1.5},
+		{SampleRate: 0.00001},
+		{Headers: []string{"X-Bad Header"}},
+		{Headers: []string{"a'b"}},
+	} {
+		if CheckCapture(c) == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+	}
+}
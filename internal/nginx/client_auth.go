@@ -0,0 +1,61 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Headers that tell the upstream who the client certificate belongs to.
+// They are set on every request, so clients can't send their own.
+var clientCertHeaders = map[string]string{
+	"X-SSL-Client-S-DN":   "$ssl_client_s_dn",
+	"X-SSL-Client-Verify": "$ssl_client_verify",
+}
+
+// clientAuth is a site's client certificate verification, ready to render.
+type clientAuth struct {
+	CA      string
+	Verify  string            // ssl_verify_client: "on" or "optional"
+	Headers map[string]string // Forwarded unless ProxySetHeaders sets them
+}
+
+// CheckClientAuth validates a site's client certificate authentication.
+func CheckClientAuth(site *models.Site) error {
+	c := site.ClientAuth
+	if c == nil {
+		return nil
+	}
+	if !site.SSL {
+		return fmt.Errorf("client_auth: needs ssl")
+	}
+	if !pemPath.MatchString(c.CAPath) {
+		return fmt.Errorf("client_auth: ca_path must be an absolute file path, got %q", c.CAPath)
+	}
+	// Port 80 can't ask for a certificate, so it must not proxy.
+	if !c.Optional && !site.ForceSSL {
+		return fmt.Errorf("client_auth: needs force_ssl, or plain HTTP requests would skip the certificate check")
+	}
+	return nil
+}
+
+func resolveClientAuth(site *models.Site) *clientAuth {
+	c := site.ClientAuth
+	if c == nil || !site.SSL {
+		return nil
+	}
+	a := &clientAuth{CA: c.CAPath, Verify: "on", Headers: make(map[string]string, len(clientCertHeaders))}
+	if c.Optional {
+		a.Verify = "optional"
+	}
+	for name, value := range clientCertHeaders {
+		a.Headers[name] = value
+		for k := range site.ProxySetHeaders {
+			if strings.EqualFold(k, name) {
+				delete(a.Headers, name)
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestClientAuth(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "admin.local", Domain: "admin.local", Upstreams: []string{"admin:8080"}, SSL: true, ForceSSL: true,
+		ClientAuth: &models.ClientAuth{CAPath: "/etc/hubfly/mtls/clients-ca.pem"},
+		Routes:     []models.RouteOverride{{Path: "/rpc/", Protocol: "grpc"}},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"ssl_client_certificate /etc/hubfly/mtls/clients-ca.pem;",
+		"ssl_verify_client on;",
+		"proxy_set_header X-SSL-Client-S-DN $ssl_client_s_dn;",
+		"proxy_set_header X-SSL-Client-Verify $ssl_client_verify;",
+		"grpc_set_header X-SSL-Client-S-DN $ssl_client_s_dn;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if n := strings.Count(cfg, "ssl_verify_client"); n != 1 {
+		t.Errorf("Expected ssl_verify_client only on the HTTPS server, got %d", n)
+	}
+
+	// Optional verification may serve plain HTTP; a header the site sets
+	// itself wins.
+	site.ForceSSL = false
+	site.Routes = nil
+	site.ClientAuth.Optional = true
+	site.ProxySetHeaders = map[string]string{"x-ssl-client-verify": "$ssl_client_verify_custom"}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = string(config)
+	if !strings.Contains(cfg, "ssl_verify_client optional;") || strings.Contains(cfg, "X-SSL-Client-Verify") {
+		t.Errorf("Expected optional verification without the default verify header:\n%s", cfg)
+	}
+
+	for _, s := range []*models.Site{
+		{ClientAuth: &models.ClientAuth{CAPath: "/etc/ca.pem", Optional: true}},
+		{SSL: true, ForceSSL: true, ClientAuth: &models.ClientAuth{CAPath: "ca.pem"}},
+		{SSL: true, ForceSSL: true, ClientAuth: &models.ClientAuth{CAPath: "/etc/ca.pem; ssl_verify_client off"}},
+		{SSL: true, ClientAuth: &models.ClientAuth{CAPath: "/etc/ca.pem"}},
+	} {
+		if CheckClientAuth(s) == nil {
+			t.Errorf("Expected %+v to be rejected", s.ClientAuth)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package nginx
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultDeployCheckHosts are the loopback addresses certificate
+// deployments are checked on, one per IP family.
+var DefaultDeployCheckHosts = []string{"127.0.0.1", "::1"}
+
+// Ports of the site listeners, as rendered by siteTemplate. Variables so
+// tests can point them elsewhere.
+var (
+	deployHTTPPort  = "80"
+	deployHTTPSPort = "443"
+)
+
+// deployCheckWait is how long a deployment check keeps retrying while
+// nginx's new workers take over after a reload.
+var deployCheckWait = 5 * time.Second
+
+// Deployment probe results.
+const (
+	ProbeOK         = "ok"
+	ProbeMismatch   = "mismatch"    // Another certificate, or no HTTPS redirect
+	ProbeNoListener = "no_listener" // Nothing listens there, e.g. no IPv6 listener
+	ProbeError      = "error"
+)
+
+// DeployProbe is what one listener answered.
+type DeployProbe struct {
+	Address string `json:"address"` // e.g. "[::1]:443"
+	Check   string `json:"check"`   // "certificate" or "redirect"
+	Status  string `json:"status"`  // ok, mismatch, no_listener or error
+	Got     string `json:"got,omitempty"`
+}
+
+// DeployCheck is the result of CheckDeployment.
+type DeployCheck struct {
+	Host      string        `json:"host"`
+	Serial    string        `json:"serial"` // Expected leaf serial, hex
+	CheckedAt time.Time     `json:"checked_at"`
+	OK        bool          `json:"ok"`    // No mismatches or errors
+	Stale     bool          `json:"stale"` // Some listener still serves another certificate
+	Probes    []DeployProbe `json:"probes"`
+}
+
+// CheckDeployment connects to every DeployCheckHosts listener asking for
+// host and checks that the HTTPS listener serves the certificate with
+// serial and, with redirect, that plain HTTP redirects to HTTPS. Failed
+// probes are retried for a few seconds, since a reload does not take
+// effect at once.
+func (m *Manager) CheckDeployment(host, serial string, redirect bool) *DeployCheck {
+	var check *DeployCheck
+	deadline := time.Now().Add(deployCheckWait)
+	for {
+		check = m.probeDeployment(host, serial, redirect)
+		if check.OK || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	if !check.OK {
+		slog.Warn("Certificate deployment check failed", "host", host, "serial", serial, "probes", check.Probes)
+	}
+	return check
+}
+
+func (m *Manager) probeDeployment(host, serial string, redirect bool) *DeployCheck {
+	check := &DeployCheck{Host: host, Serial: serial, CheckedAt: time.Now(), OK: true, Probes: []DeployProbe{}}
+	for _, ip := range m.DeployCheckHosts {
+		p := probeCertificate(net.JoinHostPort(ip, deployHTTPSPort), host, serial)
+		check.Probes = append(check.Probes, p)
+		if redirect {
+			check.Probes = append(check.Probes, probeRedirect(net.JoinHostPort(ip, deployHTTPPort), host))
+		}
+	}
+	for _, p := range check.Probes {
+		if p.Status == ProbeMismatch || p.Status == ProbeError {
+			check.OK = false
+		}
+		if p.Check == "certificate" && p.Status == ProbeMismatch {
+			check.Stale = true
+		}
+	}
+	return check
+}
+
+func probeCertificate(addr, host, serial string) DeployProbe {
+	p := DeployProbe{Address: addr, Check: "certificate"}
+	dialer := &net.Dialer{Timeout: time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true, // Only the serial matters; a stale cert may be expired
+	})
+	if err != nil {
+		p.Status, p.Got = probeFailure(err), err.Error()
+		return p
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		p.Status, p.Got = ProbeError, "no certificate"
+		return p
+	}
+	p.Got = certs[0].SerialNumber.Text(16)
+	p.Status = ProbeOK
+	if !strings.EqualFold(p.Got, serial) {
+		p.Status = ProbeMismatch
+	}
+	return p
+}
+
+func probeRedirect(addr, host string) DeployProbe {
+	p := DeployProbe{Address: addr, Check: "redirect"}
+	client := &http.Client{
+		Timeout: time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+	if err != nil {
+		p.Status, p.Got = ProbeError, err.Error()
+		return p
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", "hubfly-deploy-check")
+	resp, err := client.Do(req)
+	if err != nil {
+		p.Status, p.Got = probeFailure(err), err.Error()
+		return p
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	location := resp.Header.Get("Location")
+	p.Got = fmt.Sprint(resp.StatusCode)
+	if location != "" {
+		p.Got += " " + location
+	}
+	p.Status = ProbeOK
+	if resp.StatusCode != http.StatusMovedPermanently || !strings.HasPrefix(location, "https://"+host+"/") {
+		p.Status = ProbeMismatch
+	}
+	return p
+}
+
+// probeFailure tells a missing listener (or IP family) from other errors.
+func probeFailure(err error) string {
+	for _, errno := range []syscall.Errno{syscall.ECONNREFUSED, syscall.EADDRNOTAVAIL, syscall.ENETUNREACH, syscall.EAFNOSUPPORT} {
+		if errors.Is(err, errno) {
+			return ProbeNoListener
+		}
+	}
+	return ProbeError
+}
@@ -0,0 +1,56 @@
+package nginx
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCheckDeployment(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}))
+	defer redirect.Close()
+
+	port := func(srv *httptest.Server) string {
+		u, _ := url.Parse(srv.URL)
+		_, p, _ := net.SplitHostPort(u.Host)
+		return p
+	}
+	oldHTTP, oldHTTPS, oldWait := deployHTTPPort, deployHTTPSPort, deployCheckWait
+	defer func() { deployHTTPPort, deployHTTPSPort, deployCheckWait = oldHTTP, oldHTTPS, oldWait }()
+	deployHTTPPort, deployHTTPSPort, deployCheckWait = port(redirect), port(tlsSrv), 0
+
+	// Nothing listens on ::1, which counts as no IPv6 listener.
+	m := &Manager{DeployCheckHosts: []string{"127.0.0.1", "::1"}}
+	serial := tlsSrv.Certificate().SerialNumber.Text(16)
+
+	check := m.CheckDeployment("app.example.com", serial, true)
+	if !check.OK || check.Stale {
+		t.Fatalf("Expected a passing check, got %+v", check)
+	}
+	if len(check.Probes) != 4 {
+		t.Fatalf("Expected 4 probes, got %+v", check.Probes)
+	}
+	for _, p := range check.Probes {
+		want := ProbeOK
+		if p.Address[0] == '[' {
+			want = ProbeNoListener
+		}
+		if p.Status != want {
+			t.Errorf("%s %s: expected %s, got %s (%s)", p.Check, p.Address, want, p.Status, p.Got)
+		}
+	}
+
+	check = m.CheckDeployment("app.example.com", "abc123", false)
+	if check.OK || !check.Stale {
+		t.Errorf("Expected a stale certificate, got %+v", check)
+	}
+	if check.Probes[0].Status != ProbeMismatch || check.Probes[0].Got != serial {
+		t.Errorf("Expected the served serial %s, got %+v", serial, check.Probes[0])
+	}
+}
@@ -0,0 +1,324 @@
+package nginx
+
+import (
+	"slices"
+	"strings"
+)
+
+// DirectiveDoc describes a directive hubfly renders, for inline help in
+// dashboards. Fields are the site or stream fields (JSON paths, such as
+// "firewall.rate_limit") that make hubfly render it or shape its
+// arguments; a directive without fields is always rendered. Contexts are
+// the blocks hubfly puts it in, not every block nginx allows.
+type DirectiveDoc struct {
+	Name        string   `json:"name"`
+	Resource    string   `json:"resource"` // "site" or "stream"
+	Module      string   `json:"module"`
+	Contexts    []string `json:"contexts"` // http, server, location, if, upstream; stream, stream server, stream upstream
+	Description string   `json:"description"`
+	Fields      []string `json:"fields,omitempty"`
+	URL         string   `json:"url"`
+}
+
+// Documentation of the third-party modules in the image.
+var thirdPartyDocs = map[string]string{
+	"ngx_http_modsecurity_module": "https://github.com/owasp-modsecurity/ModSecurity-nginx#usage",
+	"ngx_http_geoip2_module":      "https://github.com/leev/ngx_http_geoip2_module#example-usage",
+}
+
+// directiveDocs documents what the site template, the stream renderer and
+// the presets write. TestDirectiveDocs renders them and fails when the
+// two drift apart, either way.
+var directiveDocs = []DirectiveDoc{
+	// Site server blocks
+	{Name: "server", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"http"},
+		Description: "Virtual server of the site: one on port 80 and, with ssl, one on 443."},
+	{Name: "listen", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "Port 80, 443 ssl with ssl, and 443 quic with http3.", Fields: []string{"ssl", "http3"}},
+	{Name: "http2", Resource: "site", Module: "ngx_http_v2_module", Contexts: []string{"server"},
+		Description: "On for HTTPS, and on port 80 (h2c) when the site or a route proxies gRPC.", Fields: []string{"ssl", "protocol", "routes.protocol"}},
+	{Name: "server_name", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "The site's domain and aliases, in their ASCII form.", Fields: []string{"domain", "aliases"}},
+	{Name: "access_log", Resource: "site", Module: "ngx_http_log_module", Contexts: []string{"server", "location"},
+		Description: "The site's access log, plus the audit, capture and traversal logs when enabled. Internal locations log nothing.",
+		Fields:      []string{"log_format", "audit_headers", "capture", "firewall.block_traversal"}},
+	{Name: "error_log", Resource: "site", Module: "ngx_core_module", Contexts: []string{"server"},
+		Description: "The site's error log, at notice level."},
+	{Name: "log_format", Resource: "site", Module: "ngx_http_log_module", Contexts: []string{"http"},
+		Description: "JSON formats of registered access logs, header audits and request captures.", Fields: []string{"log_format", "audit_headers", "capture"}},
+
+	// TLS
+	{Name: "ssl_certificate", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Certificate chain of the site's lineage, or of the shared wildcard certificate.", Fields: []string{"ssl", "wildcard", "cert_lineage"}},
+	{Name: "ssl_certificate_key", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Private key of the site's certificate.", Fields: []string{"ssl", "wildcard", "cert_lineage"}},
+	{Name: "ssl_session_cache", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Shared cache of TLS sessions, so returning clients skip the full handshake.", Fields: []string{"tls.session_cache_size"}},
+	{Name: "ssl_session_tickets", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Whether clients may resume sessions with tickets.", Fields: []string{"tls.session_tickets"}},
+	{Name: "ssl_early_data", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Accepts TLS 1.3 early data (0-RTT); requests can be replayed.", Fields: []string{"tls.early_data"}},
+	{Name: "ssl_client_certificate", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "CA bundle client certificates must chain to.", Fields: []string{"client_auth.ca_path"}},
+	{Name: "ssl_verify_client", Resource: "site", Module: "ngx_http_ssl_module", Contexts: []string{"server"},
+		Description: "Requires a client certificate, or only checks one when sent.", Fields: []string{"client_auth.optional"}},
+
+	// Proxying
+	{Name: "location", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server", "location"},
+		Description: "The root location proxying to the upstreams, and locations for routes, redirects, static assets, firewall rules, error pages, internal hand-offs and the ACME challenge.",
+		Fields:      []string{"routes", "redirects", "static_assets", "firewall.block_rules", "protected_files", "asset_shield", "intercept_errors", "capacity", "traffic_mirror", "jwt_gate", "force_ssl", "templates"}},
+	{Name: "proxy_pass", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Passes requests to the upstream, through a variable for a single upstream so nginx starts while it is down.",
+		Fields:      []string{"upstreams", "upstream_tls", "load_balancing", "canary_release", "traffic_mirror", "jwt_gate"}},
+	{Name: "grpc_pass", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "Passes requests to a gRPC upstream.", Fields: []string{"protocol", "routes.protocol", "upstream_tls"}},
+	{Name: "proxy_http_version", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "HTTP/1.1 to the upstream, for keepalive and upgrades."},
+	{Name: "proxy_set_header", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Headers sent to the upstream: Upgrade and Connection, Host, custom headers and client certificate details.",
+		Fields:      []string{"proxy_set_header", "upstream_host", "websockets", "tls.early_data", "client_auth", "response_rewrite", "traffic_mirror", "jwt_gate", "templates"}},
+	{Name: "grpc_set_header", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "Headers sent to a gRPC upstream.", Fields: []string{"proxy_set_header", "tls.early_data", "client_auth"}},
+	{Name: "proxy_read_timeout", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How long to wait between two reads from the upstream.", Fields: []string{"websockets", "websocket_timeout_seconds", "routes.read_timeout_seconds", "traffic_mirror", "templates"}},
+	{Name: "proxy_send_timeout", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How long to wait between two writes to the upstream.", Fields: []string{"websockets", "websocket_timeout_seconds", "routes.send_timeout_seconds", "templates"}},
+	{Name: "proxy_connect_timeout", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How long to wait for a connection to the upstream.", Fields: []string{"routes.connect_timeout_seconds", "traffic_mirror"}},
+	{Name: "grpc_read_timeout", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "How long to wait between two reads from a gRPC upstream.", Fields: []string{"routes.read_timeout_seconds"}},
+	{Name: "grpc_send_timeout", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "How long to wait between two writes to a gRPC upstream.", Fields: []string{"routes.send_timeout_seconds"}},
+	{Name: "grpc_connect_timeout", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "How long to wait for a connection to a gRPC upstream.", Fields: []string{"routes.connect_timeout_seconds"}},
+	{Name: "proxy_next_upstream", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Failures that retry the request on the next upstream.", Fields: []string{"routes.retries.on"}},
+	{Name: "proxy_next_upstream_tries", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How many upstreams a request is tried on.", Fields: []string{"routes.retries.tries"}},
+	{Name: "proxy_next_upstream_timeout", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How long a request may be retried for.", Fields: []string{"routes.retries.timeout_seconds"}},
+	{Name: "grpc_next_upstream", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "Failures that retry a gRPC call on the next upstream.", Fields: []string{"routes.retries.on"}},
+	{Name: "grpc_next_upstream_tries", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "How many upstreams a gRPC call is tried on.", Fields: []string{"routes.retries.tries"}},
+	{Name: "grpc_next_upstream_timeout", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"location"},
+		Description: "How long a gRPC call may be retried for.", Fields: []string{"routes.retries.timeout_seconds"}},
+	{Name: "limit_rate", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Caps the bandwidth of each response, by time of day with a schedule.", Fields: []string{"routes.limit_rate", "routes.rate_schedule"}},
+	{Name: "mirror", Resource: "site", Module: "ngx_http_mirror_module", Contexts: []string{"location"},
+		Description: "Copies requests to the mirror upstream; its responses are dropped.", Fields: []string{"traffic_mirror"}},
+	{Name: "internal", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Locations only reachable from nginx: the mirror and JWT subrequests, X-Accel-Redirect targets and error pages.",
+		Fields:      []string{"traffic_mirror", "jwt_gate", "protected_files", "intercept_errors"}},
+	{Name: "alias", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Serves files from a directory: X-Accel-Redirect targets and uploaded favicon.ico and robots.txt.", Fields: []string{"protected_files", "asset_shield"}},
+
+	// Upstreams
+	{Name: "upstream", Resource: "site", Module: "ngx_http_upstream_module", Contexts: []string{"http"},
+		Description: "Group of upstreams, for sites with several of them or load_balancing.", Fields: []string{"upstreams", "load_balancing"}},
+	{Name: "server", Resource: "site", Module: "ngx_http_upstream_module", Contexts: []string{"upstream"},
+		Description: "One upstream with its weight; down when health checks mark it or while it drains.",
+		Fields:      []string{"upstreams", "load_balancing.weights", "load_balancing.adaptive", "health_check.mark_down", "drain"}},
+	{Name: "keepalive", Resource: "site", Module: "ngx_http_upstream_module", Contexts: []string{"upstream"},
+		Description: "Idle connections to the upstreams each worker keeps open.", Fields: []string{"upstream_keepalive.connections"}},
+	{Name: "keepalive_timeout", Resource: "site", Module: "ngx_http_upstream_module", Contexts: []string{"upstream"},
+		Description: "How long an idle upstream connection is kept.", Fields: []string{"upstream_keepalive.timeout_seconds"}},
+	{Name: "keepalive_requests", Resource: "site", Module: "ngx_http_upstream_module", Contexts: []string{"upstream"},
+		Description: "Requests sent over one upstream connection before it is closed.", Fields: []string{"upstream_keepalive.requests"}},
+	{Name: "split_clients", Resource: "site", Module: "ngx_http_split_clients_module", Contexts: []string{"http"},
+		Description: "Picks the canary for a share of clients, and samples mirrored and captured requests.",
+		Fields:      []string{"canary_release", "traffic_mirror.sample_rate", "capture.sample_rate"}},
+	{Name: "map", Resource: "site", Module: "ngx_http_map_module", Contexts: []string{"http"},
+		Description: "Variables derived per request: the Connection header for upgrades, traversal and country blocks, HSTS and Alt-Svc over HTTPS, audited headers.",
+		Fields:      []string{"websockets", "firewall.block_traversal", "firewall.countries", "security_headers.hsts", "http3", "audit_headers"}},
+
+	// Upstream TLS
+	{Name: "proxy_ssl_certificate", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "Client certificate presented to HTTPS upstreams.", Fields: []string{"upstream_tls.client_cert"}},
+	{Name: "proxy_ssl_certificate_key", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "Key of the client certificate presented to HTTPS upstreams.", Fields: []string{"upstream_tls.client_key"}},
+	{Name: "proxy_ssl_trusted_certificate", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "CA bundle HTTPS upstreams are verified against.", Fields: []string{"upstream_tls.ca"}},
+	{Name: "proxy_ssl_verify", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "Verifies the certificate of HTTPS upstreams.", Fields: []string{"upstream_tls.verify"}},
+	{Name: "proxy_ssl_server_name", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "Sends SNI to HTTPS upstreams.", Fields: []string{"upstream_tls.sni"}},
+	{Name: "proxy_ssl_name", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server"},
+		Description: "Name sent as SNI and checked against the upstream's certificate.", Fields: []string{"upstream_tls.server_name"}},
+	{Name: "grpc_ssl_certificate", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "Client certificate presented to grpcs upstreams.", Fields: []string{"upstream_tls.client_cert"}},
+	{Name: "grpc_ssl_certificate_key", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "Key of the client certificate presented to grpcs upstreams.", Fields: []string{"upstream_tls.client_key"}},
+	{Name: "grpc_ssl_trusted_certificate", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "CA bundle grpcs upstreams are verified against.", Fields: []string{"upstream_tls.ca"}},
+	{Name: "grpc_ssl_verify", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "Verifies the certificate of grpcs upstreams.", Fields: []string{"upstream_tls.verify"}},
+	{Name: "grpc_ssl_server_name", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "Sends SNI to grpcs upstreams.", Fields: []string{"upstream_tls.sni"}},
+	{Name: "grpc_ssl_name", Resource: "site", Module: "ngx_http_grpc_module", Contexts: []string{"server"},
+		Description: "Name sent as SNI and checked against the grpcs upstream's certificate.", Fields: []string{"upstream_tls.server_name"}},
+
+	// Firewall and capacity
+	{Name: "allow", Resource: "site", Module: "ngx_http_access_module", Contexts: []string{"location"},
+		Description: "Addresses or CIDR ranges let through.", Fields: []string{"firewall.ip_rules"}},
+	{Name: "deny", Resource: "site", Module: "ngx_http_access_module", Contexts: []string{"location"},
+		Description: "Addresses or CIDR ranges answered with 403.", Fields: []string{"firewall.ip_rules"}},
+	{Name: "geoip2", Resource: "site", Module: "ngx_http_geoip2_module", Contexts: []string{"http"},
+		Description: "Looks up the client's country in the GeoIP database.", Fields: []string{"firewall.countries"}},
+	{Name: "if", Resource: "site", Module: "ngx_http_rewrite_module", Contexts: []string{"server", "location"},
+		Description: "Blocks by user agent, method, content type, path traversal or country, and skips unsampled mirror requests.",
+		Fields:      []string{"firewall.block_rules", "firewall.block_traversal", "firewall.countries", "traffic_mirror.sample_rate"}},
+	{Name: "return", Resource: "site", Module: "ngx_http_rewrite_module", Contexts: []string{"location", "if"},
+		Description: "Answers without proxying: HTTPS and exact-path redirects, blocked requests, shed load and JSON error pages.",
+		Fields:      []string{"force_ssl", "redirects", "firewall", "capacity", "intercept_errors", "templates"}},
+	{Name: "rewrite", Resource: "site", Module: "ngx_http_rewrite_module", Contexts: []string{"server", "location"},
+		Description: "Regex redirects, and URI rewrites before proxying.", Fields: []string{"redirects", "rewrites"}},
+	{Name: "set", Resource: "site", Module: "ngx_http_rewrite_module", Contexts: []string{"server", "location"},
+		Description: "Holds the upstream URL in a variable, and the hashes of audited headers.", Fields: []string{"upstreams", "traffic_mirror", "audit_headers"}},
+	{Name: "limit_req_zone", Resource: "site", Module: "ngx_http_limit_req_module", Contexts: []string{"http"},
+		Description: "Shared state of the per-client rate limit and of the site-wide request queue.", Fields: []string{"firewall.rate_limit", "capacity.rate"}},
+	{Name: "limit_req", Resource: "site", Module: "ngx_http_limit_req_module", Contexts: []string{"server", "location"},
+		Description: "Applies the rate limit (with its burst) and the request queue.", Fields: []string{"firewall.rate_limit", "capacity.rate", "capacity.queue"}},
+	{Name: "limit_req_status", Resource: "site", Module: "ngx_http_limit_req_module", Contexts: []string{"server"},
+		Description: "Status of requests the queue rejects.", Fields: []string{"capacity.shed_status"}},
+	{Name: "limit_conn_zone", Resource: "site", Module: "ngx_http_limit_conn_module", Contexts: []string{"http"},
+		Description: "Shared state of the site's concurrent request cap.", Fields: []string{"capacity.max_concurrent"}},
+	{Name: "limit_conn", Resource: "site", Module: "ngx_http_limit_conn_module", Contexts: []string{"server"},
+		Description: "Caps concurrent requests to the site.", Fields: []string{"capacity.max_concurrent"}},
+	{Name: "limit_conn_status", Resource: "site", Module: "ngx_http_limit_conn_module", Contexts: []string{"server"},
+		Description: "Status of requests over the concurrency cap.", Fields: []string{"capacity.shed_status"}},
+	{Name: "error_page", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server", "location"},
+		Description: "Pages for shed load and intercepted upstream errors.", Fields: []string{"capacity.shed_body", "capacity.retry_after", "intercept_errors", "templates"}},
+	{Name: "default_type", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Content type of shed-load bodies and JSON error pages.", Fields: []string{"capacity.shed_content_type", "intercept_errors"}},
+	{Name: "proxy_intercept_errors", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server", "location"},
+		Description: "Replaces upstream error responses with the site's error pages.", Fields: []string{"intercept_errors", "templates"}},
+	{Name: "modsecurity", Resource: "site", Module: "ngx_http_modsecurity_module", Contexts: []string{"server"},
+		Description: "Runs requests through ModSecurity.", Fields: []string{"waf.enabled"}},
+	{Name: "modsecurity_rules_file", Resource: "site", Module: "ngx_http_modsecurity_module", Contexts: []string{"server"},
+		Description: "The engine settings and the OWASP Core Rule Set.", Fields: []string{"waf.enabled", "waf.detection_only"}},
+	{Name: "modsecurity_rules", Resource: "site", Module: "ngx_http_modsecurity_module", Contexts: []string{"server"},
+		Description: "Paranoia level and rule exclusions around the Core Rule Set.", Fields: []string{"waf.paranoia", "waf.detection_only", "waf.rule_exclusions"}},
+
+	// Connections and bodies
+	{Name: "client_header_timeout", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "How long a client may take to send the request headers.", Fields: []string{"connection_hygiene.client_header_timeout_seconds", "connection_hygiene.preset"}},
+	{Name: "client_body_timeout", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "How long a client may pause while sending the body.", Fields: []string{"connection_hygiene.client_body_timeout_seconds", "connection_hygiene.preset"}},
+	{Name: "send_timeout", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "How long a client may pause while reading the response.", Fields: []string{"connection_hygiene.send_timeout_seconds", "connection_hygiene.preset"}},
+	{Name: "keepalive_requests", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "Requests a client may send over one connection.", Fields: []string{"connection_hygiene.keepalive_requests", "connection_hygiene.preset"}},
+	{Name: "large_client_header_buffers", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server"},
+		Description: "Number and size of buffers for long request lines and headers.",
+		Fields:      []string{"connection_hygiene.large_header_buffers", "connection_hygiene.large_header_buffer_size", "connection_hygiene.preset"}},
+	{Name: "client_max_body_size", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"server", "location"},
+		Description: "Largest request body accepted; 0 disables the limit.", Fields: []string{"client_max_body_size", "templates"}},
+	{Name: "proxy_request_buffering", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server", "location"},
+		Description: "Whether request bodies are read in full before they are sent upstream.", Fields: []string{"proxy_request_buffering", "templates"}},
+	{Name: "proxy_buffering", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"server", "location"},
+		Description: "Whether responses are buffered, or streamed to the client as they come.", Fields: []string{"proxy_buffering", "templates"}},
+
+	// Responses
+	{Name: "add_header", Resource: "site", Module: "ngx_http_headers_module", Contexts: []string{"server", "location"},
+		Description: "Response headers: security headers, Alt-Svc, Cache-Control of static assets, X-Cache-Status and Retry-After.",
+		Fields:      []string{"security_headers", "http3", "static_assets", "cache", "capacity.retry_after"}},
+	{Name: "expires", Resource: "site", Module: "ngx_http_headers_module", Contexts: []string{"location"},
+		Description: "Expires and Cache-Control max-age of static assets.", Fields: []string{"static_assets.max_age_seconds", "asset_shield.max_age_seconds"}},
+	{Name: "proxy_hide_header", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Drops the upstream's caching headers from static assets.", Fields: []string{"static_assets"}},
+	{Name: "log_not_found", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Keeps missing favicon.ico and robots.txt out of the error log.", Fields: []string{"asset_shield"}},
+	{Name: "sub_filter", Resource: "site", Module: "ngx_http_sub_module", Contexts: []string{"location"},
+		Description: "Replaces a string in response bodies.", Fields: []string{"response_rewrite.rules"}},
+	{Name: "sub_filter_once", Resource: "site", Module: "ngx_http_sub_module", Contexts: []string{"location"},
+		Description: "Replaces only the first match, or every one.", Fields: []string{"response_rewrite.once"}},
+	{Name: "sub_filter_types", Resource: "site", Module: "ngx_http_sub_module", Contexts: []string{"location"},
+		Description: "Content types rewritten besides text/html.", Fields: []string{"response_rewrite.types"}},
+	{Name: "proxy_cache_path", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"http"},
+		Description: "On-disk cache of the site and its shared key zone.", Fields: []string{"cache.enabled", "cache.zone_size"}},
+	{Name: "proxy_cache", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Caches upstream responses.", Fields: []string{"cache.enabled"}},
+	{Name: "proxy_cache_key", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "What tells cached responses apart.", Fields: []string{"cache.key_extras"}},
+	{Name: "proxy_cache_valid", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "How long responses are cached, by status.", Fields: []string{"cache.ttl_by_status"}},
+	{Name: "proxy_cache_bypass", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Requests answered from the upstream even when cached.", Fields: []string{"cache.bypass_cookies"}},
+	{Name: "proxy_no_cache", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Responses not stored in the cache.", Fields: []string{"cache.bypass_cookies"}},
+	{Name: "auth_request", Resource: "site", Module: "ngx_http_auth_request_module", Contexts: []string{"location"},
+		Description: "Checks the request's JWT with hubfly before proxying it.", Fields: []string{"jwt_gate", "routes.jwt_gate"}},
+	{Name: "proxy_method", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Sends JWT checks as GET.", Fields: []string{"jwt_gate", "routes.jwt_gate"}},
+	{Name: "proxy_pass_request_body", Resource: "site", Module: "ngx_http_proxy_module", Contexts: []string{"location"},
+		Description: "Leaves the body out of JWT checks.", Fields: []string{"jwt_gate", "routes.jwt_gate"}},
+	{Name: "root", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Serves ACME HTTP-01 challenges and bundled error pages from disk."},
+	{Name: "try_files", Resource: "site", Module: "ngx_http_core_module", Contexts: []string{"location"},
+		Description: "Answers unknown ACME challenges with 404."},
+
+	// Streams
+	{Name: "server", Resource: "stream", Module: "ngx_stream_core_module", Contexts: []string{"stream"},
+		Description: "Listener of a stream port, shared by the streams routed on it by SNI.", Fields: []string{"listen_port"}},
+	{Name: "listen", Resource: "stream", Module: "ngx_stream_core_module", Contexts: []string{"stream server"},
+		Description: "The port, for tcp or udp, on every interface or the bind address.", Fields: []string{"listen_port", "protocol", "bind_address"}},
+	{Name: "ssl_preread", Resource: "stream", Module: "ngx_stream_ssl_preread_module", Contexts: []string{"stream server"},
+		Description: "Reads the SNI of TLS connections, to route ports shared by several streams.", Fields: []string{"domain"}},
+	{Name: "map", Resource: "stream", Module: "ngx_stream_map_module", Contexts: []string{"stream"},
+		Description: "Maps the SNI to the upstream of each stream on the port.", Fields: []string{"domain"}},
+	{Name: "access_log", Resource: "stream", Module: "ngx_stream_log_module", Contexts: []string{"stream server"},
+		Description: "Sessions of the port, in the hubfly_stream format."},
+	{Name: "proxy_pass", Resource: "stream", Module: "ngx_stream_proxy_module", Contexts: []string{"stream server"},
+		Description: "Passes connections to the upstream, the upstream group or the SNI map.", Fields: []string{"upstream", "upstreams", "domain"}},
+	{Name: "proxy_timeout", Resource: "stream", Module: "ngx_stream_proxy_module", Contexts: []string{"stream server"},
+		Description: "How long a connection may be idle.", Fields: []string{"timeouts.idle_seconds", "timeouts.preset"}},
+	{Name: "proxy_connect_timeout", Resource: "stream", Module: "ngx_stream_proxy_module", Contexts: []string{"stream server"},
+		Description: "How long to wait for a connection to the upstream.", Fields: []string{"timeouts.connect_timeout_seconds", "timeouts.preset"}},
+	{Name: "proxy_socket_keepalive", Resource: "stream", Module: "ngx_stream_proxy_module", Contexts: []string{"stream server"},
+		Description: "TCP keepalive probes on upstream connections.", Fields: []string{"timeouts.socket_keepalive", "timeouts.preset"}},
+	{Name: "proxy_responses", Resource: "stream", Module: "ngx_stream_proxy_module", Contexts: []string{"stream server"},
+		Description: "Datagrams that end a UDP session.", Fields: []string{"udp.proxy_responses"}},
+	{Name: "upstream", Resource: "stream", Module: "ngx_stream_upstream_module", Contexts: []string{"stream"},
+		Description: "Group of upstreams a stream balances over.", Fields: []string{"upstreams"}},
+	{Name: "server", Resource: "stream", Module: "ngx_stream_upstream_module", Contexts: []string{"stream upstream"},
+		Description: "One upstream, with its weight, failure limits and backup flag.",
+		Fields:      []string{"upstreams", "load_balancing.max_fails", "load_balancing.fail_timeout_seconds", "load_balancing.servers"}},
+	{Name: "least_conn", Resource: "stream", Module: "ngx_stream_upstream_module", Contexts: []string{"stream upstream"},
+		Description: "Sends connections to the upstream with the fewest active ones.", Fields: []string{"load_balancing.method"}},
+	{Name: "hash", Resource: "stream", Module: "ngx_stream_upstream_module", Contexts: []string{"stream upstream"},
+		Description: "Picks the upstream by a key, so a client keeps its upstream.", Fields: []string{"load_balancing.method", "load_balancing.hash_key", "load_balancing.consistent"}},
+	{Name: "random", Resource: "stream", Module: "ngx_stream_upstream_module", Contexts: []string{"stream upstream"},
+		Description: "Picks a random upstream.", Fields: []string{"load_balancing.method"}},
+}
+
+// Directives returns the documentation of every directive hubfly renders,
+// sorted by name and resource.
+func Directives() []DirectiveDoc {
+	docs := make([]DirectiveDoc, len(directiveDocs))
+	for i, d := range directiveDocs {
+		d.URL = directiveURL(d.Module, d.Name)
+		docs[i] = d
+	}
+	slices.SortStableFunc(docs, func(a, b DirectiveDoc) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Resource, b.Resource)
+	})
+	return docs
+}
+
+// directiveURL links a directive to its module's documentation.
+func directiveURL(module, name string) string {
+	if url, ok := thirdPartyDocs[module]; ok {
+		return url
+	}
+	switch {
+	case strings.HasPrefix(module, "ngx_http_"):
+		return "https://nginx.org/en/docs/http/" + module + ".html#" + name
+	case strings.HasPrefix(module, "ngx_stream_"):
+		return "https://nginx.org/en/docs/stream/" + module + ".html#" + name
+	}
+	return "https://nginx.org/en/docs/" + module + ".html#" + name
+}
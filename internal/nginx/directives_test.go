@@ -0,0 +1,191 @@
+package nginx
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Sites between them turning on every feature of the site template.
+var directiveSites = []string{
+	`{"id": "a.local", "domain": "a.local", "aliases": ["www.a.local"], "upstreams": ["a:80", "b:80"], "ssl": true, "force_ssl": true, "http3": true,
+	  "websockets": true, "websocket_timeout_seconds": 600, "client_max_body_size": "10m", "proxy_buffering": false, "proxy_request_buffering": false,
+	  "proxy_set_header": {"X-Env": "prod"}, "upstream_host": "a.internal",
+	  "firewall": {"ip_rules": [{"value": "10.0.0.0/8", "action": "allow"}, {"value": "0.0.0.0/0", "action": "deny"}],
+	    "block_rules": {"user_agents": ["curl"], "methods": ["TRACE"], "paths": ["^/admin"], "path_methods": {"/api": ["DELETE"]}, "extensions": ["env"], "content_types": ["text/xml"]},
+	    "rate_limit": {"enabled": true, "rate": 10, "unit": "r/s", "burst": 20}, "block_traversal": true, "countries": {"deny": ["XX"]}},
+	  "capacity": {"max_concurrent": 100, "rate": 50, "queue": 10, "shed_status": 503, "shed_body": "busy", "retry_after": 5},
+	  "connection_hygiene": {"preset": "hardened"},
+	  "security_headers": {"preset": "recommended"},
+	  "waf": {"enabled": true, "paranoia": 2, "rule_exclusions": [{"rule_id": 942100, "path": "/search"}]},
+	  "tls": {"session_cache_size": "10m", "session_tickets": false, "early_data": true},
+	  "client_auth": {"ca_path": "/etc/hubfly/ca.pem", "optional": true},
+	  "routes": [{"path": "/reports/", "read_timeout_seconds": 300, "send_timeout_seconds": 300, "connect_timeout_seconds": 10,
+	    "retries": {"on": ["error", "timeout"], "tries": 2, "timeout_seconds": 5}, "limit_rate": "1m", "rate_schedule": [{"from": "09:00", "to": "17:00", "rate": "512k"}],
+	    "jwt_gate": {"jwks_url": "https://id.local/jwks"}},
+	    {"path": "/rpc/", "protocol": "grpc", "read_timeout_seconds": 60, "send_timeout_seconds": 60, "connect_timeout_seconds": 5, "retries": {"on": ["error"], "tries": 2, "timeout_seconds": 5}}],
+	  "redirects": [{"from": "/old", "to": "/new"}, {"from": "~^/blog/(.*)$", "to": "/posts/$1"}],
+	  "rewrites": [{"pattern": "^/v1/(.*)$", "replacement": "/$1", "flag": "break"}],
+	  "static_assets": [{"path": "/assets/", "max_age_seconds": 3600, "immutable": true}],
+	  "asset_shield": {"favicon": true, "robots": true},
+	  "intercept_errors": {"codes": {"502": {"action": "page"}, "500": {"action": "json"}, "404": {"action": "passthrough"}}},
+	  "cache": {"enabled": true, "ttl_by_status": {"200": "10m"}, "key_extras": ["$http_accept"], "bypass_cookies": ["session"]},
+	  "traffic_mirror": {"upstream": "shadow:80", "sample_rate": 0.1},
+	  "load_balancing": {"weights": {"a:80": 3}},
+	  "upstream_keepalive": {"connections": 16, "timeout_seconds": 30, "requests": 500},
+	  "upstream_tls": {"scheme": "https", "client_cert": "/c.pem", "client_key": "/k.pem", "ca": "/ca.pem", "verify": true, "sni": true},
+	  "audit_headers": [{"name": "Authorization", "mode": "hash"}, {"name": "X-Key", "mode": "presence"}],
+	  "protected_files": [{"path": "/downloads/", "directory": "/srv/files/"}],
+	  "response_rewrite": {"rules": [{"find": "http://a", "replace": "https://a"}], "types": ["text/css"]},
+	  "capture": {"sample_rate": 0.5, "started_at": "2026-01-01T00:00:00Z", "expires_at": "2999-01-01T00:00:00Z"},
+	  "jwt_gate": {"jwks_url": "https://id.local/jwks"}}`,
+	`{"id": "b.local", "domain": "b.local", "upstreams": ["b:80"], "canary_release": {"upstream": "b2:80", "percent": 10}}`,
+	`{"id": "g.local", "domain": "g.local", "upstreams": ["g:50051"], "protocol": "grpc", "ssl": true,
+	  "upstream_tls": {"scheme": "https", "client_cert": "/c.pem", "client_key": "/k.pem", "ca": "/ca.pem", "verify": true, "sni": true, "server_name": "g.internal"}}`,
+}
+
+// Streams between them using every option of the stream renderer.
+var directiveStreams = []string{
+	`[{"id": "a", "listen_port": 9000, "protocol": "tcp", "upstreams": ["a:1", "b:1"],
+	   "load_balancing": {"method": "least_conn", "max_fails": 3, "fail_timeout_seconds": 10, "servers": {"b:1": {"backup": true}}},
+	   "timeouts": {"idle_seconds": 600, "connect_timeout_seconds": 5, "socket_keepalive": true}}]`,
+	`[{"id": "h", "listen_port": 9001, "protocol": "tcp", "upstreams": ["a:1", "b:1"], "load_balancing": {"method": "hash", "consistent": true}}]`,
+	`[{"id": "r", "listen_port": 9002, "protocol": "udp", "bind_address": "127.0.0.1", "upstreams": ["a:1", "b:1"], "load_balancing": {"method": "random"}, "udp": {"proxy_responses": 1}}]`,
+	`[{"id": "x", "listen_port": 9443, "protocol": "tcp", "domain": "x.local", "upstream": "x:443"},
+	  {"id": "y", "listen_port": 9443, "protocol": "tcp", "domain": "y.local", "upstream": "y:443"}]`,
+}
+
+// directiveContexts collects the directives of a rendered config with the
+// block each sits in, skipping the parameters of map-like blocks.
+func directiveContexts(t *testing.T, config []byte, root string) map[string]bool {
+	t.Helper()
+	dirs, err := Parse(config)
+	if err != nil {
+		t.Fatalf("Parse: %v\n%s", err, config)
+	}
+	found := map[string]bool{}
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		context := root
+		for _, p := range parents {
+			switch p.Name {
+			case "map", "split_clients", "geoip2":
+				return
+			}
+		}
+		if len(parents) > 0 {
+			context = parents[len(parents)-1].Name
+			if root == "stream" {
+				context = "stream " + context
+			}
+		}
+		found[d.Name+" in "+context] = true
+	})
+	return found
+}
+
+func TestDirectiveDocs(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	mgr.GeoIPDB = "/etc/hubfly/geoip.mmdb"
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	documented := map[string]bool{}
+	for _, d := range Directives() {
+		root := "http"
+		if d.Resource == "stream" {
+			root = "stream"
+		}
+		for _, c := range d.Contexts {
+			if strings.HasPrefix(c, "stream") != (root == "stream") {
+				t.Errorf("%s directive %s in %q", d.Resource, d.Name, c)
+			}
+			documented[d.Resource+": "+d.Name+" in "+c] = true
+		}
+		if d.Description == "" || d.Module == "" || !strings.HasPrefix(d.URL, "https://") {
+			t.Errorf("Incomplete doc: %+v", d)
+		}
+	}
+
+	rendered := map[string]bool{}
+	check := func(resource string, found map[string]bool) {
+		for k := range found {
+			rendered[resource+": "+k] = true
+			if !documented[resource+": "+k] {
+				t.Errorf("Rendered %s directive %s is not documented", resource, k)
+			}
+		}
+	}
+	for _, doc := range directiveSites {
+		var site models.Site
+		if err := json.Unmarshal([]byte(doc), &site); err != nil {
+			t.Fatal(err)
+		}
+		config, err := mgr.Render(&site)
+		if err != nil {
+			t.Fatalf("Render %s: %v", site.ID, err)
+		}
+		check("site", directiveContexts(t, config, "http"))
+	}
+	for _, p := range Presets() {
+		site := &models.Site{ID: "p.local", Domain: "p.local", Upstreams: []string{"app:80"}, Templates: []string{p.Name}}
+		config, err := mgr.Render(site)
+		if err != nil {
+			t.Fatalf("Render with preset %s: %v", p.Name, err)
+		}
+		check("site", directiveContexts(t, config, "http"))
+	}
+	for _, doc := range directiveStreams {
+		var streams []models.Stream
+		if err := json.Unmarshal([]byte(doc), &streams); err != nil {
+			t.Fatal(err)
+		}
+		config, err := mgr.RenderStreamConfig(streams[0].ListenPort, streams)
+		if err != nil {
+			t.Fatalf("RenderStreamConfig %d: %v", streams[0].ListenPort, err)
+		}
+		check("stream", directiveContexts(t, config, "stream"))
+	}
+	for k := range documented {
+		if !rendered[k] {
+			t.Errorf("Documented %s is never rendered", k)
+		}
+	}
+}
+
+func TestDirectiveFields(t *testing.T) {
+	types := map[string]reflect.Type{"site": reflect.TypeOf(models.Site{}), "stream": reflect.TypeOf(models.Stream{})}
+	for _, d := range Directives() {
+		for _, f := range d.Fields {
+			if !hasJSONPath(types[d.Resource], strings.Split(f, ".")) {
+				t.Errorf("%s %s: no field %q", d.Resource, d.Name, f)
+			}
+		}
+	}
+}
+
+// hasJSONPath reports whether path names nested JSON fields of t, looking
+// through pointers, slices and maps.
+func hasJSONPath(t reflect.Type, path []string) bool {
+	for len(path) > 0 {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		next := reflect.Type(nil)
+		for i := 0; i < t.NumField(); i++ {
+			if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name == path[0] {
+				next = t.Field(i).Type
+			}
+		}
+		if next == nil {
+			return false
+		}
+		t, path = next, path[1:]
+	}
+	return true
+}
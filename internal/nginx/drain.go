@@ -0,0 +1,81 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Upstream drain timeouts. The longest matches worker_shutdown_timeout in
+// the bundled nginx.conf, after which old workers close what they still
+// hold anyway.
+const (
+	DefaultDrainTimeout = 300
+	maxDrainTimeout     = 3600
+)
+
+// CheckDrain validates a site's upstream drain settings.
+func CheckDrain(site *models.Site) error {
+	d := site.Drain
+	if d == nil {
+		return nil
+	}
+	if d.Timeout < 0 || d.Timeout > maxDrainTimeout {
+		return fmt.Errorf("drain: timeout_seconds must be between 0 and %d", maxDrainTimeout)
+	}
+	return nil
+}
+
+// DrainTimeout is how long upstreams removed from site are kept at most.
+func DrainTimeout(site *models.Site) time.Duration {
+	if site.Drain == nil || site.Drain.Timeout == 0 {
+		return DefaultDrainTimeout * time.Second
+	}
+	return time.Duration(site.Drain.Timeout) * time.Second
+}
+
+// drainingServers are the draining upstreams of site rendered as "down",
+// so new requests avoid them while they stay listed with the site.
+// Upstreams added back aren't repeated.
+func drainingServers(site *models.Site) []upstreamServer {
+	var servers []upstreamServer
+	for _, d := range site.DrainingUpstreams {
+		if !slices.Contains(site.Upstreams, d.Address) {
+			servers = append(servers, upstreamServer{Address: d.Address, Weight: 1, Down: true})
+		}
+	}
+	return servers
+}
+
+// ShuttingDownWorkers counts the nginx workers left over from earlier
+// reloads. They keep serving the connections they had, WebSockets
+// included, under the config they were started with.
+func (m *Manager) ShuttingDownWorkers() (int, error) {
+	return countShuttingDownWorkers("/proc")
+}
+
+func countShuttingDownWorkers(procDir string) (int, error) {
+	cmdlines, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "cmdline"))
+	if err != nil {
+		return 0, err
+	}
+	if len(cmdlines) == 0 {
+		return 0, fmt.Errorf("no processes listed in %s", procDir)
+	}
+	n := 0
+	for _, path := range cmdlines {
+		cmdline, err := os.ReadFile(path)
+		if err != nil {
+			continue // The process exited
+		}
+		if bytes.HasPrefix(cmdline, []byte("nginx: worker process is shutting down")) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,83 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestDrainingUpstreams(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "chat.local", Domain: "chat.local", WebSockets: true,
+		Upstreams:     []string{"chat-v2a:8080", "chat-v2b:8080"},
+		LoadBalancing: &models.LoadBalancing{},
+		Drain:         &models.UpstreamDrain{Enabled: true},
+		DrainingUpstreams: []models.DrainingUpstream{
+			{Address: "chat-v1:8080", Until: time.Now().Add(time.Minute)},
+			{Address: "chat-v2a:8080", Until: time.Now().Add(time.Minute)}, // Added back
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	if !strings.Contains(cfg, "server chat-v1:8080 down;") {
+		t.Errorf("Expected the draining upstream marked down:\n%s", cfg)
+	}
+	if strings.Count(cfg, "server chat-v2a:8080") != 1 || strings.Contains(cfg, "server chat-v2a:8080 down;") {
+		t.Errorf("Expected an upstream added back to be served once:\n%s", cfg)
+	}
+
+	// A single upstream doesn't get a block for its draining upstream.
+	site.Upstreams = []string{"chat-v3:8080"}
+	site.LoadBalancing = nil
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "upstream ") || strings.Contains(string(config), "chat-v1") {
+		t.Errorf("Expected no upstream block:\n%s", config)
+	}
+
+	site.Drain = &models.UpstreamDrain{Enabled: true, Timeout: maxDrainTimeout + 1}
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected a drain timeout over an hour to be rejected")
+	}
+	if got := DrainTimeout(&models.Site{Drain: &models.UpstreamDrain{Enabled: true}}); got != DefaultDrainTimeout*time.Second {
+		t.Errorf("DrainTimeout = %v, want the default", got)
+	}
+}
+
+func TestCountShuttingDownWorkers(t *testing.T) {
+	proc := t.TempDir()
+	for pid, cmdline := range map[string]string{
+		"1":   "nginx: master process nginx -g daemon off;",
+		"20":  "nginx: worker process",
+		"21":  "nginx: worker process is shutting down",
+		"22":  "nginx: worker process is shutting down",
+		"300": "/usr/local/bin/hubfly\x00--port\x0081",
+	} {
+		if err := os.MkdirAll(filepath.Join(proc, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(proc, pid, "cmdline"), []byte(cmdline), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := countShuttingDownWorkers(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Got %d shutting down workers, want 2", n)
+	}
+	if _, err := countShuttingDownWorkers(t.TempDir()); err == nil {
+		t.Error("Expected an error without a process list")
+	}
+}
@@ -0,0 +1,147 @@
+package nginx
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Error interception actions.
+const (
+	ErrorPage        = "page"
+	ErrorJSON        = "json"
+	ErrorPassthrough = "passthrough"
+)
+
+const maxErrorMessage = 512
+
+// bundledErrorPages are the pages in /var/www/hubfly/static. 403 and
+// 502/504 are served for errors nginx generates itself on every site.
+var bundledErrorPages = map[int]string{
+	403: "/403.html",
+	404: "/404.html",
+	502: "/502.html",
+	504: "/502.html",
+}
+
+// errorPages is what the "error_pages" template renders.
+type errorPages struct {
+	Intercept bool        // proxy_intercept_errors on
+	Pages     []errorPage // error_page directives
+	Bundled   []string    // Internal locations of the bundled pages in use
+	JSON      []jsonError
+}
+
+type errorPage struct {
+	Codes string // e.g. "502 504"
+	URI   string
+}
+
+type jsonError struct {
+	Status int
+	Body   string
+}
+
+// CheckInterceptErrors validates a site's upstream error interception.
+func CheckInterceptErrors(site *models.Site) error {
+	ie := site.InterceptErrors
+	if ie == nil {
+		return nil
+	}
+	if isGRPC(site.Protocol) {
+		return fmt.Errorf("intercept_errors: not supported for gRPC sites")
+	}
+	if len(ie.Codes) == 0 {
+		return fmt.Errorf("intercept_errors: needs at least one status code")
+	}
+	for _, code := range slices.Sorted(maps.Keys(ie.Codes)) {
+		r := ie.Codes[code]
+		if code < 400 || code > 599 {
+			return fmt.Errorf("intercept_errors: status %d is not an error (use 400-599)", code)
+		}
+		if c := site.Capacity; c != nil && (c.ShedBody != "" || c.RetryAfter > 0) && code == c.Status() {
+			return fmt.Errorf("intercept_errors: status %d already answers requests shed by capacity", code)
+		}
+		if r.Page != "" && r.Action != ErrorPage {
+			return fmt.Errorf("intercept_errors: %d: page needs action page", code)
+		}
+		if r.Message != "" && r.Action != ErrorJSON {
+			return fmt.Errorf("intercept_errors: %d: message needs action json", code)
+		}
+		switch r.Action {
+		case ErrorPage:
+			if r.Page == "" && bundledErrorPages[code] == "" {
+				return fmt.Errorf("intercept_errors: %d: page is required (bundled pages exist for 403, 404, 502 and 504)", code)
+			}
+			if r.Page != "" && !assetPathPattern.MatchString(r.Page) {
+				return fmt.Errorf("intercept_errors: %d: page must start with / and hold URL characters only, got %q", code, r.Page)
+			}
+		case ErrorJSON:
+			if len(r.Message) > maxErrorMessage || strings.ContainsAny(r.Message, "\r\n") {
+				return fmt.Errorf("intercept_errors: %d: message must be a single line of at most %d characters", code, maxErrorMessage)
+			}
+		case ErrorPassthrough:
+		default:
+			return fmt.Errorf("intercept_errors: %d: unknown action %q (use page, json or passthrough)", code, r.Action)
+		}
+	}
+	return nil
+}
+
+// resolveErrorPages overlays a site's interception on the bundled 403 and
+// 502/504 pages. Passthrough drops the bundled page, so the backend's body
+// gets through; errors nginx generates itself then get nginx's own page.
+func resolveErrorPages(site *models.Site) errorPages {
+	targets := map[int]string{403: bundledErrorPages[403], 502: bundledErrorPages[502], 504: bundledErrorPages[504]}
+	var ep errorPages
+	if ie := site.InterceptErrors; ie != nil && !isGRPC(site.Protocol) {
+		ep.Intercept = true
+		for code, r := range ie.Codes {
+			switch r.Action {
+			case ErrorPage:
+				targets[code] = r.Page
+				if r.Page == "" {
+					targets[code] = bundledErrorPages[code]
+				}
+			case ErrorJSON:
+				targets[code] = fmt.Sprintf("@hubfly_error_%d", code)
+				msg := r.Message
+				if msg == "" {
+					msg = http.StatusText(code)
+				}
+				body, _ := json.Marshal(struct {
+					Error  string `json:"error"`
+					Status int    `json:"status"`
+				}{msg, code})
+				// "$" would start an nginx variable.
+				ep.JSON = append(ep.JSON, jsonError{Status: code, Body: strings.ReplaceAll(string(body), "$", `\u0024`)})
+			default:
+				delete(targets, code)
+			}
+		}
+		slices.SortFunc(ep.JSON, func(a, b jsonError) int { return a.Status - b.Status })
+	}
+
+	// One error_page per target, in the order of their lowest status.
+	index := map[string]int{}
+	for _, code := range slices.Sorted(maps.Keys(targets)) {
+		uri := targets[code]
+		i, ok := index[uri]
+		if !ok {
+			i = len(ep.Pages)
+			index[uri] = i
+			ep.Pages = append(ep.Pages, errorPage{URI: uri})
+			if slices.Contains([]string{"/403.html", "/404.html", "/502.html"}, uri) {
+				ep.Bundled = append(ep.Bundled, uri)
+			}
+		}
+		ep.Pages[i].Codes = strings.TrimSpace(ep.Pages[i].Codes + fmt.Sprintf(" %d", code))
+	}
+	slices.Sort(ep.Bundled)
+	return ep
+}
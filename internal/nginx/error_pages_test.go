@@ -0,0 +1,82 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestInterceptErrors(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "api.local", Domain: "api.local", Upstreams: []string{"api:3000"},
+		InterceptErrors: &models.ErrorInterception{Codes: map[int]models.ErrorResponse{
+			404: {Action: ErrorPage},
+			500: {Action: ErrorPage, Page: "/errors/500.html"},
+			503: {Action: ErrorJSON, Message: "costs $5"},
+			429: {Action: ErrorJSON},
+			502: {Action: ErrorPassthrough},
+		}},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"proxy_intercept_errors on;",
+		"error_page 403 /403.html;",
+		"error_page 404 /404.html;",
+		"error_page 429 @hubfly_error_429;",
+		"error_page 500 /errors/500.html;",
+		"error_page 504 /502.html;",
+		"location = /404.html {",
+		`return 429 "{\"error\":\"Too Many Requests\",\"status\":429}";`,
+		`return 503 "{\"error\":\"costs \\u00245\",\"status\":503}";`, // No nginx variable
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if strings.Contains(cfg, "error_page 502") {
+		t.Errorf("Expected 502 to pass through:\n%s", cfg)
+	}
+
+	// Without interception only nginx's own errors get the bundled pages.
+	site.InterceptErrors = nil
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = string(config)
+	if strings.Contains(cfg, "proxy_intercept_errors") || strings.Contains(cfg, "/404.html") || !strings.Contains(cfg, "error_page 502 504 /502.html;") {
+		t.Errorf("Expected the default error pages:\n%s", cfg)
+	}
+}
+
+func TestCheckInterceptErrors(t *testing.T) {
+	for _, ie := range []map[int]models.ErrorResponse{
+		{},
+		{302: {Action: ErrorPage, Page: "/x"}},
+		{500: {Action: ErrorPage}},
+		{404: {Action: ErrorPage, Page: "errors/404.html"}},
+		{404: {Action: ErrorPassthrough, Page: "/404.html"}},
+		{500: {Action: ErrorPage, Message: "oops"}},
+		{500: {Action: ErrorJSON, Message: "a\nb"}},
+		{500: {Action: "drop"}},
+		{503: {Action: ErrorJSON}}, // Shed by capacity
+	} {
+		site := &models.Site{
+			InterceptErrors: &models.ErrorInterception{Codes: ie},
+			Capacity:        &models.Capacity{MaxConcurrent: 10, RetryAfter: 5},
+		}
+		if err := CheckInterceptErrors(site); err == nil {
+			t.Errorf("Expected %v to be rejected", ie)
+		}
+	}
+	site := &models.Site{Protocol: "grpc", InterceptErrors: &models.ErrorInterception{Codes: map[int]models.ErrorResponse{500: {Action: ErrorJSON}}}}
+	if err := CheckInterceptErrors(site); err == nil {
+		t.Error("Expected gRPC sites to be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+package nginx
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// exportDir is a directory copied into the export archive under Name.
+type exportDir struct {
+	Name, Path, Glob string
+}
+
+// exportDirs are the live directories an export carries: the rendered
+// site and stream configs, and the global includes shipped with the
+// image (see nginx.conf).
+func (m *Manager) exportDirs() []exportDir {
+	conf := filepath.Dir(m.NginxConf)
+	return []exportDir{
+		{"sites", m.SitesDir, "*.conf"},
+		{"streams", m.StreamsDir, "*.conf"},
+		{"modsec", m.WAFDir, "*.conf"},
+		{"njs", filepath.Join(conf, "njs"), "*.js"},
+		{"modules-enabled", filepath.Join(conf, "modules-enabled"), "*.conf"},
+	}
+}
+
+// Export writes a tar.gz of the effective proxy configuration for offline
+// review: nginx.conf at the top, and each directory of exportDirs under
+// its name. Absolute paths to those directories are rewritten relative to
+// nginx.conf, so the unpacked tree can be checked in place, e.g. with
+// "gixy nginx.conf". Directories that don't exist are left out.
+func (m *Manager) Export(w io.Writer, now time.Time) error {
+	dirs := m.exportDirs()
+	paths := make([]*regexp.Regexp, len(dirs))
+	for i, d := range dirs {
+		paths[i] = regexp.MustCompile(`(?m)(^|[\s"'])` + regexp.QuoteMeta(filepath.Clean(d.Path)) + `/`)
+	}
+	rewrite := func(b []byte) []byte {
+		for i, re := range paths {
+			b = re.ReplaceAll(b, []byte("${1}"+dirs[i].Name+"/"))
+		}
+		return b
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	main, err := os.ReadFile(m.NginxConf)
+	switch {
+	case err == nil:
+		if err := add("nginx.conf", rewrite(main)); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	for _, d := range dirs {
+		files, err := filepath.Glob(filepath.Join(d.Path, d.Glob))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if err := add(d.Name+"/"+filepath.Base(f), rewrite(data)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,65 @@
+package nginx
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	base := t.TempDir()
+	m := NewManager(filepath.Join(base, "hubfly"))
+	if err := m.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	m.NginxConf = filepath.Join(base, "nginx", "nginx.conf")
+	m.WAFDir = filepath.Join(base, "nginx", "modsec")
+	os.MkdirAll(m.WAFDir, 0755)
+	os.WriteFile(m.NginxConf, []byte("http {\n    include "+m.SitesDir+"/*.conf;\n}\nstream {\n    include "+m.StreamsDir+"/*.conf;\n}\n"), 0644)
+	os.WriteFile(filepath.Join(m.WAFDir, "modsecurity.conf"), []byte("SecRuleEngine On\n"), 0644)
+	os.WriteFile(m.SiteConfigFile("a.local"), []byte("modsecurity_rules_file "+m.WAFDir+"/modsecurity.conf;\n"), 0644)
+	os.WriteFile(PreviousConfigFile(m.SiteConfigFile("a.local")), []byte("old"), 0644)
+	os.WriteFile(m.StreamConfigFile(5432), []byte("server { listen 5432; }\n"), 0644)
+
+	var buf bytes.Buffer
+	if err := m.Export(&buf, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(data)
+	}
+
+	want := map[string]string{
+		"nginx.conf":              "http {\n    include sites/*.conf;\n}\nstream {\n    include streams/*.conf;\n}\n",
+		"sites/a.local.conf":      "modsecurity_rules_file modsec/modsecurity.conf;\n",
+		"streams/port_5432.conf":  "server { listen 5432; }\n",
+		"modsec/modsecurity.conf": "SecRuleEngine On\n",
+	}
+	if len(files) != len(want) {
+		t.Errorf("Expected %d files, got %v", len(want), files)
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s: expected %q, got %q", name, content, files[name])
+		}
+	}
+}
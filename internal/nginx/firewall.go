@@ -0,0 +1,49 @@
+package nginx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// traversalPatterns match path traversal attempts in the raw $request_uri,
+// which is forwarded to upstreams unnormalized when proxy_pass uses a
+// variable. Backslashes are matched as \x5c so the pattern survives nginx's
+// string unescaping unchanged.
+var traversalPatterns = []string{
+	`(\.|%2e)(\.|%2e)(/|\x5c|%2f|%5c)`,       // ../ with any dot/slash encoded
+	`(/|\x5c|%2f|%5c)(\.|%2e)(\.|%2e)($|\?)`, // trailing /..
+	`%25(2e|2f|5c|00)`,                       // double encoding
+	`%00`,                                    // null byte
+	`%c0%(ae|af)|%e0%80%ae|%c1%9c`,           // overlong UTF-8 dot/slash
+}
+
+// traversalPattern is the combined case-insensitive regex for traversalPatterns.
+func traversalPattern() string {
+	return strings.Join(traversalPatterns, "|")
+}
+
+// extensionPatterns normalizes file extensions (".php", "env") into escaped
+// regex alternatives for the extension blocking location.
+func extensionPatterns(exts []string) []string {
+	out := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+		if ext == "" {
+			continue
+		}
+		out = append(out, regexp.QuoteMeta(ext))
+	}
+	return out
+}
+
+// quoteRegexes escapes literal values (e.g. content types) for use inside an
+// nginx regex.
+func quoteRegexes(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, regexp.QuoteMeta(v))
+		}
+	}
+	return out
+}
@@ -2,6 +2,7 @@ package nginx
 
 import (
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -246,4 +247,140 @@ func TestSSLConfig(t *testing.T) {
 			t.Errorf("Config missing SSL directive: %s", s)
 		}
 	}
+
+	// A wildcard site serves the shared lineage.
+	site.Domain = "app.ssl.local"
+	site.Wildcard = "ssl.local"
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(string(config), "ssl_certificate /etc/letsencrypt/live/_wildcard.ssl.local/fullchain.pem;") {
+		t.Errorf("Wildcard site should use the shared certificate lineage")
+	}
+}
+
+func TestFirewallExtensionAndContentTypeBlocking(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:        "test-ext",
+		Domain:    "ext.local",
+		Upstreams: []string{"127.0.0.1:8080"},
+		SSL:       true,
+		Firewall: &models.FirewallConfig{
+			BlockRules: &models.BlockRules{
+				Extensions:   []string{".php", "env", "git"},
+				ContentTypes: []string{"application/x-php", "application/x-sh"},
+			},
+		},
+	}
+
+	configFile, err := mgr.GenerateConfig(site)
+	if err != nil {
+		t.Fatalf("GenerateConfig failed: %v", err)
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configStr := string(content)
+
+	extRule := `location ~* \.(php|env|git)(/|$) { return 403; }`
+	if n := strings.Count(configStr, extRule); n != 2 {
+		t.Errorf("Expected extension rule in HTTP and HTTPS servers, found %d", n)
+	}
+	ctRule := `if ($content_type ~* "^(application/x-php|application/x-sh)") { return 415; }`
+	if !strings.Contains(configStr, ctRule) {
+		t.Errorf("Config missing content-type rule: %s", ctRule)
+	}
+}
+
+func TestFirewallTraversalBlocking(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_traversal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:        "test.traversal",
+		Domain:    "traversal.local",
+		Upstreams: []string{"127.0.0.1:8080"},
+		Firewall:  &models.FirewallConfig{BlockTraversal: true},
+	}
+
+	configFile, err := mgr.GenerateConfig(site)
+	if err != nil {
+		t.Fatalf("GenerateConfig failed: %v", err)
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configStr := string(content)
+
+	expectedStrings := []string{
+		"map $request_uri $traversal_test_traversal_8b96d107 {",
+		"if ($traversal_test_traversal_8b96d107) { return 400; }",
+		"access_log /var/log/hubfly/test.traversal.security.log hubfly if=$traversal_test_traversal_8b96d107;",
+	}
+	for _, s := range expectedStrings {
+		if !strings.Contains(configStr, s) {
+			t.Errorf("Config missing traversal rule: %s", s)
+		}
+	}
+
+	// The rendered pattern is PCRE; the subset used is RE2 compatible.
+	re := regexp.MustCompile("(?i)" + traversalPattern())
+
+	blocked := []string{
+		"/static/../etc/passwd",
+		"/static/%2e%2e/etc/passwd",
+		"/static/%2E%2E%2Fetc/passwd",
+		"/static/.%2e/etc/passwd",
+		"/static/..%2fetc/passwd",
+		"/static/..%5cwindows",
+		`/static/..\windows`,
+		"/static/%252e%252e/etc/passwd",
+		"/static/%252fetc",
+		"/download?file=report.pdf%00.txt",
+		"/static/%c0%ae%c0%ae/etc/passwd",
+		"/files/..",
+		"/files/%2e%2e?x=1",
+	}
+	for _, uri := range blocked {
+		if !re.MatchString(uri) {
+			t.Errorf("Expected %q to be blocked", uri)
+		}
+	}
+
+	allowed := []string{
+		"/",
+		"/index.html",
+		"/assets/app.min.js",
+		"/search?q=a%20b",
+		"/files/report..2025.pdf",
+		"/path/%2525",
+	}
+	for _, uri := range allowed {
+		if re.MatchString(uri) {
+			t.Errorf("Expected %q to be allowed", uri)
+		}
+	}
 }
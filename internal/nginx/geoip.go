@@ -0,0 +1,89 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// geoBlock is a site's country rules, ready to render as a geoip2 lookup
+// and a map to $geo_blocked_<id>.
+type geoBlock struct {
+	DB      string
+	Default int // For countries in neither list
+	Unknown int // For clients the database has no country for
+	Allow   []string
+	Deny    []string
+}
+
+// CheckCountries validates firewall country rules.
+func CheckCountries(c *models.CountryRules) error {
+	if c == nil {
+		return nil
+	}
+	seen := make(map[string]string)
+	for _, list := range []struct {
+		name  string
+		codes []string
+	}{{"allow", c.Allow}, {"deny", c.Deny}} {
+		for _, code := range list.codes {
+			if !isCountryCode(code) {
+				return fmt.Errorf("firewall countries: %q is not a two-letter ISO country code", code)
+			}
+			code = strings.ToUpper(code)
+			if other, ok := seen[code]; ok {
+				if other == list.name {
+					return fmt.Errorf("firewall countries: %s is listed twice", code)
+				}
+				return fmt.Errorf("firewall countries: %s is in both allow and deny", code)
+			}
+			seen[code] = list.name
+		}
+	}
+	return nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// geoRules returns the site's country rules, or nil when it has none. They
+// need the geoip2 module and a MaxMind database (GeoIPDB).
+func (m *Manager) geoRules(site *models.Site) (*geoBlock, error) {
+	if site.Firewall == nil || site.Firewall.Countries == nil {
+		return nil, nil
+	}
+	c := site.Firewall.Countries
+	if err := CheckCountries(c); err != nil {
+		return nil, err
+	}
+	if len(c.Allow) == 0 && len(c.Deny) == 0 {
+		return nil, nil
+	}
+	if m.GeoIPDB == "" {
+		return nil, fmt.Errorf("firewall countries need a GeoIP database (--geoip-db)")
+	}
+	g := &geoBlock{DB: m.GeoIPDB}
+	if len(c.Allow) > 0 {
+		g.Default = 1
+		if !c.AllowUnknown {
+			g.Unknown = 1
+		}
+	}
+	for _, code := range c.Allow {
+		g.Allow = append(g.Allow, strings.ToUpper(code))
+	}
+	for _, code := range c.Deny {
+		g.Deny = append(g.Deny, strings.ToUpper(code))
+	}
+	return g, nil
+}
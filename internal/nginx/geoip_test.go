@@ -0,0 +1,67 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestFirewallCountries(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "geo.local", Domain: "geo.local", Upstreams: []string{"app:80"},
+		Firewall: &models.FirewallConfig{Countries: &models.CountryRules{Allow: []string{"de", "FR"}}},
+		Routes:   []models.RouteOverride{{Path: "/api/", ReadTimeout: 30}},
+	}
+	if _, err := mgr.Render(site); err == nil || !strings.Contains(err.Error(), "GeoIP database") {
+		t.Fatalf("Expected country rules without a database to fail, got %v", err)
+	}
+
+	mgr.GeoIPDB = "/etc/hubfly/geoip.mmdb"
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		`geoip2 "/etc/hubfly/geoip.mmdb" {`,
+		"$geoip2_country_geo_local_5d55be4d country iso_code;",
+		"map $geoip2_country_geo_local_5d55be4d $geo_blocked_geo_local_5d55be4d {",
+		"default 1;",
+		`"" 1;`,
+		"DE 0;",
+		"FR 0;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in:\n%s", want, cfg)
+		}
+	}
+	// Root location and the route, which doesn't inherit "if".
+	if n := strings.Count(cfg, "if ($geo_blocked_geo_local_5d55be4d) { return 403; }"); n != 2 {
+		t.Errorf("Expected the country check twice, got %d in:\n%s", n, cfg)
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	site.Firewall.Countries = &models.CountryRules{Deny: []string{"KP"}}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := string(config); !strings.Contains(cfg, "default 0;") || !strings.Contains(cfg, `"" 0;`) || !strings.Contains(cfg, "KP 1;") {
+		t.Errorf("Expected a deny list to pass other and unknown countries:\n%s", cfg)
+	}
+
+	for _, bad := range []models.CountryRules{
+		{Allow: []string{"USA"}},
+		{Deny: []string{"1A"}},
+		{Allow: []string{"US"}, Deny: []string{"us"}},
+		{Deny: []string{"CN", "cn"}},
+	} {
+		if err := CheckCountries(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Upstream protocols of sites and routes. Empty means HTTP.
+const (
+	ProtocolHTTP  = "http"
+	ProtocolGRPC  = "grpc"
+	ProtocolGRPCS = "grpcs" // gRPC over TLS to the upstream
+)
+
+// grpcHeaderDefaults are the grpc_set_header directives of gRPC locations,
+// unless the site's proxy_set_header sets the same header.
+var grpcHeaderDefaults = map[string]string{
+	"Host":              "$host",
+	"X-Real-IP":         "$remote_addr",
+	"X-Forwarded-For":   "$proxy_add_x_forwarded_for",
+	"X-Forwarded-Proto": "$scheme",
+}
+
+// CheckProtocol validates the protocol of a site and its routes. gRPC
+// messages are binary frames, so a gRPC site cannot rewrite response
+// bodies or mirror requests (mirrors are sent over HTTP/1.1).
+func CheckProtocol(site *models.Site) error {
+	if !validProtocol(site.Protocol) {
+		return fmt.Errorf("protocol must be http, grpc or grpcs, got %q", site.Protocol)
+	}
+	for _, r := range site.Routes {
+		if !validProtocol(r.Protocol) {
+			return fmt.Errorf("routes: %s: protocol must be http, grpc or grpcs, got %q", r.Path, r.Protocol)
+		}
+	}
+	if !isGRPC(site.Protocol) {
+		return nil
+	}
+	if site.ResponseRewrite != nil {
+		return fmt.Errorf("response_rewrite is not supported for gRPC sites")
+	}
+	if site.TrafficMirror != nil {
+		return fmt.Errorf("traffic_mirror is not supported for gRPC sites")
+	}
+	return nil
+}
+
+func validProtocol(p string) bool {
+	return p == "" || p == ProtocolHTTP || p == ProtocolGRPC || p == ProtocolGRPCS
+}
+
+func isGRPC(p string) bool {
+	return p == ProtocolGRPC || p == ProtocolGRPCS
+}
+
+// upstreamScheme is the URL scheme upstreams are passed with.
+func upstreamScheme(p string) string {
+	if isGRPC(p) {
+		return p
+	}
+	return ProtocolHTTP
+}
+
+// routeProtocol is the protocol a route proxies with: its own, or the site's.
+func routeProtocol(site *models.Site, r models.RouteOverride) string {
+	if r.Protocol != "" {
+		return r.Protocol
+	}
+	return site.Protocol
+}
+
+// usesGRPC reports whether the site or one of its routes proxies gRPC,
+// which needs HTTP/2 on the plain listener as well.
+func usesGRPC(site *models.Site) bool {
+	for _, r := range site.Routes {
+		if isGRPC(routeProtocol(site, r)) {
+			return true
+		}
+	}
+	return isGRPC(site.Protocol)
+}
+
+// grpcHeaders are grpcHeaderDefaults overlaid with the site's
+// proxy_set_header, which nginx only applies to proxy_pass.
+func grpcHeaders(site *models.Site) map[string]string {
+	headers := make(map[string]string, len(grpcHeaderDefaults)+len(site.ProxySetHeaders))
+	for k, v := range grpcHeaderDefaults {
+		headers[k] = v
+	}
+	if site.UpstreamHost != "" {
+		headers["Host"] = site.UpstreamHost
+	}
+	for k, v := range site.ProxySetHeaders {
+		for d := range grpcHeaderDefaults {
+			if strings.EqualFold(k, d) {
+				delete(headers, d)
+			}
+		}
+		headers[k] = v
+	}
+	return headers
+}
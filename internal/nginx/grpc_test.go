@@ -0,0 +1,72 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestGRPCSite(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "api.local", Domain: "api.local", Upstreams: []string{"greeter:50051"},
+		Protocol:        ProtocolGRPC,
+		ProxySetHeaders: map[string]string{"host": "greeter.internal"},
+		Routes: []models.RouteOverride{
+			{Path: "/helloworld.Greeter/", ReadTimeout: 3600},
+			{Path: "/healthz", Protocol: ProtocolHTTP},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"listen 80;\n    http2 on;",
+		`set $upstream_endpoint "grpc://greeter:50051";`,
+		"grpc_pass $upstream_endpoint;",
+		"grpc_set_header host greeter.internal;",
+		"grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;",
+		"grpc_read_timeout 3600s;",
+		`set $upstream_endpoint "http://greeter:50051";`,
+		"proxy_set_header host greeter.internal;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if strings.Contains(cfg, "grpc_set_header Host $host;") {
+		t.Errorf("Expected proxy_set_header to replace the default Host:\n%s", cfg)
+	}
+	if strings.Contains(cfg, "proxy_read_timeout") {
+		t.Errorf("Expected gRPC routes to use grpc_* timeouts:\n%s", cfg)
+	}
+
+	// An HTTP site can send one route to a gRPC service.
+	site.Protocol = ""
+	site.Routes = []models.RouteOverride{{Path: "/helloworld.Greeter/", Protocol: ProtocolGRPCS}}
+	config, _ = mgr.Render(site)
+	cfg = string(config)
+	if !strings.Contains(cfg, `set $upstream_endpoint "grpcs://greeter:50051";`) || !strings.Contains(cfg, "grpc_set_header X-Real-IP $remote_addr;") || !strings.Contains(cfg, "http2 on;") {
+		t.Errorf("Expected a gRPC route with its own headers:\n%s", cfg)
+	}
+
+	site.Routes = nil
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "grpc") || strings.Contains(string(config), "http2 on;\n    server_name") {
+		t.Errorf("Expected a plain HTTP site:\n%s", config)
+	}
+
+	for _, bad := range []*models.Site{
+		{Protocol: "h2c"},
+		{Routes: []models.RouteOverride{{Path: "/a/", Protocol: "udp"}}},
+		{Protocol: ProtocolGRPC, TrafficMirror: &models.Mirror{Upstream: "shadow:50051"}},
+		{Protocol: ProtocolGRPC, ResponseRewrite: &models.ResponseRewrite{}},
+	} {
+		if CheckProtocol(bad) == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// quicReuseport is the listen option only one server per address may set.
+const quicReuseport = "quic reuseport"
+
+// SupportsHTTP3 reports an error unless the nginx binary was built with
+// the HTTP/3 module, which QUIC listeners need.
+func (m *Manager) SupportsHTTP3() error {
+	info, err := m.Info()
+	if err != nil {
+		return fmt.Errorf("http3: cannot check the nginx build: %w", err)
+	}
+	if !slices.Contains(info.Modules, "http_v3_module") {
+		return fmt.Errorf("http3 needs nginx built with --with-http_v3_module (nginx %s is not)", info.Version)
+	}
+	return nil
+}
+
+// ownsReuseport reports whether the site's QUIC listener should carry
+// reuseport: nginx refuses a second listen 443 quic with socket options,
+// so the option goes to whichever HTTP/3 site was applied first. When
+// that site goes, the others keep listening without it until one of them
+// is applied again.
+func (m *Manager) ownsReuseport(siteID string) bool {
+	own := m.SiteConfigFile(siteID)
+	files, _ := filepath.Glob(filepath.Join(m.SitesDir, "*.conf"))
+	for _, f := range files {
+		if f == own {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err == nil && bytes.Contains(data, []byte("listen 443 "+quicReuseport)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package nginx
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestHTTP3(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	site := &models.Site{ID: "app.local", Domain: "app.local", Upstreams: []string{"app:80"}, SSL: true, HTTP3: true}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"listen 443 ssl;\n    listen 443 quic reuseport;",
+		"map $https $alt_svc_app_local_1a79d0dc {\n    on 'h3=\":443\"; ma=86400';\n    default \"\";\n}",
+		"add_header Alt-Svc $alt_svc_app_local_1a79d0dc always;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// Only the first HTTP/3 site sets reuseport; re-rendering it keeps it.
+	os.WriteFile(mgr.SiteConfigFile(site.ID), config, 0644)
+	config, _ = mgr.Render(site)
+	if !strings.Contains(string(config), "listen 443 quic reuseport;") {
+		t.Errorf("Expected the site to keep reuseport:\n%s", config)
+	}
+	other := &models.Site{ID: "b.local", Domain: "b.local", Upstreams: []string{"b:80"}, SSL: true, HTTP3: true}
+	config, _ = mgr.Render(other)
+	if !strings.Contains(string(config), "listen 443 quic;") {
+		t.Errorf("Expected a second QUIC listener without reuseport:\n%s", config)
+	}
+
+	site.HTTP3 = false
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "quic") || strings.Contains(string(config), "Alt-Svc") {
+		t.Errorf("Expected no QUIC listener:\n%s", config)
+	}
+}
@@ -0,0 +1,107 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// HygienePresets are the named starting points for connection hygiene.
+// "hardened" gives slow clients 10 seconds per read or write and keeps
+// headers small; raise large_header_buffer_size if clients with large
+// cookies get "400 Request Header Or Cookie Too Large".
+var HygienePresets = map[string]models.ConnectionHygiene{
+	"hardened": {
+		ClientHeaderTimeout: 10,
+		ClientBodyTimeout:   10,
+		SendTimeout:         10,
+		KeepaliveRequests:   100,
+		HeaderBuffers:       4,
+		HeaderBufferSize:    "4k",
+	},
+}
+
+// maxHygieneTimeout bounds hygiene timeouts (one hour).
+const maxHygieneTimeout = 3600
+
+var bufferSizePattern = regexp.MustCompile(`^([0-9]+)([kK]?)$`)
+
+// CheckHygiene validates connection hygiene settings.
+func CheckHygiene(h *models.ConnectionHygiene) error {
+	if h == nil {
+		return nil
+	}
+	if _, ok := HygienePresets[h.Preset]; !ok && h.Preset != "" && h.Preset != "none" {
+		return fmt.Errorf("connection_hygiene: unknown preset %q (use hardened or none)", h.Preset)
+	}
+	for _, t := range []int{h.ClientHeaderTimeout, h.ClientBodyTimeout, h.SendTimeout} {
+		if t < 0 || t > maxHygieneTimeout {
+			return fmt.Errorf("connection_hygiene: timeouts must be between 0 and %d seconds", maxHygieneTimeout)
+		}
+	}
+	if h.KeepaliveRequests < 0 || h.KeepaliveRequests > 100000 {
+		return fmt.Errorf("connection_hygiene: keepalive_requests must be between 0 and 100000")
+	}
+	if h.HeaderBuffers < 0 || h.HeaderBuffers > 64 {
+		return fmt.Errorf("connection_hygiene: large_header_buffers must be between 0 and 64")
+	}
+	if h.HeaderBufferSize != "" {
+		m := bufferSizePattern.FindStringSubmatch(h.HeaderBufferSize)
+		if m == nil {
+			return fmt.Errorf("connection_hygiene: invalid large_header_buffer_size %q (use bytes or k, e.g. 8k)", h.HeaderBufferSize)
+		}
+		n, _ := strconv.Atoi(m[1])
+		if m[2] != "" {
+			n *= 1024
+		}
+		if n < 1024 || n > 64*1024 {
+			return fmt.Errorf("connection_hygiene: large_header_buffer_size must be between 1k and 64k")
+		}
+	}
+	return nil
+}
+
+// resolveHygiene returns the settings rendered for a site: its own, or the
+// global default, with the preset filled in under explicit values. Nil
+// means nginx's defaults.
+func resolveHygiene(site, def *models.ConnectionHygiene) *models.ConnectionHygiene {
+	h := site
+	if h == nil {
+		h = def
+	}
+	if h == nil || h.Preset == "none" {
+		return nil
+	}
+	out := HygienePresets[h.Preset]
+	if h.ClientHeaderTimeout > 0 {
+		out.ClientHeaderTimeout = h.ClientHeaderTimeout
+	}
+	if h.ClientBodyTimeout > 0 {
+		out.ClientBodyTimeout = h.ClientBodyTimeout
+	}
+	if h.SendTimeout > 0 {
+		out.SendTimeout = h.SendTimeout
+	}
+	if h.KeepaliveRequests > 0 {
+		out.KeepaliveRequests = h.KeepaliveRequests
+	}
+	if h.HeaderBuffers > 0 {
+		out.HeaderBuffers = h.HeaderBuffers
+	}
+	if h.HeaderBufferSize != "" {
+		out.HeaderBufferSize = strings.ToLower(h.HeaderBufferSize)
+	}
+	// large_client_header_buffers needs both; fill in nginx's defaults.
+	if out.HeaderBuffers > 0 && out.HeaderBufferSize == "" {
+		out.HeaderBufferSize = "8k"
+	} else if out.HeaderBufferSize != "" && out.HeaderBuffers == 0 {
+		out.HeaderBuffers = 4
+	}
+	if out == (models.ConnectionHygiene{}) {
+		return nil
+	}
+	return &out
+}
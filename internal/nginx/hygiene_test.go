@@ -0,0 +1,70 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestConnectionHygiene(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	mgr.DefaultHygiene = &models.ConnectionHygiene{Preset: "hardened"}
+
+	site := &models.Site{ID: "hy.local", Domain: "hy.local", Upstreams: []string{"app:80"}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"client_header_timeout 10s;",
+		"client_body_timeout 10s;",
+		"send_timeout 10s;",
+		"keepalive_requests 100;",
+		"large_client_header_buffers 4 4k;",
+	} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("Expected the global default %q in:\n%s", want, config)
+		}
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	// Site values override the preset they start from.
+	site.Hygiene = &models.ConnectionHygiene{Preset: "hardened", ClientBodyTimeout: 60, HeaderBufferSize: "16k"}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"client_header_timeout 10s;", "client_body_timeout 60s;", "large_client_header_buffers 4 16k;"} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("Expected %q in:\n%s", want, config)
+		}
+	}
+
+	// "none" opts out of the global default.
+	site.Hygiene = &models.ConnectionHygiene{Preset: "none"}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "client_header_timeout") {
+		t.Errorf("Expected no hygiene directives with preset none:\n%s", config)
+	}
+
+	for _, bad := range []models.ConnectionHygiene{
+		{Preset: "paranoid"},
+		{ClientHeaderTimeout: -1},
+		{SendTimeout: 7200},
+		{KeepaliveRequests: -5},
+		{HeaderBuffers: 100},
+		{HeaderBufferSize: "8m"},
+		{HeaderBufferSize: "128k"},
+		{HeaderBufferSize: "4k; deny all"},
+	} {
+		if err := CheckHygiene(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package nginx
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BuildInfo is what `nginx -V` reports about the running binary.
+type BuildInfo struct {
+	Version       string   `json:"version"`
+	BuiltWith     string   `json:"built_with,omitempty"` // TLS library, e.g. "OpenSSL 3.1.4 24 Oct 2023"
+	Modules       []string `json:"modules"`
+	ConfigureArgs []string `json:"configure_args"`
+}
+
+// Info runs `nginx -V` and parses its output.
+func (m *Manager) Info() (*BuildInfo, error) {
+	path, err := exec.LookPath("nginx")
+	if err != nil {
+		return nil, fmt.Errorf("nginx not found")
+	}
+	// nginx prints its version and build flags to stderr.
+	out, err := exec.Command(path, "-V").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("nginx -V failed: %s, output: %s", err, string(out))
+	}
+	info := ParseBuildInfo(string(out))
+	return &info, nil
+}
+
+// ParseBuildInfo parses `nginx -V` output. Modules are the compiled-in
+// --with-*_module flags plus --add-module/--add-dynamic-module names.
+func ParseBuildInfo(out string) BuildInfo {
+	info := BuildInfo{Modules: []string{}, ConfigureArgs: []string{}}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "nginx version:"):
+			v := strings.TrimSpace(strings.TrimPrefix(line, "nginx version:"))
+			info.Version = strings.TrimPrefix(v, "nginx/")
+		case strings.HasPrefix(line, "built with "):
+			info.BuiltWith = strings.TrimPrefix(line, "built with ")
+		case strings.HasPrefix(line, "configure arguments:"):
+			info.ConfigureArgs = strings.Fields(strings.TrimPrefix(line, "configure arguments:"))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, arg := range info.ConfigureArgs {
+		var name string
+		switch {
+		case strings.HasPrefix(arg, "--with-"):
+			name = strings.TrimSuffix(strings.TrimPrefix(arg, "--with-"), "=dynamic")
+			if !strings.HasSuffix(name, "_module") && name != "stream" && name != "mail" {
+				continue // --with-cc-opt=..., --with-threads, ...
+			}
+		case strings.HasPrefix(arg, "--add-module="), strings.HasPrefix(arg, "--add-dynamic-module="):
+			name = addonName(arg[strings.Index(arg, "=")+1:])
+		default:
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			info.Modules = append(info.Modules, name)
+		}
+	}
+	sort.Strings(info.Modules)
+	return info
+}
+
+// addonName names a third-party module after its source directory. Some
+// keep the nginx glue in a "nginx" subdirectory (njs), so use the parent.
+func addonName(dir string) string {
+	dir = strings.TrimSuffix(dir, "/")
+	if filepath.Base(dir) == "nginx" {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Base(dir)
+}
+
+// ManagedFiles counts the config files hubfly has written.
+type ManagedFiles struct {
+	Sites   int `json:"sites"`
+	Streams int `json:"streams"`
+	Staging int `json:"staging"` // Leftovers of interrupted applies
+}
+
+// Inventory counts the .conf files in the managed directories.
+func (m *Manager) Inventory() ManagedFiles {
+	count := func(dir string) int {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+		return len(files)
+	}
+	return ManagedFiles{
+		Sites:   count(m.SitesDir),
+		Streams: count(m.StreamsDir),
+		Staging: count(m.StagingDir),
+	}
+}
@@ -0,0 +1,51 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const nginxV = `nginx version: nginx/1.26.2
+built by gcc 13.2.1 20240309 (Alpine 13.2.1_git20240309)
+built with OpenSSL 3.3.0 9 Apr 2024 (running with OpenSSL 3.3.2 3 Sep 2024)
+TLS SNI support enabled
+configure arguments: --prefix=/etc/nginx --with-http_ssl_module --with-http_v2_module --with-stream=dynamic --with-stream_ssl_module --with-http_sub_module --with-http_geoip_module=dynamic --with-threads --add-dynamic-module=/build/njs-0.8.4/nginx
+`
+
+func TestParseBuildInfo(t *testing.T) {
+	info := ParseBuildInfo(nginxV)
+	if info.Version != "1.26.2" {
+		t.Errorf("Version = %q", info.Version)
+	}
+	if !strings.HasPrefix(info.BuiltWith, "OpenSSL 3.3.0") {
+		t.Errorf("BuiltWith = %q", info.BuiltWith)
+	}
+	want := []string{"http_geoip_module", "http_ssl_module", "http_sub_module", "http_v2_module", "njs-0.8.4", "stream", "stream_ssl_module"}
+	if strings.Join(info.Modules, ",") != strings.Join(want, ",") {
+		t.Errorf("Modules = %v, want %v", info.Modules, want)
+	}
+	if len(info.ConfigureArgs) != 9 {
+		t.Errorf("ConfigureArgs = %v", info.ConfigureArgs)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"sites/a.conf", "sites/b.conf", "sites/notes.txt", "streams/30001.conf"} {
+		os.WriteFile(filepath.Join(tmpDir, f), nil, 0644)
+	}
+	if got := mgr.Inventory(); got != (ManagedFiles{Sites: 2, Streams: 1}) {
+		t.Errorf("Inventory = %+v", got)
+	}
+}
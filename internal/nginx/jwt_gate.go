@@ -0,0 +1,122 @@
+package nginx
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultAuthAddr is the API listener nginx asks to validate JWTs.
+const DefaultAuthAddr = "127.0.0.1:81"
+
+const (
+	maxJWTLeeway = 300
+	maxJWKSCache = 86400
+)
+
+// jwtGate is a site's JWT validation, ready to render. Each gate is an
+// internal location that auth_request sends a bodiless GET to; the API
+// answers 204 for a valid token and 401 otherwise.
+type jwtGate struct {
+	Site       bool // The site has a gate, on / and the locations beside it
+	Validators []jwtValidator
+	routes     map[string]string // Route path to its auth_request argument
+}
+
+type jwtValidator struct {
+	Location string
+	URL      string
+}
+
+// CheckJWTGate validates the JWT gates of a site and its routes.
+func CheckJWTGate(site *models.Site) error {
+	if err := checkJWTGate("jwt_gate", site.JWTGate, false); err != nil {
+		return err
+	}
+	for _, r := range site.Routes {
+		if err := checkJWTGate(fmt.Sprintf("routes[%s].jwt_gate", r.Path), r.JWTGate, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkJWTGate(section string, g *models.JWTGate, route bool) error {
+	if g == nil {
+		return nil
+	}
+	if g.Disabled {
+		if !route {
+			return fmt.Errorf("%s: disabled only applies to routes; remove the gate instead", section)
+		}
+		return nil
+	}
+	u, err := url.Parse(g.JWKSURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%s: jwks_url must be an http(s) URL, got %q", section, g.JWKSURL)
+	}
+	if g.Header != "" && g.Cookie != "" {
+		return fmt.Errorf("%s: set header or cookie, not both", section)
+	}
+	if g.Header != "" && !headerNameRegex.MatchString(g.Header) {
+		return fmt.Errorf("%s: invalid header name %q", section, g.Header)
+	}
+	if g.Cookie != "" && !cookieName.MatchString(g.Cookie) {
+		return fmt.Errorf("%s: invalid cookie name %q", section, g.Cookie)
+	}
+	for _, a := range g.Audience {
+		if a == "" {
+			return fmt.Errorf("%s: audience must not be empty", section)
+		}
+	}
+	if g.Leeway < 0 || g.Leeway > maxJWTLeeway {
+		return fmt.Errorf("%s: leeway_seconds must be 0-%d, got %d", section, maxJWTLeeway, g.Leeway)
+	}
+	if g.CacheSeconds < 0 || g.CacheSeconds > maxJWKSCache {
+		return fmt.Errorf("%s: jwks_cache_seconds must be 0-%d, got %d", section, maxJWKSCache, g.CacheSeconds)
+	}
+	return nil
+}
+
+// resolveJWTGate renders the gates of a site and its routes. Routes are
+// nested in the root location, so they inherit the site's auth_request
+// unless they have their own or turn it off. Route validators are
+// addressed by the route's index, and every validator passes its gate's
+// hash so the API rejects checks for a gate it no longer has.
+func (m *Manager) resolveJWTGate(site *models.Site) (*jwtGate, error) {
+	g := &jwtGate{routes: make(map[string]string)}
+	base := "http://" + m.AuthAddr + "/v1/auth/jwt/" + site.ID
+	if site.JWTGate != nil {
+		g.Site = true
+		g.Validators = append(g.Validators, jwtValidator{Location: "/_hubfly_jwt", URL: base + "?gate=" + site.JWTGate.Hash()})
+	}
+	for i, r := range site.Routes {
+		switch {
+		case r.JWTGate == nil:
+		case r.JWTGate.Disabled:
+			g.routes[r.Path] = "off"
+		default:
+			loc := "/_hubfly_jwt_" + strconv.Itoa(i)
+			g.Validators = append(g.Validators, jwtValidator{Location: loc, URL: base + "/" + strconv.Itoa(i) + "?gate=" + r.JWTGate.Hash()})
+			g.routes[r.Path] = loc
+		}
+	}
+	if len(g.Validators) == 0 && len(g.routes) == 0 {
+		return nil, nil
+	}
+	if len(g.Validators) > 0 && m.AuthAddr == "" {
+		return nil, fmt.Errorf("jwt_gate: no validator address is configured")
+	}
+	return g, nil
+}
+
+// route is the auth_request argument of a route, empty when it inherits
+// the site's.
+func (g *jwtGate) route(path string) string {
+	if g == nil {
+		return ""
+	}
+	return g.routes[path]
+}
@@ -0,0 +1,97 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestJWTGate(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	mgr.AuthAddr = "127.0.0.1:8081"
+	site := &models.Site{
+		ID: "app.local", Domain: "app.local", Upstreams: []string{"app:3000"}, SSL: true,
+		JWTGate: &models.JWTGate{JWKSURL: "https://id.example.com/.well-known/jwks.json", Issuer: "https://id.example.com"},
+		Routes: []models.RouteOverride{
+			{Path: "/public/", JWTGate: &models.JWTGate{Disabled: true}},
+			{Path: "/admin/", JWTGate: &models.JWTGate{JWKSURL: "https://id.example.com/jwks", Audience: []string{"admin"}}},
+			{Path: "/static/"},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"location = /_hubfly_jwt {\n        internal;\n        proxy_pass http://127.0.0.1:8081/v1/auth/jwt/app.local?gate=" + site.JWTGate.Hash() + ";",
+		"location = /_hubfly_jwt_1 {\n        internal;\n        proxy_pass http://127.0.0.1:8081/v1/auth/jwt/app.local/1?gate=" + site.Routes[1].JWTGate.Hash() + ";",
+		"proxy_method GET;",
+		"proxy_pass_request_body off;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	for _, route := range []struct{ path, want string }{
+		{"/public/", "auth_request off;"},
+		{"/admin/", "auth_request /_hubfly_jwt_1;"},
+	} {
+		i := strings.Index(cfg, "location "+route.path+" {")
+		if i < 0 || !strings.Contains(cfg[i:i+200], route.want) {
+			t.Errorf("Expected %q in route %s:\n%s", route.want, route.path, cfg)
+		}
+	}
+	if i := strings.Index(cfg, "location /static/ {"); i < 0 || strings.Contains(cfg[i:i+200], "auth_request") {
+		t.Errorf("Expected /static/ to inherit the site's gate:\n%s", cfg)
+	}
+	// Both root locations and the HTTPS server's /ws/.
+	if n := strings.Count(cfg, "auth_request /_hubfly_jwt;"); n != 3 {
+		t.Errorf("Expected the site gate in 3 locations, got %d:\n%s", n, cfg)
+	}
+	if n := strings.Count(cfg, "location = /_hubfly_jwt {"); n != 2 {
+		t.Errorf("Expected the validator in both servers, got %d", n)
+	}
+
+	// A port 80 that redirects still gates /ws/.
+	site.ForceSSL = true
+	config, _ = mgr.Render(site)
+	if n := strings.Count(string(config), "location = /_hubfly_jwt {"); n != 2 {
+		t.Errorf("Expected the validator in both servers with force_ssl, got %d", n)
+	}
+	site.ForceSSL = false
+
+	// No gate, no auth_request.
+	site.JWTGate = nil
+	site.Routes = nil
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "auth_request") {
+		t.Errorf("Expected no auth_request without a gate:\n%s", config)
+	}
+
+	for _, g := range []*models.JWTGate{
+		{},
+		{JWKSURL: "ftp://id.example.com/jwks"},
+		{JWKSURL: "https://id.example.com/jwks", Header: "X-Token", Cookie: "session"},
+		{JWKSURL: "https://id.example.com/jwks", Header: "X Token"},
+		{JWKSURL: "https://id.example.com/jwks", Cookie: "a;b"},
+		{JWKSURL: "https://id.example.com/jwks", Leeway: 301},
+		{JWKSURL: "https://id.example.com/jwks", CacheSeconds: -1},
+		{JWKSURL: "https://id.example.com/jwks", Audience: []string{""}},
+		{Disabled: true},
+	} {
+		if CheckJWTGate(&models.Site{JWTGate: g}) == nil {
+			t.Errorf("Expected %+v to be rejected", g)
+		}
+	}
+	if err := CheckJWTGate(&models.Site{Routes: []models.RouteOverride{{Path: "/", JWTGate: &models.JWTGate{Disabled: true}}}}); err != nil {
+		t.Errorf("Expected a disabled route gate to be valid, got %v", err)
+	}
+
+	mgr.AuthAddr = ""
+	site.JWTGate = &models.JWTGate{JWKSURL: "https://id.example.com/jwks"}
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected an error without a validator address")
+	}
+}
@@ -0,0 +1,52 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestUpstreamKeepalive(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{ID: "api.local", Domain: "api.local", Upstreams: []string{"api-1:80", "api-2:80"},
+		UpstreamKeepalive: &models.UpstreamKeepalive{Connections: 32, Timeout: 30}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"keepalive 32;",
+		"keepalive_timeout 30s;",
+		"proxy_http_version 1.1;",
+		`'' "";`,
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if strings.Contains(cfg, "keepalive_requests") || strings.Contains(cfg, "'' close;") {
+		t.Errorf("Unexpected keepalive settings:\n%s", cfg)
+	}
+
+	site.UpstreamKeepalive = nil
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "keepalive") || !strings.Contains(string(config), "'' close;") {
+		t.Errorf("Expected no keepalive by default:\n%s", config)
+	}
+
+	for _, bad := range []models.Site{
+		{Upstreams: []string{"api:80"}, UpstreamKeepalive: &models.UpstreamKeepalive{Connections: 8}},
+		{Upstreams: []string{"a:80", "b:80"}, UpstreamKeepalive: &models.UpstreamKeepalive{}},
+		{Upstreams: []string{"a:80", "b:80"}, UpstreamKeepalive: &models.UpstreamKeepalive{Connections: 8, Timeout: -1}},
+	} {
+		if err := CheckKeepalive(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad.UpstreamKeepalive)
+		}
+	}
+	single := &models.Site{Upstreams: []string{"api:80"}, LoadBalancing: &models.LoadBalancing{}, UpstreamKeepalive: &models.UpstreamKeepalive{Connections: 8}}
+	if err := CheckKeepalive(single); err != nil {
+		t.Errorf("Expected load_balancing to allow keepalive, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// LintWarning is a risky pattern found in a site's rendered config.
+type LintWarning struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity,omitempty"` // Security findings only: "high" or "medium"
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// ifSafe are the directives that behave predictably inside "if" in a
+// location ("if is evil" otherwise).
+var ifSafe = map[string]bool{"return": true, "rewrite": true, "set": true}
+
+// Lint renders the site and reports risky patterns in the result, including
+// template snippets and ExtraConfig. others are the remaining sites, used to
+// find server_name collisions. A config that fails to render or parse is
+// reported as a single warning.
+func (m *Manager) Lint(site *models.Site, others []models.Site) []LintWarning {
+	config, err := m.Render(site)
+	if err != nil {
+		return []LintWarning{{Rule: "render", Message: err.Error()}}
+	}
+	dirs, err := Parse(config)
+	if err != nil {
+		return []LintWarning{{Rule: "syntax", Message: err.Error()}}
+	}
+
+	warnings := append(lintDirectives(dirs), scanSecurity(dirs)...)
+	if other, name := FindServerNameConflict(site, others); other != nil {
+		warnings = append(warnings, LintWarning{
+			Rule:    "duplicate_server_name",
+			Message: fmt.Sprintf("server_name %s is also used by site %s; nginx will silently pick one", name, other.ID),
+		})
+	}
+	return warnings
+}
+
+func lintDirectives(dirs []*Directive) []LintWarning {
+	var warnings []LintWarning
+
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		switch d.Name {
+		case "if":
+			if !inside(parents, "location") {
+				return
+			}
+			for _, child := range d.Block {
+				if !ifSafe[child.Name] {
+					warnings = append(warnings, LintWarning{
+						Rule:    "if_in_location",
+						Message: fmt.Sprintf("%q inside \"if\" in a location behaves unpredictably; only return, rewrite and set are safe there", child.Name),
+						Line:    child.Line,
+					})
+				}
+			}
+		case "location":
+			if hasDirective(d.Block, "proxy_pass") && !setsHost(append(parents, d)) {
+				warnings = append(warnings, LintWarning{
+					Rule:    "missing_host_header",
+					Message: fmt.Sprintf("location %s proxies without proxy_set_header Host; the upstream receives its own address as Host", strings.Join(d.Args, " ")),
+					Line:    d.Line,
+				})
+			}
+		case "ssl_early_data":
+			if len(d.Args) == 1 && d.Args[0] == "on" {
+				warnings = append(warnings, LintWarning{
+					Rule:    "early_data_replay",
+					Message: "ssl_early_data lets an attacker replay requests sent in 0-RTT; the upstream must answer 425 to non-idempotent requests with Early-Data: 1",
+					Line:    d.Line,
+				})
+			}
+		case "client_max_body_size":
+			if len(d.Args) == 1 && d.Args[0] == "0" {
+				warnings = append(warnings, LintWarning{
+					Rule:    "unbounded_body_size",
+					Message: "client_max_body_size 0 disables the request body limit; set an explicit size",
+					Line:    d.Line,
+				})
+			}
+		}
+	})
+	return warnings
+}
+
+func inside(parents []*Directive, name string) bool {
+	for _, p := range parents {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDirective(block []*Directive, name string) bool {
+	for _, d := range block {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setsHost reports whether the innermost block that declares any
+// proxy_set_header also sets Host. nginx only inherits proxy_set_header
+// from the enclosing level when the current level declares none.
+func setsHost(chain []*Directive) bool {
+	for i := len(chain) - 1; i >= 0; i-- {
+		declared := false
+		for _, d := range chain[i].Block {
+			if d.Name != "proxy_set_header" || len(d.Args) == 0 {
+				continue
+			}
+			declared = true
+			if strings.EqualFold(d.Args[0], "Host") {
+				return true
+			}
+		}
+		if declared {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package nginx
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	config := `
+# comment
+server {
+    listen 80;
+    set $x "a ; { } \" b"; # trailing comment
+    location ~* \.(php|env)(/|$) { return 403; }
+    if ($request_method ~* "(POST|PUT)") { return 405; }
+}
+`
+	dirs, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(dirs) != 1 || dirs[0].Name != "server" || len(dirs[0].Block) != 4 {
+		t.Fatalf("Unexpected tree: %+v", dirs)
+	}
+	set := dirs[0].Block[1]
+	if set.Name != "set" || len(set.Args) != 2 || set.Args[1] != `a ; { } \" b` || set.Line != 5 {
+		t.Errorf("Unexpected set directive: %+v", set)
+	}
+	loc := dirs[0].Block[2]
+	if loc.Args[1] != `\.(php|env)(/|$)` || len(loc.Block) != 1 {
+		t.Errorf("Unexpected location: %+v", loc)
+	}
+
+	for _, bad := range []string{"server {", "listen 80", "}", `set $x "open;`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("Expected parse error for %q", bad)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:          "lint.local",
+		Domain:      "lint.local",
+		Upstreams:   []string{"app:80"},
+		ExtraConfig: "client_max_body_size 0;\nif ($http_x_debug) { proxy_pass http://debug; }",
+		Firewall: &models.FirewallConfig{
+			BlockRules: &models.BlockRules{Methods: []string{"TRACE"}},
+		},
+	}
+	others := []models.Site{{ID: "other", Domain: "LINT.local"}, {ID: "lint.local", Domain: "lint.local"}}
+
+	rules := map[string]int{}
+	for _, w := range mgr.Lint(site, others) {
+		rules[w.Rule]++
+	}
+	want := map[string]int{
+		"unbounded_body_size":   1,
+		"if_in_location":        1, // the generated "if ... return" is not flagged
+		"missing_host_header":   1,
+		"duplicate_server_name": 1,
+	}
+	for rule, n := range want {
+		if rules[rule] != n {
+			t.Errorf("rule %s: got %d warnings, want %d (all: %v)", rule, rules[rule], n, rules)
+		}
+	}
+
+	// Setting Host clears the header warning
+	site.ExtraConfig = ""
+	site.ProxySetHeaders = map[string]string{"Host": "$host"}
+	for _, w := range mgr.Lint(site, nil) {
+		t.Errorf("Unexpected warning: %+v", w)
+	}
+}
@@ -0,0 +1,164 @@
+package nginx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// maxLogFields bounds the fields of a log format.
+const maxLogFields = 64
+
+var (
+	logFieldPattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	logVariablePattern = regexp.MustCompile(`^\$[a-z_][a-z0-9_]*$`)
+)
+
+// CheckLogFormat validates a log format. Every field holds exactly one
+// variable, and one of them must be $time_local or $time_iso8601 so that
+// entries can be filtered and purged by time.
+func CheckLogFormat(f *models.LogFormat) error {
+	if !ValidTemplateName(f.Name) {
+		return fmt.Errorf("invalid log format name %q: use letters, digits, '-' and '_' (max 64)", f.Name)
+	}
+	if len(f.Fields) == 0 || len(f.Fields) > maxLogFields {
+		return fmt.Errorf("a log format needs between 1 and %d fields", maxLogFields)
+	}
+	seen := make(map[string]bool, len(f.Fields))
+	timed := false
+	for _, field := range f.Fields {
+		if !logFieldPattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q: use letters, digits and '_'", field.Name)
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("duplicate field %s", field.Name)
+		}
+		seen[field.Name] = true
+		if !logVariablePattern.MatchString(field.Variable) {
+			return fmt.Errorf("field %s: variable %q must be a single nginx variable such as $remote_addr", field.Name, field.Variable)
+		}
+		if field.Variable == "$time_local" || field.Variable == "$time_iso8601" {
+			timed = true
+		}
+	}
+	if !timed {
+		return fmt.Errorf("a log format needs a $time_local or $time_iso8601 field")
+	}
+	return nil
+}
+
+// logFormatName is the nginx log_format a site's access log uses. Each site
+// declares its own copy, so two sites sharing a format don't define the
+// same name twice.
+func logFormatName(site *models.Site) string {
+	if site.LogFormat == "" {
+		return "hubfly"
+	}
+	return "hubfly_fmt_" + ident(site.ID)
+}
+
+// logFormatDirective renders the log_format declaring a site's format.
+// escape=json keeps each entry a valid JSON object.
+func logFormatDirective(site *models.Site, f *models.LogFormat) string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, field := range f.Fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `"%s":"%s"`, field.Name, field.Variable)
+	}
+	b.WriteString("}")
+	return fmt.Sprintf("log_format %s escape=json '%s';", logFormatName(site), b.String())
+}
+
+func (m *Manager) logFormatPath(name string) string {
+	return filepath.Join(m.FormatsDir, name+".json")
+}
+
+// ListLogFormats returns every registered format, sorted by name.
+func (m *Manager) ListLogFormats() ([]models.LogFormat, error) {
+	entries, err := os.ReadDir(m.FormatsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.LogFormat{}, nil
+		}
+		return nil, err
+	}
+	formats := []models.LogFormat{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || !ValidTemplateName(name) {
+			continue
+		}
+		if f, err := m.GetLogFormat(name); err == nil {
+			formats = append(formats, *f)
+		}
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].Name < formats[j].Name })
+	return formats, nil
+}
+
+// GetLogFormat reads one format. A missing format returns an error
+// satisfying os.IsNotExist.
+func (m *Manager) GetLogFormat(name string) (*models.LogFormat, error) {
+	if !ValidTemplateName(name) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(m.logFormatPath(name))
+	if err != nil {
+		return nil, err
+	}
+	var f models.LogFormat
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("log format %s: %w", name, err)
+	}
+	f.Name = name
+	return &f, nil
+}
+
+// SaveLogFormat validates and writes a format, replacing any existing one.
+func (m *Manager) SaveLogFormat(f *models.LogFormat) error {
+	if err := CheckLogFormat(f); err != nil {
+		return err
+	}
+	f.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.FormatsDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.FormatsDir, "."+f.Name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.logFormatPath(f.Name))
+}
+
+// DeleteLogFormat removes a format.
+func (m *Manager) DeleteLogFormat(name string) error {
+	if !ValidTemplateName(name) {
+		return os.ErrNotExist
+	}
+	return os.Remove(m.logFormatPath(name))
+}
@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestLogFormats(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	f := &models.LogFormat{Name: "json", Fields: []models.LogField{
+		{Name: "ts", Variable: "$time_iso8601"},
+		{Name: "client", Variable: "$remote_addr"},
+		{Name: "request_id", Variable: "$request_id"},
+	}}
+	if err := mgr.SaveLogFormat(f); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := mgr.ListLogFormats(); len(list) != 1 || len(list[0].Fields) != 3 {
+		t.Errorf("Unexpected formats: %+v", list)
+	}
+
+	site := &models.Site{ID: "f.local", Domain: "f.local", Upstreams: []string{"app:80"}, LogFormat: "json"}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`log_format hubfly_fmt_f_local_4e0f8143 escape=json '{"ts":"$time_iso8601","client":"$remote_addr","request_id":"$request_id"}';`,
+		"access_log /var/log/hubfly/f.local.access.log hubfly_fmt_f_local_4e0f8143;",
+	} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("Expected %q in:\n%s", want, config)
+		}
+	}
+
+	// HTTPS traffic is logged in the same format, not only the redirects
+	ssl := *site
+	ssl.SSL, ssl.ForceSSL = true, true
+	file, err := mgr.GenerateConfig(&ssl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"access_log /var/log/hubfly/f.local.access.log hubfly_fmt_f_local_4e0f8143;",
+		"error_log /var/log/hubfly/f.local.error.log notice;",
+	} {
+		if n := strings.Count(string(generated), want); n != 2 {
+			t.Errorf("Expected %q in both servers, got %d in:\n%s", want, n, generated)
+		}
+	}
+
+	site.LogFormat = "missing"
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected an unknown log format to fail the render")
+	}
+
+	for _, bad := range []models.LogFormat{
+		{Name: "bad name", Fields: f.Fields},
+		{Name: "x"},
+		{Name: "x", Fields: []models.LogField{{Name: "client", Variable: "$remote_addr"}}},
+		{Name: "x", Fields: []models.LogField{{Name: "ts", Variable: "$time_local"}, {Name: "ts", Variable: "$status"}}},
+		{Name: "x", Fields: []models.LogField{{Name: "ts", Variable: "$time_local"}, {Name: "a", Variable: "$status'; evil"}}},
+		{Name: "x", Fields: []models.LogField{{Name: "ts", Variable: "$time_local"}, {Name: "a\"b", Variable: "$status"}}},
+	} {
+		if err := CheckLogFormat(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
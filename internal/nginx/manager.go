@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
 	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
 )
 
@@ -18,7 +23,29 @@ type Manager struct {
 	StreamsDir   string
 	StagingDir   string
 	TemplatesDir string
+	FormatsDir   string // Registered access log formats (JSON)
+	FilesDir     string // Files uploaded for sites' asset shields, per site
 	NginxConf    string // Path to main nginx.conf
+	StatusURL    string // stub_status endpoint, see DefaultStatusURL
+	GeoIPDB      string // MaxMind DB for firewall country rules (geoip2 module)
+	WAFDir       string // ModSecurity includes, see DefaultWAFDir
+	CacheRoot    string // Site proxy caches, see DefaultCacheRoot
+	CanaryAddr   string // HTTP listener for canary requests (empty disables), see DefaultCanaryAddr
+	AuthAddr     string // API listener that validates JWTs for jwt_gate, see DefaultAuthAddr
+
+	// DeployCheckHosts are the local addresses CheckDeployment probes;
+	// empty disables the check. See DefaultDeployCheckHosts.
+	DeployCheckHosts []string
+
+	Faults *faults.Injector // Failure injection (chaos mode); nil in normal operation
+
+	// DefaultHygiene is the connection hygiene of sites without their own.
+	DefaultHygiene *models.ConnectionHygiene
+	// ClientMaxBodySize is the request body limit of sites without their
+	// own, see DefaultClientMaxBodySize.
+	ClientMaxBodySize string
+
+	reloads reloadStats
 }
 
 func NewManager(baseDir string) *Manager {
@@ -27,13 +54,23 @@ func NewManager(baseDir string) *Manager {
 		StreamsDir:   filepath.Join(baseDir, "streams"),
 		StagingDir:   filepath.Join(baseDir, "staging"),
 		TemplatesDir: filepath.Join(baseDir, "templates"),
+		FormatsDir:   filepath.Join(baseDir, "log_formats"),
+		FilesDir:     filepath.Join(baseDir, "files"),
 		NginxConf:    "/etc/nginx/nginx.conf",
+		StatusURL:    DefaultStatusURL,
+		WAFDir:       DefaultWAFDir,
+		CacheRoot:    DefaultCacheRoot,
+		CanaryAddr:   DefaultCanaryAddr,
+		AuthAddr:     DefaultAuthAddr,
+
+		DeployCheckHosts:  DefaultDeployCheckHosts,
+		ClientMaxBodySize: DefaultClientMaxBodySize,
 	}
 }
 
 // EnsureDirs creates necessary directories
 func (m *Manager) EnsureDirs() error {
-	dirs := []string{m.SitesDir, m.StreamsDir, m.StagingDir, m.TemplatesDir}
+	dirs := []string{m.SitesDir, m.StreamsDir, m.StagingDir, m.TemplatesDir, m.FormatsDir}
 	for _, d := range dirs {
 		if err := os.MkdirAll(d, 0755); err != nil {
 			return err
@@ -44,266 +81,244 @@ func (m *Manager) EnsureDirs() error {
 
 // GenerateConfig renders the site config to a staging file.
 func (m *Manager) GenerateConfig(site *models.Site) (string, error) {
+	config, err := m.Render(site)
+	if err != nil {
+		return "", err
+	}
+
+	// nginx creates the last directory of a proxy_cache_path, not its parents.
+	if site.Cache != nil && site.Cache.Enabled {
+		if err := os.MkdirAll(m.CacheRoot, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	stagingFile := filepath.Join(m.StagingDir, site.ID+".conf")
+	if err := os.WriteFile(stagingFile, config, 0644); err != nil {
+		return "", err
+	}
+	slog.Debug("Generated staging config", "file", stagingFile)
+
+	return stagingFile, nil
+}
+
+// Render returns the site's nginx config without writing it anywhere.
+func (m *Manager) Render(site *models.Site) ([]byte, error) {
 	// Load templates
 	var templateContent strings.Builder
 	for _, tplName := range site.Templates {
-		content, err := os.ReadFile(filepath.Join(m.TemplatesDir, tplName+".conf"))
+		content, err := m.templateContent(tplName)
 		if err != nil {
-			// For MVP, we might log warning but here we fail
-			// If template not found, maybe ignore? stricter is better.
-			return "", fmt.Errorf("failed to load template %s: %w", tplName, err)
+			return nil, err
 		}
 		templateContent.Write(content)
 		templateContent.WriteString("\n")
 	}
 
+	audit, err := renderAuditLog(site)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkServerNameSyntax(site); err != nil {
+		return nil, err
+	}
+	if err := checkResponseRewrite(site.ResponseRewrite); err != nil {
+		return nil, err
+	}
+	if err := checkProtectedFiles(site.ProtectedFiles); err != nil {
+		return nil, err
+	}
+	if err := checkCapacity(site.Capacity); err != nil {
+		return nil, err
+	}
+	if err := CheckHygiene(site.Hygiene); err != nil {
+		return nil, err
+	}
+	if err := CheckSecurityHeaders(site.SecurityHeaders); err != nil {
+		return nil, err
+	}
+	geo, err := m.geoRules(site)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckWAF(site.WAF); err != nil {
+		return nil, err
+	}
+	if err := checkRoutes(site); err != nil {
+		return nil, err
+	}
+	if err := CheckRedirects(site.Redirects); err != nil {
+		return nil, err
+	}
+	if err := CheckRewrites(site.Rewrites); err != nil {
+		return nil, err
+	}
+	if err := CheckCanaryRelease(site.CanaryRelease); err != nil {
+		return nil, err
+	}
+	if err := CheckTrafficMirror(site.TrafficMirror); err != nil {
+		return nil, err
+	}
+	if err := CheckProtocol(site); err != nil {
+		return nil, err
+	}
+	if err := CheckWebSockets(site); err != nil {
+		return nil, err
+	}
+	if err := CheckRateSchedules(site); err != nil {
+		return nil, err
+	}
+	if err := CheckCache(site); err != nil {
+		return nil, err
+	}
+	if err := CheckTLS(site); err != nil {
+		return nil, err
+	}
+	if err := CheckClientAuth(site); err != nil {
+		return nil, err
+	}
+	if err := CheckBodySize(site.ClientMaxBodySize); err != nil {
+		return nil, err
+	}
+	if err := CheckKeepalive(site); err != nil {
+		return nil, err
+	}
+	if err := CheckUpstreamHost(site); err != nil {
+		return nil, err
+	}
+	if err := CheckUpstreamTLS(site); err != nil {
+		return nil, err
+	}
+	if err := CheckCapture(site.Capture); err != nil {
+		return nil, err
+	}
+	if err := CheckJWTGate(site); err != nil {
+		return nil, err
+	}
+	if err := CheckStaticAssets(site); err != nil {
+		return nil, err
+	}
+	if err := CheckInterceptErrors(site); err != nil {
+		return nil, err
+	}
+	if err := CheckAssetShield(site); err != nil {
+		return nil, err
+	}
+	if err := CheckDrain(site); err != nil {
+		return nil, err
+	}
+	jwt, err := m.resolveJWTGate(site)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := renderUpstream(site)
+	if err != nil {
+		return nil, err
+	}
+
+	var logFormat string
+	if site.LogFormat != "" {
+		f, err := m.GetLogFormat(site.LogFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load log format %s: %w", site.LogFormat, err)
+		}
+		logFormat = logFormatDirective(site, f)
+	}
+
+	now := renderTime()
+
 	// Wrapper for template data
 	data := struct {
 		*models.Site
 		TemplateSnippets string
+		AuditHTTP        string
+		AuditServer      string
+		Upstream         upstreamBlock
+		LogFormatDecl    string
+		AccessLogFormat  string
+		ConnHygiene      *models.ConnectionHygiene
+		SecHeaders       *securityHeaders
+		Geo              *geoBlock
+		ModSec           *modSecurity
+		Shadow           *shadowMirror
+		GRPC             bool // The root location proxies gRPC
+		GRPCHeaders      map[string]string
+		HTTP2            bool // Some location proxies gRPC, so port 80 speaks h2c too
+		WS               *webSockets
+		Reuseport        bool // The HTTP/3 listener sets reuseport, see ownsReuseport
+		ProxyCache       *proxyCache
+		TLSSession       *tlsSession
+		ClientAuth       *clientAuth
+		Body             bodyBuffering
+		Capture          *trafficCapture
+		UpstreamTLS      *upstreamTLS
+		JWT              *jwtGate
+		StaticAssets     []staticAsset
+		ErrorPages       errorPages
+		Shield           *assetShield
 	}{
 		Site:             site,
 		TemplateSnippets: templateContent.String(),
+		AuditHTTP:        audit.HTTP,
+		AuditServer:      audit.Server,
+		Upstream:         upstream,
+		LogFormatDecl:    logFormat,
+		AccessLogFormat:  logFormatName(site),
+		ConnHygiene:      resolveHygiene(site.Hygiene, m.DefaultHygiene),
+		SecHeaders:       resolveSecurityHeaders(site.SecurityHeaders),
+		Geo:              geo,
+		ModSec:           m.wafRules(site.WAF),
+		Shadow:           resolveTrafficMirror(site.TrafficMirror),
+		GRPC:             isGRPC(site.Protocol),
+		GRPCHeaders:      grpcHeaders(site),
+		HTTP2:            usesGRPC(site),
+		WS:               resolveWebSockets(site, templateContent.String()),
+		Reuseport:        site.SSL && site.HTTP3 && m.ownsReuseport(site.ID),
+		ProxyCache:       m.resolveCache(site),
+		TLSSession:       resolveTLS(site),
+		ClientAuth:       resolveClientAuth(site),
+		Body:             resolveBody(site, m.ClientMaxBodySize),
+		Capture:          resolveCapture(site, now),
+		UpstreamTLS:      resolveUpstreamTLS(site),
+		JWT:              jwt,
+		StaticAssets:     resolveStaticAssets(site),
+		ErrorPages:       resolveErrorPages(site),
+		Shield:           m.resolveAssetShield(site),
 	}
 
-	// Basic server block template
-	// In a real app, this might be loaded from a file.
-	const serverTmpl = `
-{{ if .Firewall }}
-{{ if .Firewall.RateLimit }}
-{{ if .Firewall.RateLimit.Enabled }}
-limit_req_zone $binary_remote_addr zone=zone_{{ .ID }}:10m rate={{ .Firewall.RateLimit.Rate }}{{ .Firewall.RateLimit.Unit }};
-{{ end }}
-{{ end }}
-{{ end }}
-
-server {
-    listen 80;
-    server_name {{ .Domain }};
-
-    access_log /var/log/hubfly/{{ .ID }}.access.log hubfly;
-    error_log /var/log/hubfly/{{ .ID }}.error.log notice;
-
-    {{ if .Firewall }}
-    {{ if .Firewall.BlockRules }}
-    {{ range .Firewall.BlockRules.Paths }}
-    location ~ {{ . }} { return 403; }
-    {{ end }}
-    {{ range $path, $methods := .Firewall.BlockRules.PathMethods }}
-    location ~ {{ $path }} {
-        if ($request_method ~* "({{ join $methods "|" }})") { return 405; }
-        # Fallback to main proxy pass if method allowed? 
-        # Note: 'location' blocks capture request. We need to proxy_pass here too if not blocked.
-        # But duplication is messy. 
-        # Better strategy: strict match location with limit_except or if.
-        # If we use location ~ $path, it takes precedence.
-        # So we must include proxy logic inside.
-        set $upstream_endpoint "http://{{ index $.Upstreams 0 }}";
-        proxy_pass $upstream_endpoint;
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Host $host;
-        {{ range $k, $v := $.ProxySetHeaders }}
-        proxy_set_header {{ $k }} {{ $v }};
-        {{ end }}
-    }
-    {{ end }}
-    {{ end }}
-    {{ end }}
-
-    {{ if .ForceSSL }}
-    location / {
-        return 301 https://$host$request_uri;
-    }
-    location /ws/ {
-        set $upstream_endpoint "http://{{ index .Upstreams 0 }}";
-        proxy_pass $upstream_endpoint;
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Host $host;
-    }
-
-    {{ else }}
-    location / {
-        set $upstream_endpoint "http://{{ index .Upstreams 0 }}";
-
-        {{ if .Firewall }}
-        {{ range .Firewall.IPRules }}
-        {{ .Action }} {{ .Value }};
-        {{ end }}
-        
-        {{ if .Firewall.BlockRules }}
-        {{ if .Firewall.BlockRules.UserAgents }}
-        if ($http_user_agent ~* "({{ join .Firewall.BlockRules.UserAgents "|" }})") { return 403; }
-        {{ end }}
-        {{ if .Firewall.BlockRules.Methods }}
-        if ($request_method ~* "({{ join .Firewall.BlockRules.Methods "|" }})") { return 405; }
-        {{ end }}
-        {{ end }}
-
-        {{ if .Firewall.RateLimit }}
-        {{ if .Firewall.RateLimit.Enabled }}
-        limit_req zone=zone_{{ .ID }} burst={{ .Firewall.RateLimit.Burst }} nodelay;
-        {{ end }}
-        {{ end }}
-        {{ end }}
-
-        proxy_pass $upstream_endpoint;
-
-        # WebSocket Support
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Connection "upgrade";
-
-        {{ range $k, $v := .ProxySetHeaders }}
-        proxy_set_header {{ $k }} {{ $v }};
-        {{ end }}
-
-        {{ .TemplateSnippets }}
-        {{ .ExtraConfig }}
-    }
-    {{ end }}
-
-    # Challenge path for Certbot
-    location /.well-known/acme-challenge/ {
-        root /var/www/hubfly;
-        try_files $uri =404;
-    }
-
-    error_page 403 /403.html;
-    location = /403.html {
-        root /var/www/hubfly/static;
-        internal;
-    }
-
-    error_page 502 504 /502.html;
-    location = /502.html {
-        root /var/www/hubfly/static;
-        internal;
-    }
-}
-
-{{ if .SSL }}
-server {
-    listen 443 ssl;
-    http2 on;
-    server_name {{ .Domain }};
-
-    ssl_certificate /etc/letsencrypt/live/{{ .Domain }}/fullchain.pem;
-    ssl_certificate_key /etc/letsencrypt/live/{{ .Domain }}/privkey.pem;
-
-    {{ if .Firewall }}
-    {{ if .Firewall.BlockRules }}
-    {{ range .Firewall.BlockRules.Paths }}
-    location ~ {{ . }} { return 403; }
-    {{ end }}
-    {{ range $path, $methods := .Firewall.BlockRules.PathMethods }}
-    location ~ {{ $path }} {
-        if ($request_method ~* "({{ join $methods "|" }})") { return 405; }
-        set $upstream_endpoint "http://{{ index $.Upstreams 0 }}";
-        proxy_pass $upstream_endpoint;
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Host $host;
-        {{ range $k, $v := $.ProxySetHeaders }}
-        proxy_set_header {{ $k }} {{ $v }};
-        {{ end }}
-    }
-    {{ end }}
-    {{ end }}
-    {{ end }}
-
-    location / {
-        set $upstream_endpoint "http://{{ index .Upstreams 0 }}";
-
-        {{ if .Firewall }}
-        {{ range .Firewall.IPRules }}
-        {{ .Action }} {{ .Value }};
-        {{ end }}
-
-        {{ if .Firewall.BlockRules }}
-        {{ if .Firewall.BlockRules.UserAgents }}
-        if ($http_user_agent ~* "({{ join .Firewall.BlockRules.UserAgents "|" }})") { return 403; }
-        {{ end }}
-        {{ if .Firewall.BlockRules.Methods }}
-        if ($request_method ~* "({{ join .Firewall.BlockRules.Methods "|" }})") { return 405; }
-        {{ end }}
-        {{ end }}
-
-        {{ if .Firewall.RateLimit }}
-        {{ if .Firewall.RateLimit.Enabled }}
-        limit_req zone=zone_{{ .ID }} burst={{ .Firewall.RateLimit.Burst }} nodelay;
-        {{ end }}
-        {{ end }}
-        {{ end }}
-
-        proxy_pass $upstream_endpoint;
-
-        # WebSocket Support
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Connection "upgrade";
-
-        {{ range $k, $v := .ProxySetHeaders }}
-        proxy_set_header {{ $k }} {{ $v }};
-        {{ end }}
-
-        {{ .TemplateSnippets }}
-        {{ .ExtraConfig }}
-    }
-
-    location /ws/ {
-        set $upstream_endpoint "http://{{ index .Upstreams 0 }}";
-        proxy_pass $upstream_endpoint;
-        proxy_http_version 1.1;
-        proxy_set_header Upgrade $http_upgrade;
-        proxy_set_header Connection $connection_upgrade;
-        proxy_set_header Host $host;
-    }
-
-    error_page 403 /403.html;
-    location = /403.html {
-        root /var/www/hubfly/static;
-        internal;
-    }
-
-    error_page 502 504 /502.html;
-    location = /502.html {
-        root /var/www/hubfly/static;
-        internal;
-    }
-}
-{{ end }}
-`
-	// Note: This is a simplified template for MVP.
-	// Real implementation should load from m.TemplatesDir and handle "Templates" list (caching, etc).
-
 	funcMap := template.FuncMap{
-		"join": strings.Join,
+		"join":       strings.Join,
+		"extensions": extensionPatterns,
+		"quoteRegex": quoteRegexes,
+		"ident":      ident,
+		"traversal":  traversalPattern,
+		"quote":      quote,
+		"quoteNames": serverNames,
+		"redirect":   redirectDirective,
+		"isGRPC":     isGRPC,
+		"routeProtocol": func(r models.RouteOverride) string {
+			return routeProtocol(site, r)
+		},
+		"limitRate": func(r models.RouteOverride) string {
+			return activeRate(r, now)
+		},
+		"routeJWT": func(r models.RouteOverride) string {
+			return jwt.route(r.Path)
+		},
 	}
 
-	t, err := template.New("site").Funcs(funcMap).Parse(serverTmpl)
+	t, err := template.New("site").Funcs(funcMap).Parse(siteTemplate)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, data); err != nil {
-		return "", err
+		return nil, err
 	}
-
-	stagingFile := filepath.Join(m.StagingDir, site.ID+".conf")
-	if err := os.WriteFile(stagingFile, buf.Bytes(), 0644); err != nil {
-		return "", err
-	}
-	slog.Debug("Generated staging config", "file", stagingFile)
-
-	return stagingFile, nil
+	return buf.Bytes(), nil
 }
 
 // RebuildStreamConfig generates the config for a specific port, handling multiple SNI streams.
@@ -312,6 +327,29 @@ func (m *Manager) RebuildStreamConfig(port int, streams []models.Stream) error {
 		return m.DeleteStreamConfig(port)
 	}
 
+	config, err := m.RenderStreamConfig(port, streams)
+	if err != nil {
+		return err
+	}
+
+	configFile := m.StreamConfigFile(port)
+	return m.installConfig(configFile, func() error {
+		if err := os.WriteFile(configFile, config, 0644); err != nil {
+			return err
+		}
+		slog.Info("Rebuilt stream config", "port", port, "file", configFile)
+		return nil
+	}, nil)
+}
+
+// StreamConfigFile is where the config for a stream port lives.
+func (m *Manager) StreamConfigFile(port int) string {
+	return filepath.Join(m.StreamsDir, fmt.Sprintf("port_%d.conf", port))
+}
+
+// RenderStreamConfig returns the config for the streams sharing a port
+// without writing it anywhere.
+func (m *Manager) RenderStreamConfig(port int, streams []models.Stream) ([]byte, error) {
 	// Check if we need SNI routing
 	// If multiple streams, or the single stream has a domain, we use SNI.
 	// Exception: UDP cannot use ssl_preread (DTLS is complex, assume TCP for SNI).
@@ -323,6 +361,7 @@ func (m *Manager) RebuildStreamConfig(port int, streams []models.Stream) error {
 	}
 
 	var buf bytes.Buffer
+	renderStreamUpstreams(&buf, streams)
 
 	// Simple Pass-through (No SNI, Single Stream)
 	if !useSNI {
@@ -337,24 +376,26 @@ func (m *Manager) RebuildStreamConfig(port int, streams []models.Stream) error {
 		// But variables aren't allowed in 'upstream' directive, but can be used in proxy_pass
 		tmpl := `
 server {
-    listen {{ .ListenPort }}{{ .Proto }};
-    listen [::]:{{ .ListenPort }}{{ .Proto }};
-    proxy_pass {{ .Upstream }};
+    {{ range .Listen }}listen {{ . }}{{ $.Proto }};
+    {{ end }}{{ range .Directives }}{{ . }};
+    {{ end }}proxy_pass {{ .Upstream }};
 }
 `
 		data := struct {
-			ListenPort int
+			Listen     []string
 			Proto      string
+			Directives []string
 			Upstream   string
 		}{
-			ListenPort: s.ListenPort,
+			Listen:     listenAddrs(s.BindAddress, s.ListenPort),
 			Proto:      proto,
-			Upstream:   s.Upstream,
+			Directives: append(append([]string{streamAccessLog(port)}, streamTimeoutDirectives(&s)...), streamUDPDirectives(&s)...),
+			Upstream:   streamTarget(&s),
 		}
 
 		t, _ := template.New("simple_stream").Parse(tmpl)
 		if err := t.Execute(&buf, data); err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		// SNI Routing (TCP only usually)
@@ -367,7 +408,7 @@ server {
 		buf.WriteString(fmt.Sprintf("map $ssl_preread_server_name $%s {\n", mapName))
 		for _, s := range streams {
 			if s.Domain != "" {
-				buf.WriteString(fmt.Sprintf("    %s %s;\n", s.Domain, s.Upstream))
+				buf.WriteString(fmt.Sprintf("    %s %s;\n", s.Domain, streamTarget(&s)))
 			} else {
 				// Default/Catch-all if one is missing domain?
 				// Or explicit default. For now, let's map "." (if supported) or use default clause
@@ -382,28 +423,43 @@ server {
 			}
 		}
 		if defaultStream != nil {
-			buf.WriteString(fmt.Sprintf("    default %s;\n", defaultStream.Upstream))
+			buf.WriteString(fmt.Sprintf("    default %s;\n", streamTarget(defaultStream)))
 		}
 		buf.WriteString("}\n\n")
 
 		buf.WriteString("server {\n")
-		buf.WriteString(fmt.Sprintf("    listen %d;\n", port))
+		for _, addr := range listenAddrs(streams[0].BindAddress, port) {
+			buf.WriteString(fmt.Sprintf("    listen %s;\n", addr))
+		}
 		buf.WriteString("    ssl_preread on;\n")
+		buf.WriteString("    " + streamAccessLog(port) + ";\n")
+		// Streams on a port agree on their timeouts.
+		for _, d := range streamTimeoutDirectives(&streams[0]) {
+			buf.WriteString("    " + d + ";\n")
+		}
 		buf.WriteString(fmt.Sprintf("    proxy_pass $%s;\n", mapName))
 		buf.WriteString("}\n")
 	}
+	return buf.Bytes(), nil
+}
 
-	configFile := filepath.Join(m.StreamsDir, fmt.Sprintf("port_%d.conf", port))
-	if err := os.WriteFile(configFile, buf.Bytes(), 0644); err != nil {
-		return err
-	}
-	slog.Info("Rebuilt stream config", "port", port, "file", configFile)
+// streamAccessLog logs the sessions of a stream port in the hubfly_stream
+// format of the bundled nginx.conf, see logmanager.ParseStreamLine.
+func streamAccessLog(port int) string {
+	return fmt.Sprintf("access_log /var/log/hubfly/stream_%d.access.log hubfly_stream", port)
+}
 
-	return m.Reload()
+// listenAddrs returns the listen targets for a stream port. Without a bind
+// address the port is opened on all IPv4 and IPv6 interfaces.
+func listenAddrs(bind string, port int) []string {
+	if bind == "" {
+		return []string{strconv.Itoa(port), fmt.Sprintf("[::]:%d", port)}
+	}
+	return []string{net.JoinHostPort(bind, strconv.Itoa(port))}
 }
 
 func (m *Manager) DeleteStreamConfig(port int) error {
-	target := filepath.Join(m.StreamsDir, fmt.Sprintf("port_%d.conf", port))
+	target := m.StreamConfigFile(port)
 	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -411,35 +467,158 @@ func (m *Manager) DeleteStreamConfig(port int) error {
 	return m.Reload()
 }
 
-// Validate runs nginx -t against the staging config
-// Note: To validate a single include properly, we usually need to validate the whole nginx tree.
-// For MVP, we assume the staging file is valid if it parses.
-// A robust way is to create a temp nginx.conf that includes the staging file.
-func (m *Manager) Validate(stagingFile string) error {
-	// In a real container, we run nginx -t.
-	// For local dev where nginx might not be installed, we skip or mock.
+// SiteConfigFile is where a site's live config lives.
+func (m *Manager) SiteConfigFile(siteID string) string {
+	return filepath.Join(m.SitesDir, siteID+".conf")
+}
 
-	// Strategy: use `nginx -t -c /etc/nginx/nginx.conf` but we need to inject our staging file.
-	// Since the main nginx.conf likely includes `/etc/hubfly/sites/*.conf`,
-	// we can temporary symlink staging file to sites/ OR use a specific test config.
+// Apply moves staging file to live sites dir and reloads. If the reload
+// fails the previous config is restored; see installConfig.
+func (m *Manager) Apply(siteID, stagingFile string) error {
+	return m.ApplyVerified(siteID, stagingFile, nil)
+}
 
-	// For MVP, let's try to just syntax check the file if possible, or skip if too complex.
-	// Simpler: Just return nil for now if not in a proper env.
+// ApplyVerified is Apply with a check run once nginx has reloaded, such
+// as Canary. If it fails the previous config is restored too and a
+// *CanaryError returned.
+func (m *Manager) ApplyVerified(siteID, stagingFile string, verify func() error) error {
+	target := m.SiteConfigFile(siteID)
+	return m.installConfig(target, func() error {
+		if err := os.Rename(stagingFile, target); err != nil {
+			return err
+		}
+		slog.Info("Applied site config", "site_id", siteID, "target", target)
+		return nil
+	}, verify)
+}
 
-	return nil
+// ReloadError is a reload that failed after a new config went live. By
+// the time it is returned the previous config has been put back.
+type ReloadError struct {
+	Err         error // The failed reload, with nginx's output
+	RollbackErr error // Set when restoring or reloading the old config failed too
 }
 
-// Apply moves staging file to live sites dir and reloads
-func (m *Manager) Apply(siteID, stagingFile string) error {
-	target := filepath.Join(m.SitesDir, siteID+".conf")
-	if err := os.Rename(stagingFile, target); err != nil {
+func (e *ReloadError) Error() string {
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%v; rollback failed: %v", e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("%v; previous config restored", e.Err)
+}
+
+func (e *ReloadError) Unwrap() error { return e.Err }
+
+// PreviousConfigFile is the copy of a live config kept from before its
+// last change, next to it. The suffix keeps it out of nginx's *.conf
+// includes.
+func PreviousConfigFile(target string) string {
+	return target + ".prev"
+}
+
+// installConfig runs install to put a new version of target in place and
+// reloads nginx. The old version is kept as PreviousConfigFile(target); if
+// the reload fails it is restored (or target removed, for a new file) and
+// nginx reloaded again, so one bad config can't leave nginx broken for
+// every other site. The same happens when verify, if set, fails after a
+// successful reload.
+func (m *Manager) installConfig(target string, install func() error, verify func() error) error {
+	previous, err := os.ReadFile(target)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	slog.Info("Applied site config", "site_id", siteID, "target", target)
-	return m.Reload()
+	backup := PreviousConfigFile(target)
+	if existed {
+		if err := os.WriteFile(backup, previous, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := install(); err != nil {
+		return err
+	}
+	if reloadErr := m.Reload(); reloadErr != nil {
+		slog.Warn("Reload failed, restoring previous config", "file", target, "new_file", !existed)
+		return &ReloadError{Err: reloadErr, RollbackErr: m.restoreConfig(target, previous, existed)}
+	}
+	if verify == nil {
+		return nil
+	}
+	if verifyErr := verify(); verifyErr != nil {
+		slog.Warn("Canary failed, restoring previous config", "file", target, "new_file", !existed)
+		return &CanaryError{Err: verifyErr, RollbackErr: m.restoreConfig(target, previous, existed)}
+	}
+	return nil
+}
+
+// restoreConfig puts back the version of target from before installConfig
+// and reloads.
+func (m *Manager) restoreConfig(target string, previous []byte, existed bool) error {
+	var err error
+	if existed {
+		err = os.WriteFile(target, previous, 0644)
+	} else {
+		err = os.Remove(target)
+	}
+	if err == nil {
+		err = m.Reload()
+	}
+	if err != nil {
+		slog.Error("Rollback failed, nginx may be serving a stale config", "file", target, "error", err)
+	}
+	return err
+}
+
+// ReloadStats counts nginx reloads since startup.
+type ReloadStats struct {
+	Total        int64     `json:"total"`
+	Failed       int64     `json:"failed"`
+	InFlight     int       `json:"in_flight"`
+	LastAt       time.Time `json:"last_at,omitempty"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+type reloadStats struct {
+	mu    sync.Mutex
+	stats ReloadStats
+}
+
+// ReloadStats returns a snapshot of the reload counters.
+func (m *Manager) ReloadStats() ReloadStats {
+	m.reloads.mu.Lock()
+	defer m.reloads.mu.Unlock()
+	return m.reloads.stats
 }
 
 func (m *Manager) Reload() error {
+	m.reloads.mu.Lock()
+	m.reloads.stats.InFlight++
+	m.reloads.mu.Unlock()
+	start := time.Now()
+
+	err := m.reload()
+
+	m.reloads.mu.Lock()
+	defer m.reloads.mu.Unlock()
+	st := &m.reloads.stats
+	st.InFlight--
+	st.Total++
+	st.LastAt = start
+	st.LastDuration = time.Since(start).String()
+	st.LastError = ""
+	if err != nil {
+		st.Failed++
+		st.LastError = err.Error()
+	}
+	return err
+}
+
+func (m *Manager) reload() error {
+	if err := m.Faults.Check(faults.NginxReload); err != nil {
+		slog.Error("Nginx reload failed", "error", err)
+		return err
+	}
 	path, err := exec.LookPath("nginx")
 	if err != nil {
 		slog.Warn("Nginx not found, skipping reload")
@@ -457,7 +636,7 @@ func (m *Manager) Reload() error {
 }
 
 func (m *Manager) Delete(siteID string) error {
-	target := filepath.Join(m.SitesDir, siteID+".conf")
+	target := m.SiteConfigFile(siteID)
 	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
 		return err
 	}
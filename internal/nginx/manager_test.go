@@ -0,0 +1,663 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestAuditHeaders(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:        "audit.local",
+		Domain:    "audit.local",
+		Upstreams: []string{"127.0.0.1:8080"},
+		AuditHeaders: []models.HeaderAudit{
+			{Name: "Authorization"},
+			{Name: "X-Api-Key", Mode: "hash"},
+			{Name: "X-Request-Id", Mode: "raw"},
+		},
+	}
+
+	configFile, err := mgr.GenerateConfig(site)
+	if err != nil {
+		t.Fatalf("GenerateConfig failed: %v", err)
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configStr := string(content)
+
+	expectedStrings := []string{
+		"map $http_authorization $audit_audit_local_9b1e6aec_authorization {",
+		`"authorization":"$audit_audit_local_9b1e6aec_authorization"`,
+		`"x-request-id":"$http_x_request_id"`,
+		`set $hubfly_audit_hash "x-api-key";`,
+		"access_log /var/log/hubfly/audit.local.audit.log hubfly_audit_audit_local_9b1e6aec;",
+	}
+
+	for _, s := range expectedStrings {
+		if !strings.Contains(configStr, s) {
+			t.Errorf("Config missing audit directive: %s", s)
+		}
+	}
+	if strings.Contains(configStr, "$http_x_api_key") {
+		t.Errorf("Hashed header must not be logged raw")
+	}
+
+	site.AuditHeaders = []models.HeaderAudit{{Name: "X-Api-Key", Mode: "plain"}}
+	if _, err := mgr.GenerateConfig(site); err == nil {
+		t.Errorf("Expected error for invalid audit mode")
+	}
+}
+
+func TestIdent(t *testing.T) {
+	seen := make(map[string]string)
+	for _, id := range []string{"app", "my-app.example.com", "my.app.example.com", "my_app_example_com", "my_app.example.com"} {
+		name := ident(id)
+		if other, ok := seen[name]; ok {
+			t.Errorf("%q and %q both map to %q", other, id, name)
+		}
+		seen[name] = id
+	}
+	if ident("app") != "app" {
+		t.Errorf("Expected alphanumeric IDs to stay as they are, got %q", ident("app"))
+	}
+
+	// Two such sites declare nothing twice in the http context
+	mgr := NewManager(t.TempDir())
+	declared := make(map[string]string)
+	for _, id := range []string{"my-app.example.com", "my.app.example.com"} {
+		site := &models.Site{ID: id, Domain: id, Upstreams: []string{"a:80", "b:80"}, AuditHeaders: []models.HeaderAudit{{Name: "Authorization"}}}
+		config, err := mgr.Render(site)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(config), "\n") {
+			if !strings.HasPrefix(line, "upstream ") && !strings.HasPrefix(line, "log_format ") && !strings.HasPrefix(line, "map ") {
+				continue
+			}
+			if other, ok := declared[line]; ok {
+				t.Errorf("%s and %s both declare %q", other, id, line)
+			}
+			declared[line] = id
+		}
+	}
+	if len(declared) == 0 {
+		t.Error("Expected http context declarations")
+	}
+}
+
+func TestStreamBindAddress(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		stream   models.Stream
+		expected []string
+	}{
+		{
+			stream:   models.Stream{ID: "all", ListenPort: 30001, Upstream: "db:5432", Protocol: "tcp"},
+			expected: []string{"listen 30001;", "listen [::]:30001;"},
+		},
+		{
+			stream:   models.Stream{ID: "v4", ListenPort: 30002, Upstream: "dns:53", Protocol: "udp", BindAddress: "10.0.0.5"},
+			expected: []string{"listen 10.0.0.5:30002 udp;"},
+		},
+		{
+			stream:   models.Stream{ID: "v6", ListenPort: 30003, Upstream: "db:5432", Protocol: "tcp", BindAddress: "fd00::5"},
+			expected: []string{"listen [fd00::5]:30003;"},
+		},
+	}
+
+	for _, c := range cases {
+		if err := mgr.RebuildStreamConfig(c.stream.ListenPort, []models.Stream{c.stream}); err != nil {
+			t.Fatalf("RebuildStreamConfig failed: %v", err)
+		}
+		content, err := os.ReadFile(filepath.Join(mgr.StreamsDir, fmt.Sprintf("port_%d.conf", c.stream.ListenPort)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		configStr := string(content)
+		for _, s := range c.expected {
+			if !strings.Contains(configStr, s) {
+				t.Errorf("Stream %s config missing %q:\n%s", c.stream.ID, s, configStr)
+			}
+		}
+		if c.stream.BindAddress != "" && strings.Contains(configStr, "[::]:") {
+			t.Errorf("Stream %s bound to %s must not listen on all interfaces", c.stream.ID, c.stream.BindAddress)
+		}
+	}
+}
+
+func TestUpstreamWeights(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:        "lb.local",
+		Domain:    "lb.local",
+		Upstreams: []string{"app1:8080", "app2:8080", "app3:8080"},
+		LoadBalancing: &models.LoadBalancing{
+			Weights:          map[string]int{"app1:8080": 3, "app2:8080": 2},
+			Adaptive:         &models.AdaptiveWeights{Enabled: true},
+			EffectiveWeights: map[string]int{"app2:8080": 7},
+		},
+		DownUpstreams: []string{"app3:8080"},
+	}
+
+	configFile, err := mgr.GenerateConfig(site)
+	if err != nil {
+		t.Fatalf("GenerateConfig failed: %v", err)
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configStr := string(content)
+
+	expectedStrings := []string{
+		"upstream hubfly_lb_local_c55d8aff {",
+		"server app1:8080 weight=3;", // base weight
+		"server app2:8080 weight=7;", // adaptive weight wins
+		"server app3:8080 down;",
+		`set $upstream_endpoint "http://hubfly_lb_local_c55d8aff";`,
+	}
+	for _, s := range expectedStrings {
+		if !strings.Contains(configStr, s) {
+			t.Errorf("Config missing upstream directive: %s", s)
+		}
+	}
+
+	// A single upstream keeps the variable-based proxy_pass
+	single := &models.Site{ID: "one.local", Domain: "one.local", Upstreams: []string{"app:80"}}
+	configFile, err = mgr.GenerateConfig(single)
+	if err != nil {
+		t.Fatalf("GenerateConfig failed: %v", err)
+	}
+	content, _ = os.ReadFile(configFile)
+	if strings.Contains(string(content), "upstream ") {
+		t.Errorf("Single upstream site should not render an upstream block")
+	}
+	if !strings.Contains(string(content), `set $upstream_endpoint "http://app:80";`) {
+		t.Errorf("Single upstream site should proxy to the upstream directly")
+	}
+}
+
+func TestResponseRewrite(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_rewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	site := &models.Site{
+		ID:        "rw.local",
+		Domain:    "rw.local",
+		Upstreams: []string{"app:8080"},
+		ResponseRewrite: &models.ResponseRewrite{
+			Rules: []models.SubFilter{
+				{Find: "http://app:8080", Replace: "https://$host"},
+				{Find: `say "hi"`, Replace: "hello"},
+			},
+			Types: []string{"application/json", "text/css"},
+		},
+	}
+
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	configStr := string(config)
+
+	expectedStrings := []string{
+		`proxy_set_header Accept-Encoding "";`,
+		`sub_filter "http://app:8080" "https://$host";`,
+		`sub_filter "say \"hi\"" "hello";`,
+		"sub_filter_once off;",
+		"sub_filter_types application/json text/css;",
+	}
+	for _, s := range expectedStrings {
+		if !strings.Contains(configStr, s) {
+			t.Errorf("Config missing sub_filter directive: %s", s)
+		}
+	}
+	if _, err := Parse(config); err != nil {
+		t.Errorf("Rendered config does not parse: %v", err)
+	}
+
+	site.ResponseRewrite.Rules = append(site.ResponseRewrite.Rules, models.SubFilter{Replace: "x"})
+	if _, err := mgr.Render(site); err == nil {
+		t.Errorf("Empty find should be rejected")
+	}
+}
+
+func TestProtectedFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_protected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	site := &models.Site{
+		ID:             "files.local",
+		Domain:         "files.local",
+		Upstreams:      []string{"app:8080"},
+		SSL:            true,
+		ProtectedFiles: []models.FileMapping{{Path: "/protected/", Directory: "/srv/downloads/"}},
+	}
+
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	dirs, err := Parse(config)
+	if err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+	found := 0
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		if d.Name == "location" && len(d.Args) == 1 && d.Args[0] == "/protected/" {
+			found++
+			if !hasDirective(d.Block, "internal") {
+				t.Errorf("Protected location must be internal")
+			}
+		}
+	})
+	if found != 2 {
+		t.Errorf("Protected location rendered %d times, want one per server block", found)
+	}
+	if !strings.Contains(string(config), "alias /srv/downloads/;") {
+		t.Errorf("Config missing alias for protected files")
+	}
+
+	for _, bad := range []models.FileMapping{
+		{Path: "/protected", Directory: "/srv/downloads/"},
+		{Path: "/protected/", Directory: "srv/downloads/"},
+		{Path: "/p/", Directory: "/srv/x/; autoindex on;/"},
+		{Path: "/", Directory: "/srv/"},
+	} {
+		site.ProtectedFiles = []models.FileMapping{bad}
+		if _, err := mgr.Render(site); err == nil {
+			t.Errorf("Mapping %+v should be rejected", bad)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_capacity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	site := &models.Site{
+		ID:        "legacy.local",
+		Domain:    "legacy.local",
+		Upstreams: []string{"app:8080"},
+		Capacity: &models.Capacity{
+			MaxConcurrent:   10,
+			Rate:            5,
+			Queue:           20,
+			ShedStatus:      429,
+			ShedBody:        `{"error":"busy"}`,
+			ShedContentType: "application/json",
+			RetryAfter:      30,
+		},
+		Firewall: &models.FirewallConfig{
+			RateLimit: &models.RateLimitConfig{Enabled: true, Rate: 10, Unit: "r/s", Burst: 20},
+		},
+	}
+
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	configStr := string(config)
+	expectedStrings := []string{
+		"limit_conn_zone $server_name zone=conn_legacy_local_1c27bde6:1m;",
+		"limit_req_zone $server_name zone=queue_legacy_local_1c27bde6:1m rate=5r/s;",
+		"limit_conn conn_legacy_local_1c27bde6 10;",
+		"limit_conn_status 429;",
+		"limit_req_status 429;",
+		"error_page 429 @capacity_shed;",
+		"add_header Retry-After 30 always;",
+		"default_type application/json;",
+		`return 429 "{\"error\":\"busy\"}";`,
+	}
+	for _, s := range expectedStrings {
+		if !strings.Contains(configStr, s) {
+			t.Errorf("Config missing capacity directive: %s", s)
+		}
+	}
+
+	dirs, err := Parse(config)
+	if err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+	// The root location sets its own limit_req (firewall rate limit), so
+	// the queue must be repeated there to still apply.
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		if d.Name == "location" && len(d.Args) == 1 && d.Args[0] == "/" {
+			zones := 0
+			for _, c := range d.Block {
+				if c.Name == "limit_req" {
+					zones++
+				}
+			}
+			if zones != 2 {
+				t.Errorf("Root location has %d limit_req directives, want firewall and capacity", zones)
+			}
+		}
+	})
+
+	for _, bad := range []models.Capacity{
+		{},
+		{Queue: 10, MaxConcurrent: 5},
+		{Rate: -1},
+		{Rate: 5, ShedStatus: 502},
+		{Rate: 5, ShedStatus: 200},
+		{Rate: 5, ShedContentType: "text/plain; charset=utf-8"},
+	} {
+		site.Capacity = &bad
+		if _, err := mgr.Render(site); err == nil {
+			t.Errorf("Capacity %+v should be rejected", bad)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	snippet := "add_header X-Frame-Options DENY;\nif ($request_method = OPTIONS) {\n    return 204;\n}\n"
+	if err := mgr.SaveTemplate("security-headers", snippet); err != nil {
+		t.Fatalf("Valid template rejected: %v", err)
+	}
+	tpl, err := mgr.GetTemplate("security-headers")
+	if err != nil || tpl.Content != snippet {
+		t.Fatalf("GetTemplate = %+v, %v", tpl, err)
+	}
+	list, err := mgr.ListTemplates()
+	if err != nil || len(list) != 1 || list[0].Name != "security-headers" || list[0].Content != "" {
+		t.Errorf("ListTemplates = %+v, %v", list, err)
+	}
+
+	site := &models.Site{ID: "t.local", Domain: "t.local", Upstreams: []string{"app:80"}, Templates: []string{"security-headers"}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(string(config), "add_header X-Frame-Options DENY;") {
+		t.Errorf("Template content missing from config")
+	}
+
+	for _, bad := range []struct{ name, content string }{
+		{"../escape", "gzip on;"},
+		{"", "gzip on;"},
+		{"unbalanced", "location /x {\n    return 200;\n"},
+		{"no-semicolon", "gzip on"},
+		{"server-block", "server {\n    listen 8080;\n}\n"},
+		{"nested-listen", "if ($host) {\n    listen 8080;\n}\n"},
+		{"zone", "limit_req_zone $binary_remote_addr zone=x:1m rate=1r/s;"},
+	} {
+		if err := mgr.SaveTemplate(bad.name, bad.content); err == nil {
+			t.Errorf("Template %q should be rejected", bad.name)
+		}
+	}
+
+	// Names from the site record never reach the filesystem unchecked.
+	site.Templates = []string{"../../etc/passwd"}
+	if _, err := mgr.Render(site); err == nil {
+		t.Errorf("Render should reject a template name with a path")
+	}
+
+	if err := mgr.DeleteTemplate("security-headers"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.GetTemplate("security-headers"); !os.IsNotExist(err) {
+		t.Errorf("Deleted template still readable: %v", err)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range Presets() {
+		if err := CheckTemplate(p.Content); err != nil {
+			t.Errorf("Preset %s is not a valid template: %v", p.Name, err)
+		}
+		site := &models.Site{ID: "p.local", Domain: "p.local", Upstreams: []string{"app:80"}, Templates: []string{p.Name}}
+		config, err := mgr.Render(site)
+		if err != nil {
+			t.Fatalf("Render with preset %s failed: %v", p.Name, err)
+		}
+		if !strings.Contains(string(config), "proxy_set_header Host $host;") {
+			t.Errorf("Preset %s content missing from config", p.Name)
+		}
+		if warnings := mgr.Lint(site, nil); len(warnings) > 0 {
+			t.Errorf("Preset %s has lint warnings: %+v", p.Name, warnings)
+		}
+	}
+
+	if p, err := LookupPreset("wordpress@1"); err != nil || p.Version != 1 {
+		t.Errorf("LookupPreset(wordpress@1) = %+v, %v", p, err)
+	}
+	for _, bad := range []string{"wordpress@99", "wordpress@x", "nope", "nope@1"} {
+		if _, err := LookupPreset(bad); err == nil {
+			t.Errorf("LookupPreset(%q) should fail", bad)
+		}
+	}
+
+	// A template file of the same name takes precedence.
+	os.WriteFile(filepath.Join(mgr.TemplatesDir, "spa.conf"), []byte("gzip on;\n"), 0644)
+	site := &models.Site{ID: "p.local", Domain: "p.local", Upstreams: []string{"app:80"}, Templates: []string{"spa"}}
+	config, err := mgr.Render(site)
+	if err != nil || !strings.Contains(string(config), "gzip on;") || strings.Contains(string(config), "error_page 404") {
+		t.Errorf("Template file should shadow the spa preset: %v", err)
+	}
+	site.Templates = []string{"spa@1"}
+	if config, err := mgr.Render(site); err != nil || !strings.Contains(string(config), "error_page 404") {
+		t.Errorf("Pinned preset should ignore the template file: %v", err)
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	mgr.Faults = faults.NewInjector()
+	stage := func(content string) string {
+		file := filepath.Join(mgr.StagingDir, "r.local.conf")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	live := mgr.SiteConfigFile("r.local")
+
+	if err := mgr.Apply("r.local", stage("# v1\n")); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// The reload after v2 fails once; the rollback reload succeeds.
+	mgr.Faults.Set(faults.Fault{Point: faults.NginxReload, Count: 1, Message: "bad config"})
+	err = mgr.Apply("r.local", stage("# v2\n"))
+	var rerr *ReloadError
+	if !errors.As(err, &rerr) || rerr.RollbackErr != nil || !strings.Contains(err.Error(), "bad config") {
+		t.Fatalf("Expected a rolled back ReloadError, got %v", err)
+	}
+	if data, _ := os.ReadFile(live); string(data) != "# v1\n" {
+		t.Errorf("Live config = %q, want v1 restored", data)
+	}
+
+	// A new site whose first reload fails is removed again.
+	mgr.Faults.Set(faults.Fault{Point: faults.NginxReload, Count: 1})
+	file := filepath.Join(mgr.StagingDir, "new.local.conf")
+	os.WriteFile(file, []byte("# new\n"), 0644)
+	if err := mgr.Apply("new.local", file); !errors.As(err, &rerr) {
+		t.Fatalf("Expected a ReloadError, got %v", err)
+	}
+	if _, err := os.Stat(mgr.SiteConfigFile("new.local")); !os.IsNotExist(err) {
+		t.Errorf("Config of a new site should be removed after a failed reload")
+	}
+
+	// When the rollback reload fails too, the error says so.
+	mgr.Faults.Set(faults.Fault{Point: faults.NginxReload, Count: 2})
+	if err := mgr.Apply("r.local", stage("# v3\n")); !errors.As(err, &rerr) || rerr.RollbackErr == nil {
+		t.Errorf("Expected a failed rollback, got %v", err)
+	}
+
+	// Successful applies keep the previous version next to the live file.
+	if err := mgr.Apply("r.local", stage("# v4\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(PreviousConfigFile(live)); string(data) != "# v1\n" {
+		t.Errorf("Previous config = %q, want v1", data)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	site := &models.Site{
+		ID: "r.local", Domain: "r.local", Upstreams: []string{"app:80", "app2:80"},
+		Firewall: &models.FirewallConfig{BlockRules: &models.BlockRules{UserAgents: []string{"badbot"}}},
+		Routes: []models.RouteOverride{
+			{Path: "/reports/", ReadTimeout: 600, SendTimeout: 600},
+			{Path: "/api/", ReadTimeout: 5, ConnectTimeout: 2, Retries: &models.RetryPolicy{On: []string{"error", "timeout"}, Tries: 2, Timeout: 10}},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	dirs, err := Parse(config)
+	if err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	routes := map[string]*Directive{}
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		if d.Name == "location" && len(parents) > 0 && parents[len(parents)-1].Name == "location" {
+			routes[d.Args[0]] = d
+		}
+	})
+	has := func(block *Directive, name string, args ...string) bool {
+		for _, d := range block.Block {
+			if d.Name == name && strings.Join(d.Args, " ") == strings.Join(args, " ") {
+				return true
+			}
+		}
+		return false
+	}
+	reports, api := routes["/reports/"], routes["/api/"]
+	if reports == nil || api == nil {
+		t.Fatalf("Route locations not nested in the root location:\n%s", config)
+	}
+	if !has(reports, "proxy_read_timeout", "600s") || !has(reports, "proxy_send_timeout", "600s") || !has(reports, "proxy_pass", "$upstream_endpoint") {
+		t.Errorf("Unexpected /reports/ location: %+v", reports.Block)
+	}
+	if !has(api, "proxy_connect_timeout", "2s") || !has(api, "proxy_next_upstream", "error", "timeout") ||
+		!has(api, "proxy_next_upstream_tries", "2") || !has(api, "proxy_next_upstream_timeout", "10s") {
+		t.Errorf("Unexpected /api/ location: %+v", api.Block)
+	}
+	found := false
+	for _, d := range api.Block {
+		if d.Name == "if" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Firewall block rules must be repeated in route locations")
+	}
+
+	site.ProtectedFiles = []models.FileMapping{{Path: "/files/", Directory: "/srv/files/"}}
+	for _, bad := range []models.RouteOverride{
+		{Path: "/"},
+		{Path: "reports"},
+		{Path: "/a b/"},
+		{Path: "/ws/chat"},
+		{Path: "/files/x"},
+		{Path: "/x/", ReadTimeout: -1},
+		{Path: "/x/", ConnectTimeout: 120},
+		{Path: "/x/", Retries: &models.RetryPolicy{On: []string{"http_418"}}},
+		{Path: "/x/", Retries: &models.RetryPolicy{On: []string{"off", "error"}}},
+		{Path: "/reports/"},
+	} {
+		site.Routes = []models.RouteOverride{{Path: "/reports/"}, bad}
+		if _, err := mgr.Render(site); err == nil {
+			t.Errorf("Route %+v should be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Directive is a parsed nginx directive. Block is non-nil for block
+// directives such as server, location or if.
+type Directive struct {
+	Name  string
+	Args  []string
+	Line  int
+	Block []*Directive
+}
+
+// Parse reads nginx configuration into a directive tree. It understands
+// quoting, escapes and comments, which is enough for linting; it does not
+// know which directives are valid.
+func Parse(data []byte) ([]*Directive, error) {
+	p := &parser{src: string(data), line: 1}
+	dirs, err := p.block(false)
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) block(nested bool) ([]*Directive, error) {
+	var dirs []*Directive
+	var cur *Directive
+
+	for {
+		tok, quoted, line, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok == "" && !quoted:
+			if nested {
+				return nil, fmt.Errorf("line %d: unexpected end of file, expecting \"}\"", p.line)
+			}
+			if cur != nil {
+				return nil, fmt.Errorf("line %d: unexpected end of file, expecting \";\"", p.line)
+			}
+			return dirs, nil
+		case tok == ";" && !quoted:
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: unexpected \";\"", line)
+			}
+			dirs = append(dirs, cur)
+			cur = nil
+		case tok == "{" && !quoted:
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: unexpected \"{\"", line)
+			}
+			children, err := p.block(true)
+			if err != nil {
+				return nil, err
+			}
+			cur.Block = children
+			if cur.Block == nil {
+				cur.Block = []*Directive{}
+			}
+			dirs = append(dirs, cur)
+			cur = nil
+		case tok == "}" && !quoted:
+			if !nested || cur != nil {
+				return nil, fmt.Errorf("line %d: unexpected \"}\"", line)
+			}
+			return dirs, nil
+		default:
+			if cur == nil {
+				cur = &Directive{Name: tok, Line: line}
+			} else {
+				cur.Args = append(cur.Args, tok)
+			}
+		}
+	}
+}
+
+// token returns the next token; "" with quoted=false means end of input.
+func (p *parser) token() (tok string, quoted bool, line int, err error) {
+	// Skip whitespace and comments
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '\n' {
+			p.line++
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			p.pos++
+			continue
+		}
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+	if p.pos >= len(p.src) {
+		return "", false, p.line, nil
+	}
+
+	line = p.line
+	c := p.src[p.pos]
+	switch c {
+	case ';', '{', '}':
+		p.pos++
+		return string(c), false, line, nil
+	case '"', '\'':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.src) {
+			ch := p.src[p.pos]
+			if ch == '\\' && p.pos+1 < len(p.src) {
+				b.WriteByte(ch)
+				b.WriteByte(p.src[p.pos+1])
+				p.pos += 2
+				continue
+			}
+			if ch == c {
+				p.pos++
+				return b.String(), true, line, nil
+			}
+			if ch == '\n' {
+				p.line++
+			}
+			b.WriteByte(ch)
+			p.pos++
+		}
+		return "", false, line, fmt.Errorf("line %d: unterminated string", line)
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		if ch == '\\' && p.pos+1 < len(p.src) {
+			p.pos += 2
+			continue
+		}
+		if ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == ';' || ch == '#' {
+			break
+		}
+		// "{" and "}" end a token unless part of a ${var} reference.
+		if ch == '{' && !(p.pos > start && p.src[p.pos-1] == '$') {
+			break
+		}
+		if ch == '}' && !strings.Contains(p.src[start:p.pos], "${") {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos], false, line, nil
+}
+
+// Walk calls fn for every directive in depth-first order with the chain of
+// enclosing block directives.
+func Walk(dirs []*Directive, fn func(d *Directive, parents []*Directive)) {
+	var walk func(dirs []*Directive, parents []*Directive)
+	walk = func(dirs []*Directive, parents []*Directive) {
+		for _, d := range dirs {
+			fn(d, parents)
+			if d.Block != nil {
+				walk(d.Block, append(parents[:len(parents):len(parents)], d))
+			}
+		}
+	}
+	walk(dirs, nil)
+}
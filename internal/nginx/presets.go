@@ -0,0 +1,144 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Preset is a built-in template shipped with hubfly. Sites select it by
+// name in "templates" like a file template; "name@N" pins a version,
+// otherwise the latest is used. Content must pass CheckTemplate.
+type Preset struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+}
+
+const forwardedHeaders = `proxy_set_header Host $host;
+proxy_set_header X-Real-IP $remote_addr;
+proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+proxy_set_header X-Forwarded-Proto $scheme;
+`
+
+// presets holds every version of every preset. Versions are never edited
+// once released; a changed preset gets a new entry.
+var presets = []Preset{
+	{
+		Name: "wordpress", Version: 1,
+		Description: "WordPress: forwarded headers, 64m uploads, blocks config files, xmlrpc and PHP in uploads",
+		Content: forwardedHeaders + `client_max_body_size 64m;
+proxy_read_timeout 300s;
+location ~* /(wp-config\.php|xmlrpc\.php|readme\.html|license\.txt)$ { return 403; }
+location ~* ^/wp-content/uploads/.*\.php$ { return 403; }
+`,
+	},
+	{
+		Name: "nextcloud", Version: 1,
+		Description: "Nextcloud: forwarded headers, large unbuffered uploads, long timeouts, CalDAV/CardDAV discovery",
+		Content: forwardedHeaders + `client_max_body_size 10g;
+proxy_request_buffering off;
+proxy_buffering off;
+proxy_read_timeout 3600s;
+proxy_send_timeout 3600s;
+location = /.well-known/carddav { return 301 $scheme://$host/remote.php/dav; }
+location = /.well-known/caldav { return 301 $scheme://$host/remote.php/dav; }
+`,
+	},
+	{
+		Name: "grafana", Version: 1,
+		Description: "Grafana: forwarded headers and long-lived Grafana Live connections",
+		Content: forwardedHeaders + `proxy_read_timeout 3600s;
+`,
+	},
+	{
+		Name: "websocket", Version: 1,
+		Description: "WebSocket app: forwarded headers, unbuffered responses and hour-long idle connections",
+		Content: forwardedHeaders + `proxy_buffering off;
+proxy_read_timeout 3600s;
+proxy_send_timeout 3600s;
+`,
+	},
+	{
+		Name: "spa", Version: 1,
+		Description: "Single-page app: serves /index.html for paths the upstream answers with 404",
+		Content: `proxy_set_header Host $host;
+proxy_intercept_errors on;
+error_page 404 = /index.html;
+`,
+	},
+}
+
+// Presets returns the latest version of each preset, in declaration order.
+func Presets() []Preset {
+	var latest []Preset
+	index := map[string]int{}
+	for _, p := range presets {
+		if i, ok := index[p.Name]; ok {
+			if p.Version > latest[i].Version {
+				latest[i] = p
+			}
+			continue
+		}
+		index[p.Name] = len(latest)
+		latest = append(latest, p)
+	}
+	return latest
+}
+
+// IsPreset reports whether name (without a version) is a built-in preset.
+func IsPreset(name string) bool {
+	for _, p := range presets {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PresetVersions returns the released versions of a preset, oldest first.
+func PresetVersions(name string) []int {
+	var versions []int
+	for _, p := range presets {
+		if p.Name == name {
+			versions = append(versions, p.Version)
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// LookupPreset resolves "name" or "name@N" to a preset.
+func LookupPreset(ref string) (*Preset, error) {
+	name, version, pinned := strings.Cut(ref, "@")
+	want := 0
+	if pinned {
+		v, err := strconv.Atoi(version)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid preset version in %q", ref)
+		}
+		want = v
+	}
+	var found *Preset
+	for i := range presets {
+		p := &presets[i]
+		if p.Name != name {
+			continue
+		}
+		if p.Version == want {
+			return p, nil
+		}
+		if want == 0 && (found == nil || p.Version > found.Version) {
+			found = p
+		}
+	}
+	if found == nil {
+		if pinned && IsPreset(name) {
+			return nil, fmt.Errorf("preset %s has no version %d", name, want)
+		}
+		return nil, fmt.Errorf("no template or preset named %q", ref)
+	}
+	return found, nil
+}
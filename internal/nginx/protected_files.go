@@ -0,0 +1,39 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// reservedPaths are locations hubfly renders itself.
+var reservedPaths = []string{"/", "/ws/", "/.well-known/acme-challenge/"}
+
+// checkProtectedFiles validates X-Accel-Redirect mappings. Paths and
+// directories are rendered unquoted, so anything that could end the
+// directive is rejected.
+func checkProtectedFiles(mappings []models.FileMapping) error {
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if !strings.HasPrefix(m.Path, "/") || !strings.HasSuffix(m.Path, "/") {
+			return fmt.Errorf("protected_files: path %q must start and end with /", m.Path)
+		}
+		if !strings.HasPrefix(m.Directory, "/") || !strings.HasSuffix(m.Directory, "/") {
+			return fmt.Errorf("protected_files: directory %q must be absolute and end with /", m.Directory)
+		}
+		if strings.ContainsAny(m.Path+m.Directory, " \t\n;{}\"'$#") {
+			return fmt.Errorf("protected_files: %q -> %q contains characters not allowed in a location", m.Path, m.Directory)
+		}
+		for _, r := range reservedPaths {
+			if m.Path == r {
+				return fmt.Errorf("protected_files: path %s is reserved", m.Path)
+			}
+		}
+		if seen[m.Path] {
+			return fmt.Errorf("protected_files: duplicate path %s", m.Path)
+		}
+		seen[m.Path] = true
+	}
+	return nil
+}
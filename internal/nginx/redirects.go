@@ -0,0 +1,89 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// redirectCodes are the status codes a redirect may use. rewrite can only
+// send 301 (permanent) and 302 (redirect).
+var redirectCodes = map[int]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+// CheckRedirects validates redirect rules. A zero code means 301.
+func CheckRedirects(redirects []models.Redirect) error {
+	seen := make(map[string]bool)
+	for _, r := range redirects {
+		if r.Code != 0 && !redirectCodes[r.Code] {
+			return fmt.Errorf("redirects: %s: code must be 301, 302, 303, 307 or 308", r.From)
+		}
+
+		if pattern, ok := strings.CutPrefix(r.From, "~"); ok {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("redirects: regex %q is empty", r.From)
+			}
+			if strings.ContainsFunc(pattern, func(c rune) bool { return c <= ' ' || c == 0x7f }) {
+				return fmt.Errorf("redirects: regex %q must not contain whitespace or control characters", r.From)
+			}
+			if err := checkRegex(pattern); err != nil {
+				return fmt.Errorf("redirects: %s: %w", r.From, err)
+			}
+			if r.Code != 0 && r.Code != 301 && r.Code != 302 {
+				return fmt.Errorf("redirects: %s: regex redirects use rewrite, which only sends 301 or 302", r.From)
+			}
+		} else {
+			if !strings.HasPrefix(r.From, "/") {
+				return fmt.Errorf("redirects: from %q must be a path starting with / or a regex starting with ~", r.From)
+			}
+			if strings.ContainsAny(r.From, " \t\n;{}\"'$#?") {
+				return fmt.Errorf("redirects: from %q contains characters not allowed in a location", r.From)
+			}
+			if strings.HasPrefix(r.From, "/.well-known/acme-challenge/") {
+				return fmt.Errorf("redirects: %s is under the ACME challenge path", r.From)
+			}
+			if seen[r.From] {
+				return fmt.Errorf("redirects: duplicate from %s", r.From)
+			}
+			seen[r.From] = true
+		}
+
+		if !strings.HasPrefix(r.To, "/") && !strings.HasPrefix(r.To, "http://") && !strings.HasPrefix(r.To, "https://") {
+			return fmt.Errorf("redirects: %s: to %q must be a path or an http(s) URL", r.From, r.To)
+		}
+		if strings.ContainsFunc(r.To, func(c rune) bool { return c <= ' ' || c == 0x7f }) {
+			return fmt.Errorf("redirects: %s: to must not contain whitespace or control characters", r.From)
+		}
+	}
+	return nil
+}
+
+// redirectDirective renders a redirect: a server-level rewrite for a regex,
+// which runs before any location is chosen, or an exact location with
+// return otherwise.
+//
+// The client's query string is kept unless To has one of its own. return
+// needs it appended; rewrite appends it by itself, unless the replacement
+// ends in "?".
+func redirectDirective(r models.Redirect) string {
+	if pattern, ok := strings.CutPrefix(r.From, "~"); ok {
+		flag := "permanent"
+		if r.Code == 302 {
+			flag = "redirect"
+		}
+		to := r.To
+		if strings.Contains(to, "?") {
+			to += "?"
+		}
+		return fmt.Sprintf("rewrite %s %s %s;", quote(pattern), quote(to), flag)
+	}
+	code := r.Code
+	if code == 0 {
+		code = 301
+	}
+	to := r.To
+	if !strings.Contains(to, "?") {
+		to += "$is_args$args"
+	}
+	return fmt.Sprintf("location = %s {\n        return %d %s;\n    }", r.From, code, quote(to))
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestRedirects(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "r.local", Domain: "r.local", Upstreams: []string{"app:80"}, SSL: true, ForceSSL: true,
+		Redirects: []models.Redirect{
+			{From: "/spring-sale", To: "https://shop.example.com/sale"},
+			{From: "/old-pricing", To: "/pricing?plan=pro", Code: 308},
+			{From: `~^/blog/(\d{4})/(.*)$`, To: "https://blog.example.com/$1/$2", Code: 302},
+			{From: "~^/docs/(.*)$", To: "/help?page=$1"},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"location = /spring-sale {\n        return 301 \"https://shop.example.com/sale$is_args$args\";\n    }",
+		`return 308 "/pricing?plan=pro";`,
+		`rewrite "^/blog/(\\d{4})/(.*)$" "https://blog.example.com/$1/$2" redirect;`,
+		`rewrite "^/docs/(.*)$" "/help?page=$1?" permanent;`,
+	} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf("Expected %q in:\n%s", want, config)
+		}
+	}
+	// With force_ssl, port 80 redirects to HTTPS first; rules live in the TLS server only.
+	if n := strings.Count(string(config), "location = /spring-sale"); n != 1 {
+		t.Errorf("Expected the redirect once, got %d", n)
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	for _, bad := range []models.Redirect{
+		{From: "spring-sale", To: "/sale"},
+		{From: "/a b", To: "/sale"},
+		{From: "/sale", To: "ftp://example.com"},
+		{From: "/sale", To: "/x; return 200"},
+		{From: "/sale", To: "/x", Code: 200},
+		{From: "~^/(.*", To: "/x"},
+		{From: "~^/a$", To: "/x", Code: 308},
+		{From: "/.well-known/acme-challenge/x", To: "/x"},
+	} {
+		site.Redirects = []models.Redirect{bad}
+		if _, err := mgr.Render(site); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+	site.Redirects = []models.Redirect{{From: "/a", To: "/b"}, {From: "/a", To: "/c"}}
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected duplicate from paths to be rejected")
+	}
+}
@@ -0,0 +1,37 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+var rewriteFlags = map[string]bool{"": true, "last": true, "break": true, "redirect": true, "permanent": true}
+
+// CheckRewrites validates rewrite rules, so a bad pattern is refused by the
+// API instead of failing the nginx reload.
+func CheckRewrites(rewrites []models.Rewrite) error {
+	invalid := func(c rune) bool { return c <= ' ' || c == 0x7f }
+	for i, rw := range rewrites {
+		if rw.Pattern == "" {
+			return fmt.Errorf("rewrites: rule %d: pattern must not be empty", i+1)
+		}
+		if strings.ContainsFunc(rw.Pattern, invalid) {
+			return fmt.Errorf("rewrites: rule %d: pattern must not contain whitespace or control characters", i+1)
+		}
+		if err := checkRegex(rw.Pattern); err != nil {
+			return fmt.Errorf("rewrites: rule %d: %w", i+1, err)
+		}
+		if rw.Replacement == "" {
+			return fmt.Errorf("rewrites: rule %d: replacement must not be empty", i+1)
+		}
+		if strings.ContainsFunc(rw.Replacement, invalid) {
+			return fmt.Errorf("rewrites: rule %d: replacement must not contain whitespace or control characters", i+1)
+		}
+		if !rewriteFlags[rw.Flag] {
+			return fmt.Errorf("rewrites: rule %d: flag must be last, break, redirect, permanent or empty", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestRewrites(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "rw.local", Domain: "rw.local", Upstreams: []string{"app:80"},
+		Rewrites: []models.Rewrite{
+			{Pattern: `^/api/v1/(.*)$`, Replacement: "/v1/$1", Flag: "break"},
+			{Pattern: `^/(\w{2})/shop$`, Replacement: "/shop?lang=$1"},
+		},
+		Routes: []models.RouteOverride{{Path: "/reports/", ReadTimeout: 300}},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`rewrite "^/api/v1/(.*)$" "/v1/$1" break;`,
+		`rewrite "^/(\\w{2})/shop$" "/shop?lang=$1";`,
+	} {
+		// Once in the root location and once in the route, which doesn't
+		// inherit rewrite directives.
+		if n := strings.Count(string(config), want); n != 2 {
+			t.Errorf("Expected %q twice, got %d in:\n%s", want, n, config)
+		}
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	for _, bad := range []models.Rewrite{
+		{Pattern: "", Replacement: "/x"},
+		{Pattern: "^/(a", Replacement: "/x"},
+		{Pattern: "^/[a", Replacement: "/x"},
+		{Pattern: "^/a b", Replacement: "/x"},
+		{Pattern: "^/a", Replacement: ""},
+		{Pattern: "^/a", Replacement: "/x; return 200"},
+		{Pattern: "^/a", Replacement: "/x", Flag: "stop"},
+	} {
+		if err := CheckRewrites([]models.Rewrite{bad}); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+	if err := CheckRewrites([]models.Rewrite{{Pattern: `^/(?!admin)(.*)$`, Replacement: "/$1"}}); err != nil {
+		t.Errorf("Expected a PCRE lookahead to be left to nginx, got %v", err)
+	}
+}
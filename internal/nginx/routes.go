@@ -0,0 +1,75 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// maxRouteTimeout bounds route timeouts (one day).
+const maxRouteTimeout = 86400
+
+// nextUpstreamConditions are the values proxy_next_upstream accepts.
+var nextUpstreamConditions = map[string]bool{
+	"error": true, "timeout": true, "invalid_header": true, "non_idempotent": true, "off": true,
+	"http_500": true, "http_502": true, "http_503": true, "http_504": true,
+	"http_403": true, "http_404": true, "http_429": true,
+}
+
+// checkRoutes validates route overrides. Routes are nested in the root
+// location, so a path under one of the server-level locations would never
+// be matched and is rejected.
+func checkRoutes(site *models.Site) error {
+	shadowing := []string{"/ws/", "/.well-known/acme-challenge/"}
+	for _, f := range site.ProtectedFiles {
+		shadowing = append(shadowing, f.Path)
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range site.Routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("routes: path %q must start with /", r.Path)
+		}
+		if r.Path == "/" {
+			return fmt.Errorf("routes: path / is the site itself; set site-wide timeouts in extra_config")
+		}
+		if strings.ContainsAny(r.Path, " \t\n;{}\"'$#") {
+			return fmt.Errorf("routes: path %q contains characters not allowed in a location", r.Path)
+		}
+		for _, p := range shadowing {
+			if strings.HasPrefix(r.Path, p) {
+				return fmt.Errorf("routes: path %s is under %s, which hubfly serves itself", r.Path, p)
+			}
+		}
+		if seen[r.Path] {
+			return fmt.Errorf("routes: duplicate path %s", r.Path)
+		}
+		seen[r.Path] = true
+
+		for _, t := range []int{r.ReadTimeout, r.SendTimeout, r.ConnectTimeout} {
+			if t < 0 || t > maxRouteTimeout {
+				return fmt.Errorf("routes: %s: timeouts must be between 0 and %d seconds", r.Path, maxRouteTimeout)
+			}
+		}
+		if r.ConnectTimeout > 75 {
+			return fmt.Errorf("routes: %s: connect_timeout_seconds cannot exceed 75", r.Path)
+		}
+
+		if r.Retries == nil {
+			continue
+		}
+		for _, c := range r.Retries.On {
+			if !nextUpstreamConditions[c] {
+				return fmt.Errorf("routes: %s: unknown retry condition %q", r.Path, c)
+			}
+			if c == "off" && len(r.Retries.On) > 1 {
+				return fmt.Errorf("routes: %s: retry condition \"off\" cannot be combined with others", r.Path)
+			}
+		}
+		if r.Retries.Tries < 0 || r.Retries.Timeout < 0 {
+			return fmt.Errorf("routes: %s: retries tries and timeout_seconds must not be negative", r.Path)
+		}
+	}
+	return nil
+}
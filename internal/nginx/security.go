@@ -0,0 +1,169 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Severities of security findings. Other lint warnings have none.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+)
+
+// userVariable matches nginx variables a client controls: headers,
+// arguments, cookies, the URI and regex captures.
+var userVariable = regexp.MustCompile(`\$\{?(http_\w+|arg_\w+|cookie_\w+|host|request_uri|uri|document_uri|args|query_string|request_body|[1-9])\b`)
+
+var variableRef = regexp.MustCompile(`\$\{?(\w+)\}?`)
+
+// ScanConfig parses config and runs the security checks on it.
+func ScanConfig(config []byte) ([]LintWarning, error) {
+	dirs, err := Parse(config)
+	if err != nil {
+		return nil, err
+	}
+	return scanSecurity(dirs), nil
+}
+
+// SecurityFinding is a security check result in a live config file.
+type SecurityFinding struct {
+	File string `json:"file"`
+	LintWarning
+}
+
+// ScanSecurity runs the security checks on every config in the sites
+// directory plus the main nginx.conf, as ScanServerNames reads them.
+func (m *Manager) ScanSecurity() ([]SecurityFinding, error) {
+	files, err := filepath.Glob(filepath.Join(m.SitesDir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(m.NginxConf); err == nil {
+		files = append(files, m.NginxConf)
+	}
+
+	var findings []SecurityFinding
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		found, err := ScanConfig(data)
+		if err != nil {
+			// Unparseable files are reported by nginx itself; skip them here.
+			continue
+		}
+		for _, f := range found {
+			findings = append(findings, SecurityFinding{File: file, LintWarning: f})
+		}
+	}
+	return findings, nil
+}
+
+// scanSecurity is an embedded subset of gixy's checks, under the same
+// rule names:
+//   - host_spoofing: the Host sent upstream comes from $http_host.
+//   - alias_traversal: a location without a trailing slash aliases a
+//     directory, so /files../ reaches the directory's parent.
+//   - ssrf: the upstream address of proxy_pass or grpc_pass comes from the
+//     request, directly or through a "set" variable.
+func scanSecurity(dirs []*Directive) []LintWarning {
+	// Variables are resolved across the whole file: a location may proxy
+	// through a variable any "set" assigns.
+	sets := map[string][]string{}
+	Walk(dirs, func(d *Directive, _ []*Directive) {
+		if d.Name == "set" && len(d.Args) == 2 {
+			name := strings.TrimPrefix(d.Args[0], "$")
+			sets[name] = append(sets[name], d.Args[1])
+		}
+	})
+
+	var findings []LintWarning
+	Walk(dirs, func(d *Directive, _ []*Directive) {
+		switch d.Name {
+		case "proxy_set_header", "grpc_set_header":
+			if len(d.Args) == 2 && strings.EqualFold(d.Args[0], "Host") && strings.Contains(d.Args[1], "$http_host") {
+				findings = append(findings, LintWarning{
+					Rule:     "host_spoofing",
+					Severity: SeverityMedium,
+					Message:  fmt.Sprintf("%s Host uses $http_host, the raw header a client may forge; use $host", d.Name),
+					Line:     d.Line,
+				})
+			}
+		case "location":
+			if len(d.Args) == 0 {
+				return
+			}
+			path := d.Args[len(d.Args)-1]
+			if len(d.Args) == 2 && d.Args[0] != "^~" || strings.HasSuffix(path, "/") {
+				return
+			}
+			for _, c := range d.Block {
+				if c.Name == "alias" && len(c.Args) == 1 && strings.HasSuffix(c.Args[0], "/") {
+					findings = append(findings, LintWarning{
+						Rule:     "alias_traversal",
+						Severity: SeverityHigh,
+						Message:  fmt.Sprintf("location %s has no trailing slash but aliases %s, so %s../ reads its parent directory", path, c.Args[0], path),
+						Line:     c.Line,
+					})
+				}
+			}
+		case "proxy_pass", "grpc_pass":
+			if len(d.Args) != 1 {
+				return
+			}
+			for _, target := range expandSets(d.Args[0], sets, 3) {
+				if v := userVariable.FindString(upstreamHost(target)); v != "" {
+					findings = append(findings, LintWarning{
+						Rule:     "ssrf",
+						Severity: SeverityHigh,
+						Message:  fmt.Sprintf("%s picks its upstream from %s, which the client controls", d.Name, v),
+						Line:     d.Line,
+					})
+					break
+				}
+			}
+		}
+	})
+	return findings
+}
+
+// expandSets lists the values arg can take once variables assigned with
+// "set" are replaced, a few levels deep.
+func expandSets(arg string, sets map[string][]string, depth int) []string {
+	if depth > 0 {
+		for _, loc := range variableRef.FindAllStringSubmatchIndex(arg, -1) {
+			values, ok := sets[arg[loc[2]:loc[3]]]
+			if !ok {
+				continue
+			}
+			var out []string
+			for _, v := range values {
+				out = append(out, expandSets(arg[:loc[0]]+v+arg[loc[1]:], sets, depth-1)...)
+			}
+			return out
+		}
+	}
+	return []string{arg}
+}
+
+// pathVariable starts the URI part of a proxy_pass target.
+var pathVariable = regexp.MustCompile(`/|\$\{?(request_uri|uri|document_uri|is_args|args|query_string)\b`)
+
+// upstreamHost is the scheme and address part of a proxy_pass target,
+// without the URI: variables in the URI only change what is requested, not
+// which server is asked.
+func upstreamHost(target string) string {
+	scheme := 0
+	if i := strings.Index(target, "://"); i >= 0 {
+		scheme = i + 3
+	}
+	if loc := pathVariable.FindStringIndex(target[scheme:]); loc != nil && loc[0] > 0 {
+		return target[:scheme+loc[0]]
+	}
+	return target
+}
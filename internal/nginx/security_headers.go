@@ -0,0 +1,122 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/hsts"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// SecurityHeaderPresets are the named sets of security headers.
+// "recommended" is safe for most sites; a CSP is site specific and never
+// part of a preset.
+var SecurityHeaderPresets = map[string]models.SecurityHeaders{
+	"recommended": {
+		HSTS:               &models.HSTSHeader{MaxAge: defaultHSTSMaxAge},
+		ContentTypeOptions: true,
+		FrameOptions:       "SAMEORIGIN",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+	},
+}
+
+// defaultHSTSMaxAge is used when an HSTS policy has no max-age (one year).
+const defaultHSTSMaxAge = 31536000
+
+var referrerPolicies = map[string]bool{
+	"no-referrer": true, "no-referrer-when-downgrade": true, "origin": true, "origin-when-cross-origin": true,
+	"same-origin": true, "strict-origin": true, "strict-origin-when-cross-origin": true, "unsafe-url": true,
+}
+
+// securityHeaders are a site's resolved header values, ready to render.
+type securityHeaders struct {
+	HSTS               string
+	ContentTypeOptions bool
+	FrameOptions       string
+	ReferrerPolicy     string
+	CSP                string
+}
+
+// CheckSecurityHeaders validates a site's security headers.
+func CheckSecurityHeaders(h *models.SecurityHeaders) error {
+	if h == nil {
+		return nil
+	}
+	if _, ok := SecurityHeaderPresets[h.Preset]; !ok && h.Preset != "" {
+		return fmt.Errorf("security_headers: unknown preset %q (use recommended)", h.Preset)
+	}
+	if h.HSTS != nil {
+		if h.HSTS.MaxAge < 0 {
+			return fmt.Errorf("security_headers: hsts max_age_seconds must not be negative")
+		}
+		if h.HSTS.Preload && (!h.HSTS.IncludeSubDomains || (h.HSTS.MaxAge != 0 && h.HSTS.MaxAge < hsts.MinMaxAge)) {
+			return fmt.Errorf("security_headers: hsts preload requires include_subdomains and a max_age_seconds of at least %d", hsts.MinMaxAge)
+		}
+	}
+	switch strings.ToUpper(h.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		return fmt.Errorf("security_headers: x_frame_options must be DENY or SAMEORIGIN")
+	}
+	if h.ReferrerPolicy != "" && !referrerPolicies[strings.ToLower(h.ReferrerPolicy)] {
+		return fmt.Errorf("security_headers: unknown referrer_policy %q", h.ReferrerPolicy)
+	}
+	if len(h.CSP) > 8192 {
+		return fmt.Errorf("security_headers: content_security_policy is longer than 8192 bytes")
+	}
+	for _, r := range h.CSP {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("security_headers: content_security_policy contains control characters")
+		}
+	}
+	if strings.Contains(h.CSP, "$") {
+		// nginx would expand it as a variable
+		return fmt.Errorf("security_headers: content_security_policy must not contain $")
+	}
+	return nil
+}
+
+// resolveSecurityHeaders applies the preset under the site's own values.
+func resolveSecurityHeaders(h *models.SecurityHeaders) *securityHeaders {
+	if h == nil {
+		return nil
+	}
+	merged := SecurityHeaderPresets[h.Preset]
+	if h.HSTS != nil {
+		merged.HSTS = h.HSTS
+	}
+	if h.ContentTypeOptions {
+		merged.ContentTypeOptions = true
+	}
+	if h.FrameOptions != "" {
+		merged.FrameOptions = h.FrameOptions
+	}
+	if h.ReferrerPolicy != "" {
+		merged.ReferrerPolicy = h.ReferrerPolicy
+	}
+	merged.CSP = h.CSP
+
+	out := &securityHeaders{
+		ContentTypeOptions: merged.ContentTypeOptions,
+		FrameOptions:       strings.ToUpper(merged.FrameOptions),
+		ReferrerPolicy:     strings.ToLower(merged.ReferrerPolicy),
+		CSP:                merged.CSP,
+	}
+	if merged.HSTS != nil {
+		maxAge := merged.HSTS.MaxAge
+		if maxAge == 0 {
+			maxAge = defaultHSTSMaxAge
+		}
+		out.HSTS = fmt.Sprintf("max-age=%d", maxAge)
+		if merged.HSTS.IncludeSubDomains {
+			out.HSTS += "; includeSubDomains"
+		}
+		if merged.HSTS.Preload {
+			out.HSTS += "; preload"
+		}
+	}
+	if *out == (securityHeaders{}) {
+		return nil
+	}
+	return out
+}
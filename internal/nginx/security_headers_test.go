@@ -0,0 +1,60 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "sec.local", Domain: "sec.local", Upstreams: []string{"app:80"}, SSL: true,
+		SecurityHeaders: &models.SecurityHeaders{
+			Preset:       "recommended",
+			HSTS:         &models.HSTSHeader{MaxAge: 63072000, IncludeSubDomains: true, Preload: true},
+			FrameOptions: "deny",
+			CSP:          `default-src 'self'; img-src "data:"`,
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		`on "max-age=63072000; includeSubDomains; preload";`,
+		`add_header Strict-Transport-Security $hsts_sec_local_3f089741 always;`,
+		`add_header X-Content-Type-Options "nosniff" always;`,
+		`add_header X-Frame-Options "DENY" always;`,
+		`add_header Referrer-Policy "strict-origin-when-cross-origin" always;`,
+		`add_header Content-Security-Policy "default-src 'self'; img-src \"data:\"" always;`,
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in:\n%s", want, cfg)
+		}
+	}
+	// Server level in both servers, plus each root location.
+	if n := strings.Count(cfg, "add_header X-Frame-Options"); n != 4 {
+		t.Errorf("Expected X-Frame-Options 4 times, got %d", n)
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	for _, bad := range []models.SecurityHeaders{
+		{Preset: "strict"},
+		{FrameOptions: "ALLOW-FROM https://x"},
+		{ReferrerPolicy: "everywhere"},
+		{CSP: "default-src 'self'\nX-Injected: 1"},
+		{CSP: "script-src $host"},
+		{HSTS: &models.HSTSHeader{MaxAge: -1}},
+		{HSTS: &models.HSTSHeader{MaxAge: 300, IncludeSubDomains: true, Preload: true}},
+		{HSTS: &models.HSTSHeader{Preload: true}},
+	} {
+		if err := CheckSecurityHeaders(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
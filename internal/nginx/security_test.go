@@ -0,0 +1,85 @@
+package nginx
+
+import (
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestScanConfig(t *testing.T) {
+	config := `
+server {
+    set $backend "http://$http_x_backend";
+    location /files { alias /srv/files/; }
+    location /static/ { alias /srv/static/; }
+    location = /logo.png { alias /srv/logo.png; }
+    location /a/ {
+        proxy_set_header Host $http_host;
+        proxy_pass $backend;
+    }
+    location /b/ { proxy_pass http://$host$request_uri; }
+    location /c/ { proxy_pass http://app:80$request_uri; }
+    location /d/ { proxy_pass http://app:80/$arg_path; }
+    location /e/ { grpc_pass grpc://$arg_target; }
+}
+`
+	findings, err := ScanConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := map[string][]int{}
+	for _, f := range findings {
+		if f.Severity == "" {
+			t.Errorf("Expected a severity: %+v", f)
+		}
+		lines[f.Rule] = append(lines[f.Rule], f.Line)
+	}
+	want := map[string][]int{
+		"alias_traversal": {4},
+		"host_spoofing":   {8},
+		"ssrf":            {9, 11, 14},
+	}
+	for rule, l := range want {
+		if len(lines[rule]) != len(l) {
+			t.Errorf("rule %s: got lines %v, want %v", rule, lines[rule], l)
+			continue
+		}
+		for i := range l {
+			if lines[rule][i] != l[i] {
+				t.Errorf("rule %s: got lines %v, want %v", rule, lines[rule], l)
+			}
+		}
+	}
+}
+
+func TestScanRenderedSite(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "app.local", Domain: "app.local", Upstreams: []string{"app:80"},
+		ProxySetHeaders: map[string]string{"Host": "$host"},
+		TrafficMirror:   &models.Mirror{Upstream: "shadow:80"},
+		CanaryRelease:   &models.Canary{Upstream: "app-v2:80", Percent: 10},
+		ForceSSL:        true, SSL: true,
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := ScanConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Errorf("Unexpected finding in a generated config: %+v", f)
+	}
+
+	site.ExtraConfig = "proxy_set_header Host $http_host;"
+	site.ProxySetHeaders = nil
+	found := false
+	for _, w := range mgr.Lint(site, nil) {
+		found = found || w.Rule == "host_spoofing"
+	}
+	if !found {
+		t.Errorf("Expected Lint to report host_spoofing from extra_config")
+	}
+}
@@ -0,0 +1,193 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// serverNameKeys returns the names nginx indexes a server_name under.
+// ".example.com" is shorthand for both "example.com" and "*.example.com".
+// Regex names ("~...") and the catch-all "_" are not comparable and yield
+// no keys.
+func serverNameKeys(name string) []string {
+	n := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	if n == "" || n == "_" || strings.HasPrefix(n, "~") {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(n, "."); ok {
+		return []string{rest, "*." + rest}
+	}
+	return []string{n}
+}
+
+// IsRegexServerName reports whether name is a regular expression ("~...").
+func IsRegexServerName(name string) bool {
+	return strings.HasPrefix(name, "~")
+}
+
+// IsWildcardServerName reports whether name is a "*.example.com" wildcard.
+func IsWildcardServerName(name string) bool {
+	return strings.HasPrefix(name, "*.")
+}
+
+// regexSyntaxErrors are the regexp/syntax errors that PCRE reports too.
+// Others (lookarounds, possessive repeats, unknown escapes) are PCRE
+// features Go lacks and are left to nginx -t.
+var regexSyntaxErrors = map[syntax.ErrorCode]bool{
+	syntax.ErrMissingParen:          true,
+	syntax.ErrUnexpectedParen:       true,
+	syntax.ErrMissingBracket:        true,
+	syntax.ErrInvalidCharRange:      true,
+	syntax.ErrMissingRepeatArgument: true,
+	syntax.ErrTrailingBackslash:     true,
+}
+
+// checkRegex rejects a PCRE pattern that is broken in any regex dialect.
+func checkRegex(pattern string) error {
+	if _, err := syntax.Parse(pattern, syntax.Perl); err != nil {
+		if se, ok := err.(*syntax.Error); !ok || regexSyntaxErrors[se.Code] {
+			return fmt.Errorf("invalid regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// CheckServerName rejects a site name nginx would refuse or misread. Plain
+// names are hostnames, wildcards are a single leading "*." label (the only
+// form a certificate can cover) and regexes start with "~".
+func CheckServerName(name string) error {
+	if IsRegexServerName(name) {
+		pattern := name[1:]
+		if pattern == "" {
+			return fmt.Errorf("server name %q: empty regex", name)
+		}
+		if strings.ContainsFunc(pattern, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+			return fmt.Errorf("server name %q: regex must not contain whitespace or control characters", name)
+		}
+		if err := checkRegex(pattern); err != nil {
+			return fmt.Errorf("server name %q: %w", name, err)
+		}
+		return nil
+	}
+
+	host := strings.TrimPrefix(name, "*.")
+	if host == "" {
+		return fmt.Errorf("server name must not be empty")
+	}
+	if strings.Contains(host, "*") {
+		return fmt.Errorf("server name %q: only a leading \"*.\" wildcard label is supported", name)
+	}
+	for _, r := range host {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_') {
+			return fmt.Errorf("server name %q: invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
+// checkServerNameSyntax validates every server name of the site.
+func checkServerNameSyntax(site *models.Site) error {
+	for _, name := range site.ServerNames() {
+		if err := CheckServerName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverNames renders the arguments of a server_name directive. Regexes
+// are quoted so "{", ";" and friends don't end the directive.
+func serverNames(names []string) string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		if IsRegexServerName(name) {
+			out[i] = quote(name)
+		} else {
+			out[i] = name
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// ServerNamesConflict reports whether nginx would see a and b as the same
+// server name, in which case it serves one of the two sites silently.
+// Distinct exact and wildcard names do not conflict: nginx prefers the
+// exact name, then the longest wildcard.
+func ServerNamesConflict(a, b string) bool {
+	for _, ka := range serverNameKeys(a) {
+		for _, kb := range serverNameKeys(b) {
+			if ka == kb {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindServerNameConflict returns the first site other than site that claims
+// one of site's server names.
+func FindServerNameConflict(site *models.Site, sites []models.Site) (other *models.Site, name string) {
+	for i := range sites {
+		if sites[i].ID == site.ID {
+			continue
+		}
+		for _, mine := range site.ServerNames() {
+			for _, theirs := range sites[i].ServerNames() {
+				if ServerNamesConflict(mine, theirs) {
+					return &sites[i], mine
+				}
+			}
+		}
+	}
+	return nil, ""
+}
+
+// ServerNameClaim is a server_name found in an nginx config file.
+type ServerNameClaim struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// ScanServerNames collects the server_name entries from every config in
+// the sites directory plus the main nginx.conf, including files that were
+// not written by hubfly.
+func (m *Manager) ScanServerNames() ([]ServerNameClaim, error) {
+	files, err := filepath.Glob(filepath.Join(m.SitesDir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(m.NginxConf); err == nil {
+		files = append(files, m.NginxConf)
+	}
+
+	var claims []ServerNameClaim
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		dirs, err := Parse(data)
+		if err != nil {
+			// Unparseable files are reported by nginx itself; skip them here.
+			continue
+		}
+		Walk(dirs, func(d *Directive, parents []*Directive) {
+			if d.Name != "server_name" || !inside(parents, "server") {
+				return
+			}
+			for _, name := range d.Args {
+				if len(serverNameKeys(name)) == 0 {
+					continue
+				}
+				claims = append(claims, ServerNameClaim{Name: name, File: file, Line: d.Line})
+			}
+		})
+	}
+	return claims, nil
+}
@@ -0,0 +1,116 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestServerNamesConflict(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"example.com", "EXAMPLE.com.", true},
+		{"*.example.com", "*.example.com", true},
+		{".example.com", "example.com", true},
+		{".example.com", "*.example.com", true},
+		{"*.example.com", "www.example.com", false}, // exact name wins in nginx
+		{"*.example.com", "*.sub.example.com", false},
+		{"~^www\\d+\\.example\\.com$", "~^www\\d+\\.example\\.com$", false},
+		{"_", "_", false},
+	}
+	for _, c := range cases {
+		if got := ServerNamesConflict(c.a, c.b); got != c.want {
+			t.Errorf("ServerNamesConflict(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+
+	site := &models.Site{ID: "new", Domain: "new.example.com", Aliases: []string{".shop.example.com"}}
+	sites := []models.Site{
+		{ID: "new", Domain: "new.example.com"},
+		{ID: "shop", Domain: "shop.example.com"},
+	}
+	other, name := FindServerNameConflict(site, sites)
+	if other == nil || other.ID != "shop" || name != ".shop.example.com" {
+		t.Errorf("Expected conflict with shop via alias, got %v %q", other, name)
+	}
+}
+
+func TestScanServerNames(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nginx_test_names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mgr := NewManager(tmpDir)
+	mgr.NginxConf = filepath.Join(tmpDir, "nginx.conf")
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(mgr.NginxConf, []byte("http { server { listen 80 default_server; server_name _; } }"), 0644)
+	os.WriteFile(filepath.Join(mgr.SitesDir, "manual.conf"), []byte("server {\n  listen 80;\n  server_name legacy.local www.legacy.local;\n}\n"), 0644)
+
+	claims, err := mgr.ScanServerNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 2 || claims[0].Name != "legacy.local" || claims[1].Line != 3 {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+}
+
+func TestCheckServerName(t *testing.T) {
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{"example.com", true},
+		{"*.apps.example.com", true},
+		{".example.com", true},
+		{"_", true},
+		{`~^(?<app>[a-z]+)\.apps\.example\.com$`, true},
+		{`~^www(?=\d)`, true}, // PCRE lookahead, left to nginx -t
+		{"www.*.example.com", false},
+		{"example.*", false},
+		{"bad name.com", false},
+		{"evil.com;", false},
+		{"~", false},
+		{"~^(unclosed", false},
+		{"~^a b$", false},
+	}
+	for _, c := range cases {
+		if err := CheckServerName(c.name); (err == nil) != c.ok {
+			t.Errorf("CheckServerName(%q) = %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestRenderRegexServerName(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "apps", Domain: `~^(?<app>[a-z]{2,})\.apps\.example\.com$`,
+		Aliases: []string{"*.apps.example.com"}, Upstreams: []string{"app:80"},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `server_name "~^(?<app>[a-z]{2,})\\.apps\\.example\\.com$" *.apps.example.com;`
+	if !strings.Contains(string(config), want) {
+		t.Errorf("Expected %s in:\n%s", want, config)
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	site.Aliases = []string{"www.*.example.com"}
+	if _, err := mgr.Render(site); err == nil {
+		t.Error("Expected a mid-name wildcard to be rejected")
+	}
+}
@@ -0,0 +1,656 @@
+package nginx
+
+// siteTemplate renders a site's server blocks. Pieces shared by the HTTP and
+// HTTPS servers live in named sub-templates so both stay in sync.
+const siteTemplate = `
+{{ define "firewall_locations" }}
+    {{ if .Firewall }}
+    {{ if .Firewall.BlockRules }}
+    {{ range .Firewall.BlockRules.Paths }}
+    location ~ {{ . }} { return 403; }
+    {{ end }}
+    {{ if .Firewall.BlockRules.Extensions }}
+    location ~* \.({{ join (extensions .Firewall.BlockRules.Extensions) "|" }})(/|$) { return 403; }
+    {{ end }}
+    {{ range $path, $methods := .Firewall.BlockRules.PathMethods }}
+    location ~ {{ $path }} {
+        {{ template "geo_block" $ }}
+        {{ template "jwt_gate" $ }}
+        if ($request_method ~* "({{ join $methods "|" }})") { return 405; }
+        # 'location' blocks capture the request, so allowed methods must be
+        # proxied from here as well.
+        set $upstream_endpoint "{{ $.Upstream.URL $.Protocol }}";
+        {{ if $.GRPC }}
+        grpc_pass $upstream_endpoint;
+        {{ template "grpc_headers" $ }}
+        {{ else }}
+        proxy_pass $upstream_endpoint;
+        proxy_http_version 1.1;
+        {{ template "upgrade_headers" $ }}
+        {{ template "ws_timeouts" $ }}
+        proxy_set_header Host {{ with $.UpstreamHost }}{{ . }}{{ else }}$host{{ end }};
+        {{ range $k, $v := $.ProxySetHeaders }}
+        proxy_set_header {{ $k }} {{ $v }};
+        {{ end }}
+        {{ template "early_data_header" $ }}
+        {{ template "client_cert_headers" $ }}
+        {{ template "response_rewrite" $ }}
+        {{ end }}
+    }
+    {{ end }}
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "response_rewrite" }}
+    {{ if .ResponseRewrite }}
+    # sub_filter only sees uncompressed bodies
+    proxy_set_header Accept-Encoding "";
+    {{ range .ResponseRewrite.Rules }}
+    sub_filter {{ quote .Find }} {{ quote .Replace }};
+    {{ end }}
+    sub_filter_once {{ if .ResponseRewrite.Once }}on{{ else }}off{{ end }};
+    {{ if .ResponseRewrite.Types }}
+    sub_filter_types {{ join .ResponseRewrite.Types " " }};
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "proxy_headers" }}
+        proxy_http_version 1.1;
+        {{ template "upgrade_headers" . }}
+
+        {{ with .UpstreamHost }}proxy_set_header Host {{ . }};{{ end }}
+        {{ range $k, $v := .ProxySetHeaders }}
+        proxy_set_header {{ $k }} {{ $v }};
+        {{ end }}
+        {{ template "early_data_header" . }}
+        {{ template "client_cert_headers" . }}
+{{ end }}
+
+{{/* Tells the upstream a request came as TLS 1.3 early data, which an
+     attacker can replay. */}}
+{{ define "early_data_header" }}
+        {{ with .TLSSession }}{{ if .EarlyHeader }}
+        proxy_set_header Early-Data $ssl_early_data;
+        {{ end }}{{ end }}
+{{ end }}
+
+{{ define "client_cert_headers" }}
+        {{ with .ClientAuth }}{{ range $k, $v := .Headers }}
+        proxy_set_header {{ $k }} {{ $v }};
+        {{ end }}{{ end }}
+{{ end }}
+
+{{ define "upgrade_headers" }}
+        # WebSocket Support
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection {{ .WS.Connection }};
+{{ end }}
+
+{{/* Not part of upgrade_headers: routes repeat those headers but may set
+     their own timeouts. */}}
+{{ define "ws_timeouts" }}
+        {{ if .WS.Timeout }}
+        proxy_read_timeout {{ .WS.Timeout }}s;
+        proxy_send_timeout {{ .WS.Timeout }}s;
+        {{ end }}
+{{ end }}
+
+{{ define "grpc_headers" }}
+        {{ range $k, $v := .GRPCHeaders }}
+        grpc_set_header {{ $k }} {{ $v }};
+        {{ end }}
+        {{ with .TLSSession }}{{ if .EarlyHeader }}
+        grpc_set_header Early-Data $ssl_early_data;
+        {{ end }}{{ end }}
+        {{ with .ClientAuth }}{{ range $k, $v := .Headers }}
+        grpc_set_header {{ $k }} {{ $v }};
+        {{ end }}{{ end }}
+{{ end }}
+
+{{ define "upstream_tls" }}
+    {{ with .UpstreamTLS }}{{ $t := . }}{{ range .Prefixes }}
+    {{ if $t.ClientCert }}{{ . }}_ssl_certificate {{ $t.ClientCert }};
+    {{ . }}_ssl_certificate_key {{ $t.ClientKey }};{{ end }}
+    {{ if $t.CA }}{{ . }}_ssl_trusted_certificate {{ $t.CA }};{{ end }}
+    {{ if $t.Verify }}{{ . }}_ssl_verify on;{{ end }}
+    {{ if $t.SNI }}{{ . }}_ssl_server_name on;{{ end }}
+    {{ if $t.ServerName }}{{ . }}_ssl_name {{ $t.ServerName }};{{ end }}
+    {{ end }}{{ end }}
+{{ end }}
+
+{{ define "tls_session" }}
+    {{ with .TLSSession }}
+    {{ if .SessionCache }}ssl_session_cache {{ .SessionCache }};{{ end }}
+    {{ if .SessionTickets }}ssl_session_tickets {{ .SessionTickets }};{{ end }}
+    {{ if .EarlyData }}ssl_early_data on;{{ end }}
+    {{ end }}
+    {{ with .ClientAuth }}
+    ssl_client_certificate {{ .CA }};
+    ssl_verify_client {{ .Verify }};
+    {{ end }}
+{{ end }}
+
+{{ define "root_location" }}
+    location / {
+        set $upstream_endpoint "{{ .Upstream.URL .Protocol }}";
+
+        {{ if .Firewall }}
+        {{ range .Firewall.IPRules }}
+        {{ .Action }} {{ .Value }};
+        {{ end }}
+
+        {{ template "block_rules" . }}
+
+        {{ if .Firewall.RateLimit }}
+        {{ if .Firewall.RateLimit.Enabled }}
+        limit_req zone=zone_{{ .ID }} burst={{ .Firewall.RateLimit.Burst }} nodelay;
+        {{ end }}
+        {{ end }}
+        {{ end }}
+        {{/* limit_req is only inherited by locations without their own */}}
+        {{ template "capacity_queue" . }}
+        {{ template "jwt_gate" . }}
+        {{ template "rewrites" . }}
+
+        {{ if .GRPC }}
+        grpc_pass $upstream_endpoint;
+        {{ template "grpc_headers" . }}
+        {{ else }}
+        proxy_pass $upstream_endpoint;
+        {{ if .Shadow }}mirror /_hubfly_mirror;{{ end }}
+        {{ template "proxy_headers" . }}
+        {{ template "ws_timeouts" . }}
+        {{ template "response_rewrite" . }}
+        {{ template "proxy_cache" . }}
+        {{ end }}
+        {{ template "security_headers" . }}
+
+        {{ .TemplateSnippets }}
+        {{ .ExtraConfig }}
+
+        {{ template "routes" . }}
+        {{ template "static_assets" . }}
+    }
+{{ end }}
+
+{{/* Static asset rules are nested in the root location like routes and
+     repeat proxy_pass, the rewrite module and add_header. Being regex
+     locations, they take precedence over route prefixes. expires only
+     applies to successful and redirect responses, so errors aren't
+     cached. */}}
+{{ define "static_assets" }}
+    {{ range .StaticAssets }}
+    location {{ .Location }} {
+        set $upstream_endpoint "{{ $.Upstream.URL $.Protocol }}";
+        {{ template "block_rules" $ }}
+        {{ template "rewrites" $ }}
+        proxy_pass $upstream_endpoint;
+        proxy_hide_header Cache-Control;
+        proxy_hide_header Expires;
+        proxy_hide_header Pragma;
+        expires {{ .MaxAge }}s;
+        add_header Cache-Control "{{ .CacheControl }}";
+        {{ template "security_headers" $ }}
+        {{ if $.ProxyCache }}add_header X-Cache-Status $upstream_cache_status always;{{ end }}
+    }
+    {{ end }}
+{{ end }}
+
+{{ define "rewrites" }}
+    {{ range .Rewrites }}
+    rewrite {{ quote .Pattern }} {{ quote .Replacement }}{{ if .Flag }} {{ .Flag }}{{ end }};
+    {{ end }}
+{{ end }}
+
+{{ define "block_rules" }}
+    {{ template "geo_block" . }}
+    {{ if .Firewall }}{{ if .Firewall.BlockRules }}
+    {{ if .Firewall.BlockRules.UserAgents }}
+    if ($http_user_agent ~* "({{ join .Firewall.BlockRules.UserAgents "|" }})") { return 403; }
+    {{ end }}
+    {{ if .Firewall.BlockRules.Methods }}
+    if ($request_method ~* "({{ join .Firewall.BlockRules.Methods "|" }})") { return 405; }
+    {{ end }}
+    {{ if .Firewall.BlockRules.ContentTypes }}
+    if ($content_type ~* "^({{ join (quoteRegex .Firewall.BlockRules.ContentTypes) "|" }})") { return 415; }
+    {{ end }}
+    {{ end }}{{ end }}
+{{ end }}
+
+{{ define "geo_block" }}
+    {{ if .Geo }}
+    if ($geo_blocked_{{ ident .ID }}) { return 403; }
+    {{ end }}
+{{ end }}
+
+{{/* Route overrides are nested in the root location and inherit its
+     settings, except proxy_pass and the rewrite module ("set", "if"),
+     which are repeated. A route with a protocol other than the site's
+     also sets its own headers, since proxy_set_header and grpc_set_header
+     don't carry over to each other. */}}
+{{ define "routes" }}
+    {{ range .Routes }}
+    {{ $protocol := routeProtocol . }}{{ $grpc := isGRPC $protocol }}
+    {{ $p := "proxy" }}{{ if $grpc }}{{ $p = "grpc" }}{{ end }}
+    location {{ .Path }} {
+        set $upstream_endpoint "{{ $.Upstream.URL $protocol }}";
+        {{ template "block_rules" $ }}
+        {{ with routeJWT . }}auth_request {{ . }};{{ end }}
+        {{ template "rewrites" $ }}
+        {{ $p }}_pass $upstream_endpoint;
+        {{ if ne $grpc $.GRPC }}{{ if $grpc }}{{ template "grpc_headers" $ }}{{ else }}{{ template "proxy_headers" $ }}{{ end }}{{ end }}
+
+        {{ if .ReadTimeout }}{{ $p }}_read_timeout {{ .ReadTimeout }}s;{{ end }}
+        {{ if .SendTimeout }}{{ $p }}_send_timeout {{ .SendTimeout }}s;{{ end }}
+        {{ if .ConnectTimeout }}{{ $p }}_connect_timeout {{ .ConnectTimeout }}s;{{ end }}
+        {{ with limitRate . }}limit_rate {{ . }};{{ end }}
+        {{ with .Retries }}
+        {{ if .On }}{{ $p }}_next_upstream {{ join .On " " }};{{ end }}
+        {{ if .Tries }}{{ $p }}_next_upstream_tries {{ .Tries }};{{ end }}
+        {{ if .Timeout }}{{ $p }}_next_upstream_timeout {{ .Timeout }}s;{{ end }}
+        {{ end }}
+    }
+    {{ end }}
+{{ end }}
+
+{{/* Mirrored requests are subrequests: the response is dropped, but the
+     client connection's next request waits for them, hence the short
+     timeouts. */}}
+{{/* Routes are nested in the root location and inherit its cache. */}}
+{{ define "proxy_cache" }}
+    {{ with .ProxyCache }}
+        proxy_cache {{ .Zone }};
+        proxy_cache_key "{{ .Key }}";
+        {{ range .Valid }}proxy_cache_valid {{ . }};
+        {{ end }}
+        {{ if .Bypass }}proxy_cache_bypass {{ .Bypass }};
+        proxy_no_cache {{ .Bypass }};{{ end }}
+        add_header X-Cache-Status $upstream_cache_status always;
+    {{ end }}
+{{ end }}
+
+{{ define "mirror_location" }}
+    {{ with .Shadow }}
+    location = /_hubfly_mirror {
+        internal;
+        {{ if .Sample }}if ($mirror_sample_{{ ident $.ID }} = "") { return 204; }{{ end }}
+        set $mirror_endpoint "{{ .URL }}";
+        proxy_pass $mirror_endpoint$request_uri;
+        proxy_set_header Host $host;
+        proxy_set_header X-Mirrored-By hubfly;
+        proxy_connect_timeout 2s;
+        proxy_read_timeout 10s;
+        access_log off;
+    }
+    {{ end }}
+{{ end }}
+
+{{ define "jwt_gate" }}
+    {{ with .JWT }}{{ if .Site }}auth_request /_hubfly_jwt;{{ end }}{{ end }}
+{{ end }}
+
+{{/* auth_request subrequests keep the client's headers, so the validator
+     sees the token. The body is dropped and the method made GET: only
+     the headers matter. */}}
+{{ define "jwt_locations" }}
+    {{ with .JWT }}{{ range .Validators }}
+    location = {{ .Location }} {
+        internal;
+        proxy_pass {{ .URL }};
+        proxy_method GET;
+        proxy_pass_request_body off;
+        proxy_set_header Content-Length "";
+        proxy_set_header X-Original-URI $request_uri;
+        access_log off;
+    }
+    {{ end }}{{ end }}
+{{ end }}
+
+{{ define "ws_location" }}
+    location /ws/ {
+        {{ template "geo_block" . }}
+        {{ template "jwt_gate" . }}
+        set $upstream_endpoint "{{ .Upstream.URL "http" }}";
+        proxy_pass $upstream_endpoint;
+        proxy_http_version 1.1;
+        {{ template "upgrade_headers" . }}
+        {{ template "ws_timeouts" . }}
+        proxy_set_header Host {{ with .UpstreamHost }}{{ . }}{{ else }}$host{{ end }};
+        {{ template "client_cert_headers" . }}
+    }
+{{ end }}
+
+{{ define "capture" }}
+    {{ with .Capture }}access_log /var/log/hubfly/{{ $.ID }}.capture.log hubfly_capture_{{ ident $.ID }}{{ if .Sample }} if=$capture_sample_{{ ident $.ID }}{{ end }};{{ end }}
+{{ end }}
+
+{{ define "traversal_guard" }}
+    {{ if .Firewall }}{{ if .Firewall.BlockTraversal }}
+    access_log /var/log/hubfly/{{ .ID }}.security.log hubfly if=$traversal_{{ ident .ID }};
+    if ($traversal_{{ ident .ID }}) { return 400; }
+    {{ end }}{{ end }}
+{{ end }}
+
+{{ define "redirects" }}
+    {{ range .Redirects }}
+    {{ redirect . }}
+    {{ end }}
+{{ end }}
+
+{{ define "protected_files" }}
+    {{ range .ProtectedFiles }}
+    # X-Accel-Redirect target; not reachable by clients
+    location {{ .Path }} {
+        internal;
+        alias {{ .Directory }};
+    }
+    {{ end }}
+{{ end }}
+
+{{/* Locations with an add_header of their own (from a template, say) drop
+     the server's, so the root location repeats these. HSTS and Alt-Svc
+     are only sent over HTTPS; an empty $hsts_ value adds no header. */}}
+{{ define "security_headers" }}
+    {{ if and .SSL .HTTP3 }}add_header Alt-Svc $alt_svc_{{ ident .ID }} always;{{ end }}
+    {{ with .SecHeaders }}
+    {{ if .HSTS }}add_header Strict-Transport-Security $hsts_{{ ident $.ID }} always;{{ end }}
+    {{ if .ContentTypeOptions }}add_header X-Content-Type-Options "nosniff" always;{{ end }}
+    {{ if .FrameOptions }}add_header X-Frame-Options "{{ .FrameOptions }}" always;{{ end }}
+    {{ if .ReferrerPolicy }}add_header Referrer-Policy "{{ .ReferrerPolicy }}" always;{{ end }}
+    {{ if .CSP }}add_header Content-Security-Policy {{ quote .CSP }} always;{{ end }}
+    {{ end }}
+{{ end }}
+
+{{/* Rule order matters to ModSecurity: the paranoia level and runtime
+     exclusions must come before the CRS, SecRuleRemoveById after it. */}}
+{{ define "waf" }}
+    {{ with .ModSec }}
+    modsecurity on;
+    modsecurity_rules_file {{ .Engine }};
+    modsecurity_rules '{{ range .Before }}
+        {{ . }}{{ end }}
+    ';
+    modsecurity_rules_file {{ .CRS }};
+    {{ if .After }}
+    modsecurity_rules '{{ range .After }}
+        {{ . }}{{ end }}
+    ';
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "hygiene" }}
+    {{ with .ConnHygiene }}
+    {{ if .ClientHeaderTimeout }}client_header_timeout {{ .ClientHeaderTimeout }}s;{{ end }}
+    {{ if .ClientBodyTimeout }}client_body_timeout {{ .ClientBodyTimeout }}s;{{ end }}
+    {{ if .SendTimeout }}send_timeout {{ .SendTimeout }}s;{{ end }}
+    {{ if .KeepaliveRequests }}keepalive_requests {{ .KeepaliveRequests }};{{ end }}
+    {{ if .HeaderBuffers }}large_client_header_buffers {{ .HeaderBuffers }} {{ .HeaderBufferSize }};{{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "body" }}
+    {{ with .Body }}
+    {{ if .MaxSize }}client_max_body_size {{ .MaxSize }};{{ end }}
+    {{ if .RequestBuffering }}proxy_request_buffering {{ .RequestBuffering }};{{ end }}
+    {{ if .Buffering }}proxy_buffering {{ .Buffering }};{{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "capacity" }}
+    {{ if .Capacity }}
+    {{ if .Capacity.MaxConcurrent }}
+    limit_conn conn_{{ ident .ID }} {{ .Capacity.MaxConcurrent }};
+    limit_conn_status {{ .Capacity.Status }};
+    {{ end }}
+    {{ if .Capacity.Rate }}
+    {{ template "capacity_queue" . }}
+    limit_req_status {{ .Capacity.Status }};
+    {{ end }}
+    {{ if or .Capacity.ShedBody .Capacity.RetryAfter }}
+    error_page {{ .Capacity.Status }} @capacity_shed;
+    location @capacity_shed {
+        {{ if .Capacity.RetryAfter }}
+        add_header Retry-After {{ .Capacity.RetryAfter }} always;
+        {{ end }}
+        {{ if .Capacity.ShedBody }}
+        default_type {{ if .Capacity.ShedContentType }}{{ .Capacity.ShedContentType }}{{ else }}text/plain{{ end }};
+        return {{ .Capacity.Status }} {{ quote .Capacity.ShedBody }};
+        {{ else }}
+        return {{ .Capacity.Status }};
+        {{ end }}
+    }
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{ define "capacity_queue" }}
+    {{ if .Capacity }}{{ if .Capacity.Rate }}
+    limit_req zone=queue_{{ ident .ID }}{{ if .Capacity.Queue }} burst={{ .Capacity.Queue }}{{ end }};
+    {{ end }}{{ end }}
+{{ end }}
+
+{{/* Exact locations, so they win over the root location, routes and
+     static asset rules. */}}
+{{ define "asset_shield" }}
+    {{ with .Shield }}
+    {{ range .Files }}
+    location = {{ .Path }} {
+        access_log off;
+        log_not_found off;
+        expires {{ $.Shield.MaxAge }}s;
+        {{ if .File }}alias {{ quote .File }};{{ else }}{{ .Default }}{{ end }}
+    }
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{/* error_page is only inherited by locations without their own, so
+     the pages are defined once per server block. */}}
+{{ define "error_pages" }}
+    {{ with .ErrorPages }}
+    {{ if .Intercept }}proxy_intercept_errors on;{{ end }}
+    {{ range .Pages }}
+    error_page {{ .Codes }} {{ .URI }};
+    {{ end }}
+    {{ range .Bundled }}
+    location = {{ . }} {
+        root /var/www/hubfly/static;
+        internal;
+    }
+    {{ end }}
+    {{ range .JSON }}
+    location @hubfly_error_{{ .Status }} {
+        default_type application/json;
+        return {{ .Status }} {{ quote .Body }};
+    }
+    {{ end }}
+    {{ end }}
+{{ end }}
+
+{{ if .Firewall }}
+{{ if .Firewall.RateLimit }}
+{{ if .Firewall.RateLimit.Enabled }}
+limit_req_zone $binary_remote_addr zone=zone_{{ .ID }}:10m rate={{ .Firewall.RateLimit.Rate }}{{ .Firewall.RateLimit.Unit }};
+{{ end }}
+{{ end }}
+{{ end }}
+
+{{ if .Capacity }}
+{{ if .Capacity.MaxConcurrent }}
+limit_conn_zone $server_name zone=conn_{{ ident .ID }}:1m;
+{{ end }}
+{{ if .Capacity.Rate }}
+limit_req_zone $server_name zone=queue_{{ ident .ID }}:1m rate={{ .Capacity.Rate }}r/s;
+{{ end }}
+{{ end }}
+
+{{ if .Firewall }}{{ if .Firewall.BlockTraversal }}
+map $request_uri $traversal_{{ ident .ID }} {
+    default 0;
+    "~*({{ traversal }})" 1;
+}
+{{ end }}{{ end }}
+
+{{ with .Geo }}
+geoip2 {{ quote .DB }} {
+    $geoip2_country_{{ ident $.ID }} country iso_code;
+}
+map $geoip2_country_{{ ident $.ID }} $geo_blocked_{{ ident $.ID }} {
+    default {{ .Default }};
+    "" {{ .Unknown }};
+    {{ range .Allow }}{{ . }} 0;
+    {{ end }}{{ range .Deny }}{{ . }} 1;
+    {{ end }}
+}
+{{ end }}
+
+{{ if and .SSL .HTTP3 }}
+map $https $alt_svc_{{ ident .ID }} {
+    on 'h3=":443"; ma=86400';
+    default "";
+}
+{{ end }}
+
+{{ if .SecHeaders }}{{ if .SecHeaders.HSTS }}
+map $https $hsts_{{ ident .ID }} {
+    on "{{ .SecHeaders.HSTS }}";
+    default "";
+}
+{{ end }}{{ end }}
+
+{{ with .Shadow }}{{ if .Sample }}
+split_clients "${request_id}" $mirror_sample_{{ ident $.ID }} {
+    {{ .Sample }}% 1;
+    * "";
+}
+{{ end }}{{ end }}
+
+{{/* Kept upstream connections need requests without "Connection: close". */}}
+map $http_upgrade {{ .WS.Connection }} {
+    default upgrade;
+    '' {{ if .Upstream.Keepalive }}""{{ else }}close{{ end }};
+}
+
+{{ with .Upstream.Split }}
+split_clients "${remote_addr}${http_user_agent}" {{ .Var }} {
+    {{ .Percent }}% "{{ .Canary }}";
+    * "{{ .Stable }}";
+}
+{{ end }}
+
+{{ with .ProxyCache }}
+proxy_cache_path {{ .Path }} levels=1:2 keys_zone={{ .Zone }}:{{ .Size }} inactive=60m use_temp_path=off;
+{{ end }}
+
+{{ if .Upstream.Name }}
+upstream {{ .Upstream.Name }} {
+    {{ range .Upstream.Servers }}server {{ .Address }}{{ if gt .Weight 1 }} weight={{ .Weight }}{{ end }}{{ if .Down }} down{{ end }};
+    {{ end }}
+    {{ with .Upstream.Keepalive }}
+    keepalive {{ .Connections }};
+    {{ if .Timeout }}keepalive_timeout {{ .Timeout }}s;{{ end }}
+    {{ if .Requests }}keepalive_requests {{ .Requests }};{{ end }}
+    {{ end }}
+}
+{{ end }}
+
+{{ .AuditHTTP }}
+{{ .LogFormatDecl }}
+{{ with .Capture }}
+{{ .Format }}
+{{ if .Sample }}
+split_clients "${request_id}" $capture_sample_{{ ident $.ID }} {
+    {{ .Sample }}% 1;
+    * "";
+}
+{{ end }}{{ end }}
+
+server {
+    listen 80;
+    {{ if .HTTP2 }}http2 on;{{ end }}
+    server_name {{ quoteNames .ServerNames }};
+
+    access_log /var/log/hubfly/{{ .ID }}.access.log {{ .AccessLogFormat }};
+    error_log /var/log/hubfly/{{ .ID }}.error.log notice;
+    {{ .AuditServer }}
+    {{ template "capture" . }}
+    {{ template "traversal_guard" . }}
+    {{ template "capacity" . }}
+    {{ template "hygiene" . }}
+    {{ template "body" . }}
+    {{ template "upstream_tls" . }}
+    {{ template "security_headers" . }}
+    {{ template "waf" . }}
+
+    {{ template "firewall_locations" . }}
+
+    {{ if .ForceSSL }}
+    location / {
+        return 301 https://$host$request_uri;
+    }
+    {{ template "ws_location" . }}
+    {{ else }}
+    {{ template "redirects" . }}
+
+    {{ template "root_location" . }}
+    {{ template "mirror_location" . }}
+    {{ template "asset_shield" . }}
+    {{ end }}
+    {{ template "jwt_locations" . }}
+
+    {{ template "protected_files" . }}
+
+    # Challenge path for Certbot
+    location /.well-known/acme-challenge/ {
+        root /var/www/hubfly;
+        try_files $uri =404;
+    }
+
+    {{ template "error_pages" . }}
+}
+
+{{ if .SSL }}
+server {
+    listen 443 ssl;
+    {{ if .HTTP3 }}listen 443 quic{{ if .Reuseport }} reuseport{{ end }};{{ end }}
+    http2 on;
+    server_name {{ quoteNames .ServerNames }};
+
+    ssl_certificate /etc/letsencrypt/live/{{ .CertName }}/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/{{ .CertName }}/privkey.pem;
+    {{ template "tls_session" . }}
+
+    # The global log keeps feeding GoAccess
+    access_log /var/log/hubfly/access.log hubfly;
+    access_log /var/log/hubfly/{{ .ID }}.access.log {{ .AccessLogFormat }};
+    error_log /var/log/hubfly/{{ .ID }}.error.log notice;
+    {{ .AuditServer }}
+    {{ template "capture" . }}
+    {{ template "traversal_guard" . }}
+    {{ template "capacity" . }}
+    {{ template "hygiene" . }}
+    {{ template "body" . }}
+    {{ template "upstream_tls" . }}
+    {{ template "security_headers" . }}
+    {{ template "waf" . }}
+
+    {{ template "firewall_locations" . }}
+
+    {{ template "redirects" . }}
+
+    {{ template "root_location" . }}
+    {{ template "mirror_location" . }}
+    {{ template "asset_shield" . }}
+    {{ template "jwt_locations" . }}
+
+    {{ template "ws_location" . }}
+
+    {{ template "protected_files" . }}
+
+    {{ template "error_pages" . }}
+}
+{{ end }}
+`
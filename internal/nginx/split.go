@@ -0,0 +1,57 @@
+package nginx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// trafficSplit is the split_clients block that picks a site's backend
+// when a canary release is set.
+type trafficSplit struct {
+	Var     string // Variable the upstream target is read from, e.g. $canary_app_local
+	Percent string // Share sent to Canary, without the "%"
+	Canary  string
+	Stable  string
+}
+
+// CheckCanaryRelease validates a canary release.
+func CheckCanaryRelease(c *models.Canary) error {
+	if c == nil {
+		return nil
+	}
+	if !validUpstreamAddress(c.Upstream) {
+		return fmt.Errorf("canary_release: upstream must be a host:port, got %q", c.Upstream)
+	}
+	if c.Percent < 0 || c.Percent > 100 {
+		return fmt.Errorf("canary_release: percent must be between 0 and 100")
+	}
+	if p := c.Percent * 100; math.Abs(p-math.Round(p)) > 1e-6 {
+		return fmt.Errorf("canary_release: percent may have at most two decimals")
+	}
+	return nil
+}
+
+// splitTraffic points u at a split_clients variable choosing between the
+// canary and the site's own upstreams. A zero percent changes nothing and
+// 100% sends everything to the canary. The split picks a target, so HTTP
+// and gRPC locations can share it.
+func splitTraffic(site *models.Site, u *upstreamBlock) {
+	c := site.CanaryRelease
+	if c == nil || c.Percent <= 0 {
+		return
+	}
+	if c.Percent >= 100 {
+		u.Target = c.Upstream
+		return
+	}
+	u.Split = &trafficSplit{
+		Var:     "$canary_" + ident(site.ID),
+		Percent: strconv.FormatFloat(c.Percent, 'f', -1, 64),
+		Canary:  c.Upstream,
+		Stable:  u.Target,
+	}
+	u.Target = u.Split.Var
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestCanaryRelease(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "app.local", Domain: "app.local", Upstreams: []string{"app-v1:80"},
+		CanaryRelease: &models.Canary{Upstream: "app-v2:80", Percent: 12.5},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"split_clients \"${remote_addr}${http_user_agent}\" $canary_app_local_1a79d0dc {\n    12.5% \"app-v2:80\";\n    * \"app-v1:80\";\n}",
+		`set $upstream_endpoint "http://$canary_app_local_1a79d0dc";`,
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// Several upstreams keep their upstream block as the stable side.
+	site.Upstreams = []string{"app-v1a:80", "app-v1b:80"}
+	config, _ = mgr.Render(site)
+	if !strings.Contains(string(config), `* "hubfly_app_local_1a79d0dc";`) {
+		t.Errorf("Expected the upstream block as the stable side:\n%s", config)
+	}
+
+	// 100% skips the split, 0% leaves the site alone.
+	site.CanaryRelease.Percent = 100
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "split_clients") || !strings.Contains(string(config), `set $upstream_endpoint "http://app-v2:80";`) {
+		t.Errorf("Expected all traffic on the canary:\n%s", config)
+	}
+	site.CanaryRelease.Percent = 0
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "app-v2") {
+		t.Errorf("Expected no canary at 0%%:\n%s", config)
+	}
+
+	for _, c := range []*models.Canary{
+		{Upstream: "", Percent: 5},
+		{Upstream: "http://app:80", Percent: 5},
+		{Upstream: "app:80", Percent: 101},
+		{Upstream: "app:80", Percent: 0.125},
+	} {
+		if CheckCanaryRelease(c) == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+	}
+	if err := CheckCanaryRelease(&models.Canary{Upstream: "app:80", Percent: 0.29}); err != nil {
+		t.Errorf("Valid canary release rejected: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Static asset limits.
+const (
+	maxStaticAssetRules  = 20
+	maxStaticAssetMaxAge = 365 * 86400
+)
+
+var (
+	assetPathPattern      = regexp.MustCompile(`^/[A-Za-z0-9._~@,+=%/-]*$`)
+	assetExtensionPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,10}$`)
+)
+
+// staticAsset is a StaticAssetRule ready to render.
+type staticAsset struct {
+	Location     string // Regex location, e.g. `~ ^/assets/.*\.(?i:css|js)$`
+	MaxAge       int
+	CacheControl string // Added to the max-age nginx's expires sets
+}
+
+// CheckStaticAssets validates a site's browser caching rules.
+func CheckStaticAssets(site *models.Site) error {
+	if len(site.StaticAssets) == 0 {
+		return nil
+	}
+	if isGRPC(site.Protocol) {
+		return fmt.Errorf("static_assets: not supported for gRPC sites")
+	}
+	if len(site.StaticAssets) > maxStaticAssetRules {
+		return fmt.Errorf("static_assets: at most %d rules", maxStaticAssetRules)
+	}
+	for i, r := range site.StaticAssets {
+		if r.Path == "" && len(r.Extensions) == 0 {
+			return fmt.Errorf("static_assets rule %d: needs a path or extensions", i+1)
+		}
+		if r.Path != "" && !assetPathPattern.MatchString(r.Path) {
+			return fmt.Errorf("static_assets rule %d: path must start with / and hold URL characters only, got %q", i+1, r.Path)
+		}
+		for _, ext := range r.Extensions {
+			if !assetExtensionPattern.MatchString(strings.TrimPrefix(ext, ".")) {
+				return fmt.Errorf("static_assets rule %d: invalid extension %q", i+1, ext)
+			}
+		}
+		if r.MaxAge < 1 || r.MaxAge > maxStaticAssetMaxAge {
+			return fmt.Errorf("static_assets rule %d: max_age_seconds must be between 1 and %d (one year)", i+1, maxStaticAssetMaxAge)
+		}
+	}
+	return nil
+}
+
+func resolveStaticAssets(site *models.Site) []staticAsset {
+	if isGRPC(site.Protocol) {
+		return nil
+	}
+	var out []staticAsset
+	for _, r := range site.StaticAssets {
+		// Paths are case-sensitive, extensions aren't.
+		pattern := "^" + regexp.QuoteMeta(r.Path)
+		if r.Path == "" {
+			pattern = ""
+		}
+		if len(r.Extensions) > 0 {
+			if r.Path != "" {
+				pattern += ".*"
+			}
+			pattern += `\.(?i:` + strings.Join(extensionPatterns(r.Extensions), "|") + ")$"
+		}
+		a := staticAsset{Location: "~ " + pattern, MaxAge: r.MaxAge, CacheControl: "public"}
+		if r.Immutable {
+			a.CacheControl += ", immutable"
+		}
+		out = append(out, a)
+	}
+	return out
+}
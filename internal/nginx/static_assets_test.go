@@ -0,0 +1,59 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestStaticAssets(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "shop.local", Domain: "shop.local", Upstreams: []string{"shop:3000"},
+		SecurityHeaders: &models.SecurityHeaders{ContentTypeOptions: true},
+		StaticAssets: []models.StaticAssetRule{
+			{Path: "/_next/static/", MaxAge: 31536000, Immutable: true},
+			{Path: "/img/", Extensions: []string{"png", ".webp"}, MaxAge: 86400},
+			{Extensions: []string{"css", "js", "woff2"}, MaxAge: 3600},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		`location ~ ^/_next/static/ {`,
+		`location ~ ^/img/.*\.(?i:png|webp)$ {`,
+		`location ~ \.(?i:css|js|woff2)$ {`,
+		"expires 31536000s;",
+		`add_header Cache-Control "public, immutable";`,
+		"expires 3600s;",
+		"proxy_hide_header Cache-Control;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	// add_header in a location drops the inherited security headers.
+	if n := strings.Count(cfg, `add_header X-Content-Type-Options "nosniff" always;`); n < 4 {
+		t.Errorf("Expected the security headers repeated in each asset location, got %d", n)
+	}
+
+	for _, r := range []models.StaticAssetRule{
+		{MaxAge: 60},
+		{Path: "assets/", MaxAge: 60},
+		{Path: "/a b/", MaxAge: 60},
+		{Path: "/assets/", MaxAge: 0},
+		{Extensions: []string{"c$s"}, MaxAge: 60},
+		{Extensions: []string{"css"}, MaxAge: 2 * 365 * 86400},
+	} {
+		if CheckStaticAssets(&models.Site{StaticAssets: []models.StaticAssetRule{r}}) == nil {
+			t.Errorf("Expected %+v to be rejected", r)
+		}
+	}
+	if CheckStaticAssets(&models.Site{Protocol: "grpc", StaticAssets: site.StaticAssets}) == nil {
+		t.Error("Expected static_assets to be rejected for gRPC sites")
+	}
+}
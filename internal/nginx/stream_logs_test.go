@@ -0,0 +1,27 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestStreamAccessLog(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	for _, streams := range [][]models.Stream{
+		{{ID: "db", ListenPort: 30010, Upstream: "db:5432", Protocol: "tcp"}},
+		{
+			{ID: "a", ListenPort: 30010, Upstream: "a:443", Protocol: "tcp", Domain: "a.example.com"},
+			{ID: "b", ListenPort: 30010, Upstream: "b:443", Protocol: "tcp", Domain: "b.example.com"},
+		},
+	} {
+		config, err := mgr.RenderStreamConfig(30010, streams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(string(config), "access_log /var/log/hubfly/stream_30010.access.log hubfly_stream;") != 1 {
+			t.Errorf("Expected one access_log for the port:\n%s", config)
+		}
+	}
+}
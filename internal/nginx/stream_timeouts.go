@@ -0,0 +1,94 @@
+package nginx
+
+import (
+	"fmt"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// StreamTimeoutPresets are the named starting points for stream timeouts.
+// "long-lived" keeps idle tunnels (SSH, databases, MQTT, VPNs) open for a
+// day and has the kernel probe the upstream side; "fast-failover" gives up
+// on an unreachable upstream after 2 seconds and on silent connections
+// after 30.
+var StreamTimeoutPresets = map[string]models.StreamTimeouts{
+	"long-lived":    {Idle: 86400, SocketKeepalive: true},
+	"fast-failover": {Idle: 30, Connect: 2},
+}
+
+// maxStreamIdle bounds proxy_timeout (one week).
+const maxStreamIdle = 7 * 86400
+
+// CheckStreamTimeouts validates a stream's timeouts.
+func CheckStreamTimeouts(stream *models.Stream) error {
+	t := stream.Timeouts
+	if t == nil {
+		return nil
+	}
+	if _, ok := StreamTimeoutPresets[t.Preset]; !ok && t.Preset != "" {
+		return fmt.Errorf("timeouts: unknown preset %q (use long-lived or fast-failover)", t.Preset)
+	}
+	if t.Idle < 0 || t.Idle > maxStreamIdle {
+		return fmt.Errorf("timeouts: idle_seconds must be between 0 and %d", maxStreamIdle)
+	}
+	if t.Connect < 0 || t.Connect > 75 {
+		return fmt.Errorf("timeouts: connect_timeout_seconds must be between 0 and 75")
+	}
+	if t.SocketKeepalive && stream.Protocol == "udp" {
+		return fmt.Errorf("timeouts: socket_keepalive needs a tcp stream")
+	}
+	return nil
+}
+
+// SameStreamTimeouts reports whether two streams render the same timeouts,
+// as streams sharing a port must.
+func SameStreamTimeouts(a, b *models.Stream) bool {
+	ta, tb := resolveStreamTimeouts(a), resolveStreamTimeouts(b)
+	return ta == nil && tb == nil || ta != nil && tb != nil && *ta == *tb
+}
+
+// resolveStreamTimeouts returns the timeouts rendered for a stream, with the
+// preset filled in under explicit values. Nil means nginx's defaults.
+func resolveStreamTimeouts(stream *models.Stream) *models.StreamTimeouts {
+	t := stream.Timeouts
+	if t == nil {
+		return nil
+	}
+	out := StreamTimeoutPresets[t.Preset]
+	out.Preset = ""
+	if t.Idle > 0 {
+		out.Idle = t.Idle
+	}
+	if t.Connect > 0 {
+		out.Connect = t.Connect
+	}
+	out.SocketKeepalive = out.SocketKeepalive || t.SocketKeepalive
+	// UDP has no connection to keep alive.
+	if stream.Protocol == "udp" {
+		out.SocketKeepalive = false
+	}
+	if out == (models.StreamTimeouts{}) {
+		return nil
+	}
+	return &out
+}
+
+// streamTimeoutDirectives returns the timeout directives of a stream
+// server block.
+func streamTimeoutDirectives(stream *models.Stream) []string {
+	t := resolveStreamTimeouts(stream)
+	if t == nil {
+		return nil
+	}
+	var out []string
+	if t.Idle > 0 {
+		out = append(out, fmt.Sprintf("proxy_timeout %ds", t.Idle))
+	}
+	if t.Connect > 0 {
+		out = append(out, fmt.Sprintf("proxy_connect_timeout %ds", t.Connect))
+	}
+	if t.SocketKeepalive {
+		out = append(out, "proxy_socket_keepalive on")
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestStreamTimeouts(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	ssh := models.Stream{ID: "ssh", ListenPort: 30022, Upstream: "bastion:22", Protocol: "tcp",
+		Timeouts: &models.StreamTimeouts{Preset: "long-lived", Connect: 5}}
+	config, err := mgr.RenderStreamConfig(ssh.ListenPort, []models.Stream{ssh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{"proxy_timeout 86400s;", "proxy_connect_timeout 5s;", "proxy_socket_keepalive on;"} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// SNI streams share one server block.
+	a := models.Stream{ID: "a", ListenPort: 30443, Upstream: "a:443", Protocol: "tcp", Domain: "a.example.com",
+		Timeouts: &models.StreamTimeouts{Preset: "fast-failover"}}
+	b := a
+	b.ID, b.Domain, b.Upstream = "b", "b.example.com", "b:443"
+	config, err = mgr.RenderStreamConfig(a.ListenPort, []models.Stream{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := string(config); strings.Count(cfg, "proxy_connect_timeout 2s;") != 1 || !strings.Contains(cfg, "proxy_timeout 30s;") {
+		t.Errorf("Expected the fast-failover timeouts once:\n%s", cfg)
+	}
+	if !SameStreamTimeouts(&a, &b) {
+		t.Error("Expected streams with the same preset to agree")
+	}
+	b.Timeouts = &models.StreamTimeouts{Idle: 30, Connect: 2}
+	if !SameStreamTimeouts(&a, &b) {
+		t.Error("Expected a preset and the same explicit values to agree")
+	}
+	b.Timeouts = nil
+	if SameStreamTimeouts(&a, &b) {
+		t.Error("Expected nginx's defaults to differ from fast-failover")
+	}
+
+	// UDP drops the preset's keepalive but rejects an explicit one.
+	dns := models.Stream{ID: "dns", ListenPort: 30053, Upstream: "dns:53", Protocol: "udp",
+		Timeouts: &models.StreamTimeouts{Preset: "long-lived"}}
+	config, _ = mgr.RenderStreamConfig(dns.ListenPort, []models.Stream{dns})
+	if strings.Contains(string(config), "proxy_socket_keepalive") {
+		t.Errorf("Expected no socket keepalive for UDP:\n%s", config)
+	}
+	for _, tt := range []models.StreamTimeouts{
+		{Preset: "forever"},
+		{Idle: -1},
+		{Idle: 8 * 86400},
+		{Connect: 90},
+		{SocketKeepalive: true},
+	} {
+		if CheckStreamTimeouts(&models.Stream{Protocol: "udp", Timeouts: &tt}) == nil {
+			t.Errorf("Expected %+v to be rejected", tt)
+		}
+	}
+}
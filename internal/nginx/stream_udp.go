@@ -0,0 +1,33 @@
+package nginx
+
+import (
+	"fmt"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+const maxStreamResponses = 100
+
+// CheckStreamUDP validates the UDP session settings of a stream.
+func CheckStreamUDP(stream *models.Stream) error {
+	u := stream.UDP
+	if u == nil {
+		return nil
+	}
+	if stream.Protocol != "udp" {
+		return fmt.Errorf("udp: needs a udp stream")
+	}
+	if u.Responses != nil && (*u.Responses < 0 || *u.Responses > maxStreamResponses) {
+		return fmt.Errorf("udp: proxy_responses must be between 0 and %d", maxStreamResponses)
+	}
+	return nil
+}
+
+// streamUDPDirectives returns the UDP session directives of a stream
+// server block.
+func streamUDPDirectives(stream *models.Stream) []string {
+	if stream.UDP == nil || stream.Protocol != "udp" || stream.UDP.Responses == nil {
+		return nil
+	}
+	return []string{fmt.Sprintf("proxy_responses %d", *stream.UDP.Responses)}
+}
@@ -0,0 +1,68 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestStreamUDP(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	one := 1
+	dns := models.Stream{ID: "dns", ListenPort: 30053, Protocol: "udp",
+		Upstreams: []string{"dns-1:53", "dns-2:53"},
+		Timeouts:  &models.StreamTimeouts{Idle: 5},
+		UDP:       &models.StreamUDP{Responses: &one},
+	}
+	if err := CheckStreamUpstreams(&dns); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckStreamUDP(&dns); err != nil {
+		t.Fatal(err)
+	}
+	config, err := mgr.RenderStreamConfig(dns.ListenPort, []models.Stream{dns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"upstream hubfly_stream_dns {\n    hash $remote_addr consistent;\n",
+		"listen 30053 udp;",
+		"proxy_timeout 5s;",
+		"proxy_responses 1;",
+		"proxy_pass hubfly_stream_dns;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// An explicit method replaces the UDP default.
+	dns.LoadBalancing = &models.StreamBalancing{Method: StreamRoundRobin}
+	dns.UDP = nil
+	config, err = mgr.RenderStreamConfig(dns.ListenPort, []models.Stream{dns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := string(config); strings.Contains(cfg, "hash") || strings.Contains(cfg, "proxy_responses") {
+		t.Errorf("Expected round robin without proxy_responses:\n%s", cfg)
+	}
+
+	// Backups don't work with the hash default.
+	game := models.Stream{ID: "game", Protocol: "udp", Upstreams: []string{"g-1:27015", "g-2:27015"},
+		LoadBalancing: &models.StreamBalancing{Servers: map[string]models.StreamServer{"g-2:27015": {Backup: true}}}}
+	if err := CheckStreamUpstreams(&game); err == nil {
+		t.Error("Expected a backup with the UDP hash default to be rejected")
+	}
+
+	many := 1000
+	for _, s := range []models.Stream{
+		{Protocol: "tcp", UDP: &models.StreamUDP{Responses: &one}},
+		{Protocol: "udp", UDP: &models.StreamUDP{Responses: &many}},
+	} {
+		if err := CheckStreamUDP(&s); err == nil {
+			t.Errorf("Expected %+v to be rejected", s.UDP)
+		}
+	}
+}
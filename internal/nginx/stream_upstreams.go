@@ -0,0 +1,201 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Stream balancing methods.
+const (
+	StreamRoundRobin = "round_robin"
+	StreamLeastConn  = "least_conn"
+	StreamHash       = "hash"
+	StreamRandom     = "random"
+)
+
+// hashKeyPattern allows nginx variables and literal text, e.g.
+// "$remote_addr" or "$ssl_preread_server_name$remote_addr".
+var hashKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_$.:-]{1,128}$`)
+
+// Stream balancing limits.
+const (
+	maxStreamFailTimeout = 3600
+	maxStreamWeight      = 100
+)
+
+// StreamUpstreams returns the addresses a stream proxies to: Upstreams, or
+// else its single Upstream.
+func StreamUpstreams(stream *models.Stream) []string {
+	if len(stream.Upstreams) > 0 {
+		return stream.Upstreams
+	}
+	if stream.Upstream != "" {
+		return []string{stream.Upstream}
+	}
+	return nil
+}
+
+// CheckStreamUpstreams validates a stream's upstreams and load balancing.
+func CheckStreamUpstreams(stream *models.Stream) error {
+	if stream.Upstream != "" && len(stream.Upstreams) > 0 {
+		return fmt.Errorf("use upstream or upstreams, not both")
+	}
+	upstreams := StreamUpstreams(stream)
+	if len(upstreams) == 0 {
+		return fmt.Errorf("upstream is required")
+	}
+	for i, u := range upstreams {
+		if !validUpstreamAddress(u) {
+			return fmt.Errorf("invalid upstream %q: must be a host:port", u)
+		}
+		if slices.Contains(upstreams[:i], u) {
+			return fmt.Errorf("upstream %s is listed twice", u)
+		}
+	}
+
+	lb := stream.LoadBalancing
+	if lb == nil {
+		return nil
+	}
+	method := streamBalancing(stream).Method
+	switch lb.Method {
+	case "", StreamRoundRobin, StreamLeastConn, StreamRandom:
+		if lb.HashKey != "" || lb.Consistent {
+			return fmt.Errorf("load_balancing: hash_key and consistent need method hash")
+		}
+	case StreamHash:
+		if lb.HashKey != "" && (!hashKeyPattern.MatchString(lb.HashKey) || !strings.Contains(lb.HashKey, "$")) {
+			return fmt.Errorf("load_balancing: invalid hash_key %q (use nginx variables, e.g. $remote_addr)", lb.HashKey)
+		}
+	default:
+		return fmt.Errorf("load_balancing: unknown method %q (use round_robin, least_conn, hash or random)", lb.Method)
+	}
+	if err := checkFailSettings("load_balancing", lb.MaxFails, lb.FailTimeout); err != nil {
+		return err
+	}
+	backups := 0
+	for addr, srv := range lb.Servers {
+		if !slices.Contains(upstreams, addr) {
+			return fmt.Errorf("load_balancing: servers: %s is not an upstream of the stream", addr)
+		}
+		if srv.Weight < 0 || srv.Weight > maxStreamWeight {
+			return fmt.Errorf("load_balancing: servers: %s: weight must be between 0 and %d", addr, maxStreamWeight)
+		}
+		if err := checkFailSettings("load_balancing: servers: "+addr, srv.MaxFails, srv.FailTimeout); err != nil {
+			return err
+		}
+		if srv.Backup {
+			if method == StreamHash || method == StreamRandom {
+				return fmt.Errorf("load_balancing: servers: %s: backup doesn't work with method %s", addr, method)
+			}
+			backups++
+		}
+	}
+	if backups == len(upstreams) {
+		return fmt.Errorf("load_balancing: at least one upstream must not be a backup")
+	}
+	return nil
+}
+
+func checkFailSettings(field string, maxFails, failTimeout int) error {
+	if maxFails < 0 || maxFails > 100 {
+		return fmt.Errorf("%s: max_fails must be between 0 and 100", field)
+	}
+	if failTimeout < 0 || failTimeout > maxStreamFailTimeout {
+		return fmt.Errorf("%s: fail_timeout_seconds must be between 0 and %d", field, maxStreamFailTimeout)
+	}
+	return nil
+}
+
+// streamBalancing returns the load balancing rendered for a stream. UDP
+// streams without a method hash the client address consistently: nginx
+// picks an upstream per UDP session, so round robin would move a client
+// between game or DNS servers every time its session idles out.
+func streamBalancing(stream *models.Stream) models.StreamBalancing {
+	var lb models.StreamBalancing
+	if stream.LoadBalancing != nil {
+		lb = *stream.LoadBalancing
+	}
+	if stream.Protocol == "udp" && lb.Method == "" {
+		lb.Method, lb.HashKey, lb.Consistent = StreamHash, "$remote_addr", true
+	}
+	return lb
+}
+
+// streamUpstreamName is the upstream block of a stream balanced over
+// several upstreams, or "" when it proxies to its address directly.
+func streamUpstreamName(stream *models.Stream) string {
+	if len(StreamUpstreams(stream)) < 2 && stream.LoadBalancing == nil {
+		return ""
+	}
+	return "hubfly_stream_" + ident(stream.ID)
+}
+
+// streamTarget is what proxy_pass (or the SNI map) points a stream at.
+func streamTarget(stream *models.Stream) string {
+	if name := streamUpstreamName(stream); name != "" {
+		return name
+	}
+	if upstreams := StreamUpstreams(stream); len(upstreams) > 0 {
+		return upstreams[0]
+	}
+	return ""
+}
+
+// renderStreamUpstreams writes the upstream blocks of the streams on a port.
+func renderStreamUpstreams(buf *bytes.Buffer, streams []models.Stream) {
+	for i := range streams {
+		s := &streams[i]
+		name := streamUpstreamName(s)
+		if name == "" {
+			continue
+		}
+		lb := streamBalancing(s)
+		fmt.Fprintf(buf, "upstream %s {\n", name)
+		switch lb.Method {
+		case StreamLeastConn:
+			buf.WriteString("    least_conn;\n")
+		case StreamRandom:
+			buf.WriteString("    random;\n")
+		case StreamHash:
+			key := lb.HashKey
+			if key == "" {
+				key = "$remote_addr"
+			}
+			if lb.Consistent {
+				key += " consistent"
+			}
+			fmt.Fprintf(buf, "    hash %s;\n", key)
+		}
+		for _, addr := range StreamUpstreams(s) {
+			srv := lb.Servers[addr]
+			maxFails, failTimeout := lb.MaxFails, lb.FailTimeout
+			if srv.MaxFails > 0 {
+				maxFails = srv.MaxFails
+			}
+			if srv.FailTimeout > 0 {
+				failTimeout = srv.FailTimeout
+			}
+			params := []string{addr}
+			if srv.Weight > 1 {
+				params = append(params, fmt.Sprintf("weight=%d", srv.Weight))
+			}
+			if maxFails > 0 {
+				params = append(params, fmt.Sprintf("max_fails=%d", maxFails))
+			}
+			if failTimeout > 0 {
+				params = append(params, fmt.Sprintf("fail_timeout=%ds", failTimeout))
+			}
+			if srv.Backup {
+				params = append(params, "backup")
+			}
+			fmt.Fprintf(buf, "    server %s;\n", strings.Join(params, " "))
+		}
+		buf.WriteString("}\n\n")
+	}
+}
@@ -0,0 +1,77 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestStreamUpstreams(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	pg := models.Stream{ID: "pg-cluster", ListenPort: 30432, Protocol: "tcp",
+		Upstreams: []string{"pg-1:5432", "pg-2:5432", "pg-3:5432"},
+		LoadBalancing: &models.StreamBalancing{Method: StreamLeastConn, MaxFails: 3, FailTimeout: 30,
+			Servers: map[string]models.StreamServer{"pg-2:5432": {Weight: 2}, "pg-3:5432": {Backup: true, FailTimeout: 5}}},
+	}
+	if err := CheckStreamUpstreams(&pg); err != nil {
+		t.Fatal(err)
+	}
+	config, err := mgr.RenderStreamConfig(pg.ListenPort, []models.Stream{pg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"upstream hubfly_stream_pg_cluster_812cebc8 {\n    least_conn;\n",
+		"server pg-1:5432 max_fails=3 fail_timeout=30s;",
+		"server pg-2:5432 weight=2 max_fails=3 fail_timeout=30s;",
+		"server pg-3:5432 max_fails=3 fail_timeout=5s backup;",
+		"proxy_pass hubfly_stream_pg_cluster_812cebc8;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// SNI streams on one port map names to their own upstream blocks.
+	mqtt := models.Stream{ID: "mqtt", ListenPort: 30883, Protocol: "tcp", Domain: "mqtt.example.com",
+		Upstreams:     []string{"emqx-1:8883", "emqx-2:8883"},
+		LoadBalancing: &models.StreamBalancing{Method: StreamHash, Consistent: true}}
+	single := models.Stream{ID: "broker", ListenPort: 30883, Protocol: "tcp", Domain: "broker.example.com", Upstream: "broker:8883"}
+	config, err = mgr.RenderStreamConfig(mqtt.ListenPort, []models.Stream{mqtt, single})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = string(config)
+	for _, want := range []string{
+		"hash $remote_addr consistent;",
+		"mqtt.example.com hubfly_stream_mqtt;",
+		"broker.example.com broker:8883;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if strings.Count(cfg, "upstream ") != 1 {
+		t.Errorf("Expected one upstream block:\n%s", cfg)
+	}
+
+	for _, s := range []models.Stream{
+		{},
+		{Upstream: "a:1", Upstreams: []string{"b:1"}},
+		{Upstreams: []string{"a:1", "a:1"}},
+		{Upstreams: []string{"a:1; return"}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{Method: "ip_hash"}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{HashKey: "$remote_addr"}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{Method: StreamHash, HashKey: "remote_addr"}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{MaxFails: -1}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{Servers: map[string]models.StreamServer{"b:1": {Weight: 2}}}},
+		{Upstream: "a:1", LoadBalancing: &models.StreamBalancing{Servers: map[string]models.StreamServer{"a:1": {Backup: true}}}},
+		{Upstreams: []string{"a:1", "b:1"}, LoadBalancing: &models.StreamBalancing{Method: StreamRandom, Servers: map[string]models.StreamServer{"a:1": {Backup: true}}}},
+	} {
+		if CheckStreamUpstreams(&s) == nil {
+			t.Errorf("Expected %+v to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStatusURL is the loopback-only stub_status location served by the
+// bundled nginx.conf.
+const DefaultStatusURL = "http://127.0.0.1:8081/nginx_status"
+
+// StubStatus is nginx's stub_status output. The counters cover the whole
+// server; stub_status does not break them down by site.
+type StubStatus struct {
+	ActiveConnections int64 `json:"active_connections"`
+	Accepts           int64 `json:"accepts"`
+	Handled           int64 `json:"handled"`
+	Requests          int64 `json:"requests"`
+	Reading           int64 `json:"reading"`
+	Writing           int64 `json:"writing"`
+	Waiting           int64 `json:"waiting"`
+}
+
+// ParseStubStatus parses a stub_status response:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func ParseStubStatus(body string) (*StubStatus, error) {
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("unexpected stub_status output (%d lines)", len(lines))
+	}
+	var st StubStatus
+	if _, err := fmt.Sscanf(strings.TrimSpace(lines[0]), "Active connections: %d", &st.ActiveConnections); err != nil {
+		return nil, fmt.Errorf("stub_status: active connections: %w", err)
+	}
+	counters := strings.Fields(lines[2])
+	if len(counters) != 3 {
+		return nil, fmt.Errorf("stub_status: expected accepts, handled and requests, got %q", lines[2])
+	}
+	for i, p := range []*int64{&st.Accepts, &st.Handled, &st.Requests} {
+		n, err := strconv.ParseInt(counters[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("stub_status: %w", err)
+		}
+		*p = n
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(lines[3]), "Reading: %d Writing: %d Waiting: %d", &st.Reading, &st.Writing, &st.Waiting); err != nil {
+		return nil, fmt.Errorf("stub_status: connection states: %w", err)
+	}
+	return &st, nil
+}
+
+// StubStatus fetches and parses StatusURL.
+func (m *Manager) StubStatus(ctx context.Context) (*StubStatus, error) {
+	if m.StatusURL == "" {
+		return nil, fmt.Errorf("stub_status is not configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.StatusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stub_status returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, err
+	}
+	return ParseStubStatus(string(body))
+}
@@ -0,0 +1,49 @@
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const stubStatusOutput = "Active connections: 291 \nserver accepts handled requests\n 16630948 16630948 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n"
+
+func TestParseStubStatus(t *testing.T) {
+	st, err := ParseStubStatus(stubStatusOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := StubStatus{ActiveConnections: 291, Accepts: 16630948, Handled: 16630948, Requests: 31070465, Reading: 6, Writing: 179, Waiting: 106}
+	if *st != want {
+		t.Errorf("Got %+v, want %+v", *st, want)
+	}
+
+	if _, err := ParseStubStatus("<html>404</html>"); err == nil {
+		t.Error("Expected an error for a non-stub_status body")
+	}
+}
+
+func TestFetchStubStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, stubStatusOutput)
+	}))
+	defer ts.Close()
+
+	mgr := NewManager(t.TempDir())
+	mgr.StatusURL = ts.URL
+	st, err := mgr.StubStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Requests != 31070465 {
+		t.Errorf("Expected requests 31070465, got %d", st.Requests)
+	}
+
+	mgr.StatusURL = ts.URL + "/missing"
+	ts.Config.Handler = http.NotFoundHandler()
+	if _, err := mgr.StubStatus(context.Background()); err == nil {
+		t.Error("Expected an error for a 404")
+	}
+}
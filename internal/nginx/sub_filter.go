@@ -0,0 +1,38 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quote renders s as a double-quoted nginx string. "$" is left alone so
+// variables still expand.
+func quote(s string) string {
+	return `"` + quoteReplacer.Replace(s) + `"`
+}
+
+// checkResponseRewrite rejects rules nginx would refuse or that can never
+// match.
+func checkResponseRewrite(rw *models.ResponseRewrite) error {
+	if rw == nil {
+		return nil
+	}
+	if len(rw.Rules) == 0 {
+		return fmt.Errorf("response_rewrite needs at least one rule")
+	}
+	for i, r := range rw.Rules {
+		if r.Find == "" {
+			return fmt.Errorf("response_rewrite rule %d: find must not be empty", i+1)
+		}
+	}
+	for _, t := range rw.Types {
+		if t != "*" && !strings.Contains(t, "/") {
+			return fmt.Errorf("response_rewrite: invalid MIME type %q", t)
+		}
+	}
+	return nil
+}
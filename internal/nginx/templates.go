@@ -0,0 +1,166 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxTemplateSize bounds a snippet uploaded through the API.
+const MaxTemplateSize = 64 << 10
+
+// Template is a reusable snippet from TemplatesDir. Sites list template
+// names in "templates"; their content is pasted into the root location.
+type Template struct {
+	Name      string    `json:"name"`
+	Content   string    `json:"content,omitempty"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ValidTemplateName reports whether name is usable as a template file name.
+func ValidTemplateName(name string) bool {
+	return templateNamePattern.MatchString(name)
+}
+
+// Directives that only make sense outside a location block. nginx would
+// reject them on reload, taking every other site's change down with it.
+var templateForbidden = map[string]bool{
+	"http": true, "server": true, "events": true, "stream": true, "upstream": true,
+	"map": true, "geo": true, "split_clients": true, "listen": true, "server_name": true,
+	"limit_req_zone": true, "limit_conn_zone": true, "proxy_cache_path": true,
+	"log_format": true, "load_module": true, "user": true, "worker_processes": true,
+}
+
+// CheckTemplate validates snippet content: it must parse and may only hold
+// directives that are valid inside a location.
+func CheckTemplate(content string) error {
+	if len(content) > MaxTemplateSize {
+		return fmt.Errorf("template is larger than %d bytes", MaxTemplateSize)
+	}
+	dirs, err := Parse([]byte(content))
+	if err != nil {
+		return fmt.Errorf("template does not parse: %w", err)
+	}
+	var bad error
+	Walk(dirs, func(d *Directive, parents []*Directive) {
+		if bad == nil && templateForbidden[d.Name] {
+			bad = fmt.Errorf("line %d: %q is not allowed in a template (templates go inside a location block)", d.Line, d.Name)
+		}
+	})
+	return bad
+}
+
+func (m *Manager) templatePath(name string) string {
+	return filepath.Join(m.TemplatesDir, name+".conf")
+}
+
+// templateContent loads a site template: a file in TemplatesDir, or else
+// a built-in preset. Files come first so existing templates keep working
+// when a preset of the same name is added.
+func (m *Manager) templateContent(name string) ([]byte, error) {
+	if ValidTemplateName(name) {
+		content, err := os.ReadFile(m.templatePath(name))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) || !IsPreset(name) {
+			return nil, fmt.Errorf("failed to load template %s: %w", name, err)
+		}
+	}
+	p, err := LookupPreset(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template %s: %w", name, err)
+	}
+	return []byte(p.Content), nil
+}
+
+// ListTemplates returns every template, sorted by name, without content.
+func (m *Manager) ListTemplates() ([]Template, error) {
+	entries, err := os.ReadDir(m.TemplatesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Template{}, nil
+		}
+		return nil, err
+	}
+	templates := []Template{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".conf")
+		if !ok || e.IsDir() || !ValidTemplateName(name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		templates = append(templates, Template{Name: name, Size: info.Size(), UpdatedAt: info.ModTime()})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// GetTemplate reads one template. A missing template returns an error
+// satisfying os.IsNotExist.
+func (m *Manager) GetTemplate(name string) (*Template, error) {
+	if !ValidTemplateName(name) {
+		return nil, os.ErrNotExist
+	}
+	path := m.templatePath(name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{Name: name, Content: string(content), Size: info.Size(), UpdatedAt: info.ModTime()}, nil
+}
+
+// SaveTemplate validates and writes a template, replacing any existing one.
+// The file is renamed into place so a render never sees half of it.
+func (m *Manager) SaveTemplate(name, content string) error {
+	if !ValidTemplateName(name) {
+		return fmt.Errorf("invalid template name %q: use letters, digits, '-' and '_' (max 64)", name)
+	}
+	if name == "builtin" {
+		return fmt.Errorf("template name %q is reserved", name)
+	}
+	if err := CheckTemplate(content); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.TemplatesDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(m.TemplatesDir, "."+name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.templatePath(name))
+}
+
+// DeleteTemplate removes a template.
+func (m *Manager) DeleteTemplate(name string) error {
+	if !ValidTemplateName(name) {
+		return os.ErrNotExist
+	}
+	return os.Remove(m.templatePath(name))
+}
@@ -0,0 +1,55 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// earlyDataHeader tells the upstream a request arrived as TLS 1.3 early
+// data (RFC 8470), so it can answer 425 Too Early to unsafe requests.
+const earlyDataHeader = "Early-Data"
+
+// tlsSession is a site's TLS settings, ready to render.
+type tlsSession struct {
+	SessionCache   string // ssl_session_cache argument, e.g. "shared:hubfly_ssl_shop:10m"
+	SessionTickets string // "on", "off" or "" for the default
+	EarlyData      bool
+	EarlyHeader    bool // Forward Early-Data; false when ProxySetHeaders sets it
+}
+
+// CheckTLS validates a site's TLS settings.
+func CheckTLS(site *models.Site) error {
+	t := site.TLS
+	if t == nil {
+		return nil
+	}
+	if t.SessionCacheSize != "" && t.SessionCacheSize != "off" && !cacheSize.MatchString(t.SessionCacheSize) {
+		return fmt.Errorf("tls: session_cache_size must be a size like 10m or \"off\", got %q", t.SessionCacheSize)
+	}
+	return nil
+}
+
+// resolveTLS renders a site's TLS settings, which only apply with SSL. Each
+// site gets a session cache zone of its own.
+func resolveTLS(site *models.Site) *tlsSession {
+	t := site.TLS
+	if t == nil || !site.SSL {
+		return nil
+	}
+	ts := &tlsSession{SessionTickets: onOff(t.SessionTickets), EarlyData: t.EarlyData, EarlyHeader: t.EarlyData}
+	switch t.SessionCacheSize {
+	case "":
+	case "off":
+		ts.SessionCache = "off"
+	default:
+		ts.SessionCache = "shared:hubfly_ssl_" + ident(site.ID) + ":" + t.SessionCacheSize
+	}
+	for k := range site.ProxySetHeaders {
+		if strings.EqualFold(k, earlyDataHeader) {
+			ts.EarlyHeader = false
+		}
+	}
+	return ts
+}
@@ -0,0 +1,61 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestTLSSession(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	off := false
+	site := &models.Site{ID: "api.local", Domain: "api.local", Upstreams: []string{"api:80"}, SSL: true,
+		TLS: &models.TLSSettings{SessionCacheSize: "20m", SessionTickets: &off, EarlyData: true}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"ssl_session_cache shared:hubfly_ssl_api_local_91022837:20m;",
+		"ssl_session_tickets off;",
+		"ssl_early_data on;",
+		"proxy_set_header Early-Data $ssl_early_data;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	replay := false
+	for _, w := range mgr.Lint(site, nil) {
+		replay = replay || w.Rule == "early_data_replay"
+	}
+	if !replay {
+		t.Error("Expected a replay warning with early data on")
+	}
+
+	// A header of the site's own replaces the forwarded one.
+	site.ProxySetHeaders = map[string]string{"early-data": "$ssl_early_data"}
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "proxy_set_header Early-Data") {
+		t.Errorf("Expected no second Early-Data header:\n%s", config)
+	}
+
+	site.Protocol = ProtocolGRPC
+	site.ProxySetHeaders = nil
+	config, _ = mgr.Render(site)
+	if !strings.Contains(string(config), "grpc_set_header Early-Data $ssl_early_data;") {
+		t.Errorf("Expected gRPC to forward Early-Data:\n%s", config)
+	}
+
+	site.SSL = false
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "ssl_") || strings.Contains(string(config), "Early-Data") {
+		t.Errorf("Expected no TLS settings without SSL:\n%s", config)
+	}
+
+	if err := CheckTLS(&models.Site{TLS: &models.TLSSettings{SessionCacheSize: "lots"}}); err == nil {
+		t.Error("Expected a bad session cache size to be rejected")
+	}
+}
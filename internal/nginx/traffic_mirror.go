@@ -0,0 +1,54 @@
+package nginx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// shadowMirror is the internal location requests are mirrored to.
+type shadowMirror struct {
+	URL    string
+	Sample string // Percent of requests mirrored; empty mirrors all
+}
+
+// CheckTrafficMirror validates a traffic mirror.
+func CheckTrafficMirror(m *models.Mirror) error {
+	if m == nil {
+		return nil
+	}
+	if !validUpstreamAddress(m.Upstream) {
+		return fmt.Errorf("traffic_mirror: upstream must be a host:port, got %q", m.Upstream)
+	}
+	return checkSampleRate("traffic_mirror", m.SampleRate)
+}
+
+// checkSampleRate validates a share of requests for split_clients, which
+// takes percentages with up to two decimals.
+func checkSampleRate(section string, rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("%s: sample_rate must be between 0 and 1", section)
+	}
+	if p := rate * 10000; math.Abs(p-math.Round(p)) > 1e-6 {
+		return fmt.Errorf("%s: sample_rate may have at most four decimals", section)
+	}
+	return nil
+}
+
+// samplePercent renders a sample rate as a split_clients percentage; empty
+// when every request is sampled.
+func samplePercent(rate float64) string {
+	if rate <= 0 || rate >= 1 {
+		return ""
+	}
+	return strconv.FormatFloat(math.Round(rate*10000)/100, 'f', -1, 64)
+}
+
+func resolveTrafficMirror(m *models.Mirror) *shadowMirror {
+	if m == nil {
+		return nil
+	}
+	return &shadowMirror{URL: "http://" + m.Upstream, Sample: samplePercent(m.SampleRate)}
+}
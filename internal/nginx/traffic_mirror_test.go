@@ -0,0 +1,54 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestTrafficMirror(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "shop.local", Domain: "shop.local", Upstreams: []string{"shop:80"}, SSL: true,
+		TrafficMirror: &models.Mirror{Upstream: "shop-staging:80", SampleRate: 0.07},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"split_clients \"${request_id}\" $mirror_sample_shop_local_6de78b6f {\n    7% 1;\n    * \"\";\n}",
+		"proxy_pass $upstream_endpoint;\n        mirror /_hubfly_mirror;",
+		`if ($mirror_sample_shop_local_6de78b6f = "") { return 204; }`,
+		`set $mirror_endpoint "http://shop-staging:80";`,
+		"proxy_pass $mirror_endpoint$request_uri;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	// One mirror location per server block.
+	if n := strings.Count(cfg, "location = /_hubfly_mirror {"); n != 2 {
+		t.Errorf("Expected 2 mirror locations, got %d", n)
+	}
+
+	// Without a sample rate every request is mirrored.
+	site.TrafficMirror.SampleRate = 0
+	config, _ = mgr.Render(site)
+	if strings.Contains(string(config), "mirror_sample") || !strings.Contains(string(config), "mirror /_hubfly_mirror;") {
+		t.Errorf("Expected unsampled mirroring:\n%s", config)
+	}
+
+	for _, m := range []*models.Mirror{
+		{Upstream: ""},
+		{Upstream: "staging:80; return 200"},
+		{Upstream: "staging:80", SampleRate: 1.5},
+		{Upstream: "staging:80", SampleRate: 0.00001},
+	} {
+		if CheckTrafficMirror(m) == nil {
+			t.Errorf("Expected %+v to be rejected", m)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package nginx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+type upstreamServer struct {
+	Address string
+	Weight  int
+	Down    bool
+}
+
+// upstreamBlock describes the named upstream rendered for sites with
+// several upstreams or explicit load balancing. Single-upstream sites keep
+// proxying through a variable so nginx starts even if the backend is down.
+type upstreamBlock struct {
+	Name    string // Empty when no upstream block is rendered
+	Target  string // Address, upstream name or split variable, without a scheme
+	Servers []upstreamServer
+	Split   *trafficSplit // Set for a canary release
+
+	Keepalive *models.UpstreamKeepalive // Only with an upstream block
+	TLS       bool                      // Passed with https:// (or grpcs://)
+}
+
+// Upstream keepalive limits.
+const (
+	maxKeepaliveConnections = 10000
+	maxKeepaliveTimeout     = 3600
+)
+
+// CheckKeepalive validates a site's upstream keepalive. nginx can only keep
+// connections to an upstream block, which single-upstream sites without
+// load_balancing don't get.
+func CheckKeepalive(site *models.Site) error {
+	k := site.UpstreamKeepalive
+	if k == nil {
+		return nil
+	}
+	if k.Connections < 1 || k.Connections > maxKeepaliveConnections {
+		return fmt.Errorf("upstream_keepalive: connections must be between 1 and %d", maxKeepaliveConnections)
+	}
+	if k.Timeout < 0 || k.Timeout > maxKeepaliveTimeout {
+		return fmt.Errorf("upstream_keepalive: timeout_seconds must be between 0 and %d", maxKeepaliveTimeout)
+	}
+	if k.Requests < 0 {
+		return fmt.Errorf("upstream_keepalive: requests must not be negative")
+	}
+	if len(site.Upstreams) < 2 && site.LoadBalancing == nil {
+		return fmt.Errorf("upstream_keepalive needs several upstreams or load_balancing")
+	}
+	return nil
+}
+
+// URL is the proxy_pass (or grpc_pass) target for protocol.
+func (u upstreamBlock) URL(protocol string) string {
+	scheme := upstreamScheme(protocol)
+	if u.TLS {
+		switch scheme {
+		case ProtocolHTTP:
+			scheme = "https"
+		case ProtocolGRPC:
+			scheme = ProtocolGRPCS
+		}
+	}
+	return scheme + "://" + u.Target
+}
+
+func renderUpstream(site *models.Site) (upstreamBlock, error) {
+	if len(site.Upstreams) == 0 {
+		return upstreamBlock{}, fmt.Errorf("site %s has no upstreams", site.ID)
+	}
+	// Draining upstreams don't get single-upstream sites a block: its
+	// names must resolve when nginx loads the config, which fails once the
+	// old backend is gone.
+	if len(site.Upstreams) == 1 && site.LoadBalancing == nil {
+		b := upstreamBlock{Target: site.Upstreams[0], TLS: site.UpstreamTLS != nil}
+		splitTraffic(site, &b)
+		return b, nil
+	}
+
+	name := "hubfly_" + ident(site.ID)
+	b := upstreamBlock{Name: name, Target: name, Keepalive: site.UpstreamKeepalive, TLS: site.UpstreamTLS != nil}
+	for _, u := range site.Upstreams {
+		b.Servers = append(b.Servers, upstreamServer{
+			Address: u,
+			Weight:  upstreamWeight(site.LoadBalancing, u),
+			Down:    slices.Contains(site.DownUpstreams, u),
+		})
+	}
+	b.Servers = append(b.Servers, drainingServers(site)...)
+	splitTraffic(site, &b)
+	return b, nil
+}
+
+// validUpstreamAddress reports whether u can be rendered after "http://"
+// as a host:port.
+func validUpstreamAddress(u string) bool {
+	return u != "" && !strings.ContainsAny(u, " \t\r\n;{}\"'$#/")
+}
+
+// upstreamWeight prefers the adaptive balancer's weight, then the base weight.
+func upstreamWeight(lb *models.LoadBalancing, upstream string) int {
+	if lb == nil {
+		return 1
+	}
+	if lb.Adaptive != nil && lb.Adaptive.Enabled {
+		if w, ok := lb.EffectiveWeights[upstream]; ok && w > 0 {
+			return w
+		}
+	}
+	if w := lb.Weights[upstream]; w > 0 {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// hostName is a DNS name, optionally with a port when used as a Host header.
+var hostName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+
+// CheckUpstreamHost validates the Host header a site sends its upstreams.
+func CheckUpstreamHost(site *models.Site) error {
+	h := site.UpstreamHost
+	if h == "" {
+		return nil
+	}
+	name, port, hasPort := strings.Cut(h, ":")
+	if !hostName.MatchString(name) || hasPort && !validPort(port) {
+		return fmt.Errorf("upstream_host: must be a host name, optionally with a port, got %q", h)
+	}
+	for k := range site.ProxySetHeaders {
+		if strings.EqualFold(k, "Host") {
+			return fmt.Errorf("upstream_host: proxy_set_header already sets Host; set one of them")
+		}
+	}
+	return nil
+}
+
+func validPort(p string) bool {
+	n := 0
+	for _, c := range p {
+		if c < '0' || c > '9' {
+			return false
+		}
+		n = n*10 + int(c-'0')
+		if n > 65535 {
+			return false
+		}
+	}
+	return p != "" && n > 0
+}
+
+// UpstreamSSLName is the name a site's upstream TLS sends as SNI and
+// verifies the certificate against: server_name, or else the host of
+// upstream_host. Empty leaves it to nginx (the host in proxy_pass).
+func UpstreamSSLName(site *models.Site) string {
+	if t := site.UpstreamTLS; t != nil && t.ServerName != "" {
+		return t.ServerName
+	}
+	name, _, _ := strings.Cut(site.UpstreamHost, ":")
+	return name
+}
@@ -0,0 +1,70 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestUpstreamHost(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "assets.local", Domain: "assets.local", SSL: true,
+		Upstreams:    []string{"bucket-a.storage.example.net:443", "bucket-b.storage.example.net:443"},
+		UpstreamHost: "assets.storage.example.net",
+		UpstreamTLS:  &models.UpstreamTLS{Scheme: "https", SNI: true, CA: "/etc/ssl/certs/ca-certificates.crt", Verify: true},
+		Firewall:     &models.FirewallConfig{BlockRules: &models.BlockRules{PathMethods: map[string][]string{"/admin": {"DELETE"}}}},
+		Routes:       []models.RouteOverride{{Path: "/rpc/", Protocol: "grpc"}},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"proxy_ssl_server_name on;",
+		"proxy_ssl_name assets.storage.example.net;",
+		"grpc_ssl_name assets.storage.example.net;",
+		"grpc_set_header Host assets.storage.example.net;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	// The root and path_methods locations of both servers, and /ws/.
+	if n := strings.Count(cfg, "proxy_set_header Host assets.storage.example.net;"); n != 5 {
+		t.Errorf("Expected the upstream Host in 5 locations, got %d:\n%s", n, cfg)
+	}
+	if strings.Contains(cfg, "proxy_set_header Host $host;") {
+		t.Errorf("Expected no location to send the client's Host:\n%s", cfg)
+	}
+
+	// server_name wins over upstream_host for the handshake.
+	site.UpstreamTLS.ServerName = "storage.example.net"
+	config, _ = mgr.Render(site)
+	if cfg := string(config); !strings.Contains(cfg, "proxy_ssl_name storage.example.net;") {
+		t.Errorf("Expected server_name as proxy_ssl_name:\n%s", cfg)
+	}
+
+	// Several upstreams need a name to verify against.
+	site.UpstreamHost = ""
+	site.UpstreamTLS.ServerName = ""
+	if CheckUpstreamTLS(site) == nil {
+		t.Error("Expected verify without a name to be rejected for several upstreams")
+	}
+
+	for _, s := range []*models.Site{
+		{UpstreamHost: "bad host"},
+		{UpstreamHost: "example.com:99999"},
+		{UpstreamHost: "example.com; return 200"},
+		{UpstreamHost: "example.com", ProxySetHeaders: map[string]string{"host": "$host"}},
+	} {
+		if CheckUpstreamHost(s) == nil {
+			t.Errorf("Expected upstream_host %q to be rejected", s.UpstreamHost)
+		}
+	}
+	if err := CheckUpstreamHost(&models.Site{UpstreamHost: "myapp.herokuapp.com:443"}); err != nil {
+		t.Errorf("Expected a host with a port to be valid, got %v", err)
+	}
+}
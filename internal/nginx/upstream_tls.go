@@ -0,0 +1,69 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+var pemPath = regexp.MustCompile(`^/[A-Za-z0-9._@+/-]+$`)
+
+// upstreamTLS is a site's upstream TLS, ready to render. Prefixes holds
+// "proxy", and "grpc" when some location proxies gRPC, since both modules
+// have their own directives.
+type upstreamTLS struct {
+	Prefixes   []string
+	ClientCert string
+	ClientKey  string
+	CA         string
+	Verify     bool
+	SNI        bool
+	ServerName string // proxy_ssl_name; empty keeps the host in proxy_pass
+}
+
+// CheckUpstreamTLS validates a site's upstream TLS.
+func CheckUpstreamTLS(site *models.Site) error {
+	t := site.UpstreamTLS
+	if t == nil {
+		return nil
+	}
+	if t.Scheme != "https" {
+		return fmt.Errorf("upstream_tls: scheme must be https, got %q", t.Scheme)
+	}
+	for _, f := range []struct{ name, path string }{{"client_cert", t.ClientCert}, {"client_key", t.ClientKey}, {"ca", t.CA}} {
+		if f.path != "" && !pemPath.MatchString(f.path) {
+			return fmt.Errorf("upstream_tls: %s must be an absolute file path, got %q", f.name, f.path)
+		}
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("upstream_tls: client_cert and client_key must be set together")
+	}
+	if t.Verify && t.CA == "" {
+		return fmt.Errorf("upstream_tls: verify needs a ca to check the upstream's certificate against")
+	}
+	if t.ServerName != "" && !hostName.MatchString(t.ServerName) {
+		return fmt.Errorf("upstream_tls: server_name must be a host name, got %q", t.ServerName)
+	}
+	// Without a name, nginx uses the host in proxy_pass, which is the
+	// upstream block's name when there is one.
+	if (t.Verify || t.SNI) && UpstreamSSLName(site) == "" && (len(site.Upstreams) > 1 || site.LoadBalancing != nil) {
+		return fmt.Errorf("upstream_tls: verify and sni need server_name (or upstream_host) with several upstreams or load_balancing")
+	}
+	return nil
+}
+
+func resolveUpstreamTLS(site *models.Site) *upstreamTLS {
+	t := site.UpstreamTLS
+	if t == nil {
+		return nil
+	}
+	u := &upstreamTLS{Prefixes: []string{"proxy"}, ClientCert: t.ClientCert, ClientKey: t.ClientKey, CA: t.CA, Verify: t.Verify, SNI: t.SNI || t.ServerName != ""}
+	if u.SNI || u.Verify {
+		u.ServerName = UpstreamSSLName(site)
+	}
+	if usesGRPC(site) {
+		u.Prefixes = append(u.Prefixes, "grpc")
+	}
+	return u
+}
@@ -0,0 +1,78 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "api.local", Domain: "api.local", Upstreams: []string{"backend:8443"}, SSL: true,
+		UpstreamTLS: &models.UpstreamTLS{
+			Scheme: "https", ClientCert: "/etc/hubfly/mtls/client.pem", ClientKey: "/etc/hubfly/mtls/client.key",
+			CA: "/etc/hubfly/mtls/ca.pem", Verify: true,
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		`set $upstream_endpoint "https://backend:8443";`,
+		"proxy_ssl_certificate /etc/hubfly/mtls/client.pem;\n    proxy_ssl_certificate_key /etc/hubfly/mtls/client.key;",
+		"proxy_ssl_trusted_certificate /etc/hubfly/mtls/ca.pem;",
+		"proxy_ssl_verify on;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if n := strings.Count(cfg, "proxy_ssl_certificate /etc"); n != 2 {
+		t.Errorf("Expected the client certificate in both servers, got %d", n)
+	}
+	if strings.Contains(cfg, "grpc_ssl") || strings.Contains(cfg, `"http://backend`) {
+		t.Errorf("Expected only https proxying:\n%s", cfg)
+	}
+
+	// gRPC locations get their own directives and grpcs://.
+	site.Routes = []models.RouteOverride{{Path: "/rpc/", Protocol: "grpc"}}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = string(config)
+	for _, want := range []string{`set $upstream_endpoint "grpcs://backend:8443";`, "grpc_ssl_certificate /etc/hubfly/mtls/client.pem;", "grpc_ssl_verify on;"} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+
+	// Re-encryption alone needs no files.
+	site.Routes = nil
+	site.UpstreamTLS = &models.UpstreamTLS{Scheme: "https"}
+	config, _ = mgr.Render(site)
+	if cfg := string(config); !strings.Contains(cfg, `"https://backend:8443"`) || strings.Contains(cfg, "proxy_ssl") {
+		t.Errorf("Expected https without proxy_ssl directives:\n%s", cfg)
+	}
+
+	for _, u := range []*models.UpstreamTLS{
+		{},
+		{Scheme: "http"},
+		{Scheme: "https", ClientCert: "/etc/client.pem"},
+		{Scheme: "https", ClientCert: "client.pem", ClientKey: "client.key"},
+		{Scheme: "https", CA: "/etc/ca.pem; return 200"},
+		{Scheme: "https", Verify: true},
+	} {
+		if CheckUpstreamTLS(&models.Site{Upstreams: []string{"a:443"}, UpstreamTLS: u}) == nil {
+			t.Errorf("Expected %+v to be rejected", u)
+		}
+	}
+	multi := &models.Site{Upstreams: []string{"a:443", "b:443"}, UpstreamTLS: &models.UpstreamTLS{Scheme: "https", CA: "/etc/ca.pem", Verify: true}}
+	if CheckUpstreamTLS(multi) == nil {
+		t.Errorf("Expected verify with an upstream block to be rejected")
+	}
+}
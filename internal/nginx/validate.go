@@ -0,0 +1,163 @@
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+)
+
+// validateTimeout bounds one nginx -t run.
+const validateTimeout = 30 * time.Second
+
+// ValidationError is the failure reported by nginx -t, with the file
+// pointing at the staging or live config rather than the test tree.
+type ValidationError struct {
+	Level   string `json:"level"` // emerg, alert, crit, ...
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("nginx: [%s] %s", e.Level, e.Message)
+	}
+	return fmt.Sprintf("nginx: [%s] %s in %s:%d", e.Level, e.Message, e.File, e.Line)
+}
+
+// nginx -t lines look like:
+// nginx: [emerg] unknown directive "foo" in /etc/hubfly/sites/a.conf:12
+var testLinePattern = regexp.MustCompile(`^nginx: \[(\w+)\] (.*?)(?: in (\S+):(\d+))?$`)
+
+// Validate runs nginx -t against the staging config in an isolated tree: a
+// copy of the main nginx.conf whose sites include points at a temporary
+// directory holding the live site configs, with the staging file in place
+// of the site it replaces. The live directory is never touched.
+//
+// Without an nginx binary or main config (local development) validation is
+// skipped.
+func (m *Manager) Validate(stagingFile string) error {
+	if err := m.Faults.Check(faults.NginxValidate); err != nil {
+		return err
+	}
+	path, err := exec.LookPath("nginx")
+	if err != nil {
+		slog.Debug("Nginx not found, skipping validation")
+		return nil
+	}
+	mainConf, err := os.ReadFile(m.NginxConf)
+	if err != nil {
+		slog.Warn("Main nginx config unreadable, skipping validation", "file", m.NginxConf, "error", err)
+		return nil
+	}
+
+	tree, err := os.MkdirTemp("", "hubfly-nginx-test-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tree)
+
+	conf, err := m.buildTestTree(tree, mainConf, stagingFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "-t", "-q", "-c", conf).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	testSites := filepath.Join(tree, "sites")
+	target := filepath.Join(testSites, filepath.Base(stagingFile))
+	mapPath := func(p string) string {
+		switch {
+		case p == target:
+			return stagingFile
+		case p == conf:
+			return m.NginxConf
+		case strings.HasPrefix(p, testSites+string(filepath.Separator)):
+			return filepath.Join(m.SitesDir, strings.TrimPrefix(p, testSites+string(filepath.Separator)))
+		}
+		return p
+	}
+	if verr := parseTestOutput(string(out), mapPath); verr != nil {
+		slog.Error("Nginx config test failed", "staging", stagingFile, "error", verr)
+		return verr
+	}
+	return fmt.Errorf("nginx -t failed: %v, output: %s", err, strings.TrimSpace(string(out)))
+}
+
+// buildTestTree writes the test nginx.conf into tree and returns its path.
+func (m *Manager) buildTestTree(tree string, mainConf []byte, stagingFile string) (string, error) {
+	sitesGlob := filepath.Join(m.SitesDir, "*.conf")
+	include := regexp.MustCompile(`(?m)^(\s*include\s+)["']?` + regexp.QuoteMeta(sitesGlob) + `["']?(\s*;)`)
+	if !include.Match(mainConf) {
+		return "", fmt.Errorf("cannot validate in isolation: %s does not include %s", m.NginxConf, sitesGlob)
+	}
+
+	testSites := filepath.Join(tree, "sites")
+	if err := os.Mkdir(testSites, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Base(stagingFile)
+	live, err := filepath.Glob(sitesGlob)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range live {
+		if filepath.Base(f) == target {
+			continue // Replaced by the staging file
+		}
+		if err := os.Symlink(f, filepath.Join(testSites, filepath.Base(f))); err != nil {
+			return "", err
+		}
+	}
+	staging, err := filepath.Abs(stagingFile)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Symlink(staging, filepath.Join(testSites, target)); err != nil {
+		return "", err
+	}
+
+	rewritten := include.ReplaceAll(mainConf, []byte("${1}"+filepath.Join(testSites, "*.conf")+"${2}"))
+	conf := filepath.Join(tree, "nginx.conf")
+	if err := os.WriteFile(conf, rewritten, 0644); err != nil {
+		return "", err
+	}
+	return conf, nil
+}
+
+// parseTestOutput returns the first error-level message from nginx -t
+// output, or nil if there is none. Warnings are logged.
+func parseTestOutput(out string, mapPath func(string) string) *ValidationError {
+	for _, line := range strings.Split(out, "\n") {
+		match := testLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		e := &ValidationError{Level: match[1], Message: match[2]}
+		if match[3] != "" {
+			e.File = mapPath(match[3])
+			e.Line, _ = strconv.Atoi(match[4])
+		}
+		switch e.Level {
+		case "emerg", "alert", "crit", "error":
+			return e
+		default:
+			slog.Warn("Nginx config test warning", "message", e.Message, "file", e.File, "line", e.Line)
+		}
+	}
+	return nil
+}
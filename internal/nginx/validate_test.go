@@ -0,0 +1,90 @@
+package nginx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeNginx stands in for nginx -t: it fails on any included site config
+// containing "bogus" and checks that the sites include was redirected.
+const fakeNginx = `#!/bin/sh
+conf="$4"
+dir=$(dirname "$conf")
+grep -q "include $dir/sites/\*.conf;" "$conf" || { echo "nginx: [emerg] sites include not rewritten in $conf:1" >&2; exit 1; }
+for f in "$dir"/sites/*.conf; do
+  if grep -q bogus "$f"; then
+    echo "nginx: [warn] conflicting server name \"a\" on 0.0.0.0:80, ignored" >&2
+    echo "nginx: [emerg] unknown directive \"bogus\" in $f:2" >&2
+    echo "nginx: configuration file $conf test failed" >&2
+    exit 1
+  fi
+done
+exit 0
+`
+
+func TestValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	bin := filepath.Join(tmpDir, "bin")
+	os.Mkdir(bin, 0755)
+	if err := os.WriteFile(filepath.Join(bin, "nginx"), []byte(fakeNginx), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	mgr := NewManager(tmpDir)
+	if err := mgr.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+	mgr.NginxConf = filepath.Join(tmpDir, "nginx.conf")
+	main := "events {}\nhttp {\n    include " + filepath.Join(mgr.SitesDir, "*.conf") + ";\n}\n"
+	os.WriteFile(mgr.NginxConf, []byte(main), 0644)
+
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staging := filepath.Join(mgr.StagingDir, "a.conf")
+	live := filepath.Join(mgr.SitesDir, "a.conf")
+
+	write(staging, "server {\n    listen 80;\n}\n")
+	if err := mgr.Validate(staging); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	write(staging, "server {\n    bogus on;\n}\n")
+	err := mgr.Validate(staging)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if verr.Level != "emerg" || verr.File != staging || verr.Line != 2 || verr.Message != `unknown directive "bogus"` {
+		t.Errorf("Unexpected error: %+v", verr)
+	}
+
+	// The staging file replaces the live config of the same site ...
+	write(live, "server {\n    bogus on;\n}\n")
+	write(staging, "server {\n    listen 80;\n}\n")
+	if err := mgr.Validate(staging); err != nil {
+		t.Errorf("Live config being replaced should not be tested: %v", err)
+	}
+
+	// ... but other live sites are part of the test.
+	other := filepath.Join(mgr.SitesDir, "b.conf")
+	write(other, "bogus;\n")
+	if err := mgr.Validate(staging); !errors.As(err, &verr) || verr.File != other {
+		t.Errorf("Expected failure in %s, got %v", other, err)
+	}
+	if data, _ := os.ReadFile(live); !strings.Contains(string(data), "bogus") {
+		t.Errorf("Validate modified the live directory")
+	}
+
+	// A main config without the sites include cannot be rewritten.
+	os.WriteFile(mgr.NginxConf, []byte("events {}\nhttp {}\n"), 0644)
+	if err := mgr.Validate(staging); err == nil || !strings.Contains(err.Error(), "cannot validate in isolation") {
+		t.Errorf("Expected isolation error, got %v", err)
+	}
+}
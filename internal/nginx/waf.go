@@ -0,0 +1,99 @@
+package nginx
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultWAFDir holds modsecurity.conf (engine settings) and crs.conf
+// (the OWASP Core Rule Set includes), as shipped in nginx/modsec.
+const DefaultWAFDir = "/etc/nginx/modsec"
+
+// wafRuleIDBase numbers the rules hubfly generates for path-scoped
+// exclusions, in the range ModSecurity leaves for local rules.
+const wafRuleIDBase = 10000
+
+var wafPathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+// modSecurity is a site's WAF, ready to render. Before is loaded ahead of
+// the CRS (engine mode, paranoia, runtime exclusions), After once its
+// rules exist.
+type modSecurity struct {
+	Engine string
+	CRS    string
+	Before []string
+	After  []string
+}
+
+// CheckWAF validates a site's WAF settings.
+func CheckWAF(w *models.WAF) error {
+	if w == nil {
+		return nil
+	}
+	if w.Paranoia < 0 || w.Paranoia > 4 {
+		return fmt.Errorf("waf: paranoia must be between 1 and 4")
+	}
+	seen := make(map[string]bool)
+	for _, e := range w.RuleExclusions {
+		if e.RuleID <= 0 || e.RuleID > 9999999 {
+			return fmt.Errorf("waf: invalid rule_id %d", e.RuleID)
+		}
+		if e.Path != "" && !wafPathPattern.MatchString(e.Path) {
+			return fmt.Errorf("waf: exclusion path %q must start with / and use only letters, digits and ._~/-", e.Path)
+		}
+		key := strconv.Itoa(e.RuleID) + " " + e.Path
+		if seen[key] {
+			return fmt.Errorf("waf: rule %d is excluded twice%s", e.RuleID, onPath(e.Path))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func onPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " on " + path
+}
+
+// wafRules returns the ModSecurity directives of a site, or nil when its
+// WAF is off.
+func (m *Manager) wafRules(w *models.WAF) *modSecurity {
+	if w == nil || !w.Enabled {
+		return nil
+	}
+	ms := &modSecurity{
+		Engine: filepath.Join(m.WAFDir, "modsecurity.conf"),
+		CRS:    filepath.Join(m.WAFDir, "crs.conf"),
+	}
+	if w.DetectionOnly {
+		ms.Before = append(ms.Before, "SecRuleEngine DetectionOnly")
+	}
+	paranoia := w.Paranoia
+	if paranoia == 0 {
+		paranoia = 1
+	}
+	ms.Before = append(ms.Before, fmt.Sprintf(`SecAction "id:900000,phase:1,pass,nolog,t:none,setvar:tx.blocking_paranoia_level=%d"`, paranoia))
+
+	var removed []string
+	n := 0
+	for _, e := range w.RuleExclusions {
+		if e.Path == "" {
+			removed = append(removed, strconv.Itoa(e.RuleID))
+			continue
+		}
+		n++
+		ms.Before = append(ms.Before, fmt.Sprintf(`SecRule REQUEST_FILENAME "@beginsWith %s" "id:%d,phase:1,pass,nolog,ctl:ruleRemoveById=%d"`,
+			e.Path, wafRuleIDBase+n, e.RuleID))
+	}
+	if len(removed) > 0 {
+		ms.After = append(ms.After, "SecRuleRemoveById "+strings.Join(removed, " "))
+	}
+	return ms
+}
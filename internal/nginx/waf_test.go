@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestWAF(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{
+		ID: "waf.local", Domain: "waf.local", Upstreams: []string{"app:80"},
+		WAF: &models.WAF{
+			Enabled:  true,
+			Paranoia: 2,
+			RuleExclusions: []models.WAFExclusion{
+				{RuleID: 942100},
+				{RuleID: 920350, Path: "/api/upload"},
+				{RuleID: 941100, Reason: "rich text editor"},
+			},
+		},
+	}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	want := []string{
+		"modsecurity on;",
+		"modsecurity_rules_file /etc/nginx/modsec/modsecurity.conf;",
+		"setvar:tx.blocking_paranoia_level=2",
+		`SecRule REQUEST_FILENAME "@beginsWith /api/upload" "id:10001,phase:1,pass,nolog,ctl:ruleRemoveById=920350"`,
+		"modsecurity_rules_file /etc/nginx/modsec/crs.conf;",
+		"SecRuleRemoveById 942100 941100",
+	}
+	last := -1
+	for _, w := range want {
+		i := strings.Index(cfg, w)
+		if i < 0 {
+			t.Fatalf("Expected %q in:\n%s", w, cfg)
+		}
+		if i < last {
+			t.Errorf("Expected %q after the directives before it", w)
+		}
+		last = i
+	}
+	if strings.Contains(cfg, "DetectionOnly") {
+		t.Errorf("Expected blocking mode by default")
+	}
+	if _, err := Parse(config); err != nil {
+		t.Fatalf("Rendered config does not parse: %v", err)
+	}
+
+	site.WAF = &models.WAF{Enabled: true, DetectionOnly: true}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := string(config); !strings.Contains(cfg, "SecRuleEngine DetectionOnly") || !strings.Contains(cfg, "blocking_paranoia_level=1") {
+		t.Errorf("Expected detection only at paranoia 1:\n%s", cfg)
+	}
+	site.WAF.Enabled = false
+	if config, _ = mgr.Render(site); strings.Contains(string(config), "modsecurity") {
+		t.Errorf("Expected no ModSecurity directives with the WAF disabled")
+	}
+
+	for _, bad := range []models.WAF{
+		{Paranoia: 5},
+		{RuleExclusions: []models.WAFExclusion{{RuleID: 0}}},
+		{RuleExclusions: []models.WAFExclusion{{RuleID: 942100, Path: "api"}}},
+		{RuleExclusions: []models.WAFExclusion{{RuleID: 942100, Path: "/a'b"}}},
+		{RuleExclusions: []models.WAFExclusion{{RuleID: 942100}, {RuleID: 942100}}},
+	} {
+		if err := CheckWAF(&bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
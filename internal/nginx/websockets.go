@@ -0,0 +1,47 @@
+package nginx
+
+import (
+	"fmt"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultWebSocketTimeout is the idle timeout of sites with websockets
+// enabled and no websocket_timeout_seconds (one hour).
+const DefaultWebSocketTimeout = 3600
+
+// webSockets renders the upgrade headers. The Connection map is rendered
+// per site, so configs don't depend on one in nginx.conf.
+type webSockets struct {
+	Connection string // Variable holding the Connection header, e.g. $ws_connection_app_local
+	Timeout    int    // proxy_read_timeout and proxy_send_timeout; 0 keeps nginx's
+}
+
+// CheckWebSockets validates a site's websocket settings.
+func CheckWebSockets(site *models.Site) error {
+	if site.WebSocketTimeout < 0 || site.WebSocketTimeout > maxRouteTimeout {
+		return fmt.Errorf("websocket_timeout_seconds must be between 0 and %d", maxRouteTimeout)
+	}
+	if site.WebSocketTimeout > 0 && !site.WebSockets {
+		return fmt.Errorf("websocket_timeout_seconds requires websockets")
+	}
+	return nil
+}
+
+// resolveWebSockets leaves the timeouts alone when the site's templates or
+// extra_config set them, since nginx rejects a duplicate.
+func resolveWebSockets(site *models.Site, snippets string) *webSockets {
+	ws := &webSockets{Connection: "$ws_connection_" + ident(site.ID)}
+	if !site.WebSockets {
+		return ws
+	}
+	dirs, err := Parse([]byte(snippets + "\n" + site.ExtraConfig))
+	if err == nil && (hasDirective(dirs, "proxy_read_timeout") || hasDirective(dirs, "proxy_send_timeout")) {
+		return ws
+	}
+	ws.Timeout = site.WebSocketTimeout
+	if ws.Timeout == 0 {
+		ws.Timeout = DefaultWebSocketTimeout
+	}
+	return ws
+}
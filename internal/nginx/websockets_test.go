@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestWebSockets(t *testing.T) {
+	mgr := NewManager(t.TempDir())
+	site := &models.Site{ID: "chat.local", Domain: "chat.local", Upstreams: []string{"chat:3000"}}
+	config, err := mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := string(config)
+	for _, want := range []string{
+		"map $http_upgrade $ws_connection_chat_local_80b64bbd {\n    default upgrade;\n    '' close;\n}",
+		"proxy_set_header Upgrade $http_upgrade;",
+		"proxy_set_header Connection $ws_connection_chat_local_80b64bbd;",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("Expected %q in config:\n%s", want, cfg)
+		}
+	}
+	if strings.Contains(cfg, `Connection "upgrade"`) || strings.Contains(cfg, "proxy_read_timeout") {
+		t.Errorf("Expected only the mapped Connection header and default timeouts:\n%s", cfg)
+	}
+
+	site.WebSockets = true
+	config, _ = mgr.Render(site)
+	if !strings.Contains(string(config), "proxy_read_timeout 3600s;\n        proxy_send_timeout 3600s;") {
+		t.Errorf("Expected the default websocket timeout:\n%s", config)
+	}
+	site.WebSocketTimeout = 600
+	site.Routes = []models.RouteOverride{{Path: "/api/", ReadTimeout: 5}}
+	config, err = mgr.Render(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "proxy_read_timeout 600s;") || !strings.Contains(string(config), "proxy_read_timeout 5s;") {
+		t.Errorf("Expected the site and route timeouts:\n%s", config)
+	}
+
+	// A template's own timeouts win over the websocket default.
+	site.ExtraConfig = "proxy_read_timeout 120s;"
+	config, _ = mgr.Render(site)
+	if strings.Count(string(config), "proxy_read_timeout") != 2 {
+		t.Errorf("Expected extra_config's timeout instead of the websocket one:\n%s", config)
+	}
+
+	for _, bad := range []*models.Site{
+		{WebSockets: true, WebSocketTimeout: -1},
+		{WebSockets: true, WebSocketTimeout: maxRouteTimeout + 1},
+		{WebSocketTimeout: 60},
+	} {
+		if CheckWebSockets(bad) == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
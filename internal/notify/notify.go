@@ -0,0 +1,66 @@
+// Package notify delivers operational alerts to webhooks.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Alert is the JSON body posted to each webhook.
+type Alert struct {
+	Time       time.Time              `json:"time"`
+	Event      string                 `json:"event"`    // e.g. "synthetic.down"
+	Resource   string                 `json:"resource"` // "site", "stream", ...
+	ResourceID string                 `json:"resource_id,omitempty"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier posts alerts to webhooks. A nil Notifier, or one without
+// webhooks, drops them.
+type Notifier struct {
+	Webhooks []string
+	client   *http.Client
+}
+
+func NewNotifier(webhooks []string) *Notifier {
+	return &Notifier{Webhooks: webhooks, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts a to every webhook in the background. Failed deliveries are
+// logged, not retried.
+func (n *Notifier) Send(a Alert) {
+	if n == nil || len(n.Webhooks) == 0 {
+		return
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	for _, url := range n.Webhooks {
+		go func(url string) {
+			if err := n.post(url, body); err != nil {
+				slog.Warn("Alert delivery failed", "event", a.Event, "webhook", url, "error", err)
+			}
+		}(url)
+	}
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
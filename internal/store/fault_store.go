@@ -0,0 +1,86 @@
+package store
+
+import (
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// FaultStore wraps a Store and fails writes when the faults.StoreWrite
+// point is armed. Reads always go through.
+type FaultStore struct {
+	Store
+	Faults *faults.Injector
+}
+
+func NewFaultStore(s Store, f *faults.Injector) *FaultStore {
+	return &FaultStore{Store: s, Faults: f}
+}
+
+// Ping forwards to the wrapped store when it supports health checks.
+func (s *FaultStore) Ping() error {
+	if p, ok := s.Store.(interface{ Ping() error }); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// Compact forwards to the wrapped store. It returns nil when the store has
+// nothing to compact, like the JSON store, which rewrites its files whole.
+func (s *FaultStore) Compact() (*CompactResult, error) {
+	if c, ok := s.Store.(interface {
+		Compact() (*CompactResult, error)
+	}); ok {
+		return c.Compact()
+	}
+	return nil, nil
+}
+
+func (s *FaultStore) SaveSite(site *models.Site) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.SaveSite(site)
+}
+
+func (s *FaultStore) DeleteSite(id string) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.DeleteSite(id)
+}
+
+func (s *FaultStore) SaveStream(stream *models.Stream) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.SaveStream(stream)
+}
+
+func (s *FaultStore) DeleteStream(id string) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.DeleteStream(id)
+}
+
+func (s *FaultStore) SaveAPIKey(key *models.APIKey) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.SaveAPIKey(key)
+}
+
+func (s *FaultStore) DeleteAPIKey(id string) error {
+	if err := s.Faults.Check(faults.StoreWrite); err != nil {
+		return err
+	}
+	return s.Store.DeleteAPIKey(id)
+}
+
+// WithTx hands fn a wrapped transaction, so an injected write error rolls
+// the whole transaction back.
+func (s *FaultStore) WithTx(fn func(tx Store) error) error {
+	return s.Store.WithTx(func(tx Store) error {
+		return fn(&FaultStore{Store: tx, Faults: s.Faults})
+	})
+}
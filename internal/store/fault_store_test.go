@@ -0,0 +1,47 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/faults"
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestFaultStore(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	js, err := NewJSONStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inj := faults.NewInjector()
+	st := NewFaultStore(js, inj)
+
+	if err := st.SaveSite(&models.Site{ID: "a", Domain: "a.local"}); err != nil {
+		t.Fatalf("Unarmed store should write: %v", err)
+	}
+
+	inj.Set(faults.Fault{Point: faults.StoreWrite, Count: 1})
+	err = st.WithTx(func(tx Store) error {
+		if err := tx.DeleteSite("a"); err != nil {
+			return err
+		}
+		return tx.SaveSite(&models.Site{ID: "b", Domain: "b.local"})
+	})
+	if err == nil {
+		t.Fatal("Injected write error should fail the transaction")
+	}
+	if _, err := st.GetSite("a"); err != nil {
+		t.Errorf("Failed transaction should leave existing data: %v", err)
+	}
+
+	// Count was 1: the next write goes through.
+	if err := st.SaveSite(&models.Site{ID: "b", Domain: "b.local"}); err != nil {
+		t.Errorf("Fault should be exhausted: %v", err)
+	}
+}
@@ -20,14 +20,26 @@ type Store interface {
 	GetStream(id string) (*models.Stream, error)
 	SaveStream(stream *models.Stream) error
 	DeleteStream(id string) error
+
+	ListAPIKeys() ([]models.APIKey, error)
+	GetAPIKey(id string) (*models.APIKey, error)
+	SaveAPIKey(key *models.APIKey) error
+	DeleteAPIKey(id string) error
+
+	// WithTx runs fn with all-or-nothing semantics: writes made through tx
+	// are committed together if fn returns nil and discarded otherwise.
+	// fn must only use tx, never the outer store.
+	WithTx(fn func(tx Store) error) error
 }
 
 type JSONStore struct {
 	sitesFilePath   string
 	streamsFilePath string
+	apiKeysFilePath string
 	mu              sync.RWMutex
 	sites           map[string]models.Site
 	streams         map[string]models.Stream
+	apiKeys         map[string]models.APIKey
 }
 
 func NewJSONStore(dir string) (*JSONStore, error) {
@@ -37,8 +49,10 @@ func NewJSONStore(dir string) (*JSONStore, error) {
 	s := &JSONStore{
 		sitesFilePath:   filepath.Join(dir, "metadata.json"),
 		streamsFilePath: filepath.Join(dir, "streams.json"),
+		apiKeysFilePath: filepath.Join(dir, "apikeys.json"),
 		sites:           make(map[string]models.Site),
 		streams:         make(map[string]models.Stream),
+		apiKeys:         make(map[string]models.APIKey),
 	}
 
 	if err := s.load(); err != nil {
@@ -65,6 +79,13 @@ func (s *JSONStore) load() error {
 		}
 	}
 
+	// Load API Keys
+	if data, err := os.ReadFile(s.apiKeysFilePath); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &s.apiKeys); err != nil {
+			return fmt.Errorf("failed to load api keys: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -84,6 +105,15 @@ func (s *JSONStore) saveStreams() error {
 	return os.WriteFile(s.streamsFilePath, data, 0644)
 }
 
+func (s *JSONStore) saveAPIKeys() error {
+	data, err := json.MarshalIndent(s.apiKeys, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Contains secret hashes: keep it private to the owner
+	return os.WriteFile(s.apiKeysFilePath, data, 0600)
+}
+
 func (s *JSONStore) ListSites() ([]models.Site, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -158,4 +188,217 @@ func (s *JSONStore) DeleteStream(id string) error {
 	return s.saveStreams()
 }
 
-// saveAtomic is removed as it is no longer needed.
+// API Key Methods
+
+func (s *JSONStore) ListAPIKeys() ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]models.APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		list = append(list, key)
+	}
+	return list, nil
+}
+
+func (s *JSONStore) GetAPIKey(id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("api key not found: %s", id)
+	}
+	return &key, nil
+}
+
+func (s *JSONStore) SaveAPIKey(key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKeys[key.ID] = *key
+	return s.saveAPIKeys()
+}
+
+func (s *JSONStore) DeleteAPIKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.apiKeys, id)
+	return s.saveAPIKeys()
+}
+
+// WithTx runs fn against a copy of the store while holding the write lock.
+// On success the copy replaces the live maps and the changed files are
+// written; if a write fails, the previous state is restored on disk too.
+func (s *JSONStore) WithTx(fn func(tx Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &jsonTx{
+		sites:   make(map[string]models.Site, len(s.sites)),
+		streams: make(map[string]models.Stream, len(s.streams)),
+		apiKeys: make(map[string]models.APIKey, len(s.apiKeys)),
+	}
+	for k, v := range s.sites {
+		tx.sites[k] = v
+	}
+	for k, v := range s.streams {
+		tx.streams[k] = v
+	}
+	for k, v := range s.apiKeys {
+		tx.apiKeys[k] = v
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	prevSites, prevStreams, prevKeys := s.sites, s.streams, s.apiKeys
+	s.sites, s.streams, s.apiKeys = tx.sites, tx.streams, tx.apiKeys
+
+	// Write each changed file; on the first failure restore every file
+	// already written so disk matches the restored maps.
+	type file struct {
+		dirty bool
+		save  func() error
+		name  string
+	}
+	files := []file{
+		{tx.sitesDirty, s.saveSites, "sites"},
+		{tx.streamsDirty, s.saveStreams, "streams"},
+		{tx.apiKeysDirty, s.saveAPIKeys, "api keys"},
+	}
+	for i, f := range files {
+		if !f.dirty {
+			continue
+		}
+		if err := f.save(); err != nil {
+			s.sites, s.streams, s.apiKeys = prevSites, prevStreams, prevKeys
+			for _, done := range files[:i+1] {
+				if done.dirty {
+					done.save()
+				}
+			}
+			return fmt.Errorf("commit %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// jsonTx is the Store view handed to WithTx callbacks. It works on private
+// copies of the maps, so nothing is visible until commit. Values are deep
+// copied going in and out, so a callback mutating a pointer field of what it
+// read can't reach live state when the transaction is discarded.
+type jsonTx struct {
+	sites        map[string]models.Site
+	streams      map[string]models.Stream
+	apiKeys      map[string]models.APIKey
+	sitesDirty   bool
+	streamsDirty bool
+	apiKeysDirty bool
+}
+
+func (t *jsonTx) ListSites() ([]models.Site, error) {
+	list := make([]models.Site, 0, len(t.sites))
+	for _, site := range t.sites {
+		list = append(list, deepCopy(site))
+	}
+	return list, nil
+}
+
+func (t *jsonTx) GetSite(id string) (*models.Site, error) {
+	site, ok := t.sites[id]
+	if !ok {
+		return nil, fmt.Errorf("site not found: %s", id)
+	}
+	site = deepCopy(site)
+	return &site, nil
+}
+
+func (t *jsonTx) SaveSite(site *models.Site) error {
+	t.sites[site.ID] = deepCopy(*site)
+	t.sitesDirty = true
+	return nil
+}
+
+func (t *jsonTx) DeleteSite(id string) error {
+	delete(t.sites, id)
+	t.sitesDirty = true
+	return nil
+}
+
+func (t *jsonTx) ListStreams() ([]models.Stream, error) {
+	list := make([]models.Stream, 0, len(t.streams))
+	for _, stream := range t.streams {
+		list = append(list, deepCopy(stream))
+	}
+	return list, nil
+}
+
+func (t *jsonTx) GetStream(id string) (*models.Stream, error) {
+	stream, ok := t.streams[id]
+	if !ok {
+		return nil, fmt.Errorf("stream not found: %s", id)
+	}
+	stream = deepCopy(stream)
+	return &stream, nil
+}
+
+func (t *jsonTx) SaveStream(stream *models.Stream) error {
+	t.streams[stream.ID] = deepCopy(*stream)
+	t.streamsDirty = true
+	return nil
+}
+
+func (t *jsonTx) DeleteStream(id string) error {
+	delete(t.streams, id)
+	t.streamsDirty = true
+	return nil
+}
+
+func (t *jsonTx) ListAPIKeys() ([]models.APIKey, error) {
+	list := make([]models.APIKey, 0, len(t.apiKeys))
+	for _, key := range t.apiKeys {
+		list = append(list, deepCopy(key))
+	}
+	return list, nil
+}
+
+func (t *jsonTx) GetAPIKey(id string) (*models.APIKey, error) {
+	key, ok := t.apiKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("api key not found: %s", id)
+	}
+	key = deepCopy(key)
+	return &key, nil
+}
+
+func (t *jsonTx) SaveAPIKey(key *models.APIKey) error {
+	t.apiKeys[key.ID] = deepCopy(*key)
+	t.apiKeysDirty = true
+	return nil
+}
+
+func (t *jsonTx) DeleteAPIKey(id string) error {
+	delete(t.apiKeys, id)
+	t.apiKeysDirty = true
+	return nil
+}
+
+// WithTx on a transaction joins the enclosing transaction.
+func (t *jsonTx) WithTx(fn func(tx Store) error) error {
+	return fn(t)
+}
+
+// deepCopy copies v through its JSON form, which is exactly what the store
+// keeps of it.
+func deepCopy[T any](v T) T {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("store: copy %T: %v", v, err))
+	}
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		panic(fmt.Sprintf("store: copy %T: %v", v, err))
+	}
+	return out
+}
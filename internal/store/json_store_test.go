@@ -0,0 +1,106 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestJSONStoreWithTx(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	st, err := NewJSONStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveSite(&models.Site{ID: "keep", Domain: "keep.local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rollback: nothing written inside a failed transaction survives
+	errBoom := errors.New("boom")
+	err = st.WithTx(func(tx Store) error {
+		if err := tx.SaveSite(&models.Site{ID: "new", Domain: "new.local"}); err != nil {
+			return err
+		}
+		if err := tx.DeleteSite("keep"); err != nil {
+			return err
+		}
+		if err := tx.SaveStream(&models.Stream{ID: "s1", ListenPort: 30001}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Expected callback error, got %v", err)
+	}
+	if _, err := st.GetSite("new"); err == nil {
+		t.Errorf("Rolled back site should not exist")
+	}
+	if _, err := st.GetSite("keep"); err != nil {
+		t.Errorf("Rolled back delete should keep site: %v", err)
+	}
+	if streams, _ := st.ListStreams(); len(streams) != 0 {
+		t.Errorf("Rolled back stream should not exist")
+	}
+
+	// Commit: all writes become visible and are persisted
+	err = st.WithTx(func(tx Store) error {
+		if err := tx.SaveSite(&models.Site{ID: "new", Domain: "new.local"}); err != nil {
+			return err
+		}
+		return tx.SaveStream(&models.Stream{ID: "s1", ListenPort: 30001})
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+
+	reloaded, err := NewJSONStore(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.GetSite("new"); err != nil {
+		t.Errorf("Committed site missing after reload: %v", err)
+	}
+	if _, err := reloaded.GetStream("s1"); err != nil {
+		t.Errorf("Committed stream missing after reload: %v", err)
+	}
+}
+
+func TestJSONStoreWithTxCopies(t *testing.T) {
+	st, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SaveSite(&models.Site{ID: "a", Domain: "a.local", ACME: &models.ACMEConfig{EABKeyID: "kid"}, Upstreams: []string{"app:80"}})
+
+	// Mutating what a discarded transaction read must not leak out
+	errBoom := errors.New("boom")
+	saved := &models.Site{ID: "b", ACME: &models.ACMEConfig{EABKeyID: "kid"}}
+	st.WithTx(func(tx Store) error {
+		site, _ := tx.GetSite("a")
+		site.ACME.EABKeyID = "changed"
+		site.Upstreams[0] = "changed:80"
+		sites, _ := tx.ListSites()
+		sites[0].ACME.EABKeyID = "changed"
+		return errBoom
+	})
+	st.WithTx(func(tx Store) error {
+		tx.SaveSite(saved)
+		saved.ACME.EABKeyID = "changed"
+		return nil
+	})
+	site, _ := st.GetSite("a")
+	if site.ACME.EABKeyID != "kid" || site.Upstreams[0] != "app:80" {
+		t.Errorf("Discarded transaction changed the live site: %+v %v", site.ACME, site.Upstreams)
+	}
+	if site, _ := st.GetSite("b"); site.ACME.EABKeyID != "kid" {
+		t.Errorf("Changing a saved site after SaveSite changed the store: %+v", site.ACME)
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// PostgresDriver is the database/sql driver name used for PostgreSQL. The
+// driver itself is linked into the binary with the "postgres" build tag.
+const PostgresDriver = "pgx"
+
+// PostgresOptions tunes the connection pool.
+type PostgresOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnectTimeout is how long to keep retrying the initial connection,
+	// e.g. while the database container is still starting.
+	ConnectTimeout time.Duration
+}
+
+// DefaultPostgresOptions suit a handful of hubfly instances sharing one database.
+var DefaultPostgresOptions = PostgresOptions{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnectTimeout:  time.Minute,
+}
+
+// NewPostgresStore connects to the database at dsn and applies migrations.
+// Connections dropped later (e.g. a database restart) are re-established
+// by the pool on the next query.
+func NewPostgresStore(dsn string, opts PostgresOptions) (*SQLStore, error) {
+	if !slices.Contains(sql.Drivers(), PostgresDriver) {
+		return nil, fmt.Errorf("postgres support not compiled in; rebuild with -tags postgres")
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("postgres connection string is required")
+	}
+
+	db, err := sql.Open(PostgresDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	if err := waitForDB(db, opts.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s, err := newSQLStore(db, true)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// waitForDB pings with exponential backoff until the database answers.
+func waitForDB(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 500 * time.Millisecond
+	for {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("database unreachable: %w", err)
+		}
+		slog.Warn("Waiting for database", "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		if backoff < 8*time.Second {
+			backoff *= 2
+		}
+	}
+}
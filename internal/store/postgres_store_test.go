@@ -0,0 +1,58 @@
+//go:build postgres
+
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDSN is the database of the tests. They drop its hubfly tables,
+// so never point it at a database in use.
+func postgresDSN(t *testing.T) string {
+	dsn := os.Getenv("HUBFLY_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("HUBFLY_TEST_POSTGRES_DSN not set")
+	}
+	return dsn
+}
+
+func openTestPostgres(dsn string) (*SQLStore, error) {
+	opts := DefaultPostgresOptions
+	opts.ConnectTimeout = 5 * time.Second
+	return NewPostgresStore(dsn, opts)
+}
+
+// resetPostgres drops the tables, so every test starts from migration 1.
+func resetPostgres(t *testing.T, dsn string) {
+	s, err := openTestPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, table := range []string{"sites", "streams", "apikeys", "migration_test", "schema_migrations"} {
+		if _, err := s.db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := postgresDSN(t)
+	resetPostgres(t, dsn)
+	s, err := openTestPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testSQLStore(t, s)
+}
+
+func TestPostgresConcurrentMigrations(t *testing.T) {
+	dsn := postgresDSN(t)
+	resetPostgres(t, dsn)
+	testConcurrentMigrations(t, func() (*SQLStore, error) { return openTestPostgres(dsn) })
+}
@@ -0,0 +1,396 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// SQLStore implements Store on top of database/sql. Each resource is a row
+// holding the JSON-encoded model, so new model fields need no schema change.
+type SQLStore struct {
+	sqlQueries
+	db *sql.DB
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlQueries holds the Store methods shared by SQLStore and sqlTx.
+type sqlQueries struct {
+	q querier
+	// numbered rewrites "?" placeholders to "$1", "$2", ... (Postgres).
+	numbered bool
+}
+
+// sqlMigrations are applied in order; the version of a migration is its
+// index + 1. Never edit or reorder entries, only append.
+var sqlMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS sites (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS streams (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS apikeys (id TEXT PRIMARY KEY, data TEXT NOT NULL)`,
+}
+
+func newSQLStore(db *sql.DB, numbered bool) (*SQLStore, error) {
+	s := &SQLStore{sqlQueries: sqlQueries{q: db, numbered: numbered}, db: db}
+	if err := s.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	return s, nil
+}
+
+// SchemaVersion returns the highest applied migration.
+func (s *SQLStore) SchemaVersion() (int, error) {
+	var v sql.NullInt64
+	err := s.q.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&v)
+	return int(v.Int64), err
+}
+
+func (s *SQLStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(sqlMigrations); i++ {
+		version := i + 1
+		err := s.applyMigration(version, sqlMigrations[i])
+		if err != nil {
+			// Another instance sharing the database may have applied it first.
+			if v, verr := s.SchemaVersion(); verr == nil && v >= version {
+				continue
+			}
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) applyMigration(version int, stmt string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"),
+		version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping checks that the database is reachable.
+func (s *SQLStore) Ping() error {
+	return s.db.Ping()
+}
+
+// CompactResult reports a store compaction.
+type CompactResult struct {
+	Engine      string `json:"engine"` // "sqlite" or "postgres"
+	BytesBefore int64  `json:"bytes_before"`
+	BytesAfter  int64  `json:"bytes_after"`
+}
+
+// Compact reclaims the space of deleted and overwritten rows. SQLite
+// rebuilds the database file (VACUUM) and truncates its write-ahead log;
+// Postgres vacuums the tables, which makes the space reusable but rarely
+// shrinks them.
+func (s *SQLStore) Compact() (*CompactResult, error) {
+	res := &CompactResult{Engine: "sqlite"}
+	size, vacuum := s.sqliteSize, []string{"VACUUM", "PRAGMA wal_checkpoint(TRUNCATE)"}
+	if s.numbered {
+		res.Engine = "postgres"
+		size, vacuum = s.postgresSize, []string{"VACUUM sites, streams, apikeys"}
+	}
+	var err error
+	if res.BytesBefore, err = size(); err != nil {
+		return nil, err
+	}
+	for _, stmt := range vacuum {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	if res.BytesAfter, err = size(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *SQLStore) sqliteSize() (int64, error) {
+	var pages, pageSize int64
+	if err := s.db.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+func (s *SQLStore) postgresSize() (int64, error) {
+	var size int64
+	err := s.db.QueryRow("SELECT pg_total_relation_size('sites') + pg_total_relation_size('streams') + pg_total_relation_size('apikeys')").Scan(&size)
+	return size, err
+}
+
+// Close releases the underlying database.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// Empty reports whether the store holds no sites, streams or API keys.
+func (s *SQLStore) Empty() (bool, error) {
+	for _, table := range []string{"sites", "streams", "apikeys"} {
+		var n int
+		if err := s.q.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *SQLStore) WithTx(fn func(tx Store) error) error {
+	dbTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqlTx{sqlQueries{q: dbTx, numbered: s.numbered}}); err != nil {
+		dbTx.Rollback()
+		return err
+	}
+	return dbTx.Commit()
+}
+
+// sqlTx is the Store view handed to WithTx callbacks.
+type sqlTx struct {
+	sqlQueries
+}
+
+// WithTx on a transaction joins the outer transaction.
+func (t *sqlTx) WithTx(fn func(tx Store) error) error {
+	return fn(t)
+}
+
+func (s sqlQueries) rebind(query string) string {
+	if !s.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s sqlQueries) list(table string, each func(data []byte) error) error {
+	rows, err := s.q.Query("SELECT data FROM " + table + " ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := each(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// get decodes a row into out, returning false when it does not exist.
+func (s sqlQueries) get(table, id string, out interface{}) (bool, error) {
+	var data []byte
+	err := s.q.QueryRow(s.rebind("SELECT data FROM "+table+" WHERE id = ?"), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+func (s sqlQueries) put(table, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.Exec(s.rebind("INSERT INTO "+table+" (id, data) VALUES (?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET data = excluded.data"), id, string(data))
+	return err
+}
+
+func (s sqlQueries) delete(table, id string) error {
+	_, err := s.q.Exec(s.rebind("DELETE FROM "+table+" WHERE id = ?"), id)
+	return err
+}
+
+// Site Methods
+
+func (s sqlQueries) ListSites() ([]models.Site, error) {
+	list := []models.Site{}
+	err := s.list("sites", func(data []byte) error {
+		var site models.Site
+		if err := json.Unmarshal(data, &site); err != nil {
+			return err
+		}
+		list = append(list, site)
+		return nil
+	})
+	return list, err
+}
+
+func (s sqlQueries) GetSite(id string) (*models.Site, error) {
+	var site models.Site
+	ok, err := s.get("sites", id, &site)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("site not found: %s", id)
+	}
+	return &site, nil
+}
+
+func (s sqlQueries) SaveSite(site *models.Site) error {
+	return s.put("sites", site.ID, site)
+}
+
+func (s sqlQueries) DeleteSite(id string) error {
+	return s.delete("sites", id)
+}
+
+// Stream Methods
+
+func (s sqlQueries) ListStreams() ([]models.Stream, error) {
+	list := []models.Stream{}
+	err := s.list("streams", func(data []byte) error {
+		var stream models.Stream
+		if err := json.Unmarshal(data, &stream); err != nil {
+			return err
+		}
+		list = append(list, stream)
+		return nil
+	})
+	return list, err
+}
+
+func (s sqlQueries) GetStream(id string) (*models.Stream, error) {
+	var stream models.Stream
+	ok, err := s.get("streams", id, &stream)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("stream not found: %s", id)
+	}
+	return &stream, nil
+}
+
+func (s sqlQueries) SaveStream(stream *models.Stream) error {
+	return s.put("streams", stream.ID, stream)
+}
+
+func (s sqlQueries) DeleteStream(id string) error {
+	return s.delete("streams", id)
+}
+
+// API Key Methods
+
+func (s sqlQueries) ListAPIKeys() ([]models.APIKey, error) {
+	list := []models.APIKey{}
+	err := s.list("apikeys", func(data []byte) error {
+		var key models.APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		list = append(list, key)
+		return nil
+	})
+	return list, err
+}
+
+func (s sqlQueries) GetAPIKey(id string) (*models.APIKey, error) {
+	var key models.APIKey
+	ok, err := s.get("apikeys", id, &key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("api key not found: %s", id)
+	}
+	return &key, nil
+}
+
+func (s sqlQueries) SaveAPIKey(key *models.APIKey) error {
+	return s.put("apikeys", key.ID, key)
+}
+
+func (s sqlQueries) DeleteAPIKey(id string) error {
+	return s.delete("apikeys", id)
+}
+
+// MigrateFromJSON copies everything in the JSON store at dir into dst in a
+// single transaction. It returns the number of records copied.
+func MigrateFromJSON(dst Store, dir string) (int, error) {
+	src, err := NewJSONStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	sites, _ := src.ListSites()
+	streams, _ := src.ListStreams()
+	keys, _ := src.ListAPIKeys()
+
+	err = dst.WithTx(func(tx Store) error {
+		for i := range sites {
+			if err := tx.SaveSite(&sites[i]); err != nil {
+				return fmt.Errorf("site %s: %w", sites[i].ID, err)
+			}
+		}
+		for i := range streams {
+			if err := tx.SaveStream(&streams[i]); err != nil {
+				return fmt.Errorf("stream %s: %w", streams[i].ID, err)
+			}
+		}
+		for i := range keys {
+			if err := tx.SaveAPIKey(&keys[i]); err != nil {
+				return fmt.Errorf("api key %s: %w", keys[i].ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(sites) + len(streams) + len(keys), nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestSQLRebind(t *testing.T) {
+	q := sqlQueries{numbered: true}
+	got := q.rebind("INSERT INTO sites (id, data) VALUES (?, ?)")
+	if want := "INSERT INTO sites (id, data) VALUES ($1, $2)"; got != want {
+		t.Errorf("rebind = %q, want %q", got, want)
+	}
+
+	q.numbered = false
+	if got := q.rebind("DELETE FROM sites WHERE id = ?"); got != "DELETE FROM sites WHERE id = ?" {
+		t.Errorf("Unnumbered rebind changed query: %q", got)
+	}
+}
+
+// testSQLStore runs the Store methods against a migrated SQL store. The
+// driver specific tests call it, as their drivers need build tags.
+func testSQLStore(t *testing.T, s *SQLStore) {
+	t.Helper()
+	if v, err := s.SchemaVersion(); err != nil || v != len(sqlMigrations) {
+		t.Fatalf("SchemaVersion = %d, %v; want %d", v, err, len(sqlMigrations))
+	}
+	if empty, err := s.Empty(); err != nil || !empty {
+		t.Fatalf("Expected an empty store: %v %v", empty, err)
+	}
+
+	site := &models.Site{ID: "a", Domain: "a.example.com", ACME: &models.ACMEConfig{EABKeyID: "kid"}}
+	if err := s.SaveSite(site); err != nil {
+		t.Fatal(err)
+	}
+	site.Domain = "b.example.com"
+	if err := s.SaveSite(site); err != nil {
+		t.Fatalf("Saving an existing site failed: %v", err)
+	}
+	got, err := s.GetSite("a")
+	if err != nil || got.Domain != "b.example.com" || got.ACME == nil || got.ACME.EABKeyID != "kid" {
+		t.Errorf("GetSite = %+v, %v", got, err)
+	}
+	if _, err := s.GetSite("missing"); err == nil {
+		t.Error("Expected an error for a missing site")
+	}
+	if err := s.SaveStream(&models.Stream{ID: "db", ListenPort: 30001, Upstream: "db:5432"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAPIKey(&models.APIKey{ID: "k", Role: models.RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	sites, _ := s.ListSites()
+	streams, _ := s.ListStreams()
+	keys, _ := s.ListAPIKeys()
+	if len(sites) != 1 || len(streams) != 1 || len(keys) != 1 {
+		t.Errorf("Expected one of each, got %d sites, %d streams, %d keys", len(sites), len(streams), len(keys))
+	}
+
+	// Rollback, then commit
+	errBoom := errors.New("boom")
+	err = s.WithTx(func(tx Store) error {
+		tx.DeleteSite("a")
+		tx.SaveStream(&models.Stream{ID: "new", ListenPort: 30002})
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+	if _, err := s.GetSite("a"); err != nil {
+		t.Errorf("Rolled back delete removed the site: %v", err)
+	}
+	if _, err := s.GetStream("new"); err == nil {
+		t.Error("Rolled back stream exists")
+	}
+	err = s.WithTx(func(tx Store) error {
+		if err := tx.DeleteSite("a"); err != nil {
+			return err
+		}
+		if err := tx.DeleteStream("db"); err != nil {
+			return err
+		}
+		return tx.DeleteAPIKey("k")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty, err := s.Empty(); err != nil || !empty {
+		t.Errorf("Expected an empty store after deleting everything: %v %v", empty, err)
+	}
+}
+
+// testConcurrentMigrations opens stores at once on a migrated database
+// while a new migration is pending, as instances sharing a database do on
+// upgrade. Every one must start, and the migration run once.
+func testConcurrentMigrations(t *testing.T, open func() (*SQLStore, error)) {
+	t.Helper()
+	first, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	orig := sqlMigrations
+	sqlMigrations = append(slices.Clip(orig), `CREATE TABLE migration_test (id TEXT PRIMARY KEY)`)
+	defer func() {
+		sqlMigrations = orig
+		first.db.Exec(`DROP TABLE IF EXISTS migration_test`)
+		first.db.Exec(first.rebind(`DELETE FROM schema_migrations WHERE version > ?`), len(orig))
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := open()
+			if err == nil {
+				s.Close()
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Concurrent start failed: %v", err)
+		}
+	}
+	var n int
+	if err := first.db.QueryRow(first.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), len(sqlMigrations)).Scan(&n); err != nil || n != 1 {
+		t.Errorf("Migration %d recorded %d times: %v", len(sqlMigrations), n, err)
+	}
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// SQLiteDriver is the database/sql driver name used for SQLite. The driver
+// itself is linked into the binary with the "sqlite" build tag.
+const SQLiteDriver = "sqlite"
+
+// NewSQLiteStore opens (or creates) the SQLite database at path.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		return nil, fmt.Errorf("sqlite support not compiled in; rebuild with -tags sqlite")
+	}
+
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serializing on one connection avoids
+	// SQLITE_BUSY between the API handlers and background workers.
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA busy_timeout = 5000",
+	} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure sqlite: %w", err)
+		}
+	}
+
+	s, err := newSQLStore(db, false)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,40 @@
+//go:build sqlite
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hubfly.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSQLStore(t, s)
+
+	// Reopening keeps the data and applies no migration twice
+	s.SaveSite(&models.Site{ID: "kept", Domain: "kept.example.com"})
+	s.Close()
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer s.Close()
+	if _, err := s.GetSite("kept"); err != nil {
+		t.Errorf("Site lost on reopen: %v", err)
+	}
+	if v, _ := s.SchemaVersion(); v != len(sqlMigrations) {
+		t.Errorf("SchemaVersion = %d after reopen", v)
+	}
+}
+
+func TestSQLiteConcurrentMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hubfly.db")
+	testConcurrentMigrations(t, func() (*SQLStore, error) { return NewSQLiteStore(path) })
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// DefaultWatchHistory is how many change events a WatchStore keeps for
+// watchers resuming from an older revision.
+const DefaultWatchHistory = 1000
+
+// Watched resources.
+const (
+	ResourceSites   = "sites"
+	ResourceStreams = "streams"
+)
+
+// Change types.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// ChangeEvent is one committed write. Object is the saved site or stream as
+// it was written, with secrets redacted; deletions only carry the ID.
+type ChangeEvent struct {
+	Revision uint64      `json:"revision"`
+	Resource string      `json:"resource"`
+	Type     string      `json:"type"`
+	ID       string      `json:"id"`
+	Time     time.Time   `json:"time"`
+	Object   interface{} `json:"object,omitempty"`
+}
+
+// WatchStore wraps a Store and numbers every site and stream write with a
+// revision, keeping the latest events so watchers can resume where they
+// left off. Revisions start from the process start time in microseconds,
+// so they keep increasing across restarts, but the history itself is in
+// memory: a watcher resuming from before a restart must list again.
+type WatchStore struct {
+	Store
+	history int
+	writes  sync.Mutex
+
+	mu      sync.Mutex
+	base    uint64 // Revision before the first event of this process
+	rev     uint64
+	events  []ChangeEvent
+	changed chan struct{} // Closed and replaced on every publish
+}
+
+func NewWatchStore(s Store) *WatchStore {
+	base := uint64(time.Now().UnixMicro())
+	return &WatchStore{Store: s, history: DefaultWatchHistory, base: base, rev: base, changed: make(chan struct{})}
+}
+
+// Ping forwards to the wrapped store when it supports health checks.
+func (s *WatchStore) Ping() error {
+	if p, ok := s.Store.(interface{ Ping() error }); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// Compact forwards to the wrapped store. It returns nil when the store has
+// nothing to compact, like the JSON store, which rewrites its files whole.
+func (s *WatchStore) Compact() (*CompactResult, error) {
+	if c, ok := s.Store.(interface {
+		Compact() (*CompactResult, error)
+	}); ok {
+		return c.Compact()
+	}
+	return nil, nil
+}
+
+// Revision is the revision of the latest write.
+func (s *WatchStore) Revision() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rev
+}
+
+// Since returns the events after revision rev and a channel that is closed
+// on the next write. ok is false when rev can't be resumed from: it is
+// older than the kept history, from before a restart, or in the future.
+func (s *WatchStore) Since(rev uint64) (events []ChangeEvent, changed <-chan struct{}, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldest := s.base
+	if len(s.events) > 0 {
+		oldest = s.events[0].Revision - 1
+	}
+	if rev < oldest || rev > s.rev {
+		return nil, s.changed, false
+	}
+	i := len(s.events)
+	for i > 0 && s.events[i-1].Revision > rev {
+		i--
+	}
+	events = append(events, s.events[i:]...)
+	return events, s.changed, true
+}
+
+func (s *WatchStore) publish(events ...ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, e := range events {
+		s.rev++
+		e.Revision, e.Time = s.rev, now
+		s.events = append(s.events, e)
+	}
+	if n := len(s.events) - s.history; n > 0 {
+		s.events = append([]ChangeEvent(nil), s.events[n:]...)
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *WatchStore) SaveSite(site *models.Site) error {
+	return s.write(func(tx *watchTx) error { return tx.SaveSite(site) })
+}
+
+func (s *WatchStore) DeleteSite(id string) error {
+	return s.write(func(tx *watchTx) error { return tx.DeleteSite(id) })
+}
+
+func (s *WatchStore) SaveStream(stream *models.Stream) error {
+	return s.write(func(tx *watchTx) error { return tx.SaveStream(stream) })
+}
+
+func (s *WatchStore) DeleteStream(id string) error {
+	return s.write(func(tx *watchTx) error { return tx.DeleteStream(id) })
+}
+
+// WithTx publishes the transaction's writes, in order, once it commits.
+func (s *WatchStore) WithTx(fn func(tx Store) error) error {
+	return s.write(func(w *watchTx) error {
+		return s.Store.WithTx(func(tx Store) error {
+			*w.pending = nil // A retried transaction starts over
+			return fn(&watchTx{Store: tx, pending: w.pending})
+		})
+	})
+}
+
+// write runs fn against the wrapped store and publishes what it wrote if
+// it succeeds. Writes are serialised so revisions follow commit order.
+func (s *WatchStore) write(fn func(tx *watchTx) error) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	var pending []ChangeEvent
+	if err := fn(&watchTx{Store: s.Store, pending: &pending}); err != nil {
+		return err
+	}
+	s.publish(pending...)
+	return nil
+}
+
+// watchTx records the writes of a transaction instead of publishing them.
+type watchTx struct {
+	Store
+	pending *[]ChangeEvent
+}
+
+func (t *watchTx) SaveSite(site *models.Site) error {
+	e, err := saveSite(t.Store, site)
+	if err == nil {
+		*t.pending = append(*t.pending, e)
+	}
+	return err
+}
+
+func (t *watchTx) DeleteSite(id string) error {
+	err := t.Store.DeleteSite(id)
+	if err == nil {
+		*t.pending = append(*t.pending, ChangeEvent{Resource: ResourceSites, Type: ChangeDeleted, ID: id})
+	}
+	return err
+}
+
+func (t *watchTx) SaveStream(stream *models.Stream) error {
+	e, err := saveStream(t.Store, stream)
+	if err == nil {
+		*t.pending = append(*t.pending, e)
+	}
+	return err
+}
+
+func (t *watchTx) DeleteStream(id string) error {
+	err := t.Store.DeleteStream(id)
+	if err == nil {
+		*t.pending = append(*t.pending, ChangeEvent{Resource: ResourceStreams, Type: ChangeDeleted, ID: id})
+	}
+	return err
+}
+
+func (t *watchTx) WithTx(fn func(tx Store) error) error {
+	return fn(t)
+}
+
+func saveSite(st Store, site *models.Site) (ChangeEvent, error) {
+	e := ChangeEvent{Resource: ResourceSites, Type: ChangeUpdated, ID: site.ID}
+	if _, err := st.GetSite(site.ID); err != nil {
+		e.Type = ChangeCreated
+	}
+	if err := st.SaveSite(site); err != nil {
+		return e, err
+	}
+	e.Object = snapshot(site.Redacted())
+	return e, nil
+}
+
+func saveStream(st Store, stream *models.Stream) (ChangeEvent, error) {
+	e := ChangeEvent{Resource: ResourceStreams, Type: ChangeUpdated, ID: stream.ID}
+	if _, err := st.GetStream(stream.ID); err != nil {
+		e.Type = ChangeCreated
+	}
+	if err := st.SaveStream(stream); err != nil {
+		return e, err
+	}
+	e.Object = snapshot(stream)
+	return e, nil
+}
+
+// snapshot freezes an object as JSON: callers keep using what they saved.
+func snapshot(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
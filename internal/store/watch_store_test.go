@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestWatchStore(t *testing.T) {
+	js, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewWatchStore(js)
+	start := st.Revision()
+
+	events, changed, ok := st.Since(start)
+	if !ok || len(events) != 0 {
+		t.Fatalf("Expected no events yet, got %v, %v", events, ok)
+	}
+	st.SaveSite(&models.Site{ID: "a", Domain: "a.local"})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("Expected a write to wake watchers")
+	}
+	st.SaveSite(&models.Site{ID: "a", Domain: "a.example.com"})
+	st.WithTx(func(tx Store) error {
+		tx.DeleteSite("a")
+		return tx.SaveStream(&models.Stream{ID: "s", ListenPort: 5432})
+	})
+	st.WithTx(func(tx Store) error {
+		tx.SaveSite(&models.Site{ID: "b", Domain: "b.local"})
+		return errors.New("rolled back")
+	})
+
+	events, _, _ = st.Since(start)
+	want := []string{"sites created a", "sites updated a", "sites deleted a", "streams created s"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, e := range events {
+		if got := e.Resource + " " + e.Type + " " + e.ID; got != want[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, want[i], got)
+		}
+		if e.Revision != start+uint64(i)+1 {
+			t.Errorf("Event %d: expected revision %d, got %d", i, start+uint64(i)+1, e.Revision)
+		}
+	}
+
+	events, _, _ = st.Since(start + 2)
+	if len(events) != 2 || events[0].Type != ChangeDeleted {
+		t.Errorf("Expected to resume after the update, got %+v", events)
+	}
+
+	st.history = 2
+	st.SaveSite(&models.Site{ID: "c", Domain: "c.local"})
+	if _, _, ok := st.Since(start); ok {
+		t.Error("Expected a revision older than the history to need a re-list")
+	}
+	if _, _, ok := st.Since(st.Revision() + 1); ok {
+		t.Error("Expected a future revision to be refused")
+	}
+}
@@ -0,0 +1,163 @@
+package synthetic
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder appends check results to a JSON-lines file per site.
+type Recorder struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{dir: dir}
+}
+
+func (r *Recorder) file(siteID string) string {
+	return filepath.Join(r.dir, siteID+".jsonl")
+}
+
+// Record appends a result of one of the site's checks. A nil Recorder
+// discards results.
+func (r *Recorder) Record(siteID string, res Result) error {
+	if r == nil {
+		return nil
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.file(siteID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Results returns the site's results since a time, oldest first.
+func (r *Recorder) Results(siteID string, since time.Time) ([]Result, error) {
+	if r == nil {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read(siteID, since)
+}
+
+func (r *Recorder) read(siteID string, since time.Time) ([]Result, error) {
+	f, err := os.Open(r.file(siteID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []Result
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var res Result
+		if json.Unmarshal(sc.Bytes(), &res) != nil || res.Time.Before(since) {
+			continue
+		}
+		results = append(results, res)
+	}
+	return results, sc.Err()
+}
+
+// Prune drops results older than before from every site's file.
+func (r *Recorder) Prune(before time.Time) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		siteID, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok {
+			continue
+		}
+		results, err := r.read(siteID, before)
+		if err != nil {
+			return err
+		}
+		var out []byte
+		for _, res := range results {
+			data, _ := json.Marshal(res)
+			out = append(append(out, data...), '\n')
+		}
+		tmp := r.file(siteID) + ".tmp"
+		if err := os.WriteFile(tmp, out, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, r.file(siteID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forget deletes the results of a site.
+func (r *Recorder) Forget(siteID string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Remove(r.file(siteID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Uptime summarizes a check's results over a window.
+type Uptime struct {
+	Runs       int     `json:"runs"`
+	Failures   int     `json:"failures"`
+	Percent    float64 `json:"percent"` // Share of passing runs; 100 with no runs
+	AvgLatency int64   `json:"avg_latency_ms"`
+}
+
+// Summarize computes the uptime of one check from results since a time.
+func Summarize(results []Result, check string, since time.Time) Uptime {
+	u := Uptime{Percent: 100}
+	var latency int64
+	for _, res := range results {
+		if res.Check != check || res.Time.Before(since) {
+			continue
+		}
+		u.Runs++
+		latency += res.Latency
+		if !res.OK {
+			u.Failures++
+		}
+	}
+	if u.Runs > 0 {
+		u.Percent = float64(u.Runs-u.Failures) * 100 / float64(u.Runs)
+		u.AvgLatency = latency / int64(u.Runs)
+	}
+	return u
+}
@@ -0,0 +1,183 @@
+// Package synthetic runs scheduled requests against sites through nginx
+// and keeps their results as uptime data.
+package synthetic
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// Defaults for checks that leave a setting out.
+const (
+	DefaultInterval      = 60 * time.Second
+	DefaultTimeout       = 10 * time.Second
+	DefaultFailThreshold = 2
+
+	// MinInterval keeps a check from hammering its site.
+	MinInterval = 10 * time.Second
+
+	// maxBody is how much of a response ExpectBody is searched in.
+	maxBody = 1 << 20
+)
+
+var checkName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Validate checks a site's synthetic checks.
+func Validate(checks []models.SyntheticCheck) error {
+	seen := map[string]bool{}
+	for _, c := range checks {
+		if !checkName.MatchString(c.Name) {
+			return fmt.Errorf("synthetic check name %q must be letters, digits, '.', '_' and '-'", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("synthetic check %q is defined twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Path != "" && (!strings.HasPrefix(c.Path, "/") || strings.ContainsAny(c.Path, " \t\r\n#")) {
+			return fmt.Errorf("synthetic check %s: path %q must start with / and contain no spaces", c.Name, c.Path)
+		}
+		for _, code := range c.ExpectStatus {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("synthetic check %s: expect_status %d is not an HTTP status code", c.Name, code)
+			}
+		}
+		if c.Interval != 0 && time.Duration(c.Interval)*time.Second < MinInterval {
+			return fmt.Errorf("synthetic check %s: interval_seconds must be at least %d", c.Name, int(MinInterval.Seconds()))
+		}
+		if c.Timeout < 0 || c.FailThreshold < 0 {
+			return fmt.Errorf("synthetic check %s: timeout_seconds and fail_threshold must not be negative", c.Name)
+		}
+		if c.Interval != 0 && c.Timeout >= c.Interval {
+			return fmt.Errorf("synthetic check %s: timeout_seconds must be shorter than interval_seconds", c.Name)
+		}
+	}
+	return nil
+}
+
+// Interval is how often c runs.
+func Interval(c models.SyntheticCheck) time.Duration {
+	if c.Interval > 0 {
+		return time.Duration(c.Interval) * time.Second
+	}
+	return DefaultInterval
+}
+
+// FailThreshold is how many failures in a row take c down.
+func FailThreshold(c models.SyntheticCheck) int {
+	if c.FailThreshold > 0 {
+		return c.FailThreshold
+	}
+	return DefaultFailThreshold
+}
+
+// Result is one run of a check.
+type Result struct {
+	Time    time.Time `json:"time"`
+	Check   string    `json:"check"`
+	OK      bool      `json:"ok"`
+	Status  int       `json:"status,omitempty"`
+	Latency int64     `json:"latency_ms"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Target is where checks, and cache warming requests, are sent: nginx's
+// listeners on this host.
+type Target struct {
+	HTTPAddr  string
+	HTTPSAddr string
+}
+
+// DefaultTarget is nginx's listeners on the loopback address.
+var DefaultTarget = Target{HTTPAddr: "127.0.0.1:80", HTTPSAddr: "127.0.0.1:443"}
+
+// Run sends c to host through the target's listener, over HTTPS when
+// secure, and judges the answer. Redirects are not followed: a check of a
+// force_ssl site over plain HTTP expects its 301.
+func (t Target) Run(ctx context.Context, host string, secure bool, c models.SyntheticCheck) Result {
+	timeout := DefaultTimeout
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout) * time.Second
+	}
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	client := t.Client(secure, timeout, c.SkipTLSVerify)
+
+	res := Result{Time: time.Now(), Check: c.Name}
+	start := time.Now()
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", "hubfly-synthetic")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		res.Status = resp.StatusCode
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return err
+		}
+		if !statusOK(resp.StatusCode, c.ExpectStatus) {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		if c.ExpectBody != "" && !strings.Contains(string(body), c.ExpectBody) {
+			return fmt.Errorf("body does not contain %q", c.ExpectBody)
+		}
+		return nil
+	}()
+	res.Latency = time.Since(start).Milliseconds()
+	res.OK = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Client returns a client that sends every request to the target's HTTP
+// listener or, when secure, its HTTPS one, whatever the URL's host; the
+// host still picks the nginx server and is sent as SNI. Redirects are not
+// followed.
+func (t Target) Client(secure bool, timeout time.Duration, skipVerify bool) *http.Client {
+	addr := t.HTTPAddr
+	if secure {
+		addr = t.HTTPSAddr
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: skipVerify},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+func statusOK(code int, expect []int) bool {
+	if len(expect) == 0 {
+		return code >= 200 && code < 400
+	}
+	return slices.Contains(expect, code)
+}
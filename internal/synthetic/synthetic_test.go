@@ -0,0 +1,101 @@
+package synthetic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+func TestRun(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "shop.local" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte("<h1>Welcome to the shop</h1>"))
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	target := Target{HTTPAddr: strings.TrimPrefix(srv.URL, "http://"), HTTPSAddr: strings.TrimPrefix(tlsSrv.URL, "https://")}
+	ctx := context.Background()
+
+	res := target.Run(ctx, "shop.local", false, models.SyntheticCheck{Name: "home", ExpectBody: "Welcome"})
+	if !res.OK || res.Status != 200 || res.Check != "home" {
+		t.Errorf("Expected the check to pass, got %+v", res)
+	}
+	if res := target.Run(ctx, "shop.local", false, models.SyntheticCheck{Name: "home", ExpectBody: "Sold out"}); res.OK {
+		t.Errorf("Expected a missing string to fail, got %+v", res)
+	}
+	if res := target.Run(ctx, "other.local", false, models.SyntheticCheck{Name: "home"}); res.OK || res.Status != 404 {
+		t.Errorf("Expected the Host header to reach the server, got %+v", res)
+	}
+	if res := target.Run(ctx, "other.local", false, models.SyntheticCheck{Name: "home", ExpectStatus: []int{404}}); !res.OK {
+		t.Errorf("Expected an expected 404 to pass, got %+v", res)
+	}
+
+	// The test certificate is not valid for shop.local.
+	if res := target.Run(ctx, "shop.local", true, models.SyntheticCheck{Name: "tls"}); res.OK {
+		t.Errorf("Expected certificate verification to fail, got %+v", res)
+	}
+	if res := target.Run(ctx, "shop.local", true, models.SyntheticCheck{Name: "tls", SkipTLSVerify: true}); !res.OK {
+		t.Errorf("Expected the check to pass without verification, got %+v", res)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]models.SyntheticCheck{{Name: "home"}, {Name: "api", Path: "/api/health", Interval: 30, Timeout: 5}}); err != nil {
+		t.Errorf("Expected valid checks, got %v", err)
+	}
+	for _, bad := range [][]models.SyntheticCheck{
+		{{Name: ""}},
+		{{Name: "a|b"}},
+		{{Name: "home"}, {Name: "home"}},
+		{{Name: "home", Path: "api"}},
+		{{Name: "home", ExpectStatus: []int{99}}},
+		{{Name: "home", Interval: 5}},
+		{{Name: "home", Interval: 30, Timeout: 30}},
+	} {
+		if err := Validate(bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder(t.TempDir())
+	now := time.Now()
+	for i, ok := range []bool{true, false, true, true} {
+		rec.Record("shop", Result{Time: now.Add(time.Duration(i-3) * time.Hour), Check: "home", OK: ok, Latency: 10})
+	}
+	rec.Record("shop", Result{Time: now, Check: "api", OK: false})
+
+	results, err := rec.Results("shop", time.Time{})
+	if err != nil || len(results) != 5 {
+		t.Fatalf("Expected 5 results, got %d, %v", len(results), err)
+	}
+	if u := Summarize(results, "home", time.Time{}); u.Runs != 4 || u.Failures != 1 || u.Percent != 75 || u.AvgLatency != 10 {
+		t.Errorf("Unexpected uptime %+v", u)
+	}
+	if u := Summarize(results, "missing", time.Time{}); u.Runs != 0 || u.Percent != 100 {
+		t.Errorf("Expected full uptime without runs, got %+v", u)
+	}
+
+	if err := rec.Prune(now.Add(-90 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	results, _ = rec.Results("shop", time.Time{})
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results after pruning, got %d", len(results))
+	}
+	rec.Forget("shop")
+	if results, _ = rec.Results("shop", time.Time{}); len(results) != 0 {
+		t.Errorf("Expected no results after Forget, got %d", len(results))
+	}
+}
@@ -0,0 +1,517 @@
+// Package yaml converts JSON documents to YAML and back, for API clients
+// that keep hubfly's configuration in YAML files.
+//
+// It covers the block style hubfly writes (mappings, sequences, literal
+// "|" strings) plus plain, quoted and JSON flow scalars. Anchors, tags,
+// multi-document streams and folded ">" strings are not supported.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// node is a JSON value with the order of object keys kept.
+type node struct {
+	scalar string // JSON literal, for anything but objects and arrays
+	object bool
+	array  bool
+	keys   []string
+	items  []*node
+}
+
+var (
+	plainKey   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// Words YAML 1.1 readers take for booleans or null, quoted when they are
+// keys.
+var reservedWords = map[string]bool{
+	"true": true, "false": true, "null": true, "yes": true, "no": true,
+	"on": true, "off": true, "y": true, "n": true,
+}
+
+// FromJSON converts a JSON document to YAML, keeping the order of keys.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	n, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	var buf bytes.Buffer
+	switch {
+	case n.object && len(n.keys) > 0:
+		writeObject(&buf, n, 0)
+	case n.array && len(n.items) > 0:
+		writeArray(&buf, n, 0)
+	default:
+		buf.WriteString(inline(n) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeJSON(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &node{object: t == '{', array: t == '['}
+		for dec.More() {
+			if n.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			item, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case json.Number:
+		return &node{scalar: t.String()}, nil
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		return &node{scalar: string(b)}, nil
+	}
+}
+
+// block reports whether n is written on the lines below its key or dash.
+func (n *node) block() bool {
+	return (n.object || n.array) && len(n.items) > 0 || literal(n) != ""
+}
+
+func writeObject(buf *bytes.Buffer, n *node, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i, key := range n.keys {
+		buf.WriteString(pad + yamlKey(key) + ":")
+		writeValue(buf, n.items[i], indent)
+	}
+}
+
+func writeArray(buf *bytes.Buffer, n *node, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range n.items {
+		switch {
+		case item.object && len(item.items) > 0:
+			// The first key goes on the dash's line.
+			var first bytes.Buffer
+			writeObject(&first, item, indent+2)
+			buf.WriteString(pad + "- " + strings.TrimPrefix(first.String(), pad+"  "))
+		case item.block():
+			buf.WriteString(pad + "-")
+			writeValue(buf, item, indent)
+		default:
+			buf.WriteString(pad + "- " + inline(item) + "\n")
+		}
+	}
+}
+
+// writeValue writes the value of a key or dash at indent.
+func writeValue(buf *bytes.Buffer, n *node, indent int) {
+	switch {
+	case n.object && len(n.items) > 0:
+		buf.WriteString("\n")
+		writeObject(buf, n, indent+2)
+	case n.array && len(n.items) > 0:
+		buf.WriteString("\n")
+		writeArray(buf, n, indent+2)
+	case literal(n) != "":
+		s := literal(n)
+		pad := strings.Repeat(" ", indent+2)
+		if strings.HasSuffix(s, "\n") {
+			buf.WriteString(" |\n")
+			s = strings.TrimSuffix(s, "\n")
+		} else {
+			buf.WriteString(" |-\n")
+		}
+		for _, line := range strings.Split(s, "\n") {
+			if line != "" {
+				buf.WriteString(pad + line)
+			}
+			buf.WriteString("\n")
+		}
+	default:
+		buf.WriteString(" " + inline(n) + "\n")
+	}
+}
+
+// inline writes a scalar or an empty object or array on one line. Strings
+// stay JSON quoted, which YAML reads as double-quoted scalars.
+func inline(n *node) string {
+	switch {
+	case n.object:
+		return "{}"
+	case n.array:
+		return "[]"
+	}
+	return n.scalar
+}
+
+// literal returns the string n holds when it reads best as a "|" block:
+// several lines, without leading indentation, carriage returns, trailing
+// blanks or control characters. It returns "" for anything else.
+func literal(n *node) string {
+	if !strings.HasPrefix(n.scalar, `"`) {
+		return ""
+	}
+	var s string
+	if json.Unmarshal([]byte(n.scalar), &s) != nil {
+		return ""
+	}
+	body := strings.TrimSuffix(s, "\n")
+	if !strings.Contains(body, "\n") || strings.HasSuffix(body, "\n") || strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t") {
+		return ""
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			return ""
+		}
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f || r == '\ufeff' {
+			return ""
+		}
+	}
+	return s
+}
+
+func yamlKey(key string) string {
+	if plainKey.MatchString(key) && !reservedWords[strings.ToLower(key)] {
+		return key
+	}
+	b, _ := json.Marshal(key)
+	return string(b)
+}
+
+// line is a line of YAML without its indentation.
+type line struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parser reads YAML line by line.
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// ToJSON converts a YAML document to JSON, keeping the order of keys.
+func ToJSON(data []byte) ([]byte, error) {
+	p := &parser{}
+	for i, raw := range strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, line{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) && p.lines[p.pos].text == "---" {
+		p.pos++
+		p.skipBlank()
+	}
+	if p.pos == len(p.lines) {
+		return []byte("null"), nil
+	}
+	n, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].text != "..." {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	var buf bytes.Buffer
+	writeJSON(&buf, n)
+	return buf.Bytes(), nil
+}
+
+// skipBlank moves past blank and comment lines.
+func (p *parser) skipBlank() {
+	for p.pos < len(p.lines) && (p.lines[p.pos].text == "" || strings.HasPrefix(p.lines[p.pos].text, "#")) {
+		p.pos++
+	}
+}
+
+func isDash(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock reads the mapping, sequence or scalar starting at the current
+// line, whose lines are indented by indent.
+func (p *parser) parseBlock(indent int) (*node, error) {
+	l := p.lines[p.pos]
+	if strings.HasPrefix(l.text, "\t") {
+		return nil, fmt.Errorf("line %d: tabs can't indent YAML", l.num)
+	}
+	if isDash(l.text) {
+		return p.parseSeq(indent)
+	}
+	if _, _, ok, err := splitKey(l.text); err != nil {
+		return nil, fmt.Errorf("line %d: %v", l.num, err)
+	} else if ok {
+		return p.parseMap(indent)
+	}
+	p.pos++
+	n, err := scalar(l.text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", l.num, err)
+	}
+	return n, nil
+}
+
+func (p *parser) parseMap(indent int) (*node, error) {
+	n := &node{object: true}
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent; p.skipBlank() {
+		l := p.lines[p.pos]
+		key, rest, ok, err := splitKey(l.text)
+		if err != nil || !ok || strings.HasPrefix(l.text, "\t") {
+			return nil, fmt.Errorf("line %d: expected a key", l.num)
+		}
+		p.pos++
+		item, err := p.parseValue(l, rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key)
+		n.items = append(n.items, item)
+	}
+	return n, nil
+}
+
+func (p *parser) parseSeq(indent int) (*node, error) {
+	n := &node{array: true}
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isDash(p.lines[p.pos].text); p.skipBlank() {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if _, _, ok, _ := splitKey(rest); ok || isDash(rest) {
+			// A mapping or sequence starting on the dash's line: reread
+			// the line indented to where it starts.
+			p.lines[p.pos] = line{num: l.num, indent: indent + len(l.text) - len(rest), text: rest}
+			item, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+			continue
+		}
+		p.pos++
+		item, err := p.parseValue(l, rest, indent, false)
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	return n, nil
+}
+
+// parseValue reads what follows a key or dash on line l: rest, or the
+// block on the lines below. Under a key, a sequence may sit at the key's
+// own indentation.
+func (p *parser) parseValue(l line, rest string, indent int, key bool) (*node, error) {
+	switch rest {
+	case "|", "|-", "|+":
+		return p.parseLiteral(rest, indent), nil
+	case "":
+		p.skipBlank()
+		if p.pos == len(p.lines) {
+			return &node{scalar: "null"}, nil
+		}
+		next := p.lines[p.pos]
+		if next.indent > indent || key && next.indent == indent && isDash(next.text) {
+			return p.parseBlock(next.indent)
+		}
+		return &node{scalar: "null"}, nil
+	}
+	n, err := scalar(rest)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", l.num, err)
+	}
+	return n, nil
+}
+
+// parseLiteral reads a "|" block scalar more indented than indent.
+func (p *parser) parseLiteral(style string, indent int) *node {
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		l := p.lines[p.pos]
+		if l.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if l.indent <= indent || blockIndent >= 0 && l.indent < blockIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = l.indent
+		}
+		lines = append(lines, strings.Repeat(" ", l.indent-blockIndent)+l.text)
+	}
+	// Blank lines after the block belong to what follows, unless kept.
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	p.pos -= trailing
+	s := strings.Join(lines, "\n")
+	switch {
+	case s == "":
+	case style == "|":
+		s += "\n"
+	case style == "|+":
+		s += strings.Repeat("\n", trailing+1)
+	}
+	b, _ := json.Marshal(s)
+	return &node{scalar: string(b)}
+}
+
+// splitKey splits "key: value" into the key and the rest. ok is false when
+// text is not a mapping entry.
+func splitKey(text string) (key, rest string, ok bool, err error) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		s, n, err := quoted(text)
+		if err != nil {
+			return "", "", false, err
+		}
+		after := text[n:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		return s, strings.TrimSpace(after[1:]), true, nil
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "#") {
+		return "", "", false, nil
+	}
+	i := strings.Index(text, ": ")
+	if strings.HasSuffix(text, ":") && (i < 0 || i == len(text)-1) {
+		i = len(text) - 1
+	}
+	if i <= 0 {
+		return "", "", false, nil
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true, nil
+}
+
+// quoted reads the quoted string text starts with and returns it and the
+// number of bytes it took.
+func quoted(text string) (string, int, error) {
+	if text[0] == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] != '\'' {
+				b.WriteByte(text[i])
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		}
+		return "", 0, fmt.Errorf("unterminated string")
+	}
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			var s string
+			if err := json.Unmarshal([]byte(text[:i+1]), &s); err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", text[:i+1])
+			}
+			return s, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// scalar converts a value written on one line to JSON.
+func scalar(text string) (*node, error) {
+	switch {
+	case strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'"):
+		s, n, err := quoted(text)
+		if err != nil {
+			return nil, err
+		}
+		if after := strings.TrimSpace(text[n:]); after != "" && !strings.HasPrefix(after, "#") {
+			return nil, fmt.Errorf("unexpected %q after a string", after)
+		}
+		b, _ := json.Marshal(s)
+		return &node{scalar: string(b)}, nil
+	case strings.HasPrefix(text, "{") || strings.HasPrefix(text, "["):
+		// Flow collections are read as JSON.
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		n, err := decodeJSON(dec)
+		if err != nil {
+			return nil, fmt.Errorf("flow collections must be JSON: %v", err)
+		}
+		return n, nil
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return &node{scalar: "null"}, nil
+	case "true", "True", "TRUE":
+		return &node{scalar: "true"}, nil
+	case "false", "False", "FALSE":
+		return &node{scalar: "false"}, nil
+	}
+	if jsonNumber.MatchString(text) {
+		return &node{scalar: text}, nil
+	}
+	b, _ := json.Marshal(text)
+	return &node{scalar: string(b)}, nil
+}
+
+func writeJSON(buf *bytes.Buffer, n *node) {
+	switch {
+	case n.object:
+		buf.WriteByte('{')
+		for i, key := range n.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			b, _ := json.Marshal(key)
+			buf.Write(b)
+			buf.WriteByte(':')
+			writeJSON(buf, n.items[i])
+		}
+		buf.WriteByte('}')
+	case n.array:
+		buf.WriteByte('[')
+		for i, item := range n.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, item)
+		}
+		buf.WriteByte(']')
+	default:
+		buf.WriteString(n.scalar)
+	}
+}
@@ -0,0 +1,84 @@
+package yaml
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	doc := `{
+		"version": 1,
+		"sites": [
+			{"id": "app.example.com", "ssl": true, "upstreams": ["app:8080", "app-2:8080"], "headers": {"X-Env": "prod", "yes": "reserved"}, "firewall": {}, "aliases": []},
+			{"id": "api.example.com", "ssl": false, "upstreams": null, "rate": 1.5e3, "note": "a: b # not a comment"}
+		],
+		"templates": [
+			{"name": "gzip", "content": "gzip on;\n\tgzip_types text/css;\n\nlocation / {\n    proxy_pass http://x;\n}\n"},
+			{"name": "no-newline", "content": "a\nb"},
+			{"name": "awkward", "content": " leading space\nline\n\n"}
+		],
+		"nested": [[1, 2], [], [{"a": {"b": [true]}}]],
+		"empty": ""
+	}`
+	out, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "    content: |\n      gzip on;\n      \tgzip_types text/css;\n\n") {
+		t.Errorf("Expected multi-line strings as literal blocks:\n%s", out)
+	}
+	if !strings.Contains(string(out), `"yes": "reserved"`) {
+		t.Errorf("Expected a reserved word key to be quoted:\n%s", out)
+	}
+	back, err := ToJSON(out)
+	if err != nil {
+		t.Fatalf("ToJSON: %v\n%s", err, out)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(doc), &want)
+	if err := json.Unmarshal(back, &got); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", back, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Round trip changed the document:\n%s\n%s", out, back)
+	}
+	if !strings.HasPrefix(string(back), `{"version":1,"sites":[{"id":"app.example.com"`) {
+		t.Errorf("Expected key order to be kept: %s", back)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct{ yaml, json string }{
+		{"---\n# hand written\nid: app  # trailing comment\nport: 8080\nssl: True\nratio: 1.5\nversion: 1.2.3\nempty:\nnone: ~\n", `{"id":"app","port":8080,"ssl":true,"ratio":1.5,"version":"1.2.3","empty":null,"none":null}`},
+		{"upstreams:\n- a:80\n- 'b:80'\n- \"c:80\"\n", `{"upstreams":["a:80","b:80","c:80"]}`},
+		{"sites:\n  - id: one\n    tags: [\"x\", \"y\"]\n  - id: two\n    headers: {}\n", `{"sites":[{"id":"one","tags":["x","y"]},{"id":"two","headers":{}}]}`},
+		{"content: |-\n  line one\n    indented\n\n  last\nnext: 'it''s'\n", `{"content":"line one\n  indented\n\nlast","next":"it's"}`},
+		{"content: |\n  kept\n\n\nnext: 1\n", `{"content":"kept\n","next":1}`},
+		{"- - 1\n  - 2\n-\n  a: 1\n", `[[1,2],{"a":1}]`},
+		{"", `null`},
+	}
+	for _, tt := range tests {
+		got, err := ToJSON([]byte(tt.yaml))
+		if err != nil {
+			t.Errorf("ToJSON(%q): %v", tt.yaml, err)
+			continue
+		}
+		if string(got) != tt.json {
+			t.Errorf("ToJSON(%q) = %s, want %s", tt.yaml, got, tt.json)
+		}
+	}
+
+	for _, bad := range []string{
+		"a: 1\n  b: 2\n",
+		"a:\n\tb: 1\n",
+		"a: \"unterminated\n",
+		"a: [1, 2\n",
+		"a: \"x\" y\n",
+	} {
+		if got, err := ToJSON([]byte(bad)); err == nil {
+			t.Errorf("ToJSON(%q) = %s, want an error", bad, got)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Hashes the request headers listed in $hubfly_audit_hash for the per-site
+// audit log, so abuse can be correlated across requests without storing
+// raw credentials on disk.
+var crypto = require('crypto');
+
+function hashHeaders(r) {
+    var names = r.variables.hubfly_audit_hash;
+    if (!names) {
+        return '';
+    }
+
+    var out = [];
+    names.split(',').forEach(function (name) {
+        var value = r.headersIn[name];
+        if (value === undefined) {
+            out.push(name + '=-');
+            return;
+        }
+        var digest = crypto.createHash('sha256').update(value).digest('hex');
+        out.push(name + '=' + digest.substring(0, 16));
+    });
+    return out.join(',');
+}
+
+export default { hashHeaders };
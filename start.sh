@@ -20,4 +20,5 @@ goaccess /var/log/hubfly/access.log --config-file=/etc/goaccess.conf --daemon
 
 # Start Hubfly
 echo "Starting Hubfly..."
-exec /usr/local/bin/hubfly --config-dir /etc/hubfly
+# Extra arguments (e.g. --acme-server) are passed through to hubfly
+exec /usr/local/bin/hubfly --config-dir /etc/hubfly "$@"
@@ -0,0 +1,265 @@
+//go:build integration
+
+// Package integration runs hubfly end to end: real nginx and certbot inside
+// the hubfly image, a Pebble ACME server for certificates and a plain HTTP
+// backend. The environment is described by docker-compose.yml and requires
+// docker with the compose plugin.
+//
+//	make integration
+//
+// Set HUBFLY_IT_KEEP=1 to leave the containers running after the tests.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+const (
+	project = "hubfly-it"
+	// backend is the upstream container as seen from hubfly.
+	backend = "backend:80"
+	// streamPort is the stream listener published by docker-compose.yml.
+	streamPort = 30001
+)
+
+// env is the running environment, shared by all tests in the package.
+var env *Env
+
+// Env holds the host-side addresses of the published hubfly ports.
+type Env struct {
+	API    string // base URL of the management API
+	HTTP   string // host:port of nginx :80
+	HTTPS  string // host:port of nginx :443
+	Stream string // host:port of the published stream listener
+}
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		fmt.Println("docker not found, skipping integration tests")
+		os.Exit(0)
+	}
+
+	env = &Env{
+		API:    "http://127.0.0.1:" + getenv("HUBFLY_IT_API_PORT", "18081"),
+		HTTP:   "127.0.0.1:" + getenv("HUBFLY_IT_HTTP_PORT", "18080"),
+		HTTPS:  "127.0.0.1:" + getenv("HUBFLY_IT_HTTPS_PORT", "18443"),
+		Stream: "127.0.0.1:" + getenv("HUBFLY_IT_STREAM_PORT", "13001"),
+	}
+
+	if err := up(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start integration environment:", err)
+		down()
+		os.Exit(1)
+	}
+	code := m.Run()
+	if code != 0 {
+		// Keep the proxy logs next to the failure.
+		compose("logs", "--no-color", "--tail", "200", "hubfly")
+	}
+	if os.Getenv("HUBFLY_IT_KEEP") == "" {
+		down()
+	}
+	os.Exit(code)
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// compose runs docker compose against this directory's compose file.
+func compose(args ...string) error {
+	args = append([]string{"compose", "-p", project, "-f", "docker-compose.yml"}, args...)
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func up() error {
+	if err := compose("up", "-d", "--build"); err != nil {
+		return err
+	}
+	// certbot must trust Pebble's directory certificate; copy its CA into
+	// the hubfly container where REQUESTS_CA_BUNDLE points.
+	dir, err := os.MkdirTemp("", "hubfly-it")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "pebble.minica.pem")
+	if err := compose("cp", "pebble:/test/certs/pebble.minica.pem", ca); err != nil {
+		return fmt.Errorf("copy pebble CA: %w", err)
+	}
+	if err := compose("cp", ca, "hubfly:/etc/hubfly/pebble.minica.pem"); err != nil {
+		return fmt.Errorf("install pebble CA: %w", err)
+	}
+
+	return poll(2*time.Minute, func() error {
+		resp, err := http.Get(env.API + "/v1/health")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("health returned %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+func down() {
+	compose("down", "-v", "--remove-orphans")
+}
+
+// poll calls fn until it succeeds or timeout passes, returning the last error.
+func poll(timeout time.Duration, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// eventually fails the test if fn does not succeed within timeout.
+func eventually(t *testing.T, timeout time.Duration, fn func() error) {
+	t.Helper()
+	if err := poll(timeout, fn); err != nil {
+		t.Fatalf("condition not met after %s: %v", timeout, err)
+	}
+}
+
+// call sends a JSON request to the API and decodes the response into out
+// (when non-nil). It returns the status code.
+func (e *Env) call(t *testing.T, method, path string, body, out interface{}) int {
+	t.Helper()
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, e.API+path, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// createSite posts the site and waits until provisioning has finished.
+func (e *Env) createSite(t *testing.T, site models.Site) *models.Site {
+	t.Helper()
+	if code := e.call(t, http.MethodPost, "/v1/sites", site, nil); code != http.StatusCreated {
+		t.Fatalf("create site %s: status %d", site.Domain, code)
+	}
+	t.Cleanup(func() { e.call(t, http.MethodDelete, "/v1/sites/"+site.Domain, nil, nil) })
+	return e.waitSite(t, site.Domain, 2*time.Minute)
+}
+
+// waitSite waits for a site to leave the "provisioning" state and fails the
+// test if it ends in an error.
+func (e *Env) waitSite(t *testing.T, id string, timeout time.Duration) *models.Site {
+	t.Helper()
+	var site models.Site
+	eventually(t, timeout, func() error {
+		site = models.Site{}
+		if code := e.call(t, http.MethodGet, "/v1/sites/"+id, nil, &site); code != 200 {
+			return fmt.Errorf("get site: status %d", code)
+		}
+		if site.Status == "provisioning" {
+			return fmt.Errorf("site %s still provisioning", id)
+		}
+		return nil
+	})
+	if site.Status != "active" {
+		t.Fatalf("site %s: status %q: %s", id, site.Status, site.ErrorMessage)
+	}
+	return &site
+}
+
+// get requests path from nginx with the given Host header.
+func (e *Env) get(host, path string) (int, string, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+e.HTTP+path, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Host = host
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return do(client, req)
+}
+
+// getTLS requests path over HTTPS with host as SNI and Host header. The
+// certificate is not verified; tests inspect it through the returned state.
+func (e *Env) getTLS(host, path string) (int, string, *tls.ConnectionState, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: host, InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, e.HTTPS)
+			},
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+path, nil)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), resp.TLS, err
+}
+
+func do(client *http.Client, req *http.Request) (int, string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
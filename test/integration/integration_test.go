@@ -0,0 +1,129 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hubfly/hubfly-reverse-proxy/internal/models"
+)
+
+// whoami echoes the request, so a proxied response contains "Host: <domain>".
+func proxied(domain string) func() error {
+	return func() error {
+		code, body, err := env.get(domain, "/")
+		if err != nil {
+			return err
+		}
+		if code != 200 || !strings.Contains(body, "Host: "+domain) {
+			return fmt.Errorf("GET %s: status %d, body %q", domain, code, body)
+		}
+		return nil
+	}
+}
+
+func TestSiteLifecycle(t *testing.T) {
+	const domain = "lifecycle.hubfly.test"
+	env.createSite(t, models.Site{Domain: domain, Upstreams: []string{backend}})
+	eventually(t, 30*time.Second, proxied(domain))
+
+	// Update: block a path through the firewall.
+	patch := map[string]interface{}{
+		"firewall": models.FirewallConfig{BlockRules: &models.BlockRules{Paths: []string{"^/private"}}},
+	}
+	if code := env.call(t, http.MethodPatch, "/v1/sites/"+domain, patch, nil); code != 200 {
+		t.Fatalf("patch site: status %d", code)
+	}
+	env.waitSite(t, domain, time.Minute)
+	eventually(t, 30*time.Second, func() error {
+		code, _, err := env.get(domain, "/private/area")
+		if err != nil {
+			return err
+		}
+		if code != http.StatusForbidden {
+			return fmt.Errorf("blocked path: status %d, want 403", code)
+		}
+		return nil
+	})
+	eventually(t, 10*time.Second, proxied(domain))
+
+	// Delete: the domain falls through to the default server.
+	if code := env.call(t, http.MethodDelete, "/v1/sites/"+domain, nil, nil); code != 200 {
+		t.Fatalf("delete site: status %d", code)
+	}
+	eventually(t, 30*time.Second, func() error {
+		if err := proxied(domain)(); err == nil {
+			return fmt.Errorf("%s is still proxied after delete", domain)
+		}
+		return nil
+	})
+}
+
+func TestStream(t *testing.T) {
+	stream := models.Stream{ListenPort: streamPort, Upstream: backend, Protocol: "tcp"}
+	var created models.Stream
+	if code := env.call(t, http.MethodPost, "/v1/streams", stream, &created); code != http.StatusCreated {
+		t.Fatalf("create stream: status %d", code)
+	}
+	t.Cleanup(func() { env.call(t, http.MethodDelete, "/v1/streams/"+created.ID, nil, nil) })
+
+	// Speak HTTP over the raw TCP stream.
+	eventually(t, time.Minute, func() error {
+		conn, err := net.DialTimeout("tcp", env.Stream, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprint(conn, "GET / HTTP/1.0\r\nHost: stream.hubfly.test\r\n\r\n")
+		status, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(status, " 200 ") {
+			return fmt.Errorf("stream: unexpected status line %q", status)
+		}
+		return nil
+	})
+}
+
+func TestCertificateIssuance(t *testing.T) {
+	const domain = "tls.hubfly.test"
+	site := env.createSite(t, models.Site{Domain: domain, Upstreams: []string{backend}, SSL: true, ForceSSL: true})
+	if site.CertIssueStatus != "valid" {
+		t.Fatalf("cert_issue_status = %q: %s", site.CertIssueStatus, site.ErrorMessage)
+	}
+
+	eventually(t, 30*time.Second, func() error {
+		code, body, state, err := env.getTLS(domain, "/")
+		if err != nil {
+			return err
+		}
+		if code != 200 || !strings.Contains(body, "Host: "+domain) {
+			return fmt.Errorf("GET https://%s: status %d, body %q", domain, code, body)
+		}
+		leaf := state.PeerCertificates[0]
+		if err := leaf.VerifyHostname(domain); err != nil {
+			return err
+		}
+		if !strings.Contains(leaf.Issuer.CommonName, "Pebble") {
+			return fmt.Errorf("certificate issued by %q, want Pebble", leaf.Issuer.CommonName)
+		}
+		return nil
+	})
+
+	// force_ssl redirects plain HTTP.
+	code, _, err := env.get(domain, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+		t.Fatalf("http with force_ssl: status %d, want redirect", code)
+	}
+}